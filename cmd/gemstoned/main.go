@@ -1,33 +1,51 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/PrismManager/gemstone/internal/daemon"
+	"github.com/PrismManager/gemstone/internal/process"
+	"github.com/PrismManager/gemstone/internal/sandbox"
 )
 
 func main() {
+	// Sandboxed processes are started through the daemon binary, which
+	// applies capabilities and seccomp profiles and then execs the command
+	sandbox.Init()
+
+	// --chaos is left out of the usage, it's meant for test setups only
+	chaos := flag.String("chaos", "", "")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s\n", os.Args[0])
+	}
+	flag.Parse()
+
 	d, err := daemon.New()
 	if err != nil {
 		log.Fatalf("Failed to initialize daemon: %v", err)
 	}
 
-	// Handle shutdown signals
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	if *chaos != "" {
+		cfg, err := process.ParseChaos(*chaos)
+		if err != nil {
+			log.Fatalf("Invalid --chaos: %v", err)
+		}
+		d.EnableChaos(cfg)
+	}
 
-	go func() {
-		<-sigChan
-		log.Println("Shutting down gemstone daemon...")
-		d.Shutdown()
-		os.Exit(0)
-	}()
+	// Handle shutdown signals
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	log.Println("Starting gemstone daemon...")
-	if err := d.Run(); err != nil {
+	if err := d.Run(ctx); err != nil {
 		log.Fatalf("Daemon error: %v", err)
 	}
+	log.Println("Gemstone daemon stopped")
 }
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/PrismManager/gemstone/internal/auth"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// identityKey is the context key of the authenticated *auth.Identity
+const identityKey = "identity"
+
+// authMiddleware authorizes unix socket peers by their credentials and
+// otherwise accepts the static auth tokens or, when configured, a JWT from
+// the identity provider. Viewers may only use read-only endpoints.
+func (s *Server) authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := s.authenticate(c)
+		if identity == nil {
+			c.JSON(http.StatusUnauthorized, types.Response{
+				Success: false,
+				Error:   "unauthorized",
+			})
+			c.Abort()
+			return
+		}
+		identity.Namespaces = s.config.OwnedNamespaces(identity.Name)
+
+		c.Set(tokenNameKey, identity.Name)
+		c.Set(identityKey, identity)
+
+		if !identity.CanWrite() && !isReadOnly(c.Request.Method) {
+			c.JSON(http.StatusForbidden, types.Response{
+				Success: false,
+				Error:   "forbidden: role " + identity.Role + " is read-only",
+			})
+			c.Abort()
+			return
+		}
+
+		if mutates(c, s.config.API.Prefix()) && s.lockedOut(c) {
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// lockedOut answers a request that would make changes with 423 Locked during
+// a lockdown, unless the identity may override it
+func (s *Server) lockedOut(c *gin.Context) bool {
+	if !s.manager.Lockdown() || identity(c).LockdownOverride {
+		return false
+	}
+	c.JSON(http.StatusLocked, types.Response{
+		Success: false,
+		Error:   "locked down: the API is read-only until the lockdown is lifted",
+	})
+	return true
+}
+
+// mutates reports whether a request may change anything during a lockdown.
+// Lifting the lockdown, annotations and requests that only compute an
+// answer, such as dry runs of the routes that support them, are let
+// through. An apply checks the lockdown itself, since its dry run flag is
+// in the body. prefix is the base path of the API.
+func mutates(c *gin.Context, prefix string) bool {
+	if isReadOnly(c.Request.Method) {
+		return false
+	}
+	switch strings.TrimPrefix(c.FullPath(), prefix) {
+	case "/api/v1/daemon/lockdown", "/api/v1/daemon/unlock",
+		"/api/v1/snapshot/diff", "/api/v1/processes/:id/simulate",
+		"/api/v1/processes/:id/annotations", "/api/v1/apply":
+		return false
+	case "/api/v1/processes", "/api/v1/processes/:id/restart":
+		return !dryRun(c)
+	}
+	return true
+}
+
+// authenticate resolves the identity of the client making a request
+func (s *Server) authenticate(c *gin.Context) *auth.Identity {
+	if conn, ok := socketPeer(c.Request.Context()); ok {
+		if s.peerAllowed(conn) {
+			role := conn.sock.Role
+			if role == "" {
+				role = auth.RoleAdmin
+			}
+			return &auth.Identity{Name: fmt.Sprintf("uid:%d", conn.cred.UID), Role: role}
+		}
+		// Other local users need a token even if TCP clients don't
+		return s.authenticateToken(authorization(c))
+	}
+
+	if !s.authRequired() {
+		return &auth.Identity{Role: auth.RoleAdmin}
+	}
+
+	return s.authenticateToken(authorization(c))
+}
+
+// authorization returns the Authorization header of a request. Browsers
+// can't set headers on WebSockets, so those may pass the token as the
+// access_token query parameter instead.
+func authorization(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); header != "" || !isWebSocket(c) {
+		return header
+	}
+	if token := c.Query("access_token"); token != "" {
+		return "Bearer " + token
+	}
+	return ""
+}
+
+// authRequired reports whether TCP clients must authenticate
+func (s *Server) authRequired() bool {
+	return s.config.API.AuthToken != "" || len(s.config.API.Tokens) > 0 || s.jwt != nil
+}
+
+// authenticateToken resolves the identity behind an Authorization header
+func (s *Server) authenticateToken(header string) *auth.Identity {
+	token := strings.TrimPrefix(header, "Bearer ")
+	if token == "" || token == header {
+		return nil
+	}
+
+	if s.config.API.AuthToken != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(s.config.API.AuthToken)) == 1 {
+		return &auth.Identity{Name: "default", Role: auth.RoleAdmin}
+	}
+
+	for _, t := range s.config.API.Tokens {
+		if t.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			role := t.Role
+			if role == "" {
+				role = auth.RoleAdmin
+			}
+			return &auth.Identity{Name: t.Name, Role: role, LockdownOverride: t.LockdownOverride}
+		}
+	}
+
+	if s.jwt != nil {
+		identity, err := s.jwt.Validate(token)
+		if err == nil {
+			return identity
+		}
+		log.Printf("api: rejected JWT: %v", err)
+	}
+
+	return nil
+}
+
+// identity returns the authenticated identity of a request
+func identity(c *gin.Context) *auth.Identity {
+	if v, ok := c.Get(identityKey); ok {
+		if id, ok := v.(*auth.Identity); ok {
+			return id
+		}
+	}
+	return &auth.Identity{}
+}
+
+// processAccessMiddleware hides processes outside the caller's namespaces.
+// They are reported as not found so tenants can't probe each other.
+func (s *Server) processAccessMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info := s.manager.Get(c.Param("id"))
+		if info == nil || !identity(c).CanAccess(info.Namespace) {
+			c.JSON(http.StatusNotFound, types.Response{
+				Success: false,
+				Error:   "process not found",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func isReadOnly(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
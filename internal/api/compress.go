@@ -0,0 +1,105 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// minGzipSize is the smallest response body worth compressing
+const minGzipSize = 1024
+
+// bufferedWriter holds back a response so it can be tagged and compressed
+// once complete
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int)              { w.status = code }
+func (w *bufferedWriter) WriteHeaderNow()                   {}
+func (w *bufferedWriter) Write(b []byte) (int, error)       { return w.body.Write(b) }
+func (w *bufferedWriter) WriteString(s string) (int, error) { return w.body.WriteString(s) }
+func (w *bufferedWriter) Status() int                       { return w.status }
+func (w *bufferedWriter) Size() int                         { return w.body.Len() }
+func (w *bufferedWriter) Written() bool                     { return w.body.Len() > 0 }
+
+// cacheMiddleware tags successful responses with an ETag, answers 304 Not
+// Modified when it matches If-None-Match, and compresses them with gzip
+// for clients accepting it. Streams with follow=true or format=ndjson are
+// passed through.
+func cacheMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("follow") == "true" || wantsNDJSON(c) || isWebSocket(c) {
+			c.Next()
+			return
+		}
+
+		w := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		body := w.body.Bytes()
+		if w.status != http.StatusOK {
+			c.Writer.WriteHeader(w.status)
+			_, _ = c.Writer.Write(body)
+			return
+		}
+
+		// The tag is of the uncompressed body, so it is weak
+		sum := sha256.Sum256(body)
+		etag := fmt.Sprintf(`W/"%x"`, sum[:16])
+		c.Header("ETag", etag)
+		c.Header("Vary", "Accept-Encoding")
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			c.Writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if len(body) < minGzipSize || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Writer.WriteHeader(http.StatusOK)
+			_, _ = c.Writer.Write(body)
+			return
+		}
+
+		c.Header("Content-Encoding", "gzip")
+		c.Writer.Header().Del("Content-Length")
+		c.Writer.WriteHeader(http.StatusOK)
+		gz := gzip.NewWriter(c.Writer)
+		_, _ = gz.Write(body)
+		_ = gz.Close()
+	}
+}
+
+// etagMatches compares an If-None-Match header to an ETag, weakly
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip tells whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, enc := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.TrimSpace(name) == "gzip" {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
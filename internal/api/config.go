@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// getConfig returns the effective configuration of the daemon with the
+// source of each value. Secrets are redacted.
+func (s *Server) getConfig(c *gin.Context) {
+	// The config describes every namespace, so tenants can't read it
+	if identity(c).Namespaces != nil {
+		c.JSON(http.StatusForbidden, types.Response{
+			Success: false,
+			Error:   "forbidden: reading the configuration requires daemon-wide access",
+		})
+		return
+	}
+
+	settings, err := s.config.Effective()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Data:    settings,
+	})
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// defaultEventLimit is the number of recent events returned unless limit is
+// given
+const defaultEventLimit = 50
+
+func (s *Server) getEvents(c *gin.Context) {
+	s.serveEvents(c, "")
+}
+
+func (s *Server) getProcessEvents(c *gin.Context) {
+	// The process may have been deleted since the access check
+	info := s.manager.Get(c.Param("id"))
+	if info == nil {
+		c.JSON(http.StatusNotFound, types.Response{
+			Success: false,
+			Error:   "process not found",
+		})
+		return
+	}
+	s.serveEvents(c, info.ID)
+}
+
+// serveEvents lists recent events, of one process if processID is set. With
+// follow=true the response is a stream of newline-delimited JSON events,
+// starting with the recent ones, that lasts until the client disconnects.
+// A WebSocket upgrade request gets the same stream as WebSocket messages.
+func (s *Server) serveEvents(c *gin.Context, processID string) {
+	limit := defaultEventLimit
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, types.Response{
+				Success: false,
+				Error:   "limit must be a non-negative number",
+			})
+			return
+		}
+		limit = n
+	}
+
+	var eventTypes map[types.EventType]bool
+	if t := c.Query("type"); t != "" {
+		eventTypes = make(map[types.EventType]bool)
+		for _, name := range strings.Split(t, ",") {
+			eventTypes[types.EventType(strings.TrimSpace(name))] = true
+		}
+	}
+
+	id := identity(c)
+	match := func(e types.Event) bool {
+		if processID != "" && e.ProcessID != processID {
+			return false
+		}
+		// Daemon-wide events like pause are visible to everyone
+		if e.ProcessID != "" && !id.CanAccess(e.Namespace) {
+			return false
+		}
+		return eventTypes == nil || eventTypes[e.Type]
+	}
+
+	if isWebSocket(c) {
+		s.serveEventSocket(c, limit, match)
+		return
+	}
+	if c.Query("follow") != "true" {
+		c.JSON(http.StatusOK, types.Response{
+			Success: true,
+			Data:    s.manager.Events().Recent(limit, match),
+		})
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	s.streamEvents(c.Request.Context(), limit, match, func(e types.Event) error {
+		return enc.Encode(e)
+	}, c.Writer.Flush)
+}
+
+// streamEvents sends up to limit recent events that match and then new ones
+// as they are published, until ctx is done or send fails. flush is called
+// after the recent events and after each new one.
+func (s *Server) streamEvents(ctx context.Context, limit int, match func(types.Event) bool, send func(types.Event) error, flush func()) {
+	bus := s.manager.Events()
+
+	// Subscribe first so no event published in between is lost
+	ch, cancel := bus.Subscribe()
+	defer cancel()
+
+	sent := make(map[string]bool)
+	for _, e := range bus.Recent(limit, match) {
+		sent[e.ID] = true
+		if err := send(e); err != nil {
+			return
+		}
+	}
+	flush()
+
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if sent[e.ID] {
+				delete(sent, e.ID)
+				continue
+			}
+			if !match(e) {
+				continue
+			}
+			if err := send(e); err != nil {
+				return
+			}
+			flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
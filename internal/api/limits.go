@@ -0,0 +1,50 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// streamRetryAfter is the Retry-After sent when streaming requests are
+// rejected, in seconds
+const streamRetryAfter = "5"
+
+// streamLimitMiddleware rejects streaming requests while max of them are
+// running, so followers and watchers can't pile up goroutines without
+// bound. A max of 0 allows any number.
+func (s *Server) streamLimitMiddleware(max int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isStreaming(c) {
+			c.Next()
+			return
+		}
+
+		if n := s.streams.Add(1); max > 0 && n > int64(max) {
+			s.streams.Add(-1)
+			c.Header("Retry-After", streamRetryAfter)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, types.Response{
+				Success: false,
+				Error:   fmt.Sprintf("too many streaming requests, at most %d at a time", max),
+			})
+			return
+		}
+		defer s.streams.Add(-1)
+
+		c.Next()
+	}
+}
+
+// isStreaming tells whether a request holds its connection open to stream
+// or wait for changes
+func isStreaming(c *gin.Context) bool {
+	return c.Query("follow") == "true" || c.Query("watch") == "true" || wantsNDJSON(c) || isWebSocket(c)
+}
+
+// Streams returns the number of streaming requests being served
+func (s *Server) Streams() int {
+	return int(s.streams.Load())
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/PrismManager/gemstone/internal/logger"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// followLogs streams the last lines of a log, or those after a sequence
+// number if after is set, and then the captured ones as newline-delimited
+// JSON until the client disconnects or the process is deleted. A slow
+// client misses lines, counted in dropped_lines, rather than slowing down
+// capture.
+func (s *Server) followLogs(c *gin.Context, id string, lines int, logType string, filter *logger.Filter, after *uint64) {
+	// Subscribe first so no line captured in between is lost, lines already
+	// sent are skipped by their sequence number
+	stream, cancel, err := s.manager.SubscribeLogs(id, logType)
+	if err != nil {
+		c.JSON(http.StatusNotFound, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer cancel()
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+
+	var last uint64
+	send := func(line string) error {
+		seq := logger.LineSeq(line)
+		last = max(last, seq)
+		return enc.Encode(types.LogStreamMessage{Line: line, Seq: seq})
+	}
+	switch {
+	case after != nil:
+		last = *after
+		err = s.manager.StreamLogsAfter(id, logType, *after, filter, send)
+	case lines > 0:
+		err = s.manager.StreamLogs(id, lines, logType, 0, filter, send)
+	}
+	if err != nil {
+		return
+	}
+	c.Writer.Flush()
+
+	done := c.Request.Context().Done()
+	for {
+		batch, ok := stream.Read(done)
+		if !ok {
+			return
+		}
+		dropped := stream.Dropped()
+		for _, line := range batch {
+			seq := logger.LineSeq(line)
+			if seq <= last || !filter.Match(line) {
+				continue
+			}
+			last = seq
+			if err := enc.Encode(types.LogStreamMessage{Line: line, Seq: seq, DroppedLines: dropped}); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
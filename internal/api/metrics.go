@@ -0,0 +1,78 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// metricsContentType is the Prometheus text exposition format
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// processMetric is a metric exported for each running process
+type processMetric struct {
+	name   string
+	kind   string // gauge or counter
+	help   string
+	labels string // extra labels, e.g. mode="user"
+	value  func(s *types.ProcessStats) float64
+}
+
+var processMetrics = []processMetric{
+	{"gemstone_process_cpu_percent", "gauge", "CPU usage of the process in percent", "", func(s *types.ProcessStats) float64 { return s.CPU }},
+	{"gemstone_process_cpu_seconds_total", "counter", "CPU time used by the run of the process in seconds", `mode="user"`, func(s *types.ProcessStats) float64 { return s.CPUUser }},
+	{"gemstone_process_cpu_seconds_total", "counter", "", `mode="system"`, func(s *types.ProcessStats) float64 { return s.CPUSystem }},
+	{"gemstone_process_memory_bytes", "gauge", "Resident memory of the process", "", func(s *types.ProcessStats) float64 { return float64(s.Memory) }},
+	{"gemstone_process_threads", "gauge", "Threads of the process", "", func(s *types.ProcessStats) float64 { return float64(s.NumThreads) }},
+	{"gemstone_process_open_fds", "gauge", "Open file descriptors of the process", "", func(s *types.ProcessStats) float64 { return float64(s.NumFDs) }},
+	{"gemstone_process_read_bytes_total", "counter", "Bytes the run of the process read from storage", "", func(s *types.ProcessStats) float64 { return float64(s.ReadBytes) }},
+	{"gemstone_process_write_bytes_total", "counter", "Bytes the run of the process wrote to storage", "", func(s *types.ProcessStats) float64 { return float64(s.WriteBytes) }},
+	{"gemstone_process_context_switches_total", "counter", "Context switches of the run of the process", `type="voluntary"`, func(s *types.ProcessStats) float64 { return float64(s.VoluntaryCtxSwitches) }},
+	{"gemstone_process_context_switches_total", "counter", "", `type="involuntary"`, func(s *types.ProcessStats) float64 { return float64(s.InvoluntaryCtxSwitches) }},
+	{"gemstone_process_page_faults_total", "counter", "Page faults of the run of the process", `type="minor"`, func(s *types.ProcessStats) float64 { return float64(s.MinorFaults) }},
+	{"gemstone_process_page_faults_total", "counter", "", `type="major"`, func(s *types.ProcessStats) float64 { return float64(s.MajorFaults) }},
+}
+
+// getMetrics exports the stats of the running processes the identity can
+// access in the Prometheus text format. Counters cover the current run and
+// start over when a process restarts.
+func (s *Server) getMetrics(c *gin.Context) {
+	id := identity(c)
+	procs := make(map[string]*types.ProcessInfo)
+	for _, p := range s.manager.List(false) {
+		if id.CanAccess(p.Namespace) {
+			procs[p.ID] = p
+		}
+	}
+
+	var b strings.Builder
+	stats := s.manager.AllStats()
+	for _, m := range processMetrics {
+		if m.help != "" {
+			fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		}
+		for _, st := range stats {
+			p, ok := procs[st.ID]
+			if !ok {
+				continue
+			}
+			labels := fmt.Sprintf(`name="%s",namespace="%s"`, escapeLabel(p.Name), escapeLabel(p.Namespace))
+			if m.labels != "" {
+				labels += "," + m.labels
+			}
+			fmt.Fprintf(&b, "%s{%s} %s\n", m.name, labels, strconv.FormatFloat(m.value(st), 'g', -1, 64))
+		}
+	}
+
+	c.Data(http.StatusOK, metricsContentType, []byte(b.String()))
+}
+
+// escapeLabel escapes a label value of the text format
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
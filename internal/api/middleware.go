@@ -0,0 +1,78 @@
+package api
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// requestIDHeader carries the request ID in requests and responses
+	requestIDHeader = "X-Request-ID"
+	// instanceHeader names the daemon answering a request
+	instanceHeader = "X-Gemstone-Instance"
+	// serverTimeHeader carries the daemon's clock when it got the request
+	serverTimeHeader = "X-Gemstone-Time"
+
+	// Context keys set by the middlewares
+	requestIDKey = "request_id"
+	tokenNameKey = "token_name"
+)
+
+// requestIDMiddleware assigns every request an ID, reusing one supplied by
+// the client, and echoes it in the response
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = uuid.New().String()
+		}
+
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// instanceMiddleware sets the daemon's instance ID and clock on every
+// response, so clients talking to many daemons through proxies can tell
+// which one answered and how far its clock is off
+func instanceMiddleware(id string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header(instanceHeader, id)
+		c.Header(serverTimeHeader, time.Now().UTC().Format(time.RFC3339Nano))
+		c.Next()
+	}
+}
+
+// accessLogMiddleware logs one structured line per API request
+func accessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		token := c.GetString(tokenNameKey)
+		if token == "" {
+			token = "-"
+		}
+
+		log.Printf("api: request_id=%s method=%s path=%s status=%d latency=%s token=%s client=%s",
+			c.GetString(requestIDKey),
+			c.Request.Method,
+			c.Request.URL.Path,
+			c.Writer.Status(),
+			time.Since(start).Round(time.Microsecond),
+			token,
+			c.ClientIP(),
+		)
+	}
+}
+
+// logRequestError records a failed operation in the daemon log together with
+// the ID of the API request that triggered it
+func logRequestError(c *gin.Context, action, target string, err error) {
+	log.Printf("api: request_id=%s %s %s failed: %v", c.GetString(requestIDKey), action, target, err)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ndjsonFlushEvery is how many items are written between flushes
+const ndjsonFlushEvery = 100
+
+// wantsNDJSON tells whether a history was requested as newline-delimited
+// JSON with format=ndjson
+func wantsNDJSON(c *gin.Context) bool {
+	return c.Query("format") == "ndjson"
+}
+
+// ndjsonWriter streams items as newline-delimited JSON, so long histories
+// aren't built in memory as one array
+type ndjsonWriter struct {
+	c   *gin.Context
+	enc *json.Encoder
+	n   int
+}
+
+func newNDJSONWriter(c *gin.Context) *ndjsonWriter {
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	return &ndjsonWriter{c: c, enc: json.NewEncoder(c.Writer)}
+}
+
+func (w *ndjsonWriter) write(v interface{}) error {
+	if err := w.enc.Encode(v); err != nil {
+		return err
+	}
+	if w.n++; w.n%ndjsonFlushEvery == 0 {
+		w.c.Writer.Flush()
+	}
+	return w.c.Request.Context().Err()
+}
+
+func (w *ndjsonWriter) close() {
+	w.c.Writer.Flush()
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package api
+
+import (
+	"fmt"
+	"net"
+)
+
+// getPeerCred is only supported on Linux, so socket peers always need a token
+func getPeerCred(conn net.Conn) (*peerCred, error) {
+	return nil, fmt.Errorf("peer credentials are not supported on this platform")
+}
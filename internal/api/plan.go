@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// dryRun tells whether a start or restart was requested with dry_run=true
+func dryRun(c *gin.Context) bool {
+	return c.Query("dry_run") == "true"
+}
+
+// servePlan answers a dry run with the resolved launch plan
+func (s *Server) servePlan(c *gin.Context, name string, plan func() (*types.LaunchPlan, error)) {
+	p, err := plan()
+	if err != nil {
+		logRequestError(c, "plan", name, err)
+		c.JSON(http.StatusBadRequest, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Message: "Dry run, nothing started",
+		Data:    p,
+	})
+}
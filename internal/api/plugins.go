@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// PluginCommandRequest represents a request to run a plugin command
+type PluginCommandRequest struct {
+	Args []string `json:"args,omitempty"`
+}
+
+func (s *Server) listPlugins(c *gin.Context) {
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Data:    s.plugins.List(),
+	})
+}
+
+func (s *Server) getPluginCollectors(c *gin.Context) {
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Data:    s.plugins.Collected(),
+	})
+}
+
+func (s *Server) runPluginCommand(c *gin.Context) {
+	// Plugins act on the whole daemon, so tenants can't use them
+	if identity(c).Namespaces != nil {
+		c.JSON(http.StatusForbidden, types.Response{
+			Success: false,
+			Error:   "forbidden: plugin commands require daemon-wide access",
+		})
+		return
+	}
+
+	var req PluginCommandRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, types.Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	name := c.Param("name")
+	result, err := s.plugins.RunCommand(name, c.Param("command"), req.Args)
+	if err != nil {
+		logRequestError(c, "plugin command", name, err)
+		c.JSON(http.StatusInternalServerError, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Data:    result,
+	})
+}
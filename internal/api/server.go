@@ -1,17 +1,33 @@
 package api
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/PrismManager/gemstone/internal/auth"
 	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/logger"
+	"github.com/PrismManager/gemstone/internal/plugin"
 	"github.com/PrismManager/gemstone/internal/process"
 	"github.com/PrismManager/gemstone/internal/stats"
 	"github.com/PrismManager/gemstone/internal/types"
+	"github.com/PrismManager/gemstone/internal/update"
 )
 
 // Server represents the API server
@@ -19,12 +35,21 @@ type Server struct {
 	config    *config.Config
 	manager   *process.Manager
 	collector *stats.Collector
-	server    *http.Server
+	servers   []*http.Server
 	router    *gin.Engine
+	jwt       *auth.JWTValidator
+	plugins   *plugin.Host
+	updates   *update.Checker
+	streams   atomic.Int64
+	startedAt time.Time
+
+	// mu guards the servers, started and stopped from different goroutines
+	mu            sync.Mutex
+	socketServers []*http.Server
 }
 
 // NewServer creates a new API server
-func NewServer(cfg *config.Config, manager *process.Manager, collector *stats.Collector) *Server {
+func NewServer(cfg *config.Config, manager *process.Manager, collector *stats.Collector, plugins *plugin.Host, updates *update.Checker) *Server {
 	gin.SetMode(gin.ReleaseMode)
 
 	router := gin.New()
@@ -36,6 +61,13 @@ func NewServer(cfg *config.Config, manager *process.Manager, collector *stats.Co
 		manager:   manager,
 		collector: collector,
 		router:    router,
+		plugins:   plugins,
+		updates:   updates,
+		startedAt: time.Now(),
+	}
+
+	if cfg.API.OIDC.Enabled() {
+		s.jwt = auth.NewJWTValidator(cfg.API.OIDC)
 	}
 
 	s.setupRoutes()
@@ -44,54 +76,166 @@ func NewServer(cfg *config.Config, manager *process.Manager, collector *stats.Co
 }
 
 func (s *Server) setupRoutes() {
+	s.router.Use(requestIDMiddleware())
+	s.router.Use(instanceMiddleware(s.config.API.InstanceID))
+
+	if s.config.API.AccessLog {
+		s.router.Use(accessLogMiddleware())
+	}
+
 	if s.config.API.EnableCORS {
 		s.router.Use(corsMiddleware())
 	}
 
-	if s.config.API.AuthToken != "" {
-		s.router.Use(authMiddleware(s.config.API.AuthToken))
-	}
+	s.router.Use(s.authMiddleware())
+	s.router.Use(s.streamLimitMiddleware(s.config.Daemon.Limits.MaxStreams))
 
-	api := s.router.Group("/api/v1")
+	// Lists, histories and logs get ETags and compression
+	cached := cacheMiddleware()
+
+	api := s.router.Group(s.config.API.Prefix() + "/api/v1")
 	{
 		api.GET("/health", s.healthCheck)
 		api.GET("/system", s.getSystemInfo)
 		api.GET("/system/stats", s.getSystemStats)
-		api.GET("/system/stats/history", s.getSystemStatsHistory)
-		api.GET("/processes", s.listProcesses)
+		api.GET("/system/stats/history", cached, s.getSystemStatsHistory)
+		api.GET("/daemon/stats", s.getDaemonStats)
+		api.POST("/daemon/pause", s.pauseDaemon)
+		api.POST("/daemon/resume", s.resumeDaemon)
+		api.POST("/daemon/lockdown", s.lockdownDaemon)
+		api.POST("/daemon/unlock", s.unlockDaemon)
+		api.GET("/processes", cached, s.listProcesses)
 		api.POST("/processes", s.startProcess)
-		api.GET("/processes/:id", s.getProcess)
-		api.DELETE("/processes/:id", s.deleteProcess)
-		api.POST("/processes/:id/stop", s.stopProcess)
-		api.POST("/processes/:id/restart", s.restartProcess)
-		api.GET("/processes/:id/stats", s.getProcessStats)
-		api.GET("/processes/:id/stats/history", s.getProcessStatsHistory)
-		api.GET("/processes/:id/logs", s.getProcessLogs)
+		api.POST("/apply", s.applyState)
+		api.GET("/snapshot", s.getSnapshot)
+		api.POST("/snapshot/diff", s.diffSnapshots)
+		api.GET("/events", cached, s.getEvents)
+		api.GET("/config", s.getConfig)
+		api.GET("/usage", cached, s.getUsage)
+		api.GET("/metrics", s.getMetrics)
+		api.GET("/namespaces", cached, s.listNamespaces)
+		api.GET("/targets", s.listTargets)
+		api.POST("/targets/:name/start", s.startTarget)
+		api.POST("/targets/:name/stop", s.stopTarget)
+		api.POST("/groups/:name/restart", s.restartGroup)
+	}
+
+	if s.plugins != nil {
+		api.GET("/plugins", s.listPlugins)
+		api.GET("/plugins/collectors", s.getPluginCollectors)
+		api.POST("/plugins/:name/commands/:command", s.runPluginCommand)
+	}
+
+	proc := api.Group("/processes/:id", s.processAccessMiddleware())
+	{
+		proc.GET("", s.getProcess)
+		proc.PATCH("", s.updateProcess)
+		proc.DELETE("", s.deleteProcess)
+		proc.POST("/stop", s.stopProcess)
+		proc.POST("/restart", s.restartProcess)
+		proc.POST("/reset", s.resetProcess)
+		proc.POST("/failover", s.failoverProcess)
+		proc.GET("/history", cached, s.getProcessHistory)
+		proc.GET("/annotations", cached, s.getProcessAnnotations)
+		proc.POST("/annotations", s.annotateProcess)
+		proc.GET("/runs", cached, s.getProcessRuns)
+		proc.GET("/events", cached, s.getProcessEvents)
+		proc.POST("/rollback", s.rollbackProcess)
+		proc.POST("/deploy", s.deployProcess)
+		proc.POST("/simulate", s.simulateProcess)
+		proc.GET("/stats", s.getProcessStats)
+		proc.GET("/stats/history", cached, s.getProcessStatsHistory)
+		proc.GET("/logs", cached, s.getProcessLogs)
+		proc.GET("/logs/download", s.downloadProcessLogs)
 	}
 }
 
-// Start starts the API server
+// Start starts the API server on all configured listen addresses. It
+// returns when all listeners have stopped, with the first error.
 func (s *Server) Start() error {
-	addr := fmt.Sprintf("%s:%d", s.config.API.Host, s.config.API.Port)
-	s.server = &http.Server{
-		Addr:    addr,
-		Handler: s.router,
+	listeners := s.config.API.ListenAddresses()
+	errs := make(chan error, len(listeners))
+
+	for _, l := range listeners {
+		srv := &http.Server{
+			Addr:    l.Address,
+			Handler: s.router,
+		}
+
+		if l.TLS.Enabled() {
+			tlsConfig, err := serverTLSConfig(l.TLS)
+			if err != nil {
+				return fmt.Errorf("invalid TLS settings for %s: %w", l.Address, err)
+			}
+			srv.TLSConfig = tlsConfig
+		}
+		s.mu.Lock()
+		s.servers = append(s.servers, srv)
+		s.mu.Unlock()
+
+		go func(l config.ListenConfig) {
+			var err error
+			if l.TLS.Enabled() {
+				fmt.Printf("API server listening on %s (TLS)\n", l.Address)
+				err = srv.ListenAndServeTLS(l.TLS.CertFile, l.TLS.KeyFile)
+			} else {
+				fmt.Printf("API server listening on %s\n", l.Address)
+				err = srv.ListenAndServe()
+			}
+			if err == http.ErrServerClosed {
+				err = nil
+			} else if err != nil {
+				fmt.Printf("API server on %s failed: %v\n", l.Address, err)
+			}
+			errs <- err
+		}(l)
 	}
 
-	fmt.Printf("API server listening on %s\n", addr)
-	return s.server.ListenAndServe()
+	var firstErr error
+	for range listeners {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
-// Stop stops the API server
-func (s *Server) Stop() error {
-	if s.server == nil {
-		return nil
+// serverTLSConfig builds the TLS configuration of a listen address
+func serverTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	return tlsConfig, nil
+}
 
-	return s.server.Shutdown(ctx)
+// Stop stops the API server, waiting for in-flight requests until ctx is
+// done
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	servers := append(append([]*http.Server(nil), s.servers...), s.socketServers...)
+	s.mu.Unlock()
+
+	var err error
+	for _, srv := range servers {
+		if e := srv.Shutdown(ctx); e != nil {
+			err = e
+		}
+	}
+	return err
 }
 
 func (s *Server) healthCheck(c *gin.Context) {
@@ -105,9 +249,17 @@ func (s *Server) getSystemInfo(c *gin.Context) {
 	sysStats := s.collector.GetCurrentSystemStats()
 
 	info := types.DaemonInfo{
-		Version:      "0.1.0",
-		ProcessCount: s.manager.Count(),
-		SystemStats:  sysStats,
+		Version:         "0.1.0",
+		InstanceID:      s.config.API.InstanceID,
+		ServerTime:      time.Now(),
+		Uptime:          int64(time.Since(s.startedAt).Seconds()),
+		StartedAt:       s.startedAt,
+		ProcessCount:    s.manager.Count(),
+		Paused:          s.manager.Paused(),
+		Lockdown:        s.manager.Lockdown(),
+		Capacity:        s.manager.Capacity(),
+		UpdateAvailable: s.updates.Available(),
+		SystemStats:     sysStats,
 	}
 
 	c.JSON(http.StatusOK, types.Response{
@@ -137,14 +289,135 @@ func (s *Server) getSystemStatsHistory(c *gin.Context) {
 	})
 }
 
+func (s *Server) getDaemonStats(c *gin.Context) {
+	stats := s.collector.GetDaemonStats()
+	stats.Streams = s.Streams()
+	if chaos := s.manager.Chaos(); chaos != nil {
+		stats.Chaos = chaos.String()
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Data:    stats,
+	})
+}
+
+func (s *Server) pauseDaemon(c *gin.Context) {
+	s.setPaused(c, true)
+}
+
+func (s *Server) resumeDaemon(c *gin.Context) {
+	s.setPaused(c, false)
+}
+
+func (s *Server) setPaused(c *gin.Context, paused bool) {
+	// Pausing affects every namespace, so tenants can't do it
+	if identity(c).Namespaces != nil {
+		c.JSON(http.StatusForbidden, types.Response{
+			Success: false,
+			Error:   "forbidden: pausing supervision requires daemon-wide access",
+		})
+		return
+	}
+
+	action, message, set := "resume", "Supervision resumed", s.manager.Resume
+	if paused {
+		action, message, set = "pause", "Supervision paused", s.manager.Pause
+	}
+
+	if err := set(); err != nil {
+		logRequestError(c, action, "daemon", err)
+		c.JSON(http.StatusInternalServerError, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Message: message,
+	})
+}
+
+func (s *Server) lockdownDaemon(c *gin.Context) {
+	s.setLockdown(c, true)
+}
+
+func (s *Server) unlockDaemon(c *gin.Context) {
+	s.setLockdown(c, false)
+}
+
+func (s *Server) setLockdown(c *gin.Context, on bool) {
+	// Like pausing, a lockdown affects every namespace
+	if identity(c).Namespaces != nil {
+		c.JSON(http.StatusForbidden, types.Response{
+			Success: false,
+			Error:   "forbidden: changing the lockdown requires daemon-wide access",
+		})
+		return
+	}
+
+	action, message := "unlock", "Lockdown lifted"
+	if on {
+		action, message = "lockdown", "Lockdown on, the API is read-only"
+	}
+
+	if err := s.manager.SetLockdown(on); err != nil {
+		logRequestError(c, action, "daemon", err)
+		c.JSON(http.StatusInternalServerError, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Message: message,
+	})
+}
+
 func (s *Server) listProcesses(c *gin.Context) {
-	processes := s.manager.List()
+	if !s.watch(c) {
+		return
+	}
+
+	id := identity(c)
+	processes := make([]*types.ProcessInfo, 0)
+	for _, p := range s.manager.List(c.Query("fresh") == "true") {
+		if id.CanAccess(p.Namespace) {
+			processes = append(processes, p)
+		}
+	}
+
 	c.JSON(http.StatusOK, types.Response{
 		Success: true,
 		Data:    processes,
 	})
 }
 
+// listNamespaces returns the rollups of the namespaces the identity can
+// access
+func (s *Server) listNamespaces(c *gin.Context) {
+	if !s.watch(c) {
+		return
+	}
+
+	id := identity(c)
+	namespaces := make([]types.NamespaceStatus, 0)
+	for _, ns := range s.manager.Namespaces() {
+		if id.CanAccess(ns.Name) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Data:    namespaces,
+	})
+}
+
 func (s *Server) startProcess(c *gin.Context) {
 	var req types.StartRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -155,16 +428,57 @@ func (s *Server) startProcess(c *gin.Context) {
 		return
 	}
 
-	if req.Name == "" || req.Command == "" {
+	if req.Name == "" || (req.Command == "" && req.Fetch == nil) {
 		c.JSON(http.StatusBadRequest, types.Response{
 			Success: false,
-			Error:   "name and command are required",
+			Error:   "name and command or fetch are required",
 		})
 		return
 	}
 
-	info, err := s.manager.Start(&req)
+	// Tenants start processes in their own namespace by default
+	id := identity(c)
+	if req.Namespace == "" && len(id.Namespaces) > 0 {
+		req.Namespace = id.Namespaces[0]
+	}
+	namespace := req.Namespace
+	if namespace == "" {
+		namespace = config.DefaultNamespace
+	}
+	if !id.CanAccess(namespace) {
+		c.JSON(http.StatusForbidden, types.Response{
+			Success: false,
+			Error:   "forbidden: no access to namespace " + namespace,
+		})
+		return
+	}
+	if len(id.Namespaces) > 0 {
+		if err := process.Confine(&req, s.config.Namespace(namespace)); err != nil {
+			c.JSON(http.StatusForbidden, types.Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		// Names are unique across namespaces, but a tenant isn't told
+		// about processes it can't see
+		if existing := s.manager.Get(req.Name); existing != nil && !id.CanAccess(existing.Namespace) {
+			c.JSON(http.StatusConflict, types.Response{
+				Success: false,
+				Error:   fmt.Sprintf("%s: %v", req.Name, process.ErrNameUnavailable),
+			})
+			return
+		}
+	}
+
+	if dryRun(c) {
+		s.servePlan(c, req.Name, func() (*types.LaunchPlan, error) { return s.manager.PlanStart(&req) })
+		return
+	}
+
+	info, err := s.manager.Start(&req, id.Name)
 	if err != nil {
+		logRequestError(c, "start", req.Name, err)
 		c.JSON(http.StatusInternalServerError, types.Response{
 			Success: false,
 			Error:   err.Error(),
@@ -172,16 +486,93 @@ func (s *Server) startProcess(c *gin.Context) {
 		return
 	}
 
+	message := "Process started"
+	if info.Schedule != "" {
+		message = "Process scheduled"
+	}
 	c.JSON(http.StatusCreated, types.Response{
 		Success: true,
-		Message: "Process started",
+		Message: message,
 		Data:    info,
 	})
 }
 
+func (s *Server) applyState(c *gin.Context) {
+	var req types.ApplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	if !req.DryRun && s.lockedOut(c) {
+		return
+	}
+
+	// Tenants declare processes in their own namespace by default
+	id := identity(c)
+	if len(id.Namespaces) > 0 {
+		for i := range req.Processes {
+			proc := &req.Processes[i]
+			if proc.Namespace == "" {
+				proc.Namespace = id.Namespaces[0]
+			}
+			// Apply rejects the namespaces the tenant can't access
+			if !id.CanAccess(proc.Namespace) {
+				continue
+			}
+			if err := process.Confine(proc, s.config.Namespace(proc.Namespace)); err != nil {
+				c.JSON(http.StatusForbidden, types.Response{
+					Success: false,
+					Error:   fmt.Sprintf("process %s: %v", proc.Name, err),
+				})
+				return
+			}
+		}
+	}
+
+	result, err := s.manager.Apply(&req, id.Name, id.CanAccess)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, process.ErrForbidden):
+			status = http.StatusForbidden
+		case errors.Is(err, process.ErrNameUnavailable):
+			status = http.StatusConflict
+		}
+		logRequestError(c, "apply", "state", err)
+		c.JSON(status, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	message := "State applied"
+	if result.DryRun {
+		message = "Dry run, no changes made"
+	}
+	for _, change := range result.Changes {
+		if change.Error != "" {
+			message = "State applied with errors"
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Message: message,
+		Data:    result,
+	})
+}
+
 func (s *Server) getProcess(c *gin.Context) {
 	id := c.Param("id")
 	info := s.manager.Get(id)
+	if c.Query("fresh") == "true" {
+		info = s.manager.GetFresh(id)
+	}
 
 	if info == nil {
 		c.JSON(http.StatusNotFound, types.Response{
@@ -197,10 +588,224 @@ func (s *Server) getProcess(c *gin.Context) {
 	})
 }
 
+func (s *Server) updateProcess(c *gin.Context) {
+	id := c.Param("id")
+
+	var patch types.ProcessPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	info, err := s.manager.Update(id, &patch, identity(c).Name)
+	if err != nil {
+		logRequestError(c, "update", id, err)
+		c.JSON(http.StatusInternalServerError, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Message: "Process updated",
+		Data:    info,
+	})
+}
+
+func (s *Server) getProcessHistory(c *gin.Context) {
+	id := c.Param("id")
+
+	history, err := s.manager.History(id)
+	if err != nil {
+		logRequestError(c, "history", id, err)
+		c.JSON(http.StatusInternalServerError, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Data:    history,
+	})
+}
+
+func (s *Server) getProcessAnnotations(c *gin.Context) {
+	id := c.Param("id")
+
+	annotations, err := s.manager.Annotations(id)
+	if err != nil {
+		logRequestError(c, "annotations", id, err)
+		c.JSON(http.StatusInternalServerError, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Data:    annotations,
+	})
+}
+
+func (s *Server) annotateProcess(c *gin.Context) {
+	id := c.Param("id")
+
+	var req types.AnnotateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	annotation, err := s.manager.Annotate(id, req.Text, identity(c).Name)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, process.ErrInvalidAnnotation) {
+			status = http.StatusBadRequest
+		}
+		logRequestError(c, "annotate", id, err)
+		c.JSON(status, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Message: "Process annotated",
+		Data:    annotation,
+	})
+}
+
+func (s *Server) getProcessRuns(c *gin.Context) {
+	id := c.Param("id")
+
+	runs, err := s.manager.Runs(id)
+	if err != nil {
+		logRequestError(c, "runs", id, err)
+		c.JSON(http.StatusInternalServerError, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Data:    runs,
+	})
+}
+
+func (s *Server) rollbackProcess(c *gin.Context) {
+	id := c.Param("id")
+
+	var req types.RollbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// An old definition may have been in another namespace
+	history, err := s.manager.History(id)
+	if err == nil {
+		for _, v := range history {
+			namespace := v.Definition.Namespace
+			if namespace == "" {
+				namespace = config.DefaultNamespace
+			}
+			if v.Version == req.Version && !identity(c).CanAccess(namespace) {
+				c.JSON(http.StatusForbidden, types.Response{
+					Success: false,
+					Error:   "forbidden: no access to namespace " + namespace,
+				})
+				return
+			}
+		}
+	}
+
+	info, err := s.manager.Rollback(id, req.Version, identity(c).Name)
+	if err != nil {
+		logRequestError(c, "rollback", id, err)
+		c.JSON(http.StatusInternalServerError, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Message: fmt.Sprintf("Rolled back to definition version %d", req.Version),
+		Data:    info,
+	})
+}
+
+func (s *Server) deployProcess(c *gin.Context) {
+	id := c.Param("id")
+
+	info, err := s.manager.Deploy(id)
+	if err != nil {
+		logRequestError(c, "deploy", id, err)
+		c.JSON(http.StatusInternalServerError, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Message: "Process deployed",
+		Data:    info,
+	})
+}
+
+func (s *Server) simulateProcess(c *gin.Context) {
+	id := c.Param("id")
+
+	var req types.SimulateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	sim, err := s.manager.Simulate(id, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Data:    sim,
+	})
+}
+
 func (s *Server) deleteProcess(c *gin.Context) {
 	id := c.Param("id")
 
 	if err := s.manager.Delete(id); err != nil {
+		logRequestError(c, "delete", id, err)
 		c.JSON(http.StatusInternalServerError, types.Response{
 			Success: false,
 			Error:   err.Error(),
@@ -218,6 +823,7 @@ func (s *Server) stopProcess(c *gin.Context) {
 	id := c.Param("id")
 
 	if err := s.manager.Stop(id); err != nil {
+		logRequestError(c, "stop", id, err)
 		c.JSON(http.StatusInternalServerError, types.Response{
 			Success: false,
 			Error:   err.Error(),
@@ -234,7 +840,18 @@ func (s *Server) stopProcess(c *gin.Context) {
 func (s *Server) restartProcess(c *gin.Context) {
 	id := c.Param("id")
 
+	if dryRun(c) {
+		s.servePlan(c, id, func() (*types.LaunchPlan, error) { return s.manager.PlanRestart(id) })
+		return
+	}
+
+	if c.Query("wait_healthy") == "true" {
+		s.restartHealthy(c, id)
+		return
+	}
+
 	if err := s.manager.Restart(id); err != nil {
+		logRequestError(c, "restart", id, err)
 		c.JSON(http.StatusInternalServerError, types.Response{
 			Success: false,
 			Error:   err.Error(),
@@ -248,6 +865,89 @@ func (s *Server) restartProcess(c *gin.Context) {
 	})
 }
 
+// Restarts with wait_healthy wait this long for the new run by default,
+// and at most maxHealthyTimeout
+const (
+	defaultHealthyTimeout = time.Minute
+	maxHealthyTimeout     = 10 * time.Minute
+)
+
+// restartHealthy restarts a process and answers once the new run is
+// healthy, with 503 if it never becomes healthy within timeout
+func (s *Server) restartHealthy(c *gin.Context, id string) {
+	timeout := defaultHealthyTimeout
+	if t := c.Query("timeout"); t != "" {
+		d, err := time.ParseDuration(t)
+		if err != nil || d <= 0 || d > maxHealthyTimeout {
+			c.JSON(http.StatusBadRequest, types.Response{
+				Success: false,
+				Error:   "timeout must be a duration of at most " + maxHealthyTimeout.String(),
+			})
+			return
+		}
+		timeout = d
+	}
+
+	if err := s.manager.RestartHealthy(c.Request.Context(), id, timeout); err != nil {
+		logRequestError(c, "restart", id, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, process.ErrNotHealthy) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Message: "Process restarted and healthy",
+	})
+}
+
+func (s *Server) resetProcess(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := s.manager.Reset(id); err != nil {
+		logRequestError(c, "reset", id, err)
+		c.JSON(http.StatusInternalServerError, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Message: "Process reset",
+	})
+}
+
+// failoverProcess hands a process over to its warm standby
+func (s *Server) failoverProcess(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := s.manager.Failover(id); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, process.ErrNoStandby) {
+			status = http.StatusConflict
+		}
+		logRequestError(c, "failover", id, err)
+		c.JSON(status, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Message: "Standby took over",
+	})
+}
+
 func (s *Server) getProcessStats(c *gin.Context) {
 	id := c.Param("id")
 	procStats := s.manager.Stats(id)
@@ -273,7 +973,25 @@ func (s *Server) getProcessStatsHistory(c *gin.Context) {
 		fmt.Sscanf(l, "%d", &limit)
 	}
 
-	procStats := s.manager.GetStatsHistory(id, limit)
+	since, err := parseTimeParam(c.Query("since"), time.Time{}, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.Response{
+			Success: false,
+			Error:   "invalid since: " + err.Error(),
+		})
+		return
+	}
+
+	if wantsNDJSON(c) {
+		w := newNDJSONWriter(c)
+		defer w.close()
+		_ = s.manager.EachStatsSample(id, since, limit, func(sample types.ProcessStats) error {
+			return w.write(sample)
+		})
+		return
+	}
+
+	procStats := s.manager.GetStatsHistory(id, since, limit)
 	if procStats == nil {
 		c.JSON(http.StatusNotFound, types.Response{
 			Success: false,
@@ -291,13 +1009,74 @@ func (s *Server) getProcessStatsHistory(c *gin.Context) {
 func (s *Server) getProcessLogs(c *gin.Context) {
 	id := c.Param("id")
 	lines := 100
+	run := 0
 	logType := c.Query("type")
 
 	if l := c.Query("lines"); l != "" {
 		fmt.Sscanf(l, "%d", &lines)
 	}
+	if r := c.Query("run"); r != "" {
+		fmt.Sscanf(r, "%d", &run)
+	}
+
+	var filter *logger.Filter
+	if grep := c.Query("grep"); grep != "" {
+		pattern, err := regexp.Compile(grep)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, types.Response{
+				Success: false,
+				Error:   fmt.Sprintf("invalid grep pattern: %v", err),
+			})
+			return
+		}
+		filter = &logger.Filter{Pattern: pattern, Invert: c.Query("invert") == "true"}
+	}
+
+	// after selects the lines following a sequence number, replacing lines
+	// and run
+	var after *uint64
+	if a := c.Query("after"); a != "" {
+		seq, err := strconv.ParseUint(a, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, types.Response{
+				Success: false,
+				Error:   fmt.Sprintf("invalid after %q, expected a sequence number", a),
+			})
+			return
+		}
+		after = &seq
+	}
 
-	logs, err := s.manager.GetLogs(id, lines, logType)
+	if c.Query("follow") == "true" {
+		s.followLogs(c, id, lines, logType, filter, after)
+		return
+	}
+
+	if wantsNDJSON(c) {
+		w := newNDJSONWriter(c)
+		defer w.close()
+		write := func(line string) error {
+			return w.write(line)
+		}
+		if after != nil {
+			_ = s.manager.StreamLogsAfter(id, logType, *after, filter, write)
+		} else {
+			_ = s.manager.StreamLogs(id, lines, logType, run, filter, write)
+		}
+		return
+	}
+
+	var logs []string
+	var err error
+	if after != nil {
+		logs = []string{}
+		err = s.manager.StreamLogsAfter(id, logType, *after, filter, func(line string) error {
+			logs = append(logs, line)
+			return nil
+		})
+	} else {
+		logs, err = s.manager.GetLogs(id, lines, logType, run, filter)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.Response{
 			Success: false,
@@ -312,12 +1091,70 @@ func (s *Server) getProcessLogs(c *gin.Context) {
 	})
 }
 
+func (s *Server) downloadProcessLogs(c *gin.Context) {
+	id := c.Param("id")
+	rotation := 0
+	if r := c.Query("rotation"); r != "" {
+		fmt.Sscanf(r, "%d", &rotation)
+	}
+
+	path, err := s.manager.LogFilePath(id, c.Query("file"), rotation)
+	if err != nil {
+		c.JSON(http.StatusNotFound, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		c.JSON(http.StatusNotFound, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer file.Close()
+
+	// The process may have been deleted meanwhile
+	info := s.manager.Get(id)
+	if info == nil {
+		c.JSON(http.StatusNotFound, types.Response{
+			Success: false,
+			Error:   "process not found",
+		})
+		return
+	}
+	filename := fmt.Sprintf("%s-%s", info.Name, filepath.Base(path))
+
+	if c.Query("gzip") == "true" && !strings.HasSuffix(filename, ".gz") {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.gz"`, filename))
+		c.Header("Content-Type", "application/gzip")
+		c.Status(http.StatusOK)
+
+		gz := gzip.NewWriter(c.Writer)
+		defer gz.Close()
+		_, _ = io.Copy(gz, file)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Content-Type", "application/octet-stream")
+	if stat, err := file.Stat(); err == nil {
+		c.Header("Content-Length", fmt.Sprintf("%d", stat.Size()))
+	}
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, file)
+}
+
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, X-Resource-Version")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -327,18 +1164,3 @@ func corsMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
-
-func authMiddleware(token string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		auth := c.GetHeader("Authorization")
-		if auth != "Bearer "+token {
-			c.JSON(http.StatusUnauthorized, types.Response{
-				Success: false,
-				Error:   "unauthorized",
-			})
-			c.Abort()
-			return
-		}
-		c.Next()
-	}
-}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/snapshot"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// getSnapshot returns the definitions and state of the processes the
+// identity can access, to be saved and compared later
+func (s *Server) getSnapshot(c *gin.Context) {
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Data:    s.manager.Snapshot(identity(c).CanAccess),
+	})
+}
+
+// diffSnapshots compares two snapshots, or a snapshot with the current
+// state. Processes of namespaces the identity can't access are left out of
+// the comparison with the current state.
+func (s *Server) diffSnapshots(c *gin.Context) {
+	var req types.SnapshotDiffRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.A == nil {
+		msg := "snapshot a is required"
+		if err != nil {
+			msg = err.Error()
+		}
+		c.JSON(http.StatusBadRequest, types.Response{
+			Success: false,
+			Error:   msg,
+		})
+		return
+	}
+
+	b := req.B
+	if b == nil {
+		id := identity(c)
+		b = s.manager.Snapshot(id.CanAccess)
+
+		visible := *req.A
+		visible.Processes = nil
+		for _, p := range req.A.Processes {
+			namespace := p.Definition.Namespace
+			if namespace == "" {
+				namespace = config.DefaultNamespace
+			}
+			if id.CanAccess(namespace) {
+				visible.Processes = append(visible.Processes, p)
+			}
+		}
+		req.A = &visible
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Data:    snapshot.Diff(req.A, b, req.Ignore),
+	})
+}
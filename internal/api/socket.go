@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/PrismManager/gemstone/internal/config"
+)
+
+// socketConnKey marks request contexts of connections accepted on a unix
+// socket
+type socketConnKey struct{}
+
+// socketConn is the value of socketConnKey: the peer, nil if unknown, and
+// the socket it connected to
+type socketConn struct {
+	cred       *peerCred
+	sock       *config.SocketConfig
+	additional bool
+}
+
+// peerCred is the identity of the process on the other end of a unix socket
+type peerCred struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// ServeSocket serves the API on a unix socket listener with the access
+// settings of sock, additional for sockets other than the main one.
+// Requests are authorized by the peer credentials of the connecting process.
+func (s *Server) ServeSocket(listener net.Listener, sock config.SocketConfig, additional bool) error {
+	srv := &http.Server{
+		Handler: s.router,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			cred, err := getPeerCred(conn)
+			if err != nil {
+				cred = nil
+			}
+			return context.WithValue(ctx, socketConnKey{}, &socketConn{cred: cred, sock: &sock, additional: additional})
+		},
+	}
+	s.mu.Lock()
+	s.socketServers = append(s.socketServers, srv)
+	s.mu.Unlock()
+
+	if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// socketPeer returns the connection a request was received on if it came
+// over a unix socket. ok is false for requests received over TCP.
+func socketPeer(ctx context.Context) (conn *socketConn, ok bool) {
+	conn, ok = ctx.Value(socketConnKey{}).(*socketConn)
+	return conn, ok
+}
+
+// peerAllowed reports whether the local user on the other end of a socket
+// connection may use it without a token. The daemon's own user is always
+// allowed.
+func (s *Server) peerAllowed(conn *socketConn) bool {
+	cred, cfg := conn.cred, conn.sock
+	if cred == nil {
+		return false
+	}
+	if cred.UID == uint32(os.Geteuid()) {
+		return true
+	}
+
+	// The mode and group of an additional socket decide who can open it
+	if conn.additional && !config.IsAbstractSocket(cfg.Path) && len(cfg.AllowedUIDs) == 0 && len(cfg.AllowedGIDs) == 0 {
+		return true
+	}
+
+	for _, uid := range cfg.AllowedUIDs {
+		if cred.UID == uid {
+			return true
+		}
+	}
+
+	if len(cfg.AllowedGIDs) == 0 {
+		return false
+	}
+
+	gids := []string{strconv.FormatUint(uint64(cred.GID), 10)}
+	if u, err := user.LookupId(strconv.FormatUint(uint64(cred.UID), 10)); err == nil {
+		if groups, err := u.GroupIds(); err == nil {
+			gids = append(gids, groups...)
+		}
+	}
+
+	for _, allowed := range cfg.AllowedGIDs {
+		for _, gid := range gids {
+			if gid == strconv.FormatUint(uint64(allowed), 10) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/PrismManager/gemstone/internal/process"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+func (s *Server) listTargets(c *gin.Context) {
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Data:    s.manager.Targets(),
+	})
+}
+
+func (s *Server) startTarget(c *gin.Context) {
+	s.actOnTarget(c, "start", s.manager.StartTarget)
+}
+
+func (s *Server) stopTarget(c *gin.Context) {
+	s.actOnTarget(c, "stop", s.manager.StopTarget)
+}
+
+// actOnTarget starts or stops a target, answering with what was done to
+// its processes even if it failed halfway
+func (s *Server) actOnTarget(c *gin.Context, verb string, act func(string, func(string) bool) (*types.TargetResult, error)) {
+	name := c.Param("name")
+	result, err := act(name, identity(c).CanAccess)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, process.ErrTargetNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, process.ErrForbidden):
+			status = http.StatusForbidden
+		}
+		logRequestError(c, verb+" target", name, err)
+		resp := types.Response{Success: false, Error: err.Error()}
+		if result != nil {
+			resp.Data = result
+		}
+		c.JSON(status, resp)
+		return
+	}
+
+	message := "Target started"
+	if verb == "stop" {
+		message = "Target stopped"
+	}
+	for _, action := range result.Actions {
+		if action.Action == "failed" {
+			message += " with errors"
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Message: message,
+		Data:    result,
+	})
+}
+
+// restartGroup restarts a restart group, answering with what was done to
+// its processes even if it failed halfway
+func (s *Server) restartGroup(c *gin.Context) {
+	name := c.Param("name")
+	result, err := s.manager.RestartGroup(name, identity(c).CanAccess)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, process.ErrGroupNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, process.ErrForbidden):
+			status = http.StatusForbidden
+		}
+		logRequestError(c, "restart group", name, err)
+		resp := types.Response{Success: false, Error: err.Error()}
+		if result != nil {
+			resp.Data = result
+		}
+		c.JSON(status, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Message: "Restart group restarted",
+		Data:    result,
+	})
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/PrismManager/gemstone/internal/process"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// defaultUsageWindow is how far back usage is reported without since
+const defaultUsageWindow = 30 * 24 * time.Hour
+
+// getUsage reports the resource consumption of namespaces or processes for
+// chargeback, as JSON or with format=csv as CSV. Restricted identities only
+// see their namespaces.
+func (s *Server) getUsage(c *gin.Context) {
+	now := time.Now()
+	since, err := parseTimeParam(c.Query("since"), now.Add(-defaultUsageWindow), now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.Response{
+			Success: false,
+			Error:   "invalid since: " + err.Error(),
+		})
+		return
+	}
+	until, err := parseTimeParam(c.Query("until"), now, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.Response{
+			Success: false,
+			Error:   "invalid until: " + err.Error(),
+		})
+		return
+	}
+
+	records, err := s.manager.Usage(since, until,
+		c.DefaultQuery("period", process.UsageDay), c.DefaultQuery("by", process.UsageByNamespace))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	id := identity(c)
+	visible := make([]types.UsageRecord, 0, len(records))
+	for _, r := range records {
+		if id.CanAccess(r.Namespace) {
+			visible = append(visible, r)
+		}
+	}
+
+	if c.Query("format") == "csv" {
+		writeUsageCSV(c, visible)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.Response{
+		Success: true,
+		Data:    visible,
+	})
+}
+
+// parseTimeParam accepts RFC 3339 times and durations before now like 24h
+func parseTimeParam(value string, def, now time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func writeUsageCSV(c *gin.Context, records []types.UsageRecord) {
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", `attachment; filename="usage.csv"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"start", "end", "namespace", "process", "cpu_seconds", "memory_byte_hours"})
+	for _, r := range records {
+		_ = w.Write([]string{
+			r.Start.Format(time.RFC3339),
+			r.End.Format(time.RFC3339),
+			r.Namespace,
+			r.Process,
+			strconv.FormatFloat(r.CPUSeconds, 'f', 3, 64),
+			fmt.Sprintf("%.0f", r.MemoryByteHours),
+		})
+	}
+	w.Flush()
+}
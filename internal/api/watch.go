@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+const (
+	// resourceVersionHeader carries the version of list responses, which
+	// watches pass back as resource_version
+	resourceVersionHeader = "X-Resource-Version"
+
+	defaultWatchTimeout = time.Minute
+	maxWatchTimeout     = 10 * time.Minute
+)
+
+// watch implements watch=true on list endpoints: the request blocks until
+// the state changed since resource_version, or since now without it, and
+// answers 304 Not Modified if the timeout passed first. It sets the version
+// header and returns false if the response was written.
+func (s *Server) watch(c *gin.Context) bool {
+	bus := s.manager.Events()
+	if c.Query("watch") != "true" {
+		c.Header(resourceVersionHeader, strconv.FormatUint(bus.Version(), 10))
+		return true
+	}
+
+	version := bus.Version()
+	if v := c.Query("resource_version"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, types.Response{
+				Success: false,
+				Error:   "resource_version must be a number",
+			})
+			return false
+		}
+		version = n
+	}
+
+	timeout := defaultWatchTimeout
+	if t := c.Query("timeout"); t != "" {
+		d, err := time.ParseDuration(t)
+		if err != nil || d <= 0 || d > maxWatchTimeout {
+			c.JSON(http.StatusBadRequest, types.Response{
+				Success: false,
+				Error:   "timeout must be a duration of at most " + maxWatchTimeout.String(),
+			})
+			return false
+		}
+		timeout = d
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	current := bus.Wait(ctx, version)
+	c.Header(resourceVersionHeader, strconv.FormatUint(current, 10))
+	if current == version {
+		c.Status(http.StatusNotModified)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// socketWriteTimeout is how long a WebSocket client may take to accept a
+// message before it is disconnected
+const socketWriteTimeout = 10 * time.Second
+
+// isWebSocket reports whether a request asks to be upgraded to a WebSocket
+func isWebSocket(c *gin.Context) bool {
+	return strings.EqualFold(c.GetHeader("Upgrade"), "websocket")
+}
+
+// serveEventSocket upgrades the request to a WebSocket and sends the recent
+// events that match and then new ones, one JSON text message per event,
+// until the client closes the connection
+func (s *Server) serveEventSocket(c *gin.Context, limit int, match func(types.Event) bool) {
+	server := websocket.Server{
+		Handshake: s.checkSocketOrigin,
+		Handler: func(conn *websocket.Conn) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Clients send nothing, but reading answers their pings and
+			// notices when they go away
+			go func() {
+				_, _ = io.Copy(io.Discard, conn)
+				cancel()
+			}()
+
+			s.streamEvents(ctx, limit, match, func(e types.Event) error {
+				_ = conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+				return websocket.JSON.Send(conn, e)
+			}, func() {})
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// checkSocketOrigin rejects WebSockets opened by pages of another site
+// unless CORS is enabled. Browsers don't apply CORS to WebSockets, so
+// without it any page could read the events of a daemon without auth.
+func (s *Server) checkSocketOrigin(_ *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" || s.config.API.EnableCORS {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(u.Host, req.Host) {
+		return fmt.Errorf("origin %s is not allowed", origin)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package archive
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultKey is the key layout used when none is configured
+const DefaultKey = "{host}/{namespace}/{name}/{date}/{file}"
+
+var placeholder = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// KeyVars are the values of the placeholders of a key layout
+type KeyVars struct {
+	Host      string
+	Namespace string
+	Name      string
+	ID        string
+	File      string
+	Time      time.Time
+}
+
+func (v KeyVars) lookup(name string) (string, bool) {
+	switch name {
+	case "host":
+		return v.Host, true
+	case "namespace":
+		return v.Namespace, true
+	case "name":
+		return v.Name, true
+	case "id":
+		return v.ID, true
+	case "file":
+		return v.File, true
+	case "date":
+		return v.Time.Format("2006-01-02"), true
+	case "year":
+		return v.Time.Format("2006"), true
+	case "month":
+		return v.Time.Format("01"), true
+	case "day":
+		return v.Time.Format("02"), true
+	}
+	return "", false
+}
+
+// ValidateKey checks that a key layout uses known placeholders and names
+// each file apart
+func ValidateKey(layout string) error {
+	for _, m := range placeholder.FindAllStringSubmatch(layout, -1) {
+		if _, ok := (KeyVars{}).lookup(m[1]); !ok {
+			return fmt.Errorf("unknown placeholder {%s}", m[1])
+		}
+	}
+	if !strings.Contains(layout, "{file}") {
+		return fmt.Errorf("key must contain {file}")
+	}
+	return nil
+}
+
+// Key expands a key layout
+func Key(layout string, vars KeyVars) string {
+	key := placeholder.ReplaceAllStringFunc(layout, func(m string) string {
+		value, _ := vars.lookup(m[1 : len(m)-1])
+		return value
+	})
+	return strings.TrimLeft(key, "/")
+}
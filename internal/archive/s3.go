@@ -0,0 +1,158 @@
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/awsauth"
+	"github.com/PrismManager/gemstone/internal/config"
+)
+
+// uploadTimeout bounds the upload of a single file
+const uploadTimeout = 10 * time.Minute
+
+// S3 uploads files to a bucket of S3 or an S3-compatible service
+type S3 struct {
+	bucket   string
+	region   string
+	endpoint string
+	client   *http.Client
+	creds    *awsauth.Provider
+}
+
+// NewS3 creates an uploader for the configured bucket
+func NewS3(cfg config.LogArchiveConfig) (*S3, error) {
+	s := &S3{
+		bucket:   cfg.Bucket,
+		region:   cfg.Region,
+		endpoint: strings.TrimRight(cfg.Endpoint, "/"),
+		client:   &http.Client{},
+	}
+	s.creds = awsauth.NewProvider(s.client)
+	if s.region == "" {
+		s.region = awsauth.Region()
+	}
+	if s.region == "" {
+		if s.endpoint == "" {
+			return nil, fmt.Errorf("region is not configured (logging.archive.region or AWS_REGION)")
+		}
+		// S3-compatible services mostly ignore it, but it is signed
+		s.region = "us-east-1"
+	}
+	if s.endpoint != "" && !strings.HasPrefix(s.endpoint, "http://") && !strings.HasPrefix(s.endpoint, "https://") {
+		return nil, fmt.Errorf("invalid endpoint %q, expected http or https", cfg.Endpoint)
+	}
+	return s, nil
+}
+
+// url returns the URL of an object. AWS is addressed by virtual host, other
+// services by path.
+func (s *S3) url(key string) string {
+	path := awsauth.EscapePath("/" + key)
+	if s.endpoint == "" {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com%s", s.bucket, s.region, path)
+	}
+	return s.endpoint + "/" + awsauth.EscapePath(s.bucket) + path
+}
+
+// Upload stores a file under key. With compress set the file is gzipped on
+// the way. It returns the bytes uploaded.
+func (s *S3) Upload(ctx context.Context, key, path string, compress bool) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	body := f
+	if compress {
+		tmp, err := gzipFile(f)
+		if err != nil {
+			return 0, fmt.Errorf("failed to compress %s: %w", path, err)
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		body = tmp
+	}
+
+	// The payload is hashed for the signature, then read again to send it
+	hash := sha256.New()
+	size, err := io.Copy(hash, body)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	creds, err := s.creds.Get(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, uploadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.url(key), io.NopCloser(body))
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = size
+	if compress {
+		req.Header.Set("Content-Type", "application/gzip")
+	} else {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(hash.Sum(nil)))
+	awsauth.Sign(req, req.Header.Get("X-Amz-Content-Sha256"), creds, s.region, "s3", time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		var e struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+			return 0, fmt.Errorf("s3: %s: %s", e.Code, e.Message)
+		}
+		return 0, fmt.Errorf("s3: %s", resp.Status)
+	}
+	return size, nil
+}
+
+// gzipFile compresses f into a temporary file, rewound for reading
+func gzipFile(f *os.File) (*os.File, error) {
+	tmp, err := os.CreateTemp("", "gemstone-archive-*.gz")
+	if err != nil {
+		return nil, err
+	}
+
+	zw := gzip.NewWriter(tmp)
+	_, err = io.Copy(zw, f)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
@@ -0,0 +1,50 @@
+package auth
+
+// Roles granted to authenticated API clients
+const (
+	// RoleAdmin may use every endpoint
+	RoleAdmin = "admin"
+	// RoleViewer may only use read-only endpoints
+	RoleViewer = "viewer"
+)
+
+// Identity is an authenticated API client
+type Identity struct {
+	Name string
+	Role string
+	// Namespaces restricts the identity to the namespaces it owns. A nil
+	// slice means access to all namespaces.
+	Namespaces []string
+	// LockdownOverride lets the identity make changes during a lockdown
+	LockdownOverride bool
+}
+
+// CanWrite reports whether the identity may use mutating endpoints
+func (i *Identity) CanWrite() bool {
+	return i.Role == RoleAdmin
+}
+
+// CanAccess reports whether the identity may see processes in a namespace
+func (i *Identity) CanAccess(namespace string) bool {
+	if i.Namespaces == nil {
+		return true
+	}
+	for _, ns := range i.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// roleRank orders roles by privilege
+func roleRank(role string) int {
+	switch role {
+	case RoleAdmin:
+		return 2
+	case RoleViewer:
+		return 1
+	default:
+		return 0
+	}
+}
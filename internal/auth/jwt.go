@@ -0,0 +1,390 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+)
+
+// jwksRefreshInterval is how long fetched signing keys are cached
+const jwksRefreshInterval = 10 * time.Minute
+
+// minRSABits is the smallest RSA modulus accepted for signatures
+const minRSABits = 2048
+
+// JWTValidator validates JWTs issued by an external identity provider
+type JWTValidator struct {
+	cfg        config.OIDCConfig
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]signingKey
+	fetchedAt time.Time
+	// attemptedAt is when the JWKS was last requested, successfully or not
+	attemptedAt time.Time
+	// fetching is closed when the JWKS request in flight finishes
+	fetching chan struct{}
+	fetchErr error
+}
+
+// signingKey is a key from the JWKS with the algorithm it is restricted to,
+// if the JWK names one
+type signingKey struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// NewJWTValidator creates a validator for the configured identity provider
+func NewJWTValidator(cfg config.OIDCConfig) *JWTValidator {
+	if cfg.RoleClaim == "" {
+		cfg.RoleClaim = "roles"
+	}
+
+	return &JWTValidator{
+		cfg: cfg,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		keys: make(map[string]signingKey),
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Validate verifies the signature and claims of a token and maps its role
+// claim to a gemstone role
+func (v *JWTValidator) Validate(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature: %w", err)
+	}
+
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+
+	role := v.mapRole(claims[v.cfg.RoleClaim])
+	if role == "" {
+		return nil, errors.New("token grants no gemstone role")
+	}
+
+	name, _ := claims["sub"].(string)
+	if email, ok := claims["email"].(string); ok && email != "" {
+		name = email
+	}
+
+	return &Identity{Name: "jwt:" + name, Role: role}, nil
+}
+
+func (v *JWTValidator) checkClaims(claims map[string]interface{}) error {
+	now := float64(time.Now().Unix())
+	const leeway = 30
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if now > exp+leeway {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now+leeway < nbf {
+		return errors.New("token not valid yet")
+	}
+
+	if iss, _ := claims["iss"].(string); v.cfg.Issuer == "" || iss != v.cfg.Issuer {
+		return errors.New("unexpected token issuer")
+	}
+
+	if v.cfg.Audience == "" || !hasAudience(claims["aud"], v.cfg.Audience) {
+		return errors.New("unexpected token audience")
+	}
+
+	return nil
+}
+
+// mapRole returns the most privileged role the role mapping grants for the
+// claim value. Values that aren't mapped grant nothing.
+func (v *JWTValidator) mapRole(claim interface{}) string {
+	var values []string
+	switch c := claim.(type) {
+	case string:
+		values = strings.Fields(c)
+	case []interface{}:
+		for _, item := range c {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	best := ""
+	for _, value := range values {
+		role := v.cfg.RoleMapping[value]
+		if roleRank(role) > roleRank(best) {
+			best = role
+		}
+	}
+	return best
+}
+
+func hasAudience(aud interface{}, want string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == want
+	case []interface{}:
+		for _, item := range a {
+			if s, ok := item.(string); ok && s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the signing key for a key ID, refetching the JWKS when the
+// cache is stale or the key is unknown. The JWKS is requested without
+// holding v.mu, and concurrent callers wait for the request in flight.
+func (v *JWTValidator) key(kid string) (signingKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if key, ok := v.lookupKey(kid); ok && time.Since(v.fetchedAt) < jwksRefreshInterval {
+		return key, nil
+	}
+
+	if done := v.fetching; done != nil {
+		v.mu.Unlock()
+		<-done
+		v.mu.Lock()
+	} else if time.Since(v.attemptedAt) > 10*time.Second {
+		// Rate limit refetches triggered by unknown key IDs
+		done := make(chan struct{})
+		v.fetching = done
+		v.attemptedAt = time.Now()
+		v.mu.Unlock()
+
+		keys, err := v.fetchKeys()
+
+		v.mu.Lock()
+		if err == nil {
+			v.keys = keys
+			v.fetchedAt = time.Now()
+		}
+		v.fetchErr = err
+		v.fetching = nil
+		close(done)
+	}
+
+	if key, ok := v.lookupKey(kid); ok {
+		return key, nil
+	}
+	if v.fetchErr != nil {
+		return signingKey{}, fmt.Errorf("failed to fetch signing keys: %w", v.fetchErr)
+	}
+	return signingKey{}, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (v *JWTValidator) lookupKey(kid string) (signingKey, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchKeys requests the JWKS and returns its signing keys by key ID
+func (v *JWTValidator) fetchKeys() (map[string]signingKey, error) {
+	resp, err := v.httpClient.Get(v.cfg.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]signingKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = signingKey{key: key, alg: k.Alg}
+	}
+
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+// verifySignature checks the signature of a token. The algorithm must suit
+// the key: RS* needs an RSA key of at least 2048 bits, ES256 a P-256 key and
+// ES384 a P-384 key, and a JWK that names an algorithm allows only that one.
+func verifySignature(alg string, key signingKey, signed string, signature []byte) error {
+	if key.alg != "" && key.alg != alg {
+		return errors.New("signing algorithm does not match key")
+	}
+
+	var h hash.Hash
+	var hashType crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		h, hashType = sha256.New(), crypto.SHA256
+	case "RS384", "ES384":
+		h, hashType = sha512.New384(), crypto.SHA384
+	case "RS512":
+		h, hashType = sha512.New(), crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch pub := key.key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return errors.New("signing algorithm does not match key")
+		}
+		if pub.N.BitLen() < minRSABits {
+			return errors.New("signing key is too small")
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hashType, digest, signature); err != nil {
+			return errors.New("invalid token signature")
+		}
+	case *ecdsa.PublicKey:
+		wantCurve := map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384()}[alg]
+		if wantCurve == nil || pub.Curve != wantCurve {
+			return errors.New("signing algorithm does not match key")
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid token signature")
+		}
+	default:
+		return errors.New("unsupported signing key")
+	}
+
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
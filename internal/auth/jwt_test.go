@@ -0,0 +1,362 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testAudience = "gemstone"
+)
+
+var (
+	keysOnce  sync.Once
+	rsaKey    *rsa.PrivateKey
+	weakKey   *rsa.PrivateKey
+	p256Key   *ecdsa.PrivateKey
+	p384Key   *ecdsa.PrivateKey
+	keysError error
+)
+
+// testKeys generates the signing keys once, RSA keys being slow to make
+func testKeys(t *testing.T) {
+	t.Helper()
+	keysOnce.Do(func() {
+		if rsaKey, keysError = rsa.GenerateKey(rand.Reader, 2048); keysError != nil {
+			return
+		}
+		if weakKey, keysError = rsa.GenerateKey(rand.Reader, 1024); keysError != nil {
+			return
+		}
+		if p256Key, keysError = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); keysError != nil {
+			return
+		}
+		p384Key, keysError = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	})
+	if keysError != nil {
+		t.Fatal(keysError)
+	}
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func rsaJWK(kid, alg string, key *rsa.PrivateKey) jwk {
+	return jwk{Kty: "RSA", Kid: kid, Alg: alg, Use: "sig", N: b64(key.N.Bytes()), E: b64(big.NewInt(int64(key.E)).Bytes())}
+}
+
+func ecJWK(kid, crv string, key *ecdsa.PrivateKey) jwk {
+	return jwk{Kty: "EC", Kid: kid, Crv: crv, X: b64(key.X.Bytes()), Y: b64(key.Y.Bytes())}
+}
+
+// jwksServer serves a JWKS and counts the requests for it
+type jwksServer struct {
+	*httptest.Server
+	requests atomic.Int32
+	fail     atomic.Bool
+}
+
+func newJWKSServer(t *testing.T, keys ...jwk) *jwksServer {
+	t.Helper()
+	s := &jwksServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if s.fail.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newTestValidator(s *jwksServer) *JWTValidator {
+	return NewJWTValidator(config.OIDCConfig{
+		Issuer:      testIssuer,
+		Audience:    testAudience,
+		JWKSURL:     s.URL,
+		RoleMapping: map[string]string{"ops": RoleAdmin, "dev": RoleViewer, "bogus": "root"},
+	})
+}
+
+// claims returns valid claims for the test issuer and audience
+func claims(extra map[string]interface{}) map[string]interface{} {
+	c := map[string]interface{}{
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"sub":   "1234",
+		"email": "jo@example.com",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"dev"},
+	}
+	for k, v := range extra {
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+	}
+	return c
+}
+
+// sign builds a token signed with key, an *rsa.PrivateKey or
+// *ecdsa.PrivateKey
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+
+	var digest []byte
+	var hashType crypto.Hash
+	switch alg[2:] {
+	case "256":
+		sum := sha256.Sum256([]byte(signed))
+		digest, hashType = sum[:], crypto.SHA256
+	case "384":
+		sum := sha512.Sum384([]byte(signed))
+		digest, hashType = sum[:], crypto.SHA384
+	case "512":
+		sum := sha512.Sum512([]byte(signed))
+		digest, hashType = sum[:], crypto.SHA512
+	}
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, hashType, digest); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+	}
+	return signed + "." + b64(signature)
+}
+
+func TestValidate(t *testing.T) {
+	testKeys(t)
+	s := newJWKSServer(t, rsaJWK("rsa", "RS256", rsaKey), ecJWK("p256", "P-256", p256Key), ecJWK("p384", "P-384", p384Key))
+	v := newTestValidator(s)
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  Identity
+	}{
+		{"RS256", sign(t, "RS256", "rsa", rsaKey, claims(nil)), Identity{Name: "jwt:jo@example.com", Role: RoleViewer}},
+		{"ES256", sign(t, "ES256", "p256", p256Key, claims(nil)), Identity{Name: "jwt:jo@example.com", Role: RoleViewer}},
+		{"ES384", sign(t, "ES384", "p384", p384Key, claims(nil)), Identity{Name: "jwt:jo@example.com", Role: RoleViewer}},
+		{"most privileged role", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"roles": []string{"dev", "ops"}})), Identity{Name: "jwt:jo@example.com", Role: RoleAdmin}},
+		{"space separated roles", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"roles": "other ops"})), Identity{Name: "jwt:jo@example.com", Role: RoleAdmin}},
+		{"subject without email", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"email": nil})), Identity{Name: "jwt:1234", Role: RoleViewer}},
+		{"audience list", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": []string{"other", testAudience}})), Identity{Name: "jwt:jo@example.com", Role: RoleViewer}},
+		{"within leeway", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": time.Now().Add(-10 * time.Second).Unix()})), Identity{Name: "jwt:jo@example.com", Role: RoleViewer}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := v.Validate(tc.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id.Name != tc.want.Name || id.Role != tc.want.Role {
+				t.Fatalf("got %+v, want %+v", id, tc.want)
+			}
+		})
+	}
+
+	if n := s.requests.Load(); n != 1 {
+		t.Errorf("the JWKS was fetched %d times, want once", n)
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	testKeys(t)
+	s := newJWKSServer(t,
+		rsaJWK("rsa", "RS256", rsaKey),
+		rsaJWK("any", "", rsaKey),
+		rsaJWK("weak", "", weakKey),
+		ecJWK("p256", "P-256", p256Key),
+		ecJWK("p384", "P-384", p384Key),
+	)
+	v := newTestValidator(s)
+
+	tampered := sign(t, "RS256", "rsa", rsaKey, claims(nil))
+	parts := strings.Split(tampered, ".")
+	forged, _ := json.Marshal(claims(map[string]interface{}{"roles": []string{"ops"}}))
+	parts[1] = b64(forged)
+
+	unsigned := strings.Split(sign(t, "RS256", "rsa", rsaKey, claims(nil)), ".")
+	none, _ := json.Marshal(map[string]string{"alg": "none", "kid": "any"})
+	unsigned[0], unsigned[2] = b64(none), ""
+
+	for _, tc := range []struct {
+		name, token, want string
+	}{
+		{"malformed", "a.b", "malformed token"},
+		{"tampered claims", strings.Join(parts, "."), "invalid token signature"},
+		{"alg none", strings.Join(unsigned, "."), "unsupported signing algorithm"},
+		{"HMAC with a public key", sign(t, "HS256", "any", rsaKey, claims(nil)), "unsupported signing algorithm"},
+		{"algorithm other than the JWK's", sign(t, "RS384", "rsa", rsaKey, claims(nil)), "does not match key"},
+		{"ES256 on an RSA key", sign(t, "ES256", "any", p256Key, claims(nil)), "does not match key"},
+		{"RS256 on an EC key", sign(t, "RS256", "p256", rsaKey, claims(nil)), "does not match key"},
+		{"ES256 on a P-384 key", sign(t, "ES256", "p384", p384Key, claims(nil)), "does not match key"},
+		{"small RSA key", sign(t, "RS256", "weak", weakKey, claims(nil)), "too small"},
+		{"unknown key", sign(t, "RS256", "other", rsaKey, claims(nil)), "unknown signing key"},
+		{"expired", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})), "token expired"},
+		{"no expiry", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": nil})), "no expiry"},
+		{"not valid yet", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"nbf": time.Now().Add(time.Minute).Unix()})), "not valid yet"},
+		{"other issuer", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"iss": "https://evil.example.com"})), "issuer"},
+		{"no issuer", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"iss": nil})), "issuer"},
+		{"other audience", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": "other"})), "audience"},
+		{"no audience", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": nil})), "audience"},
+		{"unmapped role", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"roles": []string{"admin"}})), "no gemstone role"},
+		{"mapping to an unknown role", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"roles": []string{"bogus"}})), "no gemstone role"},
+		{"no roles", sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"roles": nil})), "no gemstone role"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := v.Validate(tc.token)
+			if err == nil {
+				t.Fatalf("accepted as %+v", id)
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("got %q, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateWithoutKeyID(t *testing.T) {
+	testKeys(t)
+	v := newTestValidator(newJWKSServer(t, rsaJWK("only", "", rsaKey)))
+	if _, err := v.Validate(sign(t, "RS256", "", rsaKey, claims(nil))); err != nil {
+		t.Fatalf("a token without kid isn't matched to the only key: %v", err)
+	}
+
+	v = newTestValidator(newJWKSServer(t, rsaJWK("a", "", rsaKey), ecJWK("b", "P-256", p256Key)))
+	if _, err := v.Validate(sign(t, "RS256", "", rsaKey, claims(nil))); err == nil {
+		t.Fatal("a token without kid was matched to one of several keys")
+	}
+}
+
+func TestJWKSSkipsUnusableKeys(t *testing.T) {
+	testKeys(t)
+	enc := rsaJWK("enc", "", rsaKey)
+	enc.Use = "enc"
+	s := newJWKSServer(t, enc, jwk{Kty: "oct", Kid: "hmac"}, jwk{Kty: "EC", Kid: "p521", Crv: "P-521"}, rsaJWK("rsa", "", rsaKey))
+	v := newTestValidator(s)
+
+	if _, err := v.Validate(sign(t, "RS256", "rsa", rsaKey, claims(nil))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Validate(sign(t, "RS256", "enc", rsaKey, claims(nil))); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+		t.Fatalf("an encryption key was used to verify: %v", err)
+	}
+}
+
+func TestJWKSRefetch(t *testing.T) {
+	testKeys(t)
+	s := newJWKSServer(t, rsaJWK("rsa", "", rsaKey))
+	v := newTestValidator(s)
+	token := sign(t, "RS256", "rsa", rsaKey, claims(nil))
+
+	if _, err := v.Validate(token); err != nil {
+		t.Fatal(err)
+	}
+	// Unknown key IDs refetch at most every 10 seconds
+	for i := 0; i < 5; i++ {
+		v.Validate(sign(t, "RS256", "rotated", rsaKey, claims(nil)))
+	}
+	if n := s.requests.Load(); n != 1 {
+		t.Fatalf("the JWKS was fetched %d times, want once", n)
+	}
+
+	// Stale keys are refetched, and kept if that fails
+	v.mu.Lock()
+	v.fetchedAt = time.Now().Add(-2 * jwksRefreshInterval)
+	v.attemptedAt = time.Time{}
+	v.mu.Unlock()
+	s.fail.Store(true)
+	if _, err := v.Validate(token); err != nil {
+		t.Fatalf("a failed refetch dropped the cached keys: %v", err)
+	}
+	if n := s.requests.Load(); n != 2 {
+		t.Fatalf("the JWKS was fetched %d times, want twice", n)
+	}
+}
+
+func TestJWKSUnavailable(t *testing.T) {
+	testKeys(t)
+	s := newJWKSServer(t)
+	s.fail.Store(true)
+	v := newTestValidator(s)
+
+	_, err := v.Validate(sign(t, "RS256", "rsa", rsaKey, claims(nil)))
+	if err == nil || !strings.Contains(err.Error(), "failed to fetch signing keys") {
+		t.Fatalf("got %v, want the fetch error", err)
+	}
+}
+
+func TestJWKSFetchCoalesced(t *testing.T) {
+	testKeys(t)
+	release := make(chan struct{})
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []jwk{rsaJWK("rsa", "", rsaKey)}})
+	}))
+	defer srv.Close()
+	v := newTestValidator(&jwksServer{Server: srv})
+	token := sign(t, "RS256", "rsa", rsaKey, claims(nil))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := v.Validate(token)
+			errs <- err
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("the JWKS was fetched %d times by concurrent callers, want once", n)
+	}
+}
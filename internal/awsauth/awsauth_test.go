@@ -0,0 +1,168 @@
+package awsauth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The requests and signatures are from the AWS Signature Version 4 test
+// suite and documentation
+var (
+	testCreds = &Credentials{AccessKey: "AKIDEXAMPLE", SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	testTime  = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+)
+
+func TestSign(t *testing.T) {
+	for _, tc := range []struct {
+		name, method, url, service string
+		header                     map[string]string
+		want                       string
+	}{
+		{
+			name:    "get-vanilla",
+			method:  http.MethodGet,
+			url:     "https://example.amazonaws.com/",
+			service: "service",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:    "post-vanilla",
+			method:  http.MethodPost,
+			url:     "https://example.amazonaws.com/",
+			service: "service",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:    "get-vanilla-query-order-key-case",
+			method:  http.MethodGet,
+			url:     "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			service: "service",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:    "iam-list-users",
+			method:  http.MethodGet,
+			url:     "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08",
+			service: "iam",
+			header:  map[string]string{"Content-Type": "application/x-www-form-urlencoded; charset=utf-8"},
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+				"SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, tc.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			Sign(req, PayloadHash(nil), testCreds, "us-east-1", tc.service, testTime)
+
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %q", got)
+			}
+			if got := req.Header.Get("Authorization"); got != tc.want {
+				t.Errorf("Authorization =\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSignSessionToken(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	creds := *testCreds
+	creds.SessionToken = "token"
+	Sign(req, PayloadHash(nil), &creds, "us-east-1", "service", testTime)
+
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "token" {
+		t.Fatalf("X-Amz-Security-Token = %q", got)
+	}
+	if auth := req.Header.Get("Authorization"); !strings.Contains(auth, "SignedHeaders=host;x-amz-date;x-amz-security-token,") {
+		t.Fatalf("the session token isn't signed: %s", auth)
+	}
+}
+
+func TestSignIgnoresAuthorization(t *testing.T) {
+	sign := func(req *http.Request) string {
+		Sign(req, PayloadHash(nil), testCreds, "us-east-1", "service", testTime)
+		return req.Header.Get("Authorization")
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	first := sign(req)
+	// Signing again, as on a retry, gives the same signature
+	if again := sign(req); again != first {
+		t.Fatalf("signing twice changed the signature:\n%s\n%s", first, again)
+	}
+}
+
+func TestSignPayload(t *testing.T) {
+	sign := func(body string) string {
+		req, _ := http.NewRequest(http.MethodPost, "https://example.amazonaws.com/", nil)
+		Sign(req, PayloadHash([]byte(body)), testCreds, "us-east-1", "service", testTime)
+		return req.Header.Get("Authorization")
+	}
+	if sign("a") == sign("b") {
+		t.Fatal("the payload isn't signed")
+	}
+}
+
+func TestPayloadHash(t *testing.T) {
+	if got := PayloadHash(nil); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Fatalf("PayloadHash(nil) = %s", got)
+	}
+}
+
+func TestEscapePath(t *testing.T) {
+	for path, want := range map[string]string{
+		"/":                  "/",
+		"/bucket/key.txt":    "/bucket/key.txt",
+		"/a b/c+d":           "/a%20b/c%2Bd",
+		"/~user/-_.":         "/~user/-_.",
+		"/ü":                 "/%C3%BC",
+		"/logs/2026:10:14=x": "/logs/2026%3A10%3A14%3Dx",
+	} {
+		if got := EscapePath(path); got != want {
+			t.Errorf("EscapePath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/?b=2&a=y&a=x&path=%2Fa%2Fb&s=a+b", nil)
+	if got, want := canonicalQuery(req.URL.Query()), "a=x&a=y&b=2&path=%2Fa%2Fb&s=a%20b"; got != want {
+		t.Fatalf("canonicalQuery = %q, want %q", got, want)
+	}
+}
+
+func TestCredentialsFromEnvironment(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "token")
+
+	creds, err := NewProvider(nil).Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKey != "AKID" || creds.SecretKey != "secret" || creds.SessionToken != "token" {
+		t.Fatalf("got %+v", creds)
+	}
+}
+
+func TestRegion(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "eu-west-1")
+	if got := Region(); got != "eu-west-1" {
+		t.Fatalf("Region() = %q, want the default region", got)
+	}
+	t.Setenv("AWS_REGION", "eu-central-1")
+	if got := Region(); got != "eu-central-1" {
+		t.Fatalf("Region() = %q, want AWS_REGION", got)
+	}
+}
@@ -0,0 +1,30 @@
+package cgroup
+
+import "time"
+
+// cpuPeriod is the CFS period used for CPU quotas, in microseconds
+const cpuPeriod = 100000
+
+// Group is the cgroup of a managed process and its children
+type Group struct {
+	v2 bool
+	// path is the cgroup directory on cgroup v2
+	path string
+	// dirs maps v1 controllers to their cgroup directories
+	dirs map[string]string
+	// external groups are managed by someone else, such as systemd, and
+	// left in place
+	external bool
+}
+
+// External reports whether the group is managed by someone else, see
+// ForProcess
+func (g *Group) External() bool {
+	return g.external
+}
+
+// Usage is a CPU usage measurement of a group
+type Usage struct {
+	CPU  time.Duration
+	Time time.Time
+}
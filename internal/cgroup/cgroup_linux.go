@@ -0,0 +1,381 @@
+package cgroup
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// v1Controllers are the cgroup v1 controllers a group is created in
+var v1Controllers = []string{"cpu", "cpuacct", "memory"}
+
+var (
+	setupOnce sync.Once
+	setupErr  error
+	unified   bool
+	// base is the parent directory of groups on v2, or the parent for each
+	// controller on v1
+	base   string
+	v1Base map[string]string
+)
+
+// setup finds where groups are created. On cgroup v2 the daemon moves itself
+// into a leaf cgroup so the CPU and memory controllers can be enabled for
+// its children.
+func setup() error {
+	setupOnce.Do(func() {
+		paths, err := selfCgroups()
+		if err != nil {
+			setupErr = err
+			return
+		}
+
+		if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err == nil {
+			unified = true
+			setupErr = setupV2(paths[""])
+			return
+		}
+
+		v1Base = make(map[string]string)
+		for _, controller := range v1Controllers {
+			path, ok := paths[controller]
+			if !ok {
+				setupErr = fmt.Errorf("cgroup v1 controller %s is not available", controller)
+				return
+			}
+			dir := filepath.Join(cgroupRoot, controller, path, "gemstone")
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				setupErr = fmt.Errorf("failed to create cgroup %s: %w", dir, err)
+				return
+			}
+			v1Base[controller] = dir
+		}
+	})
+
+	return setupErr
+}
+
+func setupV2(self string) error {
+	base = filepath.Join(cgroupRoot, self)
+
+	// Processes may not live in a cgroup that has controllers enabled for
+	// its children, so the daemon moves into a leaf first
+	if self != "/" {
+		leaf := filepath.Join(base, "daemon")
+		if err := os.MkdirAll(leaf, 0755); err != nil {
+			return fmt.Errorf("failed to create cgroup %s: %w", leaf, err)
+		}
+		if err := moveAll(base, leaf); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFile(filepath.Join(base, "cgroup.subtree_control"), "+cpu +memory"); err != nil {
+		return fmt.Errorf("failed to enable cgroup controllers: %w", err)
+	}
+
+	return nil
+}
+
+// moveAll moves every process of a cgroup into another one
+func moveAll(from, to string) error {
+	data, err := os.ReadFile(filepath.Join(from, "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+
+	for _, pid := range strings.Fields(string(data)) {
+		if err := writeFile(filepath.Join(to, "cgroup.procs"), pid); err != nil {
+			return fmt.Errorf("failed to move process %s to %s: %w", pid, to, err)
+		}
+	}
+
+	return nil
+}
+
+// selfCgroups returns the cgroup paths of the daemon by controller, with
+// "" for the unified hierarchy
+func selfCgroups() (map[string]string, error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	paths := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[1] == "" {
+			paths[""] = parts[2]
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+
+	return paths, scanner.Err()
+}
+
+// New creates a cgroup with the given name below the daemon's cgroup
+func New(name string) (*Group, error) {
+	if err := setup(); err != nil {
+		return nil, err
+	}
+
+	if unified {
+		g := &Group{v2: true, path: filepath.Join(base, name)}
+		if err := os.MkdirAll(g.path, 0755); err != nil {
+			return nil, err
+		}
+		return g, nil
+	}
+
+	g := &Group{dirs: make(map[string]string)}
+	for controller, dir := range v1Base {
+		g.dirs[controller] = filepath.Join(dir, name)
+		if err := os.MkdirAll(g.dirs[controller], 0755); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// ForProcess returns the cgroup v2 group a process is in, for a group
+// delegated by systemd. Remove leaves it in place.
+func ForProcess(pid int) (*Group, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("delegated cgroups need cgroup v2")
+	}
+
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return &Group{v2: true, path: filepath.Join(cgroupRoot, path), external: true}, nil
+		}
+	}
+	return nil, fmt.Errorf("process %d is in no cgroup v2 group", pid)
+}
+
+// AddProcess moves a process into the group. Children it forks afterwards
+// are created in the group too.
+func (g *Group) AddProcess(pid int) error {
+	if g.v2 {
+		return writeFile(filepath.Join(g.path, "cgroup.procs"), strconv.Itoa(pid))
+	}
+
+	for _, dir := range g.dirs {
+		if err := writeFile(filepath.Join(dir, "cgroup.procs"), strconv.Itoa(pid)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CPUUsage returns the CPU time used by the group so far
+func (g *Group) CPUUsage() (Usage, error) {
+	now := time.Now()
+
+	if g.v2 {
+		stats, err := readKeyValues(filepath.Join(g.path, "cpu.stat"))
+		if err != nil {
+			return Usage{}, err
+		}
+		return Usage{CPU: time.Duration(stats["usage_usec"]) * time.Microsecond, Time: now}, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(g.dirs["cpuacct"], "cpuacct.usage"))
+	if err != nil {
+		return Usage{}, err
+	}
+	ns, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{CPU: time.Duration(ns), Time: now}, nil
+}
+
+// SetCPUMax caps the group at a CPU percentage, where 100 is one core
+func (g *Group) SetCPUMax(percent float64) error {
+	quota := int(percent / 100 * cpuPeriod)
+	if quota < 1000 {
+		quota = 1000
+	}
+
+	if g.v2 {
+		return writeFile(filepath.Join(g.path, "cpu.max"), fmt.Sprintf("%d %d", quota, cpuPeriod))
+	}
+	if err := writeFile(filepath.Join(g.dirs["cpu"], "cpu.cfs_period_us"), strconv.Itoa(cpuPeriod)); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(g.dirs["cpu"], "cpu.cfs_quota_us"), strconv.Itoa(quota))
+}
+
+// ResetCPUMax removes the CPU cap
+func (g *Group) ResetCPUMax() error {
+	if g.v2 {
+		return writeFile(filepath.Join(g.path, "cpu.max"), fmt.Sprintf("max %d", cpuPeriod))
+	}
+	return writeFile(filepath.Join(g.dirs["cpu"], "cpu.cfs_quota_us"), "-1")
+}
+
+// SetCPUWeight sets the relative CPU share of the group, from 1 to 10000
+// with 100 as the default
+func (g *Group) SetCPUWeight(weight int) error {
+	if g.v2 {
+		return writeFile(filepath.Join(g.path, "cpu.weight"), strconv.Itoa(weight))
+	}
+
+	// cpu.shares defaults to 1024 and must be at least 2
+	shares := weight * 1024 / 100
+	if shares < 2 {
+		shares = 2
+	}
+	return writeFile(filepath.Join(g.dirs["cpu"], "cpu.shares"), strconv.Itoa(shares))
+}
+
+// SetMemoryHigh sets the memory usage above which the kernel throttles the
+// group and reclaims its memory instead of killing it
+func (g *Group) SetMemoryHigh(bytes uint64) error {
+	if g.v2 {
+		return writeFile(filepath.Join(g.path, "memory.high"), strconv.FormatUint(bytes, 10))
+	}
+	return writeFile(filepath.Join(g.dirs["memory"], "memory.soft_limit_in_bytes"), strconv.FormatUint(bytes, 10))
+}
+
+// MemoryHighEvents returns how often the group was throttled for exceeding
+// its memory.high, or 0 on cgroup v1, which doesn't count them
+func (g *Group) MemoryHighEvents() (uint64, error) {
+	if !g.v2 {
+		return 0, nil
+	}
+
+	events, err := readKeyValues(filepath.Join(g.path, "memory.events"))
+	if err != nil {
+		return 0, err
+	}
+	return events["high"], nil
+}
+
+// OOMKills returns how many processes of the group the OOM killer killed
+func (g *Group) OOMKills() (uint64, error) {
+	path := filepath.Join(g.path, "memory.events")
+	if !g.v2 {
+		path = filepath.Join(g.dirs["memory"], "memory.oom_control")
+	}
+
+	events, err := readKeyValues(path)
+	if err != nil {
+		return 0, err
+	}
+	return events["oom_kill"], nil
+}
+
+// Remove deletes the group. It fails while processes are left in it.
+func (g *Group) Remove() error {
+	if g.external {
+		return nil
+	}
+	if g.v2 {
+		return os.Remove(g.path)
+	}
+
+	var firstErr error
+	for _, dir := range g.dirs {
+		if err := os.Remove(dir); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// readKeyValues reads a cgroup file of "key value" lines
+func readKeyValues(path string) (map[string]uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values, nil
+}
+
+func writeFile(path, value string) error {
+	return os.WriteFile(path, []byte(value), 0644)
+}
+
+// CPUQuota returns the CPU quota of the daemon's cgroup, and its ancestors
+// on v2, in CPUs. It returns 0 if no quota is set.
+func CPUQuota() (float64, error) {
+	paths, err := selfCgroups()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err == nil {
+		quota := 0.0
+		for dir := filepath.Join(cgroupRoot, paths[""]); strings.HasPrefix(dir, cgroupRoot); dir = filepath.Dir(dir) {
+			data, err := os.ReadFile(filepath.Join(dir, "cpu.max"))
+			if err == nil {
+				if q := parseQuota(strings.Fields(string(data))); q > 0 && (quota == 0 || q < quota) {
+					quota = q
+				}
+			}
+			if dir == cgroupRoot {
+				break
+			}
+		}
+		return quota, nil
+	}
+
+	dir := filepath.Join(cgroupRoot, "cpu", paths["cpu"])
+	quota, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_quota_us"))
+	if err != nil {
+		return 0, err
+	}
+	period, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, err
+	}
+	return parseQuota([]string{strings.TrimSpace(string(quota)), strings.TrimSpace(string(period))}), nil
+}
+
+// parseQuota turns a quota and period in microseconds into CPUs, 0 for no
+// quota ("max" or -1)
+func parseQuota(fields []string) float64 {
+	if len(fields) != 2 {
+		return 0
+	}
+	quota, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || quota <= 0 {
+		return 0
+	}
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || period <= 0 {
+		return 0
+	}
+	return quota / period
+}
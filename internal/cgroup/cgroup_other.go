@@ -0,0 +1,47 @@
+//go:build !linux
+
+package cgroup
+
+import "fmt"
+
+var errUnsupported = fmt.Errorf("cgroups are only supported on Linux")
+
+// New is only supported on Linux
+func New(name string) (*Group, error) {
+	return nil, errUnsupported
+}
+
+// ForProcess is only supported on Linux
+func ForProcess(pid int) (*Group, error) {
+	return nil, errUnsupported
+}
+
+// AddProcess is only supported on Linux
+func (g *Group) AddProcess(pid int) error { return errUnsupported }
+
+// CPUUsage is only supported on Linux
+func (g *Group) CPUUsage() (Usage, error) { return Usage{}, errUnsupported }
+
+// SetCPUMax is only supported on Linux
+func (g *Group) SetCPUMax(percent float64) error { return errUnsupported }
+
+// ResetCPUMax is only supported on Linux
+func (g *Group) ResetCPUMax() error { return errUnsupported }
+
+// SetCPUWeight is only supported on Linux
+func (g *Group) SetCPUWeight(weight int) error { return errUnsupported }
+
+// SetMemoryHigh is only supported on Linux
+func (g *Group) SetMemoryHigh(bytes uint64) error { return errUnsupported }
+
+// MemoryHighEvents is only supported on Linux
+func (g *Group) MemoryHighEvents() (uint64, error) { return 0, errUnsupported }
+
+// OOMKills is only supported on Linux
+func (g *Group) OOMKills() (uint64, error) { return 0, errUnsupported }
+
+// Remove is only supported on Linux
+func (g *Group) Remove() error { return errUnsupported }
+
+// CPUQuota is only supported on Linux
+func CPUQuota() (float64, error) { return 0, errUnsupported }
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// statusAnnotations is the number of recent annotations gem status shows
+const statusAnnotations = 5
+
+var annotateCmd = &cobra.Command{
+	Use:   "annotate <name|id> [text...]",
+	Short: "Attach a note to a process or list its notes",
+	Long: `Attach a free-form note to a process, e.g. why it was rolled back, as a
+lightweight operational journal. Notes are stored with the time and the
+token name of the author, published as annotation events and the latest
+ones are shown by gem status. Without text the notes of the process are
+listed.`,
+	Example: `  gem annotate web "rolled back to 1.4.2 due to bug X"
+  gem annotate web`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		if len(args) == 1 {
+			annotations, err := client.Annotations(args[0])
+			if err != nil {
+				exitWithError("Failed to get annotations", err)
+			}
+			if len(annotations) == 0 {
+				fmt.Println("No annotations")
+				return
+			}
+
+			t := newTable("TIME", "AUTHOR", "TEXT")
+			t.truncatable(2)
+			for _, a := range annotations {
+				t.row(formatTime(a.Timestamp), valueOrDash(a.Author), strings.ReplaceAll(a.Text, "\n", " "))
+			}
+			t.print()
+			return
+		}
+
+		annotation, err := client.Annotate(args[0], strings.Join(args[1:], " "))
+		if err != nil {
+			exitWithError("Failed to annotate process", err)
+		}
+		fmt.Printf("Annotated process '%s' at %s\n", args[0], formatTime(annotation.Timestamp))
+	},
+}
+
+// printAnnotations prints annotations one per line, each line of a
+// multi-line note indented below the first
+func printAnnotations(annotations []types.Annotation, indent string) {
+	for _, a := range annotations {
+		lines := strings.Split(a.Text, "\n")
+		fmt.Printf("%s%s  %s  %s\n", indent, formatTime(a.Timestamp), valueOrDash(a.Author), lines[0])
+		for _, line := range lines[1:] {
+			fmt.Printf("%s    %s\n", indent, line)
+		}
+	}
+}
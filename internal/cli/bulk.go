@@ -0,0 +1,285 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	bulkAll       bool
+	bulkNamespace string
+	bulkParallel  int
+)
+
+// spinnerFrames animate targets still in progress
+var spinnerFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// spinnerInterval is how often the progress display is redrawn
+const spinnerInterval = 100 * time.Millisecond
+
+// bulkAction is an operation that can be applied to many processes
+type bulkAction struct {
+	verb    string // e.g. "restart"
+	present string // e.g. "Restarting"
+	past    string // e.g. "Restarted"
+	run     func(client *Client, idOrName string) error
+}
+
+// addBulkFlags adds the target selection flags to a command acting on
+// processes
+func addBulkFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&bulkAll, "all", false, "Act on all processes")
+	cmd.Flags().StringVarP(&bulkNamespace, "namespace", "N", "", "Act on the processes of a namespace")
+	cmd.Flags().IntVar(&bulkParallel, "parallel", 10, "Number of processes acted on at once")
+}
+
+// bulkArgs accepts targets as arguments or through --all/--namespace
+func bulkArgs(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 && !bulkAll && bulkNamespace == "" {
+		return fmt.Errorf("requires a process name, glob, --all or --namespace")
+	}
+	return nil
+}
+
+// resolveTargets expands glob patterns like 'web-*', --all and --namespace
+// into process names. Plain names and IDs are passed on as given.
+func resolveTargets(client *Client, args []string) ([]string, error) {
+	needList := bulkAll || bulkNamespace != ""
+	for _, arg := range args {
+		if isGlob(arg) {
+			needList = true
+		}
+	}
+	if !needList {
+		return args, nil
+	}
+
+	processes, err := client.List(false)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			targets = append(targets, name)
+		}
+	}
+
+	for _, p := range processes {
+		if bulkNamespace != "" && p.Namespace != bulkNamespace {
+			continue
+		}
+		if len(args) == 0 {
+			add(p.Name)
+			continue
+		}
+		for _, arg := range args {
+			if ok, _ := path.Match(arg, p.Name); ok && isGlob(arg) {
+				add(p.Name)
+			}
+		}
+	}
+	for _, arg := range args {
+		if !isGlob(arg) {
+			add(arg)
+		}
+	}
+
+	return targets, nil
+}
+
+func isGlob(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// runBulk applies an action to the targets given on the command line. A
+// single target keeps the plain output, many are acted on concurrently with
+// a live progress display and a summary.
+func runBulk(args []string, action bulkAction) {
+	client, err := NewClient()
+	if err != nil {
+		exitWithError("Failed to connect to daemon", err)
+	}
+
+	targets, err := resolveTargets(client, args)
+	if err != nil {
+		exitWithError("Failed to list processes", err)
+	}
+	if len(targets) == 0 {
+		fmt.Println("No matching processes")
+		return
+	}
+
+	if len(targets) == 1 && len(args) == 1 && !isGlob(args[0]) {
+		if err := action.run(client, targets[0]); err != nil {
+			exitWithError(fmt.Sprintf("Failed to %s process", action.verb), err)
+		}
+		fmt.Printf("%s process '%s'\n", action.past, targets[0])
+		return
+	}
+
+	progress := newBulkProgress(targets)
+	results := make([]error, len(targets))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(bulkParallel, 1))
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = action.run(client, target)
+			progress.done(i, results[i])
+		}()
+	}
+
+	progress.run(action)
+	wg.Wait()
+	progress.stop()
+
+	failed := 0
+	for _, err := range results {
+		if err != nil {
+			failed++
+		}
+	}
+	fmt.Printf("%s %d/%d processes", action.past, len(targets)-failed, len(targets))
+	if failed > 0 {
+		fmt.Printf(", %d failed\n", failed)
+		os.Exit(1)
+	}
+	fmt.Println()
+}
+
+// bulkProgress shows the state of every target. On a terminal each target
+// gets a line with a spinner that is redrawn in place, otherwise a line is
+// printed as each target finishes.
+type bulkProgress struct {
+	mu       sync.Mutex
+	targets  []string
+	results  []error
+	finished []bool
+	live     bool
+	width    int
+	frame    int
+	drawn    bool
+	quit     chan struct{}
+	stopped  chan struct{}
+}
+
+func newBulkProgress(targets []string) *bulkProgress {
+	p := &bulkProgress{
+		targets:  targets,
+		results:  make([]error, len(targets)),
+		finished: make([]bool, len(targets)),
+		quit:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	// Redrawing in place only works while all lines fit on the screen
+	if ws, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ); err == nil {
+		p.live = len(targets) < int(ws.Row)
+		p.width = int(ws.Col)
+	}
+
+	return p
+}
+
+// done records the result of a target
+func (p *bulkProgress) done(i int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.results[i] = err
+	p.finished[i] = true
+	if !p.live {
+		p.printLine(i, "")
+	}
+}
+
+// run redraws the live display until stop is called
+func (p *bulkProgress) run(action bulkAction) {
+	go func() {
+		defer close(p.stopped)
+		if !p.live {
+			<-p.quit
+			return
+		}
+
+		ticker := time.NewTicker(spinnerInterval)
+		defer ticker.Stop()
+		for {
+			p.redraw(action)
+			select {
+			case <-ticker.C:
+			case <-p.quit:
+				p.redraw(action)
+				return
+			}
+		}
+	}()
+}
+
+// stop ends the display once all targets are done
+func (p *bulkProgress) stop() {
+	close(p.quit)
+	<-p.stopped
+}
+
+func (p *bulkProgress) redraw(action bulkAction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.drawn {
+		fmt.Printf("\x1b[%dA", len(p.targets))
+	}
+	p.drawn = true
+
+	p.frame = (p.frame + 1) % len(spinnerFrames)
+	for i := range p.targets {
+		fmt.Print("\r\x1b[K")
+		if p.finished[i] {
+			p.printLine(i, "")
+		} else {
+			p.printLine(i, string(spinnerFrames[p.frame])+" "+action.present)
+		}
+	}
+}
+
+// printLine prints the state of a target, pending when set
+func (p *bulkProgress) printLine(i int, pending string) {
+	mark, line := pending, p.targets[i]
+	switch {
+	case pending != "":
+	case p.results[i] != nil:
+		msg, _, _ := strings.Cut(p.results[i].Error(), "\n")
+		mark, line = p.mark(colorRed, "✗"), line+": "+msg
+	default:
+		mark = p.mark(colorGreen, "✓")
+	}
+
+	// Lines mustn't wrap, or redrawing in place gets misaligned
+	if p.live && p.width > 0 {
+		line = truncateText(line, max(p.width-textWidth(pending)-2, 1))
+	}
+	fmt.Printf("%s %s\n", mark, line)
+}
+
+func (p *bulkProgress) mark(color, mark string) string {
+	if p.live && colorEnabled() {
+		return color + mark + colorReset
+	}
+	return mark
+}
@@ -2,10 +2,16 @@ package cli
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/PrismManager/gemstone/internal/config"
@@ -17,19 +23,55 @@ type Client struct {
 	baseURL    string
 	httpClient *http.Client
 	authToken  string
+	// socketPath and address are where the daemon is looked for, socketErr
+	// is why the socket couldn't be used
+	socketPath string
+	address    string
+	socketErr  error
 }
 
 // StartRequest mirrors types.StartRequest for the CLI
 type StartRequest struct {
-	Name        string            `json:"name"`
-	Command     string            `json:"command"`
-	Args        []string          `json:"args,omitempty"`
-	WorkDir     string            `json:"work_dir,omitempty"`
-	Env         map[string]string `json:"env,omitempty"`
-	AutoStart   bool              `json:"auto_start"`
-	AutoRestart bool              `json:"auto_restart"`
-	MaxRestarts int               `json:"max_restarts"`
-	User        string            `json:"user,omitempty"`
+	Name                  string                `json:"name"`
+	Description           string                `json:"description,omitempty"`
+	Homepage              string                `json:"homepage,omitempty"`
+	OwnerContact          string                `json:"owner_contact,omitempty"`
+	Command               string                `json:"command"`
+	Args                  []string              `json:"args,omitempty"`
+	WorkDir               string                `json:"work_dir,omitempty"`
+	Stdin                 string                `json:"stdin,omitempty"`
+	Env                   map[string]string     `json:"env,omitempty"`
+	AutoStart             bool                  `json:"auto_start"`
+	AutoRestart           bool                  `json:"auto_restart"`
+	MaxRestarts           int                   `json:"max_restarts"`
+	User                  string                `json:"user,omitempty"`
+	Group                 string                `json:"group,omitempty"`
+	Timezone              string                `json:"timezone,omitempty"`
+	Locale                string                `json:"locale,omitempty"`
+	OutputEncoding        string                `json:"output_encoding,omitempty"`
+	Namespace             string                `json:"namespace,omitempty"`
+	LogPipe               string                `json:"log_pipe,omitempty"`
+	LogQuota              int                   `json:"log_quota,omitempty"`
+	RestartPolicy         string                `json:"restart_policy,omitempty"`
+	MaxUptime             string                `json:"max_uptime,omitempty"`
+	Schedule              string                `json:"schedule,omitempty"`
+	RestartOnBinaryChange bool                  `json:"restart_on_binary_change,omitempty"`
+	WaitFor               *types.WaitFor        `json:"wait_for,omitempty"`
+	SoftLimits            *types.SoftLimits     `json:"soft_limits,omitempty"`
+	Reserve               *types.Reservation    `json:"reserve,omitempty"`
+	OOMScoreAdj           int                   `json:"oom_score_adj,omitempty"`
+	Capabilities          *types.Capabilities   `json:"capabilities,omitempty"`
+	Seccomp               string                `json:"seccomp,omitempty"`
+	AppArmorProfile       string                `json:"apparmor_profile,omitempty"`
+	SELinuxLabel          string                `json:"selinux_label,omitempty"`
+	Network               *types.Network        `json:"network,omitempty"`
+	MonitorPaths          []string              `json:"monitor_paths,omitempty"`
+	DiskAlert             int                   `json:"disk_alert,omitempty"`
+	Ports                 []string              `json:"ports,omitempty"`
+	OutputWatchdog        *types.OutputWatchdog `json:"output_watchdog,omitempty"`
+	Standby               *types.Standby        `json:"standby,omitempty"`
+	Fetch                 *types.Fetch          `json:"fetch,omitempty"`
+	Source                *types.Source         `json:"source,omitempty"`
 }
 
 // NewClient creates a new CLI client
@@ -40,13 +82,40 @@ func NewClient() (*Client, error) {
 		cfg = config.DefaultConfig()
 	}
 
-	return &Client{
-		baseURL: fmt.Sprintf("http://%s:%d/api/v1", cfg.API.Host, cfg.API.Port),
+	// Talk to the first configured listen address
+	listen := cfg.API.ListenAddresses()[0]
+	scheme := "http"
+	if listen.TLS.Enabled() {
+		scheme = "https"
+	}
+	host, port, err := net.SplitHostPort(listen.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API address %q: %w", listen.Address, err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+
+	c := &Client{
+		baseURL: fmt.Sprintf("%s://%s%s/api/v1", scheme, net.JoinHostPort(host, port), cfg.API.Prefix()),
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		authToken: cfg.API.AuthToken,
-	}, nil
+		authToken:  cfg.API.AuthToken,
+		socketPath: config.GetSocketPath(),
+		address:    net.JoinHostPort(host, port),
+	}
+
+	// Prefer the unix socket when the daemon listens on it, local users are
+	// authorized there without a token
+	ok, err := probeSocket(c.socketPath)
+	if ok {
+		c.baseURL = "http://" + socketHost + cfg.API.Prefix() + "/api/v1"
+		c.httpClient.Transport = socketTransport(c.socketPath)
+	}
+	c.socketErr = err
+
+	return c, nil
 }
 
 func (c *Client) doRequest(method, path string, body interface{}) (*types.Response, error) {
@@ -69,9 +138,9 @@ func (c *Client) doRequest(method, path string, body interface{}) (*types.Respon
 		req.Header.Set("Authorization", "Bearer "+c.authToken)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.send(c.httpClient, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to daemon: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -135,6 +204,81 @@ func (c *Client) Restart(idOrName string) error {
 	return nil
 }
 
+// RestartHealthy restarts a process and waits until the new run is
+// healthy, failing if it isn't within timeout
+func (c *Client) RestartHealthy(idOrName string, timeout time.Duration) error {
+	// The daemon answers once the process is healthy or the timeout passed,
+	// after stopping it
+	httpClient := *c.httpClient
+	httpClient.Timeout = timeout + c.httpClient.Timeout
+	wait := *c
+	wait.httpClient = &httpClient
+
+	resp, err := wait.doRequest("POST", "/processes/"+idOrName+"/restart?wait_healthy=true&timeout="+timeout.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return fmt.Errorf(resp.Error)
+	}
+
+	return nil
+}
+
+// Reset clears the restart counters and error state of a process
+func (c *Client) Reset(idOrName string) error {
+	resp, err := c.doRequest("POST", "/processes/"+idOrName+"/reset", nil)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return fmt.Errorf(resp.Error)
+	}
+
+	return nil
+}
+
+// Failover hands a process over to its warm standby
+func (c *Client) Failover(idOrName string) error {
+	resp, err := c.doRequest("POST", "/processes/"+idOrName+"/failover", nil)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return fmt.Errorf(resp.Error)
+	}
+
+	return nil
+}
+
+// PlanStart resolves what starting a process would run without starting it
+func (c *Client) PlanStart(req *StartRequest) (*types.LaunchPlan, error) {
+	return c.plan("/processes?dry_run=true", req)
+}
+
+// PlanRestart resolves what restarting a process would run without
+// restarting it
+func (c *Client) PlanRestart(idOrName string) (*types.LaunchPlan, error) {
+	return c.plan("/processes/"+idOrName+"/restart?dry_run=true", nil)
+}
+
+func (c *Client) plan(path string, body interface{}) (*types.LaunchPlan, error) {
+	resp, err := c.doRequest("POST", path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan types.LaunchPlan
+	if err := decodeData(resp, &plan); err != nil {
+		return nil, err
+	}
+
+	return &plan, nil
+}
+
 // Delete deletes a process
 func (c *Client) Delete(idOrName string) error {
 	resp, err := c.doRequest("DELETE", "/processes/"+idOrName, nil)
@@ -149,9 +293,208 @@ func (c *Client) Delete(idOrName string) error {
 	return nil
 }
 
-// List lists all processes
-func (c *Client) List() ([]*types.ProcessInfo, error) {
-	resp, err := c.doRequest("GET", "/processes", nil)
+// Update changes settings of a process
+func (c *Client) Update(idOrName string, patch *types.ProcessPatch) (*types.ProcessInfo, error) {
+	resp, err := c.doRequest("PATCH", "/processes/"+idOrName, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	var info types.ProcessInfo
+	if err := decodeData(resp, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// History gets the definition history of a process
+func (c *Client) History(idOrName string) ([]types.DefinitionVersion, error) {
+	resp, err := c.doRequest("GET", "/processes/"+idOrName+"/history", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []types.DefinitionVersion
+	if err := decodeData(resp, &history); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// Annotate attaches a note to a process
+func (c *Client) Annotate(idOrName, text string) (*types.Annotation, error) {
+	resp, err := c.doRequest("POST", "/processes/"+idOrName+"/annotations", types.AnnotateRequest{Text: text})
+	if err != nil {
+		return nil, err
+	}
+
+	var annotation types.Annotation
+	if err := decodeData(resp, &annotation); err != nil {
+		return nil, err
+	}
+
+	return &annotation, nil
+}
+
+// Annotations gets the notes attached to a process, oldest first
+func (c *Client) Annotations(idOrName string) ([]types.Annotation, error) {
+	resp, err := c.doRequest("GET", "/processes/"+idOrName+"/annotations", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var annotations []types.Annotation
+	if err := decodeData(resp, &annotations); err != nil {
+		return nil, err
+	}
+
+	return annotations, nil
+}
+
+// Runs gets the finished runs of a scheduled process, oldest first
+func (c *Client) Runs(idOrName string) ([]types.ScheduledRun, error) {
+	resp, err := c.doRequest("GET", "/processes/"+idOrName+"/runs", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []types.ScheduledRun
+	if err := decodeData(resp, &runs); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// eventsPath returns the events endpoint for a process, or for the whole
+// daemon if idOrName is empty
+func eventsPath(idOrName string, limit int, eventTypes []string) string {
+	path := fmt.Sprintf("/events?limit=%d", limit)
+	if idOrName != "" {
+		path = fmt.Sprintf("/processes/%s/events?limit=%d", idOrName, limit)
+	}
+	if len(eventTypes) > 0 {
+		path += "&type=" + url.QueryEscape(strings.Join(eventTypes, ","))
+	}
+	return path
+}
+
+// Events gets recent events of a process, or of the whole daemon if idOrName
+// is empty
+func (c *Client) Events(idOrName string, limit int, eventTypes []string) ([]types.Event, error) {
+	resp, err := c.doRequest("GET", eventsPath(idOrName, limit, eventTypes), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []types.Event
+	if err := decodeData(resp, &events); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// FollowEvents calls fn with recent events and then with new events as they
+// happen. It only returns when the connection fails or ctx is done.
+func (c *Client) FollowEvents(ctx context.Context, idOrName string, limit int, eventTypes []string, fn func(types.Event)) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+eventsPath(idOrName, limit, eventTypes)+"&follow=true", nil)
+	if err != nil {
+		return err
+	}
+	if c.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+	}
+
+	// The stream stays open, so don't apply the default request timeout
+	httpClient := *c.httpClient
+	httpClient.Timeout = 0
+
+	resp, err := c.send(&httpClient, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var response types.Response
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return fmt.Errorf("%s", response.Error)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var event types.Event
+		if err := dec.Decode(&event); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == io.EOF {
+				return fmt.Errorf("daemon closed the event stream")
+			}
+			return err
+		}
+		fn(event)
+	}
+}
+
+// Rollback restores a previous definition version of a process
+func (c *Client) Rollback(idOrName string, version int) (*types.ProcessInfo, error) {
+	resp, err := c.doRequest("POST", "/processes/"+idOrName+"/rollback", types.RollbackRequest{Version: version})
+	if err != nil {
+		return nil, err
+	}
+
+	var info types.ProcessInfo
+	if err := decodeData(resp, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// Deploy fetches and checks out the source of a process, restarting it
+func (c *Client) Deploy(idOrName string) (*types.ProcessInfo, error) {
+	resp, err := c.doRequest("POST", "/processes/"+idOrName+"/deploy", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var info types.ProcessInfo
+	if err := decodeData(resp, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// Simulate runs the restart rules of a process against simulated crashes
+func (c *Client) Simulate(idOrName string, req types.SimulateRequest) (*types.Simulation, error) {
+	resp, err := c.doRequest("POST", "/processes/"+idOrName+"/simulate", req)
+	if err != nil {
+		return nil, err
+	}
+
+	var sim types.Simulation
+	if err := decodeData(resp, &sim); err != nil {
+		return nil, err
+	}
+
+	return &sim, nil
+}
+
+// List lists all processes. With fresh, the daemon samples CPU and memory
+// usage now instead of reporting the last stats sample.
+func (c *Client) List(fresh bool) ([]*types.ProcessInfo, error) {
+	path := "/processes"
+	if fresh {
+		path += "?fresh=true"
+	}
+	resp, err := c.doRequest("GET", path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -175,7 +518,17 @@ func (c *Client) List() ([]*types.ProcessInfo, error) {
 
 // Get gets a process by ID or name
 func (c *Client) Get(idOrName string) (*types.ProcessInfo, error) {
-	resp, err := c.doRequest("GET", "/processes/"+idOrName, nil)
+	return c.get("/processes/" + idOrName)
+}
+
+// GetFresh gets a process by ID or name with CPU and memory usage sampled
+// now
+func (c *Client) GetFresh(idOrName string) (*types.ProcessInfo, error) {
+	return c.get("/processes/" + idOrName + "?fresh=true")
+}
+
+func (c *Client) get(path string) (*types.ProcessInfo, error) {
+	resp, err := c.doRequest("GET", path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -197,11 +550,12 @@ func (c *Client) Get(idOrName string) (*types.ProcessInfo, error) {
 	return &info, nil
 }
 
-// GetLogs gets logs for a process
-func (c *Client) GetLogs(idOrName string, lines int, logType string) ([]string, error) {
-	path := fmt.Sprintf("/processes/%s/logs?lines=%d", idOrName, lines)
-	if logType != "" {
-		path += "&type=" + logType
+// GetLogs gets logs for a process. With grep, the daemon only returns lines
+// matching the regular expression, or not matching it with invert.
+func (c *Client) GetLogs(idOrName string, lines int, logType string, run int, grep string, invert bool) ([]string, error) {
+	path := logsPath(idOrName, lines, logType, grep, invert)
+	if run > 0 {
+		path += fmt.Sprintf("&run=%d", run)
 	}
 
 	resp, err := c.doRequest("GET", path, nil)
@@ -226,10 +580,302 @@ func (c *Client) GetLogs(idOrName string, lines int, logType string) ([]string,
 	return logs, nil
 }
 
+// FollowLogs calls fn with the last lines of a log, or the lines after a
+// sequence number if after is set, and then with the lines captured from
+// then on. It only returns when the connection fails or ctx is done; an
+// error response of the daemon is a *rejectedError.
+func (c *Client) FollowLogs(ctx context.Context, idOrName string, lines int, logType, grep string, invert bool, after *uint64, fn func(types.LogStreamMessage)) error {
+	path := logsPath(idOrName, lines, logType, grep, invert) + "&follow=true"
+	if after != nil {
+		path += fmt.Sprintf("&after=%d", *after)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+	}
+
+	// The stream stays open, so don't apply the default request timeout
+	httpClient := *c.httpClient
+	httpClient.Timeout = 0
+
+	resp, err := c.send(&httpClient, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var response types.Response
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			return &rejectedError{Message: fmt.Sprintf("unexpected status %s", resp.Status)}
+		}
+		return &rejectedError{Message: response.Error}
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg types.LogStreamMessage
+		if err := dec.Decode(&msg); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == io.EOF {
+				return fmt.Errorf("daemon closed the log stream")
+			}
+			return err
+		}
+		fn(msg)
+	}
+}
+
+// rejectedError is an error response of the daemon to a stream request, as
+// opposed to a failed connection
+type rejectedError struct {
+	Message string
+}
+
+func (e *rejectedError) Error() string {
+	return e.Message
+}
+
+// logsPath returns the path of the logs of a process with the common query
+func logsPath(idOrName string, lines int, logType, grep string, invert bool) string {
+	path := fmt.Sprintf("/processes/%s/logs?lines=%d", idOrName, lines)
+	if logType != "" {
+		path += "&type=" + logType
+	}
+	if grep != "" {
+		path += "&grep=" + url.QueryEscape(grep)
+		if invert {
+			path += "&invert=true"
+		}
+	}
+	return path
+}
+
+// DownloadLogs streams a raw log file of a process to w and returns the
+// file name suggested by the daemon
+func (c *Client) DownloadLogs(idOrName, logType string, rotation int, compress bool, w io.Writer) (string, error) {
+	path := fmt.Sprintf("/processes/%s/logs/download?rotation=%d", idOrName, rotation)
+	if logType != "" {
+		path += "&file=" + logType
+	}
+	if compress {
+		path += "&gzip=true"
+	}
+
+	req, err := http.NewRequest("GET", c.baseURL+path, nil)
+	if err != nil {
+		return "", err
+	}
+	if c.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+	}
+
+	// Log files can be large, so don't apply the default request timeout
+	httpClient := *c.httpClient
+	httpClient.Timeout = 0
+
+	resp, err := c.send(&httpClient, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var response types.Response
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			return "", fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return "", fmt.Errorf(response.Error)
+	}
+
+	filename := "log"
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := params["filename"]; name != "" {
+			filename = filepath.Base(name)
+		}
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return "", err
+	}
+
+	return filename, nil
+}
+
+// Usage gets the resource consumption of namespaces or processes. query
+// holds the since, until, period and by parameters.
+func (c *Client) Usage(query url.Values) ([]types.UsageRecord, error) {
+	resp, err := c.doRequest("GET", "/usage?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []types.UsageRecord
+	if err := decodeData(resp, &records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Snapshot returns the definitions and state of all processes
+func (c *Client) Snapshot() (*types.Snapshot, error) {
+	resp, err := c.doRequest("GET", "/snapshot", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var snap types.Snapshot
+	if err := decodeData(resp, &snap); err != nil {
+		return nil, err
+	}
+
+	return &snap, nil
+}
+
+// Namespaces returns the rollups of the namespaces
+func (c *Client) Namespaces() ([]types.NamespaceStatus, error) {
+	resp, err := c.doRequest("GET", "/namespaces", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces []types.NamespaceStatus
+	if err := decodeData(resp, &namespaces); err != nil {
+		return nil, err
+	}
+
+	return namespaces, nil
+}
+
+// Targets returns the configured targets
+func (c *Client) Targets() ([]types.TargetStatus, error) {
+	resp, err := c.doRequest("GET", "/targets", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []types.TargetStatus
+	if err := decodeData(resp, &targets); err != nil {
+		return nil, err
+	}
+
+	return targets, nil
+}
+
+// Apply applies a desired-state document
+func (c *Client) Apply(req *types.ApplyRequest) (*types.ApplyResult, error) {
+	resp, err := c.doRequest("POST", "/apply", req)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	var result types.ApplyResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// RestartGroup restarts a restart group. The result lists what was done to
+// the processes, also when the restart failed halfway.
+func (c *Client) RestartGroup(name string) (*types.GroupResult, error) {
+	resp, err := c.doRequest("POST", "/groups/"+url.PathEscape(name)+"/restart", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *types.GroupResult
+	if resp.Data != nil {
+		data, err := json.Marshal(resp.Data)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+	}
+	if !resp.Success {
+		return result, fmt.Errorf("%s", resp.Error)
+	}
+
+	return result, nil
+}
+
+// TargetAction starts or stops a target. The result lists what was done to
+// the processes, also when the action failed halfway.
+func (c *Client) TargetAction(name, action string) (*types.TargetResult, error) {
+	resp, err := c.doRequest("POST", "/targets/"+url.PathEscape(name)+"/"+action, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *types.TargetResult
+	if resp.Data != nil {
+		data, err := json.Marshal(resp.Data)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+	}
+	if !resp.Success {
+		return result, fmt.Errorf("%s", resp.Error)
+	}
+
+	return result, nil
+}
+
+// UsageCSV writes the resource consumption as CSV rendered by the daemon
+// to w
+func (c *Client) UsageCSV(query url.Values, w io.Writer) error {
+	query.Set("format", "csv")
+	req, err := http.NewRequest("GET", c.baseURL+"/usage?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if c.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+	}
+
+	resp, err := c.send(c.httpClient, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var response types.Response
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return fmt.Errorf(response.Error)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
 // GetAllStats gets stats for all running processes
 func (c *Client) GetAllStats() ([]*types.ProcessStats, error) {
 	// Get all processes first
-	processes, err := c.List()
+	processes, err := c.List(false)
 	if err != nil {
 		return nil, err
 	}
@@ -265,6 +911,149 @@ func (c *Client) GetAllStats() ([]*types.ProcessStats, error) {
 	return stats, nil
 }
 
+// GetStatsHistory returns the recorded stats samples of a process from the
+// window before now, or all of them for a zero window, oldest first
+func (c *Client) GetStatsHistory(idOrName string, window time.Duration) ([]types.ProcessStats, error) {
+	// A limit of 0 returns every sample the daemon keeps
+	path := "/processes/" + idOrName + "/stats/history?limit=0"
+	if window > 0 {
+		path += "&since=" + window.String()
+	}
+	resp, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []types.ProcessStats
+	if err := decodeData(resp, &history); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// GetConfig returns the effective configuration of the daemon
+func (c *Client) GetConfig() ([]config.Setting, error) {
+	resp, err := c.doRequest("GET", "/config", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var settings []config.Setting
+	if err := decodeData(resp, &settings); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// SetPaused pauses or resumes supervision by the daemon
+func (c *Client) SetPaused(paused bool) error {
+	path := "/daemon/resume"
+	if paused {
+		path = "/daemon/pause"
+	}
+
+	resp, err := c.doRequest("POST", path, nil)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return fmt.Errorf("%s", resp.Error)
+	}
+
+	return nil
+}
+
+// SetLockdown locks the API down or lifts the lockdown
+func (c *Client) SetLockdown(on bool) error {
+	path := "/daemon/unlock"
+	if on {
+		path = "/daemon/lockdown"
+	}
+
+	resp, err := c.doRequest("POST", path, nil)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return fmt.Errorf("%s", resp.Error)
+	}
+
+	return nil
+}
+
+// GetDaemonStats gets resource usage of the daemon itself
+func (c *Client) GetDaemonStats() (*types.DaemonStats, error) {
+	resp, err := c.doRequest("GET", "/daemon/stats", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, fmt.Errorf(resp.Error)
+	}
+
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats types.DaemonStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// ListPlugins lists the plugins loaded by the daemon
+func (c *Client) ListPlugins() ([]types.PluginInfo, error) {
+	resp, err := c.doRequest("GET", "/plugins", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var plugins []types.PluginInfo
+	if err := decodeData(resp, &plugins); err != nil {
+		return nil, err
+	}
+
+	return plugins, nil
+}
+
+// RunPluginCommand runs a custom command of a plugin
+func (c *Client) RunPluginCommand(name, command string, args []string) (*types.PluginResult, error) {
+	body := map[string]interface{}{"args": args}
+	resp, err := c.doRequest("POST", "/plugins/"+name+"/commands/"+command, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result types.PluginResult
+	if err := decodeData(resp, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// decodeData checks a response for success and decodes its data into v
+func decodeData(resp *types.Response, v interface{}) error {
+	if !resp.Success {
+		return fmt.Errorf("%s", resp.Error)
+	}
+
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
 // GetSystemInfo gets system information
 func (c *Client) GetSystemInfo() (*types.DaemonInfo, error) {
 	resp, err := c.doRequest("GET", "/system", nil)
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/config"
+)
+
+var (
+	configEffective bool
+	configOutput    string
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the daemon configuration",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the configuration",
+	Long: `Show the configuration file. With --effective the daemon reports the
+configuration it runs with, merged from defaults, the file and environment
+variables, with the source of every value. Secrets are redacted.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateOutputFormat(configOutput)
+
+		if !configEffective {
+			path := config.GetConfigPath()
+			data, err := os.ReadFile(path)
+			if os.IsNotExist(err) {
+				fmt.Printf("%s does not exist, the defaults apply (see --effective)\n", path)
+				return
+			}
+			if err != nil {
+				exitWithError("Failed to read config", err)
+			}
+			fmt.Printf("# %s\n%s", path, data)
+			return
+		}
+
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		settings, err := client.GetConfig()
+		if err != nil {
+			exitWithError("Failed to get config", err)
+		}
+
+		if printOutput(configOutput, settings) {
+			return
+		}
+
+		t := newTable("KEY", "VALUE", "SOURCE")
+		t.truncatable(1)
+		t.color(2, func(source string) string {
+			if source == config.SourceDefault {
+				return colorGray
+			}
+			return ""
+		})
+		for _, s := range settings {
+			source := s.Source
+			if s.Env != "" {
+				source += " (" + s.Env + ")"
+			}
+			t.row(s.Key, settingValue(s.Value), source)
+		}
+		t.print()
+	},
+}
+
+// settingValue formats a setting, lists and maps as JSON
+func settingValue(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "-"
+	case []interface{}, map[string]interface{}:
+		var b strings.Builder
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(value); err == nil {
+			return strings.TrimSpace(b.String())
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+func init() {
+	configShowCmd.Flags().BoolVar(&configEffective, "effective", false, "Show the effective configuration of the daemon with the source of each value")
+	configShowCmd.Flags().StringVarP(&configOutput, "output", "o", "", outputFlagUsage)
+	configCmd.AddCommand(configShowCmd)
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var deployCmd = &cobra.Command{
+	Use:   "deploy <name|id>",
+	Short: "Fetch the source of a process and restart it",
+	Long: `Fetch the git source of a process, check out its ref and restart the
+process if it is running and the revision changed. A deploy event is
+published, which an on_deploy hook can act on.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		info, err := client.Deploy(args[0])
+		if err != nil {
+			exitWithError("Failed to deploy", err)
+		}
+
+		fmt.Printf("Deployed process '%s' at revision %s\n", info.Name, shortRevision(info.Revision))
+	},
+}
+
+// shortRevision abbreviates a commit hash
+func shortRevision(revision string) string {
+	if len(revision) > 12 {
+		return revision[:12]
+	}
+	return revision
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/PrismManager/gemstone/internal/lint"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// ecosystemFlags are the flags of gem start that apply to ecosystem files;
+// everything else is set per process in the file
+var ecosystemFlags = map[string]bool{"namespace": true, "dry-run": true, "output": true}
+
+// isEcosystemFile reports whether the argument of gem start is a YAML or
+// JSON file of processes rather than a command
+func isEcosystemFile(arg string) bool {
+	switch strings.ToLower(filepath.Ext(arg)) {
+	case ".yaml", ".yml", ".json":
+	default:
+		return false
+	}
+	fi, err := os.Stat(arg)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// startEcosystem applies the processes of an ecosystem file without
+// deleting others and starts those that aren't running. --namespace is the
+// namespace of processes that don't set one.
+func startEcosystem(cmd *cobra.Command, path string) {
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if !ecosystemFlags[f.Name] && cmd.LocalFlags().Lookup(f.Name) != nil {
+			exitWithError("Failed to start "+path, fmt.Errorf("--%s can't be used with an ecosystem file, set it in the file instead", f.Name))
+		}
+	})
+
+	doc, err := lint.ParseFile(path)
+	if err != nil {
+		exitWithError("Failed to read "+path, err)
+	}
+	if len(doc.Processes) == 0 {
+		exitWithError("Failed to start "+path, fmt.Errorf("no processes in the file"))
+	}
+	if startNamespace != "" {
+		for i := range doc.Processes {
+			if doc.Processes[i].Namespace == "" {
+				doc.Processes[i].Namespace = startNamespace
+			}
+		}
+	}
+	doc.Partial = true
+	doc.Start = true
+	doc.DryRun = startDryRun
+
+	client, err := NewClient()
+	if err != nil {
+		exitWithError("Failed to connect to daemon", err)
+	}
+
+	result, err := client.Apply(doc)
+	if err != nil {
+		exitWithError("Failed to start "+path, err)
+	}
+	if !printOutput(planOutput, result) {
+		printApplyResult(result)
+	}
+
+	for _, change := range result.Changes {
+		if change.Error != "" {
+			os.Exit(1)
+		}
+	}
+}
+
+// printApplyResult prints what an apply did, or would do in a dry run, to
+// each process
+func printApplyResult(result *types.ApplyResult) {
+	if result.DryRun {
+		fmt.Println("Dry run, no changes made")
+	}
+
+	t := newTable("NAME", "NAMESPACE", "ACTION", "CHANGES", "ERROR")
+	t.truncatable(4)
+	t.color(2, func(action string) string {
+		switch {
+		case strings.HasPrefix(action, "failed"):
+			return colorRed
+		case action == string(types.ApplyUnchanged):
+			return colorGray
+		}
+		return colorGreen
+	})
+	for _, change := range result.Changes {
+		action := string(change.Action)
+		switch {
+		case change.Error != "":
+			action = "failed to " + action
+		case change.Started && change.Action == types.ApplyUnchanged:
+			action = "start"
+		case change.Started:
+			action += ", start"
+		}
+		t.row(change.Name, change.Namespace, action, valueOrDash(strings.Join(change.Fields, ",")), valueOrDash(change.Error))
+	}
+	t.print()
+}
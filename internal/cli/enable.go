@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+var enableCmd = &cobra.Command{
+	Use:   "enable <name|id>",
+	Short: "Start a process with the daemon",
+	Long:  `Enable auto-start, so the process is started whenever the daemon starts.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		setAutoStart(args[0], true)
+	},
+}
+
+var disableCmd = &cobra.Command{
+	Use:   "disable <name|id>",
+	Short: "Don't start a process with the daemon",
+	Long:  `Disable auto-start. A running process keeps running.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		setAutoStart(args[0], false)
+	},
+}
+
+func setAutoStart(idOrName string, autoStart bool) {
+	client, err := NewClient()
+	if err != nil {
+		exitWithError("Failed to connect to daemon", err)
+	}
+
+	info, err := client.Update(idOrName, &types.ProcessPatch{AutoStart: &autoStart})
+	if err != nil {
+		exitWithError("Failed to update process", err)
+	}
+
+	if autoStart {
+		fmt.Printf("Enabled process '%s'\n", info.Name)
+	} else {
+		fmt.Printf("Disabled process '%s'\n", info.Name)
+	}
+}
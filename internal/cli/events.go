@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+var (
+	eventsLimit  int
+	eventsFollow bool
+	eventsTypes  []string
+)
+
+var eventsCmd = &cobra.Command{
+	Use:   "events [name|id]",
+	Short: "Show the event timeline",
+	Long: `Show recent events of a process, or of the whole daemon: starts, stops,
+crashes with their exit codes, restarts, throttling and definition changes.
+Use --follow to keep streaming new events.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		target := ""
+		if len(args) > 0 {
+			target = args[0]
+		}
+
+		if eventsFollow {
+			err := client.FollowEvents(context.Background(), target, eventsLimit, eventsTypes, printEvent)
+			exitWithError("Event stream ended", err)
+		}
+
+		events, err := client.Events(target, eventsLimit, eventsTypes)
+		if err != nil {
+			exitWithError("Failed to get events", err)
+		}
+
+		if len(events) == 0 {
+			fmt.Println("No events")
+			return
+		}
+		for _, event := range events {
+			printEvent(event)
+		}
+	},
+}
+
+// printEvent prints an event as one timeline line
+func printEvent(event types.Event) {
+	process := event.ProcessName
+	if process == "" {
+		process = "daemon"
+	}
+
+	fmt.Printf("%s  %-13s %-20s %s%s\n",
+		formatTime(event.Timestamp), event.Type, process,
+		event.Message, eventDetails(event))
+}
+
+// eventDetails formats the interesting data of an event
+func eventDetails(event types.Event) string {
+	var details []string
+	switch event.Type {
+	case types.EventCrash, types.EventStop:
+		if code, ok := event.Data["exit_code"]; ok {
+			details = append(details, fmt.Sprintf("exit_code=%v", code))
+		}
+	case types.EventConfigChange:
+		if version, ok := event.Data["version"]; ok {
+			details = append(details, fmt.Sprintf("version=%v", version))
+		}
+		if actor, ok := event.Data["actor"].(string); ok && actor != "" {
+			details = append(details, "actor="+actor)
+		}
+		if changes, ok := event.Data["changes"].([]interface{}); ok && len(changes) > 0 {
+			fields := make([]string, len(changes))
+			for i, c := range changes {
+				fields[i] = fmt.Sprint(c)
+			}
+			details = append(details, "changes="+strings.Join(fields, ","))
+		}
+	case types.EventAnnotation:
+		if author, ok := event.Data["author"].(string); ok && author != "" {
+			details = append(details, "author="+author)
+		}
+	}
+
+	if len(details) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(details, " ") + ")"
+}
+
+func init() {
+	eventsCmd.Flags().IntVarP(&eventsLimit, "limit", "n", 20, "Number of recent events to show (0 for all)")
+	eventsCmd.Flags().BoolVarP(&eventsFollow, "follow", "f", false, "Stream new events as they happen")
+	eventsCmd.Flags().StringSliceVarP(&eventsTypes, "type", "t", nil, "Only show events of these types (e.g. crash,restart)")
+}
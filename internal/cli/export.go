@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/secrets"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+var exportOutput string
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export process definitions to other formats",
+}
+
+var exportSystemdCmd = &cobra.Command{
+	Use:   "systemd <name|id>",
+	Short: "Render a systemd service unit for a process",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		info, err := client.Get(args[0])
+		if err != nil {
+			exitWithError("Failed to get process", err)
+		}
+
+		unit, warnings := renderSystemdUnit(info)
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+
+		if exportOutput == "" {
+			fmt.Print(unit)
+			return
+		}
+
+		if err := os.WriteFile(exportOutput, []byte(unit), 0644); err != nil {
+			exitWithError("Failed to write unit file", err)
+		}
+		fmt.Printf("Wrote %s\n", exportOutput)
+	},
+}
+
+// renderSystemdUnit renders a systemd service unit equivalent to a process
+// definition, with warnings about settings systemd can't express
+func renderSystemdUnit(info *types.ProcessInfo) (string, []string) {
+	var warnings []string
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Exported from gemstone process %s (%s)\n", info.Name, info.ID)
+	if info.OwnerContact != "" {
+		fmt.Fprintf(&b, "# Owner contact: %s\n", info.OwnerContact)
+	}
+	b.WriteString("[Unit]\n")
+	description := info.Description
+	if description == "" {
+		description = info.Name
+	}
+	fmt.Fprintf(&b, "Description=%s\n", systemdEscape(description))
+	if info.Homepage != "" {
+		fmt.Fprintf(&b, "Documentation=%s\n", systemdEscape(info.Homepage))
+	}
+	b.WriteString("After=network.target\n")
+	if info.AutoRestart && info.MaxRestarts > 0 {
+		// systemd limits restarts per interval instead of per lifetime
+		fmt.Fprintf(&b, "StartLimitBurst=%d\n", info.MaxRestarts)
+	}
+	b.WriteString("\n")
+
+	b.WriteString("[Service]\nType=simple\n")
+
+	if !filepath.IsAbs(info.Command) {
+		warnings = append(warnings, fmt.Sprintf("command %q is not an absolute path, systemd looks it up in its own PATH", info.Command))
+	}
+	words := make([]string, 0, len(info.Args)+1)
+	for _, word := range append([]string{info.Command}, info.Args...) {
+		words = append(words, systemdQuote(strings.ReplaceAll(word, "$", "$$")))
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(words, " "))
+
+	if info.WorkDir != "" {
+		fmt.Fprintf(&b, "WorkingDirectory=%s\n", systemdEscape(info.WorkDir))
+	}
+	if stdin := info.Stdin; stdin != "" && stdin != os.DevNull {
+		if !filepath.IsAbs(stdin) && info.WorkDir != "" {
+			stdin = filepath.Join(info.WorkDir, stdin)
+		}
+		if filepath.IsAbs(stdin) {
+			fmt.Fprintf(&b, "StandardInput=file:%s\n", systemdEscape(stdin))
+		} else {
+			warnings = append(warnings, "stdin is relative without a work_dir and not exported, StandardInput= needs an absolute path")
+		}
+	}
+
+	// systemd sets HOME and USER for User= itself
+	if info.Timezone != "" {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote("TZ="+info.Timezone))
+	}
+	if info.Locale != "" {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote("LANG="+info.Locale))
+	}
+	keys := make([]string, 0, len(info.Env))
+	for k := range info.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote(k+"="+info.Env[k]))
+	}
+
+	if info.User != "" {
+		fmt.Fprintf(&b, "User=%s\n", info.User)
+	}
+	if info.Group != "" {
+		fmt.Fprintf(&b, "Group=%s\n", info.Group)
+	}
+	if info.OOMScoreAdj != 0 {
+		fmt.Fprintf(&b, "OOMScoreAdjust=%d\n", info.OOMScoreAdj)
+	}
+	if n := info.Network; n != nil && n.Mode == "isolated" {
+		b.WriteString("PrivateNetwork=yes\n")
+		if len(n.Publish) > 0 {
+			warnings = append(warnings, "published ports are not exported, consider a socket unit with systemd-socket-proxyd")
+		}
+	}
+	if info.AppArmorProfile != "" {
+		fmt.Fprintf(&b, "AppArmorProfile=%s\n", info.AppArmorProfile)
+	}
+	if info.SELinuxLabel != "" {
+		fmt.Fprintf(&b, "SELinuxContext=%s\n", info.SELinuxLabel)
+	}
+	if c := info.Capabilities; c != nil {
+		if len(c.Keep) > 0 {
+			fmt.Fprintf(&b, "CapabilityBoundingSet=%s\n", systemdCapabilities(c.Keep))
+			if info.User != "" {
+				fmt.Fprintf(&b, "AmbientCapabilities=%s\n", systemdCapabilities(c.Keep))
+			}
+		}
+		if len(c.Drop) > 0 {
+			fmt.Fprintf(&b, "CapabilityBoundingSet=~%s\n", systemdCapabilities(c.Drop))
+		}
+	}
+
+	// gemstone sends SIGTERM to the process group and SIGKILL after 5s
+	b.WriteString("KillMode=control-group\nTimeoutStopSec=5\n")
+
+	if info.AutoRestart {
+		b.WriteString("Restart=on-failure\nRestartSec=1\n")
+	} else {
+		b.WriteString("Restart=no\n")
+	}
+
+	if info.AutoStart {
+		b.WriteString("\n[Install]\nWantedBy=multi-user.target\n")
+	}
+
+	if info.OutputEncoding != "" {
+		warnings = append(warnings, "output_encoding is not exported, the journal stores output as is")
+	}
+	if info.LogPipe != "" {
+		warnings = append(warnings, "log_pipe is not exported, output goes to the journal")
+	}
+	if info.LogQuota > 0 {
+		warnings = append(warnings, "log_quota is not exported, configure journald limits instead")
+	}
+	if info.RestartPolicy != "" {
+		warnings = append(warnings, "restart_policy is not exported")
+	}
+	if info.RestartOnBinaryChange {
+		warnings = append(warnings, "restart_on_binary_change is not exported")
+	}
+	if info.MaxUptime != "" {
+		warnings = append(warnings, "max_uptime is not exported, consider RuntimeMaxSec= with Restart=always")
+	}
+	if info.Schedule != "" {
+		warnings = append(warnings, "schedule is not exported, consider a timer unit with OnCalendar=")
+	}
+	if info.SoftLimits != nil {
+		warnings = append(warnings, "soft_limits are not exported, consider CPUQuota= or MemoryHigh=")
+	}
+	if info.Reserve != nil {
+		warnings = append(warnings, "reserve is not exported, systemd has no admission control")
+	}
+	if info.Seccomp != "" {
+		warnings = append(warnings, "seccomp is not exported, consider SystemCallFilter=")
+	}
+	if info.WaitFor != nil {
+		warnings = append(warnings, "wait_for is not exported, order the unit after its dependency instead")
+	}
+	if len(info.MonitorPaths) > 0 {
+		warnings = append(warnings, "monitor_paths and disk_alert are not exported")
+	}
+	if info.Source != nil {
+		warnings = append(warnings, "source is not exported, check out the repository and point WorkingDirectory at it")
+	}
+	if info.Fetch != nil {
+		warnings = append(warnings, fmt.Sprintf("fetch is not exported, ExecStart runs the script already fetched to %s", info.Command))
+	}
+	for _, v := range info.Env {
+		if secrets.IsReference(v) {
+			warnings = append(warnings, "secret references in env are exported literally, consider LoadCredential= or an EnvironmentFile=")
+			break
+		}
+	}
+	if info.OutputWatchdog != nil {
+		warnings = append(warnings, "output_watchdog is not exported, consider WatchdogSec= with sd_notify")
+	}
+	if info.Standby != nil {
+		warnings = append(warnings, "standby is not exported, systemd keeps no warm standby")
+	}
+	if len(info.Ports) > 0 {
+		warnings = append(warnings, "ports are not probed by systemd, consider a socket unit or a health check")
+	}
+
+	return b.String(), warnings
+}
+
+// systemdCapabilities spells capability names the way systemd expects them,
+// e.g. net_raw as CAP_NET_RAW
+func systemdCapabilities(caps []string) string {
+	names := make([]string, len(caps))
+	for i, c := range caps {
+		c = strings.ToUpper(c)
+		if !strings.HasPrefix(c, "CAP_") {
+			c = "CAP_" + c
+		}
+		names[i] = c
+	}
+	return strings.Join(names, " ")
+}
+
+// systemdEscape escapes the specifiers systemd expands in unit values
+func systemdEscape(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+// systemdQuote quotes a word for ExecStart or Environment when needed. Words
+// of ExecStart must have "$" escaped as "$$" beforehand.
+func systemdQuote(s string) string {
+	s = systemdEscape(s)
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\;") {
+		return s
+	}
+	s = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(s)
+	return "\"" + s + "\""
+}
+
+func init() {
+	exportSystemdCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Write the unit to a file instead of stdout")
+	exportCmd.AddCommand(exportSystemdCmd)
+}
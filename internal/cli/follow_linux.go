@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// followLocalFile tails a log file on the local filesystem using inotify,
+// reopening it when it is rotated away. It only returns on error.
+func followLocalFile(path string, out io.Writer) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("failed to initialize inotify: %w", err)
+	}
+	defer syscall.Close(fd)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { file.Close() }()
+
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+
+	const mask = syscall.IN_MODIFY | syscall.IN_MOVE_SELF | syscall.IN_DELETE_SELF
+	wd, err := syscall.InotifyAddWatch(fd, path, mask)
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", path, err)
+	}
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return err
+		}
+
+		rotated := false
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			if event.Mask&(syscall.IN_MOVE_SELF|syscall.IN_DELETE_SELF) != 0 {
+				rotated = true
+			}
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+		}
+
+		// Flush whatever was appended, including the tail of a rotated file
+		if _, err := io.Copy(out, file); err != nil {
+			return err
+		}
+
+		if !rotated {
+			continue
+		}
+
+		// The daemon recreates the file right after rotating it
+		_, _ = syscall.InotifyRmWatch(fd, uint32(wd))
+		file.Close()
+
+		file, err = reopenLogFile(path)
+		if err != nil {
+			return err
+		}
+		if wd, err = syscall.InotifyAddWatch(fd, path, mask); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		if _, err := io.Copy(out, file); err != nil {
+			return err
+		}
+	}
+}
+
+// reopenLogFile waits for a rotated log file to be recreated
+func reopenLogFile(path string) (*os.File, error) {
+	for i := 0; ; i++ {
+		file, err := os.Open(path)
+		if err == nil {
+			return file, nil
+		}
+		if !os.IsNotExist(err) || i >= 50 {
+			return nil, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
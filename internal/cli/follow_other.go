@@ -0,0 +1,13 @@
+//go:build !linux
+
+package cli
+
+import (
+	"fmt"
+	"io"
+)
+
+// followLocalFile is only supported on Linux, where inotify is available
+func followLocalFile(path string, out io.Writer) error {
+	return fmt.Errorf("following local log files is only supported on Linux")
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// runGroupRestart restarts a restart group and prints what happened to
+// each of its processes
+func runGroupRestart(name string) {
+	client, err := NewClient()
+	if err != nil {
+		exitWithError("Failed to connect to daemon", err)
+	}
+
+	result, err := client.RestartGroup(name)
+	if result != nil {
+		printGroupResult(result)
+	}
+	if err != nil {
+		exitWithError(fmt.Sprintf("Failed to restart group %s", name), err)
+	}
+}
+
+// printGroupResult prints the actions taken on the processes of a restart
+// group, in the order they were taken
+func printGroupResult(result *types.GroupResult) {
+	if len(result.Actions) == 0 {
+		fmt.Printf("Restart group '%s' has no processes\n", result.Group)
+		return
+	}
+
+	t := newTable("PROCESS", "ACTION", "ERROR")
+	t.truncatable(2)
+	t.color(1, func(action string) string {
+		switch action {
+		case "started":
+			return colorGreen
+		case "stopped", "skipped":
+			return colorGray
+		case "failed":
+			return colorRed
+		}
+		return ""
+	})
+	for _, a := range result.Actions {
+		errText := a.Error
+		if errText == "" {
+			errText = "-"
+		}
+		t.row(a.Process, a.Action, errText)
+	}
+	t.print()
+}
@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+var (
+	historyDiff int
+	rollbackTo  int
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history <name|id>",
+	Short: "Show the definition history of a process",
+	Long: `Show every change to the definition of a process, with who made it and
+which fields changed. Use --diff to see the changes of a single version.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		history, err := client.History(args[0])
+		if err != nil {
+			exitWithError("Failed to get history", err)
+		}
+
+		if len(history) == 0 {
+			fmt.Println("No definition history")
+			return
+		}
+
+		if historyDiff > 0 {
+			printDefinitionDiff(history, historyDiff)
+			return
+		}
+
+		t := newTable("VERSION", "TIME", "ACTOR", "ACTION", "CHANGES")
+		t.truncatable(2, 4)
+		for _, v := range history {
+			t.row(v.Version, formatTime(v.Timestamp),
+				valueOrDash(v.Actor), v.Action, joinOrDash(v.Changes))
+		}
+		t.print()
+	},
+}
+
+var rollbackConfigCmd = &cobra.Command{
+	Use:   "rollback-config <name|id>",
+	Short: "Restore a previous process definition",
+	Long: `Restore a definition version from the history of a process. A running
+process is restarted with the restored definition.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if rollbackTo <= 0 {
+			exitWithError("--to is required", nil)
+		}
+
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		info, err := client.Rollback(args[0], rollbackTo)
+		if err != nil {
+			exitWithError("Failed to roll back", err)
+		}
+
+		fmt.Printf("Rolled back process '%s' to definition version %d\n", info.Name, rollbackTo)
+	},
+}
+
+// printDefinitionDiff prints the fields a version changed compared to the
+// version before it
+func printDefinitionDiff(history []types.DefinitionVersion, version int) {
+	for i, v := range history {
+		if v.Version != version {
+			continue
+		}
+
+		fmt.Printf("Version %d (%s by %s, %s)\n", v.Version, v.Action, valueOrDash(v.Actor), formatTime(v.Timestamp))
+
+		var before map[string]interface{}
+		if i > 0 {
+			before = definitionFields(history[i-1].Definition)
+		}
+		after := definitionFields(v.Definition)
+
+		keys := make([]string, 0, len(after))
+		for k := range after {
+			keys = append(keys, k)
+		}
+		for k := range before {
+			if _, ok := after[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			old, hadOld := before[k]
+			cur, hasCur := after[k]
+			oldText, curText := diffValue(old), diffValue(cur)
+
+			switch {
+			case hadOld && hasCur && oldText == curText:
+				continue
+			case hadOld:
+				fmt.Printf("- %s: %s\n", k, oldText)
+			}
+			if hasCur {
+				fmt.Printf("+ %s: %s\n", k, curText)
+			}
+		}
+		return
+	}
+
+	exitWithError(fmt.Sprintf("version %d not found", version), nil)
+}
+
+// definitionFields returns the set fields of a definition by JSON name
+func definitionFields(def types.StartRequest) map[string]interface{} {
+	data, _ := json.Marshal(def)
+	var fields map[string]interface{}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
+
+func diffValue(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return strings.TrimSpace(string(data))
+}
+
+func init() {
+	historyCmd.Flags().IntVar(&historyDiff, "diff", 0, "Show the changes made by a version")
+	rollbackConfigCmd.Flags().IntVar(&rollbackTo, "to", 0, "Definition version to restore")
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/importer"
+)
+
+var (
+	importFrom      string
+	importNamespace string
+	importDryRun    bool
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <file>...",
+	Short: "Import processes from PM2, supervisord or systemd",
+	Long: `Import process definitions from other process managers and start them.
+
+  gem import --from pm2 ecosystem.config.js
+  gem import --from supervisord /etc/supervisor/supervisord.conf
+  gem import --from systemd /etc/systemd/system/api.service worker.service
+
+PM2 JavaScript ecosystem files are evaluated with node; JSON and YAML
+ecosystem files are read directly.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := importer.Import(importFrom, args)
+		if err != nil {
+			exitWithError("Failed to import", err)
+		}
+
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+
+		if importDryRun {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tCOMMAND\tWORKDIR\tAUTO-RESTART\tUSER")
+			for _, p := range result.Processes {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%v\t%s\n",
+					p.Name, strings.Join(append([]string{p.Command}, p.Args...), " "),
+					valueOrDash(p.WorkDir), p.AutoRestart, valueOrDash(p.User))
+			}
+			w.Flush()
+			return
+		}
+
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		failed := 0
+		for _, p := range result.Processes {
+			req := StartRequest{
+				Name:            p.Name,
+				Command:         p.Command,
+				Args:            p.Args,
+				WorkDir:         p.WorkDir,
+				Env:             p.Env,
+				AutoStart:       p.AutoStart,
+				AutoRestart:     p.AutoRestart,
+				MaxRestarts:     p.MaxRestarts,
+				User:            p.User,
+				Group:           p.Group,
+				Namespace:       importNamespace,
+				OOMScoreAdj:     p.OOMScoreAdj,
+				Capabilities:    p.Capabilities,
+				AppArmorProfile: p.AppArmorProfile,
+				SELinuxLabel:    p.SELinuxLabel,
+				Network:         p.Network,
+			}
+
+			info, err := client.Start(&req)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Failed to start process '%s': %v\n", p.Name, err)
+				failed++
+				continue
+			}
+
+			fmt.Printf("Imported process '%s' (ID: %s, PID: %d)\n", info.Name, info.ID, info.PID)
+		}
+
+		if failed > 0 {
+			exitWithError(fmt.Sprintf("%d of %d processes failed to import", failed, len(result.Processes)), nil)
+		}
+	},
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func init() {
+	importCmd.Flags().StringVar(&importFrom, "from", "", "Source format (pm2, supervisord or systemd)")
+	importCmd.Flags().StringVarP(&importNamespace, "namespace", "N", "", "Namespace of the imported processes")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Show the translated processes without starting them")
+	_ = importCmd.MarkFlagRequired("from")
+}
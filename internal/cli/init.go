@@ -0,0 +1,331 @@
+package cli
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
+
+	"github.com/PrismManager/gemstone/internal/config"
+)
+
+// systemdUnitPath is where gem init --systemd installs the service unit
+const systemdUnitPath = "/etc/systemd/system/gemstone.service"
+
+var (
+	initDir        string
+	initHost       string
+	initPort       int
+	initLogDir     string
+	initToken      bool
+	initSystemd    bool
+	initDaemonPath string
+	initForce      bool
+	initYes        bool
+)
+
+// initSettings are the values filled into the generated files
+type initSettings struct {
+	Host       string
+	Port       int
+	LogDir     string
+	PluginDir  string
+	AuthToken  string
+	DaemonPath string
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Generate a starter configuration",
+	Long: `Generate a commented config.yaml and an example ecosystem.yaml listing
+processes in the configuration directory. On a terminal the settings are
+asked for, flags and -y skip the questions.
+
+With --systemd the daemon's service unit is installed as well.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := initSettings{
+			Host:       initHost,
+			Port:       initPort,
+			LogDir:     initLogDir,
+			PluginDir:  filepath.Join(initDir, "plugins"),
+			DaemonPath: initDaemonPath,
+		}
+
+		if !initYes && isTerminal(os.Stdin) {
+			askInitSettings(cmd, &settings)
+		}
+		if initToken {
+			token, err := generateToken()
+			if err != nil {
+				exitWithError("Failed to generate an API token", err)
+			}
+			settings.AuthToken = token
+		}
+
+		if err := os.MkdirAll(initDir, 0755); err != nil {
+			exitWithError("Failed to create configuration directory", err)
+		}
+
+		// The config holds the API token, so only root may read it then
+		configMode := os.FileMode(0644)
+		if settings.AuthToken != "" {
+			configMode = 0600
+		}
+
+		configPath := filepath.Join(initDir, "config.yaml")
+		ecosystemPath := filepath.Join(initDir, "ecosystem.yaml")
+
+		// Check all files first so nothing is written when one exists
+		paths := []string{configPath, ecosystemPath}
+		if initSystemd {
+			paths = append(paths, systemdUnitPath)
+		}
+		for _, path := range paths {
+			if _, err := os.Stat(path); err == nil && !initForce {
+				exitWithError(fmt.Sprintf("%s already exists, use --force to replace it", path), nil)
+			}
+		}
+
+		writeInitFile(configPath, configTemplate, settings, configMode)
+		writeInitFile(ecosystemPath, ecosystemTemplate, settings, 0644)
+
+		if initSystemd {
+			writeInitFile(systemdUnitPath, unitTemplate, settings, 0644)
+			if out, err := exec.Command("systemctl", "daemon-reload").CombinedOutput(); err != nil {
+				fmt.Printf("Warning: systemctl daemon-reload failed: %v %s\n", err, strings.TrimSpace(string(out)))
+			}
+			fmt.Println("Start the daemon with 'systemctl enable --now gemstone'")
+		}
+
+		if configPath != config.GetConfigPath() {
+			fmt.Printf("Point gem and gemstoned at the config with GEMSTONE_CONFIG=%s\n", configPath)
+		}
+	},
+}
+
+// askInitSettings asks for the settings whose flags weren't given
+func askInitSettings(cmd *cobra.Command, s *initSettings) {
+	in := bufio.NewReader(os.Stdin)
+	flags := cmd.Flags()
+
+	if !flags.Changed("host") {
+		s.Host = ask(in, "API listen host", s.Host)
+	}
+	if !flags.Changed("port") {
+		for {
+			port, err := strconv.Atoi(ask(in, "API port", strconv.Itoa(s.Port)))
+			if err == nil && port > 0 && port < 65536 {
+				s.Port = port
+				break
+			}
+			fmt.Println("Enter a port between 1 and 65535")
+		}
+	}
+	if !flags.Changed("log-dir") {
+		s.LogDir = ask(in, "Log directory", s.LogDir)
+	}
+	if !flags.Changed("token") {
+		initToken = askYesNo(in, "Require an API token", initToken)
+	}
+	if !flags.Changed("systemd") {
+		initSystemd = askYesNo(in, "Install the systemd unit", initSystemd)
+	}
+}
+
+// ask prompts for a value, returning def on an empty answer
+func ask(in *bufio.Reader, question, def string) string {
+	fmt.Printf("%s [%s]: ", question, def)
+	answer, _ := in.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer
+	}
+	return def
+}
+
+func askYesNo(in *bufio.Reader, question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	fmt.Printf("%s [%s]: ", question, hint)
+	answer, _ := in.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
+
+func isTerminal(f *os.File) bool {
+	_, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+	return err == nil
+}
+
+// generateToken returns a random API token
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// writeInitFile renders a template to path, refusing to replace an
+// existing file unless --force is given
+func writeInitFile(path, text string, settings initSettings, mode os.FileMode) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if initForce {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(path, flags, mode)
+	if os.IsExist(err) {
+		exitWithError(fmt.Sprintf("%s already exists, use --force to replace it", path), nil)
+	}
+	if err != nil {
+		exitWithError("Failed to create "+path, err)
+	}
+	defer f.Close()
+
+	// OpenFile doesn't change the mode of an existing file
+	if err := f.Chmod(mode); err != nil {
+		exitWithError("Failed to set permissions of "+path, err)
+	}
+
+	if err := template.Must(template.New(filepath.Base(path)).Parse(text)).Execute(f, settings); err != nil {
+		exitWithError("Failed to write "+path, err)
+	}
+
+	fmt.Printf("Wrote %s\n", path)
+}
+
+const configTemplate = `# Gemstone configuration, generated by gem init
+
+daemon:
+  shutdown_timeout: 30  # Seconds to drain API requests and stop processes on shutdown
+
+api:
+  enabled: true
+  host: "{{.Host}}"
+  port: {{.Port}}
+{{- if .AuthToken}}
+  auth_token: "{{.AuthToken}}"  # Send as "Authorization: Bearer <token>"
+{{- else}}
+  # auth_token: "your-secret-token"  # Require a token on TCP connections
+{{- end}}
+  enable_cors: false
+  access_log: true      # Log every API request with its request ID
+  socket:
+    mode: "0660"        # Permissions of the unix socket
+    # group: "gemstone" # Group owning the socket
+    allowed_uids: [0]   # Local users allowed on the socket without a token
+
+logging:
+  directory: "{{.LogDir}}"
+  max_size: 10          # Max log file size in MB
+  max_backups: 5        # Rotated files kept per log
+  max_age: 30           # Max age of rotated files in days
+  compress: true        # Gzip rotated files
+  max_total_size: 0     # Log directory budget in MB (0 = unlimited)
+
+plugins:
+  enabled: true
+  directory: "{{.PluginDir}}"  # Executables speaking JSON over stdio
+
+hooks:
+  # on_crash: /usr/local/bin/notify.sh  # Receives the event JSON on stdin
+  timeout: 30
+
+time:
+  utc: false            # Show times in UTC
+  # format: rfc3339     # Default of gem --time-format
+
+stats:
+  retention: 3h         # Keep every sample, taken each 10s, this long
+  downsample:           # Then average them into coarser tiers
+    - resolution: 5m
+      retention: 24h
+    - resolution: 1h
+      retention: 720h
+`
+
+const ecosystemTemplate = `# Example processes, in the format of POST /api/v1/apply documents.
+# Applying it creates, updates or deletes processes until the namespaces
+# listed match this file.
+
+namespaces: [web]
+
+processes:
+  - name: api
+    namespace: web
+    command: /srv/api/bin/api
+    args: ["--listen", "127.0.0.1:8080"]
+    work_dir: /srv/api
+    env:
+      APP_ENV: production
+    user: www-data
+    auto_start: true      # Start with the daemon
+    auto_restart: true    # Restart when it exits
+    max_restarts: 10
+    # wait_for:           # Start once a dependency accepts connections
+    #   tcp: 127.0.0.1:5432
+    #   timeout: 60s
+    # soft_limits:        # Throttle instead of restarting
+    #   cpu_percent: 80
+    #   memory_high: 512  # MB
+
+  - name: worker
+    namespace: web
+    command: /srv/api/bin/worker
+    auto_start: true
+    auto_restart: true
+    max_restarts: 5
+    log_quota: 100        # MB of logs kept for this process
+`
+
+const unitTemplate = `[Unit]
+Description=Gemstone Process Manager Daemon
+Documentation=https://github.com/PrismManager/gemstone
+After=network.target
+
+[Service]
+Type=simple
+ExecStart={{.DaemonPath}}
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=always
+RestartSec=5
+LimitNOFILE=65536
+LimitNPROC=65536
+RuntimeDirectory=gemstone
+StateDirectory=gemstone
+LogsDirectory=gemstone
+
+[Install]
+WantedBy=multi-user.target
+`
+
+func init() {
+	defaultDir := filepath.Dir(config.GetConfigPath())
+
+	initCmd.Flags().StringVar(&initDir, "dir", defaultDir, "Directory to write config.yaml and ecosystem.yaml to")
+	initCmd.Flags().StringVar(&initHost, "host", "127.0.0.1", "Address the API listens on")
+	initCmd.Flags().IntVar(&initPort, "port", config.DefaultAPIPort, "Port the API listens on")
+	initCmd.Flags().StringVar(&initLogDir, "log-dir", config.DefaultLogDir, "Directory of process logs")
+	initCmd.Flags().BoolVar(&initToken, "token", false, "Generate an API token")
+	initCmd.Flags().BoolVar(&initSystemd, "systemd", false, "Install the systemd unit to "+systemdUnitPath)
+	initCmd.Flags().StringVar(&initDaemonPath, "daemon-path", "/usr/local/bin/gemstoned", "Path of gemstoned in the systemd unit")
+	initCmd.Flags().BoolVar(&initForce, "force", false, "Replace existing files")
+	initCmd.Flags().BoolVarP(&initYes, "yes", "y", false, "Don't ask, use the flags and defaults")
+}
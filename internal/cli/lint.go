@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/lint"
+)
+
+var (
+	lintOutput string
+	lintStrict bool
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint <file>...",
+	Short: "Check process files for mistakes",
+	Long: `Check ecosystem files (apply documents in YAML or JSON) for common mistakes:
+unknown fields, commands that don't exist or aren't executable, undefined
+users and groups, missing working directories, host ports published twice,
+wait_for gates waiting on each other and suspiciously low timeouts.
+
+Commands, users and directories are resolved on this host, so run it where
+the daemon runs. The command exits with status 1 when errors are found, or
+warnings with --strict. Use -o json for CI.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateOutputFormat(lintOutput)
+
+		issues := []lint.Issue{}
+		for _, path := range args {
+			doc, err := lint.ParseFile(path)
+			if err != nil {
+				issues = append(issues, lint.Issue{
+					File:     path,
+					Severity: lint.SeverityError,
+					Message:  err.Error(),
+				})
+				continue
+			}
+			issues = append(issues, lint.Check(path, doc)...)
+		}
+
+		errors, warnings := 0, 0
+		for _, issue := range issues {
+			if issue.Severity == lint.SeverityError {
+				errors++
+			} else {
+				warnings++
+			}
+		}
+
+		if !printOutput(lintOutput, issues) {
+			for _, issue := range issues {
+				fmt.Println(issue)
+			}
+			if len(issues) == 0 {
+				fmt.Println("No issues found")
+			} else {
+				fmt.Printf("\n%d errors, %d warnings\n", errors, warnings)
+			}
+		}
+
+		if errors > 0 || (lintStrict && warnings > 0) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	lintCmd.Flags().StringVarP(&lintOutput, "output", "o", "", outputFlagUsage)
+	lintCmd.Flags().BoolVar(&lintStrict, "strict", false, "Also fail on warnings")
+}
@@ -2,27 +2,88 @@ package cli
 
 import (
 	"fmt"
-	"os"
-	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+var (
+	listOutput      string
+	listByNamespace bool
+	listFresh       bool
+	listRuns        bool
 )
 
 var listCmd = &cobra.Command{
-	Use:     "list",
-	Aliases: []string{"ls", "ps"},
+	Use:     "list [name|id...]",
+	Aliases: []string{"ls", "ps", "get"},
 	Short:   "List all processes",
-	Long:    `List all managed processes with their status.`,
+	Long: `List all managed processes with their status, or only the named ones.
+
+With -o the processes are printed as json, yaml or a JSONPath template
+instead. A single named process is printed as an object, otherwise as a
+list:
+
+  gem get api -o jsonpath='{.pid}'
+  gem list -o jsonpath='{[*].name}'
+
+With --by-namespace, one line per namespace is shown instead, with its
+process counts, total CPU and memory and the worst health of its
+processes.
+
+Processes with a schedule add columns with their next and last run. With
+--runs, the finished runs of the named process are shown instead, with
+their exit codes.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		validateOutputFormat(listOutput)
+
 		client, err := NewClient()
 		if err != nil {
 			exitWithError("Failed to connect to daemon", err)
 		}
 
-		processes, err := client.List()
-		if err != nil {
-			exitWithError("Failed to list processes", err)
+		if listByNamespace {
+			listNamespaces(client)
+			return
+		}
+		if listRuns {
+			if len(args) != 1 {
+				exitWithError("--runs requires exactly one process", nil)
+			}
+			listProcessRuns(client, args[0])
+			return
+		}
+
+		var processes []*types.ProcessInfo
+		if len(args) > 0 {
+			for _, name := range args {
+				get := client.Get
+				if listFresh {
+					get = client.GetFresh
+				}
+				info, err := get(name)
+				if err != nil {
+					exitWithError(fmt.Sprintf("Failed to get process '%s'", name), err)
+				}
+				processes = append(processes, info)
+			}
+		} else {
+			processes, err = client.List(listFresh)
+			if err != nil {
+				exitWithError("Failed to list processes", err)
+			}
+		}
+
+		if len(args) == 1 && printOutput(listOutput, processes[0]) {
+			return
+		}
+		if processes == nil {
+			processes = []*types.ProcessInfo{}
+		}
+		if printOutput(listOutput, processes) {
+			return
 		}
 
 		if len(processes) == 0 {
@@ -30,8 +91,21 @@ var listCmd = &cobra.Command{
 			return
 		}
 
-		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(w, "ID\tNAME\tSTATUS\tPID\tCPU\tMEMORY\tUPTIME")
+		headers := []string{"ID", "NAME", "NAMESPACE", "STATUS", "ENABLED", "PID", "CPU", "MEMORY", "UPTIME", "RESTARTS", "LAST EXIT"}
+		scheduled := false
+		for _, p := range processes {
+			if p.Schedule != "" {
+				scheduled = true
+				break
+			}
+		}
+		if scheduled {
+			headers = append(headers, "NEXT RUN", "LAST RUN")
+		}
+
+		t := newTable(headers...)
+		t.truncatable(1, 2)
+		t.color(3, statusColor)
 
 		for _, p := range processes {
 			uptime := "-"
@@ -54,14 +128,99 @@ var listCmd = &cobra.Command{
 				pid = fmt.Sprintf("%d", p.PID)
 			}
 
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-				p.ID, p.Name, p.Status, pid, cpu, memory, uptime)
+			enabled := "no"
+			if p.AutoStart {
+				enabled = "yes"
+			}
+
+			cells := []interface{}{p.ID, p.Name, p.Namespace, p.Status, enabled, pid, cpu, memory, uptime, p.RestartCount, formatExit(p.LastExit)}
+			if scheduled {
+				cells = append(cells, formatNextRun(p.NextRun), formatLastRun(p.LastRun))
+			}
+			t.row(cells...)
 		}
 
-		w.Flush()
+		t.print()
 	},
 }
 
+func listNamespaces(client *Client) {
+	namespaces, err := client.Namespaces()
+	if err != nil {
+		exitWithError("Failed to list namespaces", err)
+	}
+	if printOutput(listOutput, namespaces) {
+		return
+	}
+
+	if len(namespaces) == 0 {
+		fmt.Println("No namespaces")
+		return
+	}
+
+	t := newTable("NAMESPACE", "TOTAL", "RUNNING", "STOPPED", "ERRORED", "CPU", "MEMORY", "RESTARTS", "HEALTH", "UNHEALTHY")
+	t.truncatable(0, 9)
+	t.color(8, healthColor)
+	for _, ns := range namespaces {
+		t.row(ns.Name, ns.Total, ns.Running, ns.Stopped, ns.Errored, fmt.Sprintf("%.1f%%", ns.CPU),
+			formatBytes(ns.Memory), ns.Restarts, ns.Health, joinOrDash(ns.Unhealthy))
+	}
+	t.print()
+}
+
+// listProcessRuns prints the finished runs of a process, newest first
+func listProcessRuns(client *Client, name string) {
+	runs, err := client.Runs(name)
+	if err != nil {
+		exitWithError("Failed to get runs", err)
+	}
+	if printOutput(listOutput, runs) {
+		return
+	}
+
+	if len(runs) == 0 {
+		fmt.Println("No runs")
+		return
+	}
+
+	t := newTable("STARTED", "TRIGGER", "DURATION", "EXIT")
+	for i := len(runs) - 1; i >= 0; i-- {
+		r := runs[i]
+		duration := time.Duration(r.Duration * float64(time.Second)).Round(time.Millisecond)
+		t.row(formatTime(r.StartedAt), r.Trigger, duration, formatExit(&types.LastExit{Code: r.ExitCode, Signal: r.Signal, Reason: r.Reason}))
+	}
+	t.print()
+}
+
+// formatNextRun describes when a scheduled process runs next
+func formatNextRun(next *time.Time) string {
+	if next == nil {
+		return "-"
+	}
+	return "in " + formatDuration(time.Until(*next))
+}
+
+// formatLastRun describes the exit of the last run and how long ago it was
+func formatLastRun(run *types.ScheduledRun) string {
+	if run == nil {
+		return "-"
+	}
+	exit := formatExit(&types.LastExit{Code: run.ExitCode, Signal: run.Signal, Reason: run.Reason})
+	return fmt.Sprintf("%s %s ago", exit, formatDuration(time.Since(run.FinishedAt)))
+}
+
+// formatExit describes the exit reason with its code or signal
+func formatExit(exit *types.LastExit) string {
+	switch {
+	case exit == nil:
+		return "-"
+	case exit.Signal != "":
+		return fmt.Sprintf("%s (%s)", exit.Reason, exit.Signal)
+	default:
+		return fmt.Sprintf("%s (%d)", exit.Reason, exit.Code)
+	}
+}
+
 func formatDuration(d time.Duration) string {
 	days := int(d.Hours() / 24)
 	hours := int(d.Hours()) % 24
@@ -94,3 +253,10 @@ func formatBytes(bytes uint64) string {
 		return fmt.Sprintf("%dB", bytes)
 	}
 }
+
+func init() {
+	listCmd.Flags().StringVarP(&listOutput, "output", "o", "", outputFlagUsage)
+	listCmd.Flags().BoolVar(&listFresh, "fresh", false, "Sample CPU and memory now instead of showing the last stats sample")
+	listCmd.Flags().BoolVar(&listByNamespace, "by-namespace", false, "Show a rollup per namespace instead of the processes")
+	listCmd.Flags().BoolVar(&listRuns, "runs", false, "Show the finished runs of a scheduled process instead")
+}
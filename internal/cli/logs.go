@@ -1,40 +1,238 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/logger"
+	"github.com/PrismManager/gemstone/internal/types"
 )
 
+// logsReconnectDelay is the pause before gem logs --follow reconnects
+const logsReconnectDelay = time.Second
+
 var (
 	logsLines  int
 	logsType   string
 	logsFollow bool
+	logsRun    int
+	logsLocal  bool
+	logsGrep   string
+	logsInvert bool
+
+	logsDownload bool
+	logsRotation int
+	logsGzip     bool
+	logsOutput   string
 )
 
 var logsCmd = &cobra.Command{
 	Use:   "logs <name|id>",
 	Short: "View process logs",
-	Long:  `View logs for a process. Shows combined stdout/stderr by default.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `View logs for a process. Shows combined stdout/stderr by default.
+
+With --grep the daemon searches the log and only returns the last matching
+lines, so nothing else is transferred.
+
+With --follow the last lines are shown and then the lines the daemon
+captures, until interrupted. When the connection is lost, e.g. because the
+daemon restarts, gem reconnects and resumes after the last line shown.
+
+With --follow --local the log file is tailed directly from the local
+filesystem, which requires running on the daemon host with read access to
+the log directory.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		if logsLocal && !logsFollow {
+			exitWithError("--local requires --follow", nil)
+		}
+
 		client, err := NewClient()
 		if err != nil {
 			exitWithError("Failed to connect to daemon", err)
 		}
 
-		logs, err := client.GetLogs(args[0], logsLines, logsType)
+		if logsDownload {
+			downloadLogs(client, args[0])
+			return
+		}
+
+		if logsInvert && logsGrep == "" {
+			exitWithError("--invert requires --grep", nil)
+		}
+
+		// Validate the pattern for local following as well
+		var filter *logger.Filter
+		if logsGrep != "" {
+			pattern, err := regexp.Compile(logsGrep)
+			if err != nil {
+				exitWithError("Invalid --grep pattern", err)
+			}
+			filter = &logger.Filter{Pattern: pattern, Invert: logsInvert}
+		}
+
+		if logsFollow && !logsLocal {
+			followLogs(client, args[0])
+			return
+		}
+
+		logs, err := client.GetLogs(args[0], logsLines, logsType, logsRun, logsGrep, logsInvert)
 		if err != nil {
 			exitWithError("Failed to get logs", err)
 		}
 
-		fmt.Println(strings.Join(logs, "\n"))
+		if len(logs) > 0 {
+			fmt.Println(strings.Join(logs, "\n"))
+		}
+
+		if logsFollow {
+			info, err := client.Get(args[0])
+			if err != nil {
+				exitWithError("Failed to get process", err)
+			}
+
+			path := localLogPath(info, logsType)
+			var out io.Writer = os.Stdout
+			if filter != nil {
+				out = &filterWriter{filter: filter, out: os.Stdout}
+			}
+			if err := followLocalFile(path, out); err != nil {
+				exitWithError("Failed to follow local log file", err)
+			}
+		}
 	},
 }
 
+// followLogs prints the last lines of a log and then the lines the daemon
+// captures, reconnecting after the last line printed when the stream breaks.
+// It only returns through exitWithError.
+func followLogs(client *Client, idOrName string) {
+	var after *uint64
+	received := false
+	for {
+		var dropped uint64
+		err := client.FollowLogs(context.Background(), idOrName, logsLines, logsType, logsGrep, logsInvert, after, func(msg types.LogStreamMessage) {
+			received = true
+			if msg.DroppedLines > dropped {
+				fmt.Fprintf(os.Stderr, "Warning: skipped %d lines, the output fell behind\n", msg.DroppedLines-dropped)
+				dropped = msg.DroppedLines
+			}
+			fmt.Println(msg.Line)
+			if msg.Seq > 0 {
+				seq := msg.Seq
+				after = &seq
+			}
+		})
+
+		var rejected *rejectedError
+		if errors.As(err, &rejected) || !received {
+			exitWithError("Failed to follow logs", err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: log stream interrupted: %v, reconnecting\n", err)
+		time.Sleep(logsReconnectDelay)
+	}
+}
+
+// downloadLogs saves a raw log file to --output, or to the file name
+// suggested by the daemon in the current directory
+func downloadLogs(client *Client, idOrName string) {
+	if logsOutput == "-" {
+		if _, err := client.DownloadLogs(idOrName, logsType, logsRotation, logsGzip, os.Stdout); err != nil {
+			exitWithError("Failed to download logs", err)
+		}
+		return
+	}
+
+	dir := "."
+	if logsOutput != "" {
+		dir = filepath.Dir(logsOutput)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".gem-download-*")
+	if err != nil {
+		exitWithError("Failed to create output file", err)
+	}
+
+	filename, err := client.DownloadLogs(idOrName, logsType, logsRotation, logsGzip, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		exitWithError("Failed to download logs", err)
+	}
+
+	output := logsOutput
+	if output == "" {
+		output = filename
+	}
+	if err := os.Rename(tmp.Name(), output); err != nil {
+		os.Remove(tmp.Name())
+		exitWithError("Failed to write output file", err)
+	}
+
+	fmt.Printf("Saved logs to %s\n", output)
+}
+
+// filterWriter writes the complete lines passing a filter
+type filterWriter struct {
+	filter  *logger.Filter
+	out     io.Writer
+	partial []byte
+}
+
+func (w *filterWriter) Write(data []byte) (int, error) {
+	w.partial = append(w.partial, data...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := w.partial[:i+1]
+		if w.filter.Match(string(line[:i])) {
+			if _, err := w.out.Write(line); err != nil {
+				return 0, err
+			}
+		}
+		w.partial = w.partial[i+1:]
+	}
+	return len(data), nil
+}
+
+// localLogPath returns the path of a process log file on the daemon host
+func localLogPath(info *types.ProcessInfo, logType string) string {
+	file := "combined.log"
+	switch logType {
+	case "stdout":
+		file = "stdout.log"
+	case "stderr":
+		file = "stderr.log"
+	}
+	logDir := config.NamespaceLogDir(config.GetLogPath(), info.Namespace)
+	return filepath.Join(logDir, fmt.Sprintf("%s-%s", info.Name, info.ID), file)
+}
+
 func init() {
 	logsCmd.Flags().IntVarP(&logsLines, "lines", "n", 100, "Number of lines to show")
 	logsCmd.Flags().StringVarP(&logsType, "type", "t", "", "Log type (stdout, stderr, or empty for combined)")
-	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Follow log output (not implemented yet)")
+	logsCmd.Flags().IntVar(&logsRun, "run", 0, "Only show output from the given run (generation)")
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Follow log output")
+	logsCmd.Flags().BoolVar(&logsDownload, "download", false, "Download the raw log file")
+	logsCmd.Flags().IntVar(&logsRotation, "rotation", 0, "Rotated file to download (0 for the active file, 1 for the newest rotated file)")
+	logsCmd.Flags().BoolVar(&logsGzip, "gzip", false, "Compress the download with gzip")
+	logsCmd.Flags().StringVarP(&logsOutput, "output", "o", "", "Output path for --download (- for stdout)")
+	logsCmd.Flags().StringVar(&logsGrep, "grep", "", "Only show lines matching this regular expression, filtered by the daemon")
+	logsCmd.Flags().BoolVar(&logsInvert, "invert", false, "With --grep, only show lines not matching")
+	logsCmd.Flags().BoolVar(&logsLocal, "local", false, "With --follow, tail the log file directly from the local filesystem")
 }
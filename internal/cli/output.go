@@ -0,0 +1,276 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// outputFlagUsage is the help text of -o/--output
+const outputFlagUsage = "Output format: json, yaml or jsonpath=TEMPLATE"
+
+// printOutput prints v in a machine-readable format and reports whether it
+// did. An empty format leaves printing the usual text to the caller.
+func printOutput(format string, v interface{}) bool {
+	if format == "" {
+		return false
+	}
+
+	out, err := formatOutput(format, v)
+	if err != nil {
+		exitWithError("Failed to format output", err)
+	}
+
+	fmt.Print(out)
+	if !strings.HasSuffix(out, "\n") {
+		fmt.Println()
+	}
+	return true
+}
+
+// validateOutputFormat fails early on an unknown -o value, before talking
+// to the daemon
+func validateOutputFormat(format string) {
+	if _, err := formatOutput(format, nil); err != nil {
+		exitWithError("Invalid --output", err)
+	}
+}
+
+func formatOutput(format string, v interface{}) (string, error) {
+	switch {
+	case format == "json":
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	case format == "yaml":
+		// Go through JSON so yaml keys match the API field names
+		generic, err := toGeneric(v)
+		if err != nil {
+			return "", err
+		}
+		data, err := yaml.Marshal(generic)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	case strings.HasPrefix(format, "jsonpath="):
+		template, err := parseJSONPath(strings.TrimPrefix(format, "jsonpath="))
+		if err != nil {
+			return "", err
+		}
+		generic, err := toGeneric(v)
+		if err != nil {
+			return "", err
+		}
+		return template.execute(generic)
+	case format == "":
+		return "", nil
+	}
+	return "", fmt.Errorf("unknown format %q: must be json, yaml or jsonpath=TEMPLATE", format)
+}
+
+// toGeneric converts v to the maps, slices and values JSON decodes into
+func toGeneric(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return convertNumbers(generic), nil
+}
+
+// convertNumbers turns integral json numbers into int64 so yaml doesn't
+// print large values like memory in exponent form
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = convertNumbers(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = convertNumbers(value)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// jsonPath is a parsed kubectl-style JSONPath template: literal text with
+// {expressions}. Expressions select fields with .name, list elements with
+// [n] and all elements with [*], or are quoted string literals like {"\n"}.
+type jsonPath []jsonPathPart
+
+type jsonPathPart struct {
+	literal string
+	expr    bool
+	steps   []jsonPathStep
+}
+
+type jsonPathStep struct {
+	field string
+	index int
+	all   bool
+	isIdx bool
+}
+
+func parseJSONPath(template string) (jsonPath, error) {
+	var path jsonPath
+	for template != "" {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			path = append(path, jsonPathPart{literal: template})
+			break
+		}
+		if start > 0 {
+			path = append(path, jsonPathPart{literal: template[:start]})
+		}
+
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed { in jsonpath %q", template)
+		}
+		expr := strings.TrimSpace(template[start+1 : start+end])
+		template = template[start+end+1:]
+
+		if strings.HasPrefix(expr, `"`) {
+			literal, err := strconv.Unquote(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string literal %s in jsonpath", expr)
+			}
+			path = append(path, jsonPathPart{literal: literal})
+			continue
+		}
+
+		steps, err := parseJSONPathExpr(expr)
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, jsonPathPart{expr: true, steps: steps})
+	}
+	return path, nil
+}
+
+func parseJSONPathExpr(expr string) ([]jsonPathStep, error) {
+	rest := strings.TrimPrefix(expr, "$")
+	var steps []jsonPathStep
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			n := strings.IndexAny(rest, ".[")
+			if n < 0 {
+				n = len(rest)
+			}
+			if n > 0 {
+				steps = append(steps, jsonPathStep{field: rest[:n]})
+			}
+			rest = rest[n:]
+		case '[':
+			n := strings.IndexByte(rest, ']')
+			if n < 0 {
+				return nil, fmt.Errorf("unclosed [ in jsonpath expression %q", expr)
+			}
+			index := rest[1:n]
+			rest = rest[n+1:]
+
+			if index == "*" {
+				steps = append(steps, jsonPathStep{all: true})
+				continue
+			}
+			i, err := strconv.Atoi(index)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index [%s] in jsonpath expression %q", index, expr)
+			}
+			steps = append(steps, jsonPathStep{index: i, isIdx: true})
+		default:
+			return nil, fmt.Errorf("invalid jsonpath expression %q: expected . or [", expr)
+		}
+	}
+	return steps, nil
+}
+
+func (path jsonPath) execute(data interface{}) (string, error) {
+	var b strings.Builder
+	for _, part := range path {
+		if !part.expr {
+			b.WriteString(part.literal)
+			continue
+		}
+
+		values := []interface{}{data}
+		for _, step := range part.steps {
+			values = step.apply(values)
+		}
+
+		for i, value := range values {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			text, err := jsonPathText(value)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(text)
+		}
+	}
+	return b.String(), nil
+}
+
+// apply selects from every value, dropping the ones without a match
+func (step jsonPathStep) apply(values []interface{}) []interface{} {
+	var selected []interface{}
+	for _, value := range values {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if step.field == "" {
+				continue
+			}
+			if field, ok := v[step.field]; ok {
+				selected = append(selected, field)
+			}
+		case []interface{}:
+			switch {
+			case step.all:
+				selected = append(selected, v...)
+			case step.isIdx:
+				i := step.index
+				if i < 0 {
+					i += len(v)
+				}
+				if i >= 0 && i < len(v) {
+					selected = append(selected, v[i])
+				}
+			}
+		}
+	}
+	return selected
+}
+
+// jsonPathText prints strings as is and anything else as JSON
+func jsonPathText(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
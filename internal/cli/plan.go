@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// planOutput is the output format of --dry-run
+var planOutput string
+
+// planRestarts prints what restarting the targets would run, one plan
+// after the other, and exits with status 1 if any would fail
+func planRestarts(args []string) {
+	validateOutputFormat(planOutput)
+
+	client, err := NewClient()
+	if err != nil {
+		exitWithError("Failed to connect to daemon", err)
+	}
+
+	targets, err := resolveTargets(client, args)
+	if err != nil {
+		exitWithError("Failed to list processes", err)
+	}
+	if len(targets) == 0 {
+		fmt.Println("No matching processes")
+		return
+	}
+
+	ok := true
+	for i, target := range targets {
+		plan, err := client.PlanRestart(target)
+		if err != nil {
+			exitWithError(fmt.Sprintf("Failed to plan restart of %s", target), err)
+		}
+		if i > 0 && planOutput == "" {
+			fmt.Println()
+		}
+		if !printPlan(plan) {
+			ok = false
+		}
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// printPlan prints what a start or restart would run and reports whether
+// it would fail
+func printPlan(plan *types.LaunchPlan) (ok bool) {
+	ok = len(plan.Problems) == 0
+	if printOutput(planOutput, plan) {
+		return ok
+	}
+
+	fmt.Printf("Process: %s (dry run)\n", plan.Name)
+	fmt.Printf("  Namespace:    %s\n", plan.Namespace)
+	fmt.Printf("  Command:      %s\n", plan.Command)
+	if plan.Path != "" && plan.Path != plan.Command {
+		fmt.Printf("  Path:         %s\n", plan.Path)
+	}
+	if len(plan.Args) > 0 {
+		fmt.Printf("  Args:         %s\n", strings.Join(plan.Args, " "))
+	}
+	if plan.WorkDir != "" {
+		fmt.Printf("  Working Dir:  %s\n", plan.WorkDir)
+	}
+	if plan.Stdin != "" {
+		fmt.Printf("  Stdin:        %s\n", plan.Stdin)
+	}
+	user := fmt.Sprintf("%s (uid %d, gid %d)", plan.User, plan.UID, plan.GID)
+	if plan.Group != "" {
+		user = fmt.Sprintf("%s:%s (uid %d, gid %d)", plan.User, plan.Group, plan.UID, plan.GID)
+	}
+	fmt.Printf("  User:         %s\n", user)
+	fmt.Printf("  Auto-restart: %v (max %d)\n", plan.AutoRestart, plan.MaxRestarts)
+	if plan.WaitFor != nil {
+		fmt.Printf("  Wait for:     %s\n", plan.WaitFor.TCP)
+	}
+
+	if l := plan.SoftLimits; l != nil {
+		var limits []string
+		if l.CPUPercent > 0 {
+			switch l.CPUAction {
+			case "weight":
+				limits = append(limits, fmt.Sprintf("cpu %.0f%% -> cpu.weight %d for %s", l.CPUPercent, l.CPUWeight, l.ThrottleFor))
+			default:
+				limits = append(limits, fmt.Sprintf("cpu %.0f%% -> cpu.max %.0f%% for %s", l.CPUPercent, l.CPUThrottle, l.ThrottleFor))
+			}
+		}
+		if l.MemoryHigh > 0 {
+			limits = append(limits, fmt.Sprintf("memory.high %d MB", l.MemoryHigh))
+		}
+		fmt.Printf("  Soft limits:  %s\n", strings.Join(limits, ", "))
+	}
+	if r := plan.Reserve; r != nil {
+		fmt.Printf("  Reserved:     %s\n", formatReservation(r.CPU, r.Memory))
+	}
+	if plan.OOMScoreAdj != 0 {
+		fmt.Printf("  OOM score:    %d\n", plan.OOMScoreAdj)
+	}
+	switch {
+	case plan.Unit != "" && plan.Slice != "":
+		fmt.Printf("  Unit:         %s in %s\n", plan.Unit, plan.Slice)
+	case plan.Unit != "":
+		fmt.Printf("  Unit:         %s\n", plan.Unit)
+	case plan.Cgroup != "":
+		fmt.Printf("  Cgroup:       %s\n", plan.Cgroup)
+	}
+
+	if c := plan.Capabilities; c != nil {
+		if len(c.Keep) > 0 {
+			fmt.Printf("  Cap keep:     %s\n", strings.Join(c.Keep, ","))
+		}
+		if len(c.Drop) > 0 {
+			fmt.Printf("  Cap drop:     %s\n", strings.Join(c.Drop, ","))
+		}
+	}
+	if plan.Seccomp != "" {
+		fmt.Printf("  Seccomp:      %s\n", plan.Seccomp)
+	}
+	if plan.AppArmorProfile != "" {
+		fmt.Printf("  AppArmor:     %s\n", plan.AppArmorProfile)
+	}
+	if plan.SELinuxLabel != "" {
+		fmt.Printf("  SELinux:      %s\n", plan.SELinuxLabel)
+	}
+	if plan.IsolatedNetwork {
+		fmt.Printf("  Network:      isolated\n")
+	}
+
+	fmt.Println("  Environment:")
+	for _, kv := range plan.Env {
+		fmt.Printf("    %s\n", kv)
+	}
+
+	for _, note := range plan.Notes {
+		fmt.Printf("Note: %s\n", note)
+	}
+	for _, problem := range plan.Problems {
+		fmt.Fprintf(os.Stderr, "Problem: %s\n", problem)
+	}
+	return ok
+}
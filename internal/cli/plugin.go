@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Plugin commands",
+}
+
+var pluginListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List loaded plugins",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		plugins, err := client.ListPlugins()
+		if err != nil {
+			exitWithError("Failed to list plugins", err)
+		}
+
+		if len(plugins) == 0 {
+			fmt.Println("No plugins loaded")
+			return
+		}
+
+		t := newTable("NAME", "RUNNING", "HOOKS", "COMMANDS", "COLLECTORS")
+		t.truncatable(2, 3, 4)
+
+		for _, p := range plugins {
+			t.row(p.Name, p.Running,
+				joinOrDash(p.Hooks), joinOrDash(p.Commands), joinOrDash(p.Collectors))
+		}
+
+		t.print()
+	},
+}
+
+var pluginRunCmd = &cobra.Command{
+	Use:   "run <plugin> <command> [args...]",
+	Short: "Run a custom plugin command",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		result, err := client.RunPluginCommand(args[0], args[1], args[2:])
+		if err != nil {
+			exitWithError("Plugin command failed", err)
+		}
+
+		if result.Output != "" {
+			fmt.Println(strings.TrimRight(result.Output, "\n"))
+		}
+		if result.Data != nil {
+			data, _ := json.MarshalIndent(result.Data, "", "  ")
+			fmt.Println(string(data))
+		}
+	},
+}
+
+func joinOrDash(items []string) string {
+	if len(items) == 0 {
+		return "-"
+	}
+	return strings.Join(items, ",")
+}
+
+func init() {
+	pluginCmd.AddCommand(pluginListCmd)
+	pluginCmd.AddCommand(pluginRunCmd)
+}
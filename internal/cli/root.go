@@ -14,6 +14,9 @@ var rootCmd = &cobra.Command{
 It provides process management, auto-restart, logging, monitoring, and a REST API for remote management.
 
 Similar to PM2 but written in Go for better performance and simpler deployment.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		loadTimeDefaults(cmd)
+	},
 }
 
 // Execute runs the root command
@@ -22,16 +25,42 @@ func Execute() error {
 }
 
 func init() {
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output (also set by NO_COLOR)")
+	rootCmd.PersistentFlags().BoolVar(&outputUTC, "utc", false, "Show timestamps in UTC instead of local time")
+	rootCmd.PersistentFlags().StringVar(&timeFormat, "time-format", "", "Timestamp format: default, rfc3339, rfc3339nano, iso8601, unix or a Go layout")
+
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(stopCmd)
 	rootCmd.AddCommand(restartCmd)
+	rootCmd.AddCommand(resetCmd)
+	rootCmd.AddCommand(failoverCmd)
 	rootCmd.AddCommand(deleteCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(logsCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(infoCmd)
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(selfUpdateCmd)
 	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(pluginCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(enableCmd)
+	rootCmd.AddCommand(disableCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(annotateCmd)
+	rootCmd.AddCommand(rollbackConfigCmd)
+	rootCmd.AddCommand(deployCmd)
+	rootCmd.AddCommand(snapshotCmd)
+	rootCmd.AddCommand(eventsCmd)
+	rootCmd.AddCommand(waitCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(lintCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(simulateCmd)
+	rootCmd.AddCommand(usageCmd)
+	rootCmd.AddCommand(targetCmd)
 }
 
 func exitWithError(msg string, err error) {
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+var (
+	simulateExitCode int
+	simulateTimes    int
+	simulateUptime   time.Duration
+	simulateOutput   string
+)
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate <name|id>",
+	Short: "Dry-run the restart rules of a process against crashes",
+	Long: `Run the restart rules of a process, its restart policy or the built-in
+auto_restart and max_restarts rules, against a sequence of simulated crashes
+and show what the daemon would do after each. The simulation starts from the
+current restart count of the process. Nothing is started or stopped.`,
+	Example: `  gem simulate api --exit-code 1 --times 5
+  gem simulate api --exit-code 137 --times 20 --uptime 2s`,
+	Args: cobra.ExactArgs(1),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		validateOutputFormat(simulateOutput)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		sim, err := client.Simulate(args[0], types.SimulateRequest{
+			ExitCode: simulateExitCode,
+			Times:    simulateTimes,
+			Uptime:   simulateUptime.String(),
+		})
+		if err != nil {
+			exitWithError("Failed to simulate", err)
+		}
+
+		if printOutput(simulateOutput, sim) {
+			return
+		}
+
+		fmt.Printf("Process: %s\nPolicy:  %s\n\n", sim.Process, sim.Policy)
+
+		t := newTable("CRASH", "AT", "EXIT CODE", "ACTION", "DELAY", "REASON")
+		t.truncatable(5)
+		for _, step := range sim.Steps {
+			reason := step.Reason
+			if step.Error != "" {
+				reason = "policy failed, built-in rules used: " + step.Error
+			}
+			delay := "-"
+			if step.Delay > 0 {
+				delay = seconds(step.Delay).String()
+			}
+			t.row(step.Crash, "+"+seconds(step.At).String(), step.ExitCode,
+				step.Action, delay, valueOrDash(reason))
+		}
+		t.print()
+
+		fmt.Printf("\n%s\n", sim.Outcome)
+	},
+}
+
+// seconds converts seconds of the API to a duration, rounded for display
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond)
+}
+
+func init() {
+	simulateCmd.Flags().IntVar(&simulateExitCode, "exit-code", 1, "Exit code of each simulated crash")
+	simulateCmd.Flags().IntVar(&simulateTimes, "times", 5, "Number of crashes to simulate")
+	simulateCmd.Flags().DurationVar(&simulateUptime, "uptime", 0, "How long the process runs before each crash")
+	simulateCmd.Flags().StringVarP(&simulateOutput, "output", "o", "", outputFlagUsage)
+}
@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/snapshot"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+var (
+	snapshotIgnore   []string
+	snapshotOutput   string
+	snapshotExitCode bool
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Save and compare the state of processes",
+}
+
+var snapshotSaveCmd = &cobra.Command{
+	Use:   "save [file]",
+	Short: "Save the definitions and state of all processes",
+	Long: `Save the definitions, status and source revision of all processes to a
+file, or print them without one. Compare snapshots with gem snapshot diff.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		snap, err := client.Snapshot()
+		if err != nil {
+			exitWithError("Failed to take snapshot", err)
+		}
+
+		data, err := json.MarshalIndent(snap, "", "  ")
+		if err != nil {
+			exitWithError("Failed to encode snapshot", err)
+		}
+		data = append(data, '\n')
+
+		if len(args) == 0 {
+			os.Stdout.Write(data)
+			return
+		}
+		if err := os.WriteFile(args[0], data, 0600); err != nil {
+			exitWithError("Failed to write snapshot", err)
+		}
+		fmt.Printf("Saved %d processes to %s\n", len(snap.Processes), args[0])
+	},
+}
+
+var snapshotDiffCmd = &cobra.Command{
+	Use:   "diff <a> [b]",
+	Short: "Compare two snapshots",
+	Long: `Compare two saved snapshots, from two hosts or two points in time, and
+list the processes added, removed and changed from a to b with the fields
+that differ. Without b, a is compared to the current state of the daemon.
+
+Processes are matched by namespace and name. --exit-code exits with status
+1 when the snapshots differ, for drift checks.`,
+	Example: `  gem snapshot diff web-1.json web-2.json
+  gem snapshot diff before.json --ignore status,revision`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		validateOutputFormat(snapshotOutput)
+
+		a, err := snapshot.Load(args[0])
+		if err != nil {
+			exitWithError("Failed to read snapshot", err)
+		}
+
+		var b *types.Snapshot
+		if len(args) == 2 {
+			b, err = snapshot.Load(args[1])
+			if err != nil {
+				exitWithError("Failed to read snapshot", err)
+			}
+		} else {
+			client, err := NewClient()
+			if err != nil {
+				exitWithError("Failed to connect to daemon", err)
+			}
+			b, err = client.Snapshot()
+			if err != nil {
+				exitWithError("Failed to take snapshot", err)
+			}
+		}
+
+		diff := snapshot.Diff(a, b, snapshotIgnore)
+		if !printOutput(snapshotOutput, diff) {
+			printSnapshotDiff(diff)
+		}
+		if snapshotExitCode && !diff.Empty() {
+			os.Exit(1)
+		}
+	},
+}
+
+// printSnapshotDiff prints added processes with +, removed ones with - and
+// changed ones with ~ followed by their changed fields
+func printSnapshotDiff(diff *types.SnapshotDiff) {
+	fmt.Printf("Comparing %s (%s) with %s (%s)\n",
+		valueOrDash(diff.A.Host), formatTime(diff.A.TakenAt),
+		valueOrDash(diff.B.Host), formatTime(diff.B.TakenAt))
+
+	if diff.Empty() {
+		fmt.Printf("No differences, %d processes\n", diff.Unchanged)
+		return
+	}
+
+	fmt.Println()
+	for _, p := range diff.Added {
+		fmt.Printf("+ %s/%s\n", p.Namespace, p.Name)
+	}
+	for _, p := range diff.Removed {
+		fmt.Printf("- %s/%s\n", p.Namespace, p.Name)
+	}
+	for _, p := range diff.Changed {
+		fmt.Printf("~ %s/%s\n", p.Namespace, p.Name)
+		for _, f := range p.Fields {
+			fmt.Printf("    %s: %s -> %s\n", f.Field, diffValue(f.Old), diffValue(f.New))
+		}
+	}
+
+	fmt.Printf("\n%d added, %d removed, %d changed, %d unchanged\n",
+		len(diff.Added), len(diff.Removed), len(diff.Changed), diff.Unchanged)
+}
+
+func init() {
+	snapshotCmd.AddCommand(snapshotSaveCmd)
+	snapshotCmd.AddCommand(snapshotDiffCmd)
+
+	snapshotDiffCmd.Flags().StringSliceVar(&snapshotIgnore, "ignore", nil, "Fields to leave out of the comparison, e.g. status,revision")
+	snapshotDiffCmd.Flags().StringVarP(&snapshotOutput, "output", "o", "", outputFlagUsage)
+	snapshotDiffCmd.Flags().BoolVar(&snapshotExitCode, "exit-code", false, "Exit with status 1 when the snapshots differ")
+}
@@ -2,41 +2,131 @@ package cli
 
 import (
 	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
 
 	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/types"
 )
 
 var (
-	startName        string
-	startWorkDir     string
-	startAutoStart   bool
-	startAutoRestart bool
-	startMaxRestarts int
-	startUser        string
-	startEnv         []string
+	startName          string
+	startDescription   string
+	startHomepage      string
+	startOwnerContact  string
+	startWorkDir       string
+	startStdin         string
+	startAutoStart     bool
+	startAutoRestart   bool
+	startMaxRestarts   int
+	startUser          string
+	startTimezone      string
+	startLocale        string
+	startEncoding      string
+	startEnv           []string
+	startLogPipe       string
+	startLogQuota      int
+	startPolicy        string
+	startMaxUptime     string
+	startSchedule      string
+	startBinaryRestart bool
+	startWaitTCP       string
+	startWaitTimeout   string
+	startCPUSoft       float64
+	startCPUAction     string
+	startMemoryHigh    int
+	startReserveCPU    float64
+	startReserveMemory int
+	startOOMScoreAdj   int
+	startCapKeep       []string
+	startCapDrop       []string
+	startSeccomp       string
+	startAppArmor      string
+	startSELinux       string
+	startNetwork       string
+	startPublish       []string
+	startNamespace     string
+	startMonitor       []string
+	startDiskAlert     int
+	startPorts         []string
+	startOutputTimeout string
+	startOutputRestart bool
+	startStandby       bool
+	startStandbyWarmup string
+	startFetch         string
+	startSHA256        string
+	startGit           string
+	startRef           string
+	startDryRun        bool
 )
 
 var startCmd = &cobra.Command{
-	Use:   "start <command> [args...]",
+	Use:   "start <command> [args...] | <ecosystem file>",
 	Short: "Start a new process",
-	Long:  `Start a new managed process with the specified command and arguments.`,
-	Args:  cobra.MinimumNArgs(1),
+	Long: `Start a new managed process with the specified command and arguments.
+
+With --fetch the command is a script downloaded by the daemon into its data
+directory and verified against --sha256, and all arguments are passed to it.
+
+With --schedule the process isn't started now but on a cron schedule, in
+its --timezone. Each run is left to finish and isn't restarted; a run due
+while the previous one still runs is skipped. gem restart runs it right away.
+
+Given a .yaml, .yml or .json ecosystem file instead, the processes it lists
+(in the format of apply documents, see gem init) are created, changed ones
+are redefined and restarted, and those that aren't running are started.
+Unchanged running processes and processes not in the file are left alone.`,
+	Example: `  gem start --name api -- ./api --listen :8080
+  gem start --name backup --schedule "*/5 * * * *" -- ./backup.sh
+  gem start ecosystem.yaml
+  gem start ecosystem.yaml --dry-run`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if startFetch != "" {
+			if startSHA256 == "" {
+				return fmt.Errorf("--fetch requires --sha256")
+			}
+			return nil
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
+		validateOutputFormat(planOutput)
+
+		if len(args) == 1 && startFetch == "" && isEcosystemFile(args[0]) {
+			startEcosystem(cmd, args[0])
+			return
+		}
+
 		client, err := NewClient()
 		if err != nil {
 			exitWithError("Failed to connect to daemon", err)
 		}
 
-		command := args[0]
+		var command string
 		cmdArgs := []string{}
-		if len(args) > 1 {
-			cmdArgs = args[1:]
+		if startFetch == "" {
+			command = args[0]
+			args = args[1:]
+		}
+		if len(args) > 0 {
+			cmdArgs = args
 		}
 
 		name := startName
 		if name == "" {
 			name = command
 		}
+		if name == "" {
+			if u, err := url.Parse(startFetch); err == nil {
+				name = strings.TrimSuffix(path.Base(u.Path), path.Ext(u.Path))
+			}
+			if name == "" || name == "." || name == "/" {
+				exitWithError("Failed to start process", fmt.Errorf("no name in %s, use --name", startFetch))
+			}
+		}
 
 		// Parse environment variables
 		env := make(map[string]string)
@@ -50,15 +140,87 @@ var startCmd = &cobra.Command{
 		}
 
 		req := StartRequest{
-			Name:        name,
-			Command:     command,
-			Args:        cmdArgs,
-			WorkDir:     startWorkDir,
-			Env:         env,
-			AutoStart:   startAutoStart,
-			AutoRestart: startAutoRestart,
-			MaxRestarts: startMaxRestarts,
-			User:        startUser,
+			Name:                  name,
+			Description:           startDescription,
+			Homepage:              startHomepage,
+			OwnerContact:          startOwnerContact,
+			Command:               command,
+			Args:                  cmdArgs,
+			WorkDir:               startWorkDir,
+			Stdin:                 startStdin,
+			Env:                   env,
+			AutoStart:             startAutoStart,
+			AutoRestart:           startAutoRestart,
+			MaxRestarts:           startMaxRestarts,
+			User:                  startUser,
+			Timezone:              startTimezone,
+			Locale:                startLocale,
+			OutputEncoding:        startEncoding,
+			Namespace:             startNamespace,
+			LogPipe:               startLogPipe,
+			LogQuota:              startLogQuota,
+			RestartPolicy:         startPolicy,
+			MaxUptime:             startMaxUptime,
+			Schedule:              startSchedule,
+			RestartOnBinaryChange: startBinaryRestart,
+			OOMScoreAdj:           startOOMScoreAdj,
+			Seccomp:               startSeccomp,
+			AppArmorProfile:       startAppArmor,
+			SELinuxLabel:          startSELinux,
+			MonitorPaths:          startMonitor,
+			DiskAlert:             startDiskAlert,
+			Ports:                 startPorts,
+		}
+
+		if startNetwork != "" || len(startPublish) > 0 {
+			req.Network = &types.Network{Mode: startNetwork, Publish: startPublish}
+		}
+
+		if len(startCapKeep) > 0 || len(startCapDrop) > 0 {
+			req.Capabilities = &types.Capabilities{Keep: startCapKeep, Drop: startCapDrop}
+		}
+
+		if startCPUSoft > 0 || startMemoryHigh > 0 {
+			req.SoftLimits = &types.SoftLimits{
+				CPUPercent: startCPUSoft,
+				CPUAction:  startCPUAction,
+				MemoryHigh: startMemoryHigh,
+			}
+		}
+
+		if startReserveCPU > 0 || startReserveMemory > 0 {
+			req.Reserve = &types.Reservation{CPU: startReserveCPU, Memory: startReserveMemory}
+		}
+
+		if startOutputTimeout != "" {
+			req.OutputWatchdog = &types.OutputWatchdog{Timeout: startOutputTimeout, Restart: startOutputRestart}
+		}
+
+		if startStandby || startStandbyWarmup != "" {
+			req.Standby = &types.Standby{Warmup: startStandbyWarmup}
+		}
+
+		if startFetch != "" {
+			req.Fetch = &types.Fetch{URL: startFetch, SHA256: startSHA256}
+		}
+
+		if startGit != "" {
+			req.Source = &types.Source{Git: startGit, Ref: startRef}
+		}
+
+		if startWaitTCP != "" {
+			req.WaitFor = &types.WaitFor{TCP: startWaitTCP, Timeout: startWaitTimeout}
+		}
+
+		if startDryRun {
+			plan, err := client.PlanStart(&req)
+			if err != nil {
+				exitWithError("Failed to plan process", err)
+			}
+			if !printPlan(plan) {
+				os.Exit(1)
+			}
+			return
 		}
 
 		info, err := client.Start(&req)
@@ -66,16 +228,71 @@ var startCmd = &cobra.Command{
 			exitWithError("Failed to start process", err)
 		}
 
+		if info.NextRun != nil {
+			fmt.Printf("Scheduled process '%s' (ID: %s), next run at %s\n", info.Name, info.ID, formatTime(*info.NextRun))
+			return
+		}
+		if info.Status == types.StatusQueued {
+			fmt.Printf("Queued process '%s' (ID: %s), it starts once a start slot is free\n", info.Name, info.ID)
+			return
+		}
+		if info.Status == types.StatusStarting && info.WaitFor != nil {
+			fmt.Printf("Starting process '%s' (ID: %s) once %s accepts connections\n", info.Name, info.ID, info.WaitFor.TCP)
+			return
+		}
+
 		fmt.Printf("Started process '%s' (ID: %s, PID: %d)\n", info.Name, info.ID, info.PID)
 	},
 }
 
 func init() {
 	startCmd.Flags().StringVarP(&startName, "name", "n", "", "Process name (defaults to command name)")
+	startCmd.Flags().StringVar(&startDescription, "description", "", "What the process does, shown by status")
+	startCmd.Flags().StringVar(&startHomepage, "homepage", "", "URL of the documentation or runbook of the process")
+	startCmd.Flags().StringVar(&startOwnerContact, "owner-contact", "", "Who to contact about the process, e.g. a team or pager address")
 	startCmd.Flags().StringVarP(&startWorkDir, "cwd", "c", "", "Working directory")
+	startCmd.Flags().StringVar(&startStdin, "stdin", "", "File or named pipe to read standard input from (default /dev/null)")
 	startCmd.Flags().BoolVar(&startAutoStart, "auto-start", true, "Auto-start on daemon restart")
 	startCmd.Flags().BoolVar(&startAutoRestart, "auto-restart", true, "Auto-restart on crash")
 	startCmd.Flags().IntVar(&startMaxRestarts, "max-restarts", 10, "Maximum restart attempts")
 	startCmd.Flags().StringVarP(&startUser, "user", "u", "", "Run as user")
+	startCmd.Flags().StringVar(&startTimezone, "timezone", "", "Timezone of the process, sets TZ (e.g. Europe/Berlin)")
+	startCmd.Flags().StringVar(&startLocale, "locale", "", "Locale of the process, sets LANG (e.g. de_DE.UTF-8)")
+	startCmd.Flags().StringVar(&startEncoding, "output-encoding", "", "Character encoding of the output, transcoded to UTF-8 (e.g. windows-1252)")
+	startCmd.Flags().StringVarP(&startNamespace, "namespace", "N", "", "Namespace of the process")
+	startCmd.Flags().StringVar(&startLogPipe, "log-pipe", "", "Command receiving captured log lines on stdin")
+	startCmd.Flags().IntVar(&startLogQuota, "log-quota", 0, "Log disk quota for this process in MB (0 for no quota)")
+	startCmd.Flags().StringVar(&startPolicy, "restart-policy", "", "Starlark script deciding whether to restart after an exit")
+	startCmd.Flags().BoolVar(&startBinaryRestart, "restart-on-binary-change", false, "Restart the process when its binary changes on disk")
+	startCmd.Flags().StringVar(&startMaxUptime, "max-uptime", "", "Restart the process once it has been up this long (e.g. 7d)")
+	startCmd.Flags().StringVar(&startSchedule, "schedule", "", "Start the process on a cron schedule instead of now (e.g. \"*/5 * * * *\")")
+	startCmd.Flags().StringVar(&startWaitTCP, "wait-for-tcp", "", "Don't start until this host:port accepts connections")
+	startCmd.Flags().StringVar(&startWaitTimeout, "wait-timeout", "60s", "How long to wait for --wait-for-tcp")
+	startCmd.Flags().Float64Var(&startCPUSoft, "cpu-soft-limit", 0, "Throttle the process when its CPU usage exceeds this percentage (100 = one core)")
+	startCmd.Flags().StringVar(&startCPUAction, "cpu-soft-action", "max", "How to throttle: cap with cpu.max or lower cpu.weight")
+	startCmd.Flags().IntVar(&startMemoryHigh, "memory-high", 0, "Memory in MB above which the process is throttled and reclaimed")
+	startCmd.Flags().Float64Var(&startReserveCPU, "reserve-cpu", 0, "CPU cores the process is expected to use, checked by admission control")
+	startCmd.Flags().IntVar(&startReserveMemory, "reserve-memory", 0, "Memory in MB the process is expected to use, checked by admission control")
+	startCmd.Flags().IntVar(&startOOMScoreAdj, "oom-score-adj", 0, "OOM killer score adjustment from -1000 (never killed) to 1000 (killed first)")
+	startCmd.Flags().StringSliceVar(&startCapKeep, "cap-keep", nil, "Capabilities to keep, dropping all others (e.g. CAP_NET_BIND_SERVICE)")
+	startCmd.Flags().StringSliceVar(&startCapDrop, "cap-drop", nil, "Capabilities to drop (e.g. CAP_NET_RAW)")
+	startCmd.Flags().StringVar(&startSeccomp, "seccomp", "", "OCI seccomp profile applied before exec")
+	startCmd.Flags().StringVar(&startAppArmor, "apparmor-profile", "", "AppArmor profile to run the process under")
+	startCmd.Flags().StringVar(&startSELinux, "selinux-label", "", "SELinux context to run the process under")
+	startCmd.Flags().StringVar(&startNetwork, "network", "", "Network mode: host, or isolated for a namespace with only loopback")
+	startCmd.Flags().StringArrayVarP(&startPublish, "publish", "p", nil, "Forward a host port into an isolated process ([host_ip:]host_port:port)")
+	startCmd.Flags().StringArrayVar(&startMonitor, "monitor-path", nil, "File or directory whose size is recorded over time (repeatable)")
+	startCmd.Flags().IntVar(&startDiskAlert, "disk-alert", 0, "Emit a disk_alert event when a monitored path grows above this many MB")
+	startCmd.Flags().StringArrayVar(&startPorts, "port", nil, "Port or host:port the process listens on, probed while it runs (repeatable)")
+	startCmd.Flags().StringVar(&startOutputTimeout, "output-timeout", "", "Emit a no_output event when the process writes no output for this long (e.g. 10m)")
+	startCmd.Flags().BoolVar(&startOutputRestart, "output-restart", false, "Also restart the process when --output-timeout passes")
+	startCmd.Flags().BoolVar(&startStandby, "standby", false, "Keep a suspended second copy of the process to fail over to")
+	startCmd.Flags().StringVar(&startStandbyWarmup, "standby-warmup", "", "How long the standby boots before it is suspended (default 30s, implies --standby)")
+	startCmd.Flags().StringVar(&startFetch, "fetch", "", "Download the command from this URL into the data directory")
+	startCmd.Flags().StringVar(&startSHA256, "sha256", "", "SHA-256 the script of --fetch must match")
+	startCmd.Flags().StringVar(&startGit, "git", "", "Git repository checked out as the working directory (--cwd is then relative to it)")
+	startCmd.Flags().StringVar(&startRef, "ref", "", "Branch, tag or commit of --git to check out (default branch if empty)")
 	startCmd.Flags().StringArrayVarP(&startEnv, "env", "e", []string{}, "Environment variables (KEY=VALUE)")
+	startCmd.Flags().BoolVar(&startDryRun, "dry-run", false, "Print the resolved command, environment, user and limits without starting anything")
+	startCmd.Flags().StringVarP(&planOutput, "output", "o", "", "Output format of --dry-run: json, yaml or jsonpath=TEMPLATE")
 }
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// sparkBlocks are the bar heights of a sparkline, lowest first
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// maxSparkWidth caps the sparkline width on wide terminals
+const maxSparkWidth = 80
+
+var statsWindow time.Duration
+
+var statsCmd = &cobra.Command{
+	Use:   "stats <name|id>",
+	Short: "Chart CPU and memory history of a process",
+	Long: `Render the recorded CPU and memory usage of a process as sparklines with
+min/avg/max summaries. The daemon samples processes every 10 seconds and
+keeps the most recent 1000 samples.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		history, err := client.GetStatsHistory(args[0], statsWindow)
+		if err != nil {
+			exitWithError("Failed to get stats history", err)
+		}
+
+		if len(history) == 0 {
+			fmt.Println("No stats recorded in this window")
+			return
+		}
+
+		cpu := make([]float64, len(history))
+		memory := make([]float64, len(history))
+		for i, s := range history {
+			cpu[i] = s.CPU
+			memory[i] = float64(s.Memory)
+		}
+
+		first, last := history[0].Timestamp, history[len(history)-1].Timestamp
+		fmt.Printf("%s: %d samples from %s to %s\n\n",
+			args[0], len(history), formatTime(first), formatTime(last))
+
+		width := maxSparkWidth
+		if w, _ := terminalWidth(); w > 0 && w-10 < width {
+			width = max(w-10, 10)
+		}
+
+		percent := func(v float64) string { return fmt.Sprintf("%.1f%%", v) }
+		bytes := func(v float64) string { return formatBytes(uint64(v)) }
+		printSparkline("CPU", cpu, width, percent)
+		printSparkline("Memory", memory, width, bytes)
+	},
+}
+
+// printSparkline prints a labelled sparkline followed by its summary line
+func printSparkline(label string, values []float64, width int, format func(float64) string) {
+	lo, hi, sum := values[0], values[0], 0.0
+	for _, v := range values {
+		lo = min(lo, v)
+		hi = max(hi, v)
+		sum += v
+	}
+
+	fmt.Printf("%-8s%s\n", label, sparkline(values, width, lo, hi))
+	fmt.Printf("%-8smin %s  avg %s  max %s\n\n",
+		"", format(lo), format(sum/float64(len(values))), format(hi))
+}
+
+// sparkline scales values between lo and hi into at most width bars, each
+// the average of its share of the samples
+func sparkline(values []float64, width int, lo, hi float64) string {
+	buckets := min(len(values), width)
+
+	var b strings.Builder
+	for i := 0; i < buckets; i++ {
+		start := i * len(values) / buckets
+		end := (i + 1) * len(values) / buckets
+
+		sum := 0.0
+		for _, v := range values[start:end] {
+			sum += v
+		}
+		avg := sum / float64(end-start)
+
+		level := 0
+		if hi > lo {
+			level = int((avg - lo) / (hi - lo) * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[level])
+	}
+	return b.String()
+}
+
+func init() {
+	statsCmd.Flags().DurationVarP(&statsWindow, "window", "w", time.Hour, "Only chart samples from this long ago until now (0 for all)")
+}
@@ -2,18 +2,27 @@ package cli
 
 import (
 	"fmt"
-	"os"
-	"text/tabwriter"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/types"
 )
 
+var statusOutput string
+
 var statusCmd = &cobra.Command{
-	Use:   "status [name|id]",
-	Short: "Show process status",
-	Long:  `Show detailed status for a specific process or all processes.`,
-	Args:  cobra.MaximumNArgs(1),
+	Use:     "status [name|id]",
+	Aliases: []string{"describe"},
+	Short:   "Show process status",
+	Long: `Show detailed status for a specific process or all processes.
+Use -o json, yaml or jsonpath=TEMPLATE for machine-readable output.`,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		validateOutputFormat(statusOutput)
+
 		client, err := NewClient()
 		if err != nil {
 			exitWithError("Failed to connect to daemon", err)
@@ -35,8 +44,22 @@ var statusCmd = &cobra.Command{
 			exitWithError("Process not found", nil)
 		}
 
+		if printOutput(statusOutput, info) {
+			return
+		}
+
 		fmt.Printf("Process: %s\n", info.Name)
 		fmt.Printf("  ID:           %s\n", info.ID)
+		fmt.Printf("  Namespace:    %s\n", info.Namespace)
+		if info.Description != "" {
+			fmt.Printf("  Description:  %s\n", info.Description)
+		}
+		if info.Homepage != "" {
+			fmt.Printf("  Homepage:     %s\n", info.Homepage)
+		}
+		if info.OwnerContact != "" {
+			fmt.Printf("  Owner:        %s\n", info.OwnerContact)
+		}
 		fmt.Printf("  Status:       %s\n", info.Status)
 		fmt.Printf("  PID:          %d\n", info.PID)
 		fmt.Printf("  Command:      %s\n", info.Command)
@@ -46,18 +69,158 @@ var statusCmd = &cobra.Command{
 		if info.WorkDir != "" {
 			fmt.Printf("  Working Dir:  %s\n", info.WorkDir)
 		}
+		if info.Stdin != "" {
+			fmt.Printf("  Stdin:        %s\n", info.Stdin)
+		}
+		if info.Timezone != "" {
+			fmt.Printf("  Timezone:     %s\n", info.Timezone)
+		}
+		if info.Locale != "" {
+			fmt.Printf("  Locale:       %s\n", info.Locale)
+		}
+		if info.OutputEncoding != "" {
+			fmt.Printf("  Encoding:     %s\n", info.OutputEncoding)
+		}
+		if info.LogPipe != "" {
+			fmt.Printf("  Log pipe:     %s\n", info.LogPipe)
+		}
 		fmt.Printf("  Auto-start:   %v\n", info.AutoStart)
 		fmt.Printf("  Auto-restart: %v\n", info.AutoRestart)
 		fmt.Printf("  Max restarts: %d\n", info.MaxRestarts)
+		if info.WaitFor != nil {
+			fmt.Printf("  Wait for:     tcp %s (timeout %s)\n", info.WaitFor.TCP, valueOrDash(info.WaitFor.Timeout))
+		}
+		if s := info.SoftLimits; s != nil {
+			fmt.Printf("  Soft limits:  cpu %.0f%% (%s), memory high %dMB, throttled: %v\n",
+				s.CPUPercent, valueOrDash(s.CPUAction), s.MemoryHigh, info.Throttled)
+		}
+		if r := info.Reserve; r != nil {
+			fmt.Printf("  Reserved:     %s\n", formatReservation(r.CPU, r.Memory))
+		}
+		fmt.Printf("  OOM score adj:%d\n", info.OOMScoreAdj)
+		if c := info.Capabilities; c != nil {
+			fmt.Printf("  Capabilities: keep %s, drop %s\n", joinOrDash(c.Keep), joinOrDash(c.Drop))
+		}
+		if info.Seccomp != "" {
+			fmt.Printf("  Seccomp:      %s\n", info.Seccomp)
+		}
+		if n := info.Network; n != nil {
+			fmt.Printf("  Network:      %s, publish %s\n", valueOrDash(n.Mode), joinOrDash(n.Publish))
+		}
+		if info.AppArmorProfile != "" {
+			fmt.Printf("  AppArmor:     %s\n", info.AppArmorProfile)
+		}
+		if info.SELinuxLabel != "" {
+			fmt.Printf("  SELinux:      %s\n", info.SELinuxLabel)
+		}
+		if info.SecurityContext != "" {
+			fmt.Printf("  Security ctx: %s\n", info.SecurityContext)
+		}
+		if info.Unit != "" {
+			fmt.Printf("  Unit:         %s\n", info.Unit)
+		}
+		if info.RestartPolicy != "" {
+			fmt.Printf("  Policy:       %s\n", info.RestartPolicy)
+		}
+		if info.MaxUptime != "" {
+			fmt.Printf("  Max uptime:   %s\n", info.MaxUptime)
+		}
+		if info.Schedule != "" {
+			fmt.Printf("  Schedule:     %s\n", info.Schedule)
+			if info.NextRun != nil {
+				fmt.Printf("  Next run:     %s\n", formatTime(*info.NextRun))
+			}
+			if r := info.LastRun; r != nil {
+				fmt.Printf("  Last run:     %s, %s after %s\n", formatTime(r.StartedAt),
+					formatExit(&types.LastExit{Code: r.ExitCode, Signal: r.Signal, Reason: r.Reason}),
+					time.Duration(r.Duration*float64(time.Second)).Round(time.Millisecond))
+			}
+		}
+		if b := info.Binary; b != nil {
+			fmt.Printf("  Binary:       %s (sha256 %s, modified %s)\n", b.Path, shortRevision(b.SHA256), formatTime(b.ModTime))
+			if info.BinaryUpdated {
+				fmt.Printf("                restart pending: binary updated\n")
+			}
+		}
+		for _, path := range info.MonitorPaths {
+			size := "-"
+			if s, ok := info.DiskUsage[path]; ok {
+				size = formatBytes(s)
+			}
+			fmt.Printf("  Disk:         %s %s\n", path, size)
+		}
+		if info.DiskAlert > 0 {
+			fmt.Printf("  Disk alert:   %dMB\n", info.DiskAlert)
+		}
+		if s := info.Source; s != nil {
+			fmt.Printf("  Source:       %s %s (revision %s)\n", s.Git, valueOrDash(s.Ref), valueOrDash(info.Revision))
+		}
+		if f := info.Fetch; f != nil {
+			fmt.Printf("  Fetched from: %s (sha256 %s)\n", f.URL, f.SHA256)
+		}
+		if w := info.OutputWatchdog; w != nil {
+			last := "never"
+			if info.LastOutput != nil {
+				last = formatTime(*info.LastOutput)
+			}
+			fmt.Printf("  Watchdog:     no output for %s (restart: %v), last output %s\n", w.Timeout, w.Restart, last)
+		}
+		if info.Standby != nil {
+			switch {
+			case info.StandbyReady:
+				fmt.Printf("  Standby:      PID %d, suspended and ready\n", info.StandbyPID)
+			case info.StandbyPID > 0:
+				fmt.Printf("  Standby:      PID %d, warming up\n", info.StandbyPID)
+			default:
+				fmt.Println("  Standby:      none yet")
+			}
+		}
+		for _, line := range probeLines(info) {
+			fmt.Printf("  Port:         %s\n", line)
+		}
+		if r := info.Report; r != nil {
+			fmt.Printf("  Reported:     %s at %s\n", reportSummary(r), formatTime(r.UpdatedAt))
+			if r.Status != "" {
+				fmt.Printf("  Status text:  %s\n", r.Status)
+			}
+			keys := make([]string, 0, len(r.Details))
+			for k := range r.Details {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				fmt.Printf("  Detail:       %s=%s\n", k, r.Details[k])
+			}
+		}
 		fmt.Printf("  Restart count:%d\n", info.RestartCount)
-		fmt.Printf("  Created at:   %s\n", info.CreatedAt.Format("2006-01-02 15:04:05"))
+		if info.CrashLoopedAt != nil {
+			fmt.Printf("  Crash looped: since %s, run gem reset to clear\n", formatTime(*info.CrashLoopedAt))
+		}
+		if e := info.LastExit; e != nil {
+			detail := ""
+			if e.Detail != "" {
+				detail = ": " + e.Detail
+			}
+			fmt.Printf("  Last exit:    %s at %s%s\n", formatExit(e), formatTime(e.Time), detail)
+		}
+		fmt.Printf("  Generation:   %d\n", info.Generation)
+		fmt.Printf("  Created at:   %s\n", formatTime(info.CreatedAt))
 		if info.StartedAt != nil {
-			fmt.Printf("  Started at:   %s\n", info.StartedAt.Format("2006-01-02 15:04:05"))
+			fmt.Printf("  Started at:   %s\n", formatTime(*info.StartedAt))
 		}
 		if info.Status == "running" {
 			fmt.Printf("  CPU:          %.1f%%\n", info.CPU)
 			fmt.Printf("  Memory:       %s (%.1f%%)\n", formatBytes(info.Memory), info.MemoryPercent)
 		}
+
+		// Daemons without annotations answer with an error
+		if annotations, err := client.Annotations(info.ID); err == nil && len(annotations) > 0 {
+			fmt.Println("  Annotations:")
+			printAnnotations(annotations[max(0, len(annotations)-statusAnnotations):], "    ")
+			if len(annotations) > statusAnnotations {
+				fmt.Printf("    (%d older, see gem annotate %s)\n", len(annotations)-statusAnnotations, info.Name)
+			}
+		}
 	},
 }
 
@@ -67,22 +230,27 @@ func showAllStats(client *Client) {
 		exitWithError("Failed to get stats", err)
 	}
 
+	if stats == nil {
+		stats = []*types.ProcessStats{}
+	}
+	if printOutput(statusOutput, stats) {
+		return
+	}
+
 	if len(stats) == 0 {
 		fmt.Println("No running processes")
 		return
 	}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tPID\tCPU\tMEMORY\tTHREADS\tFDs\tREAD\tWRITE")
+	t := newTable("ID", "PID", "CPU", "MEMORY", "THREADS", "FDs", "READ", "WRITE")
 
 	for _, s := range stats {
-		fmt.Fprintf(w, "%s\t%d\t%.1f%%\t%s\t%d\t%d\t%s\t%s\n",
-			s.ID, s.PID, s.CPU, formatBytes(s.Memory),
+		t.row(s.ID, s.PID, fmt.Sprintf("%.1f%%", s.CPU), formatBytes(s.Memory),
 			s.NumThreads, s.NumFDs,
 			formatBytes(s.ReadBytes), formatBytes(s.WriteBytes))
 	}
 
-	w.Flush()
+	t.print()
 }
 
 var infoCmd = &cobra.Command{
@@ -102,7 +270,15 @@ var infoCmd = &cobra.Command{
 
 		fmt.Printf("Gemstone Daemon\n")
 		fmt.Printf("  Version:        %s\n", info.Version)
+		fmt.Printf("  Instance:       %s\n", info.InstanceID)
+		if !info.ServerTime.IsZero() {
+			fmt.Printf("  Clock:          %s (%s)\n", formatTime(info.ServerTime), clockSkew(info.ServerTime))
+		}
 		fmt.Printf("  Process count:  %d\n", info.ProcessCount)
+		if c := info.Capacity; c != nil {
+			fmt.Printf("  Reserved:       %s of %s (%s)\n",
+				formatReservation(c.ReservedCPU, c.ReservedMemory), formatReservation(c.CPU, c.Memory), c.Mode)
+		}
 		fmt.Println()
 		fmt.Printf("System Stats\n")
 		fmt.Printf("  CPU:            %.1f%%\n", info.SystemStats.CPUPercent)
@@ -120,5 +296,107 @@ var infoCmd = &cobra.Command{
 				info.SystemStats.LoadAverage[1],
 				info.SystemStats.LoadAverage[2])
 		}
+
+		if infoDaemon {
+			showDaemonStats(client)
+		}
 	},
 }
+
+var infoDaemon bool
+
+// formatReservation formats reserved CPU cores and memory in MB
+func formatReservation(cpu float64, memory int) string {
+	return fmt.Sprintf("%g cores, %d MB", cpu, memory)
+}
+
+// clockSkewTolerance is the clock difference to the daemon still shown as
+// in sync, covering the request latency
+const clockSkewTolerance = time.Second
+
+// clockSkew describes how far the daemon's clock is off from the local one
+func clockSkew(serverTime time.Time) string {
+	skew := time.Since(serverTime).Round(time.Millisecond)
+	switch {
+	case skew > clockSkewTolerance:
+		return fmt.Sprintf("%s behind", skew)
+	case skew < -clockSkewTolerance:
+		return fmt.Sprintf("%s ahead", -skew)
+	}
+	return "in sync"
+}
+
+func showDaemonStats(client *Client) {
+	stats, err := client.GetDaemonStats()
+	if err != nil {
+		exitWithError("Failed to get daemon stats", err)
+	}
+
+	fmt.Println()
+	fmt.Printf("Daemon Resources\n")
+	fmt.Printf("  PID:            %d\n", stats.PID)
+	fmt.Printf("  Uptime:         %s\n", formatDuration(time.Duration(stats.Uptime)*time.Second))
+	fmt.Printf("  CPU:            %.1f%%\n", stats.CPU)
+	fmt.Printf("  Memory (RSS):   %s\n", formatBytes(stats.Memory))
+	fmt.Printf("  Heap:           %s / %s\n", formatBytes(stats.HeapAlloc), formatBytes(stats.HeapSys))
+	fmt.Printf("  Goroutines:     %d\n", stats.Goroutines)
+	fmt.Printf("  Threads:        %d (GOMAXPROCS %d)\n", stats.NumThreads, stats.GOMAXPROCS)
+	fmt.Printf("  Open FDs:       %d (%d log files)\n", stats.NumFDs, stats.OpenLogFiles)
+	fmt.Printf("  Streams:        %d\n", stats.Streams)
+	fmt.Printf("  GC cycles:      %d (%s total pause)\n", stats.NumGC, time.Duration(stats.GCPauseTotal))
+	if stats.Chaos != "" {
+		fmt.Printf("  Chaos mode:     %s\n", stats.Chaos)
+	}
+}
+
+// probeLines describes the declared ports of a process with their last
+// probe, if any
+func probeLines(info *types.ProcessInfo) []string {
+	probes := make(map[string]types.PortProbe, len(info.Probes))
+	for i, probe := range info.Probes {
+		if i < len(info.Ports) {
+			probes[info.Ports[i]] = probe
+		}
+	}
+
+	lines := make([]string, 0, len(info.Ports))
+	for _, port := range info.Ports {
+		probe, ok := probes[port]
+		switch {
+		case !ok:
+			lines = append(lines, port+" not probed yet")
+		case probe.Error != "":
+			lines = append(lines, fmt.Sprintf("%s failed %d times: %s", probe.Address, probe.Failures, probe.Error))
+		default:
+			line := fmt.Sprintf("%s %.1fms", probe.Address, probe.Latency)
+			if probe.Backlog > 0 {
+				line += fmt.Sprintf(", %d waiting to be accepted", probe.Backlog)
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// reportSummary describes what a process reported on the notify socket,
+// e.g. "ready, degraded"
+func reportSummary(r *types.Report) string {
+	var parts []string
+	if r.Ready {
+		parts = append(parts, "ready")
+	} else {
+		parts = append(parts, "not ready")
+	}
+	if r.Health != "" {
+		parts = append(parts, r.Health)
+	}
+	if r.Stopping {
+		parts = append(parts, "stopping")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func init() {
+	statusCmd.Flags().StringVarP(&statusOutput, "output", "o", "", outputFlagUsage)
+	infoCmd.Flags().BoolVar(&infoDaemon, "daemon", false, "Also show resource usage of the daemon itself")
+}
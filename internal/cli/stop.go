@@ -2,63 +2,151 @@ package cli
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	restartDryRun        bool
+	restartWaitHealthy   bool
+	restartHealthTimeout time.Duration
+	restartGroupName     string
+)
+
 var stopCmd = &cobra.Command{
-	Use:   "stop <name|id>",
+	Use:   "stop <name|id|glob>...",
 	Short: "Stop a running process",
-	Long:  `Stop a running process by name or ID.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Stop running processes by name, ID or a glob like 'web-*'. With several
+targets, --all or --namespace the processes are stopped concurrently.`,
+	Args: bulkArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		client, err := NewClient()
-		if err != nil {
-			exitWithError("Failed to connect to daemon", err)
-		}
-
-		if err := client.Stop(args[0]); err != nil {
-			exitWithError("Failed to stop process", err)
-		}
-
-		fmt.Printf("Stopped process '%s'\n", args[0])
+		runBulk(args, bulkAction{
+			verb:    "stop",
+			present: "Stopping",
+			past:    "Stopped",
+			run:     (*Client).Stop,
+		})
 	},
 }
 
 var restartCmd = &cobra.Command{
-	Use:   "restart <name|id>",
+	Use:   "restart <name|id|glob>...",
 	Short: "Restart a process",
-	Long:  `Restart a process by name or ID.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Restart processes by name, ID or a glob like 'web-*'. With several
+targets, --all or --namespace the processes are restarted concurrently.
+
+With --wait-healthy each restart only succeeds once the new run is healthy:
+its ports accept connections, it reported READY=1 if it uses the notify
+socket, and otherwise it stayed up for 5 seconds. A run that exits or isn't
+healthy within --health-timeout fails the restart.
+
+With --group the processes of a restart group from the config are restarted
+together: the running ones are stopped, the last one first, and then all of
+them are started in the listed order, each once the ones before it run.`,
+	Example: `  gem restart api
+  gem restart 'web-*' --wait-healthy
+  gem restart --group payments`,
+	Args: restartArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		client, err := NewClient()
-		if err != nil {
-			exitWithError("Failed to connect to daemon", err)
+		if restartGroupName != "" {
+			runGroupRestart(restartGroupName)
+			return
 		}
-
-		if err := client.Restart(args[0]); err != nil {
-			exitWithError("Failed to restart process", err)
+		if restartDryRun {
+			planRestarts(args)
+			return
+		}
+		action := bulkAction{
+			verb:    "restart",
+			present: "Restarting",
+			past:    "Restarted",
+			run:     (*Client).Restart,
 		}
+		if restartWaitHealthy {
+			action.run = func(client *Client, idOrName string) error {
+				return client.RestartHealthy(idOrName, restartHealthTimeout)
+			}
+		}
+		runBulk(args, action)
+	},
+}
 
-		fmt.Printf("Restarted process '%s'\n", args[0])
+// restartArgs accepts either targets like bulkArgs or --group alone
+func restartArgs(cmd *cobra.Command, args []string) error {
+	if restartGroupName == "" {
+		return bulkArgs(cmd, args)
+	}
+	if len(args) > 0 || bulkAll || bulkNamespace != "" {
+		return fmt.Errorf("--group can't be combined with process names, --all or --namespace")
+	}
+	if restartDryRun || restartWaitHealthy {
+		return fmt.Errorf("--group can't be combined with --dry-run or --wait-healthy")
+	}
+	return nil
+}
+
+var resetCmd = &cobra.Command{
+	Use:   "reset <name|id|glob>...",
+	Short: "Clear the restart count and error state of a process",
+	Long: `Reset the restart count, recent restarts and crash loop of processes by
+name, ID or a glob like 'web-*', so a fixed service gets its full restart
+budget again. Crash-looped and errored processes are left stopped, running
+ones keep running.`,
+	Args: bulkArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runBulk(args, bulkAction{
+			verb:    "reset",
+			present: "Resetting",
+			past:    "Reset",
+			run:     (*Client).Reset,
+		})
+	},
+}
+
+var failoverCmd = &cobra.Command{
+	Use:   "failover <name|id|glob>...",
+	Short: "Hand a process over to its warm standby",
+	Long: `Resume the suspended standby of processes started with --standby in
+place of the running process, which is stopped. The takeover is instant, the
+daemon starts a new standby once the replaced run has exited.`,
+	Args: bulkArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runBulk(args, bulkAction{
+			verb:    "fail over",
+			present: "Failing over",
+			past:    "Failed over",
+			run:     (*Client).Failover,
+		})
 	},
 }
 
 var deleteCmd = &cobra.Command{
-	Use:   "delete <name|id>",
+	Use:   "delete <name|id|glob>...",
 	Short: "Delete a process",
-	Long:  `Delete a process by name or ID. The process will be stopped if running.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Delete processes by name, ID or a glob like 'web-*'. Running processes
+are stopped. With several targets, --all or --namespace the processes are
+deleted concurrently.`,
+	Args: bulkArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		client, err := NewClient()
-		if err != nil {
-			exitWithError("Failed to connect to daemon", err)
-		}
-
-		if err := client.Delete(args[0]); err != nil {
-			exitWithError("Failed to delete process", err)
-		}
-
-		fmt.Printf("Deleted process '%s'\n", args[0])
+		runBulk(args, bulkAction{
+			verb:    "delete",
+			present: "Deleting",
+			past:    "Deleted",
+			run:     (*Client).Delete,
+		})
 	},
 }
+
+func init() {
+	addBulkFlags(stopCmd)
+	addBulkFlags(restartCmd)
+	restartCmd.Flags().BoolVar(&restartDryRun, "dry-run", false, "Print what the processes would be started with without restarting them")
+	restartCmd.Flags().StringVarP(&planOutput, "output", "o", "", "Output format of --dry-run: json, yaml or jsonpath=TEMPLATE")
+	restartCmd.Flags().BoolVar(&restartWaitHealthy, "wait-healthy", false, "Wait until the new run is healthy and fail if it isn't")
+	restartCmd.Flags().DurationVar(&restartHealthTimeout, "health-timeout", time.Minute, "How long --wait-healthy waits for the new run")
+	restartCmd.Flags().StringVar(&restartGroupName, "group", "", "Restart the processes of a restart group together, in order")
+	addBulkFlags(resetCmd)
+	addBulkFlags(failoverCmd)
+	addBulkFlags(deleteCmd)
+}
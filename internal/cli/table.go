@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// noColor disables colored output, like the NO_COLOR environment variable
+var noColor bool
+
+// ANSI colors used in tables
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorGray   = "\x1b[90m"
+)
+
+// minTruncatedWidth is the narrowest a truncated column gets
+const minTruncatedWidth = 6
+
+// columnGap separates columns
+const columnGap = "  "
+
+// table renders aligned columns. On a terminal, columns marked truncatable
+// are shortened with an ellipsis to fit its width, and cells are colored.
+type table struct {
+	headers  []string
+	rows     [][]string
+	truncate map[int]bool
+	colors   map[int]func(string) string
+}
+
+func newTable(headers ...string) *table {
+	return &table{
+		headers:  headers,
+		truncate: make(map[int]bool),
+		colors:   make(map[int]func(string) string),
+	}
+}
+
+// row adds a row of cells
+func (t *table) row(cells ...interface{}) {
+	row := make([]string, len(cells))
+	for i, c := range cells {
+		row[i] = fmt.Sprint(c)
+	}
+	t.rows = append(t.rows, row)
+}
+
+// truncatable allows shortening a column to fit the terminal
+func (t *table) truncatable(columns ...int) {
+	for _, c := range columns {
+		t.truncate[c] = true
+	}
+}
+
+// color sets the function choosing the color of a column's cells by value
+func (t *table) color(column int, fn func(string) string) {
+	t.colors[column] = fn
+}
+
+// print writes the table to stdout
+func (t *table) print() {
+	width, tty := terminalWidth()
+	t.render(os.Stdout, width, tty && colorEnabled())
+}
+
+func (t *table) render(w io.Writer, maxWidth int, colored bool) {
+	widths := make([]int, len(t.headers))
+	for i, h := range t.headers {
+		widths[i] = textWidth(h)
+	}
+	for _, row := range t.rows {
+		for i, cell := range row {
+			if i < len(widths) && textWidth(cell) > widths[i] {
+				widths[i] = textWidth(cell)
+			}
+		}
+	}
+
+	if maxWidth > 0 {
+		t.fit(widths, maxWidth)
+	}
+
+	t.writeRow(w, t.headers, widths, func(int, string) string {
+		if colored {
+			return colorBold
+		}
+		return ""
+	})
+	for _, row := range t.rows {
+		t.writeRow(w, row, widths, func(column int, value string) string {
+			if fn := t.colors[column]; colored && fn != nil {
+				return fn(value)
+			}
+			return ""
+		})
+	}
+}
+
+// fit shrinks the widest truncatable column until the table fits
+func (t *table) fit(widths []int, maxWidth int) {
+	total := func() int {
+		sum := len(columnGap) * (len(widths) - 1)
+		for _, w := range widths {
+			sum += w
+		}
+		return sum
+	}
+
+	for total() > maxWidth {
+		widest := -1
+		for c := range t.truncate {
+			if c < len(widths) && widths[c] > minTruncatedWidth && (widest < 0 || widths[c] > widths[widest]) {
+				widest = c
+			}
+		}
+		if widest < 0 {
+			return
+		}
+		widths[widest]--
+	}
+}
+
+func (t *table) writeRow(w io.Writer, cells []string, widths []int, color func(int, string) string) {
+	var b strings.Builder
+	for i, width := range widths {
+		value := ""
+		if i < len(cells) {
+			value = cells[i]
+		}
+		cell := truncateText(value, width)
+
+		if i > 0 {
+			b.WriteString(columnGap)
+		}
+		code := color(i, value)
+		if code != "" {
+			b.WriteString(code + cell + colorReset)
+		} else {
+			b.WriteString(cell)
+		}
+		// The last column isn't padded to avoid trailing spaces
+		if i < len(widths)-1 {
+			b.WriteString(strings.Repeat(" ", width-textWidth(cell)))
+		}
+	}
+	b.WriteString("\n")
+	io.WriteString(w, b.String())
+}
+
+func textWidth(s string) int {
+	return len([]rune(s))
+}
+
+// truncateText shortens text to width runes, ending with an ellipsis
+func truncateText(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	if width <= 1 {
+		return string(runes[:width])
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// colorEnabled reports whether colors are enabled by --no-color and
+// NO_COLOR (https://no-color.org)
+func colorEnabled() bool {
+	return !noColor && os.Getenv("NO_COLOR") == ""
+}
+
+// terminalWidth returns the width of the terminal stdout is connected to.
+// COLUMNS overrides it. Output that isn't a terminal isn't truncated.
+func terminalWidth() (int, bool) {
+	ws, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ)
+	tty := err == nil
+
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n, tty
+	}
+	if !tty {
+		return 0, false
+	}
+	return int(ws.Col), true
+}
+
+// statusColor colors process statuses
+func statusColor(status string) string {
+	switch status {
+	case "running":
+		return colorGreen
+	case "starting", "queued", "restarting", "stopping":
+		return colorYellow
+	case "errored", "crashed", "crash_looped":
+		return colorRed
+	case "stopped":
+		return colorGray
+	}
+	return ""
+}
+
+func healthColor(health string) string {
+	switch health {
+	case types.HealthHealthy:
+		return colorGreen
+	case types.HealthDegraded:
+		return colorYellow
+	case types.HealthUnhealthy:
+		return colorRed
+	}
+	return ""
+}
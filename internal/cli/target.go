@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+var targetOutput string
+
+var targetCmd = &cobra.Command{
+	Use:   "target",
+	Short: "Start and stop groups of processes",
+	Long: `Targets are named groups of processes defined under targets in the daemon
+config. Starting a target first starts the targets it requires and waits
+until their processes run; stopping one first stops the targets requiring
+it.`,
+}
+
+var targetListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List targets and the state of their processes",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateOutputFormat(targetOutput)
+
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		targets, err := client.Targets()
+		if err != nil {
+			exitWithError("Failed to list targets", err)
+		}
+		if printOutput(targetOutput, targets) {
+			return
+		}
+
+		if len(targets) == 0 {
+			fmt.Println("No targets")
+			return
+		}
+
+		t := newTable("TARGET", "STATUS", "RUNNING", "REQUIRES", "PROCESSES")
+		t.truncatable(4)
+		t.color(1, statusColor)
+		for _, target := range targets {
+			status := "stopped"
+			if target.Active {
+				status = "running"
+			} else if target.Running > 0 {
+				status = "partial"
+			}
+			t.row(target.Name, status, fmt.Sprintf("%d/%d", target.Running, len(target.Processes)),
+				joinOrDash(target.Requires), joinOrDash(target.Processes))
+		}
+		t.print()
+	},
+}
+
+var targetStartCmd = &cobra.Command{
+	Use:     "start <target>",
+	Short:   "Start a target after the targets it requires",
+	Example: `  gem target start staging-stack`,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runTargetAction(args[0], "start")
+	},
+}
+
+var targetStopCmd = &cobra.Command{
+	Use:   "stop <target>",
+	Short: "Stop a target after the targets requiring it",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runTargetAction(args[0], "stop")
+	},
+}
+
+// runTargetAction starts or stops a target and prints what happened to
+// each of its processes
+func runTargetAction(name, action string) {
+	validateOutputFormat(targetOutput)
+
+	client, err := NewClient()
+	if err != nil {
+		exitWithError("Failed to connect to daemon", err)
+	}
+
+	result, err := client.TargetAction(name, action)
+	if result != nil && !printOutput(targetOutput, result) {
+		printTargetResult(result)
+	}
+	if err != nil {
+		exitWithError(fmt.Sprintf("Failed to %s target %s", action, name), err)
+	}
+
+	for _, a := range result.Actions {
+		if a.Action == "failed" {
+			os.Exit(1)
+		}
+	}
+}
+
+func printTargetResult(result *types.TargetResult) {
+	if len(result.Actions) == 0 {
+		fmt.Printf("Nothing to do for target '%s'\n", result.Target)
+		return
+	}
+
+	t := newTable("TARGET", "PROCESS", "ACTION", "ERROR")
+	t.truncatable(3)
+	t.color(2, func(action string) string {
+		switch action {
+		case "started", "running":
+			return colorGreen
+		case "stopped":
+			return colorGray
+		case "failed":
+			return colorRed
+		}
+		return ""
+	})
+	for _, a := range result.Actions {
+		errText := a.Error
+		if errText == "" {
+			errText = "-"
+		}
+		t.row(a.Target, a.Process, a.Action, errText)
+	}
+	t.print()
+}
+
+func init() {
+	targetCmd.AddCommand(targetListCmd)
+	targetCmd.AddCommand(targetStartCmd)
+	targetCmd.AddCommand(targetStopCmd)
+
+	targetCmd.PersistentFlags().StringVarP(&targetOutput, "output", "o", "", outputFlagUsage)
+}
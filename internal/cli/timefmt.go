@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/config"
+)
+
+// defaultTimeFormat is the layout of timestamps in CLI output
+const defaultTimeFormat = "2006-01-02 15:04:05"
+
+var (
+	outputUTC  bool
+	timeFormat string
+)
+
+// timeFormats are the named formats accepted by --time-format. Anything
+// else is used as a Go time layout.
+var timeFormats = map[string]string{
+	"default":     defaultTimeFormat,
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"iso8601":     "2006-01-02T15:04:05.000Z07:00",
+}
+
+// loadTimeDefaults applies the time section of the config file to the
+// flags that weren't given
+func loadTimeDefaults(cmd *cobra.Command) {
+	cfg, err := config.Load(config.GetConfigPath())
+	if err != nil {
+		return
+	}
+
+	flags := cmd.Flags()
+	if !flags.Changed("utc") {
+		outputUTC = cfg.Time.UTC
+	}
+	if !flags.Changed("time-format") && cfg.Time.Format != "" {
+		timeFormat = cfg.Time.Format
+	}
+}
+
+// formatTime formats a timestamp for CLI output, in local time unless
+// --utc is given
+func formatTime(t time.Time) string {
+	if outputUTC {
+		t = t.UTC()
+	} else {
+		t = t.Local()
+	}
+
+	switch timeFormat {
+	case "":
+		return t.Format(defaultTimeFormat)
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	if layout, ok := timeFormats[timeFormat]; ok {
+		return t.Format(layout)
+	}
+	return t.Format(timeFormat)
+}
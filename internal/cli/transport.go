@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+)
+
+// Failed connection attempts are retried with backoff, e.g. while the
+// daemon restarts
+const (
+	connectAttempts = 4
+	connectBackoff  = 200 * time.Millisecond
+)
+
+// socketProbeTimeout bounds checking whether the daemon accepts
+// connections on its unix socket
+const socketProbeTimeout = 500 * time.Millisecond
+
+// socketHost is the host of API URLs sent over the unix socket
+const socketHost = "gemstone"
+
+// probeSocket reports whether the daemon accepts connections on the unix
+// socket at path. The error explains why it doesn't, nil if the socket
+// doesn't exist.
+func probeSocket(path string) (bool, error) {
+	abstract := config.IsAbstractSocket(path)
+	if !abstract {
+		if _, err := os.Stat(path); err != nil {
+			return false, nil
+		}
+	}
+
+	conn, err := net.DialTimeout("unix", path, socketProbeTimeout)
+	if err != nil {
+		// An abstract socket nobody listens on doesn't exist
+		if abstract {
+			return false, nil
+		}
+		return false, err
+	}
+	conn.Close()
+	return true, nil
+}
+
+// socketTransport sends requests over the unix socket at path
+func socketTransport(path string) *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}
+}
+
+// send sends a request with the given http client, retrying when the
+// connection can't be established. Such requests never reached the daemon,
+// so retrying is safe for every method.
+func (c *Client) send(httpClient *http.Client, req *http.Request) (*http.Response, error) {
+	backoff := connectBackoff
+	for attempt := 1; ; attempt++ {
+		resp, err := httpClient.Do(req)
+		if err == nil {
+			return resp, nil
+		}
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if attempt == connectAttempts || !isDialError(err) || isPermissionError(err) {
+			return nil, c.connectError(err)
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func isPermissionError(err error) bool {
+	return errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.EPERM)
+}
+
+// connectError wraps a connection failure with a hint on how to fix it
+func (c *Client) connectError(err error) error {
+	var hint string
+	switch {
+	case isPermissionError(err) || isPermissionError(c.socketErr):
+		hint = fmt.Sprintf("permission denied on %s: run as a user in api.socket allowed_uids or allowed_gids, or with sudo", c.socketPath)
+	case errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT):
+		hint = fmt.Sprintf("the daemon doesn't seem to be running (tried %s and %s), check 'systemctl status gemstone'", c.socketPath, c.address)
+	}
+
+	if hint == "" {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	return fmt.Errorf("failed to connect to daemon: %w\nHint: %s", err, hint)
+}
@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/systemd"
+	"github.com/PrismManager/gemstone/internal/types"
+	"github.com/PrismManager/gemstone/internal/update"
+)
+
+var (
+	selfUpdateCheck   bool
+	selfUpdateDaemon  string
+	selfUpdateUnit    string
+	selfUpdateTimeout time.Duration
+)
+
+// restartPollInterval is the time between checks whether the restarted
+// daemon is up
+const restartPollInterval = time.Second
+
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Update gem and the daemon to the latest release",
+	Long: `Look up the latest release and, if it is newer, download gem and
+gemstoned for this platform. The binaries are checked against SHA256SUMS of
+the release, whose Ed25519 signature must match update.public_key, before
+they replace the installed ones. The previous binaries are kept with an .old
+suffix.
+
+On systemd hosts the daemon unit is then restarted: the daemon stops its
+processes gracefully and the new one starts them again. If the new daemon
+doesn't answer within --timeout, the previous binaries are put back and the
+daemon is restarted on them.
+
+With --check only report whether a newer release is available.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load(config.GetConfigPath())
+		if err != nil {
+			exitWithError("Failed to load config", err)
+		}
+
+		ctx := context.Background()
+		rel, err := update.Latest(ctx, cfg.Update)
+		if err != nil {
+			exitWithError("Failed to check for updates", err)
+		}
+		if !update.Newer(rel.Version, version) {
+			fmt.Printf("Gemstone %s is up to date, the latest release is %s\n", version, rel.Version)
+			return
+		}
+		fmt.Printf("Gemstone %s is available, running %s\n", rel.Version, version)
+		if rel.Page != "" {
+			fmt.Printf("  %s\n", rel.Page)
+		}
+		if selfUpdateCheck {
+			return
+		}
+
+		sums, err := rel.Checksums(ctx, cfg.Update)
+		if err != nil {
+			exitWithError("Failed to verify the release", err)
+		}
+		fmt.Printf("Verified the signature of %s\n", update.ChecksumsAsset)
+
+		binaries, err := selfUpdateBinaries()
+		if err != nil {
+			exitWithError("Failed to find the installed binaries", err)
+		}
+
+		// Download everything before replacing anything
+		for _, b := range binaries {
+			name := update.AssetName(b.name)
+			if err := rel.Download(ctx, name, sums[name], b.path+".new"); err != nil {
+				for _, b := range binaries {
+					os.Remove(b.path + ".new")
+				}
+				exitWithError("Failed to download "+name, err)
+			}
+			fmt.Printf("Downloaded %s for %s\n", name, b.path)
+		}
+		for _, b := range binaries {
+			if err := installBinary(b.path); err != nil {
+				exitWithError("Failed to install "+b.path, err)
+			}
+		}
+		fmt.Printf("Installed gemstone %s\n", rel.Version)
+
+		if len(binaries) == 1 {
+			fmt.Println("gemstoned was not found next to gem, update the daemon separately")
+			return
+		}
+		restartUpdatedDaemon(binaries, rel.Version)
+	},
+}
+
+// selfUpdateBinary is an installed binary and the release asset it is
+// replaced with
+type selfUpdateBinary struct {
+	name string
+	path string
+}
+
+// selfUpdateBinaries returns the installed gem and, if found, gemstoned:
+// --daemon-binary, else the one next to gem or in PATH
+func selfUpdateBinaries() ([]selfUpdateBinary, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return nil, err
+	}
+	binaries := []selfUpdateBinary{{name: "gem", path: exe}}
+
+	daemon := selfUpdateDaemon
+	if daemon == "" {
+		daemon = filepath.Join(filepath.Dir(exe), "gemstoned")
+		if _, err := os.Stat(daemon); err != nil {
+			if daemon, err = exec.LookPath("gemstoned"); err != nil {
+				return binaries, nil
+			}
+		}
+	}
+	if daemon, err = filepath.EvalSymlinks(daemon); err != nil {
+		return nil, err
+	}
+	return append(binaries, selfUpdateBinary{name: "gemstoned", path: daemon}), nil
+}
+
+// installBinary replaces path with the downloaded path.new, keeping the
+// previous binary as path.old
+func installBinary(path string) error {
+	if err := os.Rename(path, path+".old"); err != nil {
+		os.Remove(path + ".new")
+		return err
+	}
+	if err := os.Rename(path+".new", path); err != nil {
+		os.Rename(path+".old", path)
+		return err
+	}
+	return nil
+}
+
+// rollbackBinaries puts the previous binaries back
+func rollbackBinaries(binaries []selfUpdateBinary) {
+	for _, b := range binaries {
+		if err := os.Rename(b.path+".old", b.path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to restore %s: %v\n", b.path, err)
+		}
+	}
+}
+
+// restartUpdatedDaemon restarts the daemon unit on the new binary and
+// waits for it to come back, rolling back if it doesn't
+func restartUpdatedDaemon(binaries []selfUpdateBinary, newVersion string) {
+	client, err := NewClient()
+	if err != nil {
+		fmt.Println("The daemon is not running, it runs the new version once started")
+		return
+	}
+	before, err := client.GetSystemInfo()
+	if err != nil {
+		fmt.Println("The daemon is not responding, it runs the new version once restarted")
+		return
+	}
+	if !systemd.Booted() {
+		fmt.Println("Restart the daemon to finish the upgrade; it stops and starts its processes")
+		return
+	}
+
+	fmt.Printf("Restarting %s, its processes are stopped gracefully and started again\n", selfUpdateUnit)
+	if err := systemd.RestartUnit(selfUpdateUnit); err != nil {
+		exitWithError("Failed to restart the daemon", err)
+	}
+	if info, ok := waitDaemonRestart(client, before.StartedAt); ok {
+		fmt.Printf("Daemon restarted, running version %s\n", info.Version)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "The daemon didn't come back within %s, rolling back\n", selfUpdateTimeout)
+	rollbackBinaries(binaries)
+	if err := systemd.RestartUnit(selfUpdateUnit); err != nil {
+		exitWithError("Failed to restart the daemon on the previous binaries", err)
+	}
+	exitWithError(fmt.Sprintf("Upgrade to %s rolled back", newVersion), nil)
+}
+
+// waitDaemonRestart waits until a daemon started after since answers
+func waitDaemonRestart(client *Client, since time.Time) (*types.DaemonInfo, bool) {
+	deadline := time.Now().Add(selfUpdateTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(restartPollInterval)
+		if info, err := client.GetSystemInfo(); err == nil && info.StartedAt.After(since) {
+			return info, true
+		}
+	}
+	return nil, false
+}
+
+func init() {
+	selfUpdateCmd.Flags().BoolVar(&selfUpdateCheck, "check", false, "Only report whether a newer release is available")
+	selfUpdateCmd.Flags().StringVar(&selfUpdateDaemon, "daemon-binary", "", "Path of the installed gemstoned (default next to gem, or in PATH)")
+	selfUpdateCmd.Flags().StringVar(&selfUpdateUnit, "unit", "gemstone.service", "systemd unit of the daemon")
+	selfUpdateCmd.Flags().DurationVar(&selfUpdateTimeout, "timeout", 2*time.Minute, "How long to wait for the restarted daemon before rolling back")
+}
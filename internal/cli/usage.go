@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	usageSince  string
+	usageUntil  string
+	usagePeriod string
+	usageBy     string
+	usageOutput string
+)
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Show resource consumption for chargeback",
+	Long: `Show the CPU seconds and memory byte-hours used per namespace, or per
+process with --by process, summed by hour, day, month or over the whole
+window. The daemon keeps 90 days of usage, including that of deleted
+processes. Use -o csv to export it for billing.`,
+	Example: `  gem usage --since 720h --period month
+  gem usage --by process --period total -o csv > usage.csv`,
+	Args: cobra.NoArgs,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if usageOutput != "csv" {
+			validateOutputFormat(usageOutput)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		query := url.Values{}
+		query.Set("period", usagePeriod)
+		query.Set("by", usageBy)
+		if usageSince != "" {
+			query.Set("since", usageSince)
+		}
+		if usageUntil != "" {
+			query.Set("until", usageUntil)
+		}
+
+		if usageOutput == "csv" {
+			if err := client.UsageCSV(query, os.Stdout); err != nil {
+				exitWithError("Failed to get usage", err)
+			}
+			return
+		}
+
+		records, err := client.Usage(query)
+		if err != nil {
+			exitWithError("Failed to get usage", err)
+		}
+
+		if printOutput(usageOutput, records) {
+			return
+		}
+
+		if len(records) == 0 {
+			fmt.Println("No usage recorded in this window")
+			return
+		}
+
+		headers := []string{"START", "END", "NAMESPACE", "CPU SECONDS", "MEMORY HOURS"}
+		if usageBy == "process" {
+			headers = []string{"START", "END", "NAMESPACE", "PROCESS", "CPU SECONDS", "MEMORY HOURS"}
+		}
+		t := newTable(headers...)
+		for _, r := range records {
+			cells := []interface{}{formatTime(r.Start), formatTime(r.End), r.Namespace}
+			if usageBy == "process" {
+				cells = append(cells, r.Process)
+			}
+			cells = append(cells, fmt.Sprintf("%.1f", r.CPUSeconds), formatBytes(uint64(r.MemoryByteHours))+"h")
+			t.row(cells...)
+		}
+		t.print()
+	},
+}
+
+func init() {
+	usageCmd.Flags().StringVar(&usageSince, "since", "", "Start of the window, RFC 3339 or a duration ago like 24h (default 720h)")
+	usageCmd.Flags().StringVar(&usageUntil, "until", "", "End of the window, RFC 3339 or a duration ago (default now)")
+	usageCmd.Flags().StringVar(&usagePeriod, "period", "day", "Sum usage by hour, day, month or total")
+	usageCmd.Flags().StringVar(&usageBy, "by", "namespace", "Group usage by namespace or process")
+	usageCmd.Flags().StringVarP(&usageOutput, "output", "o", "", "Output format: json, yaml, csv or jsonpath=TEMPLATE")
+}
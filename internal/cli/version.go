@@ -57,11 +57,87 @@ var daemonStatusCmd = &cobra.Command{
 
 		fmt.Printf("Daemon is running (version %s)\n", info.Version)
 		fmt.Printf("Managing %d processes\n", info.ProcessCount)
+		if info.Paused {
+			fmt.Println("Supervision is paused (resume with 'gem daemon resume')")
+		}
+		if info.Lockdown {
+			fmt.Println("The API is locked down (lift with 'gem daemon lockdown off')")
+		}
+		if info.UpdateAvailable != "" {
+			fmt.Printf("Version %s is available (update with 'gem self-update')\n", info.UpdateAvailable)
+		}
+	},
+}
+
+var daemonPauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Pause all automatic actions",
+	Long: `Freeze all automatic actions of the daemon, such as auto-restarts and
+auto-start, for incident response. Processes keep running, the API keeps
+serving and manual commands still work. The pause survives daemon restarts.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		setDaemonPaused(true)
+	},
+}
+
+var daemonResumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Resume automatic actions after a pause",
+	Run: func(cmd *cobra.Command, args []string) {
+		setDaemonPaused(false)
+	},
+}
+
+var daemonLockdownCmd = &cobra.Command{
+	Use:   "lockdown on|off",
+	Short: "Make the API read-only or lift the lockdown",
+	Long: `Lock the API down during incident freezes and maintenance windows. All
+endpoints making changes are refused, except for tokens with
+lockdown_override, while monitoring keeps working and the daemon keeps
+supervising. The lockdown survives daemon restarts.`,
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"on", "off"},
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		on := args[0] == "on"
+		if err := client.SetLockdown(on); err != nil {
+			exitWithError("Failed to update daemon", err)
+		}
+
+		if on {
+			fmt.Println("Lockdown on, the API is read-only")
+		} else {
+			fmt.Println("Lockdown lifted")
+		}
 	},
 }
 
+func setDaemonPaused(paused bool) {
+	client, err := NewClient()
+	if err != nil {
+		exitWithError("Failed to connect to daemon", err)
+	}
+
+	if err := client.SetPaused(paused); err != nil {
+		exitWithError("Failed to update daemon", err)
+	}
+
+	if paused {
+		fmt.Println("Supervision paused, automatic actions are frozen")
+	} else {
+		fmt.Println("Supervision resumed")
+	}
+}
+
 func init() {
 	daemonCmd.AddCommand(daemonStartCmd)
 	daemonCmd.AddCommand(daemonStopCmd)
 	daemonCmd.AddCommand(daemonStatusCmd)
+	daemonCmd.AddCommand(daemonPauseCmd)
+	daemonCmd.AddCommand(daemonResumeCmd)
+	daemonCmd.AddCommand(daemonLockdownCmd)
 }
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+var (
+	waitFor     string
+	waitTimeout time.Duration
+)
+
+// waitConditions are the states gem wait can wait for
+var waitConditions = map[string]func(*types.ProcessInfo) bool{
+	"running": func(info *types.ProcessInfo) bool {
+		return info.Status == types.StatusRunning
+	},
+	"stopped": func(info *types.ProcessInfo) bool {
+		return info.Status == types.StatusStopped || info.Status == types.StatusErrored || info.Status == types.StatusCrashLooped
+	},
+	"healthy": func(info *types.ProcessInfo) bool {
+		if r := info.Report; r != nil && r.Health != "" && r.Health != types.HealthHealthy {
+			return false
+		}
+		return info.Status == types.StatusRunning && !info.Throttled
+	},
+	"ready": func(info *types.ProcessInfo) bool {
+		return info.Status == types.StatusRunning && info.Report != nil && info.Report.Ready
+	},
+}
+
+var waitCmd = &cobra.Command{
+	Use:   "wait <name|id>",
+	Short: "Wait until a process reaches a state",
+	Long: `Block until a process reaches a state, for sequencing deployment scripts.
+
+  running  the process is running (past any readiness gate)
+  stopped  the process is stopped or errored
+  healthy  the process is running, not throttled by its soft limits and
+           did not report itself degraded or unhealthy
+  ready    the process reported READY=1 on the notify socket
+
+The command exits with status 1 when the timeout passes first, or when the
+process errors while waiting for running, healthy or ready.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		reached, ok := waitConditions[waitFor]
+		if !ok {
+			exitWithError(fmt.Sprintf("invalid --for %q: must be running, stopped, healthy or ready", waitFor), nil)
+		}
+
+		client, err := NewClient()
+		if err != nil {
+			exitWithError("Failed to connect to daemon", err)
+		}
+
+		ctx := context.Background()
+		if waitTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, waitTimeout)
+			defer cancel()
+		}
+
+		info, err := waitForState(ctx, client, args[0], reached, waitFor != "stopped")
+		if err == context.DeadlineExceeded {
+			fmt.Fprintf(os.Stderr, "Error: timed out after %s waiting for '%s' to be %s (status: %s)\n",
+				waitTimeout, args[0], waitFor, info.Status)
+			os.Exit(1)
+		}
+		if err != nil {
+			exitWithError("Failed to wait for process", err)
+		}
+
+		fmt.Printf("Process '%s' is %s\n", info.Name, waitFor)
+	},
+}
+
+// waitForState returns once the process satisfies reached, or fails when it
+// errors and failOnError is set. The state is checked again on every event
+// of the process. The stream starts with the latest event, so a change
+// between the first check and subscribing isn't missed.
+func waitForState(ctx context.Context, client *Client, idOrName string, reached func(*types.ProcessInfo) bool, failOnError bool) (*types.ProcessInfo, error) {
+	info, err := client.Get(idOrName)
+	if err != nil {
+		return nil, err
+	}
+	if reached(info) {
+		return info, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := make(chan struct{}, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.FollowEvents(ctx, info.ID, 1, nil, func(types.Event) {
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		})
+	}()
+
+	for {
+		select {
+		case <-events:
+			current, err := client.Get(info.ID)
+			if err != nil {
+				return info, err
+			}
+			info = current
+			if reached(info) {
+				return info, nil
+			}
+			if failOnError && info.Status == types.StatusErrored {
+				return info, fmt.Errorf("process '%s' errored", info.Name)
+			}
+			if failOnError && info.Status == types.StatusCrashLooped {
+				return info, fmt.Errorf("process '%s' is crash-looping", info.Name)
+			}
+		case err := <-done:
+			return info, err
+		}
+	}
+}
+
+func init() {
+	waitCmd.Flags().StringVar(&waitFor, "for", "running", "State to wait for: running, stopped, healthy or ready")
+	waitCmd.Flags().DurationVar(&waitTimeout, "timeout", 60*time.Second, "Maximum time to wait (0 to wait forever)")
+}
@@ -1,8 +1,14 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -20,22 +26,378 @@ const (
 	DefaultAPIPort = 9876
 	// DefaultSocketPath is the default Unix socket path
 	DefaultSocketPath = "/run/gemstone/gemstone.sock"
+	// DefaultShutdownTimeout is the default shutdown deadline in seconds
+	DefaultShutdownTimeout = 30
+	// DefaultNamespace is the namespace of processes that don't set one
+	DefaultNamespace = "default"
 )
 
 // Config represents the main configuration
 type Config struct {
-	API       APIConfig `yaml:"api"`
-	Logging   LogConfig `yaml:"logging"`
-	Processes []Process `yaml:"processes,omitempty"`
+	Daemon     DaemonConfig      `yaml:"daemon"`
+	API        APIConfig         `yaml:"api"`
+	Logging    LogConfig         `yaml:"logging"`
+	Namespaces []NamespaceConfig `yaml:"namespaces,omitempty"`
+	Targets    []TargetConfig    `yaml:"targets,omitempty"`
+	Groups     []RestartGroup    `yaml:"restart_groups,omitempty"`
+	Plugins    PluginsConfig     `yaml:"plugins"`
+	Hooks      HooksConfig       `yaml:"hooks,omitempty"`
+	Time       TimeConfig        `yaml:"time,omitempty"`
+	Stats      StatsConfig       `yaml:"stats"`
+	Secrets    SecretsConfig     `yaml:"secrets,omitempty"`
+	Retention  RetentionConfig   `yaml:"retention,omitempty"`
+	Systemd    SystemdConfig     `yaml:"systemd,omitempty"`
+	Admission  AdmissionConfig   `yaml:"admission,omitempty"`
+	StartQueue StartQueueConfig  `yaml:"start_queue,omitempty"`
+	Update     UpdateConfig      `yaml:"update,omitempty"`
+	Processes  []Process         `yaml:"processes,omitempty"`
+
+	// path is the file the config was loaded from and file the values set
+	// in it, to tell them apart from defaults
+	path string
+	file map[string]interface{}
+}
+
+// PluginsConfig represents plugin settings. Every executable in the
+// directory is started as a plugin speaking JSON over stdio, as the daemon
+// user, so plugins are off unless enabled.
+type PluginsConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Directory string `yaml:"directory"`
+}
+
+// RetentionConfig removes process definitions that are no longer used.
+// Processes stopped for longer than Stopped, and processes that exited with
+// 0 on their own longer than Completed ago, are deleted, or with the
+// "archive" action saved to the archive directory first. Empty durations
+// keep processes forever.
+type RetentionConfig struct {
+	Stopped   string `yaml:"stopped,omitempty"`   // e.g. "720h"
+	Completed string `yaml:"completed,omitempty"` // e.g. "168h"
+	Action    string `yaml:"action,omitempty"`    // "delete" (default) or "archive"
+}
+
+// SystemdConfig integrates processes with systemd. With Scope set every
+// process runs in a transient scope unit of its own, so systemd-cgls and
+// systemctl show it and resource control follows systemd's hierarchy.
+type SystemdConfig struct {
+	Scope bool `yaml:"scope,omitempty"`
+	// Slice places the scopes below a slice, e.g. "gemstone.slice"
+	Slice string `yaml:"slice,omitempty"`
+}
+
+// AdmissionConfig checks the CPU and memory reservations of processes
+// against the host's capacity before they start. With mode "warn" starts
+// that would overcommit the host are logged, with "enforce" they are
+// refused; empty disables admission control.
+type AdmissionConfig struct {
+	Mode   string  `yaml:"mode,omitempty"`
+	CPU    float64 `yaml:"cpu,omitempty"`    // cores, default the host's
+	Memory int     `yaml:"memory,omitempty"` // MB, default the host's
+}
+
+// StartQueueConfig limits how many processes start at the same time. The
+// others are queued until a process started before them reports ready,
+// exits or was starting for Hold.
+type StartQueueConfig struct {
+	Concurrency int    `yaml:"concurrency,omitempty"` // 0 for no limit
+	Hold        string `yaml:"hold,omitempty"`        // default "10s"
+}
+
+// UpdateConfig represents where new releases are looked up and the key
+// their checksums must be signed with
+type UpdateConfig struct {
+	// URL is the release endpoint, by default the latest GitHub release
+	URL string `yaml:"url,omitempty"`
+	// PublicKey is the base64 Ed25519 key SHA256SUMS is signed with,
+	// required to update
+	PublicKey string `yaml:"public_key,omitempty"`
+	// Check makes the daemon look for a new release once a day
+	Check bool `yaml:"check,omitempty"`
+}
+
+// SecretsConfig represents the stores that vault:// and awsssm:// environment
+// values are resolved from when a process starts
+type SecretsConfig struct {
+	// CacheTTL is how long a resolved secret is reused, "0s" disables the
+	// cache
+	CacheTTL string      `yaml:"cache_ttl,omitempty"`
+	Vault    VaultConfig `yaml:"vault,omitempty"`
+	AWS      AWSConfig   `yaml:"aws,omitempty"`
+}
+
+// VaultConfig represents a HashiCorp Vault server. Empty values fall back to
+// VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE.
+type VaultConfig struct {
+	Address string `yaml:"address,omitempty"`
+	Token   string `yaml:"token,omitempty"`
+	// TokenFile is read on every request, e.g. the sink of a Vault agent
+	TokenFile string `yaml:"token_file,omitempty"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// AWSConfig represents the AWS region and endpoint of SSM Parameter Store.
+// Credentials come from the environment or the EC2 instance role.
+type AWSConfig struct {
+	Region   string `yaml:"region,omitempty"`
+	Endpoint string `yaml:"endpoint,omitempty"`
+}
+
+// HooksConfig represents daemon-level event handlers. Each handler is a
+// shell command receiving the event as JSON on stdin.
+type HooksConfig struct {
+	OnStart     string `yaml:"on_start,omitempty"`
+	OnStop      string `yaml:"on_stop,omitempty"`
+	OnCrash     string `yaml:"on_crash,omitempty"`
+	OnRestart   string `yaml:"on_restart,omitempty"`
+	OnLogQuota  string `yaml:"on_log_quota,omitempty"`
+	OnThrottle  string `yaml:"on_throttle,omitempty"`
+	OnDiskAlert string `yaml:"on_disk_alert,omitempty"`
+	OnPortDown  string `yaml:"on_port_down,omitempty"`
+	OnNoOutput  string `yaml:"on_no_output,omitempty"`
+	OnDeploy    string `yaml:"on_deploy,omitempty"`
+	OnCrashLoop string `yaml:"on_crash_loop,omitempty"`
+	// Timeout is how long a handler may run before it is killed, in seconds
+	Timeout int `yaml:"timeout,omitempty"`
+}
+
+// Handler returns the handler command for an event type, or "" if none is
+// configured
+func (h HooksConfig) Handler(eventType string) string {
+	switch eventType {
+	case "start":
+		return h.OnStart
+	case "stop":
+		return h.OnStop
+	case "crash":
+		return h.OnCrash
+	case "restart":
+		return h.OnRestart
+	case "log_quota":
+		return h.OnLogQuota
+	case "throttle":
+		return h.OnThrottle
+	case "disk_alert":
+		return h.OnDiskAlert
+	case "port_down":
+		return h.OnPortDown
+	case "no_output":
+		return h.OnNoOutput
+	case "deploy":
+		return h.OnDeploy
+	case "crash_loop":
+		return h.OnCrashLoop
+	}
+	return ""
+}
+
+// NamespaceConfig represents ownership and quotas of a namespace
+type NamespaceConfig struct {
+	Name string `yaml:"name"`
+	// Owners lists the identities owning the namespace: token names,
+	// "uid:<n>" for unix socket peers or "jwt:<subject>". An identity that
+	// owns any namespace can only see and control processes in the
+	// namespaces it owns.
+	Owners   []string `yaml:"owners"`
+	LogQuota int      `yaml:"log_quota,omitempty"` // MB
+	// StartConcurrency is how many processes of the namespace may start at
+	// the same time, 0 for no limit
+	StartConcurrency int `yaml:"start_concurrency,omitempty"`
+	// RunAs and RunAsGroup are the user and group the processes the owners
+	// start run as, whatever they ask for. Without RunAs the owners can't
+	// start processes.
+	RunAs      string `yaml:"run_as,omitempty"`
+	RunAsGroup string `yaml:"run_as_group,omitempty"`
+}
+
+// TargetConfig is a named group of processes brought up and down together
+type TargetConfig struct {
+	Name string `yaml:"name"`
+	// Processes are process names or globs like 'api-*'
+	Processes []string `yaml:"processes"`
+	// Requires lists the targets started before this one and stopped
+	// after it
+	Requires []string `yaml:"requires,omitempty"`
+}
+
+// RestartGroup is a named group of processes restarted together, like an
+// app and its sidecar cache: all running members are stopped, the last one
+// first, and then all are started in the listed order
+type RestartGroup struct {
+	Name string `yaml:"name"`
+	// Processes are process names or globs like 'api-*', each started once
+	// the ones before it run
+	Processes []string `yaml:"processes"`
+	// RestartOnCrash restarts the whole group when a member crashes and
+	// would be restarted, instead of only that member
+	RestartOnCrash bool `yaml:"restart_on_crash,omitempty"`
+}
+
+// DaemonConfig represents settings of the daemon itself
+type DaemonConfig struct {
+	// ShutdownTimeout is how long shutdown waits for API requests to
+	// drain and processes to stop, in seconds
+	ShutdownTimeout int `yaml:"shutdown_timeout"`
+	// Limits bound the resources of the daemon itself
+	Limits DaemonLimitsConfig `yaml:"limits"`
+	// CrashLoopCooldown is how long a crash-looped process waits before
+	// its restart budget is reset and it is started again, e.g. "30m".
+	// Empty leaves it down until it is started by hand.
+	CrashLoopCooldown string `yaml:"crash_loop_cooldown,omitempty"`
+}
+
+// DaemonLimitsConfig bounds the resources of the daemon itself so it stays
+// stable on small machines. GOMAXPROCS 0 follows the CPU quota of the
+// daemon's cgroup. MaxRSS in MB makes the garbage collector work harder near
+// it and warns beyond it, 0 disables it. MaxOpenLogFiles 0 allows half the
+// open file limit. MaxStreams caps concurrent follow, watch and NDJSON
+// requests, 0 disables it.
+type DaemonLimitsConfig struct {
+	GOMAXPROCS      int `yaml:"gomaxprocs"`
+	MaxRSS          int `yaml:"max_rss"`
+	MaxOpenLogFiles int `yaml:"max_open_log_files"`
+	MaxStreams      int `yaml:"max_streams"`
 }
 
 // APIConfig represents API configuration
 type APIConfig struct {
-	Enabled    bool   `yaml:"enabled"`
-	Port       int    `yaml:"port"`
-	Host       string `yaml:"host"`
-	AuthToken  string `yaml:"auth_token,omitempty"`
-	EnableCORS bool   `yaml:"enable_cors"`
+	Enabled bool   `yaml:"enabled"`
+	Port    int    `yaml:"port"`
+	Host    string `yaml:"host"`
+	// Listen replaces host and port with a list of listen addresses, each
+	// with its own TLS settings
+	Listen    []ListenConfig `yaml:"listen,omitempty"`
+	AuthToken string         `yaml:"auth_token,omitempty"`
+	// Tokens are additional named static tokens
+	Tokens     []TokenConfig `yaml:"tokens,omitempty"`
+	EnableCORS bool          `yaml:"enable_cors"`
+	AccessLog  bool          `yaml:"access_log"`
+	// Socket controls access to the API over the unix socket
+	Socket SocketConfig `yaml:"socket"`
+	// Sockets are additional unix sockets, e.g. a read-only one for a
+	// monitoring group next to an admin socket only root can open
+	Sockets []SocketConfig `yaml:"sockets,omitempty"`
+	// OIDC enables JWTs from an external identity provider in addition
+	// to the static auth token
+	OIDC OIDCConfig `yaml:"oidc,omitempty"`
+	// InstanceID names the daemon in every response. If empty, an ID is
+	// generated once and kept in the data directory.
+	InstanceID string `yaml:"instance_id,omitempty"`
+	// BasePath is a path prefix the API is served under, e.g. "/gemstone"
+	// behind a reverse proxy routing by path
+	BasePath string `yaml:"base_path,omitempty"`
+}
+
+// ListenConfig represents an API listen address
+type ListenConfig struct {
+	Address string    `yaml:"address"` // host:port, IPv6 hosts in brackets
+	TLS     TLSConfig `yaml:"tls,omitempty"`
+}
+
+// TLSConfig represents TLS settings of a listen address
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+	// ClientCAFile enables mutual TLS, requiring client certificates
+	// signed by one of the CAs in the file
+	ClientCAFile string `yaml:"client_ca_file,omitempty"`
+}
+
+// Enabled reports whether TLS is configured
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// ListenAddresses returns the configured listen addresses, falling back to
+// host and port
+func (a APIConfig) ListenAddresses() []ListenConfig {
+	if len(a.Listen) > 0 {
+		return a.Listen
+	}
+	return []ListenConfig{{Address: net.JoinHostPort(a.Host, strconv.Itoa(a.Port))}}
+}
+
+// Prefix returns the base path with a leading and without a trailing
+// slash, empty if the API is served at the root
+func (a APIConfig) Prefix() string {
+	p := strings.Trim(a.BasePath, "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// TokenConfig represents a named static API token
+type TokenConfig struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	Role  string `yaml:"role,omitempty"` // admin (default) or viewer
+	// LockdownOverride lets an admin token make changes during a lockdown
+	LockdownOverride bool `yaml:"lockdown_override,omitempty"`
+}
+
+// SocketConfig represents unix socket access settings. Local users in the
+// allowlists (and the daemon's own user) need no token on the socket; all
+// other local users are denied unless they present one. On additional
+// sockets without allowlists, every user who can open the socket is let in,
+// as its mode and group already decide who can.
+type SocketConfig struct {
+	// Path is where an additional socket listens, the main socket's comes
+	// from GEMSTONE_SOCKET. A leading @ selects the abstract namespace
+	// (Linux), which has no permissions.
+	Path        string   `yaml:"path,omitempty"`
+	Mode        string   `yaml:"mode"` // octal permission bits
+	Group       string   `yaml:"group,omitempty"`
+	AllowedUIDs []uint32 `yaml:"allowed_uids"`
+	AllowedGIDs []uint32 `yaml:"allowed_gids,omitempty"`
+	// Role is granted to users let in without a token, admin (default) or
+	// viewer
+	Role string `yaml:"role,omitempty"`
+}
+
+// IsAbstractSocket reports whether a socket path is in the abstract
+// namespace
+func IsAbstractSocket(path string) bool {
+	return strings.HasPrefix(path, "@")
+}
+
+// OIDCConfig represents JWT validation settings for an identity provider
+type OIDCConfig struct {
+	Issuer   string `yaml:"issuer,omitempty"`
+	Audience string `yaml:"audience,omitempty"`
+	JWKSURL  string `yaml:"jwks_url,omitempty"`
+	// RoleClaim is the claim holding the user's roles or groups
+	RoleClaim string `yaml:"role_claim,omitempty"`
+	// RoleMapping maps claim values to gemstone roles (admin, viewer)
+	RoleMapping map[string]string `yaml:"role_mapping,omitempty"`
+}
+
+// Enabled reports whether JWT validation is configured
+func (o OIDCConfig) Enabled() bool {
+	return o.JWKSURL != ""
+}
+
+// validate rejects an enabled provider that would accept tokens issued for
+// another service or grant roles the configuration doesn't name
+func (o OIDCConfig) validate() error {
+	if !o.Enabled() {
+		return nil
+	}
+	if o.Issuer == "" {
+		return errors.New("api.oidc: issuer is required with jwks_url")
+	}
+	if o.Audience == "" {
+		return errors.New("api.oidc: audience is required with jwks_url")
+	}
+	if len(o.RoleMapping) == 0 {
+		return errors.New("api.oidc: role_mapping is required with jwks_url")
+	}
+	for value, role := range o.RoleMapping {
+		if role != "admin" && role != "viewer" {
+			return fmt.Errorf("api.oidc: role_mapping %q maps to unknown role %q", value, role)
+		}
+	}
+	return nil
 }
 
 // LogConfig represents logging configuration
@@ -45,31 +407,237 @@ type LogConfig struct {
 	MaxAge     int    `yaml:"max_age"`     // Max age in days
 	Compress   bool   `yaml:"compress"`
 	Directory  string `yaml:"directory"`
+	// MaxTotalSize is the budget in MB for the whole log directory. When
+	// exceeded, the oldest rotated files are deleted. 0 disables the quota.
+	MaxTotalSize int `yaml:"max_total_size"`
+	// Buffer sets how captured lines are written to the log files
+	Buffer LogBufferConfig `yaml:"buffer"`
+	// Archive uploads rotated log files to object storage
+	Archive LogArchiveConfig `yaml:"archive,omitempty"`
+	// Redact masks secrets and personal data in captured lines before they
+	// are written or served
+	Redact []RedactRule `yaml:"redact,omitempty"`
+}
+
+// RedactRule masks the matches of Pattern, a regular expression, or of a
+// built-in Preset: email, ipv4, bearer, jwt or aws_access_key. Mask
+// replaces them, "[REDACTED]" if empty, and may refer to groups of the
+// pattern as ${1}.
+type RedactRule struct {
+	Pattern string `yaml:"pattern,omitempty"`
+	Preset  string `yaml:"preset,omitempty"`
+	Mask    string `yaml:"mask,omitempty"`
+}
+
+// LogArchiveConfig sets where rotated log files are uploaded. Archival is
+// enabled by setting a bucket. Key is a layout with the placeholders {host},
+// {namespace}, {name}, {id}, {file}, {date}, {year}, {month} and {day}.
+// Endpoint selects an S3-compatible service, addressed with path-style
+// URLs. Uploaded files are deleted locally unless KeepLocal is set.
+type LogArchiveConfig struct {
+	Bucket    string `yaml:"bucket,omitempty"`
+	Region    string `yaml:"region,omitempty"`
+	Endpoint  string `yaml:"endpoint,omitempty"`
+	Key       string `yaml:"key,omitempty"`
+	Interval  string `yaml:"interval,omitempty"` // e.g. "5m"
+	KeepLocal bool   `yaml:"keep_local,omitempty"`
+}
+
+// Enabled reports whether log archival is configured
+func (a LogArchiveConfig) Enabled() bool {
+	return a.Bucket != ""
+}
+
+// LogBufferConfig sets how log lines are buffered. Lines are written at
+// least every FlushInterval, or once SizeKB of them are pending for a file.
+// An empty FlushInterval writes every line as it is captured. With Fsync
+// the files are synced after every write.
+type LogBufferConfig struct {
+	FlushInterval string `yaml:"flush_interval"` // e.g. "500ms"
+	SizeKB        int    `yaml:"size_kb"`
+	Fsync         bool   `yaml:"fsync"`
+}
+
+// TimeConfig sets how timestamps are shown. With UTC set the daemon also
+// logs and reports times in UTC. Format is the default of gem --time-format.
+type TimeConfig struct {
+	UTC    bool   `yaml:"utc"`
+	Format string `yaml:"format,omitempty"`
+}
+
+// StatsConfig sets how long the stats history of processes is kept.
+// Every sample, taken each 10 seconds, is kept for Retention. Older samples
+// are averaged into the tiers of Downsample, each kept up to its retention
+// counted from now, then dropped.
+//
+// Each tier keeps as many samples as fit in its retention, at most
+// MaxSamples if set. SystemHistory is the number of system stats samples
+// kept.
+type StatsConfig struct {
+	Retention     string             `yaml:"retention"`
+	Downsample    []DownsampleConfig `yaml:"downsample"`
+	MaxSamples    int                `yaml:"max_samples,omitempty"`
+	SystemHistory int                `yaml:"system_history"`
+}
+
+// DownsampleConfig represents a tier of downsampled stats
+type DownsampleConfig struct {
+	Resolution string `yaml:"resolution"` // e.g. "5m"
+	Retention  string `yaml:"retention"`  // e.g. "720h"
 }
 
 // Process represents a managed process configuration
 type Process struct {
-	ID          string            `yaml:"id"`
-	Name        string            `yaml:"name"`
-	Command     string            `yaml:"command"`
-	Args        []string          `yaml:"args,omitempty"`
-	WorkDir     string            `yaml:"work_dir,omitempty"`
-	Env         map[string]string `yaml:"env,omitempty"`
-	AutoStart   bool              `yaml:"auto_start"`
-	AutoRestart bool              `yaml:"auto_restart"`
-	MaxRestarts int               `yaml:"max_restarts"`
-	User        string            `yaml:"user,omitempty"`
-	Group       string            `yaml:"group,omitempty"`
+	ID                    string                `yaml:"id"`
+	Name                  string                `yaml:"name"`
+	Description           string                `yaml:"description,omitempty"`
+	Homepage              string                `yaml:"homepage,omitempty"`
+	OwnerContact          string                `yaml:"owner_contact,omitempty"`
+	Command               string                `yaml:"command"`
+	Args                  []string              `yaml:"args,omitempty"`
+	WorkDir               string                `yaml:"work_dir,omitempty"`
+	Stdin                 string                `yaml:"stdin,omitempty"`
+	Env                   map[string]string     `yaml:"env,omitempty"`
+	AutoStart             bool                  `yaml:"auto_start"`
+	AutoRestart           bool                  `yaml:"auto_restart"`
+	MaxRestarts           int                   `yaml:"max_restarts"`
+	User                  string                `yaml:"user,omitempty"`
+	Group                 string                `yaml:"group,omitempty"`
+	Timezone              string                `yaml:"timezone,omitempty"`
+	Locale                string                `yaml:"locale,omitempty"`
+	OutputEncoding        string                `yaml:"output_encoding,omitempty"`
+	Namespace             string                `yaml:"namespace,omitempty"`
+	LogPipe               string                `yaml:"log_pipe,omitempty"`
+	LogQuota              int                   `yaml:"log_quota,omitempty"` // MB
+	RestartPolicy         string                `yaml:"restart_policy,omitempty"`
+	MaxUptime             string                `yaml:"max_uptime,omitempty"`
+	Schedule              string                `yaml:"schedule,omitempty"`
+	RestartOnBinaryChange bool                  `yaml:"restart_on_binary_change,omitempty"`
+	WaitFor               *WaitForConfig        `yaml:"wait_for,omitempty"`
+	SoftLimits            *SoftLimitsConfig     `yaml:"soft_limits,omitempty"`
+	Reserve               *ReservationConfig    `yaml:"reserve,omitempty"`
+	OOMScoreAdj           int                   `yaml:"oom_score_adj,omitempty"`
+	Capabilities          *CapabilitiesConfig   `yaml:"capabilities,omitempty"`
+	Seccomp               string                `yaml:"seccomp,omitempty"`
+	AppArmorProfile       string                `yaml:"apparmor_profile,omitempty"`
+	SELinuxLabel          string                `yaml:"selinux_label,omitempty"`
+	Network               *NetworkConfig        `yaml:"network,omitempty"`
+	MonitorPaths          []string              `yaml:"monitor_paths,omitempty"`
+	DiskAlert             int                   `yaml:"disk_alert,omitempty"` // MB
+	Ports                 []string              `yaml:"ports,omitempty"`
+	OutputWatchdog        *OutputWatchdogConfig `yaml:"output_watchdog,omitempty"`
+	Standby               *StandbyConfig        `yaml:"standby,omitempty"`
+	Fetch                 *FetchConfig          `yaml:"fetch,omitempty"`
+	Source                *SourceConfig         `yaml:"source,omitempty"`
+	Generation            int                   `yaml:"generation,omitempty"`
+	StoppedAt             *time.Time            `yaml:"stopped_at,omitempty"`
+	LastExit              *LastExitConfig       `yaml:"last_exit,omitempty"`
+	CrashLoopedAt         *time.Time            `yaml:"crash_looped_at,omitempty"`
+	Binary                *BinaryConfig         `yaml:"binary,omitempty"`
+}
+
+// BinaryConfig represents the command binary of the last start, kept
+// across daemon restarts
+type BinaryConfig struct {
+	Path    string    `yaml:"path"`
+	SHA256  string    `yaml:"sha256"`
+	ModTime time.Time `yaml:"mod_time"`
+}
+
+// LastExitConfig represents the last exit of a process, kept across daemon
+// restarts
+type LastExitConfig struct {
+	Code   int       `yaml:"code"`
+	Signal string    `yaml:"signal,omitempty"`
+	Reason string    `yaml:"reason"`
+	Detail string    `yaml:"detail,omitempty"`
+	Time   time.Time `yaml:"time"`
+}
+
+// WaitForConfig represents a readiness gate a process waits for before it is
+// started
+type WaitForConfig struct {
+	TCP     string `yaml:"tcp"`
+	Timeout string `yaml:"timeout,omitempty"`
+}
+
+// FetchConfig represents a script downloaded from a URL and verified against
+// its checksum
+type FetchConfig struct {
+	URL    string `yaml:"url"`
+	SHA256 string `yaml:"sha256"`
+}
+
+// SourceConfig represents a git repository checked out as the working
+// directory of a process
+type SourceConfig struct {
+	Git string `yaml:"git"`
+	Ref string `yaml:"ref,omitempty"`
+}
+
+// OutputWatchdogConfig represents how long a process may go without output
+type OutputWatchdogConfig struct {
+	Timeout string `yaml:"timeout"`
+	Restart bool   `yaml:"restart,omitempty"`
+}
+
+// StandbyConfig represents the warm standby of a process
+type StandbyConfig struct {
+	Warmup string `yaml:"warmup,omitempty"`
+}
+
+// SoftLimitsConfig represents resource usage at which a process is
+// throttled instead of restarted
+type SoftLimitsConfig struct {
+	CPUPercent  float64 `yaml:"cpu_percent,omitempty"`
+	CPUAction   string  `yaml:"cpu_action,omitempty"`
+	CPUThrottle float64 `yaml:"cpu_throttle,omitempty"`
+	CPUWeight   int     `yaml:"cpu_weight,omitempty"`
+	ThrottleFor string  `yaml:"throttle_for,omitempty"`
+	MemoryHigh  int     `yaml:"memory_high,omitempty"` // MB
+}
+
+// ReservationConfig represents the CPU and memory a process is expected to
+// use
+type ReservationConfig struct {
+	CPU    float64 `yaml:"cpu,omitempty"`    // cores
+	Memory int     `yaml:"memory,omitempty"` // MB
+}
+
+// CapabilitiesConfig represents the capabilities a process keeps or drops
+type CapabilitiesConfig struct {
+	Keep []string `yaml:"keep,omitempty"`
+	Drop []string `yaml:"drop,omitempty"`
+}
+
+// NetworkConfig represents the network setup of a process
+type NetworkConfig struct {
+	Mode    string   `yaml:"mode,omitempty"`
+	Publish []string `yaml:"publish,omitempty"`
 }
 
 // DefaultConfig returns a default configuration
 func DefaultConfig() *Config {
 	return &Config{
+		Daemon: DaemonConfig{
+			ShutdownTimeout: DefaultShutdownTimeout,
+			Limits: DaemonLimitsConfig{
+				MaxStreams: 256,
+			},
+		},
 		API: APIConfig{
 			Enabled:    true,
 			Port:       DefaultAPIPort,
 			Host:       "127.0.0.1",
 			EnableCORS: false,
+			AccessLog:  true,
+			Socket: SocketConfig{
+				Mode:        "0660",
+				AllowedUIDs: []uint32{0},
+			},
+		},
+		Plugins: PluginsConfig{
+			Directory: filepath.Join(DefaultConfigDir, "plugins"),
 		},
 		Logging: LogConfig{
 			MaxSize:    10,
@@ -77,13 +645,55 @@ func DefaultConfig() *Config {
 			MaxAge:     30,
 			Compress:   true,
 			Directory:  DefaultLogDir,
+			Buffer: LogBufferConfig{
+				FlushInterval: "500ms",
+				SizeKB:        64,
+			},
 		},
+		Stats: StatsConfig{
+			Retention: "3h",
+			Downsample: []DownsampleConfig{
+				{Resolution: "5m", Retention: "24h"},
+				{Resolution: "1h", Retention: "720h"},
+			},
+			SystemHistory: 1000,
+		},
+	}
+}
+
+// OwnedNamespaces returns the namespaces owned by an identity, or nil if it
+// doesn't own any and is therefore not restricted to namespaces
+func (c *Config) OwnedNamespaces(identity string) []string {
+	if identity == "" {
+		return nil
+	}
+
+	var owned []string
+	for _, ns := range c.Namespaces {
+		for _, owner := range ns.Owners {
+			if owner == identity {
+				owned = append(owned, ns.Name)
+				break
+			}
+		}
+	}
+	return owned
+}
+
+// Namespace returns the configuration of a namespace, or nil
+func (c *Config) Namespace(name string) *NamespaceConfig {
+	for i := range c.Namespaces {
+		if c.Namespaces[i].Name == name {
+			return &c.Namespaces[i]
+		}
 	}
+	return nil
 }
 
 // Load loads configuration from file
 func Load(path string) (*Config, error) {
 	cfg := DefaultConfig()
+	cfg.path = path
 
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -96,6 +706,17 @@ func Load(path string) (*Config, error) {
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, err
 	}
+	if err := yaml.Unmarshal(data, &cfg.file); err != nil {
+		return nil, err
+	}
+	if err := cfg.API.OIDC.validate(); err != nil {
+		return nil, err
+	}
+	for _, ns := range cfg.Namespaces {
+		if ns.RunAs == "root" || ns.RunAs == "0" {
+			return nil, fmt.Errorf("namespace %s: run_as must not be root", ns.Name)
+		}
+	}
 
 	return cfg, nil
 }
@@ -139,6 +760,37 @@ func GetLogPath() string {
 	return DefaultLogDir
 }
 
+// NamespaceLogDir returns the log directory subtree of a namespace. Processes
+// in the default namespace log directly into the log directory.
+func NamespaceLogDir(logDir, namespace string) string {
+	if namespace == "" || namespace == DefaultNamespace {
+		return logDir
+	}
+	return filepath.Join(logDir, namespace)
+}
+
+// ParseDuration parses a duration like time.ParseDuration that may start
+// with a number of days, e.g. "7d" or "1d12h"
+func ParseDuration(s string) (time.Duration, error) {
+	days, rest, ok := strings.Cut(s, "d")
+	if !ok {
+		return time.ParseDuration(s)
+	}
+	n, err := strconv.Atoi(days)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	d := time.Duration(n) * 24 * time.Hour
+	if rest != "" {
+		r, err := time.ParseDuration(rest)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d += r
+	}
+	return d, nil
+}
+
 // GetSocketPath returns the Unix socket path
 func GetSocketPath() string {
 	if p := os.Getenv("GEMSTONE_SOCKET"); p != "" {
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of effective settings
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+)
+
+// redacted replaces secret values in effective settings
+const redacted = "<redacted>"
+
+// secretKeys are the setting names whose values are never shown
+var secretKeys = map[string]bool{
+	"auth_token": true,
+	"token":      true,
+}
+
+// Setting is one effective configuration value and where it came from
+type Setting struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+	// Env is the environment variable that set the value
+	Env string `json:"env,omitempty"`
+}
+
+// Effective returns every setting of the config as dotted keys, sorted,
+// with secrets redacted. Lists are single settings. The directories the
+// daemon uses are included under paths.
+func (c *Config) Effective() ([]Setting, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+
+	var settings []Setting
+	c.flatten("", values, &settings)
+
+	settings = append(settings,
+		pathSetting("paths.config", "GEMSTONE_CONFIG", c.path, GetConfigPath()),
+		pathSetting("paths.data", "GEMSTONE_DATA", DefaultDataDir, GetDataPath()),
+		pathSetting("paths.logs", "GEMSTONE_LOG", DefaultLogDir, GetLogPath()),
+		pathSetting("paths.socket", "GEMSTONE_SOCKET", DefaultSocketPath, GetSocketPath()),
+	)
+
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings, nil
+}
+
+func (c *Config) flatten(prefix string, values map[string]interface{}, settings *[]Setting) {
+	for key, value := range values {
+		full := key
+		if prefix != "" {
+			full = prefix + "." + key
+		}
+
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			c.flatten(full, nested, settings)
+			continue
+		}
+
+		source := SourceDefault
+		if c.inFile(full) {
+			source = SourceFile
+		}
+		*settings = append(*settings, Setting{Key: full, Value: redact(key, value), Source: source})
+	}
+}
+
+// inFile reports whether a dotted key was set in the config file
+func (c *Config) inFile(key string) bool {
+	var value interface{} = c.file
+	for _, part := range strings.Split(key, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if value, ok = m[part]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// redact hides secret values, also inside lists like api.tokens
+func redact(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, nested := range v {
+			out[k] = redact(k, nested)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, nested := range v {
+			out[i] = redact("", nested)
+		}
+		return out
+	}
+
+	if secretKeys[key] && value != "" && value != nil {
+		return redacted
+	}
+	return value
+}
+
+// pathSetting describes a directory that can be overridden by env
+func pathSetting(key, env, def, value string) Setting {
+	if os.Getenv(env) != "" {
+		return Setting{Key: key, Value: value, Source: SourceEnv, Env: env}
+	}
+	return Setting{Key: key, Value: def, Source: SourceDefault}
+}
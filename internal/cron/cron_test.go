@@ -0,0 +1,132 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns a time in UTC from "2006-01-02 15:04"
+func at(t *testing.T, s string) time.Time {
+	t.Helper()
+	v, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"* * * foo *",
+		"@reboot",
+		"0 0 30 2 *",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	for _, tc := range []struct {
+		spec, after, want string
+	}{
+		{"* * * * *", "2026-03-10 12:00", "2026-03-10 12:01"},
+		{"*/15 * * * *", "2026-03-10 12:01", "2026-03-10 12:15"},
+		{"0-30/10 * * * *", "2026-03-10 12:21", "2026-03-10 12:30"},
+		{"5/20 * * * *", "2026-03-10 12:26", "2026-03-10 12:45"},
+		{"0 9 * * *", "2026-03-10 09:00", "2026-03-11 09:00"},
+		{"30 2 1 * *", "2026-03-10 12:00", "2026-04-01 02:30"},
+		{"0 0 * jan,jul *", "2026-03-10 12:00", "2026-07-01 00:00"},
+		{"@hourly", "2026-03-10 12:59", "2026-03-10 13:00"},
+		{"@daily", "2026-12-31 23:00", "2027-01-01 00:00"},
+		{"@yearly", "2026-03-10 12:00", "2027-01-01 00:00"},
+		{"@Weekly", "2026-03-10 12:00", "2026-03-15 00:00"},
+		// Both Sunday spellings
+		{"0 0 * * 0", "2026-03-10 12:00", "2026-03-15 00:00"},
+		{"0 0 * * 7", "2026-03-10 12:00", "2026-03-15 00:00"},
+		{"0 0 * * 6-7", "2026-03-10 12:00", "2026-03-14 00:00"},
+		{"0 0 * * sat-7", "2026-03-15 12:00", "2026-03-21 00:00"},
+		{"0 0 29 2 *", "2026-03-01 00:00", "2028-02-29 00:00"},
+	} {
+		s, err := Parse(tc.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.spec, err)
+			continue
+		}
+		if got, want := s.Next(at(t, tc.after)), at(t, tc.want); !got.Equal(want) {
+			t.Errorf("%q after %s: got %s, want %s", tc.spec, tc.after, got.Format("2006-01-02 15:04"), tc.want)
+		}
+	}
+}
+
+func TestDayFields(t *testing.T) {
+	for _, tc := range []struct {
+		spec, after, want string
+	}{
+		// Both restricted: either day matches. 2026-03-13 is a Friday.
+		{"0 0 1 * fri", "2026-03-10 12:00", "2026-03-13 00:00"},
+		{"0 0 11 * fri", "2026-03-10 12:00", "2026-03-11 00:00"},
+		// A step is a restriction even when it starts at the first day
+		{"0 0 */2 * mon", "2026-03-10 12:00", "2026-03-11 00:00"},
+		// A day field spelled out in full matches every day, so only the
+		// other one decides
+		{"0 0 1-31 * fri", "2026-03-10 12:00", "2026-03-13 00:00"},
+		{"0 0 15 * 0-6", "2026-03-10 12:00", "2026-03-15 00:00"},
+		{"0 0 15 * 0-7", "2026-03-10 12:00", "2026-03-15 00:00"},
+		{"0 0 15 * *", "2026-03-10 12:00", "2026-03-15 00:00"},
+	} {
+		s, err := Parse(tc.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.spec, err)
+			continue
+		}
+		if got, want := s.Next(at(t, tc.after)), at(t, tc.want); !got.Equal(want) {
+			t.Errorf("%q after %s: got %s, want %s", tc.spec, tc.after, got.Format("2006-01-02 15:04"), tc.want)
+		}
+	}
+}
+
+func TestNextLocation(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	s, err := Parse("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := s.Next(time.Date(2026, 3, 10, 12, 0, 0, 0, loc))
+	if next.Location() != loc || next.Hour() != 9 || next.Day() != 11 {
+		t.Fatalf("got %s, want 09:00 on the 11th in New York", next)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	s, err := Parse("* 8-19 * * mon-fri")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for when, want := range map[string]bool{
+		"2026-03-10 08:00": true,
+		"2026-03-10 19:59": true,
+		"2026-03-10 20:00": false,
+		"2026-03-10 07:59": false,
+		"2026-03-14 12:00": false,
+	} {
+		if got := s.Matches(at(t, when)); got != want {
+			t.Errorf("Matches(%s) = %v, want %v", when, got, want)
+		}
+	}
+}
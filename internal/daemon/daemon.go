@@ -1,29 +1,89 @@
 package daemon
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"os/user"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/PrismManager/gemstone/internal/api"
 	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/hooks"
+	"github.com/PrismManager/gemstone/internal/plugin"
 	"github.com/PrismManager/gemstone/internal/process"
 	"github.com/PrismManager/gemstone/internal/stats"
+	"github.com/PrismManager/gemstone/internal/update"
 )
 
 // Version is the daemon version
 const Version = "0.1.0"
 
+const (
+	// logMaintenanceInterval is how often log rotation and quotas are enforced
+	logMaintenanceInterval = time.Minute
+	// pluginCollectInterval is how often plugin collectors are run
+	pluginCollectInterval = 10 * time.Second
+	// softLimitInterval is how often CPU usage is compared to soft limits
+	softLimitInterval = 10 * time.Second
+	// diskMonitorInterval is how often monitored paths are measured
+	diskMonitorInterval = time.Minute
+	// portProbeInterval is how often declared ports are probed
+	portProbeInterval = 10 * time.Second
+	// outputWatchdogInterval is how often processes are checked for output
+	outputWatchdogInterval = 15 * time.Second
+	// selfLimitInterval is how often the daemon checks its own memory use
+	selfLimitInterval = 30 * time.Second
+	// crashLoopInterval is how often crash-looped processes are checked
+	// against the cooldown
+	crashLoopInterval = 30 * time.Second
+	// maxUptimeInterval is how often processes are checked against their
+	// max uptime
+	maxUptimeInterval = 30 * time.Second
+	// scheduleInterval is how often the schedules of processes are checked
+	// for due runs
+	scheduleInterval = time.Second
+	// scaleInterval is how often the instance counts of scaled processes
+	// are moved by one toward their scale rules
+	scaleInterval = 10 * time.Second
+	// binaryCheckInterval is how often the binaries of running processes
+	// are checked for changes
+	binaryCheckInterval = 30 * time.Second
+	// standbyInterval is how often processes with a warm standby are
+	// checked for a missing one
+	standbyInterval = 10 * time.Second
+	// updateCheckInterval is how often the release endpoint is checked for
+	// a new version, with update.check
+	updateCheckInterval = 24 * time.Hour
+	// retentionInterval is how often stopped processes are checked against
+	// the retention policy
+	retentionInterval = 10 * time.Minute
+)
+
 // Daemon represents the gemstone daemon
 type Daemon struct {
 	config         *config.Config
 	manager        *process.Manager
 	api            *api.Server
 	statsCollector *stats.Collector
+	plugins        *plugin.Host
+	updates        *update.Checker
+	hooks          *hooks.Runner
 	startedAt      time.Time
 	socketPath     string
+	stopChan       chan struct{}
+	overMemory     bool
+	// announcedUpdate is the newer release an event was published for
+	announcedUpdate string
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
 }
 
 // New creates a new daemon instance
@@ -34,6 +94,14 @@ func New() (*Daemon, error) {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
+	// Log lines and API timestamps are all taken from the local time
+	if cfg.Time.UTC {
+		time.Local = time.UTC
+	}
+
+	// Limit the daemon itself before loading any process
+	applyLimits(cfg.Daemon.Limits)
+
 	// Create process manager
 	manager, err := process.NewManager(cfg, config.GetDataPath(), config.GetLogPath())
 	if err != nil {
@@ -41,88 +109,358 @@ func New() (*Daemon, error) {
 	}
 
 	// Create stats collector
-	statsCollector := stats.NewCollector(manager)
+	statsCollector := stats.NewCollector(manager, cfg.Stats.SystemHistory)
+
+	// Create plugin host
+	var plugins *plugin.Host
+	if cfg.Plugins.Enabled {
+		plugins = plugin.NewHost(cfg.Plugins.Directory, manager.Events())
+	}
+
+	if cfg.API.InstanceID == "" {
+		id, err := loadInstanceID(config.GetDataPath())
+		if err != nil {
+			fmt.Printf("Warning: %v, using a new instance ID until restart\n", err)
+		}
+		cfg.API.InstanceID = id
+	}
+
+	var updates *update.Checker
+	if cfg.Update.Check {
+		updates = update.NewChecker(cfg.Update, Version)
+	}
 
 	// Create API server
-	apiServer := api.NewServer(cfg, manager, statsCollector)
+	apiServer := api.NewServer(cfg, manager, statsCollector, plugins, updates)
 
 	return &Daemon{
 		config:         cfg,
 		manager:        manager,
 		api:            apiServer,
 		statsCollector: statsCollector,
+		plugins:        plugins,
+		updates:        updates,
+		hooks:          hooks.NewRunner(cfg.Hooks, manager.Events()),
 		socketPath:     config.GetSocketPath(),
+		stopChan:       make(chan struct{}),
 	}, nil
 }
 
-// Run starts the daemon
-func (d *Daemon) Run() error {
+// EnableChaos turns on chaos mode, which injects faults into the matching
+// processes. It must be called before Run.
+func (d *Daemon) EnableChaos(cfg process.ChaosConfig) {
+	fmt.Printf("Warning: chaos mode enabled, %s\n", cfg)
+	d.manager.EnableChaos(cfg)
+}
+
+// Run starts the daemon and blocks until ctx is cancelled, Shutdown is
+// called or a listener fails. It then shuts everything down and returns an
+// error if the shutdown was not clean.
+func (d *Daemon) Run(ctx context.Context) error {
 	d.startedAt = time.Now()
 
-	// Make sure that the socket directory exists
-	socketDir := filepath.Dir(d.socketPath)
-	if err := os.MkdirAll(socketDir, 0755); err != nil {
-		return fmt.Errorf("failed to create socket directory: %w", err)
-	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	d.mu.Lock()
+	d.cancel = cancel
+	d.mu.Unlock()
 
-	// Remove stale socket file
-	if err := os.Remove(d.socketPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove stale socket: %w", err)
+	// Create the unix sockets, the main one (for CLI communication) first
+	sockets := append([]config.SocketConfig{d.config.API.Socket}, d.config.API.Sockets...)
+	sockets[0].Path = d.socketPath
+	listeners := make([]net.Listener, 0, len(sockets))
+	for i, sock := range sockets {
+		var listener net.Listener
+		err := fmt.Errorf("api.sockets[%d]: path is required", i-1)
+		if sock.Path != "" {
+			listener, err = listenSocket(sock)
+		}
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, listener)
 	}
 
-	// Create Unix socket listener
-	listener, err := net.Listen("unix", d.socketPath)
-	if err != nil {
-		return fmt.Errorf("failed to create socket: %w", err)
+	// Listen for processes reporting their state, before any is started
+	notifyPath := filepath.Join(filepath.Dir(d.socketPath), "notify.sock")
+	if config.IsAbstractSocket(d.socketPath) {
+		notifyPath = d.socketPath + ".notify"
 	}
-	defer listener.Close()
-
-	// Set socket permissions
-	if err := os.Chmod(d.socketPath, 0666); err != nil {
-		return fmt.Errorf("failed to set socket permissions: %w", err)
+	if err := d.manager.ListenNotify(notifyPath); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		fmt.Printf("Warning: %v\n", err)
 	}
 
+	// Start event hooks before any process so their first start is seen
+	d.hooks.Start()
+
 	// Start auto-start processes
 	d.manager.StartAutoStartProcesses()
 
 	// Start stats collector
 	d.statsCollector.Start()
 
+	// Start log rotation and quota enforcement
+	go d.every(logMaintenanceInterval, d.manager.MaintainLogs)
+
+	// Start uploading rotated log files to the archive
+	if interval := d.manager.ArchiveInterval(); interval > 0 {
+		go d.every(interval, d.manager.ArchiveLogs)
+	}
+
+	// Start deleting processes stopped for longer than the retention, once
+	// right away for daemons that don't run long
+	if d.manager.RetentionEnabled() {
+		go func() {
+			d.manager.EnforceRetention()
+			d.every(retentionInterval, d.manager.EnforceRetention)
+		}()
+	}
+
+	// Start soft limit enforcement
+	go d.every(softLimitInterval, d.manager.EnforceSoftLimits)
+
+	// Start measuring monitored paths, once right away so the sizes are
+	// known before the first interval
+	go func() {
+		d.manager.MonitorDisk()
+		d.every(diskMonitorInterval, d.manager.MonitorDisk)
+	}()
+
+	// Start probing declared ports
+	go d.every(portProbeInterval, d.manager.ProbePorts)
+
+	// Start watching for processes that went quiet
+	go d.every(outputWatchdogInterval, d.manager.WatchOutput)
+
+	// Start bringing back crash-looped processes after their cooldown
+	go d.every(crashLoopInterval, d.manager.RecoverCrashLoops)
+
+	// Start restarting processes that have been up longer than they may
+	go d.every(maxUptimeInterval, d.manager.RestartAged)
+
+	// Start running processes on their schedules
+	go d.every(scheduleInterval, d.manager.RunScheduled)
+
+	// Start scaling processes with scale rules
+	go d.every(scaleInterval, d.manager.Scale)
+
+	// Start watching the binaries of running processes for updates
+	go d.every(binaryCheckInterval, d.manager.CheckBinaries)
+
+	// Start keeping warm standbys of the processes that want one
+	go d.every(standbyInterval, d.manager.EnsureStandbys)
+
+	// Start looking for new releases
+	if d.updates != nil {
+		go func() {
+			d.checkForUpdate()
+			d.every(updateCheckInterval, d.checkForUpdate)
+		}()
+	}
+
+	// Start checking the memory use of the daemon itself
+	go d.every(selfLimitInterval, d.checkMemory)
+
+	// Start killing processes in chaos mode
+	if chaos := d.manager.Chaos(); chaos != nil {
+		go d.every(chaos.Interval, d.manager.InjectChaos)
+	}
+
+	// Start plugins
+	if d.plugins != nil {
+		d.plugins.Start()
+		go d.every(pluginCollectInterval, d.plugins.Collect)
+	}
+
+	serveErr := make(chan error, 1+len(listeners))
+
 	// Start API server (if enabled)
 	if d.config.API.Enabled {
-		go d.api.Start()
+		go func() {
+			if err := d.api.Start(); err != nil {
+				serveErr <- fmt.Errorf("API server failed: %w", err)
+			}
+		}()
 	}
 
-	// Handle socket connections (for CLI communication)
-	for {
-		conn, err := listener.Accept()
-		if err != nil {
-			continue
-		}
-		go d.handleConnection(conn)
+	// Serve the API on the sockets
+	for i, listener := range listeners {
+		go func(listener net.Listener, sock config.SocketConfig, additional bool) {
+			if err := d.api.ServeSocket(listener, sock, additional); err != nil {
+				serveErr <- fmt.Errorf("socket server failed on %s: %w", sock.Path, err)
+			}
+		}(listener, sockets[i], i > 0)
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case runErr = <-serveErr:
 	}
+
+	if err := d.shutdown(); err != nil && runErr == nil {
+		runErr = err
+	}
+	return runErr
 }
 
-// Shutdown gracefully shuts down the daemon
+// Shutdown makes Run stop the daemon and return
 func (d *Daemon) Shutdown() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cancel != nil {
+		d.cancel()
+	}
+}
+
+// shutdown stops accepting API requests, drains in-flight ones and stops all
+// processes, giving up after the configured shutdown timeout
+func (d *Daemon) shutdown() error {
+	timeout := time.Duration(d.config.Daemon.ShutdownTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = config.DefaultShutdownTimeout * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	fmt.Println("Shutting down gemstone daemon...")
+
 	// Stop stats collector
 	d.statsCollector.Stop()
 
-	// Stop API server
-	d.api.Stop()
+	// Stop background loops
+	close(d.stopChan)
+
+	var errs []error
+
+	// Stop API servers, draining in-flight requests
+	if err := d.api.Stop(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to drain API requests: %w", err))
+	}
+
+	// Stop all processes and wait for them to exit
+	if err := d.manager.StopAll(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	d.manager.FlushLogs()
+	if err := d.manager.FlushProcesses(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to save processes: %w", err))
+	}
+	d.manager.SaveStats()
+	if err := d.manager.SaveUsage(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to save usage: %w", err))
+	}
+
+	// Stop plugins and event hooks
+	if d.plugins != nil {
+		d.plugins.Stop()
+	}
+	d.hooks.Stop()
+
+	// Remove socket files
+	for _, path := range d.socketPaths() {
+		if !config.IsAbstractSocket(path) {
+			os.Remove(path)
+		}
+	}
+	d.manager.CloseNotify()
+
+	return errors.Join(errs...)
+}
+
+// listenSocket creates a unix socket listener with the mode and group of
+// sock. Abstract sockets have neither.
+func listenSocket(sock config.SocketConfig) (net.Listener, error) {
+	if config.IsAbstractSocket(sock.Path) {
+		if runtime.GOOS != "linux" {
+			return nil, fmt.Errorf("abstract socket %s: only supported on Linux", sock.Path)
+		}
+		listener, err := net.Listen("unix", sock.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create socket %s: %w", sock.Path, err)
+		}
+		return listener, nil
+	}
+
+	// Make sure that the socket directory exists
+	if err := os.MkdirAll(filepath.Dir(sock.Path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	// Remove stale socket file
+	if err := os.Remove(sock.Path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", sock.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket %s: %w", sock.Path, err)
+	}
+
+	if err := setSocketPermissions(sock); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// setSocketPermissions applies the configured mode and group to a socket
+func setSocketPermissions(cfg config.SocketConfig) error {
+	mode := uint64(0660)
+	if cfg.Mode != "" {
+		m, err := strconv.ParseUint(cfg.Mode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid socket mode %q: %w", cfg.Mode, err)
+		}
+		mode = m
+	}
+
+	if cfg.Group != "" {
+		g, err := user.LookupGroup(cfg.Group)
+		if err != nil {
+			return fmt.Errorf("failed to look up socket group: %w", err)
+		}
+		gid, err := strconv.Atoi(g.Gid)
+		if err != nil {
+			return fmt.Errorf("invalid socket group id: %w", err)
+		}
+		if err := os.Chown(cfg.Path, -1, gid); err != nil {
+			return fmt.Errorf("failed to set socket group: %w", err)
+		}
+	}
 
-	// Stop all processes
-	d.manager.StopAll()
+	if err := os.Chmod(cfg.Path, os.FileMode(mode)); err != nil {
+		return fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return nil
+}
 
-	// Remove socket file
-	os.Remove(d.socketPath)
+// socketPaths returns the paths of all unix sockets of the API
+func (d *Daemon) socketPaths() []string {
+	paths := []string{d.socketPath}
+	for _, sock := range d.config.API.Sockets {
+		paths = append(paths, sock.Path)
+	}
+	return paths
 }
 
-// handleConnection handles a Unix socket connection
-func (d *Daemon) handleConnection(conn net.Conn) {
-	defer conn.Close()
-	// This is handled by the API/RPC layer
-	// For now, we'll use HTTP API for all communication
+// every runs fn periodically until the daemon shuts down
+func (d *Daemon) every(interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fn()
+		case <-d.stopChan:
+			return
+		}
+	}
 }
 
 // GetInfo returns daemon information
@@ -0,0 +1,38 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// instanceIDFile holds the generated instance ID in the data directory
+const instanceIDFile = "instance_id"
+
+// loadInstanceID returns the instance ID kept in the data directory,
+// generating and saving one on first start. If it can't be saved, the new
+// ID is returned with the error.
+func loadInstanceID(dataDir string) (string, error) {
+	path := filepath.Join(dataDir, instanceIDFile)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return uuid.New().String(), fmt.Errorf("failed to read instance ID: %w", err)
+	}
+
+	id := uuid.New().String()
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return id, fmt.Errorf("failed to save instance ID: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(id+"\n"), 0644); err != nil {
+		return id, fmt.Errorf("failed to save instance ID: %w", err)
+	}
+	return id, nil
+}
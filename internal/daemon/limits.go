@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/PrismManager/gemstone/internal/cgroup"
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/logger"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+const megabyte = 1024 * 1024
+
+// applyLimits sets the limits of the daemon process itself
+func applyLimits(cfg config.DaemonLimitsConfig) {
+	// An explicit GOMAXPROCS environment variable wins over the quota
+	procs := cfg.GOMAXPROCS
+	if procs <= 0 && os.Getenv("GOMAXPROCS") == "" {
+		if quota, err := cgroup.CPUQuota(); err == nil && quota > 0 {
+			procs = min(int(math.Ceil(quota)), runtime.NumCPU())
+		}
+	}
+	if procs > 0 && procs != runtime.GOMAXPROCS(0) {
+		runtime.GOMAXPROCS(procs)
+		fmt.Printf("Using GOMAXPROCS=%d\n", procs)
+	}
+
+	if cfg.MaxRSS > 0 {
+		debug.SetMemoryLimit(int64(cfg.MaxRSS) * megabyte)
+	}
+
+	files := cfg.MaxOpenLogFiles
+	if files <= 0 {
+		var limit unix.Rlimit
+		if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &limit); err == nil && limit.Cur != unix.RLIM_INFINITY {
+			files = int(min(limit.Cur/2, math.MaxInt32))
+		}
+	}
+	logger.SetMaxOpenFiles(files)
+}
+
+// checkMemory warns when the daemon uses more memory than its max_rss and
+// returns what it can to the OS
+func (d *Daemon) checkMemory() {
+	limit := uint64(d.config.Daemon.Limits.MaxRSS) * megabyte
+	if limit == 0 {
+		return
+	}
+
+	rss := d.statsCollector.GetDaemonStats().Memory
+	over := rss > limit
+	if over {
+		debug.FreeOSMemory()
+	}
+	if over == d.overMemory {
+		return
+	}
+	d.overMemory = over
+
+	message := fmt.Sprintf("Daemon memory back under max_rss of %dMB", d.config.Daemon.Limits.MaxRSS)
+	if over {
+		message = fmt.Sprintf("Daemon uses %dMB, over max_rss of %dMB", rss/megabyte, d.config.Daemon.Limits.MaxRSS)
+		fmt.Printf("Warning: %s\n", message)
+	}
+	d.manager.Events().Publish(types.Event{
+		Type:    types.EventDaemonLimit,
+		Message: message,
+		Data: map[string]interface{}{
+			"limit": "max_rss",
+			"over":  over,
+			"rss":   rss,
+		},
+	})
+}
@@ -0,0 +1,34 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// checkForUpdate queries the release endpoint and publishes an
+// update_available event the first time a newer release is found
+func (d *Daemon) checkForUpdate() {
+	rel, err := d.updates.Check(context.Background())
+	if err != nil {
+		fmt.Printf("Warning: update check failed: %v\n", err)
+		return
+	}
+	if rel == nil || rel.Version == d.announcedUpdate {
+		return
+	}
+	d.announcedUpdate = rel.Version
+
+	message := fmt.Sprintf("Gemstone %s is available, running %s (update with gem self-update)", rel.Version, Version)
+	fmt.Println(message)
+	d.manager.Events().Publish(types.Event{
+		Type:    types.EventUpdateAvailable,
+		Message: message,
+		Data: map[string]interface{}{
+			"version": rel.Version,
+			"current": Version,
+			"page":    rel.Page,
+		},
+	})
+}
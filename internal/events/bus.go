@@ -0,0 +1,140 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// subscriberBuffer is the channel size for each subscriber
+const subscriberBuffer = 64
+
+// Bus distributes events to subscribers and keeps a bounded history
+type Bus struct {
+	mu          sync.RWMutex
+	history     []types.Event
+	maxHistory  int
+	subscribers map[int]chan types.Event
+	nextID      int
+	// version counts the published events, changed is closed and replaced
+	// on each to wake up Wait
+	version uint64
+	changed chan struct{}
+}
+
+// NewBus creates a new event bus keeping up to maxHistory recent events
+func NewBus(maxHistory int) *Bus {
+	return &Bus{
+		maxHistory:  maxHistory,
+		subscribers: make(map[int]chan types.Event),
+		changed:     make(chan struct{}),
+	}
+}
+
+// Publish records an event and delivers it to all subscribers. Slow
+// subscribers miss events instead of blocking the publisher.
+func (b *Bus) Publish(event types.Event) {
+	if event.ID == "" {
+		event.ID = uuid.New().String()[:8]
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.history = append(b.history, event)
+	if len(b.history) > b.maxHistory {
+		b.history = b.history[len(b.history)-b.maxHistory:]
+	}
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+
+	b.version++
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// Version returns the number of events published so far, which changes
+// whenever a process changes
+func (b *Bus) Version() uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.version
+}
+
+// Wait blocks until the version differs from version or ctx is done, and
+// returns the current version. A version from before a daemon restart
+// differs right away.
+func (b *Bus) Wait(ctx context.Context, version uint64) uint64 {
+	for {
+		b.mu.RLock()
+		current, changed := b.version, b.changed
+		b.mu.RUnlock()
+
+		if current != version {
+			return current
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return current
+		}
+	}
+}
+
+// Subscribe returns a channel receiving new events and a function to
+// cancel the subscription
+func (b *Bus) Subscribe() (<-chan types.Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	ch := make(chan types.Event, subscriberBuffer)
+	b.subscribers[id] = ch
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[id]; ok {
+			delete(b.subscribers, id)
+			close(ch)
+		}
+	}
+}
+
+// Recent returns up to limit recent events, optionally only those match
+// accepts
+func (b *Bus) Recent(limit int, match func(types.Event) bool) []types.Event {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	result := make([]types.Event, 0)
+	for i := len(b.history) - 1; i >= 0; i-- {
+		if match != nil && !match(b.history[i]) {
+			continue
+		}
+		result = append(result, b.history[i])
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+	}
+
+	// Return in chronological order
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+
+	return result
+}
@@ -0,0 +1,408 @@
+package gemtest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/gemtest"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// statusTimeout bounds how long a test waits for a process status
+const statusTimeout = 10 * time.Second
+
+func startDaemon(t *testing.T) *gemtest.Daemon {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("starts a daemon")
+	}
+	return gemtest.StartDaemon(t)
+}
+
+// alive reports whether a process with a PID exists
+func alive(pid int) bool {
+	return pid > 0 && syscall.Kill(pid, 0) == nil
+}
+
+func TestStartStop(t *testing.T) {
+	d := startDaemon(t)
+
+	d.StartProcess(types.StartRequest{Name: "web", Command: gemtest.FakeProcess(t)})
+	info := d.WaitForStatus("web", types.StatusRunning, statusTimeout)
+	if !alive(info.PID) {
+		t.Fatalf("process %d is not running", info.PID)
+	}
+
+	d.Post("/processes/web/stop", nil, nil)
+	d.WaitForStatus("web", types.StatusStopped, statusTimeout)
+	if err := d.WaitFor(statusTimeout, func() bool { return !alive(info.PID) }); err != nil {
+		t.Fatalf("process %d still runs after stop: %v", info.PID, err)
+	}
+}
+
+func TestStartDuplicateName(t *testing.T) {
+	d := startDaemon(t)
+
+	req := types.StartRequest{Name: "web", Command: gemtest.FakeProcess(t)}
+	d.StartProcess(req)
+	if err := d.Do(http.MethodPost, "/processes", req, nil); err == nil {
+		t.Fatal("starting a second process named web succeeded")
+	}
+}
+
+func TestStopIgnoringSigterm(t *testing.T) {
+	d := startDaemon(t)
+
+	d.StartProcess(types.StartRequest{
+		Name:    "stubborn",
+		Command: gemtest.FakeProcess(t),
+		Args:    []string{"--ignore-sigterm"},
+	})
+	info := d.WaitForStatus("stubborn", types.StatusRunning, statusTimeout)
+
+	d.Post("/processes/stubborn/stop", nil, nil)
+	d.WaitForStatus("stubborn", types.StatusStopped, 2*statusTimeout)
+	if alive(info.PID) {
+		t.Fatalf("process %d survived stop", info.PID)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	d := startDaemon(t)
+
+	d.StartProcess(types.StartRequest{Name: "web", Command: gemtest.FakeProcess(t)})
+	before := d.WaitForStatus("web", types.StatusRunning, statusTimeout)
+
+	d.Post("/processes/web/restart", nil, nil)
+	var after *types.ProcessInfo
+	err := d.WaitFor(statusTimeout, func() bool {
+		after = d.Process("web")
+		return after.Status == types.StatusRunning && after.Generation > before.Generation
+	})
+	if err != nil {
+		t.Fatalf("process did not come back after restart: %v", err)
+	}
+	if after.PID == before.PID {
+		t.Fatalf("restart kept PID %d", after.PID)
+	}
+	if alive(before.PID) {
+		t.Fatalf("old process %d still runs", before.PID)
+	}
+}
+
+func TestAutoRestart(t *testing.T) {
+	d := startDaemon(t)
+
+	d.StartProcess(types.StartRequest{
+		Name:        "flaky",
+		Command:     gemtest.FakeProcess(t),
+		Args:        []string{"--exit-after", "200ms", "--exit-code", "3"},
+		AutoRestart: true,
+		MaxRestarts: 2,
+	})
+	err := d.WaitFor(3*statusTimeout, func() bool {
+		return d.Process("flaky").RestartCount >= 2
+	})
+	if err != nil {
+		t.Fatalf("process was not restarted: %v", err)
+	}
+}
+
+func TestDaemonRestartKeepsProcesses(t *testing.T) {
+	d := startDaemon(t)
+
+	d.StartProcess(types.StartRequest{Name: "web", Command: gemtest.FakeProcess(t), AutoStart: true})
+	before := d.WaitForStatus("web", types.StatusRunning, statusTimeout)
+
+	d.Restart()
+	after := d.WaitForStatus("web", types.StatusRunning, statusTimeout)
+	if after.ID != before.ID {
+		t.Fatalf("process ID changed from %s to %s", before.ID, after.ID)
+	}
+}
+
+// actions returns the apply action of each process by name
+func actions(result *types.ApplyResult) map[string]types.ApplyAction {
+	m := make(map[string]types.ApplyAction, len(result.Changes))
+	for _, change := range result.Changes {
+		m[change.Name] = change.Action
+	}
+	return m
+}
+
+func expectActions(t *testing.T, result *types.ApplyResult, want map[string]types.ApplyAction) {
+	t.Helper()
+	got := actions(result)
+	if len(got) != len(want) {
+		t.Fatalf("got changes %v, want %v", got, want)
+	}
+	for name, action := range want {
+		if got[name] != action {
+			t.Fatalf("got changes %v, want %v", got, want)
+		}
+	}
+	for _, change := range result.Changes {
+		if change.Error != "" {
+			t.Fatalf("%s %s: %s", change.Action, change.Name, change.Error)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	d := startDaemon(t)
+	fake := gemtest.FakeProcess(t)
+
+	doc := types.ApplyRequest{
+		Namespaces: []string{"shop"},
+		Processes: []types.StartRequest{
+			{Name: "api", Command: fake, Namespace: "shop"},
+			{Name: "worker", Command: fake, Namespace: "shop", Instances: 2},
+		},
+	}
+
+	var result types.ApplyResult
+	dryRun := doc
+	dryRun.DryRun = true
+	d.Post("/apply", dryRun, &result)
+	expectActions(t, &result, map[string]types.ApplyAction{
+		"api": types.ApplyCreate, "worker-0": types.ApplyCreate, "worker-1": types.ApplyCreate,
+	})
+	if err := d.Do(http.MethodGet, "/processes/api", nil, nil); err == nil {
+		t.Fatal("dry run created api")
+	}
+
+	d.Post("/apply", doc, &result)
+	expectActions(t, &result, map[string]types.ApplyAction{
+		"api": types.ApplyCreate, "worker-0": types.ApplyCreate, "worker-1": types.ApplyCreate,
+	})
+	for _, name := range []string{"api", "worker-0", "worker-1"} {
+		info := d.WaitForStatus(name, types.StatusRunning, statusTimeout)
+		if name == "worker-1" && info.Env["GEMSTONE_INSTANCE"] != "1" {
+			t.Fatalf("worker-1 has GEMSTONE_INSTANCE=%q", info.Env["GEMSTONE_INSTANCE"])
+		}
+	}
+
+	d.Post("/apply", doc, &result)
+	expectActions(t, &result, map[string]types.ApplyAction{
+		"api": types.ApplyUnchanged, "worker-0": types.ApplyUnchanged, "worker-1": types.ApplyUnchanged,
+	})
+
+	// Redefine api, lower the workers to one and drop nothing else
+	before := d.Process("api")
+	doc.Processes[0].Args = []string{"--lines", "1"}
+	doc.Processes[1].Instances = 1
+	d.Post("/apply", doc, &result)
+	expectActions(t, &result, map[string]types.ApplyAction{
+		"api": types.ApplyUpdate, "worker-0": types.ApplyDelete, "worker-1": types.ApplyDelete, "worker": types.ApplyCreate,
+	})
+	after := d.WaitForStatus("api", types.StatusRunning, statusTimeout)
+	if after.ID != before.ID || after.Generation <= before.Generation {
+		t.Fatalf("api was not restarted in place: %s gen %d, was %s gen %d", after.ID, after.Generation, before.ID, before.Generation)
+	}
+
+	// A full apply deletes the processes it doesn't list
+	doc.Processes = doc.Processes[:1]
+	d.Post("/apply", doc, &result)
+	expectActions(t, &result, map[string]types.ApplyAction{
+		"api": types.ApplyUnchanged, "worker": types.ApplyDelete,
+	})
+	if err := d.Do(http.MethodGet, "/processes/worker", nil, nil); err == nil {
+		t.Fatal("worker was not deleted")
+	}
+}
+
+func TestApplyPartial(t *testing.T) {
+	d := startDaemon(t)
+	fake := gemtest.FakeProcess(t)
+
+	d.StartProcess(types.StartRequest{Name: "other", Command: fake})
+	var result types.ApplyResult
+	d.Post("/apply", types.ApplyRequest{
+		Processes: []types.StartRequest{{Name: "api", Command: fake}},
+		Partial:   true,
+	}, &result)
+	expectActions(t, &result, map[string]types.ApplyAction{"api": types.ApplyCreate})
+	d.WaitForStatus("other", types.StatusRunning, statusTimeout)
+}
+
+func TestApplyInvalid(t *testing.T) {
+	d := startDaemon(t)
+
+	for i, doc := range []types.ApplyRequest{
+		{Processes: []types.StartRequest{{Name: "api"}}},
+		{Processes: []types.StartRequest{{Name: "api", Command: "x"}, {Name: "api", Command: "y"}}},
+		{Processes: []types.StartRequest{{Name: "api", Command: "x", Instances: -1}}},
+		{Processes: []types.StartRequest{{Name: "api", Command: "x", Scale: []types.ScaleRule{{Schedule: "nope", Instances: 2}}}}},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			if err := d.Do(http.MethodPost, "/apply", doc, nil); err == nil {
+				t.Fatal("invalid document was applied")
+			}
+		})
+	}
+	var procs []types.ProcessInfo
+	d.Get("/processes", &procs)
+	if len(procs) != 0 {
+		t.Fatalf("invalid documents created %d processes", len(procs))
+	}
+}
+
+func TestApplyScale(t *testing.T) {
+	d := startDaemon(t)
+
+	doc := types.ApplyRequest{
+		Processes: []types.StartRequest{{
+			Name:      "worker",
+			Command:   gemtest.FakeProcess(t),
+			Instances: 1,
+			Scale:     []types.ScaleRule{{Schedule: "* * * * *", Instances: 3}},
+		}},
+	}
+	var result types.ApplyResult
+	d.Post("/apply", doc, &result)
+	expectActions(t, &result, map[string]types.ApplyAction{
+		"worker-0": types.ApplyCreate, "worker-1": types.ApplyCreate, "worker-2": types.ApplyCreate,
+	})
+
+	// Later applies keep the count and leave changing it to the daemon
+	doc.Processes[0].Scale[0].Instances = 2
+	d.Post("/apply", doc, &result)
+	expectActions(t, &result, map[string]types.ApplyAction{
+		"worker-0": types.ApplyUnchanged, "worker-1": types.ApplyUnchanged, "worker-2": types.ApplyUnchanged,
+	})
+}
+
+// postAs posts body to an API path with a token and returns the status and
+// response
+func postAs(t *testing.T, d *gemtest.Daemon, token, path string, body interface{}) (int, types.Response) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, d.URL(path), bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var result types.Response
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, result
+}
+
+func TestTenantSecretReference(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a daemon")
+	}
+	d := gemtest.StartDaemon(t, func(cfg *config.Config) {
+		cfg.API.AuthToken = "admin-token"
+		cfg.API.Tokens = []config.TokenConfig{{Name: "team-a", Token: "team-a-token"}}
+		cfg.Namespaces = []config.NamespaceConfig{{Name: "team-a", Owners: []string{"team-a"}, RunAs: "nobody"}}
+	})
+	req := types.StartRequest{Name: "api", Command: gemtest.FakeProcess(t), Namespace: "team-a"}
+
+	// The same definition without the reference passes
+	if status, resp := postAs(t, d, "team-a-token", "/processes?dry_run=true", req); status != http.StatusOK {
+		t.Fatalf("dry run got %d: %s", status, resp.Error)
+	}
+
+	for _, ref := range []string{"vault://secret/data/team-b/db#password", "awsssm:///team-b/token"} {
+		req.Env = map[string]string{"DB_PASSWORD": ref}
+		status, resp := postAs(t, d, "team-a-token", "/processes", req)
+		if status != http.StatusForbidden || !strings.Contains(resp.Error, "env.DB_PASSWORD (secret reference)") {
+			t.Fatalf("starting with %s got %d: %s", ref, status, resp.Error)
+		}
+
+		doc := types.ApplyRequest{Processes: []types.StartRequest{req}, Partial: true}
+		status, resp = postAs(t, d, "team-a-token", "/apply", doc)
+		if status != http.StatusForbidden || !strings.Contains(resp.Error, "secret reference") {
+			t.Fatalf("applying with %s got %d: %s", ref, status, resp.Error)
+		}
+	}
+
+	// Admins keep using the daemon's credentials
+	req.Namespace = ""
+	req.Env = map[string]string{"DB_PASSWORD": "vault://secret/data/app#password"}
+	if status, resp := postAs(t, d, "admin-token", "/processes?dry_run=true", req); status != http.StatusOK {
+		t.Fatalf("admin dry run got %d: %s", status, resp.Error)
+	}
+}
+
+// startEvents returns the number of start events of a process
+func startEvents(d *gemtest.Daemon, id string) int {
+	var events []types.Event
+	d.Get("/events?limit=1000", &events)
+	n := 0
+	for _, e := range events {
+		if e.ProcessID == id && e.Type == types.EventStart {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDeleteWhileStarting(t *testing.T) {
+	d := startDaemon(t)
+
+	// The gate opens only after the delete
+	addr := fmt.Sprintf("127.0.0.1:%d", gemtest.FreePort(t))
+	info := d.StartProcess(types.StartRequest{
+		Name:    "gated",
+		Command: gemtest.FakeProcess(t),
+		WaitFor: &types.WaitFor{TCP: addr, Timeout: "30s"},
+	})
+	d.WaitForStatus("gated", types.StatusStarting, statusTimeout)
+	if err := d.Do(http.MethodDelete, "/processes/gated", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	time.Sleep(2 * time.Second)
+	if n := startEvents(d, info.ID); n != 0 {
+		t.Fatalf("the deleted process was launched %d times", n)
+	}
+}
+
+func TestDeleteDuringBackoff(t *testing.T) {
+	d := startDaemon(t)
+
+	info := d.StartProcess(types.StartRequest{
+		Name:        "flaky",
+		Command:     gemtest.FakeProcess(t),
+		Args:        []string{"--exit-after", "100ms", "--exit-code", "1"},
+		AutoRestart: true,
+		MaxRestarts: 10,
+	})
+	d.WaitForStatus("flaky", types.StatusRestarting, statusTimeout)
+	starts := startEvents(d, info.ID)
+	if err := d.Do(http.MethodDelete, "/processes/flaky", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Past the restart delay of a second
+	time.Sleep(2500 * time.Millisecond)
+	if n := startEvents(d, info.ID); n != starts {
+		t.Fatalf("the deleted process was relaunched %d times", n-starts)
+	}
+}
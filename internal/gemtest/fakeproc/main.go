@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// fakeproc is a controllable child process for integration tests. It logs
+// at a given rate, can listen on a port, ignore SIGTERM and exit on demand:
+// after a delay, on SIGUSR1 or once a file exists.
+func main() {
+	var (
+		lines         = flag.Int("lines", 0, "Lines to log per second on stdout")
+		stderrLines   = flag.Int("stderr-lines", 0, "Lines to log per second on stderr")
+		exitAfter     = flag.Duration("exit-after", 0, "Exit after this long, 0 runs until told otherwise")
+		exitCode      = flag.Int("exit-code", 0, "Exit code when exiting on demand")
+		exitFile      = flag.String("exit-file", "", "Exit once this file exists")
+		ignoreSigterm = flag.Bool("ignore-sigterm", false, "Keep running on SIGTERM")
+		listen        = flag.String("listen", "", "TCP address to accept connections on")
+		startDelay    = flag.Duration("start-delay", 0, "Wait this long before listening and logging")
+	)
+	flag.Parse()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGUSR1)
+
+	time.Sleep(*startDelay)
+	fmt.Printf("fakeproc started pid=%d\n", os.Getpid())
+
+	if *listen != "" {
+		l, err := net.Listen("tcp", *listen)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to listen: %v\n", err)
+			os.Exit(2)
+		}
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+	}
+
+	go emit(os.Stdout, "out", *lines)
+	go emit(os.Stderr, "err", *stderrLines)
+
+	var deadline <-chan time.Time
+	if *exitAfter > 0 {
+		deadline = time.After(*exitAfter)
+	}
+
+	poll := time.NewTicker(100 * time.Millisecond)
+	defer poll.Stop()
+
+	for {
+		select {
+		case sig := <-signals:
+			switch {
+			case sig == syscall.SIGUSR1:
+				fmt.Println("fakeproc exiting on SIGUSR1")
+				os.Exit(*exitCode)
+			case *ignoreSigterm:
+				fmt.Printf("fakeproc ignoring %s\n", sig)
+			default:
+				fmt.Printf("fakeproc stopping on %s\n", sig)
+				os.Exit(0)
+			}
+		case <-deadline:
+			fmt.Println("fakeproc exiting after delay")
+			os.Exit(*exitCode)
+		case <-poll.C:
+			if *exitFile == "" {
+				continue
+			}
+			if _, err := os.Stat(*exitFile); err == nil {
+				fmt.Println("fakeproc exiting on exit file")
+				os.Exit(*exitCode)
+			}
+		}
+	}
+}
+
+// emit writes perSecond numbered lines per second to f
+func emit(f *os.File, stream string, perSecond int) {
+	if perSecond <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Second / time.Duration(perSecond))
+	defer ticker.Stop()
+
+	for n := 1; ; n++ {
+		<-ticker.C
+		fmt.Fprintf(f, "fakeproc %s line %d\n", stream, n)
+	}
+}
@@ -0,0 +1,367 @@
+package gemtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+const (
+	// startTimeout is how long a daemon gets to answer its health check
+	startTimeout = 10 * time.Second
+	// stopTimeout is how long a daemon gets to exit before it is killed
+	stopTimeout = 15 * time.Second
+)
+
+var (
+	buildOnce sync.Once
+	buildDir  string
+	buildErr  error
+)
+
+// Daemon is a gemstoned running on temporary directories for a test
+type Daemon struct {
+	// Dir holds the config, data, log and socket of the daemon
+	Dir        string
+	ConfigPath string
+	DataDir    string
+	LogDir     string
+	SocketPath string
+	// Addr is the host:port of the API
+	Addr string
+	// Token authenticates the requests of Do, the auth_token of the config
+	Token string
+
+	t      testing.TB
+	bin    string
+	cmd    *exec.Cmd
+	output *syncWriter
+	exited chan struct{}
+	client *http.Client
+}
+
+// Option changes the config of a daemon before it is started
+type Option func(cfg *config.Config)
+
+// Binaries builds gemstoned and the fake process once per test binary and
+// returns the directory holding them
+func Binaries(t testing.TB) string {
+	t.Helper()
+
+	buildOnce.Do(func() {
+		buildDir, buildErr = build()
+	})
+	if buildErr != nil {
+		t.Fatalf("failed to build binaries: %v", buildErr)
+	}
+	return buildDir
+}
+
+func build() (string, error) {
+	out, err := exec.Command("go", "env", "GOMOD").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the module: %w", err)
+	}
+	root := filepath.Dir(strings.TrimSpace(string(out)))
+
+	dir, err := os.MkdirTemp("", "gemtest-bin-")
+	if err != nil {
+		return "", err
+	}
+
+	for name, pkg := range map[string]string{
+		"gemstoned": "./cmd/gemstoned",
+		"fakeproc":  "./internal/gemtest/fakeproc",
+	} {
+		cmd := exec.Command("go", "build", "-o", filepath.Join(dir, name), pkg)
+		cmd.Dir = root
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("go build %s: %w\n%s", pkg, err, out)
+		}
+	}
+	return dir, nil
+}
+
+// FakeProcess returns the path of the fake process. Its flags are:
+//
+//	--lines N            log N lines per second on stdout
+//	--stderr-lines N     log N lines per second on stderr
+//	--exit-after D       exit after duration D
+//	--exit-code N        exit code when exiting on demand
+//	--exit-file PATH     exit once PATH exists
+//	--ignore-sigterm     keep running on SIGTERM
+//	--listen ADDR        accept TCP connections on ADDR
+//	--start-delay D      wait D before listening and logging
+//
+// It also exits with its exit code on SIGUSR1.
+func FakeProcess(t testing.TB) string {
+	t.Helper()
+	return filepath.Join(Binaries(t), "fakeproc")
+}
+
+// FreePort returns a TCP port that was free on 127.0.0.1
+func FreePort(t testing.TB) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// StartDaemon starts a daemon on temporary directories and a free port and
+// waits until its API answers. It is stopped when the test ends.
+func StartDaemon(t testing.TB, opts ...Option) *Daemon {
+	t.Helper()
+
+	bin := Binaries(t)
+	dir := t.TempDir()
+	d := &Daemon{
+		Dir:        dir,
+		ConfigPath: filepath.Join(dir, "config.yaml"),
+		DataDir:    filepath.Join(dir, "data"),
+		LogDir:     filepath.Join(dir, "logs"),
+		SocketPath: filepath.Join(dir, "gemstone.sock"),
+		t:          t,
+		bin:        filepath.Join(bin, "gemstoned"),
+		output:     &syncWriter{},
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.API.Port = FreePort(t)
+	cfg.API.Socket.AllowedUIDs = []uint32{uint32(os.Getuid())}
+	cfg.Logging.Directory = d.LogDir
+	cfg.Plugins.Enabled = false
+	cfg.Plugins.Directory = filepath.Join(dir, "plugins")
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	d.Addr = cfg.API.ListenAddresses()[0].Address
+	d.Token = cfg.API.AuthToken
+
+	if err := cfg.Save(d.ConfigPath); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	d.launch()
+	t.Cleanup(d.Stop)
+	return d
+}
+
+// Env returns the environment pointing the CLI and daemon at this daemon
+func (d *Daemon) Env() []string {
+	return []string{
+		"GEMSTONE_CONFIG=" + d.ConfigPath,
+		"GEMSTONE_DATA=" + d.DataDir,
+		"GEMSTONE_LOG=" + d.LogDir,
+		"GEMSTONE_SOCKET=" + d.SocketPath,
+	}
+}
+
+// URL returns the URL of an API path, such as "/processes"
+func (d *Daemon) URL(path string) string {
+	return "http://" + d.Addr + "/api/v1" + path
+}
+
+// Output returns what the daemon printed so far
+func (d *Daemon) Output() string {
+	d.output.mu.Lock()
+	defer d.output.mu.Unlock()
+	return d.output.buf.String()
+}
+
+// Do sends a request to the API and decodes the data of the response into
+// out, if not nil. It fails if the response isn't successful.
+func (d *Daemon) Do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, d.URL(path), reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if d.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.Token)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result types.Response
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("%s %s: invalid response: %w", method, path, err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%s %s: %s", method, path, result.Error)
+	}
+	if out == nil || result.Data == nil {
+		return nil
+	}
+
+	// Data arrives as generic JSON, so round trip it into out
+	data, err := json.Marshal(result.Data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Get fetches an API path into out and fails the test on error
+func (d *Daemon) Get(path string, out interface{}) {
+	d.t.Helper()
+	if err := d.Do(http.MethodGet, path, nil, out); err != nil {
+		d.t.Fatal(err)
+	}
+}
+
+// Post posts body to an API path, decodes the data into out and fails the
+// test on error
+func (d *Daemon) Post(path string, body, out interface{}) {
+	d.t.Helper()
+	if err := d.Do(http.MethodPost, path, body, out); err != nil {
+		d.t.Fatal(err)
+	}
+}
+
+// StartProcess starts a process and returns it
+func (d *Daemon) StartProcess(req types.StartRequest) *types.ProcessInfo {
+	d.t.Helper()
+	var info types.ProcessInfo
+	d.Post("/processes", req, &info)
+	return &info
+}
+
+// Process returns a process by name or ID
+func (d *Daemon) Process(id string) *types.ProcessInfo {
+	d.t.Helper()
+	var info types.ProcessInfo
+	d.Get("/processes/"+id, &info)
+	return &info
+}
+
+// WaitForStatus waits until a process has the given status
+func (d *Daemon) WaitForStatus(id string, status types.ProcessStatus, timeout time.Duration) *types.ProcessInfo {
+	d.t.Helper()
+
+	var info types.ProcessInfo
+	err := d.WaitFor(timeout, func() bool {
+		return d.Do(http.MethodGet, "/processes/"+id, nil, &info) == nil && info.Status == status
+	})
+	if err != nil {
+		d.t.Fatalf("process %s is %s, not %s: %v", id, info.Status, status, err)
+	}
+	return &info
+}
+
+// WaitFor polls cond until it returns true or the timeout passes
+func (d *Daemon) WaitFor(timeout time.Duration, cond func() bool) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if cond() {
+			return nil
+		}
+		select {
+		case <-d.exited:
+			return fmt.Errorf("daemon exited")
+		default:
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Stop stops the daemon with SIGTERM, killing it if it doesn't exit in time
+func (d *Daemon) Stop() {
+	select {
+	case <-d.exited:
+		return
+	default:
+	}
+
+	d.cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-d.exited:
+	case <-time.After(stopTimeout):
+		d.cmd.Process.Kill()
+		<-d.exited
+		d.t.Errorf("daemon did not stop within %s\n%s", stopTimeout, d.Output())
+	}
+}
+
+// Restart stops the daemon and starts it again on the same directories and
+// port, so saved processes are loaded again
+func (d *Daemon) Restart() {
+	d.t.Helper()
+	d.Stop()
+
+	d.launch()
+}
+
+// launch starts the daemon process and waits until its API answers
+func (d *Daemon) launch() {
+	d.t.Helper()
+
+	cmd := exec.Command(d.bin)
+	cmd.Env = append(os.Environ(), d.Env()...)
+	cmd.Stdout = d.output
+	cmd.Stderr = d.output
+	if err := cmd.Start(); err != nil {
+		d.t.Fatalf("failed to start daemon: %v", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	d.cmd, d.exited = cmd, exited
+
+	err := d.WaitFor(startTimeout, func() bool {
+		return d.Do(http.MethodGet, "/health", nil, nil) == nil
+	})
+	if err != nil {
+		d.t.Fatalf("daemon did not start: %v\n%s", err, d.Output())
+	}
+}
+
+// syncWriter collects the output of the daemon across restarts
+type syncWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
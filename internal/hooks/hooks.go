@@ -0,0 +1,89 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/events"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// DefaultTimeout is how long a handler may run if no timeout is configured
+const DefaultTimeout = 30 * time.Second
+
+// Runner runs the configured handler scripts for daemon events
+type Runner struct {
+	config   config.HooksConfig
+	events   *events.Bus
+	stopChan chan struct{}
+}
+
+// NewRunner creates a hook runner for the configured handlers
+func NewRunner(cfg config.HooksConfig, bus *events.Bus) *Runner {
+	return &Runner{
+		config:   cfg,
+		events:   bus,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start starts running handlers for new events
+func (r *Runner) Start() {
+	ch, cancel := r.events.Subscribe()
+
+	go func() {
+		defer cancel()
+		for {
+			select {
+			case event := <-ch:
+				if command := r.config.Handler(string(event.Type)); command != "" {
+					go r.run(command, event)
+				}
+			case <-r.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops running handlers for new events. Handlers that are already
+// running are left to finish.
+func (r *Runner) Stop() {
+	close(r.stopChan)
+}
+
+// run runs a handler through the shell with the event as JSON on stdin
+func (r *Runner) run(command string, event types.Event) {
+	timeout := time.Duration(r.config.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(append(data, '\n'))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"GEMSTONE_EVENT="+string(event.Type),
+		"GEMSTONE_EVENT_ID="+event.ID,
+		"GEMSTONE_PROCESS_ID="+event.ProcessID,
+		"GEMSTONE_PROCESS_NAME="+event.ProcessName,
+	)
+
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("Warning: %s hook %q failed: %v\n", event.Type, command, err)
+	}
+}
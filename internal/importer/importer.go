@@ -0,0 +1,114 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// Formats that can be imported
+const (
+	FormatPM2         = "pm2"
+	FormatSupervisord = "supervisord"
+	FormatSystemd     = "systemd"
+)
+
+// defaultMaxRestarts is used when a source doesn't limit restarts
+const defaultMaxRestarts = 10
+
+// Result holds the process definitions translated from a source and
+// warnings about settings that could not be translated
+type Result struct {
+	Processes []types.StartRequest
+	Warnings  []string
+}
+
+func (r *Result) warnf(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Import translates the files of a source format into process definitions
+func Import(format string, paths []string) (*Result, error) {
+	result := &Result{}
+
+	for _, path := range paths {
+		var err error
+		switch format {
+		case FormatPM2:
+			err = importPM2(path, result)
+		case FormatSupervisord:
+			err = importSupervisord(path, result)
+		case FormatSystemd:
+			err = importSystemd(path, result)
+		default:
+			return nil, fmt.Errorf("unknown import format %q (expected pm2, supervisord or systemd)", format)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return result, nil
+}
+
+// splitCommand splits a command line into words, honoring single and double
+// quotes and backslash escapes
+func splitCommand(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != '\'' && r == '\\' && i+1 < len(runes):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", line)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
+
+// setCommand splits a command line into the command and args of a definition
+func setCommand(req *types.StartRequest, line string) error {
+	words, err := splitCommand(line)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		return fmt.Errorf("empty command")
+	}
+
+	req.Command = words[0]
+	req.Args = words[1:]
+	return nil
+}
@@ -0,0 +1,83 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// iniSection is a section of an INI file with its keys in file order
+type iniSection struct {
+	Name   string
+	Keys   []string
+	Values map[string]string
+}
+
+// parseINI parses an INI file as used by supervisord and systemd. Lines
+// starting with '#' or ';' are comments and indented lines continue the
+// previous value. With joinBackslash, a line ending in a backslash is also
+// continued on the next line, as in systemd units. Repeated keys are kept
+// as separate entries joined by newlines.
+func parseINI(r io.Reader, joinBackslash bool) ([]*iniSection, error) {
+	var sections []*iniSection
+	var current *iniSection
+	var lastKey string
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := scanner.Text()
+		for joinBackslash && strings.HasSuffix(raw, "\\") && scanner.Scan() {
+			lineNo++
+			raw = strings.TrimSuffix(raw, "\\") + " " + strings.TrimSpace(scanner.Text())
+		}
+		line := strings.TrimSpace(raw)
+
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			lastKey = ""
+			continue
+		}
+
+		// Continuation of the previous value
+		if lastKey != "" && (raw[0] == ' ' || raw[0] == '\t') {
+			current.Values[lastKey] += "\n" + line
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = &iniSection{
+				Name:   strings.TrimSpace(line[1 : len(line)-1]),
+				Values: make(map[string]string),
+			}
+			sections = append(sections, current)
+			lastKey = ""
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key=value", lineNo)
+		}
+		if current == nil {
+			return nil, fmt.Errorf("line %d: key outside of a section", lineNo)
+		}
+
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if existing, ok := current.Values[key]; ok {
+			current.Values[key] = existing + "\n" + value
+		} else {
+			current.Keys = append(current.Keys, key)
+			current.Values[key] = value
+		}
+		lastKey = key
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return sections, nil
+}
@@ -0,0 +1,152 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// pm2App is an app of a PM2 ecosystem file
+type pm2App struct {
+	Name            string                 `yaml:"name"`
+	Script          string                 `yaml:"script"`
+	Args            interface{}            `yaml:"args"`
+	Cwd             string                 `yaml:"cwd"`
+	Interpreter     string                 `yaml:"interpreter"`
+	InterpreterArgs interface{}            `yaml:"interpreter_args"`
+	Env             map[string]interface{} `yaml:"env"`
+	Autorestart     *bool                  `yaml:"autorestart"`
+	MaxRestarts     *int                   `yaml:"max_restarts"`
+	UID             string                 `yaml:"uid"`
+	GID             string                 `yaml:"gid"`
+	Instances       interface{}            `yaml:"instances"`
+	Cron            string                 `yaml:"cron_restart"`
+	Watch           interface{}            `yaml:"watch"`
+}
+
+// pm2Ecosystem is a PM2 ecosystem file. JSON files are parsed as YAML.
+type pm2Ecosystem struct {
+	Apps []pm2App `yaml:"apps"`
+}
+
+// importPM2 imports a PM2 ecosystem file. JavaScript files are evaluated
+// with node; JSON and YAML files are read directly.
+func importPM2(path string, result *Result) error {
+	data, err := readPM2(path)
+	if err != nil {
+		return err
+	}
+
+	var eco pm2Ecosystem
+	if err := yaml.Unmarshal(data, &eco); err != nil {
+		return fmt.Errorf("failed to parse ecosystem file: %w", err)
+	}
+	if len(eco.Apps) == 0 {
+		return fmt.Errorf("no apps found")
+	}
+
+	for _, app := range eco.Apps {
+		if app.Script == "" {
+			return fmt.Errorf("app %q has no script", app.Name)
+		}
+
+		name := app.Name
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(app.Script), filepath.Ext(app.Script))
+		}
+
+		req := types.StartRequest{
+			Name:        name,
+			WorkDir:     app.Cwd,
+			AutoStart:   true,
+			AutoRestart: app.Autorestart == nil || *app.Autorestart,
+			MaxRestarts: defaultMaxRestarts,
+			User:        app.UID,
+			Group:       app.GID,
+		}
+		if app.MaxRestarts != nil {
+			req.MaxRestarts = *app.MaxRestarts
+		}
+
+		args, err := pm2Args(app.Args)
+		if err != nil {
+			return fmt.Errorf("app %s: %w", name, err)
+		}
+		interpreterArgs, err := pm2Args(app.InterpreterArgs)
+		if err != nil {
+			return fmt.Errorf("app %s: %w", name, err)
+		}
+
+		if app.Interpreter != "" && app.Interpreter != "none" {
+			req.Command = app.Interpreter
+			req.Args = append(append(interpreterArgs, app.Script), args...)
+		} else {
+			req.Command = app.Script
+			req.Args = args
+		}
+
+		if len(app.Env) > 0 {
+			req.Env = make(map[string]string, len(app.Env))
+			for k, v := range app.Env {
+				req.Env[k] = fmt.Sprint(v)
+			}
+		}
+
+		if app.Instances != nil && fmt.Sprint(app.Instances) != "1" {
+			result.warnf("%s: instances=%v is not supported, importing one instance", name, app.Instances)
+		}
+		if app.Cron != "" {
+			result.warnf("%s: cron_restart is not supported", name)
+		}
+		if app.Watch != nil && fmt.Sprint(app.Watch) != "false" {
+			result.warnf("%s: watch is not supported", name)
+		}
+
+		result.Processes = append(result.Processes, req)
+	}
+
+	return nil
+}
+
+// readPM2 returns the contents of an ecosystem file as JSON or YAML
+func readPM2(path string) ([]byte, error) {
+	switch filepath.Ext(path) {
+	case ".js", ".cjs", ".mjs":
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		script := "const m = require(process.argv[1]); console.log(JSON.stringify(m.default || m))"
+		out, err := exec.Command("node", "-e", script, abs).Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate ecosystem file with node (convert it to JSON with `pm2 ecosystem` or install node): %w", err)
+		}
+		return out, nil
+	default:
+		return os.ReadFile(path)
+	}
+}
+
+// pm2Args converts PM2 args, which may be a string or a list
+func pm2Args(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return splitCommand(v)
+	case []interface{}:
+		args := make([]string, len(v))
+		for i, arg := range v {
+			args[i] = fmt.Sprint(arg)
+		}
+		return args, nil
+	default:
+		return nil, fmt.Errorf("unsupported args %v", v)
+	}
+}
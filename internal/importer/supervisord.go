@@ -0,0 +1,179 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// importSupervisord imports the [program:x] sections of a supervisord
+// configuration file
+func importSupervisord(path string, result *Result) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sections, err := parseINI(f, false)
+	if err != nil {
+		return err
+	}
+
+	here, _ := filepath.Abs(filepath.Dir(path))
+	found := false
+
+	for _, section := range sections {
+		if section.Name == "include" {
+			result.warnf("%s: [include] is not followed, import the included files separately", path)
+			continue
+		}
+
+		name, ok := strings.CutPrefix(section.Name, "program:")
+		if !ok {
+			continue
+		}
+		found = true
+
+		get := func(key string) string {
+			return supervisordExpand(supervisordValue(section.Values[key]), name, here)
+		}
+
+		req := types.StartRequest{
+			Name:        name,
+			WorkDir:     get("directory"),
+			AutoStart:   true,
+			AutoRestart: true,
+			MaxRestarts: defaultMaxRestarts,
+			User:        get("user"),
+		}
+
+		if err := setCommand(&req, get("command")); err != nil {
+			return fmt.Errorf("program %s: %w", name, err)
+		}
+
+		if v := get("autostart"); v != "" {
+			req.AutoStart = v == "true"
+		}
+		switch v := get("autorestart"); v {
+		case "", "unexpected":
+			req.AutoRestart = true
+			if section.Values["exitcodes"] != "" {
+				result.warnf("%s: exitcodes is not supported, every unexpected exit restarts", name)
+			}
+		default:
+			req.AutoRestart = v == "true"
+		}
+		if v := get("startretries"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("program %s: invalid startretries %q", name, v)
+			}
+			req.MaxRestarts = n
+		}
+
+		if v := get("environment"); v != "" {
+			env, err := supervisordEnv(v)
+			if err != nil {
+				return fmt.Errorf("program %s: %w", name, err)
+			}
+			req.Env = env
+		}
+
+		if v := get("numprocs"); v != "" && v != "1" {
+			result.warnf("%s: numprocs=%s is not supported, importing one process", name, v)
+		}
+		for _, key := range []string{"stdout_logfile", "stderr_logfile"} {
+			if v := get(key); v != "" && v != "AUTO" && v != "NONE" {
+				result.warnf("%s: %s is ignored, logs are kept in the gemstone log directory", name, key)
+			}
+		}
+
+		result.Processes = append(result.Processes, req)
+	}
+
+	if !found {
+		return fmt.Errorf("no [program:x] sections found")
+	}
+
+	return nil
+}
+
+// supervisordValue strips an inline comment, which supervisord recognizes
+// after whitespace followed by ';'
+func supervisordValue(value string) string {
+	for i := 1; i < len(value); i++ {
+		if value[i] == ';' && (value[i-1] == ' ' || value[i-1] == '\t') {
+			return strings.TrimSpace(value[:i])
+		}
+	}
+	return value
+}
+
+// supervisordExpand expands the %(name)s expressions supervisord supports
+// in values
+func supervisordExpand(value, program, here string) string {
+	if !strings.Contains(value, "%(") {
+		return value
+	}
+
+	replacements := []string{
+		"%(program_name)s", program,
+		"%(process_num)s", "0",
+		"%(process_num)02d", "00",
+		"%(here)s", here,
+		"%%", "%",
+	}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		replacements = append(replacements, "%(ENV_"+k+")s", v)
+	}
+
+	return strings.NewReplacer(replacements...).Replace(value)
+}
+
+// supervisordEnv parses an environment value like KEY="value",KEY2=value2
+func supervisordEnv(value string) (map[string]string, error) {
+	env := make(map[string]string)
+
+	var parts []string
+	var part strings.Builder
+	var quote rune
+	for _, r := range value {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			part.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteRune(r)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in environment")
+	}
+	parts = append(parts, part.String())
+
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(p, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid environment entry %q", p)
+		}
+		env[strings.TrimSpace(k)] = v
+	}
+
+	return env, nil
+}
@@ -0,0 +1,205 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// importSystemd imports a systemd service unit file
+func importSystemd(path string, result *Result) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sections, err := parseINI(f, true)
+	if err != nil {
+		return err
+	}
+
+	unit := filepath.Base(path)
+	name := strings.TrimSuffix(unit, ".service")
+	prefix, instance, _ := strings.Cut(name, "@")
+	expand := strings.NewReplacer("%n", unit, "%N", name, "%p", prefix, "%i", instance, "%I", instance, "%%", "%")
+
+	var unitSection, service, install *iniSection
+	for _, section := range sections {
+		switch section.Name {
+		case "Unit":
+			unitSection = section
+		case "Service":
+			service = section
+		case "Install":
+			install = section
+		}
+	}
+	if service == nil {
+		return fmt.Errorf("no [Service] section found")
+	}
+
+	get := func(key string) string {
+		return expand.Replace(service.Values[key])
+	}
+
+	req := types.StartRequest{
+		Name:        name,
+		User:        get("User"),
+		Group:       get("Group"),
+		AutoStart:   install != nil && install.Values["WantedBy"] != "",
+		MaxRestarts: defaultMaxRestarts,
+	}
+
+	execStart := strings.Split(get("ExecStart"), "\n")
+	if len(execStart) > 1 {
+		result.warnf("%s: only the first of %d ExecStart lines is imported", name, len(execStart))
+	}
+	if err := setCommand(&req, strings.TrimLeft(execStart[0], "@-:+!")); err != nil {
+		return fmt.Errorf("ExecStart: %w", err)
+	}
+	// "$$" is a literal "$" in ExecStart; variable expansion is left to the
+	// process
+	req.Command = strings.ReplaceAll(req.Command, "$$", "$")
+	for i, arg := range req.Args {
+		req.Args[i] = strings.ReplaceAll(arg, "$$", "$")
+	}
+
+	if dir := strings.TrimPrefix(get("WorkingDirectory"), "-"); dir != "~" {
+		req.WorkDir = dir
+	} else {
+		result.warnf("%s: WorkingDirectory=~ is not supported", name)
+	}
+
+	if unitSection != nil {
+		req.Description = unitSection.Values["Description"]
+		// Documentation= lists URIs, the first one is the homepage
+		if docs := strings.Fields(unitSection.Values["Documentation"]); len(docs) > 0 {
+			req.Homepage = docs[0]
+		}
+	}
+
+	switch stdin := get("StandardInput"); {
+	case strings.HasPrefix(stdin, "file:"):
+		req.Stdin = strings.TrimPrefix(stdin, "file:")
+	case stdin != "" && stdin != "null":
+		result.warnf("%s: StandardInput=%s is not supported, stdin is /dev/null", name, stdin)
+	}
+
+	switch get("Restart") {
+	case "", "no":
+		req.AutoRestart = false
+	default:
+		req.AutoRestart = true
+	}
+	// StartLimitBurst belongs in [Unit] but older units set it in [Service]
+	burst := get("StartLimitBurst")
+	if unitSection != nil && unitSection.Values["StartLimitBurst"] != "" {
+		burst = unitSection.Values["StartLimitBurst"]
+	}
+	if v := strings.TrimSpace(burst); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid StartLimitBurst %q", v)
+		}
+		req.MaxRestarts = n
+	}
+
+	if v := strings.TrimSpace(get("OOMScoreAdjust")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid OOMScoreAdjust %q", v)
+		}
+		req.OOMScoreAdj = n
+	}
+	switch strings.ToLower(get("PrivateNetwork")) {
+	case "yes", "true", "on", "1":
+		req.Network = &types.Network{Mode: "isolated"}
+	}
+	req.AppArmorProfile = strings.TrimPrefix(get("AppArmorProfile"), "-")
+	req.SELinuxLabel = strings.TrimPrefix(get("SELinuxContext"), "-")
+	if v := get("CapabilityBoundingSet"); v != "" {
+		caps := &types.Capabilities{}
+		for _, line := range strings.Split(v, "\n") {
+			if rest, ok := strings.CutPrefix(line, "~"); ok {
+				caps.Drop = append(caps.Drop, strings.Fields(rest)...)
+			} else {
+				caps.Keep = append(caps.Keep, strings.Fields(line)...)
+			}
+		}
+		req.Capabilities = caps
+	}
+
+	env := make(map[string]string)
+	for _, file := range strings.Split(get("EnvironmentFile"), "\n") {
+		if file == "" {
+			continue
+		}
+		optional := strings.HasPrefix(file, "-")
+		if err := readEnvironmentFile(strings.TrimPrefix(file, "-"), env); err != nil {
+			if optional && os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("EnvironmentFile: %w", err)
+		}
+	}
+	for _, line := range strings.Split(get("Environment"), "\n") {
+		words, err := splitCommand(line)
+		if err != nil {
+			return fmt.Errorf("Environment: %w", err)
+		}
+		for _, word := range words {
+			if k, v, ok := strings.Cut(word, "="); ok {
+				env[k] = v
+			}
+		}
+	}
+	if len(env) > 0 {
+		req.Env = env
+	}
+
+	for _, key := range []string{"ExecStartPre", "ExecStartPost", "ExecStop", "ExecReload"} {
+		if service.Values[key] != "" {
+			result.warnf("%s: %s is not supported", name, key)
+		}
+	}
+	if t := get("Type"); t == "forking" || t == "oneshot" {
+		result.warnf("%s: Type=%s is not supported, the command must stay in the foreground", name, t)
+	}
+
+	result.Processes = append(result.Processes, req)
+	return nil
+}
+
+// readEnvironmentFile reads KEY=VALUE lines of a systemd environment file
+func readEnvironmentFile(path string, env map[string]string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		env[strings.TrimSpace(k)] = v
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,422 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/PrismManager/gemstone/internal/cron"
+	"github.com/PrismManager/gemstone/internal/secrets"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// Severities of issues
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// minWaitTimeout is the wait_for timeout below which dependencies rarely
+// have a chance to come up
+const minWaitTimeout = 5 * time.Second
+
+// Issue is a problem found in a process definition
+type Issue struct {
+	File     string `json:"file"`
+	Process  string `json:"process,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (i Issue) String() string {
+	where := i.File
+	if i.Process != "" {
+		where += ": " + i.Process
+	}
+	if i.Field != "" {
+		where += "." + i.Field
+	}
+	return fmt.Sprintf("%s: %s: %s", where, i.Severity, i.Message)
+}
+
+// ParseFile reads a YAML or JSON document in the format of apply requests.
+// Unknown fields are rejected so typos don't go unnoticed.
+func ParseFile(path string) (*types.ApplyRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML is a superset of JSON. Decode into generic values first so the
+	// json field names of the API apply to both.
+	var generic interface{}
+	if err := yaml.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	data, err = json.Marshal(generic)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var doc types.ApplyRequest
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// linter collects the issues of one file
+type linter struct {
+	file   string
+	issues []Issue
+}
+
+func (l *linter) add(severity, process, field, format string, args ...interface{}) {
+	l.issues = append(l.issues, Issue{
+		File:     l.file,
+		Process:  process,
+		Field:    field,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Check looks for mistakes in the processes of a document. The host the
+// check runs on is used to resolve commands, users and directories.
+func Check(file string, doc *types.ApplyRequest) []Issue {
+	l := &linter{file: file}
+
+	names := make(map[string]bool)
+	for _, p := range doc.Processes {
+		key := p.Namespace + "/" + p.Name
+		switch {
+		case p.Name == "":
+			l.add(SeverityError, "", "name", "process without a name")
+		case names[key]:
+			l.add(SeverityError, p.Name, "name", "defined more than once")
+		}
+		names[key] = true
+
+		l.checkProcess(p)
+	}
+
+	l.checkPorts(doc.Processes)
+	l.checkDependencies(doc.Processes)
+
+	return l.issues
+}
+
+func (l *linter) checkProcess(p types.StartRequest) {
+	if s := p.Source; s != nil {
+		// The working directory is in a checkout that doesn't exist yet
+		if s.Git == "" {
+			l.add(SeverityError, p.Name, "source.git", "no repository")
+		}
+		if filepath.IsAbs(p.WorkDir) {
+			l.add(SeverityError, p.Name, "work_dir", "%s must be relative to the checkout of source", p.WorkDir)
+		}
+	} else if p.WorkDir != "" {
+		if !filepath.IsAbs(p.WorkDir) {
+			l.add(SeverityWarning, p.Name, "work_dir", "%s is relative to the daemon's directory", p.WorkDir)
+		}
+		if info, err := os.Stat(p.WorkDir); err != nil {
+			l.add(SeverityError, p.Name, "work_dir", "%s does not exist", p.WorkDir)
+		} else if !info.IsDir() {
+			l.add(SeverityError, p.Name, "work_dir", "%s is not a directory", p.WorkDir)
+		}
+	}
+
+	l.checkCommand(p)
+
+	if p.Homepage != "" {
+		if u, err := url.Parse(p.Homepage); err != nil || u.Scheme == "" || u.Host == "" {
+			l.add(SeverityWarning, p.Name, "homepage", "%q is not an absolute URL", p.Homepage)
+		}
+	}
+
+	switch {
+	case p.Instances < 0:
+		l.add(SeverityError, p.Name, "instances", "must not be negative")
+	case p.Instances > 1 && (len(p.Ports) > 0 || (p.Network != nil && len(p.Network.Publish) > 0)):
+		l.add(SeverityWarning, p.Name, "instances", "all %d instances get the same ports", p.Instances)
+	}
+	for i, rule := range p.Scale {
+		field := fmt.Sprintf("scale[%d]", i)
+		if _, err := cron.Parse(rule.Schedule); err != nil {
+			l.add(SeverityError, p.Name, field, "%v", err)
+		}
+		if rule.Instances < 1 {
+			l.add(SeverityError, p.Name, field, "instances must be at least 1")
+		}
+	}
+
+	if p.User != "" {
+		if _, err := lookupUser(p.User); err != nil {
+			l.add(SeverityError, p.Name, "user", "user %s does not exist", p.User)
+		}
+	}
+	if p.Group != "" {
+		if _, err := lookupGroup(p.Group); err != nil {
+			l.add(SeverityError, p.Name, "group", "group %s does not exist", p.Group)
+		}
+	}
+
+	for field, path := range map[string]string{"restart_policy": p.RestartPolicy, "seccomp": p.Seccomp} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			l.add(SeverityError, p.Name, field, "%s does not exist", path)
+		}
+	}
+
+	if p.Schedule != "" {
+		if _, err := cron.Parse(p.Schedule); err != nil {
+			l.add(SeverityError, p.Name, "schedule", "%v", err)
+		}
+	}
+
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil {
+			l.add(SeverityError, p.Name, "timezone", "unknown timezone %s", p.Timezone)
+		}
+	}
+	if strings.ContainsAny(p.Locale, "= \t\n") {
+		l.add(SeverityError, p.Name, "locale", "invalid locale %q", p.Locale)
+	}
+
+	for k, v := range p.Env {
+		if err := secrets.Validate(v); err != nil {
+			l.add(SeverityError, p.Name, "env", "%s: %v", k, err)
+		}
+	}
+
+	if w := p.WaitFor; w != nil {
+		if _, _, err := net.SplitHostPort(w.TCP); err != nil {
+			l.add(SeverityError, p.Name, "wait_for.tcp", "%q is not host:port", w.TCP)
+		}
+		if w.Timeout != "" {
+			d, err := time.ParseDuration(w.Timeout)
+			switch {
+			case err != nil || d <= 0:
+				l.add(SeverityError, p.Name, "wait_for.timeout", "invalid duration %q", w.Timeout)
+			case d < minWaitTimeout:
+				l.add(SeverityWarning, p.Name, "wait_for.timeout", "%s is suspiciously low, the process errors if the dependency isn't up by then", d)
+			}
+		}
+	}
+
+	for _, path := range p.MonitorPaths {
+		if !filepath.IsAbs(path) {
+			l.add(SeverityError, p.Name, "monitor_paths", "%s must be absolute", path)
+		} else if _, err := os.Stat(path); err != nil {
+			l.add(SeverityWarning, p.Name, "monitor_paths", "%s does not exist yet", path)
+		}
+	}
+	if p.DiskAlert > 0 && len(p.MonitorPaths) == 0 {
+		l.add(SeverityError, p.Name, "disk_alert", "disk_alert is set without monitor_paths")
+	}
+
+	if w := p.OutputWatchdog; w != nil {
+		if d, err := time.ParseDuration(w.Timeout); err != nil || d <= 0 {
+			l.add(SeverityError, p.Name, "output_watchdog.timeout", "invalid duration %q", w.Timeout)
+		}
+		if w.Restart && p.MaxRestarts == 0 {
+			l.add(SeverityWarning, p.Name, "output_watchdog.restart", "max_restarts is 0, so the watchdog never restarts the process")
+		}
+	}
+
+	if sb := p.Standby; sb != nil && sb.Warmup != "" {
+		if d, err := time.ParseDuration(sb.Warmup); err != nil || d < 0 {
+			l.add(SeverityError, p.Name, "standby.warmup", "invalid duration %q", sb.Warmup)
+		}
+	}
+
+	for _, port := range p.Ports {
+		number := port
+		if _, pp, err := net.SplitHostPort(port); err == nil {
+			number = pp
+		}
+		if n, err := strconv.Atoi(number); err != nil || n < 1 || n > 65535 {
+			l.add(SeverityError, p.Name, "ports", "%q is not a port or host:port", port)
+		}
+	}
+
+	if p.AutoRestart && p.MaxRestarts == 0 {
+		l.add(SeverityWarning, p.Name, "max_restarts", "auto_restart is set but max_restarts is 0, so the process is never restarted")
+	}
+	if p.OOMScoreAdj < -1000 || p.OOMScoreAdj > 1000 {
+		l.add(SeverityError, p.Name, "oom_score_adj", "%d is not between -1000 and 1000", p.OOMScoreAdj)
+	}
+	if r := p.Reserve; r != nil && (r.CPU < 0 || r.Memory < 0) {
+		l.add(SeverityError, p.Name, "reserve", "cpu and memory must not be negative")
+	}
+}
+
+// checkCommand checks that the command resolves to an executable file the
+// way the daemon resolves it: through PATH without a slash, otherwise
+// relative to the working directory
+func (l *linter) checkCommand(p types.StartRequest) {
+	if f := p.Fetch; f != nil {
+		if p.Command != "" {
+			l.add(SeverityError, p.Name, "command", "command is set along with fetch, which provides it")
+		}
+		if u, err := url.Parse(f.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			l.add(SeverityError, p.Name, "fetch.url", "invalid url %q, expected http or https", f.URL)
+		} else if u.Scheme == "http" {
+			l.add(SeverityWarning, p.Name, "fetch.url", "%s is fetched over plain http", f.URL)
+		}
+		if len(f.SHA256) != 64 || strings.Trim(strings.ToLower(f.SHA256), "0123456789abcdef") != "" {
+			l.add(SeverityError, p.Name, "fetch.sha256", "invalid sha256 %q, expected 64 hex digits", f.SHA256)
+		}
+		return
+	}
+	if p.Command == "" {
+		l.add(SeverityError, p.Name, "command", "no command")
+		return
+	}
+	if strings.ContainsAny(p.Command, " \t") && len(p.Args) == 0 {
+		l.add(SeverityWarning, p.Name, "command", "%q contains spaces, put arguments in args, the command isn't run by a shell", p.Command)
+	}
+
+	path := p.Command
+	if !strings.Contains(path, "/") {
+		if _, err := exec.LookPath(path); err != nil {
+			l.add(SeverityError, p.Name, "command", "%s is not found in PATH", path)
+		}
+		return
+	}
+	if !filepath.IsAbs(path) && p.Source != nil {
+		// Relative to a checkout that doesn't exist yet
+		return
+	}
+	if !filepath.IsAbs(path) && p.WorkDir != "" {
+		path = filepath.Join(p.WorkDir, path)
+	}
+
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		l.add(SeverityError, p.Name, "command", "%s does not exist", path)
+	case info.IsDir():
+		l.add(SeverityError, p.Name, "command", "%s is a directory", path)
+	case info.Mode()&0111 == 0:
+		l.add(SeverityError, p.Name, "command", "%s is not executable", path)
+	}
+}
+
+// checkPorts reports host ports published by more than one process
+func (l *linter) checkPorts(processes []types.StartRequest) {
+	owners := make(map[string]string)
+	for _, p := range processes {
+		if p.Network == nil {
+			continue
+		}
+		for _, publish := range p.Network.Publish {
+			port, ok := hostPort(publish)
+			if !ok {
+				l.add(SeverityError, p.Name, "network.publish", "invalid publish %q, expected [host_ip:]host_port:port", publish)
+				continue
+			}
+			if owner, taken := owners[port]; taken && owner != p.Name {
+				l.add(SeverityError, p.Name, "network.publish", "host port %s is also published by %s", port, owner)
+				continue
+			}
+			owners[port] = p.Name
+		}
+	}
+}
+
+// checkDependencies reports processes whose wait_for gates wait on each
+// other through published ports, which never start
+func (l *linter) checkDependencies(processes []types.StartRequest) {
+	publishers := make(map[string]string)
+	for _, p := range processes {
+		if p.Network == nil {
+			continue
+		}
+		for _, publish := range p.Network.Publish {
+			// Conflicting publishes are reported by checkPorts
+			if port, ok := hostPort(publish); ok && publishers[port] == "" {
+				publishers[port] = p.Name
+			}
+		}
+	}
+
+	waitsOn := make(map[string]string)
+	for _, p := range processes {
+		if p.WaitFor == nil {
+			continue
+		}
+		if _, port, err := net.SplitHostPort(p.WaitFor.TCP); err == nil {
+			if publisher, ok := publishers[port]; ok {
+				waitsOn[p.Name] = publisher
+			}
+		}
+	}
+
+	reported := make(map[string]bool)
+	for _, p := range processes {
+		chain := []string{p.Name}
+		seen := map[string]bool{p.Name: true}
+		for next, ok := waitsOn[p.Name]; ok; next, ok = waitsOn[next] {
+			chain = append(chain, next)
+			if next == p.Name {
+				if !reported[p.Name] {
+					for _, name := range chain {
+						reported[name] = true
+					}
+					l.add(SeverityError, p.Name, "wait_for", "circular dependency: %s", strings.Join(chain, " -> "))
+				}
+				break
+			}
+			if seen[next] {
+				break
+			}
+			seen[next] = true
+		}
+	}
+}
+
+// hostPort returns the host port of a [host_ip:]host_port:port publish
+func hostPort(publish string) (string, bool) {
+	parts := strings.Split(publish, ":")
+	if len(parts) < 2 {
+		return "", false
+	}
+	port := parts[len(parts)-2]
+	for _, p := range parts[len(parts)-2:] {
+		if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+			return "", false
+		}
+	}
+	return port, true
+}
+
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return user.LookupId(name)
+	}
+	return user.Lookup(name)
+}
+
+func lookupGroup(name string) (*user.Group, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return user.LookupGroupId(name)
+	}
+	return user.LookupGroup(name)
+}
@@ -0,0 +1,125 @@
+package logger
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// openFiles limits the log files held open by all loggers
+var openFiles = &fileBudget{
+	loggers: make(map[*ProcessLogger]int),
+	kick:    make(chan struct{}, 1),
+}
+
+// fileBudget counts the open log files of each logger. Its lock is never
+// held while taking the lock of a logger.
+type fileBudget struct {
+	mu      sync.Mutex
+	max     int
+	open    int
+	loggers map[*ProcessLogger]int
+	kick    chan struct{}
+	started bool
+	warned  bool
+}
+
+// SetMaxOpenFiles limits the log files held open by all loggers. Beyond it
+// the files of the loggers written least recently are closed, to be opened
+// again on their next write. 0 removes the limit.
+func SetMaxOpenFiles(n int) {
+	b := openFiles
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.max = n
+	if n > 0 && !b.started {
+		b.started = true
+		go b.evictLoop()
+	}
+}
+
+// OpenFiles returns the number of log files held open
+func OpenFiles() int {
+	openFiles.mu.Lock()
+	defer openFiles.mu.Unlock()
+	return openFiles.open
+}
+
+func (b *fileBudget) opened(l *ProcessLogger) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.open++
+	b.loggers[l]++
+	if b.max > 0 && b.open > b.max {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *fileBudget) closed(l *ProcessLogger) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.open--
+	if b.loggers[l]--; b.loggers[l] <= 0 {
+		delete(b.loggers, l)
+	}
+}
+
+// evictLoop closes the files of the least recently written loggers until
+// the budget is kept again, leaving some room so it doesn't run on every
+// open
+func (b *fileBudget) evictLoop() {
+	for range b.kick {
+		b.mu.Lock()
+		target := b.max - b.max/10
+		excess := b.open - target
+		loggers := make([]*ProcessLogger, 0, len(b.loggers))
+		for l := range b.loggers {
+			loggers = append(loggers, l)
+		}
+		if excess > 0 && !b.warned {
+			b.warned = true
+			fmt.Printf("Warning: %d log files open, over the budget of %d, closing idle ones\n", b.open, b.max)
+		}
+		b.mu.Unlock()
+
+		if excess <= 0 {
+			continue
+		}
+
+		sort.Slice(loggers, func(i, j int) bool {
+			return loggers[i].lastWrite.Load() < loggers[j].lastWrite.Load()
+		})
+		for _, l := range loggers {
+			if excess <= 0 {
+				break
+			}
+			excess -= l.closeFiles()
+		}
+	}
+}
+
+// closeFiles writes the pending lines and closes the open log files, which
+// are opened again on the next write. It returns how many were closed.
+func (l *ProcessLogger) closeFiles() int {
+	l.Flush()
+
+	l.flushMu.Lock()
+	defer l.flushMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	closed := 0
+	for _, f := range l.files() {
+		if f.file != nil {
+			f.close()
+			closed++
+		}
+	}
+	return closed
+}
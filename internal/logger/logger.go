@@ -3,132 +3,401 @@ package logger
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
 )
 
+// runMarker prefixes the structured line written to every log file when a
+// new run (generation) of the process starts
+const runMarker = "[RUN] generation="
+
+// timestampFormat is the format of the timestamp starting every line
+const timestampFormat = "2006-01-02 15:04:05.000000"
+
 // ProcessLogger handles logging for a process
 type ProcessLogger struct {
 	mu       sync.Mutex
 	id       string
 	name     string
 	logDir   string
-	stdout   *os.File
-	stderr   *os.File
-	combined *os.File
+	stdout   *logFile
+	stderr   *logFile
+	combined *logFile
+	pipe     *logPipe
+
+	// streams are the subscribers following the files live
+	streams        map[*Stream]struct{}
+	streamsDropped uint64
+
+	// flushMu serializes writing pending lines and replacing the files,
+	// it is taken before mu
+	flushMu   sync.Mutex
+	opts      WriteOptions
+	flushNow  chan struct{}
+	flushStop chan struct{}
+	flushDone chan struct{}
+
+	// lastWrite is when a line was last logged, in Unix nanoseconds
+	lastWrite atomic.Int64
+	// seq is the sequence number of the last line written
+	seq uint64
+
+	linesCaptured uint64
+	bytesWritten  uint64
+	rotations     uint64
+
+	// closed is set by Close, after which lines are dropped and the files
+	// aren't opened again
+	closed bool
 }
 
-// NewProcessLogger creates a new process logger
+// NewProcessLogger creates a new process logger. The log files are opened
+// on the first write.
 func NewProcessLogger(id, name, logDir string) (*ProcessLogger, error) {
 	processLogDir := filepath.Join(logDir, fmt.Sprintf("%s-%s", name, id))
 	if err := os.MkdirAll(processLogDir, 0755); err != nil {
 		return nil, err
 	}
 
-	stdout, err := os.OpenFile(
-		filepath.Join(processLogDir, "stdout.log"),
-		os.O_CREATE|os.O_APPEND|os.O_WRONLY,
-		0644,
-	)
-	if err != nil {
-		return nil, err
+	l := &ProcessLogger{
+		id:     id,
+		name:   name,
+		logDir: processLogDir,
 	}
+	l.stdout = &logFile{owner: l, path: filepath.Join(processLogDir, "stdout.log")}
+	l.stderr = &logFile{owner: l, path: filepath.Join(processLogDir, "stderr.log")}
+	l.combined = &logFile{owner: l, path: filepath.Join(processLogDir, "combined.log")}
+	l.seq = l.recoverSeq()
+	return l, nil
+}
 
-	stderr, err := os.OpenFile(
-		filepath.Join(processLogDir, "stderr.log"),
-		os.O_CREATE|os.O_APPEND|os.O_WRONLY,
-		0644,
-	)
-	if err != nil {
-		stdout.Close()
-		return nil, err
+// Log writes a log entry. With buffering it is only queued for the next
+// flush.
+func (l *ProcessLogger) Log(logType, message string) {
+	var file *logFile
+	var tag string
+	switch logType {
+	case "stdout":
+		file, tag = l.stdout, "[OUT]"
+	case "stderr":
+		file, tag = l.stderr, "[ERR]"
+	default:
+		return
 	}
 
-	combined, err := os.OpenFile(
-		filepath.Join(processLogDir, "combined.log"),
-		os.O_CREATE|os.O_APPEND|os.O_WRONLY,
-		0644,
-	)
-	if err != nil {
-		stdout.Close()
-		stderr.Close()
-		return nil, err
+	now := time.Now()
+	l.lastWrite.Store(now.UnixNano())
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	if l.opts.Redact != nil {
+		message = l.opts.Redact.Redact(message)
+	}
+	prefix := l.linePrefix(now)
+	line := fmt.Sprintf("%s %s\n", prefix, message)
+	combinedLine := fmt.Sprintf("%s %s %s\n", prefix, tag, message)
+	buffered := l.buffered()
+	n := file.write(line, buffered)
+	m := l.combined.write(combinedLine, buffered)
+	wait := l.written(file)
+	wait = l.written(l.combined) || wait
+
+	l.linesCaptured++
+	l.bytesWritten += uint64(n + m)
+
+	if l.pipe != nil {
+		l.pipe.Write(combinedLine)
 	}
+	if len(l.streams) > 0 {
+		l.publish(logType, strings.TrimSuffix(line, "\n"))
+		l.publish("combined", strings.TrimSuffix(combinedLine, "\n"))
+	}
+	l.mu.Unlock()
 
-	return &ProcessLogger{
-		id:       id,
-		name:     name,
-		logDir:   processLogDir,
-		stdout:   stdout,
-		stderr:   stderr,
-		combined: combined,
-	}, nil
+	// The flushes fall behind, write the lines before capturing more
+	if wait {
+		l.Flush()
+	}
 }
 
-// Log writes a log entry
-func (l *ProcessLogger) Log(logType, message string) {
+// Stats returns the counters of the log pipeline
+func (l *ProcessLogger) Stats() types.LogStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := types.LogStats{
+		LinesCaptured:      l.linesCaptured,
+		BytesWritten:       l.bytesWritten,
+		Rotations:          l.rotations,
+		StreamLinesDropped: l.streamStats(),
+	}
+	if l.pipe != nil {
+		stats.LinesDropped = l.pipe.Dropped()
+	}
+	return stats
+}
+
+// SetPipe configures an external command that receives every captured line
+// on stdin. An empty command removes the pipe.
+func (l *ProcessLogger) SetPipe(command string) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-	line := fmt.Sprintf("[%s] %s\n", timestamp, message)
+	if l.pipe != nil {
+		l.pipe.Close()
+		l.pipe = nil
+	}
 
-	switch logType {
-	case "stdout":
-		l.stdout.WriteString(line)
-		l.combined.WriteString(fmt.Sprintf("[%s] [OUT] %s\n", timestamp, message))
-	case "stderr":
-		l.stderr.WriteString(line)
-		l.combined.WriteString(fmt.Sprintf("[%s] [ERR] %s\n", timestamp, message))
+	if command != "" {
+		l.pipe = newLogPipe(command)
 	}
 }
 
-// GetLogs reads recent log entries
-func (l *ProcessLogger) GetLogs(lines int, logType string) ([]string, error) {
+// StartRun writes a restart marker carrying the generation ID to all log
+// files, starting a new log segment for that run
+func (l *ProcessLogger) StartRun(generation, pid int) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	var logFile string
-	switch logType {
-	case "stdout":
-		logFile = filepath.Join(l.logDir, "stdout.log")
-	case "stderr":
-		logFile = filepath.Join(l.logDir, "stderr.log")
-	default:
-		logFile = filepath.Join(l.logDir, "combined.log")
+	line := fmt.Sprintf("%s %s%d pid=%d\n", l.linePrefix(time.Now()), runMarker, generation, pid)
+
+	for _, f := range l.files() {
+		f.write(line, l.buffered())
+		l.written(f)
+	}
+	for _, logType := range []string{"stdout", "stderr", "combined"} {
+		l.publish(logType, strings.TrimSuffix(line, "\n"))
 	}
+}
 
-	return readLastLines(logFile, lines)
+// Filter selects log lines matching a regular expression, or not matching
+// it if Invert is set
+type Filter struct {
+	Pattern *regexp.Regexp
+	Invert  bool
 }
 
-// Close closes all log files
-func (l *ProcessLogger) Close() error {
+// Match reports whether a line passes the filter. A nil filter passes every
+// line.
+func (f *Filter) Match(line string) bool {
+	if f == nil || f.Pattern == nil {
+		return true
+	}
+	return f.Pattern.MatchString(line) != f.Invert
+}
+
+// GetLogs reads recent log entries. If run is greater than zero, only the
+// lines belonging to that generation are returned. With a filter, the last
+// lines passing it are returned.
+func (l *ProcessLogger) GetLogs(lines int, logType string, run int, filter *Filter) ([]string, error) {
+	l.Flush()
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	logFile := l.logFile(logType)
+
+	if run > 0 {
+		return readRunLines(logFile, run, lines, filter)
+	}
+
+	return readLastLines(logFile, lines, filter)
+}
+
+// StreamLogs calls fn for each of the lines GetLogs returns without holding
+// them in memory. The files are read in two passes, counting and then
+// emitting, up to their size when the call started.
+func (l *ProcessLogger) StreamLogs(lines int, logType string, run int, filter *Filter, fn func(string) error) error {
+	l.Flush()
+
+	l.mu.Lock()
+	paths := []string{l.logFile(logType)}
 	var err error
-	if l.stdout != nil {
-		if e := l.stdout.Close(); e != nil {
-			err = e
+	if run > 0 {
+		paths, err = runLogFiles(paths[0])
+	}
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	var files []*os.File
+	var sizes []int64
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			// Rotated files may be archived away meanwhile
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
 		}
+		files = append(files, file)
+
+		// Lines written while streaming are left for the next read
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		sizes = append(sizes, info.Size())
 	}
-	if l.stderr != nil {
-		if e := l.stderr.Close(); e != nil {
-			err = e
+
+	scan := func(fn func(string) error) error {
+		current := 0
+		for i, file := range files {
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			if err := scanLines(io.LimitReader(file, sizes[i]), run, &current, filter, fn); err != nil {
+				return err
+			}
 		}
+		return nil
 	}
-	if l.combined != nil {
-		if e := l.combined.Close(); e != nil {
+
+	skip := 0
+	if lines > 0 {
+		total := 0
+		err := scan(func(string) error {
+			total++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		skip = max(total-lines, 0)
+	}
+
+	return scan(func(line string) error {
+		if skip > 0 {
+			skip--
+			return nil
+		}
+		return fn(line)
+	})
+}
+
+// runLogFiles returns the rotated files of a log, oldest first, followed by
+// the active one, since the output of a run may have been rotated out
+func runLogFiles(active string) ([]string, error) {
+	rotated, err := filepath.Glob(active + ".*")
+	if err != nil {
+		return nil, err
+	}
+	// Rotated files carry a sortable timestamp suffix, newest last
+	sort.Strings(rotated)
+	return append(rotated, active), nil
+}
+
+// scanLines calls fn for the lines matching filter, only those of a
+// generation if run is positive. current is the generation of the lines
+// read so far, carried over between the files of a log.
+func scanLines(r io.Reader, run int, current *int, filter *Filter, fn func(string) error) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if run > 0 {
+			if gen, ok := parseRunMarker(line); ok {
+				*current = gen
+			}
+			if *current != run {
+				continue
+			}
+		}
+		if filter.Match(line) {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// LogFilePath returns the path of a log file. A rotation of 0 selects the
+// active file, 1 the most recently rotated file and so on.
+func (l *ProcessLogger) LogFilePath(logType string, rotation int) (string, error) {
+	active := l.logFile(logType)
+	if rotation <= 0 {
+		// The file is read by the caller
+		l.Flush()
+		return active, nil
+	}
+
+	matches, err := filepath.Glob(active + ".*")
+	if err != nil {
+		return "", err
+	}
+
+	// Rotated files carry a sortable timestamp suffix, newest last
+	sort.Strings(matches)
+	if rotation > len(matches) {
+		return "", fmt.Errorf("rotation %d not found, %d rotated files available", rotation, len(matches))
+	}
+
+	return matches[len(matches)-rotation], nil
+}
+
+// logFile returns the path of the log file for a log type
+func (l *ProcessLogger) logFile(logType string) string {
+	switch logType {
+	case "stdout":
+		return filepath.Join(l.logDir, "stdout.log")
+	case "stderr":
+		return filepath.Join(l.logDir, "stderr.log")
+	default:
+		return filepath.Join(l.logDir, "combined.log")
+	}
+}
+
+// Close writes the pending lines and closes all log files
+func (l *ProcessLogger) Close() error {
+	l.stopFlusher()
+	l.Flush()
+
+	l.flushMu.Lock()
+	defer l.flushMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.pipe != nil {
+		l.pipe.Close()
+		l.pipe = nil
+	}
+	l.closeStreams()
+
+	err := l.saveSeq()
+	for _, f := range l.files() {
+		if e := f.close(); e != nil {
 			err = e
 		}
 	}
+
+	// Lines logged after closing are dropped
+	l.opts = WriteOptions{}
+	l.closed = true
 	return err
 }
 
 // readLastLines reads the last n lines from a file
-func readLastLines(path string, n int) ([]string, error) {
+func readLastLines(path string, n int, filter *Filter) ([]string, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -141,7 +410,9 @@ func readLastLines(path string, n int) ([]string, error) {
 	var lines []string
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+		if line := scanner.Text(); filter.Match(line) {
+			lines = append(lines, line)
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -155,12 +426,76 @@ func readLastLines(path string, n int) ([]string, error) {
 	return lines[len(lines)-n:], nil
 }
 
+// readRunLines reads the last n lines of the segment for a generation, from
+// the rotated files of the log and the active one
+func readRunLines(path string, run, n int, filter *Filter) ([]string, error) {
+	paths, err := runLogFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+	current := 0
+	for _, p := range paths {
+		file, err := os.Open(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		err = scanLines(file, run, &current, filter, func(line string) error {
+			lines = append(lines, line)
+			return nil
+		})
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if n <= 0 || n >= len(lines) {
+		return lines, nil
+	}
+
+	return lines[len(lines)-n:], nil
+}
+
+// parseRunMarker extracts the generation from a restart marker line
+func parseRunMarker(line string) (int, bool) {
+	// The marker always directly follows the timestamp, so process output
+	// that happens to contain the marker text is not mistaken for one
+	idx := strings.Index(line, "] ")
+	if idx < 0 || !strings.HasPrefix(line[idx+2:], runMarker) {
+		return 0, false
+	}
+
+	rest := line[idx+2+len(runMarker):]
+	if end := strings.IndexByte(rest, ' '); end >= 0 {
+		rest = rest[:end]
+	}
+
+	gen, err := strconv.Atoi(rest)
+	if err != nil {
+		return 0, false
+	}
+	return gen, true
+}
+
 // RotateLogs rotates log files if they exceed the size limit
 func (l *ProcessLogger) RotateLogs(maxSizeMB int) error {
+	l.Flush()
+
+	l.flushMu.Lock()
+	defer l.flushMu.Unlock()
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if l.closed {
+		return nil
+	}
 	maxSize := int64(maxSizeMB * 1024 * 1024)
+	rotated := false
 
 	for _, logName := range []string{"stdout.log", "stderr.log", "combined.log"} {
 		logPath := filepath.Join(l.logDir, logName)
@@ -176,25 +511,29 @@ func (l *ProcessLogger) RotateLogs(maxSizeMB int) error {
 				return err
 			}
 
-			// Recreate the log file
-			newFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY, 0644)
-			if err != nil {
-				return err
-			}
-
+			var f *logFile
 			switch logName {
 			case "stdout.log":
-				l.stdout.Close()
-				l.stdout = newFile
+				f = l.stdout
 			case "stderr.log":
-				l.stderr.Close()
-				l.stderr = newFile
+				f = l.stderr
 			case "combined.log":
-				l.combined.Close()
-				l.combined = newFile
+				f = l.combined
 			}
+			// Recreate the log file
+			f.close()
+			if _, err := f.open(); err != nil {
+				return err
+			}
+
+			l.rotations++
+			rotated = true
 		}
 	}
 
+	// The active files may stay empty until the daemon restarts
+	if rotated {
+		return l.saveSeq()
+	}
 	return nil
 }
@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// pipeBufferSize is the number of lines buffered for a log pipe before
+// new lines are dropped
+const pipeBufferSize = 1024
+
+// logPipe feeds captured lines to the stdin of an external command
+type logPipe struct {
+	mu      sync.Mutex
+	command string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	lines   chan string
+	done    chan struct{}
+	dropped uint64
+}
+
+// newLogPipe creates a log pipe running the command through the shell
+func newLogPipe(command string) *logPipe {
+	p := &logPipe{
+		command: command,
+		lines:   make(chan string, pipeBufferSize),
+		done:    make(chan struct{}),
+	}
+
+	go p.run()
+
+	return p
+}
+
+// Write queues a line for the pipe. Lines are dropped instead of blocking
+// the capture goroutines when the pipe falls behind.
+func (p *logPipe) Write(line string) {
+	select {
+	case p.lines <- line:
+	default:
+		p.mu.Lock()
+		p.dropped++
+		p.mu.Unlock()
+	}
+}
+
+// Dropped returns the number of lines dropped because the pipe was full
+func (p *logPipe) Dropped() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dropped
+}
+
+// Close stops the pipe command
+func (p *logPipe) Close() {
+	close(p.done)
+}
+
+func (p *logPipe) run() {
+	defer p.stop()
+
+	for {
+		select {
+		case line := <-p.lines:
+			if p.stdin == nil {
+				if err := p.start(); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to start log pipe %q: %v\n", p.command, err)
+					// Back off so a broken command doesn't spin
+					time.Sleep(time.Second)
+					continue
+				}
+			}
+
+			if _, err := io.WriteString(p.stdin, line); err != nil {
+				// The command exited, restart it on the next line
+				p.stop()
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *logPipe) start() error {
+	cmd := exec.Command("/bin/sh", "-c", p.command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	p.cmd = cmd
+	p.stdin = stdin
+	return nil
+}
+
+func (p *logPipe) stop() {
+	if p.stdin != nil {
+		p.stdin.Close()
+		p.stdin = nil
+	}
+	if p.cmd != nil {
+		_ = p.cmd.Wait()
+		p.cmd = nil
+	}
+}
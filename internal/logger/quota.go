@@ -0,0 +1,58 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// RotatedFile describes a rotated log file on disk
+type RotatedFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// RotatedFiles returns the rotated log files of the process, oldest first
+func (l *ProcessLogger) RotatedFiles() ([]RotatedFile, error) {
+	matches, err := filepath.Glob(filepath.Join(l.logDir, "*.log.*"))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]RotatedFile, 0, len(matches))
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, RotatedFile{
+			Path:    path,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime.Before(files[j].ModTime)
+	})
+	return files, nil
+}
+
+// DiskUsage returns the total size in bytes of all log files of the process
+func (l *ProcessLogger) DiskUsage() int64 {
+	return DirSize(l.logDir)
+}
+
+// DirSize returns the total size in bytes of regular files below dir
+func DirSize(dir string) int64 {
+	var total int64
+	_ = filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// defaultRedactMask replaces matches of rules without a mask
+const defaultRedactMask = "[REDACTED]"
+
+// redactPresets are the built-in patterns for common secrets and personal
+// data
+var redactPresets = map[string]string{
+	"email":          `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	"ipv4":           `\b(?:(?:25[0-5]|2[0-4][0-9]|1?[0-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1?[0-9]?[0-9])\b`,
+	"bearer":         `(?i)\bbearer\s+[A-Za-z0-9._~+/-]+=*`,
+	"jwt":            `\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`,
+	"aws_access_key": `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+}
+
+// RedactPreset returns the pattern of a built-in preset
+func RedactPreset(name string) (string, bool) {
+	pattern, ok := redactPresets[name]
+	return pattern, ok
+}
+
+// Redactor masks the matches of its rules in log lines
+type Redactor struct {
+	rules []redactRule
+}
+
+type redactRule struct {
+	pattern *regexp.Regexp
+	mask    string
+}
+
+// Add adds a rule masking the matches of a regular expression. The mask
+// may refer to groups of the pattern as ${1}; empty masks with
+// "[REDACTED]".
+func (r *Redactor) Add(pattern, mask string) error {
+	if pattern == "" {
+		return fmt.Errorf("no pattern")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	if mask == "" {
+		mask = defaultRedactMask
+	}
+	r.rules = append(r.rules, redactRule{pattern: re, mask: mask})
+	return nil
+}
+
+// Redact returns the line with the matches of all rules masked, in the
+// order the rules were added
+func (r *Redactor) Redact(line string) string {
+	for _, rule := range r.rules {
+		line = rule.pattern.ReplaceAllString(line, rule.mask)
+	}
+	return line
+}
@@ -0,0 +1,158 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// seqFile holds the last sequence number in the log directory, for when
+// the active files are empty after a rotation
+const seqFile = "sequence"
+
+// seqTail is how much of the end of the combined log is read to recover
+// the last sequence number
+const seqTail = 64 * 1024
+
+// linePrefix returns the timestamp and the next sequence number that start
+// a line, e.g. "[2026-01-12 10:04:51.201337 #42]". The caller must hold
+// l.mu.
+func (l *ProcessLogger) linePrefix(now time.Time) string {
+	l.seq++
+	return fmt.Sprintf("[%s #%d]", now.Format(timestampFormat), l.seq)
+}
+
+// LineSeq returns the sequence number of a log line, 0 for lines written
+// before lines were numbered
+func LineSeq(line string) uint64 {
+	end := strings.Index(line, "] ")
+	if !strings.HasPrefix(line, "[") || end < 0 {
+		return 0
+	}
+	i := strings.LastIndex(line[:end], " #")
+	if i < 0 {
+		return 0
+	}
+	seq, err := strconv.ParseUint(line[i+2:end], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return seq
+}
+
+// recoverSeq returns the last sequence number written by an earlier
+// logger of the process, from the end of the combined log or the sequence
+// file saved when it was rotated
+func (l *ProcessLogger) recoverSeq() uint64 {
+	var seq uint64
+	if data, err := os.ReadFile(filepath.Join(l.logDir, seqFile)); err == nil {
+		seq, _ = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	}
+
+	file, err := os.Open(l.combined.path)
+	if err != nil {
+		return seq
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil && info.Size() > seqTail {
+		if _, err := file.Seek(-seqTail, io.SeekEnd); err != nil {
+			return seq
+		}
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		seq = max(seq, LineSeq(scanner.Text()))
+	}
+	return seq
+}
+
+// saveSeq writes the last sequence number to the sequence file. The caller
+// must hold l.mu.
+func (l *ProcessLogger) saveSeq() error {
+	return os.WriteFile(filepath.Join(l.logDir, seqFile), []byte(fmt.Sprintf("%d\n", l.seq)), 0644)
+}
+
+// StreamAfter calls fn for the lines of a log with a sequence number above
+// after that pass filter, oldest first. Rotated files are read too unless
+// the active file already starts at or before after.
+func (l *ProcessLogger) StreamAfter(logType string, after uint64, filter *Filter, fn func(string) error) error {
+	l.Flush()
+
+	active := l.logFile(logType)
+	rotated, err := filepath.Glob(active + ".*")
+	if err != nil {
+		return err
+	}
+	// Rotated files carry a sortable timestamp suffix, newest last
+	sort.Strings(rotated)
+	paths := append(rotated, active)
+
+	// The first file that starts at or before after holds the next line
+	start := 0
+	for i := len(paths) - 1; i >= 0; i-- {
+		if first, ok := firstSeq(paths[i]); ok && first <= after {
+			start = i
+			break
+		}
+	}
+
+	for _, path := range paths[start:] {
+		if err := streamFileAfter(path, after, filter, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// firstSeq returns the sequence number of the first line of a file, 0 for
+// a file written before lines were numbered. ok is false for an empty or
+// missing file.
+func firstSeq(path string) (seq uint64, ok bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return 0, false
+	}
+	return LineSeq(scanner.Text()), true
+}
+
+// streamFileAfter calls fn for the lines of a file numbered above after
+// that pass filter, up to the size of the file when the call started
+func streamFileAfter(path string, after uint64, filter *Filter, fn func(string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(io.LimitReader(file, info.Size()))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if LineSeq(line) > after && filter.Match(line) {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
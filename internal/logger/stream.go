@@ -0,0 +1,157 @@
+package logger
+
+import "sync"
+
+// streamBufferSize is the number of lines buffered for a stream before the
+// oldest are dropped
+const streamBufferSize = 1024
+
+// Stream receives the lines of one log file as they are captured. A
+// consumer falling behind loses the oldest buffered lines instead of
+// holding up capture.
+type Stream struct {
+	logType string
+
+	mu      sync.Mutex
+	buf     []string
+	start   int
+	count   int
+	dropped uint64
+	closed  bool
+	ready   chan struct{}
+}
+
+func newStream(logType string) *Stream {
+	if logType != "stdout" && logType != "stderr" {
+		logType = "combined"
+	}
+	return &Stream{
+		logType: logType,
+		buf:     make([]string, streamBufferSize),
+		ready:   make(chan struct{}, 1),
+	}
+}
+
+// push queues a line, dropping the oldest one if the buffer is full
+func (s *Stream) push(line string) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	if s.count == len(s.buf) {
+		s.start = (s.start + 1) % len(s.buf)
+		s.count--
+		s.dropped++
+	}
+	s.buf[(s.start+s.count)%len(s.buf)] = line
+	s.count++
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Read waits until lines are buffered and returns all of them. ok is false
+// once the stream is closed and drained, or done is closed.
+func (s *Stream) Read(done <-chan struct{}) (lines []string, ok bool) {
+	for {
+		s.mu.Lock()
+		if s.count > 0 {
+			lines = make([]string, s.count)
+			for i := range lines {
+				j := (s.start + i) % len(s.buf)
+				lines[i] = s.buf[j]
+				s.buf[j] = ""
+			}
+			s.start, s.count = 0, 0
+			s.mu.Unlock()
+			return lines, true
+		}
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			return nil, false
+		}
+
+		select {
+		case <-s.ready:
+		case <-done:
+			return nil, false
+		}
+	}
+}
+
+// Dropped returns the number of lines dropped because the consumer fell
+// behind
+func (s *Stream) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// close ends the stream after the buffered lines
+func (s *Stream) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Subscribe returns a stream of the lines written to a log file from now on
+// and a function to unsubscribe
+func (l *ProcessLogger) Subscribe(logType string) (*Stream, func()) {
+	s := newStream(logType)
+
+	l.mu.Lock()
+	if l.streams == nil {
+		l.streams = make(map[*Stream]struct{})
+	}
+	l.streams[s] = struct{}{}
+	l.mu.Unlock()
+
+	return s, func() {
+		l.mu.Lock()
+		if _, ok := l.streams[s]; ok {
+			delete(l.streams, s)
+			l.streamsDropped += s.Dropped()
+		}
+		l.mu.Unlock()
+		s.close()
+	}
+}
+
+// publish hands a line written to a file to the streams of that file. The
+// caller must hold l.mu.
+func (l *ProcessLogger) publish(logType, line string) {
+	for s := range l.streams {
+		if s.logType == logType {
+			s.push(line)
+		}
+	}
+}
+
+// streamStats returns the lines dropped by all streams, past and present.
+// The caller must hold l.mu.
+func (l *ProcessLogger) streamStats() uint64 {
+	dropped := l.streamsDropped
+	for s := range l.streams {
+		dropped += s.Dropped()
+	}
+	return dropped
+}
+
+// closeStreams ends all streams. The caller must hold l.mu.
+func (l *ProcessLogger) closeStreams() {
+	for s := range l.streams {
+		l.streamsDropped += s.Dropped()
+		s.close()
+	}
+	l.streams = nil
+}
@@ -0,0 +1,211 @@
+package logger
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// maxPendingFactor bounds the lines pending for a file to this many times
+// the buffer size. Beyond it capture waits for a flush instead of growing
+// the buffer further.
+const maxPendingFactor = 16
+
+// errClosed is returned when writing to the files of a closed logger
+var errClosed = errors.New("logger is closed")
+
+// WriteOptions sets how log lines are written. With a FlushInterval lines
+// are buffered and written by a background goroutine at least that often,
+// or once BufferSize bytes are pending for a file. Without one every line
+// is written as it is captured. Fsync syncs the files after every write.
+// Redact masks parts of every line before it is written anywhere.
+type WriteOptions struct {
+	FlushInterval time.Duration
+	BufferSize    int
+	Fsync         bool
+	Redact        *Redactor
+}
+
+// logFile is a log file with the lines not yet written to it. The file is
+// opened on the first write.
+type logFile struct {
+	owner   *ProcessLogger
+	path    string
+	file    *os.File
+	pending []byte
+	spare   []byte
+}
+
+// open returns the file, opening it if needed. The files of a closed
+// logger aren't opened again. The caller must hold the owner's mu.
+func (f *logFile) open() (*os.File, error) {
+	if f.owner.closed {
+		return nil, errClosed
+	}
+	if f.file == nil {
+		file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		f.file = file
+		openFiles.opened(f.owner)
+	}
+	return f.file, nil
+}
+
+// close closes the file if it is open
+func (f *logFile) close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	openFiles.closed(f.owner)
+	return err
+}
+
+// write appends a line to the file, or to its pending lines if buffered
+func (f *logFile) write(line string, buffered bool) int {
+	if buffered {
+		f.pending = append(f.pending, line...)
+		return len(line)
+	}
+	file, err := f.open()
+	if err != nil {
+		return 0
+	}
+	n, _ := file.WriteString(line)
+	return n
+}
+
+// take returns the pending lines and starts a new buffer for them
+func (f *logFile) take() []byte {
+	data := f.pending
+	f.pending, f.spare = f.spare[:0], nil
+	return data
+}
+
+// SetBuffering configures how lines are written, flushing the lines pending
+// under the previous options
+func (l *ProcessLogger) SetBuffering(opts WriteOptions) {
+	l.stopFlusher()
+	l.Flush()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.opts = opts
+}
+
+// startFlusher starts the background flushes once lines are buffered, so
+// loggers of idle processes don't run one. The caller must hold l.mu.
+func (l *ProcessLogger) startFlusher() {
+	l.flushNow = make(chan struct{}, 1)
+	l.flushStop = make(chan struct{})
+	l.flushDone = make(chan struct{})
+	go l.flushLoop(l.opts.FlushInterval, l.flushNow, l.flushStop, l.flushDone)
+}
+
+// buffered returns whether lines are buffered. The caller must hold l.mu.
+func (l *ProcessLogger) buffered() bool {
+	return l.opts.FlushInterval > 0
+}
+
+// written is called after lines were added to a file. It triggers a flush
+// when enough lines are pending and reports whether the caller should wait
+// for one. The caller must hold l.mu.
+func (l *ProcessLogger) written(f *logFile) (wait bool) {
+	if !l.buffered() {
+		if l.opts.Fsync && f.file != nil {
+			f.file.Sync()
+		}
+		return false
+	}
+
+	if l.flushStop == nil {
+		l.startFlusher()
+	}
+
+	size := max(l.opts.BufferSize, 1)
+	if len(f.pending) >= size {
+		select {
+		case l.flushNow <- struct{}{}:
+		default:
+		}
+	}
+	return len(f.pending) >= size*maxPendingFactor
+}
+
+func (l *ProcessLogger) flushLoop(interval time.Duration, now, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-now:
+		case <-stop:
+			return
+		}
+		l.Flush()
+	}
+}
+
+// stopFlusher stops the background flushes, if running
+func (l *ProcessLogger) stopFlusher() {
+	l.mu.Lock()
+	stop, done := l.flushStop, l.flushDone
+	l.flushStop, l.flushDone = nil, nil
+	l.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// Flush writes the pending lines to the log files. Capture goes on while
+// they are written.
+func (l *ProcessLogger) Flush() {
+	l.flushMu.Lock()
+	defer l.flushMu.Unlock()
+
+	l.mu.Lock()
+	files := l.files()
+	data := make([][]byte, len(files))
+	handles := make([]*os.File, len(files))
+	for i, f := range files {
+		data[i] = f.take()
+		if len(data[i]) > 0 {
+			handles[i], _ = f.open()
+		}
+	}
+	fsync := l.opts.Fsync
+	l.mu.Unlock()
+
+	for i, file := range handles {
+		if file == nil {
+			continue
+		}
+		file.Write(data[i])
+		if fsync {
+			file.Sync()
+		}
+	}
+
+	// Hand the buffers back for reuse
+	l.mu.Lock()
+	for i, f := range files {
+		if f.spare == nil {
+			f.spare = data[i][:0]
+		}
+	}
+	l.mu.Unlock()
+}
+
+// files returns the log files. The caller must hold l.mu.
+func (l *ProcessLogger) files() []*logFile {
+	return []*logFile{l.stdout, l.stderr, l.combined}
+}
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogAfterClose(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewProcessLogger("1", "web", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Log("stdout", "before close")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"stdout.log", "stderr.log", "combined.log"}
+	for _, name := range names {
+		os.Remove(filepath.Join(dir, "web-1", name))
+	}
+	l.Log("stderr", "after close")
+	l.Flush()
+	if err := l.RotateLogs(1); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(dir, "web-1", name)); !os.IsNotExist(err) {
+			t.Errorf("%s was reopened after Close: %v", name, err)
+		}
+	}
+}
+
+func benchmarkLog(b *testing.B, opts WriteOptions) {
+	l, err := NewProcessLogger("bench", "bench", b.TempDir())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+	l.SetBuffering(opts)
+
+	line := "GET /api/v1/processes 200 1.2ms request_id=8d4512d0"
+	b.SetBytes(int64(len(line)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Log("stdout", line)
+	}
+	b.StopTimer()
+	l.Flush()
+}
+
+func BenchmarkLogUnbuffered(b *testing.B) {
+	benchmarkLog(b, WriteOptions{})
+}
+
+func BenchmarkLogBuffered(b *testing.B) {
+	benchmarkLog(b, WriteOptions{FlushInterval: 100 * time.Millisecond, BufferSize: 64 << 10})
+}
+
+func BenchmarkLogBufferedParallel(b *testing.B) {
+	l, err := NewProcessLogger("bench", "bench", b.TempDir())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+	l.SetBuffering(WriteOptions{FlushInterval: 100 * time.Millisecond, BufferSize: 64 << 10})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			l.Log("stderr", "worker: job finished in 12ms")
+		}
+	})
+}
+
+func BenchmarkLogRedacted(b *testing.B) {
+	redact := &Redactor{}
+	if err := redact.Add(`token=\S+`, "token=***"); err != nil {
+		b.Fatal(err)
+	}
+	benchmarkLog(b, WriteOptions{FlushInterval: 100 * time.Millisecond, BufferSize: 64 << 10, Redact: redact})
+}
@@ -0,0 +1,185 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/PrismManager/gemstone/internal/events"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// Host discovers, runs and talks to the plugins in a directory
+type Host struct {
+	mu        sync.RWMutex
+	dir       string
+	events    *events.Bus
+	plugins   map[string]*Plugin
+	collected map[string]map[string]interface{}
+	stopChan  chan struct{}
+}
+
+// NewHost creates a plugin host for a plugins directory
+func NewHost(dir string, bus *events.Bus) *Host {
+	return &Host{
+		dir:       dir,
+		events:    bus,
+		plugins:   make(map[string]*Plugin),
+		collected: make(map[string]map[string]interface{}),
+		stopChan:  make(chan struct{}),
+	}
+}
+
+// Start launches every executable in the plugins directory and starts
+// forwarding events to them
+func (h *Host) Start() {
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("Warning: failed to read plugins directory: %v\n", err)
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode()&0111 == 0 {
+			continue
+		}
+
+		path := filepath.Join(h.dir, entry.Name())
+		p, err := start(path)
+		if err != nil {
+			fmt.Printf("Warning: failed to start plugin %s: %v\n", path, err)
+			continue
+		}
+
+		h.mu.Lock()
+		if _, exists := h.plugins[p.Name()]; exists {
+			h.mu.Unlock()
+			fmt.Printf("Warning: duplicate plugin name %s from %s\n", p.Name(), path)
+			p.Stop()
+			continue
+		}
+		h.plugins[p.Name()] = p
+		h.mu.Unlock()
+
+		fmt.Printf("Loaded plugin %s from %s\n", p.Name(), path)
+	}
+
+	go h.forwardEvents()
+}
+
+// Stop terminates all plugins
+func (h *Host) Stop() {
+	close(h.stopChan)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, p := range h.plugins {
+		p.Stop()
+	}
+}
+
+// List returns information about all loaded plugins
+func (h *Host) List() []types.PluginInfo {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	result := make([]types.PluginInfo, 0, len(h.plugins))
+	for _, p := range h.plugins {
+		result = append(result, p.Info())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result
+}
+
+// RunCommand runs a custom command of a plugin and returns its output
+func (h *Host) RunCommand(name, command string, args []string) (*types.PluginResult, error) {
+	h.mu.RLock()
+	p, ok := h.plugins[name]
+	h.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("plugin %s not found", name)
+	}
+
+	reply, err := p.RunCommand(command, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.PluginResult{Output: reply.Output, Data: reply.Data}, nil
+}
+
+// Collect runs all plugin collectors and keeps their latest results
+func (h *Host) Collect() {
+	for _, p := range h.snapshot() {
+		for _, collector := range p.manifest.Collectors {
+			data, err := p.Collect(collector)
+			if err != nil {
+				continue
+			}
+
+			h.mu.Lock()
+			if h.collected[p.Name()] == nil {
+				h.collected[p.Name()] = make(map[string]interface{})
+			}
+			h.collected[p.Name()][collector] = data
+			h.mu.Unlock()
+		}
+	}
+}
+
+// snapshot returns the loaded plugins, to talk to them without holding h.mu
+func (h *Host) snapshot() []*Plugin {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	plugins := make([]*Plugin, 0, len(h.plugins))
+	for _, p := range h.plugins {
+		plugins = append(plugins, p)
+	}
+	return plugins
+}
+
+// Collected returns the latest collector results keyed by plugin and
+// collector name
+func (h *Host) Collected() map[string]map[string]interface{} {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	result := make(map[string]map[string]interface{}, len(h.collected))
+	for name, values := range h.collected {
+		copied := make(map[string]interface{}, len(values))
+		for k, v := range values {
+			copied[k] = v
+		}
+		result[name] = copied
+	}
+	return result
+}
+
+func (h *Host) forwardEvents() {
+	ch, cancel := h.events.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			for _, p := range h.snapshot() {
+				p.SendEvent(event)
+			}
+		case <-h.stopChan:
+			return
+		}
+	}
+}
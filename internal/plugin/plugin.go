@@ -0,0 +1,347 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// ProtocolVersion is the version of the plugin protocol sent on init
+const ProtocolVersion = 1
+
+// Hook names a plugin can register for in its manifest
+const (
+	HookEvents = "events"
+)
+
+// callTimeout bounds how long the daemon waits for a plugin reply
+const callTimeout = 30 * time.Second
+
+// errNotRunning is returned when talking to a plugin that has stopped, and
+// errDropped when a message is dropped after a drop was reported
+var (
+	errNotRunning = errors.New("plugin is not running")
+	errDropped    = errors.New("plugin isn't keeping up, message dropped")
+)
+
+// queueSize is how many messages may wait for a plugin to read them before
+// more are dropped
+const queueSize = 1024
+
+// message is a line of JSON exchanged with a plugin over stdio.
+//
+// The daemon sends "init", then "event", "command" and "collect" messages;
+// the plugin answers "init" with a "manifest" and "command"/"collect" with
+// a "result" carrying the same ID.
+type message struct {
+	Type      string       `json:"type"`
+	ID        string       `json:"id,omitempty"`
+	Version   int          `json:"version,omitempty"`
+	Command   string       `json:"command,omitempty"`
+	Collector string       `json:"collector,omitempty"`
+	Args      []string     `json:"args,omitempty"`
+	Event     *types.Event `json:"event,omitempty"`
+
+	// Manifest fields
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Hooks       []string `json:"hooks,omitempty"`
+	Commands    []string `json:"commands,omitempty"`
+	Collectors  []string `json:"collectors,omitempty"`
+
+	// Result fields
+	Output string      `json:"output,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// Plugin is a running external plugin executable
+type Plugin struct {
+	path     string
+	manifest message
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	pending map[string]chan message
+	nextID  int
+	running bool
+	// out queues the lines writeLoop writes to stdin, so a plugin that
+	// stops reading doesn't block the daemon; done ends writeLoop.
+	// dropped counts the messages dropped since the queue filled up.
+	out     chan []byte
+	done    chan struct{}
+	dropped int
+}
+
+// start launches the plugin and performs the init handshake
+func start(path string) (*Plugin, error) {
+	cmd := exec.Command(path)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &Plugin{
+		path:    path,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[string]chan message),
+		running: true,
+		out:     make(chan []byte, queueSize),
+		done:    make(chan struct{}),
+	}
+	manifest := make(chan message, 1)
+	go p.readLoop(stdout, manifest)
+	go p.writeLoop()
+
+	if err := p.send(message{Type: "init", Version: ProtocolVersion}); err != nil {
+		p.Stop()
+		return nil, err
+	}
+
+	select {
+	case m := <-manifest:
+		if m.Name == "" {
+			m.Name = filepath.Base(path)
+		}
+		p.manifest = m
+	case <-time.After(5 * time.Second):
+		p.Stop()
+		return nil, fmt.Errorf("plugin did not send a manifest")
+	}
+
+	return p, nil
+}
+
+// Name returns the plugin name from its manifest
+func (p *Plugin) Name() string {
+	return p.manifest.Name
+}
+
+// Info returns a description of the plugin
+func (p *Plugin) Info() types.PluginInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return types.PluginInfo{
+		Name:        p.manifest.Name,
+		Path:        p.path,
+		Description: p.manifest.Description,
+		Hooks:       p.manifest.Hooks,
+		Commands:    p.manifest.Commands,
+		Collectors:  p.manifest.Collectors,
+		Running:     p.running,
+	}
+}
+
+// Has reports whether a name is in a manifest list
+func has(list []string, name string) bool {
+	for _, item := range list {
+		if item == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SendEvent forwards an event if the plugin registered the events hook
+func (p *Plugin) SendEvent(event types.Event) {
+	if !has(p.manifest.Hooks, HookEvents) {
+		return
+	}
+	// A plugin that stopped or is dropping messages was reported already
+	err := p.send(message{Type: "event", Event: &event})
+	if err != nil && err != errNotRunning && err != errDropped {
+		fmt.Printf("Warning: failed to send event to plugin %s: %v\n", p.Name(), err)
+	}
+}
+
+// RunCommand runs a custom command provided by the plugin
+func (p *Plugin) RunCommand(command string, args []string) (message, error) {
+	if !has(p.manifest.Commands, command) {
+		return message{}, fmt.Errorf("plugin %s has no command %s", p.Name(), command)
+	}
+	return p.call(message{Type: "command", Command: command, Args: args})
+}
+
+// Collect runs a custom collector provided by the plugin
+func (p *Plugin) Collect(collector string) (interface{}, error) {
+	reply, err := p.call(message{Type: "collect", Collector: collector})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Data, nil
+}
+
+// Stop terminates the plugin
+func (p *Plugin) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.running {
+		return
+	}
+	p.closeInput()
+
+	done := make(chan struct{})
+	go func() {
+		_ = p.cmd.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		_ = p.cmd.Process.Kill()
+	}
+}
+
+// call sends a request and waits for the matching result
+func (p *Plugin) call(m message) (message, error) {
+	p.mu.Lock()
+	p.nextID++
+	m.ID = strconv.Itoa(p.nextID)
+	reply := make(chan message, 1)
+	p.pending[m.ID] = reply
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, m.ID)
+		p.mu.Unlock()
+	}()
+
+	if err := p.send(m); err != nil {
+		return message{}, err
+	}
+
+	select {
+	case r, ok := <-reply:
+		if !ok {
+			return message{}, fmt.Errorf("plugin %s exited", p.Name())
+		}
+		if r.Error != "" {
+			return r, fmt.Errorf("%s", r.Error)
+		}
+		return r, nil
+	case <-time.After(callTimeout):
+		return message{}, fmt.Errorf("plugin %s timed out", p.Name())
+	}
+}
+
+// send queues a message for the plugin without waiting for it to be read.
+// The message is dropped if the queue is full.
+func (p *Plugin) send(m message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.running {
+		return errNotRunning
+	}
+	select {
+	case p.out <- append(data, '\n'):
+		if p.dropped > 0 {
+			fmt.Printf("Warning: plugin %s caught up, %d messages were dropped\n", p.Name(), p.dropped)
+			p.dropped = 0
+		}
+		return nil
+	default:
+	}
+
+	// Only the first drop is reported, or every event would be
+	p.dropped++
+	if p.dropped == 1 {
+		return fmt.Errorf("plugin %s isn't keeping up, dropping messages", p.Name())
+	}
+	return errDropped
+}
+
+// writeLoop writes the queued messages to the plugin
+func (p *Plugin) writeLoop() {
+	for {
+		select {
+		case data := <-p.out:
+			if _, err := p.stdin.Write(data); err != nil {
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// closeInput marks the plugin stopped and closes its stdin, which also
+// ends a write blocked on it. The caller must hold p.mu.
+func (p *Plugin) closeInput() {
+	p.running = false
+	close(p.done)
+	p.stdin.Close()
+}
+
+func (p *Plugin) readLoop(stdout io.Reader, manifest chan<- message) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	for scanner.Scan() {
+		var m message
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			fmt.Printf("Warning: invalid message from plugin %s: %v\n", p.path, err)
+			continue
+		}
+
+		switch m.Type {
+		case "manifest":
+			select {
+			case manifest <- m:
+			default:
+			}
+		case "result":
+			p.mu.Lock()
+			if ch, ok := p.pending[m.ID]; ok {
+				ch <- m
+			}
+			p.mu.Unlock()
+		}
+	}
+
+	// The plugin exited, fail all pending calls
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for id, ch := range p.pending {
+		close(ch)
+		delete(p.pending, id)
+	}
+
+	if p.running {
+		fmt.Printf("Warning: plugin %s exited\n", p.path)
+		p.closeInput()
+		go p.cmd.Wait()
+	}
+}
@@ -0,0 +1,171 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// maxSteps bounds the work a policy script may do per decision
+const maxSteps = 1000000
+
+// Actions a policy can decide on
+const (
+	ActionRestart = "restart"
+	ActionBackoff = "backoff"
+	ActionGiveUp  = "give_up"
+)
+
+// Triggers a policy is evaluated for
+const (
+	TriggerExit = "exit"
+	// TriggerPortDown is evaluated when a declared port stopped accepting
+	// connections while the process runs; give_up leaves it running
+	TriggerPortDown = "port_down"
+)
+
+// Input describes the situation a policy decides on
+type Input struct {
+	Trigger      string
+	Name         string
+	Namespace    string
+	ExitCode     int
+	Uptime       time.Duration
+	RestartCount int
+	MaxRestarts  int
+	// Restarts holds the times of recent automatic restarts, oldest first
+	Restarts []time.Time
+	Now      time.Time
+	// Port is the address that failed on port_down, Failures the number
+	// of probes that failed in a row
+	Port     string
+	Failures int
+}
+
+// Decision is the outcome of a policy
+type Decision struct {
+	Action string
+	Delay  time.Duration
+	Reason string
+}
+
+// Restart returns whether the process should be restarted
+func (d Decision) Restart() bool {
+	return d.Action != ActionGiveUp
+}
+
+// Evaluate runs the policy script at path and calls its decide function.
+//
+// decide receives a struct with the fields trigger, name, namespace,
+// exit_code, uptime, restart_count, max_restarts, restarts (unix times),
+// now, hour, weekday, port and failures, and returns either an action
+// string or a dict with the keys action, delay (seconds) and reason.
+func Evaluate(path string, in Input) (Decision, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to read policy: %w", err)
+	}
+
+	thread := &starlark.Thread{
+		Name:  "policy",
+		Print: func(_ *starlark.Thread, msg string) { fmt.Printf("policy %s: %s\n", path, msg) },
+	}
+	thread.SetMaxExecutionSteps(maxSteps)
+
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, path, src, nil)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to load policy: %w", err)
+	}
+
+	decide, ok := globals["decide"].(starlark.Callable)
+	if !ok {
+		return Decision{}, fmt.Errorf("policy %s does not define a decide function", path)
+	}
+
+	result, err := starlark.Call(thread, decide, starlark.Tuple{inputValue(in)}, nil)
+	if err != nil {
+		return Decision{}, fmt.Errorf("policy failed: %w", err)
+	}
+
+	return parseDecision(result)
+}
+
+func inputValue(in Input) starlark.Value {
+	restarts := make([]starlark.Value, len(in.Restarts))
+	for i, t := range in.Restarts {
+		restarts[i] = starlark.MakeInt64(t.Unix())
+	}
+
+	return starlarkstruct.FromStringDict(starlark.String("input"), starlark.StringDict{
+		"trigger":       starlark.String(in.Trigger),
+		"name":          starlark.String(in.Name),
+		"namespace":     starlark.String(in.Namespace),
+		"exit_code":     starlark.MakeInt(in.ExitCode),
+		"uptime":        starlark.Float(in.Uptime.Seconds()),
+		"restart_count": starlark.MakeInt(in.RestartCount),
+		"max_restarts":  starlark.MakeInt(in.MaxRestarts),
+		"restarts":      starlark.NewList(restarts),
+		"now":           starlark.MakeInt64(in.Now.Unix()),
+		"hour":          starlark.MakeInt(in.Now.Hour()),
+		"weekday":       starlark.MakeInt(int(in.Now.Weekday())),
+		"port":          starlark.String(in.Port),
+		"failures":      starlark.MakeInt(in.Failures),
+	})
+}
+
+func parseDecision(v starlark.Value) (Decision, error) {
+	var d Decision
+
+	switch v := v.(type) {
+	case starlark.String:
+		d.Action = string(v)
+	case *starlark.Dict:
+		for _, item := range v.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				return Decision{}, fmt.Errorf("policy returned a dict with non-string key %s", item[0])
+			}
+
+			switch key {
+			case "action":
+				action, ok := starlark.AsString(item[1])
+				if !ok {
+					return Decision{}, fmt.Errorf("policy action must be a string")
+				}
+				d.Action = action
+			case "delay":
+				delay, ok := starlark.AsFloat(item[1])
+				if !ok || delay < 0 {
+					return Decision{}, fmt.Errorf("policy delay must be a non-negative number")
+				}
+				d.Delay = time.Duration(delay * float64(time.Second))
+			case "reason":
+				reason, ok := starlark.AsString(item[1])
+				if !ok {
+					return Decision{}, fmt.Errorf("policy reason must be a string")
+				}
+				d.Reason = reason
+			default:
+				return Decision{}, fmt.Errorf("policy returned unknown key %q", key)
+			}
+		}
+	default:
+		return Decision{}, fmt.Errorf("policy must return a string or dict, got %s", v.Type())
+	}
+
+	switch d.Action {
+	case ActionRestart, ActionGiveUp:
+	case ActionBackoff:
+		if d.Delay == 0 {
+			return Decision{}, fmt.Errorf("policy backoff requires a delay")
+		}
+	default:
+		return Decision{}, fmt.Errorf("policy returned unknown action %q", d.Action)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,144 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/mem"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// Admission modes
+const (
+	// AdmissionWarn logs starts that would overcommit the host
+	AdmissionWarn = "warn"
+	// AdmissionEnforce refuses starts that would overcommit the host
+	AdmissionEnforce = "enforce"
+)
+
+// ErrOvercommit is returned when the reservation of a process doesn't fit
+// into the capacity left
+var ErrOvercommit = errors.New("not enough capacity")
+
+// admission is the capacity reservations are checked against
+type admission struct {
+	mode   string
+	cpu    float64 // cores
+	memory int     // MB, 0 if unknown
+}
+
+// newAdmission returns the admission settings with the host's capacity
+// filled in, or nil if admission control is disabled
+func newAdmission(cfg config.AdmissionConfig) *admission {
+	switch cfg.Mode {
+	case "":
+		return nil
+	case AdmissionWarn, AdmissionEnforce:
+	default:
+		fmt.Printf("Warning: invalid admission.mode %q, admission control is disabled\n", cfg.Mode)
+		return nil
+	}
+
+	a := &admission{mode: cfg.Mode, cpu: cfg.CPU, memory: cfg.Memory}
+	if a.cpu <= 0 {
+		a.cpu = float64(runtime.NumCPU())
+	}
+	if a.memory <= 0 {
+		if vm, err := mem.VirtualMemory(); err == nil {
+			a.memory = int(vm.Total / (1024 * 1024))
+		} else {
+			fmt.Printf("Warning: failed to read the host's memory, memory reservations are not checked: %v\n", err)
+		}
+	}
+	return a
+}
+
+// reservation returns the reservation of the process
+func (p *Process) reservation() *types.Reservation {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.info.Reserve
+}
+
+// holdsReservation reports whether a process in a state counts toward the
+// reserved capacity, from its start until it stopped
+func holdsReservation(status types.ProcessStatus) bool {
+	switch status {
+	case types.StatusRunning, types.StatusStarting, types.StatusQueued, types.StatusRestarting, types.StatusStopping:
+		return true
+	}
+	return false
+}
+
+// reserved sums the reservations of the processes holding one, except skip
+func (m *Manager) reserved(skip *Process) (cpu float64, memory int) {
+	for _, p := range m.registry.all() {
+		if p == skip || !holdsReservation(p.Status()) {
+			continue
+		}
+		if r := p.reservation(); r != nil {
+			cpu += r.CPU
+			memory += r.Memory
+		}
+	}
+	return cpu, memory
+}
+
+// Capacity returns the capacity admission control checks against with the
+// current reservations, or nil if it is disabled
+func (m *Manager) Capacity() *types.Capacity {
+	a := m.admission
+	if a == nil {
+		return nil
+	}
+	cpu, memory := m.reserved(nil)
+	return &types.Capacity{
+		Mode:           a.mode,
+		CPU:            a.cpu,
+		Memory:         a.memory,
+		ReservedCPU:    cpu,
+		ReservedMemory: memory,
+	}
+}
+
+// admit checks whether the reservation of a process fits into the capacity
+// left by the others. In warn mode a start over capacity is only logged.
+// Concurrent starts are not serialized, so two of them may both fit.
+func (m *Manager) admit(p *Process) error {
+	err := m.checkAdmission(p)
+	if err == nil {
+		return nil
+	}
+	if m.admission.mode == AdmissionWarn {
+		fmt.Printf("Warning: process %s: %v\n", p.Name(), err)
+		return nil
+	}
+	return err
+}
+
+// checkAdmission returns ErrOvercommit if the reservation of a process
+// doesn't fit, regardless of the mode
+func (m *Manager) checkAdmission(p *Process) error {
+	a := m.admission
+	r := p.reservation()
+	if a == nil || r == nil {
+		return nil
+	}
+
+	cpu, memory := m.reserved(p)
+	var over []string
+	if r.CPU > 0 && cpu+r.CPU > a.cpu {
+		over = append(over, fmt.Sprintf("%g of %g cores reserved, %g more requested", cpu, a.cpu, r.CPU))
+	}
+	if r.Memory > 0 && a.memory > 0 && memory+r.Memory > a.memory {
+		over = append(over, fmt.Sprintf("%d of %d MB reserved, %d more requested", memory, a.memory, r.Memory))
+	}
+	if len(over) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrOvercommit, strings.Join(over, ", "))
+}
@@ -0,0 +1,137 @@
+package process
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// ErrInvalidAnnotation is returned for annotations without text or with too
+// much of it
+var ErrInvalidAnnotation = errors.New("invalid annotation")
+
+const (
+	// maxAnnotations is the number of annotations kept per process
+	maxAnnotations = 500
+	// maxAnnotationLength is the longest annotation text accepted, in bytes
+	maxAnnotationLength = 4096
+)
+
+// Annotate attaches a note to a process, stored with the time and author
+// and published as an annotation event
+func (m *Manager) Annotate(idOrName, text, author string) (*types.Annotation, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return nil, fmt.Errorf("%w: the text is empty", ErrInvalidAnnotation)
+	case len(text) > maxAnnotationLength:
+		return nil, fmt.Errorf("%w: the text is longer than %d bytes", ErrInvalidAnnotation, maxAnnotationLength)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	proc := m.registry.lookup(idOrName)
+	if proc == nil {
+		return nil, fmt.Errorf("process %s not found", idOrName)
+	}
+
+	annotations, err := m.loadAnnotations(proc.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	annotation := types.Annotation{
+		Timestamp: time.Now(),
+		Author:    author,
+		Text:      text,
+	}
+	annotations = append(annotations, annotation)
+	if len(annotations) > maxAnnotations {
+		annotations = annotations[len(annotations)-maxAnnotations:]
+	}
+	if err := m.saveAnnotations(proc.ID(), annotations); err != nil {
+		return nil, err
+	}
+
+	m.events.Publish(types.Event{
+		Type:        types.EventAnnotation,
+		ProcessID:   proc.ID(),
+		ProcessName: proc.Name(),
+		Namespace:   proc.Namespace(),
+		Message:     text,
+		Data: map[string]interface{}{
+			"author": author,
+		},
+	})
+
+	return &annotation, nil
+}
+
+// Annotations returns the notes attached to a process, oldest first
+func (m *Manager) Annotations(idOrName string) ([]types.Annotation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	proc := m.registry.lookup(idOrName)
+	if proc == nil {
+		return nil, fmt.Errorf("process %s not found", idOrName)
+	}
+
+	annotations, err := m.loadAnnotations(proc.ID())
+	if err != nil {
+		return nil, err
+	}
+	if annotations == nil {
+		annotations = []types.Annotation{}
+	}
+	return annotations, nil
+}
+
+func (m *Manager) annotationsPath(id string) string {
+	return filepath.Join(m.dataDir, "annotations", id+".json")
+}
+
+func (m *Manager) loadAnnotations(id string) ([]types.Annotation, error) {
+	data, err := os.ReadFile(m.annotationsPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var annotations []types.Annotation
+	if err := json.Unmarshal(data, &annotations); err != nil {
+		return nil, err
+	}
+
+	return annotations, nil
+}
+
+func (m *Manager) saveAnnotations(id string, annotations []types.Annotation) error {
+	path := m.annotationsPath(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(annotations, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data, 0644)
+}
+
+// removeAnnotations deletes the annotations of a deleted process
+func (m *Manager) removeAnnotations(id string) {
+	if err := os.Remove(m.annotationsPath(id)); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: failed to remove annotations: %v\n", err)
+	}
+}
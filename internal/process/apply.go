@@ -0,0 +1,559 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// ErrForbidden is returned when an apply changes a namespace the caller
+// may not access
+var ErrForbidden = errors.New("forbidden")
+
+// applyStopTimeout bounds how long an apply waits for a process to stop
+// before replacing its definition
+const applyStopTimeout = 10 * time.Second
+
+// Apply makes the processes of the namespaces in scope match a desired-state
+// document: missing processes are created, changed ones are redefined and
+// restarted, and processes not in the document are deleted unless Partial
+// is set. Changes of only the description, homepage or owner contact don't
+// restart a process. With Start set, listed processes that aren't running
+// are started too. Processes with a schedule are only started by it. With
+// DryRun set only the changes are computed.
+//
+// Processes with scale rules are created with the instance count their
+// rules ask for now, and Scale moves it from there.
+//
+// canAccess reports whether a namespace may be changed; nil allows all.
+//
+// Applies run one at a time. m.mu is held while planning and while each
+// definition is swapped, but not while processes stop, so an apply doesn't
+// hold up other calls.
+func (m *Manager) Apply(req *types.ApplyRequest, actor string, canAccess func(namespace string) bool) (*types.ApplyResult, error) {
+	m.applyMu.Lock()
+	defer m.applyMu.Unlock()
+
+	return m.apply(req, actor, canAccess, nil)
+}
+
+// applyPlan is the outcome of planning an apply
+type applyPlan struct {
+	changes []types.ApplyChange
+	// scaled are the processes with scale rules and unscaled the keys of
+	// the scale groups that no longer have any
+	scaled   []scaleGroup
+	unscaled []string
+}
+
+// apply plans and executes an apply. counts sets the instance count of
+// scaled processes by scale key, which otherwise keep their current one.
+// The caller must hold m.applyMu.
+func (m *Manager) apply(req *types.ApplyRequest, actor string, canAccess func(string) bool, counts map[string]int) (*types.ApplyResult, error) {
+	m.mu.Lock()
+	plan, err := m.planApply(req, canAccess, counts)
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &types.ApplyResult{DryRun: req.DryRun, Changes: plan.changes}
+	if req.DryRun {
+		return result, nil
+	}
+
+	desired := make(map[string]*types.StartRequest, len(req.Processes))
+	for i := range req.Processes {
+		desired[req.Processes[i].Name] = &req.Processes[i]
+	}
+
+	for i := range result.Changes {
+		change := &result.Changes[i]
+
+		var err error
+		switch change.Action {
+		case types.ApplyCreate:
+			var info *types.ProcessInfo
+			info, err = m.applyCreate(desired[change.Name], actor)
+			if info != nil {
+				change.ID = info.ID
+			}
+		case types.ApplyUpdate:
+			err = m.applyChange(change, desired[change.Name], actor)
+		case types.ApplyDelete:
+			err = m.applyDelete(change.ID)
+		}
+		if err == nil && change.Started {
+			if p := m.registry.get(change.ID); p != nil {
+				err = p.Start()
+			}
+		}
+		if err != nil {
+			change.Error = err.Error()
+		}
+	}
+
+	m.saveProcesses()
+	m.updateScaleGroups(plan)
+
+	return result, nil
+}
+
+// planApply validates a desired-state document and computes its changes.
+// The caller must hold m.mu and m.applyMu.
+func (m *Manager) planApply(req *types.ApplyRequest, canAccess func(string) bool, counts map[string]int) (*applyPlan, error) {
+	allowed := func(namespace string) error {
+		if canAccess != nil && !canAccess(namespace) {
+			return fmt.Errorf("%w: no access to namespace %s", ErrForbidden, namespace)
+		}
+		return nil
+	}
+
+	// Instances left over from another instance count are deleted even
+	// from a partial apply
+	bases := make(map[string]string, len(req.Processes))
+	plan := &applyPlan{}
+	now := time.Now()
+	for i := range req.Processes {
+		proc := &req.Processes[i]
+		bases[proc.Name] = namespaceOrDefault(proc.Namespace)
+
+		key := scaleKey(proc.Namespace, proc.Name)
+		g, grouped := m.scaleGroups[key]
+		if len(proc.Scale) == 0 {
+			if grouped {
+				plan.unscaled = append(plan.unscaled, key)
+			}
+			continue
+		}
+		if err := validateScale(proc); err != nil {
+			return nil, fmt.Errorf("process %s: %w", proc.Name, err)
+		}
+		n, ok := counts[key]
+		switch {
+		case ok:
+		case grouped:
+			n = g.Instances
+		default:
+			n = scaledInstances(proc, now)
+		}
+		def := *proc
+		def.Scale = append([]types.ScaleRule(nil), proc.Scale...)
+		plan.scaled = append(plan.scaled, scaleGroup{Definition: def, Instances: n})
+		proc.Instances = n
+	}
+	processes, err := expandInstances(req.Processes)
+	if err != nil {
+		return nil, err
+	}
+	req.Processes = processes
+
+	scope := make(map[string]bool)
+	for _, ns := range req.Namespaces {
+		if err := ValidateNamespace(ns); err != nil {
+			return nil, err
+		}
+		scope[namespaceOrDefault(ns)] = true
+	}
+	for _, ns := range bases {
+		scope[ns] = true
+	}
+	// A full apply drops the scaled processes it no longer lists
+	if !req.Partial {
+		for key, g := range m.scaleGroups {
+			ns := namespaceOrDefault(g.Definition.Namespace)
+			if listed, ok := bases[g.Definition.Name]; scope[ns] && (!ok || listed != ns) {
+				plan.unscaled = append(plan.unscaled, key)
+			}
+		}
+	}
+
+	names := make(map[string]bool, len(req.Processes))
+	for i := range req.Processes {
+		proc := &req.Processes[i]
+		if err := m.resolveFetch(proc); err != nil {
+			return nil, fmt.Errorf("process %s: %w", proc.Name, err)
+		}
+		if proc.Name == "" || proc.Command == "" {
+			return nil, fmt.Errorf("processes[%d]: name and command are required", i)
+		}
+		if names[proc.Name] {
+			return nil, fmt.Errorf("process %s is listed more than once", proc.Name)
+		}
+		names[proc.Name] = true
+
+		if err := validateDefinition(proc); err != nil {
+			return nil, fmt.Errorf("process %s: %w", proc.Name, err)
+		}
+		scope[namespaceOrDefault(proc.Namespace)] = true
+	}
+
+	for ns := range scope {
+		if err := allowed(ns); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := make([]types.ApplyChange, 0, len(req.Processes))
+	for i := range req.Processes {
+		proc := &req.Processes[i]
+		change := types.ApplyChange{
+			Action:    types.ApplyCreate,
+			Name:      proc.Name,
+			Namespace: namespaceOrDefault(proc.Namespace),
+		}
+
+		if existing := m.registry.lookup(proc.Name); existing != nil {
+			// Moving a process between namespaces changes both of them.
+			// The namespace of a process the caller can't access stays
+			// unnamed.
+			if canAccess != nil && !canAccess(existing.Namespace()) {
+				return nil, fmt.Errorf("process %s: %w", proc.Name, ErrNameUnavailable)
+			}
+
+			change.ID = existing.ID()
+			current := existing.Definition()
+			change.Fields = definitionChanges(&current, proc)
+			change.Action = types.ApplyUpdate
+			if len(change.Fields) == 0 {
+				change.Action = types.ApplyUnchanged
+			}
+			// Scheduled processes wait for their schedule
+			if req.Start && proc.Schedule == "" {
+				switch existing.Status() {
+				case types.StatusStopped, types.StatusErrored, types.StatusCrashLooped:
+					change.Started = true
+				}
+			}
+		}
+
+		changes = append(changes, change)
+	}
+
+	var deletes []types.ApplyChange
+	for _, p := range m.registry.all() {
+		if !scope[p.Namespace()] || names[p.Name()] {
+			continue
+		}
+		if !req.Partial || staleInstance(p, bases) {
+			deletes = append(deletes, types.ApplyChange{
+				Action:    types.ApplyDelete,
+				Name:      p.Name(),
+				Namespace: p.Namespace(),
+				ID:        p.ID(),
+			})
+		}
+	}
+	sort.Slice(deletes, func(i, j int) bool { return deletes[i].Name < deletes[j].Name })
+
+	plan.changes = append(changes, deletes...)
+	return plan, nil
+}
+
+// staleInstance reports whether an unlisted process is an instance of a
+// listed process that no longer exists, like web-3 after lowering
+// instances to 2 or web after raising it from 1. bases maps the names of the
+// listed processes to their namespaces.
+func staleInstance(p *Process, bases map[string]string) bool {
+	name, namespace := p.Name(), p.Namespace()
+	if ns, ok := bases[name]; ok {
+		return ns == namespace
+	}
+	if _, ok := p.Definition().Env["GEMSTONE_INSTANCE"]; !ok {
+		return false
+	}
+	i := strings.LastIndex(name, "-")
+	if i < 0 {
+		return false
+	}
+	if _, err := strconv.Atoi(name[i+1:]); err != nil {
+		return false
+	}
+	ns, ok := bases[name[:i]]
+	return ok && ns == namespace
+}
+
+// expandInstances replaces each process with instances set by that many
+// copies named name-0, name-1 and so on. Processes with scale rules are
+// always named that way, so scaling them between 1 and more instances
+// doesn't rename the first.
+func expandInstances(processes []types.StartRequest) ([]types.StartRequest, error) {
+	expanded := make([]types.StartRequest, 0, len(processes))
+	for _, proc := range processes {
+		n := proc.Instances
+		if n < 0 {
+			return nil, fmt.Errorf("process %s: instances must not be negative", proc.Name)
+		}
+		scaled := len(proc.Scale) > 0
+		proc.Instances = 0
+		proc.Scale = nil
+		if (n <= 1 && !scaled) || proc.Name == "" {
+			expanded = append(expanded, proc)
+			continue
+		}
+
+		for i := 0; i < n; i++ {
+			instance := proc
+			instance.Name = fmt.Sprintf("%s-%d", proc.Name, i)
+			// Set after the managed variables, so it replaces their 0
+			instance.Env = make(map[string]string, len(proc.Env)+1)
+			for k, v := range proc.Env {
+				instance.Env[k] = v
+			}
+			instance.Env["GEMSTONE_INSTANCE"] = strconv.Itoa(i)
+			expanded = append(expanded, instance)
+		}
+	}
+	return expanded, nil
+}
+
+// applyCreate creates and starts a process, or leaves it to its schedule
+func (m *Manager) applyCreate(req *types.StartRequest, actor string) (*types.ProcessInfo, error) {
+	if err := m.fetchScript(req); err != nil {
+		return nil, err
+	}
+
+	proc, err := New(req, m.logDir)
+	if err != nil {
+		return nil, err
+	}
+	m.attach(proc)
+	proc.stats = m.loadStats(proc.ID())
+
+	m.mu.Lock()
+	err = m.registry.add(proc)
+	m.mu.Unlock()
+	if err != nil {
+		proc.Close()
+		return nil, err
+	}
+	m.recordDefinition(proc, DefinitionCreate, actor, nil)
+
+	if err := m.prepareSource(proc, false); err != nil {
+		return proc.Info(), err
+	}
+	if req.Schedule != "" {
+		return proc.Info(), nil
+	}
+	if err := proc.Start(); err != nil {
+		return proc.Info(), err
+	}
+
+	return proc.Info(), nil
+}
+
+// applyChange carries out an update planned by an apply
+func (m *Manager) applyChange(change *types.ApplyChange, req *types.StartRequest, actor string) error {
+	m.mu.Lock()
+	old := m.registry.get(change.ID)
+	if old != nil && metadataOnly(change.Fields) {
+		previous := old.Definition()
+		old.SetMetadata(req)
+		m.recordDefinition(old, DefinitionUpdate, actor, &previous)
+	}
+	m.mu.Unlock()
+	if old == nil {
+		return fmt.Errorf("process %s was deleted during the apply", change.Name)
+	}
+	if metadataOnly(change.Fields) {
+		return nil
+	}
+
+	previous := old.Definition()
+	err := m.applyUpdate(old, req)
+
+	m.mu.Lock()
+	if updated := m.registry.get(change.ID); updated != nil && updated != old {
+		m.recordDefinition(updated, DefinitionUpdate, actor, &previous)
+	}
+	m.mu.Unlock()
+	return err
+}
+
+// applyUpdate replaces the definition of a process, keeping its ID, log
+// directory and generation. A running process is restarted with the new
+// definition. m.mu is only taken to swap the definitions, so the caller
+// must not hold it.
+func (m *Manager) applyUpdate(old *Process, req *types.StartRequest) error {
+	if err := m.fetchScript(req); err != nil {
+		return err
+	}
+
+	wasRunning := old.Status() == types.StatusRunning
+	if wasRunning {
+		if err := stopAndWait(old, applyStopTimeout); err != nil {
+			return err
+		}
+	}
+
+	proc, err := newProcess(old.ID(), req, m.logDir)
+	if err != nil {
+		return err
+	}
+	m.attach(proc)
+	proc.stats = old.stats
+	if req.Source == nil {
+		m.removeSource(proc.ID())
+	} else if err := m.prepareSource(proc, false); err != nil {
+		proc.Close()
+		if wasRunning {
+			_ = old.Start()
+		}
+		return err
+	}
+	proc.info.Generation = old.ToConfig().Generation
+	oldInfo := old.Info()
+	proc.info.RestartCount = oldInfo.RestartCount
+	proc.info.CreatedAt = oldInfo.CreatedAt
+	proc.info.StoppedAt = oldInfo.StoppedAt
+	proc.info.LastExit = oldInfo.LastExit
+	proc.info.LastRun = oldInfo.LastRun
+
+	// The process may have been deleted or redefined while it stopped
+	m.mu.Lock()
+	if m.registry.get(old.ID()) != old {
+		err = fmt.Errorf("process %s changed during the update", old.Name())
+	} else {
+		err = m.registry.replace(old, proc)
+	}
+	m.mu.Unlock()
+	if err != nil {
+		proc.Close()
+		if wasRunning {
+			_ = old.Start()
+		}
+		return err
+	}
+	old.Close()
+
+	if wasRunning {
+		return proc.Start()
+	}
+	return nil
+}
+
+// metadataFields are the fields of a definition that only describe the
+// process and are changed without a restart
+var metadataFields = map[string]bool{"description": true, "homepage": true, "owner_contact": true}
+
+func metadataOnly(fields []string) bool {
+	for _, f := range fields {
+		if !metadataFields[f] {
+			return false
+		}
+	}
+	return true
+}
+
+// applyDelete stops and removes a process unless it is already gone
+func (m *Manager) applyDelete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := m.registry.get(id)
+	if p == nil {
+		return nil
+	}
+	return m.deleteProcess(p, nil)
+}
+
+// stopAndWait stops a process and waits until it has exited
+func stopAndWait(p *Process, timeout time.Duration) error {
+	if err := p.Stop(); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		switch p.Status() {
+		case types.StatusStopping, types.StatusRunning:
+			time.Sleep(100 * time.Millisecond)
+		default:
+			return nil
+		}
+	}
+
+	return fmt.Errorf("process %s did not stop in time", p.Name())
+}
+
+// definitionChanges returns the names of the fields that differ between two
+// definitions
+func definitionChanges(old, req *types.StartRequest) []string {
+	var fields []string
+	diff := func(name string, a, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			fields = append(fields, name)
+		}
+	}
+
+	diff("name", old.Name, req.Name)
+	diff("description", old.Description, req.Description)
+	diff("homepage", old.Homepage, req.Homepage)
+	diff("owner_contact", old.OwnerContact, req.OwnerContact)
+	diff("command", old.Command, req.Command)
+	diff("args", nonNilArgs(old.Args), nonNilArgs(req.Args))
+	diff("work_dir", old.WorkDir, req.WorkDir)
+	diff("stdin", old.Stdin, req.Stdin)
+	diff("env", nonNilEnv(old.Env), nonNilEnv(req.Env))
+	diff("auto_start", old.AutoStart, req.AutoStart)
+	diff("auto_restart", old.AutoRestart, req.AutoRestart)
+	diff("max_restarts", old.MaxRestarts, req.MaxRestarts)
+	diff("user", old.User, req.User)
+	diff("group", old.Group, req.Group)
+	diff("timezone", old.Timezone, req.Timezone)
+	diff("locale", old.Locale, req.Locale)
+	diff("output_encoding", old.OutputEncoding, req.OutputEncoding)
+	diff("namespace", namespaceOrDefault(old.Namespace), namespaceOrDefault(req.Namespace))
+	diff("log_pipe", old.LogPipe, req.LogPipe)
+	diff("log_quota", old.LogQuota, req.LogQuota)
+	diff("restart_policy", old.RestartPolicy, req.RestartPolicy)
+	diff("max_uptime", old.MaxUptime, req.MaxUptime)
+	diff("schedule", old.Schedule, req.Schedule)
+	diff("restart_on_binary_change", old.RestartOnBinaryChange, req.RestartOnBinaryChange)
+	diff("wait_for", old.WaitFor, req.WaitFor)
+	diff("soft_limits", old.SoftLimits, req.SoftLimits)
+	diff("reserve", old.Reserve, req.Reserve)
+	diff("oom_score_adj", old.OOMScoreAdj, req.OOMScoreAdj)
+	diff("capabilities", old.Capabilities, req.Capabilities)
+	diff("seccomp", old.Seccomp, req.Seccomp)
+	diff("apparmor_profile", old.AppArmorProfile, req.AppArmorProfile)
+	diff("selinux_label", old.SELinuxLabel, req.SELinuxLabel)
+	diff("network", old.Network, req.Network)
+	diff("monitor_paths", nonNilArgs(old.MonitorPaths), nonNilArgs(req.MonitorPaths))
+	diff("disk_alert", old.DiskAlert, req.DiskAlert)
+	diff("ports", nonNilArgs(old.Ports), nonNilArgs(req.Ports))
+	diff("output_watchdog", old.OutputWatchdog, req.OutputWatchdog)
+	diff("standby", old.Standby, req.Standby)
+	diff("fetch", old.Fetch, req.Fetch)
+	diff("source", old.Source, req.Source)
+
+	return fields
+}
+
+func namespaceOrDefault(namespace string) string {
+	if namespace == "" {
+		return config.DefaultNamespace
+	}
+	return namespace
+}
+
+func nonNilArgs(args []string) []string {
+	if args == nil {
+		return []string{}
+	}
+	return args
+}
+
+func nonNilEnv(env map[string]string) map[string]string {
+	if env == nil {
+		return map[string]string{}
+	}
+	return env
+}
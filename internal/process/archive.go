@@ -0,0 +1,164 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/archive"
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// defaultArchiveInterval is how often rotated log files are uploaded when
+// the config doesn't say
+const defaultArchiveInterval = 5 * time.Minute
+
+// logArchive uploads rotated log files to object storage
+type logArchive struct {
+	store    *archive.S3
+	key      string
+	interval time.Duration
+	keep     bool
+	compress bool
+	host     string
+	// uploaded holds the files kept locally after their upload, by path
+	// and modification time
+	uploaded map[string]time.Time
+}
+
+// newLogArchive sets up log archival, or returns nil if it isn't configured
+// or the config is invalid
+func newLogArchive(cfg config.LogConfig) *logArchive {
+	if !cfg.Archive.Enabled() {
+		return nil
+	}
+
+	store, err := archive.NewS3(cfg.Archive)
+	if err != nil {
+		fmt.Printf("Warning: log archive disabled: %v\n", err)
+		return nil
+	}
+
+	a := &logArchive{
+		store:    store,
+		key:      cfg.Archive.Key,
+		interval: defaultArchiveInterval,
+		keep:     cfg.Archive.KeepLocal,
+		compress: cfg.Compress,
+		uploaded: make(map[string]time.Time),
+	}
+	if a.key == "" {
+		a.key = archive.DefaultKey
+	}
+	if err := archive.ValidateKey(a.key); err != nil {
+		fmt.Printf("Warning: log archive disabled: invalid logging.archive.key %q: %v\n", a.key, err)
+		return nil
+	}
+	if cfg.Archive.Interval != "" {
+		d, err := time.ParseDuration(cfg.Archive.Interval)
+		if err != nil || d <= 0 {
+			fmt.Printf("Warning: invalid logging.archive.interval %q, using %s\n", cfg.Archive.Interval, defaultArchiveInterval)
+		} else {
+			a.interval = d
+		}
+	}
+	a.host, _ = os.Hostname()
+	return a
+}
+
+// ArchiveInterval returns how often logs are archived, or 0 if log
+// archival is disabled
+func (m *Manager) ArchiveInterval() time.Duration {
+	if m.archive == nil {
+		return 0
+	}
+	return m.archive.interval
+}
+
+// ArchiveLogs uploads the rotated log files of all processes and deletes
+// the uploaded ones unless they are kept locally. Files that fail are tried
+// again on the next run.
+func (m *Manager) ArchiveLogs() {
+	a := m.archive
+	if a == nil {
+		return
+	}
+
+	seen := make(map[string]bool)
+	var failed int
+	var firstErr error
+	for _, p := range m.registry.all() {
+		files, err := p.logger.RotatedFiles()
+		if err != nil {
+			continue
+		}
+
+		var paths []string
+		var uploaded int64
+		for _, f := range files {
+			seen[f.Path] = true
+			if at, ok := a.uploaded[f.Path]; ok && at.Equal(f.ModTime) {
+				continue
+			}
+
+			compress := a.compress && !strings.HasSuffix(f.Path, ".gz")
+			name := filepath.Base(f.Path)
+			if compress {
+				name += ".gz"
+			}
+			key := archive.Key(a.key, archive.KeyVars{
+				Host:      a.host,
+				Namespace: p.Namespace(),
+				Name:      p.Name(),
+				ID:        p.ID(),
+				File:      name,
+				Time:      f.ModTime,
+			})
+
+			n, err := a.store.Upload(context.Background(), key, f.Path, compress)
+			if err != nil {
+				failed++
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s: %w", f.Path, err)
+				}
+				continue
+			}
+			uploaded += n
+			paths = append(paths, key)
+
+			if a.keep {
+				a.uploaded[f.Path] = f.ModTime
+			} else if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+				fmt.Printf("Warning: failed to remove archived log file %s: %v\n", f.Path, err)
+			}
+		}
+
+		if len(paths) > 0 {
+			m.events.Publish(types.Event{
+				Type:        types.EventLogArchive,
+				ProcessID:   p.ID(),
+				ProcessName: p.Name(),
+				Message:     fmt.Sprintf("Archived %d rotated log files", len(paths)),
+				Data: map[string]interface{}{
+					"keys":           paths,
+					"uploaded_bytes": uploaded,
+				},
+			})
+		}
+	}
+
+	// Forget kept files that were deleted since
+	for path := range a.uploaded {
+		if !seen[path] {
+			delete(a.uploaded, path)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("Warning: failed to archive %d log files, retrying next run: %v\n", failed, firstErr)
+	}
+}
@@ -0,0 +1,121 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// binaryState is what the binary of the running process was last seen as
+type binaryState struct {
+	size    int64
+	modTime time.Time
+	// alerted is the hash of the changed binary that was alerted on, so
+	// each change alerts once
+	alerted string
+}
+
+// recordBinary notes the hash and modification time of the binary the run
+// was started from and writes a startup banner to the log, mentioning a
+// change since the last known binary. The caller must hold p.mu.
+func (p *Process) recordBinary(path string) {
+	p.info.BinaryUpdated = false
+	p.binary = binaryState{}
+	if !filepath.IsAbs(path) && p.cmd != nil && p.cmd.Dir != "" {
+		path = filepath.Join(p.cmd.Dir, path)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return
+	}
+
+	banner := fmt.Sprintf("Starting %s (sha256 %s, modified %s)", path, sum, fi.ModTime().Format(time.RFC3339))
+	if last := p.info.Binary; last != nil && last.SHA256 != sum {
+		banner += fmt.Sprintf(", changed since the last start (sha256 %s)", last.SHA256)
+	}
+	p.logger.Log("stderr", banner)
+
+	p.info.Binary = &types.Binary{Path: path, SHA256: sum, ModTime: fi.ModTime()}
+	p.binary.size, p.binary.modTime = fi.Size(), fi.ModTime()
+}
+
+// CheckBinaries emits a binary_changed event for running processes whose
+// command binary changed on disk, and restarts those that ask for it
+func (m *Manager) CheckBinaries() {
+	paused := m.Paused()
+	for _, p := range m.registry.all() {
+		if p.checkBinary(paused) {
+			m.delayStop(p)
+			if err := p.Restart(); err != nil {
+				p.logger.Log("stderr", fmt.Sprintf("Failed to restart after the binary changed: %v", err))
+			}
+		}
+	}
+}
+
+// checkBinary compares the binary on disk to the running one, hashing it
+// only when its size or modification time changed. It reports whether the
+// process should be restarted to pick up the change.
+func (p *Process) checkBinary(paused bool) bool {
+	p.mu.RLock()
+	running := p.info.Status == types.StatusRunning && p.info.Binary != nil
+	var path string
+	seen := p.binary
+	if running {
+		path = p.info.Binary.Path
+	}
+	p.mu.RUnlock()
+	if !running {
+		return false
+	}
+
+	// A binary being replaced may be missing for a moment
+	fi, err := os.Stat(path)
+	if err != nil || (fi.Size() == seen.size && fi.ModTime().Equal(seen.modTime)) {
+		return false
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b := p.info.Binary
+	if p.info.Status != types.StatusRunning || b == nil || b.Path != path {
+		return false
+	}
+	p.binary.size, p.binary.modTime = fi.Size(), fi.ModTime()
+
+	// Changed back, or only touched
+	if sum == b.SHA256 {
+		p.info.BinaryUpdated = false
+		p.binary.alerted = ""
+		return false
+	}
+	if sum == p.binary.alerted {
+		return false
+	}
+	p.binary.alerted = sum
+	p.info.BinaryUpdated = true
+
+	restart := p.info.RestartOnBinaryChange && !paused
+	p.publish(types.EventBinaryChanged, "Restart pending: binary updated", map[string]interface{}{
+		"path":            path,
+		"sha256":          sum,
+		"previous_sha256": b.SHA256,
+		"restart":         restart,
+	})
+	if restart {
+		p.stopReason, p.stopDetail = types.ExitUpdated, fmt.Sprintf("%s changed to sha256 %s", path, sum)
+	}
+	return restart
+}
@@ -0,0 +1,229 @@
+package process
+
+import (
+	"fmt"
+	"math/rand"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// DefaultChaosInterval is how often chaos mode picks processes to kill
+const DefaultChaosInterval = 30 * time.Second
+
+// ChaosConfig sets the faults injected in chaos mode, to test restart
+// policies and alerting. Only processes matching Match and Namespace are
+// affected. Faults are drawn from a generator seeded with Seed, so a run can
+// be repeated.
+type ChaosConfig struct {
+	Seed int64
+	// Kill is the chance of each running process to be killed with SIGKILL
+	// every Interval
+	Kill     float64
+	Interval time.Duration
+	// StopDelay delays stops and restarts by up to this long
+	StopDelay time.Duration
+	// DropStats is the chance of each stats sample to be dropped
+	DropStats float64
+	// Match is a glob for process names, all names when empty
+	Match     string
+	Namespace string
+}
+
+// ParseChaos parses a chaos spec such as
+// "seed=42,kill=0.1,interval=10s,stop_delay=5s,drop_stats=0.2,match=test-*"
+func ParseChaos(spec string) (ChaosConfig, error) {
+	cfg := ChaosConfig{Interval: DefaultChaosInterval}
+
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return cfg, fmt.Errorf("invalid chaos setting %q (expected key=value)", field)
+		}
+
+		var err error
+		switch key {
+		case "seed":
+			cfg.Seed, err = strconv.ParseInt(value, 10, 64)
+		case "kill":
+			cfg.Kill, err = parseChance(value)
+		case "interval":
+			cfg.Interval, err = time.ParseDuration(value)
+			if err == nil && cfg.Interval <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "stop_delay":
+			cfg.StopDelay, err = time.ParseDuration(value)
+			if err == nil && cfg.StopDelay < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		case "drop_stats":
+			cfg.DropStats, err = parseChance(value)
+		case "match":
+			_, err = path.Match(value, "")
+			cfg.Match = value
+		case "namespace":
+			err = ValidateNamespace(value)
+			cfg.Namespace = value
+		default:
+			return cfg, fmt.Errorf("unknown chaos setting %q", key)
+		}
+		if err != nil {
+			return cfg, fmt.Errorf("invalid chaos setting %s: %w", key, err)
+		}
+	}
+
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	return cfg, nil
+}
+
+func parseChance(value string) (float64, error) {
+	chance, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if chance < 0 || chance > 1 {
+		return 0, fmt.Errorf("must be between 0 and 1")
+	}
+	return chance, nil
+}
+
+// String describes the faults, including the seed to repeat them
+func (c ChaosConfig) String() string {
+	target := "all processes"
+	if c.Match != "" {
+		target = fmt.Sprintf("processes matching %q", c.Match)
+	}
+	if c.Namespace != "" {
+		target += fmt.Sprintf(" in namespace %s", c.Namespace)
+	}
+	return fmt.Sprintf("seed=%d kill=%g every %s, stop_delay=%s, drop_stats=%g, on %s",
+		c.Seed, c.Kill, c.Interval, c.StopDelay, c.DropStats, target)
+}
+
+// chaos injects the faults of chaos mode
+type chaos struct {
+	config ChaosConfig
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// EnableChaos turns on chaos mode. It must be called before the daemon
+// starts supervising.
+func (m *Manager) EnableChaos(cfg ChaosConfig) {
+	m.chaos = &chaos{
+		config: cfg,
+		rng:    rand.New(rand.NewSource(cfg.Seed)),
+	}
+}
+
+// Chaos returns the chaos mode settings, or nil when it is off
+func (m *Manager) Chaos() *ChaosConfig {
+	if m.chaos == nil {
+		return nil
+	}
+	cfg := m.chaos.config
+	return &cfg
+}
+
+// targets reports whether a process is subject to chaos
+func (c *chaos) targets(p *Process) bool {
+	if c == nil {
+		return false
+	}
+	if c.config.Namespace != "" && p.Namespace() != c.config.Namespace {
+		return false
+	}
+	if c.config.Match != "" {
+		if ok, _ := path.Match(c.config.Match, p.Name()); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// roll returns true with the given chance
+func (c *chaos) roll(chance float64) bool {
+	if chance <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rng.Float64() < chance
+}
+
+// duration returns a random duration below max
+func (c *chaos) duration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Duration(c.rng.Int63n(int64(max)))
+}
+
+// InjectChaos kills some of the running processes, as if they crashed. It
+// does nothing while supervision is paused.
+func (m *Manager) InjectChaos() {
+	c := m.chaos
+	if c == nil || m.Paused() {
+		return
+	}
+
+	for _, p := range m.registry.all() {
+		if !c.targets(p) || !c.roll(c.config.Kill) {
+			continue
+		}
+
+		p.mu.Lock()
+		if p.info.Status == types.StatusRunning && p.cmd != nil && p.cmd.Process != nil {
+			pid := p.cmd.Process.Pid
+			if err := syscall.Kill(-pid, syscall.SIGKILL); err == nil {
+				p.publish(types.EventChaos, fmt.Sprintf("Chaos mode killed PID %d", pid), map[string]interface{}{
+					"fault": "kill",
+					"pid":   pid,
+				})
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// delayStop waits before a stop or restart of a process in chaos mode
+func (m *Manager) delayStop(p *Process) {
+	c := m.chaos
+	if !c.targets(p) {
+		return
+	}
+
+	delay := c.duration(c.config.StopDelay)
+	if delay <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	p.publish(types.EventChaos, fmt.Sprintf("Chaos mode delays the stop by %s", delay.Round(time.Millisecond)), map[string]interface{}{
+		"fault": "stop_delay",
+		"delay": delay.Seconds(),
+	})
+	p.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// dropStats reports whether chaos mode drops a stats sample of a process
+func (m *Manager) dropStats(p *Process) bool {
+	c := m.chaos
+	return c.targets(p) && c.roll(c.config.DropStats)
+}
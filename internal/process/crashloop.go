@@ -0,0 +1,73 @@
+package process
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// newCrashLoopCooldown parses the crash loop cooldown, 0 if there is none
+func newCrashLoopCooldown(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		fmt.Printf("Warning: invalid daemon.crash_loop_cooldown %q, crash-looped processes stay down\n", value)
+		return 0
+	}
+	return d
+}
+
+// enterCrashLoop moves a process that used up its restart budget into the
+// crash_looped state and raises a high-priority event. The caller must hold
+// p.mu.
+func (p *Process) enterCrashLoop(at time.Time) {
+	p.info.Status = types.StatusCrashLooped
+	p.info.CrashLoopedAt = &at
+
+	message := fmt.Sprintf("Process %s crashed %d times in a row and is no longer restarted", p.info.Name, p.info.RestartCount+1)
+	p.logger.Log("stderr", message)
+	if p.events == nil {
+		return
+	}
+	p.events.Publish(types.Event{
+		Type:        types.EventCrashLoop,
+		ProcessID:   p.info.ID,
+		ProcessName: p.info.Name,
+		Namespace:   p.info.Namespace,
+		Message:     message,
+		Priority:    types.PriorityHigh,
+		Data: map[string]interface{}{
+			"restart_count": p.info.RestartCount,
+			"max_restarts":  p.info.MaxRestarts,
+		},
+	})
+}
+
+// RecoverCrashLoops resets the restart budget of processes crash-looped
+// for longer than the cooldown and starts them again
+func (m *Manager) RecoverCrashLoops() {
+	if m.crashLoopCooldown == 0 || m.Paused() {
+		return
+	}
+
+	for _, p := range m.registry.all() {
+		p.mu.Lock()
+		due := p.info.Status == types.StatusCrashLooped && p.info.CrashLoopedAt != nil &&
+			time.Since(*p.info.CrashLoopedAt) >= m.crashLoopCooldown
+		if due {
+			p.info.RestartCount = 0
+			p.restartTimes = nil
+			p.logger.Log("stderr", fmt.Sprintf("Crash loop cooldown of %s passed, starting again", m.crashLoopCooldown))
+		}
+		p.mu.Unlock()
+
+		if due {
+			if err := p.Start(); err != nil {
+				fmt.Printf("Failed to start process %s after its crash loop cooldown: %v\n", p.Name(), err)
+			}
+		}
+	}
+}
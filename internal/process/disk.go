@@ -0,0 +1,120 @@
+package process
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// diskState tracks the sizes of the monitored paths of a process
+type diskState struct {
+	sizes map[string]uint64
+	// alerted holds the paths above disk_alert, which alert again only
+	// once they dropped below it
+	alerted map[string]bool
+}
+
+// validateMonitorPaths checks the monitored paths and their alert threshold
+func validateMonitorPaths(paths []string, alertMB int) error {
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("monitor path %s must be absolute", path)
+		}
+	}
+	if alertMB < 0 {
+		return fmt.Errorf("disk_alert must not be negative")
+	}
+	if alertMB > 0 && len(paths) == 0 {
+		return fmt.Errorf("disk_alert requires monitor_paths")
+	}
+	return nil
+}
+
+// pathSize returns the size of a file, or of all files below a directory.
+// Entries that can't be read are skipped.
+func pathSize(path string) (uint64, error) {
+	if _, err := os.Lstat(path); err != nil {
+		return 0, err
+	}
+
+	var total uint64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += uint64(info.Size())
+			}
+		}
+		return nil
+	})
+	return total, err
+}
+
+// MonitorDisk measures the monitored paths of all processes and emits a
+// disk_alert event for paths that grew above the alert threshold of their
+// process
+func (m *Manager) MonitorDisk() {
+	procs := m.registry.all()
+
+	for _, p := range procs {
+		p.checkDisk()
+	}
+}
+
+func (p *Process) checkDisk() {
+	p.mu.RLock()
+	paths, alertMB := p.info.MonitorPaths, p.info.DiskAlert
+	p.mu.RUnlock()
+
+	if len(paths) == 0 {
+		return
+	}
+
+	// Walking large trees takes a while, so measure without the lock
+	sizes := make(map[string]uint64, len(paths))
+	for _, path := range paths {
+		if size, err := pathSize(path); err == nil {
+			sizes[path] = size
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.disk.sizes = sizes
+	if p.disk.alerted == nil {
+		p.disk.alerted = make(map[string]bool)
+	}
+
+	limit := uint64(alertMB) * megabyte
+	for _, path := range paths {
+		size, ok := sizes[path]
+		above := alertMB > 0 && ok && size > limit
+		if above && !p.disk.alerted[path] {
+			p.publish(types.EventDiskAlert, fmt.Sprintf("%s grew to %.1fMB, above the disk alert of %dMB", path, float64(size)/megabyte, alertMB), map[string]interface{}{
+				"path":        path,
+				"size":        size,
+				"alert_bytes": limit,
+			})
+		}
+		p.disk.alerted[path] = above
+	}
+}
+
+// diskUsage returns a copy of the last measured sizes. The caller must hold
+// p.mu.
+func (p *Process) diskUsage() map[string]uint64 {
+	if len(p.disk.sizes) == 0 {
+		return nil
+	}
+	sizes := make(map[string]uint64, len(p.disk.sizes))
+	for path, size := range p.disk.sizes {
+		sizes[path] = size
+	}
+	return sizes
+}
@@ -0,0 +1,69 @@
+package process
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// outputEncoding looks up a character encoding by name, e.g. "latin1" or
+// "shift_jis". UTF-8 is returned as nil, it needs no transcoding.
+func outputEncoding(name string) (encoding.Encoding, error) {
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown output encoding %q", name)
+	}
+	if enc == unicode.UTF8 {
+		return nil, nil
+	}
+	return enc, nil
+}
+
+// captureEncoding returns the encoding the output of the process is
+// transcoded from: the output encoding, else the charset of the locale as
+// in "de_DE.ISO-8859-1", nil for UTF-8. The caller must hold p.mu.
+func (p *Process) captureEncoding() encoding.Encoding {
+	if p.info.OutputEncoding != "" {
+		enc, _ := outputEncoding(p.info.OutputEncoding)
+		return enc
+	}
+
+	_, charset, ok := strings.Cut(p.info.Locale, ".")
+	if !ok {
+		return nil
+	}
+	charset, _, _ = strings.Cut(charset, "@")
+	enc, _ := outputEncoding(charset)
+	return enc
+}
+
+// sanitizeOutput returns a line of output as valid UTF-8, transcoded with
+// dec unless it is nil. Bytes that still aren't valid UTF-8 are escaped as
+// \xNN, so they survive in the logs without breaking JSON.
+func sanitizeOutput(line []byte, dec *encoding.Decoder) string {
+	if dec != nil {
+		if b, err := dec.Bytes(line); err == nil {
+			line = b
+		}
+	}
+	if utf8.Valid(line) {
+		return string(line)
+	}
+
+	var b strings.Builder
+	b.Grow(len(line) + 8)
+	for len(line) > 0 {
+		r, size := utf8.DecodeRune(line)
+		if r == utf8.RuneError && size == 1 {
+			fmt.Fprintf(&b, "\\x%02x", line[0])
+		} else {
+			b.Write(line[:size])
+		}
+		line = line[size:]
+	}
+	return b.String()
+}
@@ -0,0 +1,149 @@
+package process
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+const (
+	// fetchTimeout bounds the download of a script
+	fetchTimeout = 5 * time.Minute
+	// maxFetchSize is the largest script that is downloaded
+	maxFetchSize = 100 * 1024 * 1024
+)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// validateFetch checks the source of a fetched script
+func validateFetch(f *types.Fetch) error {
+	u, err := url.Parse(f.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q: must be http or https", f.URL)
+	}
+	if !sha256Pattern.MatchString(f.SHA256) {
+		return fmt.Errorf("invalid sha256 %q: must be 64 hex digits", f.SHA256)
+	}
+	return nil
+}
+
+// scriptPath returns where the script of a fetch is kept. Scripts are
+// stored by checksum, so definitions fetching the same script share it.
+func (m *Manager) scriptPath(f *types.Fetch) string {
+	name := "script"
+	if u, err := url.Parse(f.URL); err == nil {
+		if base := path.Base(u.Path); base != "/" && base != "." {
+			name = base
+		}
+	}
+	return filepath.Join(m.dataDir, "scripts", strings.ToLower(f.SHA256), name)
+}
+
+// resolveFetch points the command of a definition with a fetch at its
+// script, which must not conflict with a command of its own
+func (m *Manager) resolveFetch(req *types.StartRequest) error {
+	if req.Fetch == nil {
+		return nil
+	}
+	script := m.scriptPath(req.Fetch)
+	if req.Command != "" && req.Command != script {
+		return fmt.Errorf("command and fetch can't both be set")
+	}
+	req.Command = script
+	return nil
+}
+
+// fetchScript downloads the script of a definition unless it is already
+// there, verifies its checksum and makes it executable
+func (m *Manager) fetchScript(req *types.StartRequest) (err error) {
+	if req.Fetch == nil {
+		return nil
+	}
+	if err := m.resolveFetch(req); err != nil {
+		return err
+	}
+
+	script := req.Command
+	want := strings.ToLower(req.Fetch.SHA256)
+	if sum, err := fileSHA256(script); err == nil && sum == want {
+		return nil
+	}
+
+	dir := filepath.Dir(script)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create script directory: %w", err)
+	}
+	defer func() {
+		// Leave no empty directory behind a failed fetch
+		if err != nil {
+			os.Remove(dir)
+		}
+	}()
+
+	client := &http.Client{Timeout: fetchTimeout}
+	resp, err := client.Get(req.Fetch.URL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", req.Fetch.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: %s", req.Fetch.URL, resp.Status)
+	}
+
+	// Download next to the script so it only appears once verified
+	tmp, err := os.CreateTemp(dir, ".fetch-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(resp.Body, maxFetchSize+1))
+	if err == nil && n > maxFetchSize {
+		err = fmt.Errorf("larger than %d MB", maxFetchSize/1024/1024)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", req.Fetch.URL, err)
+	}
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != want {
+		return fmt.Errorf("checksum mismatch for %s: got sha256 %s, expected %s", req.Fetch.URL, sum, want)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), script)
+}
+
+// fileSHA256 returns the hex SHA-256 of a file
+func fileSHA256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
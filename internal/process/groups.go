@@ -0,0 +1,190 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// ErrGroupNotFound is returned for a restart group missing from the config
+var ErrGroupNotFound = errors.New("restart group not found")
+
+// groupStartTimeout bounds how long a member of a restart group may take
+// until it runs and the next one starts
+const groupStartTimeout = DefaultWaitTimeout
+
+// groupLocks serializes the restarts of each restart group
+type groupLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock waits until no other restart of a group runs and returns the
+// function ending this one
+func (g *groupLocks) lock(name string) func() {
+	g.mu.Lock()
+	if g.locks == nil {
+		g.locks = make(map[string]*sync.Mutex)
+	}
+	l, ok := g.locks[name]
+	if !ok {
+		l = &sync.Mutex{}
+		g.locks[name] = l
+	}
+	g.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// RestartGroup restarts the processes of a restart group together: the
+// running ones are stopped, the last one first, and then all of them are
+// started in order, each once the ones before it run. If a process doesn't
+// stop, the stopped ones are started again; if one fails to start, those
+// after it are left stopped.
+//
+// canAccess reports whether a namespace may be changed; nil allows all.
+func (m *Manager) RestartGroup(name string, canAccess func(namespace string) bool) (*types.GroupResult, error) {
+	g, ok := m.findGroup(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, name)
+	}
+
+	procs := m.matchProcesses(g.Processes)
+	if canAccess != nil {
+		for _, p := range procs {
+			if ns := p.Namespace(); !canAccess(ns) {
+				return nil, fmt.Errorf("%w: restart group %s includes %s in namespace %s", ErrForbidden, g.Name, p.Name(), ns)
+			}
+		}
+	}
+	return m.restartGroup(g, procs, "requested")
+}
+
+// restartCrashedGroup restarts the first restart group with restart on
+// crash that includes a crashed process, reporting whether there was one
+func (m *Manager) restartCrashedGroup(crashed *Process) bool {
+	for _, g := range m.config.Groups {
+		if !g.RestartOnCrash {
+			continue
+		}
+		procs := m.matchProcesses(g.Processes)
+		for _, p := range procs {
+			if p != crashed {
+				continue
+			}
+			if _, err := m.restartGroup(g, procs, crashed.Name()+" crashed"); err != nil {
+				crashed.logger.Log("stderr", fmt.Sprintf("Failed to restart group %s: %v", g.Name, err))
+				// The crashed process still gets its own restart
+				if crashed.Status() == types.StatusRestarting {
+					_ = crashed.Start()
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// restartGroup stops the members of a group that are up and then starts
+// all of them in order. A crashed member waiting for its restart is not
+// running and only started.
+func (m *Manager) restartGroup(g config.RestartGroup, procs []*Process, cause string) (*types.GroupResult, error) {
+	unlock := m.groupLocks.lock(g.Name)
+	defer unlock()
+
+	result := &types.GroupResult{Group: g.Name, Actions: []types.GroupAction{}}
+	for _, p := range procs {
+		p.logger.Log("stderr", fmt.Sprintf("Restarting with restart group %s: %s", g.Name, cause))
+	}
+
+	stopped := make(map[*Process]bool)
+	for i := len(procs) - 1; i >= 0; i-- {
+		p := procs[i]
+		switch p.Status() {
+		case types.StatusRunning, types.StatusStarting, types.StatusQueued:
+		default:
+			continue
+		}
+
+		action := types.GroupAction{Process: p.Name(), Action: "stopped"}
+		m.delayStop(p)
+		err := stopAndWait(p, applyStopTimeout)
+		if err != nil {
+			action.Action, action.Error = "failed", err.Error()
+		}
+		result.Actions = append(result.Actions, action)
+		if err != nil {
+			// Don't leave the group half down
+			var restore []*Process
+			for _, q := range procs {
+				if stopped[q] {
+					restore = append(restore, q)
+				}
+			}
+			_ = startGroupMembers(restore, result)
+			return result, fmt.Errorf("restart group %s: %s failed to stop: %w", g.Name, p.Name(), err)
+		}
+		stopped[p] = true
+	}
+
+	if err := startGroupMembers(procs, result); err != nil {
+		return result, fmt.Errorf("restart group %s: %w", g.Name, err)
+	}
+	return result, nil
+}
+
+// startGroupMembers starts processes one after the other, each once the
+// ones before it run. After a failure the remaining ones are skipped.
+func startGroupMembers(procs []*Process, result *types.GroupResult) error {
+	for i, p := range procs {
+		action := types.GroupAction{Process: p.Name(), Action: "started"}
+		err := p.Start()
+		if err == nil {
+			err = waitGroupMember(p)
+		}
+		if err != nil {
+			action.Action, action.Error = "failed", err.Error()
+			result.Actions = append(result.Actions, action)
+			for _, rest := range procs[i+1:] {
+				result.Actions = append(result.Actions, types.GroupAction{Process: rest.Name(), Action: "skipped"})
+			}
+			return fmt.Errorf("%s failed to start: %w", p.Name(), err)
+		}
+		result.Actions = append(result.Actions, action)
+	}
+	return nil
+}
+
+// waitGroupMember waits until a started process runs, failing if it exits
+// or the timeout passes
+func waitGroupMember(p *Process) error {
+	deadline := time.Now().Add(groupStartTimeout)
+	for {
+		switch status := p.Status(); status {
+		case types.StatusRunning:
+			return nil
+		case types.StatusStarting, types.StatusQueued:
+		default:
+			return fmt.Errorf("process is %s", status)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not running within %s", groupStartTimeout)
+		}
+		time.Sleep(targetPollInterval)
+	}
+}
+
+// findGroup returns the config of a restart group
+func (m *Manager) findGroup(name string) (config.RestartGroup, bool) {
+	for _, g := range m.config.Groups {
+		if g.Name == name {
+			return g, true
+		}
+	}
+	return config.RestartGroup{}, false
+}
@@ -0,0 +1,125 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// ErrNotHealthy is returned when a restarted process doesn't become
+// healthy
+var ErrNotHealthy = errors.New("process did not become healthy")
+
+const (
+	// healthyUptime is how long a run without declared ports or readiness
+	// reports must stay up to count as healthy
+	healthyUptime = 5 * time.Second
+	// healthPollInterval is the time between checks of a restarted process
+	healthPollInterval = 500 * time.Millisecond
+)
+
+// RestartHealthy restarts a process and waits until the new run is
+// healthy. It fails with ErrNotHealthy if the run exits or timeout passes
+// first.
+func (m *Manager) RestartHealthy(ctx context.Context, idOrName string, timeout time.Duration) error {
+	proc := m.registry.lookup(idOrName)
+	if proc == nil {
+		return fmt.Errorf("process %s not found", idOrName)
+	}
+
+	proc.mu.RLock()
+	generation, restarts := proc.info.Generation, proc.info.RestartCount
+	proc.mu.RUnlock()
+
+	m.delayStop(proc)
+	if err := proc.Restart(); err != nil {
+		return err
+	}
+	return proc.waitHealthy(ctx, generation, restarts, timeout)
+}
+
+// waitHealthy waits until a run started after generation is healthy, without
+// crashes since the restart count was restarts
+func (p *Process) waitHealthy(ctx context.Context, generation, restarts int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		waiting, err := p.healthyAfter(generation, restarts)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrNotHealthy, err)
+		}
+		if waiting == "" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w within %s, still waiting for %s", ErrNotHealthy, timeout, waiting)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(healthPollInterval):
+		}
+	}
+}
+
+// healthyAfter checks whether a run started after generation is healthy:
+// its declared ports accept connections, it reported READY=1 if an earlier
+// run did, and otherwise it stayed up for a few seconds. It returns what is
+// still awaited, empty once healthy, or an error if the run failed.
+func (p *Process) healthyAfter(generation, restarts int) (string, error) {
+	health := p.health()
+
+	p.mu.RLock()
+	status, started := p.info.Status, p.info.Generation > generation
+	ports := p.info.Ports
+	crashed := p.info.RestartCount > restarts
+	ready := p.report != nil && p.report.Ready
+	reportsReady := p.reportsReady
+	var uptime time.Duration
+	if p.info.StartedAt != nil {
+		uptime = time.Since(*p.info.StartedAt)
+	}
+	exit := p.info.LastExit
+	p.mu.RUnlock()
+
+	switch {
+	case crashed || (started && status == types.StatusRestarting):
+		return "", fmt.Errorf("the new run exited: %s", describeExit(exit))
+	case !started && (status == types.StatusStarting || status == types.StatusQueued):
+		return "the process to start", nil
+	case !started:
+		return "", fmt.Errorf("the process is %s", status)
+	case status != types.StatusRunning:
+		return "", fmt.Errorf("the new run is %s after %s", status, describeExit(exit))
+	case health == types.HealthUnhealthy:
+		return "it to report healthy", nil
+	}
+
+	for _, port := range ports {
+		if probe := probePort(port); probe.Error != "" {
+			return fmt.Sprintf("%s to accept connections", probe.Address), nil
+		}
+	}
+	if reportsReady && !ready {
+		return "it to report READY=1", nil
+	}
+	if len(ports) == 0 && !reportsReady && uptime < healthyUptime {
+		return fmt.Sprintf("it to stay up for %s", healthyUptime), nil
+	}
+	return "", nil
+}
+
+// describeExit describes the last exit of a process in errors
+func describeExit(e *types.LastExit) string {
+	switch {
+	case e == nil:
+		return "an unknown exit"
+	case e.Signal != "":
+		return fmt.Sprintf("%s (%s)", e.Reason, e.Signal)
+	default:
+		return fmt.Sprintf("%s (exit code %d)", e.Reason, e.Code)
+	}
+}
@@ -0,0 +1,215 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// maxDefinitionVersions is the number of definition versions kept per
+// process
+const maxDefinitionVersions = 100
+
+// Definition actions recorded in the history
+const (
+	DefinitionCreate   = "create"
+	DefinitionUpdate   = "update"
+	DefinitionRollback = "rollback"
+)
+
+// DefinitionDelete is the action of config_change events for deleted
+// processes, whose history is removed
+const DefinitionDelete = "delete"
+
+// definitionMessages describe definition actions in events
+var definitionMessages = map[string]string{
+	DefinitionCreate:   "Definition created",
+	DefinitionUpdate:   "Definition updated",
+	DefinitionRollback: "Definition rolled back",
+	DefinitionDelete:   "Process deleted",
+}
+
+// History returns the definition history of a process, oldest first
+func (m *Manager) History(idOrName string) ([]types.DefinitionVersion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	proc := m.registry.lookup(idOrName)
+	if proc == nil {
+		return nil, fmt.Errorf("process %s not found", idOrName)
+	}
+
+	return m.loadHistory(proc.ID())
+}
+
+// Rollback restores the definition of a process from a version of its
+// history. A running process is restarted with the restored definition.
+func (m *Manager) Rollback(idOrName string, version int, actor string) (*types.ProcessInfo, error) {
+	proc, def, err := m.rollbackTarget(idOrName, version)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := proc.Definition()
+	err = m.applyUpdate(proc, def)
+
+	// The definition is replaced even if the restart fails
+	m.mu.Lock()
+	if updated := m.registry.get(proc.ID()); updated != nil && updated != proc {
+		m.recordDefinition(updated, DefinitionRollback, actor, &previous)
+		m.saveProcesses()
+		proc = updated
+	}
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return proc.Info(), nil
+}
+
+// rollbackTarget returns a process and the definition of a version of its
+// history
+func (m *Manager) rollbackTarget(idOrName string, version int) (*Process, *types.StartRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	proc := m.registry.lookup(idOrName)
+	if proc == nil {
+		return nil, nil, fmt.Errorf("process %s not found", idOrName)
+	}
+
+	history, err := m.loadHistory(proc.ID())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var target *types.DefinitionVersion
+	for i := range history {
+		if history[i].Version == version {
+			target = &history[i]
+		}
+	}
+	if target == nil {
+		return nil, nil, fmt.Errorf("process %s has no definition version %d", proc.Name(), version)
+	}
+
+	def := target.Definition
+	if err := m.checkNameFree(def.Name, proc); err != nil {
+		return nil, nil, err
+	}
+
+	return proc, &def, nil
+}
+
+// checkNameFree returns an error if another process than self uses name
+func (m *Manager) checkNameFree(name string, self *Process) error {
+	if p := m.registry.byName(name); p != nil && p != self {
+		return fmt.Errorf("process with name %s already exists", name)
+	}
+	return nil
+}
+
+// recordDefinition appends the current definition of a process to its
+// history. previous is the definition before the change, or nil for a new
+// process. The caller must hold m.mu unless the process is new.
+func (m *Manager) recordDefinition(p *Process, action, actor string, previous *types.StartRequest) {
+	history, err := m.loadHistory(p.ID())
+	if err != nil {
+		fmt.Printf("Warning: failed to load definition history of %s: %v\n", p.Name(), err)
+		return
+	}
+
+	def := p.Definition()
+	entry := types.DefinitionVersion{
+		Version:    1,
+		Timestamp:  time.Now(),
+		Actor:      actor,
+		Action:     action,
+		Definition: def,
+	}
+	if len(history) > 0 {
+		entry.Version = history[len(history)-1].Version + 1
+	}
+	if previous != nil {
+		entry.Changes = definitionChanges(previous, &def)
+	}
+
+	history = append(history, entry)
+	if len(history) > maxDefinitionVersions {
+		history = history[len(history)-maxDefinitionVersions:]
+	}
+
+	if err := m.saveHistory(p.ID(), history); err != nil {
+		fmt.Printf("Warning: failed to save definition history of %s: %v\n", p.Name(), err)
+	}
+
+	m.publishConfigChange(p, action, map[string]interface{}{
+		"version": entry.Version,
+		"actor":   actor,
+		"changes": entry.Changes,
+	})
+}
+
+// publishConfigChange publishes a config_change event for a definition
+func (m *Manager) publishConfigChange(p *Process, action string, data map[string]interface{}) {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data["action"] = action
+
+	m.events.Publish(types.Event{
+		Type:        types.EventConfigChange,
+		ProcessID:   p.ID(),
+		ProcessName: p.Name(),
+		Namespace:   p.Namespace(),
+		Message:     definitionMessages[action],
+		Data:        data,
+	})
+}
+
+func (m *Manager) historyPath(id string) string {
+	return filepath.Join(m.dataDir, "history", id+".json")
+}
+
+func (m *Manager) loadHistory(id string) ([]types.DefinitionVersion, error) {
+	data, err := os.ReadFile(m.historyPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var history []types.DefinitionVersion
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+func (m *Manager) saveHistory(id string, history []types.DefinitionVersion) error {
+	path := m.historyPath(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// removeHistory deletes the definition history of a deleted process
+func (m *Manager) removeHistory(id string) {
+	if err := os.Remove(m.historyPath(id)); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: failed to remove definition history: %v\n", err)
+	}
+}
@@ -0,0 +1,186 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/logger"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+const megabyte = 1024 * 1024
+
+// FlushLogs writes the buffered log lines of all processes
+func (m *Manager) FlushLogs() {
+	for _, p := range m.registry.all() {
+		p.logger.Flush()
+	}
+}
+
+// logWriteOptions parses the log buffering of the config, writing every line
+// as it is captured when it is invalid
+func logWriteOptions(cfg config.LogBufferConfig) logger.WriteOptions {
+	opts := logger.WriteOptions{BufferSize: cfg.SizeKB * 1024, Fsync: cfg.Fsync}
+	if cfg.FlushInterval == "" {
+		return opts
+	}
+
+	interval, err := time.ParseDuration(cfg.FlushInterval)
+	if err != nil || interval <= 0 {
+		fmt.Printf("Warning: invalid logging.buffer.flush_interval %q, not buffering logs\n", cfg.FlushInterval)
+		return opts
+	}
+	opts.FlushInterval = interval
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 64 * 1024
+	}
+	return opts
+}
+
+// logRedactor builds the redaction rules of the config, nil without any. An
+// invalid rule is an error: skipping it would write what it should mask.
+func logRedactor(rules []config.RedactRule) (*logger.Redactor, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	r := &logger.Redactor{}
+	for i, rule := range rules {
+		pattern := rule.Pattern
+		if rule.Preset != "" {
+			var ok bool
+			if pattern, ok = logger.RedactPreset(rule.Preset); !ok {
+				return nil, fmt.Errorf("logging.redact[%d]: unknown preset %q", i, rule.Preset)
+			}
+		}
+		if err := r.Add(pattern, rule.Mask); err != nil {
+			return nil, fmt.Errorf("logging.redact[%d]: %w", i, err)
+		}
+	}
+	return r, nil
+}
+
+// ownedLogFile is a rotated log file together with its process
+type ownedLogFile struct {
+	proc *Process
+	file logger.RotatedFile
+}
+
+// MaintainLogs rotates oversized log files and enforces the per-process,
+// per-namespace and global log quotas by deleting the oldest rotated files
+func (m *Manager) MaintainLogs() {
+	procs := m.registry.all()
+
+	byNamespace := make(map[string][]ownedLogFile)
+	for _, p := range procs {
+		if m.config.Logging.MaxSize > 0 {
+			if err := p.logger.RotateLogs(m.config.Logging.MaxSize); err != nil {
+				fmt.Printf("Warning: failed to rotate logs of %s: %v\n", p.Name(), err)
+			}
+		}
+
+		files, err := p.logger.RotatedFiles()
+		if err != nil {
+			continue
+		}
+
+		owned := make([]ownedLogFile, 0, len(files))
+		for _, f := range files {
+			owned = append(owned, ownedLogFile{proc: p, file: f})
+		}
+
+		if quota := p.LogQuota(); quota > 0 {
+			owned = m.deleteOldestLogs(owned, p.logger.DiskUsage(), int64(quota)*megabyte)
+		}
+
+		byNamespace[p.Namespace()] = append(byNamespace[p.Namespace()], owned...)
+	}
+
+	var all []ownedLogFile
+	for namespace, files := range byNamespace {
+		ns := m.config.Namespace(namespace)
+		if ns != nil && ns.LogQuota > 0 && namespace != config.DefaultNamespace {
+			sortOldestFirst(files)
+			files = m.deleteOldestLogs(files, logger.DirSize(config.NamespaceLogDir(m.logDir, namespace)), int64(ns.LogQuota)*megabyte)
+		}
+		all = append(all, files...)
+	}
+
+	if budget := m.config.Logging.MaxTotalSize; budget > 0 {
+		sortOldestFirst(all)
+		m.deleteOldestLogs(all, logger.DirSize(m.logDir), int64(budget)*megabyte)
+	}
+}
+
+func sortOldestFirst(files []ownedLogFile) {
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].file.ModTime.Before(files[j].file.ModTime)
+	})
+}
+
+// deleteOldestLogs deletes files, oldest first, until usage fits the budget.
+// An event is emitted for every process that lost files or whose files
+// couldn't be deleted. The files that were kept are returned, including
+// those that couldn't be deleted, so they still count against the next
+// budget and are tried again.
+func (m *Manager) deleteOldestLogs(files []ownedLogFile, usage, budget int64) []ownedLogFile {
+	if usage <= budget {
+		return files
+	}
+
+	removed := make(map[*Process][]string)
+	freed := make(map[*Process]int64)
+	failed := make(map[*Process][]string)
+	var kept []ownedLogFile
+
+	i := 0
+	for ; i < len(files) && usage > budget; i++ {
+		f := files[i]
+		if err := os.Remove(f.file.Path); err != nil {
+			fmt.Printf("Warning: failed to remove log file %s: %v\n", f.file.Path, err)
+			failed[f.proc] = append(failed[f.proc], fmt.Sprintf("%s: %v", f.file.Path, err))
+			kept = append(kept, f)
+			continue
+		}
+		usage -= f.file.Size
+		removed[f.proc] = append(removed[f.proc], f.file.Path)
+		freed[f.proc] += f.file.Size
+	}
+
+	for p, paths := range removed {
+		data := map[string]interface{}{
+			"files":       paths,
+			"freed_bytes": freed[p],
+		}
+		if errs := failed[p]; len(errs) > 0 {
+			data["errors"] = errs
+		}
+		m.events.Publish(types.Event{
+			Type:        types.EventLogQuota,
+			ProcessID:   p.ID(),
+			ProcessName: p.Name(),
+			Message:     fmt.Sprintf("Deleted %d rotated log files to stay within the log quota", len(paths)),
+			Data:        data,
+		})
+	}
+	for p, errs := range failed {
+		if _, ok := removed[p]; ok {
+			continue
+		}
+		m.events.Publish(types.Event{
+			Type:        types.EventLogQuota,
+			ProcessID:   p.ID(),
+			ProcessName: p.Name(),
+			Message:     fmt.Sprintf("Failed to delete %d rotated log files over the log quota", len(errs)),
+			Data: map[string]interface{}{
+				"errors": errs,
+			},
+			Priority: types.PriorityHigh,
+		})
+	}
+
+	return append(kept, files[i:]...)
+}
@@ -1,23 +1,83 @@
 package process
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/cron"
+	"github.com/PrismManager/gemstone/internal/events"
+	"github.com/PrismManager/gemstone/internal/logger"
+	"github.com/PrismManager/gemstone/internal/sandbox"
+	"github.com/PrismManager/gemstone/internal/secrets"
 	"github.com/PrismManager/gemstone/internal/types"
 )
 
+// loadConcurrency is how many saved processes are loaded at a time when the
+// daemon starts
+const loadConcurrency = 16
+
+// namespacePattern restricts namespace names, which are used as directory
+// names for the namespace's logs
+var namespacePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,62}$`)
+
+// ValidateNamespace checks that a namespace name is usable. An empty name
+// selects the default namespace.
+func ValidateNamespace(namespace string) error {
+	if namespace != "" && !namespacePattern.MatchString(namespace) {
+		return fmt.Errorf("invalid namespace %q", namespace)
+	}
+	return nil
+}
+
 // Manager manages all processes
 type Manager struct {
+	// mu serializes definition changes such as apply, update, rollback
+	// and delete. Lookups and listing go through the registry only.
 	mu        sync.RWMutex
-	processes map[string]*Process
+	registry  *registry
+	persister *persister
 	config    *config.Config
 	dataDir   string
 	logDir    string
+	events    *events.Bus
+	paused    atomic.Bool
+	lockdown  atomic.Bool
+	usage     *usageLedger
+	// shutdown is set once StopAll runs, after which nothing is started
+	// or restarted
+	shutdown atomic.Bool
+
+	statsTiers   []statsTier
+	statsSavedAt time.Time
+	logWrites    logger.WriteOptions
+	chaos        *chaos
+	secrets      *secrets.Resolver
+	archive      *logArchive
+	retention    *retentionPolicy
+	notify       *notifier
+	scopes       *scopeOptions
+	admission    *admission
+	queue        *startQueue
+	groupLocks   groupLocks
+	// applyMu serializes applies, which hold mu only while planning and
+	// swapping definitions. It guards scaleGroups, the scaled processes of
+	// applies by scaleKey.
+	applyMu     sync.Mutex
+	scaleGroups map[string]*scaleGroup
+	// runsMu serializes access to the run histories of scheduled processes
+	runsMu sync.Mutex
+	// crashLoopCooldown is how long crash-looped processes stay down, 0
+	// until they are started by hand
+	crashLoopCooldown time.Duration
 }
 
 // NewManager creates a new process manager
@@ -30,112 +90,342 @@ func NewManager(cfg *config.Config, dataDir, logDir string) (*Manager, error) {
 	}
 
 	m := &Manager{
-		processes: make(map[string]*Process),
+		registry:  newRegistry(),
+		persister: newPersister(),
 		config:    cfg,
 		dataDir:   dataDir,
 		logDir:    logDir,
+		events:    events.NewBus(1000),
+	}
+
+	m.usage = newUsageLedger(m.usagePath())
+	m.statsTiers = statsTiers(cfg.Stats)
+	m.logWrites = logWriteOptions(cfg.Logging.Buffer)
+	redact, err := logRedactor(cfg.Logging.Redact)
+	if err != nil {
+		return nil, err
+	}
+	m.logWrites.Redact = redact
+	m.secrets = secrets.NewResolver(cfg.Secrets)
+	m.archive = newLogArchive(cfg.Logging)
+	m.retention = newRetentionPolicy(cfg.Retention)
+	m.notify = &notifier{}
+	m.scopes = newScopeOptions(cfg.Systemd)
+	m.admission = newAdmission(cfg.Admission)
+	m.queue = newStartQueue(cfg)
+	m.crashLoopCooldown = newCrashLoopCooldown(cfg.Daemon.CrashLoopCooldown)
+	m.statsSavedAt = time.Now()
+
+	// Stay paused across daemon restarts
+	if _, err := os.Stat(m.pausedPath()); err == nil {
+		m.paused.Store(true)
+	}
+	if _, err := os.Stat(m.lockdownPath()); err == nil {
+		m.lockdown.Store(true)
 	}
 
 	// Load saved processes
 	if err := m.loadProcesses(); err != nil {
 		return nil, fmt.Errorf("failed to load processes: %w", err)
 	}
+	m.scaleGroups = m.loadScaleGroups()
+	go m.persistLoop()
 
 	return m, nil
 }
 
-// Start starts a new process
-func (m *Manager) Start(req *types.StartRequest) (*types.ProcessInfo, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// attach connects a new process to the event bus, settings and callbacks of
+// the manager
+func (m *Manager) attach(proc *Process) {
+	proc.events = m.events
+	proc.paused = m.Paused
+	proc.shutdown = m.shutdown.Load
+	proc.logger.SetBuffering(m.logWrites)
+	proc.source.dir = m.sourcePath(proc.ID())
+	proc.secrets = m.secrets
+	proc.notify = m.notify
+	proc.scopes = m.scopes
+	proc.admit = m.admit
+	proc.restartGroup = m.restartCrashedGroup
+	proc.recordRun = m.recordRun
+	proc.queue = m.queue
+	proc.persist = m.saveProcesses
+}
+
+// Start starts a new process, or only creates it if it has a schedule.
+// actor names who started it for the definition history.
+func (m *Manager) Start(req *types.StartRequest, actor string) (*types.ProcessInfo, error) {
+	if err := validateDefinition(req); err != nil {
+		return nil, err
+	}
 
 	// Check if process with same name exists
-	for _, p := range m.processes {
-		if p.Name() == req.Name {
-			return nil, fmt.Errorf("process with name %s already exists", req.Name)
-		}
+	if m.registry.byName(req.Name) != nil {
+		return nil, fmt.Errorf("process with name %s already exists", req.Name)
+	}
+
+	if err := m.fetchScript(req); err != nil {
+		return nil, err
 	}
 
 	proc, err := New(req, m.logDir)
 	if err != nil {
 		return nil, err
 	}
+	m.attach(proc)
+	proc.stats = m.loadStats(proc.ID())
 
-	if err := proc.Start(); err != nil {
+	// Reserve the name while the process starts
+	if err := m.registry.add(proc); err != nil {
+		proc.Close()
 		return nil, err
 	}
+	if err := m.prepareSource(proc, false); err != nil {
+		m.registry.remove(proc)
+		m.removeSource(proc.ID())
+		proc.Close()
+		return nil, err
+	}
+	// Scheduled processes are started by their schedule
+	if req.Schedule == "" {
+		if err := proc.Start(); err != nil {
+			m.registry.remove(proc)
+			m.removeSource(proc.ID())
+			proc.Close()
+			return nil, err
+		}
+	}
 
-	m.processes[proc.ID()] = proc
+	m.recordDefinition(proc, DefinitionCreate, actor, nil)
 
-	// Save processes
-	if err := m.saveProcesses(); err != nil {
-		// Log error but don't fail
-		fmt.Printf("Warning: failed to save processes: %v\n", err)
-	}
+	m.saveProcesses()
 
 	return proc.Info(), nil
 }
 
+// validateDefinition checks the settings of a process definition
+func validateDefinition(req *types.StartRequest) error {
+	if err := ValidateNamespace(req.Namespace); err != nil {
+		return err
+	}
+	if req.Instances != 0 {
+		return fmt.Errorf("instances is only supported in apply documents")
+	}
+	if len(req.Scale) > 0 {
+		return fmt.Errorf("scale is only supported in apply documents")
+	}
+
+	for k, v := range req.Env {
+		if err := secrets.Validate(v); err != nil {
+			return fmt.Errorf("invalid env %s: %w", k, err)
+		}
+	}
+
+	for field, v := range map[string]string{"description": req.Description, "homepage": req.Homepage, "owner_contact": req.OwnerContact} {
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("%s must be a single line", field)
+		}
+	}
+
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+	}
+	if strings.ContainsAny(req.Locale, "= \t\n") {
+		return fmt.Errorf("invalid locale %q", req.Locale)
+	}
+	if req.OutputEncoding != "" {
+		if _, err := outputEncoding(req.OutputEncoding); err != nil {
+			return err
+		}
+	}
+
+	if req.MaxUptime != "" {
+		if d, err := config.ParseDuration(req.MaxUptime); err != nil || d <= 0 {
+			return fmt.Errorf("invalid max_uptime %q", req.MaxUptime)
+		}
+	}
+	if req.Schedule != "" {
+		if _, err := cron.Parse(req.Schedule); err != nil {
+			return err
+		}
+	}
+	if req.RestartPolicy != "" {
+		if _, err := os.Stat(req.RestartPolicy); err != nil {
+			return fmt.Errorf("invalid restart policy: %w", err)
+		}
+	}
+
+	if req.WaitFor != nil {
+		if err := validateWaitFor(req.WaitFor); err != nil {
+			return fmt.Errorf("invalid wait_for: %w", err)
+		}
+	}
+
+	if req.Fetch != nil {
+		if err := validateFetch(req.Fetch); err != nil {
+			return fmt.Errorf("invalid fetch: %w", err)
+		}
+	}
+
+	if req.Source != nil {
+		if err := validateSource(req.Source, req.WorkDir); err != nil {
+			return fmt.Errorf("invalid source: %w", err)
+		}
+	}
+
+	if req.OutputWatchdog != nil {
+		if err := validateOutputWatchdog(req.OutputWatchdog); err != nil {
+			return fmt.Errorf("invalid output_watchdog: %w", err)
+		}
+	}
+
+	if req.Standby != nil {
+		if err := validateStandby(req.Standby); err != nil {
+			return fmt.Errorf("invalid standby: %w", err)
+		}
+	}
+
+	if req.SoftLimits != nil {
+		if err := validateSoftLimits(req.SoftLimits); err != nil {
+			return fmt.Errorf("invalid soft_limits: %w", err)
+		}
+	}
+
+	if r := req.Reserve; r != nil && (r.CPU < 0 || r.Memory < 0) {
+		return fmt.Errorf("invalid reserve: cpu and memory must not be negative")
+	}
+
+	if req.Network != nil {
+		if err := validateNetwork(req.Network); err != nil {
+			return fmt.Errorf("invalid network: %w", err)
+		}
+	}
+
+	if opts := sandboxOptions(req.Capabilities, req.Seccomp, req.AppArmorProfile, req.SELinuxLabel); !opts.Empty() {
+		if _, err := sandbox.Prepare(opts); err != nil {
+			return fmt.Errorf("invalid sandbox: %w", err)
+		}
+	}
+
+	if err := validateMonitorPaths(req.MonitorPaths, req.DiskAlert); err != nil {
+		return err
+	}
+
+	if err := validatePorts(req.Ports); err != nil {
+		return err
+	}
+
+	if req.OOMScoreAdj < minOOMScoreAdj || req.OOMScoreAdj > maxOOMScoreAdj {
+		return fmt.Errorf("invalid oom_score_adj %d: must be between %d and %d", req.OOMScoreAdj, minOOMScoreAdj, maxOOMScoreAdj)
+	}
+
+	return nil
+}
+
 // Stop stops a process by ID or name
 func (m *Manager) Stop(idOrName string) error {
-	m.mu.RLock()
-	proc := m.findProcess(idOrName)
-	m.mu.RUnlock()
+	proc := m.registry.lookup(idOrName)
 
 	if proc == nil {
 		return fmt.Errorf("process %s not found", idOrName)
 	}
 
+	m.delayStop(proc)
 	return proc.Stop()
 }
 
 // Restart restarts a process by ID or name
 func (m *Manager) Restart(idOrName string) error {
-	m.mu.RLock()
-	proc := m.findProcess(idOrName)
-	m.mu.RUnlock()
+	proc := m.registry.lookup(idOrName)
 
 	if proc == nil {
 		return fmt.Errorf("process %s not found", idOrName)
 	}
 
+	m.delayStop(proc)
 	return proc.Restart()
 }
 
+// Reset clears the restart counters and error state of a process by ID or
+// name
+func (m *Manager) Reset(idOrName string) error {
+	proc := m.registry.lookup(idOrName)
+	if proc == nil {
+		return fmt.Errorf("process %s not found", idOrName)
+	}
+
+	proc.Reset()
+	return nil
+}
+
 // Delete removes a process
 func (m *Manager) Delete(idOrName string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	var procID string
-	for id, p := range m.processes {
-		if id == idOrName || p.Name() == idOrName {
-			if p.Status() == types.StatusRunning {
-				if err := p.Stop(); err != nil {
-					return err
-				}
-			}
-			p.Close()
-			procID = id
-			break
+	p := m.registry.lookup(idOrName)
+	if p == nil {
+		return fmt.Errorf("process %s not found", idOrName)
+	}
+	return m.deleteProcess(p, nil)
+}
+
+// deleteProcess stops and removes a process with its history, annotations,
+// stats and source checkout. data is added to the config_change event. The caller
+// must hold m.mu.
+func (m *Manager) deleteProcess(p *Process, data map[string]interface{}) error {
+	// Waiting starts and restarts are cancelled too, so they don't launch
+	// the process once it is gone
+	switch p.Status() {
+	case types.StatusRunning, types.StatusStarting, types.StatusQueued, types.StatusRestarting:
+		if err := p.Stop(); err != nil {
+			return err
 		}
 	}
+	p.Close()
 
-	if procID == "" {
-		return fmt.Errorf("process %s not found", idOrName)
+	m.publishConfigChange(p, DefinitionDelete, data)
+	m.registry.remove(p)
+	m.removeHistory(p.ID())
+	m.removeAnnotations(p.ID())
+	m.removeRuns(p.ID())
+	m.removeStats(p.ID())
+	m.removeSource(p.ID())
+	m.saveProcesses()
+
+	return nil
+}
+
+// Update changes settings of a process without restarting it
+func (m *Manager) Update(idOrName string, patch *types.ProcessPatch, actor string) (*types.ProcessInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	proc := m.registry.lookup(idOrName)
+	if proc == nil {
+		return nil, fmt.Errorf("process %s not found", idOrName)
+	}
+
+	previous := proc.Definition()
+	if patch.AutoStart != nil {
+		proc.SetAutoStart(*patch.AutoStart)
+	}
+	if current := proc.Definition(); len(definitionChanges(&previous, &current)) > 0 {
+		m.recordDefinition(proc, DefinitionUpdate, actor, &previous)
 	}
 
-	delete(m.processes, procID)
+	m.saveProcesses()
 
-	return m.saveProcesses()
+	return proc.Info(), nil
 }
 
-// Get returns process info by ID or name
+// Get returns process info by ID or name, with CPU and memory usage of the
+// last stats sample
 func (m *Manager) Get(idOrName string) *types.ProcessInfo {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	proc := m.registry.lookup(idOrName)
 
-	proc := m.findProcess(idOrName)
 	if proc == nil {
 		return nil
 	}
@@ -143,14 +433,30 @@ func (m *Manager) Get(idOrName string) *types.ProcessInfo {
 	return proc.Info()
 }
 
-// List returns all processes
-func (m *Manager) List() []*types.ProcessInfo {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// GetFresh returns process info by ID or name with CPU and memory usage
+// sampled now
+func (m *Manager) GetFresh(idOrName string) *types.ProcessInfo {
+	proc := m.registry.lookup(idOrName)
+
+	if proc == nil {
+		return nil
+	}
+
+	return proc.FreshInfo()
+}
 
-	result := make([]*types.ProcessInfo, 0, len(m.processes))
-	for _, p := range m.processes {
-		result = append(result, p.Info())
+// List returns all processes. With fresh, CPU and memory usage are sampled
+// now instead of taken from the last stats sample.
+func (m *Manager) List(fresh bool) []*types.ProcessInfo {
+	procs := m.registry.all()
+
+	result := make([]*types.ProcessInfo, 0, len(procs))
+	for _, p := range procs {
+		if fresh {
+			result = append(result, p.FreshInfo())
+		} else {
+			result = append(result, p.Info())
+		}
 	}
 
 	return result
@@ -158,9 +464,7 @@ func (m *Manager) List() []*types.ProcessInfo {
 
 // Stats returns stats for a process
 func (m *Manager) Stats(idOrName string) *types.ProcessStats {
-	m.mu.RLock()
-	proc := m.findProcess(idOrName)
-	m.mu.RUnlock()
+	proc := m.registry.lookup(idOrName)
 
 	if proc == nil {
 		return nil
@@ -171,12 +475,9 @@ func (m *Manager) Stats(idOrName string) *types.ProcessStats {
 
 // AllStats returns stats for all running processes
 func (m *Manager) AllStats() []*types.ProcessStats {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
 	result := make([]*types.ProcessStats, 0)
-	for _, p := range m.processes {
-		if stats := p.Stats(); stats != nil {
+	for _, stats := range sampleStats(m.registry.all()) {
+		if stats != nil {
 			result = append(result, stats)
 		}
 	}
@@ -184,54 +485,192 @@ func (m *Manager) AllStats() []*types.ProcessStats {
 	return result
 }
 
-// GetStatsHistory returns historical stats for a process
-func (m *Manager) GetStatsHistory(idOrName string, limit int) []types.ProcessStats {
-	m.mu.RLock()
-	proc := m.findProcess(idOrName)
-	m.mu.RUnlock()
+// GetStatsHistory returns historical stats for a process from since on
+func (m *Manager) GetStatsHistory(idOrName string, since time.Time, limit int) []types.ProcessStats {
+	proc := m.registry.lookup(idOrName)
 
 	if proc == nil {
 		return nil
 	}
 
-	return proc.GetStatsHistory(limit)
+	return proc.GetStatsHistory(since, limit)
+}
+
+// EachStatsSample calls fn for each sample of the stats history of a process
+func (m *Manager) EachStatsSample(idOrName string, since time.Time, limit int, fn func(types.ProcessStats) error) error {
+	proc := m.registry.lookup(idOrName)
+
+	if proc == nil {
+		return fmt.Errorf("process %s not found", idOrName)
+	}
+
+	return proc.EachStatsSample(since, limit, fn)
+}
+
+// StreamLogs calls fn for each log line of a process GetLogs returns
+func (m *Manager) StreamLogs(idOrName string, lines int, logType string, run int, filter *logger.Filter, fn func(string) error) error {
+	proc := m.registry.lookup(idOrName)
+
+	if proc == nil {
+		return fmt.Errorf("process %s not found", idOrName)
+	}
+
+	return proc.StreamLogs(lines, logType, run, filter, fn)
+}
+
+// StreamLogsAfter calls fn for each log line of a process with a sequence
+// number above after
+func (m *Manager) StreamLogsAfter(idOrName, logType string, after uint64, filter *logger.Filter, fn func(string) error) error {
+	proc := m.registry.lookup(idOrName)
+	if proc == nil {
+		return fmt.Errorf("process %s not found", idOrName)
+	}
+
+	return proc.StreamLogsAfter(logType, after, filter, fn)
+}
+
+// SubscribeLogs returns a live stream of the log lines of a process
+func (m *Manager) SubscribeLogs(idOrName, logType string) (*logger.Stream, func(), error) {
+	proc := m.registry.lookup(idOrName)
+	if proc == nil {
+		return nil, nil, fmt.Errorf("process %s not found", idOrName)
+	}
+
+	stream, cancel := proc.SubscribeLogs(logType)
+	return stream, cancel, nil
 }
 
 // GetLogs returns logs for a process
-func (m *Manager) GetLogs(idOrName string, lines int, logType string) ([]string, error) {
-	m.mu.RLock()
-	proc := m.findProcess(idOrName)
-	m.mu.RUnlock()
+func (m *Manager) GetLogs(idOrName string, lines int, logType string, run int, filter *logger.Filter) ([]string, error) {
+	proc := m.registry.lookup(idOrName)
 
 	if proc == nil {
 		return nil, fmt.Errorf("process %s not found", idOrName)
 	}
 
-	return proc.GetLogs(lines, logType)
+	return proc.GetLogs(lines, logType, run, filter)
+}
+
+// LogFilePath returns the path of a raw log file for a process
+func (m *Manager) LogFilePath(idOrName, logType string, rotation int) (string, error) {
+	proc := m.registry.lookup(idOrName)
+
+	if proc == nil {
+		return "", fmt.Errorf("process %s not found", idOrName)
+	}
+
+	return proc.logger.LogFilePath(logType, rotation)
+}
+
+// EnforceSoftLimits throttles processes exceeding their soft limits and
+// lifts throttling that has expired
+func (m *Manager) EnforceSoftLimits() {
+	procs := m.registry.all()
+
+	for _, p := range procs {
+		p.checkSoftLimits(m.Paused())
+	}
 }
 
-// CollectAllStats collects stats for all running processes
+// CollectAllStats samples all running processes in one pass and stores
+// their stats
 func (m *Manager) CollectAllStats() {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	procs := m.registry.all()
+	for i, stats := range sampleStats(procs) {
+		if stats != nil && !m.dropStats(procs[i]) {
+			cpuSeconds, memoryByteHours := procs[i].recordStats(stats)
+			m.usage.add(stats.Timestamp, procs[i].Namespace(), procs[i].Name(), cpuSeconds, memoryByteHours)
+		}
+	}
 
-	for _, p := range m.processes {
-		if p.Status() == types.StatusRunning {
-			p.CollectStats()
+	m.usage.saveIfDue()
+	if time.Since(m.statsSavedAt) >= statsSaveInterval {
+		m.SaveStats()
+	}
+}
+
+// Pause freezes all automatic actions such as auto-restarts and auto-start
+// until Resume is called. The pause survives daemon restarts.
+func (m *Manager) Pause() error {
+	if err := os.WriteFile(m.pausedPath(), nil, 0644); err != nil {
+		return fmt.Errorf("failed to persist pause: %w", err)
+	}
+	if !m.paused.Swap(true) {
+		m.events.Publish(types.Event{
+			Type:    types.EventPause,
+			Message: "Supervision paused, automatic actions are frozen",
+		})
+	}
+	return nil
+}
+
+// Resume ends a pause
+func (m *Manager) Resume() error {
+	if err := os.Remove(m.pausedPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to persist resume: %w", err)
+	}
+	if m.paused.Swap(false) {
+		m.events.Publish(types.Event{
+			Type:    types.EventResume,
+			Message: "Supervision resumed",
+		})
+	}
+	return nil
+}
+
+// Paused returns whether supervision is paused
+func (m *Manager) Paused() bool {
+	return m.paused.Load()
+}
+
+func (m *Manager) pausedPath() string {
+	return filepath.Join(m.dataDir, "paused")
+}
+
+// SetLockdown turns lockdown on or off. While locked down the API refuses
+// all changes except from override tokens; supervision carries on. The
+// lockdown survives daemon restarts.
+func (m *Manager) SetLockdown(on bool) error {
+	if on {
+		if err := os.WriteFile(m.lockdownPath(), nil, 0644); err != nil {
+			return fmt.Errorf("failed to persist lockdown: %w", err)
 		}
+	} else if err := os.Remove(m.lockdownPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to persist lockdown: %w", err)
 	}
+
+	if m.lockdown.Swap(on) != on {
+		event := types.Event{Type: types.EventLockdown, Message: "Lockdown on, the API is read-only"}
+		if !on {
+			event = types.Event{Type: types.EventLockdownLifted, Message: "Lockdown lifted"}
+		}
+		m.events.Publish(event)
+	}
+	return nil
+}
+
+// Lockdown returns whether the API is locked down
+func (m *Manager) Lockdown() bool {
+	return m.lockdown.Load()
+}
+
+func (m *Manager) lockdownPath() string {
+	return filepath.Join(m.dataDir, "lockdown")
 }
 
 // StartAutoStartProcesses starts all processes marked for auto-start
 func (m *Manager) StartAutoStartProcesses() {
-	m.mu.RLock()
+	if m.Paused() {
+		fmt.Println("Supervision is paused, not auto-starting processes")
+		return
+	}
+
 	toStart := make([]*Process, 0)
-	for _, p := range m.processes {
+	for _, p := range m.registry.all() {
 		if p.ShouldAutoStart() && p.Status() == types.StatusStopped {
 			toStart = append(toStart, p)
 		}
 	}
-	m.mu.RUnlock()
 
 	for _, p := range toStart {
 		if err := p.Start(); err != nil {
@@ -240,32 +679,51 @@ func (m *Manager) StartAutoStartProcesses() {
 	}
 }
 
-// StopAll stops all running processes
-func (m *Manager) StopAll() {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// StopAll stops all running processes and waits for them to exit until ctx
+// is done
+func (m *Manager) StopAll(ctx context.Context) error {
+	m.shutdown.Store(true)
 
-	for _, p := range m.processes {
-		if p.Status() == types.StatusRunning {
+	procs := m.registry.all()
+	for _, p := range procs {
+		switch p.Status() {
+		case types.StatusRunning, types.StatusStarting, types.StatusQueued, types.StatusRestarting:
 			_ = p.Stop()
 		}
 	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		remaining := 0
+		for _, p := range procs {
+			switch p.Status() {
+			case types.StatusRunning, types.StatusStopping, types.StatusRestarting:
+				remaining++
+			}
+		}
+		if remaining == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("%d processes did not stop in time", remaining)
+		}
+	}
 }
 
 // Count returns the number of managed processes
 func (m *Manager) Count() int {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	return len(m.processes)
+	return m.registry.len()
 }
 
 // RunningCount returns the number of running processes
 func (m *Manager) RunningCount() int {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
 	count := 0
-	for _, p := range m.processes {
+	for _, p := range m.registry.all() {
 		if p.Status() == types.StatusRunning {
 			count++
 		}
@@ -273,34 +731,9 @@ func (m *Manager) RunningCount() int {
 	return count
 }
 
-func (m *Manager) findProcess(idOrName string) *Process {
-	// Try by ID first
-	if p, ok := m.processes[idOrName]; ok {
-		return p
-	}
-
-	// Try by name
-	for _, p := range m.processes {
-		if p.Name() == idOrName {
-			return p
-		}
-	}
-
-	return nil
-}
-
-func (m *Manager) saveProcesses() error {
-	configs := make([]*config.Process, 0, len(m.processes))
-	for _, p := range m.processes {
-		configs = append(configs, p.ToConfig())
-	}
-
-	data, err := json.MarshalIndent(configs, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(filepath.Join(m.dataDir, "processes.json"), data, 0644)
+// Events returns the event bus of the manager
+func (m *Manager) Events() *events.Bus {
+	return m.events
 }
 
 func (m *Manager) loadProcesses() error {
@@ -319,14 +752,62 @@ func (m *Manager) loadProcesses() error {
 		return err
 	}
 
-	for _, cfg := range configs {
-		proc, err := FromConfig(cfg, m.logDir)
-		if err != nil {
-			fmt.Printf("Warning: failed to load process %s: %v\n", cfg.Name, err)
+	// Processes are built and their stats histories read in parallel, then
+	// registered in file order so a duplicate name always loses to the first
+	procs := make([]*Process, len(configs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(loadConcurrency, len(configs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				procs[i] = m.loadProcess(configs[i])
+			}
+		}()
+	}
+	for i := range configs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for i, proc := range procs {
+		if proc == nil {
 			continue
 		}
-		m.processes[proc.ID()] = proc
+		if err := m.registry.add(proc); err != nil {
+			fmt.Printf("Warning: failed to load process %s: %v\n", configs[i].Name, err)
+			proc.Close()
+		}
 	}
 
 	return nil
 }
+
+// loadProcess builds a saved process, or returns nil if it can't be loaded.
+// A definition that no longer validates is loaded with a warning so the
+// process isn't lost.
+func (m *Manager) loadProcess(cfg *config.Process) *Process {
+	proc, err := FromConfig(cfg, m.logDir)
+	if err != nil {
+		fmt.Printf("Warning: failed to load process %s: %v\n", cfg.Name, err)
+		return nil
+	}
+	def := proc.Definition()
+	if err := validateDefinition(&def); err != nil {
+		fmt.Printf("Warning: process %s: %v\n", cfg.Name, err)
+	}
+	// Fetch the script again if the data directory lost it
+	if err := m.fetchScript(&def); err != nil {
+		fmt.Printf("Warning: process %s: %v\n", cfg.Name, err)
+	}
+
+	m.attach(proc)
+	proc.stats = m.loadStats(proc.ID())
+	if err := m.loadSource(proc); err != nil {
+		fmt.Printf("Warning: process %s: source: %v\n", cfg.Name, err)
+	}
+	proc.info.LastRun = m.lastRun(proc.ID())
+	return proc
+}
@@ -0,0 +1,106 @@
+package process
+
+import (
+	"sort"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// healthRank orders health from best to worst
+var healthRank = map[string]int{
+	types.HealthHealthy:   0,
+	types.HealthDegraded:  1,
+	types.HealthUnhealthy: 2,
+}
+
+// Namespaces returns the rollups of all namespaces with processes or in the
+// config, sorted by name
+func (m *Manager) Namespaces() []types.NamespaceStatus {
+	procs := m.registry.all()
+
+	rollups := make(map[string]*types.NamespaceStatus)
+	rollup := func(name string) *types.NamespaceStatus {
+		if r, ok := rollups[name]; ok {
+			return r
+		}
+		r := &types.NamespaceStatus{Name: name, Health: types.HealthHealthy}
+		rollups[name] = r
+		return r
+	}
+	for _, ns := range m.config.Namespaces {
+		rollup(ns.Name)
+	}
+
+	for _, p := range procs {
+		info := p.Info()
+		r := rollup(info.Namespace)
+		r.Total++
+		r.Restarts += info.RestartCount
+
+		switch info.Status {
+		case types.StatusRunning:
+			r.Running++
+			r.CPU += info.CPU
+			r.Memory += info.Memory
+		case types.StatusErrored:
+			r.Errored++
+		case types.StatusStopped:
+			r.Stopped++
+		}
+
+		health := p.health()
+		if health != types.HealthHealthy {
+			r.Unhealthy = append(r.Unhealthy, info.Name)
+		}
+		if healthRank[health] > healthRank[r.Health] {
+			r.Health = health
+		}
+	}
+
+	result := make([]types.NamespaceStatus, 0, len(rollups))
+	for _, r := range rollups {
+		sort.Strings(r.Unhealthy)
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// health tells whether the process is healthy: unhealthy when it errored,
+// is restarting, gave up after a crash or a port is down, degraded while
+// it is throttled or a port probe failed. A running process may report
+// itself degraded or unhealthy on the notify socket.
+func (p *Process) health() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	switch p.info.Status {
+	case types.StatusErrored, types.StatusRestarting:
+		return types.HealthUnhealthy
+	case types.StatusStopped:
+		if e := p.info.LastExit; e != nil && (e.Reason == types.ExitCrashed || e.Reason == types.ExitOOM) {
+			return types.HealthUnhealthy
+		}
+		return types.HealthHealthy
+	case types.StatusRunning:
+		reported := ""
+		if p.report != nil {
+			reported = p.report.Health
+		}
+		if len(p.probes.down) > 0 || reported == types.HealthUnhealthy {
+			return types.HealthUnhealthy
+		}
+		if reported == types.HealthDegraded {
+			return types.HealthDegraded
+		}
+		for _, r := range p.probes.results {
+			if r.Error != "" {
+				return types.HealthDegraded
+			}
+		}
+		if p.throttle.active {
+			return types.HealthDegraded
+		}
+	}
+	return types.HealthHealthy
+}
@@ -0,0 +1,156 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PrismManager/gemstone/internal/sandbox"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// Network modes
+const (
+	NetworkHost     = "host"
+	NetworkIsolated = "isolated"
+)
+
+// defaultPublishHost is where published ports listen unless an address is
+// given, so nothing is exposed on all interfaces by accident
+const defaultPublishHost = "127.0.0.1"
+
+// portForward publishes a port of an isolated process on the host
+type portForward struct {
+	listen string // host address
+	target string // address inside the namespace
+}
+
+// validateNetwork checks the network settings of a process
+func validateNetwork(n *types.Network) error {
+	switch n.Mode {
+	case "", NetworkHost:
+		if len(n.Publish) > 0 {
+			return fmt.Errorf("publish requires mode %q", NetworkIsolated)
+		}
+	case NetworkIsolated:
+	default:
+		return fmt.Errorf("unknown mode %q (expected host or isolated)", n.Mode)
+	}
+
+	for _, publish := range n.Publish {
+		if _, err := parsePublish(publish); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parsePublish parses "[host_ip:]host_port:port" or "port"
+func parsePublish(s string) (portForward, error) {
+	i := strings.LastIndex(s, ":")
+	host, hostPort, port := defaultPublishHost, s[i+1:], s[i+1:]
+	if i >= 0 {
+		hostPort = s[:i]
+		if h, p, err := net.SplitHostPort(hostPort); err == nil {
+			host, hostPort = h, p
+		}
+	}
+
+	for _, p := range []string{hostPort, port} {
+		if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+			return portForward{}, fmt.Errorf("invalid publish %q: expected [host_ip:]host_port:port", s)
+		}
+	}
+	if net.ParseIP(host) == nil {
+		return portForward{}, fmt.Errorf("invalid publish %q: %q is not an IP address", s, host)
+	}
+
+	return portForward{
+		listen: net.JoinHostPort(host, hostPort),
+		target: net.JoinHostPort("127.0.0.1", port),
+	}, nil
+}
+
+// isolatedNetwork reports whether the process runs in its own network
+// namespace
+func (p *Process) isolatedNetwork() bool {
+	return p.info.Network != nil && p.info.Network.Mode == NetworkIsolated
+}
+
+// startForwards listens on the published ports of a newly started process
+// and forwards connections into its namespace. The caller must hold p.mu.
+func (p *Process) startForwards() {
+	if !p.isolatedNetwork() {
+		return
+	}
+
+	pid := p.info.PID
+	for _, publish := range p.info.Network.Publish {
+		fwd, err := parsePublish(publish)
+		if err != nil {
+			continue
+		}
+
+		listener, err := net.Listen("tcp", fwd.listen)
+		if err != nil {
+			p.logger.Log("stderr", fmt.Sprintf("Failed to publish %s: %v", publish, err))
+			continue
+		}
+		p.forwards = append(p.forwards, listener)
+
+		go p.serveForward(listener, pid, fwd.target)
+	}
+}
+
+func (p *Process) serveForward(listener net.Listener, pid int, target string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+
+			upstream, err := sandbox.DialNamespace(pid, target)
+			if err != nil {
+				p.logger.Log("stderr", fmt.Sprintf("Failed to forward connection to %s: %v", target, err))
+				return
+			}
+			defer upstream.Close()
+
+			proxy(conn, upstream)
+		}()
+	}
+}
+
+// proxy copies between two connections until both directions are done
+func proxy(a, b net.Conn) {
+	var wg sync.WaitGroup
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, _ = io.Copy(dst, src)
+		if tcp, ok := dst.(*net.TCPConn); ok {
+			_ = tcp.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+
+	wg.Add(2)
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	wg.Wait()
+}
+
+// stopForwards closes the listeners of the published ports. Forwarded
+// connections end with the process. The caller must hold p.mu.
+func (p *Process) stopForwards() {
+	for _, listener := range p.forwards {
+		listener.Close()
+	}
+	p.forwards = nil
+}
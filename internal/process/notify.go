@@ -0,0 +1,174 @@
+package process
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// Limits on what a process can report, so a chatty or broken one can't
+// grow the daemon's memory
+const (
+	maxNotifySize   = 4096
+	maxReportValue  = 1024
+	maxReportDetail = 32
+)
+
+// notifier is the datagram socket processes report their state on, in the
+// format of sd_notify
+type notifier struct {
+	mu   sync.RWMutex
+	path string
+	conn *net.UnixConn
+}
+
+// socket returns the path of the notify socket, empty when not listening
+func (n *notifier) socket() string {
+	if n == nil {
+		return ""
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.path
+}
+
+// ListenNotify creates the notify socket at path and starts reading the
+// reports of processes from it. Abstract sockets, starting with @, have no
+// file to clean up or set permissions on.
+func (m *Manager) ListenNotify(path string) error {
+	abstract := config.IsAbstractSocket(path)
+	if !abstract {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove stale notify socket: %w", err)
+		}
+	}
+	conn, err := listenNotify(path)
+	if err != nil {
+		return err
+	}
+	// Processes may run as any user
+	if !abstract {
+		if err := os.Chmod(path, 0666); err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to set notify socket permissions: %w", err)
+		}
+	}
+
+	m.notify.mu.Lock()
+	m.notify.path = path
+	m.notify.conn = conn
+	m.notify.mu.Unlock()
+
+	go m.serveNotify(conn)
+	return nil
+}
+
+// CloseNotify closes and removes the notify socket
+func (m *Manager) CloseNotify() {
+	m.notify.mu.Lock()
+	defer m.notify.mu.Unlock()
+	if m.notify.conn == nil {
+		return
+	}
+	m.notify.conn.Close()
+	if !config.IsAbstractSocket(m.notify.path) {
+		os.Remove(m.notify.path)
+	}
+	m.notify.conn = nil
+	m.notify.path = ""
+}
+
+// handleNotify applies a message sent by a process, newline separated
+// KEY=VALUE assignments such as READY=1 and STATUS=text
+func (p *Process) handleNotify(msg string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.info.Status != types.StatusRunning && p.info.Status != types.StatusStopping {
+		return
+	}
+
+	// Copy on write, Info hands out the pointer
+	report := types.Report{}
+	if p.report != nil {
+		report = *p.report
+	}
+	details, copied := report.Details, false
+	wasReady, oldHealth := report.Ready, report.Health
+
+	for _, line := range strings.Split(msg, "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if len(value) > maxReportValue {
+			value = value[:maxReportValue]
+		}
+
+		switch key {
+		case "READY":
+			report.Ready = value == "1"
+		case "STATUS":
+			report.Status = value
+		case "STOPPING":
+			report.Stopping = value == "1"
+		case "HEALTH":
+			switch value {
+			case types.HealthHealthy, types.HealthDegraded, types.HealthUnhealthy:
+				report.Health = value
+			}
+		case "EXTEND_TIMEOUT_USEC":
+			// Ask for more time to shut down before being killed
+			if usec, err := strconv.ParseInt(value, 10, 64); err == nil && usec > 0 && p.info.Status == types.StatusStopping {
+				if deadline := time.Now().Add(time.Duration(usec) * time.Microsecond); deadline.After(p.stopDeadline) {
+					p.stopDeadline = deadline
+				}
+			}
+		case "WATCHDOG":
+			if value == "1" {
+				p.recordOutput()
+			}
+		default:
+			name, ok := strings.CutPrefix(key, "X_")
+			if !ok || name == "" {
+				continue
+			}
+			if !copied {
+				details = make(map[string]string, len(report.Details)+1)
+				for k, v := range report.Details {
+					details[k] = v
+				}
+				copied = true
+			}
+			if value == "" {
+				delete(details, name)
+			} else if _, ok := details[name]; ok || len(details) < maxReportDetail {
+				details[name] = value
+			}
+		}
+	}
+
+	report.Details = details
+	report.UpdatedAt = time.Now()
+	p.report = &report
+
+	if report.Ready && !wasReady {
+		p.reportsReady = true
+		p.releaseStartSlot()
+		p.publish(types.EventReady, fmt.Sprintf("Process %s reported ready", p.info.Name), nil)
+	}
+	if report.Health != oldHealth {
+		p.publish(types.EventHealth, fmt.Sprintf("Process %s reported %s", p.info.Name, report.Health), map[string]interface{}{
+			"health":   report.Health,
+			"previous": oldHealth,
+			"status":   report.Status,
+		})
+	}
+}
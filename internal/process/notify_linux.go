@@ -0,0 +1,127 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// maxNotifyDepth bounds the walk from a sender up to the main process
+const maxNotifyDepth = 32
+
+// listenNotify creates the datagram socket at path with SO_PASSCRED set, so
+// every message carries the PID of its sender
+func listenNotify(path string) (*net.UnixConn, error) {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notify socket: %w", err)
+	}
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var optErr error
+	if err := raw.Control(func(fd uintptr) {
+		optErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+	}); err != nil {
+		optErr = err
+	}
+	if optErr != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to enable credentials on notify socket: %w", optErr)
+	}
+	return conn, nil
+}
+
+// serveNotify reads messages until the socket is closed and hands each to
+// the process that sent it. Messages from unknown senders are dropped.
+func (m *Manager) serveNotify(conn *net.UnixConn) {
+	buf := make([]byte, maxNotifySize)
+	oob := make([]byte, syscall.CmsgSpace(syscall.SizeofUcred))
+	for {
+		n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			return
+		}
+
+		pid := senderPID(oob[:oobn])
+		if pid <= 0 {
+			continue
+		}
+		if proc := m.processForPID(pid); proc != nil {
+			proc.handleNotify(string(buf[:n]))
+		}
+	}
+}
+
+// senderPID returns the PID in the credentials of a message
+func senderPID(oob []byte) int {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0
+	}
+	for _, msg := range msgs {
+		if cred, err := syscall.ParseUnixCredentials(&msg); err == nil {
+			return int(cred.Pid)
+		}
+	}
+	return 0
+}
+
+// processForPID returns the running process pid belongs to: its main
+// process, a member of its process group or a descendant
+func (m *Manager) processForPID(pid int) *Process {
+	byPID := make(map[int]*Process)
+	for _, p := range m.registry.all() {
+		p.mu.RLock()
+		if p.info.PID > 0 {
+			byPID[p.info.PID] = p
+		}
+		p.mu.RUnlock()
+	}
+	if len(byPID) == 0 {
+		return nil
+	}
+
+	for depth := 0; depth < maxNotifyDepth && pid > 1; depth++ {
+		if p, ok := byPID[pid]; ok {
+			return p
+		}
+		ppid, pgrp, err := readParent(pid)
+		if err != nil {
+			return nil
+		}
+		// Processes run in their own group led by the main process, which
+		// also catches daemonized children reparented to init
+		if p, ok := byPID[pgrp]; ok {
+			return p
+		}
+		pid = ppid
+	}
+	return nil
+}
+
+// readParent returns the parent PID and process group of pid
+func readParent(pid int) (ppid, pgrp int, err error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return 0, 0, fmt.Errorf("malformed stat of %d", pid)
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 3 {
+		return 0, 0, fmt.Errorf("malformed stat of %d", pid)
+	}
+	ppid, _ = strconv.Atoi(fields[1])
+	pgrp, _ = strconv.Atoi(fields[2])
+	return ppid, pgrp, nil
+}
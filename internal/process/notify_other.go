@@ -0,0 +1,16 @@
+//go:build !linux
+
+package process
+
+import (
+	"errors"
+	"net"
+)
+
+// listenNotify is only supported on Linux, where messages carry the PID of
+// their sender
+func listenNotify(path string) (*net.UnixConn, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (m *Manager) serveNotify(conn *net.UnixConn) {}
@@ -0,0 +1,22 @@
+package process
+
+import "fmt"
+
+// Range of oom_score_adj
+const (
+	minOOMScoreAdj = -1000
+	maxOOMScoreAdj = 1000
+)
+
+// applyOOMScoreAdj sets the OOM score adjustment of a newly started process.
+// Children forked before it is set keep the daemon's value. The caller must
+// hold p.mu.
+func (p *Process) applyOOMScoreAdj() {
+	if p.info.OOMScoreAdj == 0 {
+		return
+	}
+
+	if err := setOOMScoreAdj(p.info.PID, p.info.OOMScoreAdj); err != nil {
+		p.logger.Log("stderr", fmt.Sprintf("Failed to set oom_score_adj: %v", err))
+	}
+}
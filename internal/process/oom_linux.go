@@ -0,0 +1,14 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// setOOMScoreAdj writes the OOM score adjustment of a process. Lowering it
+// requires CAP_SYS_RESOURCE.
+func setOOMScoreAdj(pid, adj int) error {
+	path := fmt.Sprintf("/proc/%d/oom_score_adj", pid)
+	return os.WriteFile(path, []byte(strconv.Itoa(adj)), 0644)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package process
+
+import "fmt"
+
+// setOOMScoreAdj is only supported on Linux
+func setOOMScoreAdj(pid, adj int) error {
+	return fmt.Errorf("oom_score_adj is only supported on Linux")
+}
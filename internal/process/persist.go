@@ -0,0 +1,154 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+const (
+	// persistDelay is how long changes are collected before the process
+	// definitions are written
+	persistDelay = 250 * time.Millisecond
+
+	// persistRetryDelay is how long a failed write waits before retrying
+	persistRetryDelay = 5 * time.Second
+)
+
+// persister writes the process definitions in the background. Changes
+// requested while a write is pending are coalesced into it.
+type persister struct {
+	requests chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newPersister() *persister {
+	return &persister{
+		requests: make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// saveProcesses schedules a write of the process definitions
+func (m *Manager) saveProcesses() {
+	select {
+	case m.persister.requests <- struct{}{}:
+	default:
+	}
+}
+
+// persistLoop writes the process definitions when requested until
+// FlushProcesses is called
+func (m *Manager) persistLoop() {
+	defer close(m.persister.done)
+
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-m.persister.requests:
+		case <-retry:
+		case <-m.persister.stop:
+			return
+		}
+
+		// Collect further changes before writing
+		select {
+		case <-time.After(persistDelay):
+		case <-m.persister.stop:
+			return
+		}
+		select {
+		case <-m.persister.requests:
+		default:
+		}
+
+		retry = nil
+		if err := m.writeProcesses(); err != nil {
+			m.persistFailed(err)
+			retry = time.After(persistRetryDelay)
+		}
+	}
+}
+
+// FlushProcesses stops the background writer and writes the process
+// definitions now
+func (m *Manager) FlushProcesses() error {
+	close(m.persister.stop)
+	<-m.persister.done
+
+	if err := m.writeProcesses(); err != nil {
+		m.persistFailed(err)
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) persistFailed(err error) {
+	m.events.Publish(types.Event{
+		Type:    types.EventPersistFailed,
+		Message: fmt.Sprintf("Failed to save processes: %v", err),
+		Data:    map[string]interface{}{"error": err.Error()},
+	})
+}
+
+// writeProcesses writes the process definitions to processes.json
+func (m *Manager) writeProcesses() error {
+	procs := m.registry.all()
+	configs := make([]*config.Process, 0, len(procs))
+	for _, p := range procs {
+		configs = append(configs, p.ToConfig())
+	}
+
+	data, err := json.MarshalIndent(configs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(m.dataDir, "processes.json"), data, 0644)
+}
+
+// writeFileAtomic replaces a file with data so that readers and crashes see
+// either the old or the new content
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// Make the rename itself durable
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
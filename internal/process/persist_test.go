@@ -0,0 +1,32 @@
+package process
+
+import (
+	"fmt"
+	"testing"
+)
+
+func BenchmarkWriteProcesses(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			r, _ := newTestRegistry(b, n)
+			m := &Manager{registry: r, dataDir: b.TempDir()}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := m.writeProcesses(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSaveProcesses(b *testing.B) {
+	m := &Manager{persister: newPersister()}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			m.saveProcesses()
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PrismManager/gemstone/internal/secrets"
+	"github.com/PrismManager/gemstone/internal/systemd"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// redactedValue replaces secret values in launch plans
+const redactedValue = "<redacted>"
+
+// newProcessID stands in for the ID a process gets once it is created
+const newProcessID = "<new>"
+
+// PlanStart resolves what starting a new process would run without
+// creating it, fetching its script or checking out its source
+func (m *Manager) PlanStart(req *types.StartRequest) (*types.LaunchPlan, error) {
+	if err := validateDefinition(req); err != nil {
+		return nil, err
+	}
+	if m.registry.byName(req.Name) != nil {
+		return nil, fmt.Errorf("process with name %s already exists", req.Name)
+	}
+
+	def := *req
+	if err := m.resolveFetch(&def); err != nil {
+		return nil, err
+	}
+
+	proc := &Process{info: newInfo(newProcessID, &def)}
+	proc.source.dir = m.sourcePath(newProcessID)
+	proc.secrets = m.secrets
+	proc.notify = m.notify
+	proc.scopes = m.scopes
+
+	plan := proc.plan()
+	m.planAdmission(proc, plan)
+	plan.Notes = append(plan.Notes, fmt.Sprintf("The ID, shown as %s, is assigned when the process is created", newProcessID))
+	if f := def.Fetch; f != nil {
+		if _, err := os.Stat(def.Command); err != nil {
+			plan.Notes = append(plan.Notes, fmt.Sprintf("%s is downloaded and verified first", f.URL))
+		}
+	}
+	if s := def.Source; s != nil {
+		plan.Notes = append(plan.Notes, fmt.Sprintf("%s is cloned and checked out first", sourceRef(s)))
+	}
+	return plan, nil
+}
+
+// PlanRestart resolves what restarting a process would run without
+// stopping or starting it
+func (m *Manager) PlanRestart(idOrName string) (*types.LaunchPlan, error) {
+	proc := m.registry.lookup(idOrName)
+	if proc == nil {
+		return nil, fmt.Errorf("process %s not found", idOrName)
+	}
+
+	plan := proc.plan()
+	m.planAdmission(proc, plan)
+	if proc.Status() == types.StatusRunning {
+		plan.Notes = append(plan.Notes, "The running process is stopped first")
+	}
+	return plan, nil
+}
+
+// planAdmission records in a plan whether admission control would refuse
+// or warn about the start
+func (m *Manager) planAdmission(p *Process, plan *types.LaunchPlan) {
+	err := m.checkAdmission(p)
+	switch {
+	case err == nil:
+	case m.admission.mode == AdmissionWarn:
+		plan.Notes = append(plan.Notes, fmt.Sprintf("Admission control warns: %v", err))
+	default:
+		plan.Problems = append(plan.Problems, err.Error())
+	}
+}
+
+func sourceRef(s *types.Source) string {
+	if s.Ref == "" {
+		return s.Git
+	}
+	return s.Git + "@" + s.Ref
+}
+
+// plan resolves the launch of the next run the way Start and launch do.
+// What would fail is recorded as a problem rather than returned, so the
+// whole plan can be checked at once.
+func (p *Process) plan() *types.LaunchPlan {
+	var problems []string
+
+	env, err := p.environ(context.Background())
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("failed to resolve secrets: %v", err))
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	info := p.info
+	plan := &types.LaunchPlan{
+		Name:            info.Name,
+		Namespace:       info.Namespace,
+		Command:         info.Command,
+		Args:            info.Args,
+		WorkDir:         p.workDir(),
+		Stdin:           info.Stdin,
+		AutoRestart:     info.AutoRestart,
+		MaxRestarts:     info.MaxRestarts,
+		WaitFor:         info.WaitFor,
+		SoftLimits:      softLimitDefaults(info.SoftLimits),
+		Reserve:         info.Reserve,
+		OOMScoreAdj:     info.OOMScoreAdj,
+		Capabilities:    info.Capabilities,
+		Seccomp:         info.Seccomp,
+		AppArmorProfile: info.AppArmorProfile,
+		SELinuxLabel:    info.SELinuxLabel,
+		IsolatedNetwork: p.isolatedNetwork(),
+	}
+
+	// Commands without a slash are looked up in the daemon's PATH
+	if strings.Contains(info.Command, "/") {
+		plan.Path = info.Command
+	} else if path, err := exec.LookPath(info.Command); err == nil {
+		plan.Path = path
+	} else {
+		problems = append(problems, fmt.Sprintf("command not found: %v", err))
+	}
+
+	base := os.Environ()
+	if info.User != "" {
+		plan.User, plan.Group = info.User, info.Group
+		cred, u, err := getUserCredentials(info.User, info.Group)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("failed to get user credentials: %v", err))
+		} else {
+			plan.UID, plan.GID = cred.Uid, cred.Gid
+			base = append(base, userEnv(u)...)
+		}
+	} else {
+		plan.UID, plan.GID = uint32(os.Getuid()), uint32(os.Getgid())
+		if u, err := user.Current(); err == nil {
+			plan.User = u.Username
+		}
+	}
+	if info.Timezone != "" {
+		base = append(base, "TZ="+info.Timezone)
+	}
+	if info.Locale != "" {
+		base = append(base, "LANG="+info.Locale)
+	}
+	plan.Env = planEnv(append(append(base, p.managedEnv()...), env...), info.Env)
+
+	if p.scopes != nil {
+		plan.Unit = systemd.UnitName("scope", "gemstone", info.Name, info.ID, strconv.Itoa(info.Generation+1))
+		plan.Slice = p.scopes.slice
+	} else if info.SoftLimits != nil {
+		plan.Cgroup = "proc-" + info.ID
+	}
+
+	if info.WaitFor != nil {
+		plan.Notes = append(plan.Notes, fmt.Sprintf("Waits until %s accepts connections", info.WaitFor.TCP))
+	}
+
+	plan.Problems = problems
+	return plan
+}
+
+// planEnv returns the environment a process gets from the variables in
+// launch order, the last of duplicates winning as in exec, sorted. The
+// values of variables defined as secret references are redacted.
+func planEnv(vars []string, defined map[string]string) []string {
+	values := make(map[string]string, len(vars))
+	for _, kv := range vars {
+		k, v, _ := strings.Cut(kv, "=")
+		values[k] = v
+	}
+	for k, v := range defined {
+		if secrets.IsReference(v) {
+			values[k] = redactedValue
+		}
+	}
+
+	env := make([]string, 0, len(values))
+	for k, v := range values {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// softLimitDefaults returns soft limits with the defaults applied when a
+// limit is exceeded filled in
+func softLimitDefaults(limits *types.SoftLimits) *types.SoftLimits {
+	if limits == nil {
+		return nil
+	}
+	l := *limits
+	if l.CPUPercent > 0 {
+		if l.CPUAction == "" {
+			l.CPUAction = CPUActionMax
+		}
+		if l.CPUAction == CPUActionWeight && l.CPUWeight == 0 {
+			l.CPUWeight = defaultCPUWeight
+		}
+		if l.CPUAction == CPUActionMax && l.CPUThrottle == 0 {
+			l.CPUThrottle = l.CPUPercent / 2
+		}
+		if l.ThrottleFor == "" {
+			l.ThrottleFor = DefaultThrottleFor.String()
+		}
+	}
+	return &l
+}
@@ -0,0 +1,194 @@
+package process
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/policy"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// Declared ports are connected to every probe interval. A port that fails
+// probeFailures probes in a row is down.
+const (
+	probeTimeout  = 2 * time.Second
+	probeFailures = 3
+)
+
+// probeState tracks the probes of the ports of a process
+type probeState struct {
+	results []types.PortProbe
+	down    map[string]bool
+}
+
+// validatePorts checks that ports are "port" or "host:port"
+func validatePorts(ports []string) error {
+	for _, port := range ports {
+		if _, _, err := splitProbeAddress(port); err != nil {
+			return fmt.Errorf("invalid port %q: %w", port, err)
+		}
+	}
+	return nil
+}
+
+// splitProbeAddress returns the address to connect to for a declared port,
+// on the loopback interface when no host is given
+func splitProbeAddress(port string) (string, int, error) {
+	host, p := "127.0.0.1", port
+	if h, pp, err := net.SplitHostPort(port); err == nil {
+		host, p = h, pp
+	}
+	n, err := strconv.Atoi(p)
+	if err != nil || n < 1 || n > 65535 {
+		return "", 0, fmt.Errorf("expected a port or host:port")
+	}
+	return net.JoinHostPort(host, p), n, nil
+}
+
+// probePort connects to a port and measures how long it took
+func probePort(port string) types.PortProbe {
+	address, n, _ := splitProbeAddress(port)
+	probe := types.PortProbe{Address: address, Timestamp: time.Now()}
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, probeTimeout)
+	probe.Latency = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		probe.Error = err.Error()
+	} else {
+		conn.Close()
+	}
+
+	probe.Backlog = listenBacklog(n)
+	return probe
+}
+
+// ProbePorts connects to the declared ports of all running processes
+func (m *Manager) ProbePorts() {
+	procs := m.registry.all()
+
+	// Probes of unresponsive ports take up to the timeout, don't let them
+	// add up
+	var wg sync.WaitGroup
+	for _, p := range procs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.probePorts()
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *Process) probePorts() {
+	p.mu.RLock()
+	ports, running := p.info.Ports, p.info.Status == types.StatusRunning
+	p.mu.RUnlock()
+
+	if len(ports) == 0 || !running {
+		return
+	}
+
+	results := make([]types.PortProbe, len(ports))
+	for i, port := range ports {
+		results[i] = probePort(port)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// The process may have been stopped while probing
+	if p.info.Status != types.StatusRunning {
+		return
+	}
+	if p.probes.down == nil {
+		p.probes.down = make(map[string]bool)
+	}
+
+	previous := make(map[string]types.PortProbe, len(p.probes.results))
+	for _, r := range p.probes.results {
+		previous[r.Address] = r
+	}
+
+	for i := range results {
+		r := &results[i]
+		if r.Error == "" {
+			if p.probes.down[r.Address] {
+				delete(p.probes.down, r.Address)
+				p.publish(types.EventPortUp, fmt.Sprintf("%s accepts connections again", r.Address), map[string]interface{}{
+					"address":    r.Address,
+					"latency_ms": r.Latency,
+				})
+			}
+			continue
+		}
+
+		r.Failures = previous[r.Address].Failures + 1
+		if r.Failures == probeFailures {
+			p.probes.down[r.Address] = true
+			p.publish(types.EventPortDown, fmt.Sprintf("%s is not accepting connections: %s", r.Address, r.Error), map[string]interface{}{
+				"address":  r.Address,
+				"error":    r.Error,
+				"failures": r.Failures,
+			})
+			p.decidePortDown(*r)
+		}
+	}
+	p.probes.results = results
+}
+
+// decidePortDown asks the restart policy whether to restart a process whose
+// port is down. Without a policy the process is left running. The caller
+// must hold p.mu.
+func (p *Process) decidePortDown(probe types.PortProbe) {
+	path := p.info.RestartPolicy
+	if path == "" || (p.paused != nil && p.paused()) {
+		return
+	}
+
+	in := policy.Input{
+		Trigger:      policy.TriggerPortDown,
+		Name:         p.info.Name,
+		Namespace:    p.info.Namespace,
+		RestartCount: p.info.RestartCount,
+		MaxRestarts:  p.info.MaxRestarts,
+		Restarts:     append([]time.Time(nil), p.restartTimes...),
+		Now:          time.Now(),
+		Port:         probe.Address,
+		Failures:     probe.Failures,
+	}
+	if p.info.StartedAt != nil {
+		in.Uptime = time.Since(*p.info.StartedAt)
+	}
+
+	// Policies and restarts run without the lock, which the caller holds
+	go func() {
+		d := decideRestart(false, path, in)
+		if d.err != nil {
+			p.logger.Log("stderr", fmt.Sprintf("Restart policy failed on port_down, leaving the process running: %v", d.err))
+			return
+		}
+		if !d.restart {
+			return
+		}
+
+		p.logger.Log("stderr", fmt.Sprintf("Restart policy decided to %s as %s is down: %s", d.action, probe.Address, valueOr(d.reason, "-")))
+		time.Sleep(d.delay)
+
+		p.supervisedRestart(fmt.Sprintf("%s is down", probe.Address), func() bool {
+			return p.probes.down[probe.Address]
+		})
+	}()
+}
+
+// probeResults returns a copy of the last probe results. The caller must
+// hold p.mu.
+func (p *Process) probeResults() []types.PortProbe {
+	if len(p.probes.results) == 0 {
+		return nil
+	}
+	return append([]types.PortProbe(nil), p.probes.results...)
+}
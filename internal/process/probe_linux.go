@@ -0,0 +1,43 @@
+package process
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// tcpListenState is the state of listening sockets in /proc/net/tcp
+const tcpListenState = "0A"
+
+// listenBacklog returns the number of connections waiting to be accepted by
+// the socket listening on port, which the kernel reports as rx_queue
+func listenBacklog(port int) int {
+	queued := 0
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // header
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 5 || fields[3] != tcpListenState {
+				continue
+			}
+			_, localPort, _ := strings.Cut(fields[1], ":")
+			if p, err := strconv.ParseUint(localPort, 16, 16); err != nil || int(p) != port {
+				continue
+			}
+			// A port may be listened on for IPv4 and IPv6
+			_, rx, _ := strings.Cut(fields[4], ":")
+			if n, err := strconv.ParseUint(rx, 16, 32); err == nil {
+				queued += int(n)
+			}
+		}
+		f.Close()
+	}
+	return queued
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package process
+
+// listenBacklog is only known on Linux
+func listenBacklog(port int) int {
+	return 0
+}
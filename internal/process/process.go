@@ -5,101 +5,323 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"os/user"
+	"path/filepath"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/shirou/gopsutil/v3/process"
+	"golang.org/x/sys/unix"
+	"golang.org/x/text/encoding"
 
 	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/events"
 	"github.com/PrismManager/gemstone/internal/logger"
+	"github.com/PrismManager/gemstone/internal/policy"
+	"github.com/PrismManager/gemstone/internal/sandbox"
+	"github.com/PrismManager/gemstone/internal/secrets"
 	"github.com/PrismManager/gemstone/internal/types"
 )
 
 // Process represents a managed process
 type Process struct {
-	mu           sync.RWMutex
-	info         *types.ProcessInfo
-	cmd          *exec.Cmd
-	ctx          context.Context
-	cancel       context.CancelFunc
-	logger       *logger.ProcessLogger
-	statsHistory []types.ProcessStats
-	maxHistory   int
+	mu         sync.RWMutex
+	info       *types.ProcessInfo
+	cmd        *exec.Cmd
+	ctx        context.Context
+	cancel     context.CancelFunc
+	logger     *logger.ProcessLogger
+	events     *events.Bus
+	paused     func() bool
+	shutdown   func() bool
+	throttle   throttleState
+	disk       diskState
+	probes     probeState
+	watchdog   watchdogState
+	binary     binaryState
+	standby    standbyState
+	lastOutput atomic.Int64 // unix nanoseconds
+	// stopReason is why the daemon is stopping the process, reported in
+	// its last exit
+	stopReason types.ExitReason
+	stopDetail string
+	forwards   []net.Listener
+	stats      *statsSeries
+	// persist saves the process definitions, called when state kept across
+	// daemon restarts such as the last exit changes
+	persist      func()
+	restartTimes []time.Time
+	source       sourceState
+	secrets      *secrets.Resolver
+	notify       *notifier
+	scopes       *scopeOptions
+	// admit checks the reservation of the process before a start
+	admit func(*Process) error
+	// restartGroup restarts the restart group of the process after a
+	// crash, false if it is in none that restarts on crashes
+	restartGroup func(*Process) bool
+	// recordRun saves a finished run of a scheduled process; scheduledRun
+	// is set while the current run was started by the schedule
+	recordRun    func(id string, run types.ScheduledRun)
+	scheduledRun bool
+	// queue limits concurrent starts; startSlot is held during startup
+	queue     *startQueue
+	startSlot *startSlot
+	// report is what the current run reported on the notify socket
+	report *types.Report
+	// reportsReady is set once a run reported READY=1, after which a run is
+	// only healthy once it reports it too
+	reportsReady bool
+	// stopDeadline is when a stopping process gets killed, extended on
+	// request of the process
+	stopDeadline time.Time
+	// restartCancel is closed when a pending restart after a crash is
+	// cancelled, ending its wait early
+	restartCancel chan struct{}
+	// closed is set by Close, after which the process isn't started again
+	closed bool
 }
 
+// maxRestartTimes is the number of recent restarts passed to policies
+const maxRestartTimes = 20
+
+// stopTimeout is how long a process gets to exit after SIGTERM before it
+// is killed
+const stopTimeout = 5 * time.Second
+
 // New creates a new process from a start request
 func New(req *types.StartRequest, logDir string) (*Process, error) {
-	id := uuid.New().String()[:8]
+	return newProcess(uuid.New().String()[:8], req, logDir)
+}
 
-	now := time.Now()
-	info := &types.ProcessInfo{
-		ID:          id,
-		Name:        req.Name,
-		Status:      types.StatusStopped,
-		Command:     req.Command,
-		Args:        req.Args,
-		WorkDir:     req.WorkDir,
-		Env:         req.Env,
-		AutoStart:   req.AutoStart,
-		AutoRestart: req.AutoRestart,
-		MaxRestarts: req.MaxRestarts,
-		User:        req.User,
-		Group:       req.Group,
-		CreatedAt:   now,
-	}
-
-	procLogger, err := logger.NewProcessLogger(id, req.Name, logDir)
+func newProcess(id string, req *types.StartRequest, logDir string) (*Process, error) {
+	info := newInfo(id, req)
+
+	procLogger, err := logger.NewProcessLogger(id, req.Name, config.NamespaceLogDir(logDir, info.Namespace))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create logger: %w", err)
 	}
+	procLogger.SetPipe(req.LogPipe)
+
+	p := &Process{
+		info:   info,
+		logger: procLogger,
+		stats:  newStatsSeries(nil),
+	}
+	p.info.NextRun = p.nextRun(time.Now())
+	return p, nil
+}
+
+// newInfo returns the info of a stopped process with a definition
+func newInfo(id string, req *types.StartRequest) *types.ProcessInfo {
+	namespace := req.Namespace
+	if namespace == "" {
+		namespace = config.DefaultNamespace
+	}
 
-	return &Process{
-		info:       info,
-		logger:     procLogger,
-		maxHistory: 1000,
-	}, nil
+	return &types.ProcessInfo{
+		ID:                    id,
+		Name:                  req.Name,
+		Description:           req.Description,
+		Homepage:              req.Homepage,
+		OwnerContact:          req.OwnerContact,
+		Status:                types.StatusStopped,
+		Command:               req.Command,
+		Args:                  req.Args,
+		WorkDir:               req.WorkDir,
+		Stdin:                 req.Stdin,
+		Env:                   req.Env,
+		AutoStart:             req.AutoStart,
+		AutoRestart:           req.AutoRestart,
+		MaxRestarts:           req.MaxRestarts,
+		User:                  req.User,
+		Group:                 req.Group,
+		Timezone:              req.Timezone,
+		Locale:                req.Locale,
+		OutputEncoding:        req.OutputEncoding,
+		Namespace:             namespace,
+		LogPipe:               req.LogPipe,
+		LogQuota:              req.LogQuota,
+		CreatedAt:             time.Now(),
+		RestartPolicy:         req.RestartPolicy,
+		MaxUptime:             req.MaxUptime,
+		Schedule:              req.Schedule,
+		RestartOnBinaryChange: req.RestartOnBinaryChange,
+		WaitFor:               req.WaitFor,
+		SoftLimits:            req.SoftLimits,
+		Reserve:               req.Reserve,
+		OOMScoreAdj:           req.OOMScoreAdj,
+		Capabilities:          req.Capabilities,
+		Seccomp:               req.Seccomp,
+		AppArmorProfile:       req.AppArmorProfile,
+		SELinuxLabel:          req.SELinuxLabel,
+		Network:               req.Network,
+		MonitorPaths:          req.MonitorPaths,
+		DiskAlert:             req.DiskAlert,
+		Ports:                 req.Ports,
+		OutputWatchdog:        req.OutputWatchdog,
+		Standby:               req.Standby,
+		Fetch:                 req.Fetch,
+		Source:                req.Source,
+	}
 }
 
 // FromConfig creates a process from configuration
 func FromConfig(cfg *config.Process, logDir string) (*Process, error) {
 	req := &types.StartRequest{
-		Name:        cfg.Name,
-		Command:     cfg.Command,
-		Args:        cfg.Args,
-		WorkDir:     cfg.WorkDir,
-		Env:         cfg.Env,
-		AutoStart:   cfg.AutoStart,
-		AutoRestart: cfg.AutoRestart,
-		MaxRestarts: cfg.MaxRestarts,
-		User:        cfg.User,
-		Group:       cfg.Group,
-	}
-
-	p, err := New(req, logDir)
+		Name:                  cfg.Name,
+		Description:           cfg.Description,
+		Homepage:              cfg.Homepage,
+		OwnerContact:          cfg.OwnerContact,
+		Command:               cfg.Command,
+		Args:                  cfg.Args,
+		WorkDir:               cfg.WorkDir,
+		Stdin:                 cfg.Stdin,
+		Env:                   cfg.Env,
+		AutoStart:             cfg.AutoStart,
+		AutoRestart:           cfg.AutoRestart,
+		MaxRestarts:           cfg.MaxRestarts,
+		User:                  cfg.User,
+		Group:                 cfg.Group,
+		Timezone:              cfg.Timezone,
+		Locale:                cfg.Locale,
+		OutputEncoding:        cfg.OutputEncoding,
+		Namespace:             cfg.Namespace,
+		LogPipe:               cfg.LogPipe,
+		LogQuota:              cfg.LogQuota,
+		RestartPolicy:         cfg.RestartPolicy,
+		MaxUptime:             cfg.MaxUptime,
+		Schedule:              cfg.Schedule,
+		RestartOnBinaryChange: cfg.RestartOnBinaryChange,
+		OOMScoreAdj:           cfg.OOMScoreAdj,
+		Seccomp:               cfg.Seccomp,
+		AppArmorProfile:       cfg.AppArmorProfile,
+		SELinuxLabel:          cfg.SELinuxLabel,
+		MonitorPaths:          cfg.MonitorPaths,
+		DiskAlert:             cfg.DiskAlert,
+		Ports:                 cfg.Ports,
+	}
+	if cfg.WaitFor != nil {
+		req.WaitFor = &types.WaitFor{TCP: cfg.WaitFor.TCP, Timeout: cfg.WaitFor.Timeout}
+	}
+	if n := cfg.Network; n != nil {
+		req.Network = &types.Network{Mode: n.Mode, Publish: n.Publish}
+	}
+	if c := cfg.Capabilities; c != nil {
+		req.Capabilities = &types.Capabilities{Keep: c.Keep, Drop: c.Drop}
+	}
+	if w := cfg.OutputWatchdog; w != nil {
+		req.OutputWatchdog = &types.OutputWatchdog{Timeout: w.Timeout, Restart: w.Restart}
+	}
+	if sb := cfg.Standby; sb != nil {
+		req.Standby = &types.Standby{Warmup: sb.Warmup}
+	}
+	if f := cfg.Fetch; f != nil {
+		req.Fetch = &types.Fetch{URL: f.URL, SHA256: f.SHA256}
+	}
+	if s := cfg.Source; s != nil {
+		req.Source = &types.Source{Git: s.Git, Ref: s.Ref}
+	}
+	if s := cfg.SoftLimits; s != nil {
+		req.SoftLimits = &types.SoftLimits{
+			CPUPercent:  s.CPUPercent,
+			CPUAction:   s.CPUAction,
+			CPUThrottle: s.CPUThrottle,
+			CPUWeight:   s.CPUWeight,
+			ThrottleFor: s.ThrottleFor,
+			MemoryHigh:  s.MemoryHigh,
+		}
+	}
+	if r := cfg.Reserve; r != nil {
+		req.Reserve = &types.Reservation{CPU: r.CPU, Memory: r.Memory}
+	}
+
+	// Keep the persisted ID so the process keeps using its log directory
+	id := cfg.ID
+	if id == "" {
+		id = uuid.New().String()[:8]
+	}
+
+	p, err := newProcess(id, req, logDir)
 	if err != nil {
 		return nil, err
 	}
-
-	if cfg.ID != "" {
-		p.info.ID = cfg.ID
+	p.info.Generation = cfg.Generation
+	p.info.StoppedAt = cfg.StoppedAt
+	if cfg.CrashLoopedAt != nil {
+		p.info.Status = types.StatusCrashLooped
+		p.info.CrashLoopedAt = cfg.CrashLoopedAt
+	}
+	if b := cfg.Binary; b != nil {
+		p.info.Binary = &types.Binary{Path: b.Path, SHA256: b.SHA256, ModTime: b.ModTime}
+	}
+	if e := cfg.LastExit; e != nil {
+		p.info.LastExit = &types.LastExit{
+			Code:   e.Code,
+			Signal: e.Signal,
+			Reason: types.ExitReason(e.Reason),
+			Detail: e.Detail,
+			Time:   e.Time,
+		}
 	}
 
 	return p, nil
 }
 
-// Start starts the process
+// Start starts the process. With a readiness gate the process stays in the
+// starting state until its dependency is ready.
 func (p *Process) Start() error {
+	// Secrets are resolved without holding the lock so a slow store doesn't
+	// block readers. Gated processes resolve them once the gate passes.
+	p.mu.RLock()
+	gated := p.info.WaitFor != nil
+	queued := p.queue.limits(p.info.Namespace)
+	status := p.info.Status
+	p.mu.RUnlock()
+
+	// A process restarting after a crash keeps its reservation
+	if p.admit != nil && (status == types.StatusStopped || status == types.StatusErrored || status == types.StatusCrashLooped) {
+		if err := p.admit(p); err != nil {
+			p.logger.Log("stderr", fmt.Sprintf("Not starting: %v", err))
+			return err
+		}
+	}
+
+	var env []string
+	var envErr error
+	if !gated {
+		env, envErr = p.environ(context.Background())
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if p.info.Status == types.StatusRunning {
+	switch p.info.Status {
+	case types.StatusRunning:
 		return fmt.Errorf("process %s is already running", p.info.Name)
+	case types.StatusStarting:
+		return fmt.Errorf("process %s is already starting", p.info.Name)
+	case types.StatusQueued:
+		return fmt.Errorf("process %s is already queued to start", p.info.Name)
+	}
+	if p.shutdown != nil && p.shutdown() {
+		return fmt.Errorf("not starting process %s, the daemon is shutting down", p.info.Name)
+	}
+	if p.closed {
+		return fmt.Errorf("process %s was removed", p.info.Name)
+	}
+
+	if envErr != nil {
+		p.info.Status = types.StatusErrored
+		p.logger.Log("stderr", fmt.Sprintf("Not starting: %v", envErr))
+		p.publishErrored(envErr)
+		return envErr
 	}
 
 	p.info.Status = types.StatusStarting
@@ -108,62 +330,239 @@ func (p *Process) Start() error {
 	p.ctx = ctx
 	p.cancel = cancel
 
-	cmd := exec.CommandContext(ctx, p.info.Command, p.info.Args...)
+	if gated {
+		go p.waitAndLaunch(ctx, p.info.WaitFor)
+		return nil
+	}
+	if queued {
+		slot, ok := p.queue.tryAcquire(p.info.Namespace)
+		if !ok {
+			p.info.Status = types.StatusQueued
+			go p.waitAndLaunch(ctx, nil)
+			return nil
+		}
+		if err := p.launch(ctx, env); err != nil {
+			slot.release()
+			return err
+		}
+		p.holdStartSlot(slot)
+		return nil
+	}
+
+	return p.launch(ctx, env)
+}
+
+// waitAndLaunch launches the process once its readiness gate passes and it
+// got a slot in the start queue. The slot is held until the process reports
+// ready, exits or the hold time passes.
+func (p *Process) waitAndLaunch(ctx context.Context, waitFor *types.WaitFor) {
+	var err error
+	if waitFor != nil {
+		err = waitForReady(ctx, *waitFor)
+	}
 
-	if p.info.WorkDir != "" {
-		cmd.Dir = p.info.WorkDir
+	p.mu.Lock()
+	namespace := p.info.Namespace
+	if err == nil && p.queue.limits(namespace) && p.info.Status == types.StatusStarting {
+		p.info.Status = types.StatusQueued
 	}
+	p.mu.Unlock()
 
-	cmd.Env = os.Environ()
-	for k, v := range p.info.Env {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	var slot *startSlot
+	if err == nil && p.queue.limits(namespace) {
+		slot, err = p.queue.acquire(ctx, namespace)
+	}
+	var env []string
+	if err == nil {
+		env, err = p.environ(ctx)
 	}
 
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Stopped while waiting
+	if ctx.Err() != nil || (p.info.Status != types.StatusStarting && p.info.Status != types.StatusQueued) {
+		slot.release()
+		return
+	}
+
+	if err != nil {
+		slot.release()
+		p.info.Status = types.StatusErrored
+		p.logger.Log("stderr", fmt.Sprintf("Not starting: %v", err))
+		p.publishErrored(err)
+		return
+	}
+
+	p.info.Status = types.StatusStarting
+	if err := p.launch(ctx, env); err != nil {
+		slot.release()
+		p.logger.Log("stderr", fmt.Sprintf("Failed to start: %v", err))
+		return
+	}
+	if slot != nil {
+		p.holdStartSlot(slot)
+	}
+}
+
+// environ returns the variables of the definition with secret references
+// resolved
+func (p *Process) environ(ctx context.Context) ([]string, error) {
+	p.mu.RLock()
+	vars := p.info.Env
+	p.mu.RUnlock()
+
+	if p.secrets != nil {
+		resolved, err := p.secrets.ResolveEnv(ctx, vars)
+		if err != nil {
+			return nil, err
+		}
+		vars = resolved
+	}
+
+	env := make([]string, 0, len(vars))
+	for k, v := range vars {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+	return env, nil
+}
+
+// managedEnv returns the GEMSTONE_* variables describing the process to
+// itself, for the run about to be started. GEMSTONE_SOCKET points the gem
+// CLI run by the process at this daemon. The caller must hold p.mu.
+func (p *Process) managedEnv() []string {
+	socket := config.GetSocketPath()
+	if !config.IsAbstractSocket(socket) {
+		if abs, err := filepath.Abs(socket); err == nil {
+			socket = abs
+		}
+	}
+	env := []string{
+		"GEMSTONE_ID=" + p.info.ID,
+		"GEMSTONE_NAME=" + p.info.Name,
+		"GEMSTONE_NAMESPACE=" + p.info.Namespace,
+		// Processes run a single instance. Copies made with instances in
+		// apply documents set their index in their env.
+		"GEMSTONE_INSTANCE=0",
+		"GEMSTONE_GENERATION=" + strconv.Itoa(p.info.Generation+1),
+		"GEMSTONE_SOCKET=" + socket,
+	}
+	if notify := p.notify.socket(); notify != "" {
+		env = append(env, "NOTIFY_SOCKET="+notify)
+	}
+	return env
+}
+
+// launch starts the command as the run of the process. The caller must hold
+// p.mu.
+func (p *Process) launch(ctx context.Context, env []string) error {
+	cmd, stdout, stderr, err := p.spawn(ctx, env)
+	if err != nil {
+		p.info.Status = types.StatusErrored
+		p.publishErrored(err)
+		return err
+	}
+	p.adopt(cmd)
+
+	enc := p.captureEncoding()
+	go p.captureOutput(stdout, "stdout", enc)
+	go p.captureOutput(stderr, "stderr", enc)
+	go p.waitForExit(cmd)
+
+	return nil
+}
+
+// spawn starts the command with the daemon's environment, the identity of
+// the run user, the timezone and locale, the managed variables and env,
+// later ones taking precedence. The caller must hold p.mu.
+func (p *Process) spawn(ctx context.Context, env []string) (cmd *exec.Cmd, stdout, stderr io.ReadCloser, err error) {
+	cmd = exec.CommandContext(ctx, p.info.Command, p.info.Args...)
+	// Stop signals the process group and kills it after the stop deadline,
+	// cancelling the context must not kill the main process right away
+	cmd.Cancel = func() error { return os.ErrProcessDone }
+
+	if dir := p.workDir(); dir != "" {
+		cmd.Dir = dir
+	}
+
+	base := os.Environ()
 	if p.info.User != "" {
-		cred, err := getUserCredentials(p.info.User, p.info.Group)
+		cred, u, err := getUserCredentials(p.info.User, p.info.Group)
 		if err != nil {
-			p.info.Status = types.StatusErrored
-			return fmt.Errorf("failed to get user credentials: %w", err)
+			return nil, nil, nil, fmt.Errorf("failed to get user credentials: %w", err)
 		}
 		cmd.SysProcAttr = &syscall.SysProcAttr{
 			Credential: cred,
 			Setpgid:    true,
 		}
+		base = append(base, userEnv(u)...)
 	} else {
 		cmd.SysProcAttr = &syscall.SysProcAttr{
 			Setpgid: true,
 		}
 	}
+	if p.info.Timezone != "" {
+		base = append(base, "TZ="+p.info.Timezone)
+	}
+	if p.info.Locale != "" {
+		base = append(base, "LANG="+p.info.Locale)
+	}
+	cmd.Env = append(append(base, p.managedEnv()...), env...)
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		p.info.Status = types.StatusErrored
-		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	if err := p.sandbox(cmd); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to set up sandbox: %w", err)
 	}
 
-	stderr, err := cmd.StderrPipe()
+	stdin, err := p.openStdin(cmd.SysProcAttr.Credential)
 	if err != nil {
-		p.info.Status = types.StatusErrored
-		return fmt.Errorf("failed to create stderr pipe: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to open stdin: %w", err)
+	}
+	if stdin != nil {
+		// The process gets its own copy of the descriptor
+		defer stdin.Close()
+		cmd.Stdin = stdin
+	}
+
+	if stdout, err = cmd.StdoutPipe(); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	if stderr, err = cmd.StderrPipe(); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
 
 	if err := cmd.Start(); err != nil {
-		p.info.Status = types.StatusErrored
-		return fmt.Errorf("failed to start process: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to start process: %w", err)
 	}
+	return cmd, stdout, stderr, nil
+}
 
+// adopt makes a started command the run of the process. The caller must
+// hold p.mu.
+func (p *Process) adopt(cmd *exec.Cmd) {
 	p.cmd = cmd
 	p.info.PID = cmd.Process.Pid
 	p.info.Status = types.StatusRunning
+	p.info.Generation++
 	now := time.Now()
 	p.info.StartedAt = &now
 	p.info.StoppedAt = nil
-
-	go p.captureOutput(stdout, "stdout")
-	go p.captureOutput(stderr, "stderr")
-	go p.waitForExit()
-
-	return nil
+	p.info.CrashLoopedAt = nil
+	p.probes = probeState{}
+	p.report = nil
+	p.stopReason, p.stopDetail = "", ""
+
+	p.info.SecurityContext = sandbox.SecurityContext(p.info.PID)
+
+	p.logger.StartRun(p.info.Generation, p.info.PID)
+	p.recordBinary(cmd.Path)
+	p.joinScope()
+	p.setupCgroup()
+	p.applyOOMScoreAdj()
+	p.startForwards()
+	p.publish(types.EventStart, fmt.Sprintf("Process started with PID %d", p.info.PID), map[string]interface{}{
+		"pid":        p.info.PID,
+		"generation": p.info.Generation,
+	})
 }
 
 // Stop stops the process
@@ -171,25 +570,60 @@ func (p *Process) Stop() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	// Cancel waiting for a readiness gate or a start slot
+	if p.info.Status == types.StatusStarting || p.info.Status == types.StatusQueued {
+		p.cancel()
+		p.dropStandby()
+		p.info.Status = types.StatusStopped
+		return nil
+	}
+
+	// Cancel a pending restart after a crash
+	if p.info.Status == types.StatusRestarting {
+		if p.restartCancel != nil {
+			close(p.restartCancel)
+			p.restartCancel = nil
+		}
+		p.dropStandby()
+		p.removeCgroup()
+		p.info.Status = types.StatusStopped
+		return nil
+	}
+
 	if p.info.Status != types.StatusRunning {
 		return fmt.Errorf("process %s is not running", p.info.Name)
 	}
 
 	p.info.Status = types.StatusStopping
+	if p.stopReason == "" {
+		p.stopReason = types.ExitKilledByUser
+	}
 
 	if p.cancel != nil {
 		p.cancel()
 	}
+	p.dropStandby()
 
 	if p.cmd != nil && p.cmd.Process != nil {
 		_ = syscall.Kill(-p.cmd.Process.Pid, syscall.SIGTERM)
 
+		// The process may push the deadline out with EXTEND_TIMEOUT_USEC
+		p.stopDeadline = time.Now().Add(stopTimeout)
 		go func() {
-			time.Sleep(5 * time.Second)
-			p.mu.Lock()
-			defer p.mu.Unlock()
-			if p.info.Status == types.StatusStopping {
-				_ = syscall.Kill(-p.cmd.Process.Pid, syscall.SIGKILL)
+			wait := stopTimeout
+			for {
+				time.Sleep(wait)
+				p.mu.Lock()
+				if p.info.Status != types.StatusStopping {
+					p.mu.Unlock()
+					return
+				}
+				if wait = time.Until(p.stopDeadline); wait <= 0 {
+					_ = syscall.Kill(-p.cmd.Process.Pid, syscall.SIGKILL)
+					p.mu.Unlock()
+					return
+				}
+				p.mu.Unlock()
 			}
 		}()
 	}
@@ -199,16 +633,26 @@ func (p *Process) Stop() error {
 
 // Restart restarts the process
 func (p *Process) Restart() error {
-	if p.info.Status == types.StatusRunning {
+	p.mu.RLock()
+	status := p.info.Status
+	p.mu.RUnlock()
+
+	// Restart right away instead of after the pending restart's delay
+	if status == types.StatusRestarting {
+		_ = p.Stop()
+	}
+	if status == types.StatusRunning {
 		if err := p.Stop(); err != nil {
 			return err
 		}
-		for i := 0; i < 10; i++ {
+		// Wait past the stop deadline, which the process may extend, for
+		// the kill to take effect
+		for {
 			time.Sleep(500 * time.Millisecond)
 			p.mu.RLock()
-			status := p.info.Status
+			status, deadline := p.info.Status, p.stopDeadline
 			p.mu.RUnlock()
-			if status == types.StatusStopped {
+			if status == types.StatusStopped || time.Now().After(deadline.Add(stopTimeout)) {
 				break
 			}
 		}
@@ -216,133 +660,282 @@ func (p *Process) Restart() error {
 	return p.Start()
 }
 
-// Info returns process information
+// Info returns process information. CPU and memory usage come from the
+// last stats sample, see FreshInfo.
 func (p *Process) Info() *types.ProcessInfo {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
 	info := *p.info
+	info.Throttled = p.throttle.active
+	info.DiskUsage = p.diskUsage()
+	info.Probes = p.probeResults()
+	if cmd := p.standby.cmd; cmd != nil {
+		info.StandbyPID = cmd.Process.Pid
+		info.StandbyReady = p.standby.ready
+	}
+	if info.Status == types.StatusRunning || info.Status == types.StatusStopping {
+		info.Report = p.report
+	}
+	if t := p.lastOutputTime(); !t.IsZero() {
+		info.LastOutput = &t
+	}
 
 	if info.Status == types.StatusRunning && info.StartedAt != nil {
 		info.Uptime = int64(time.Since(*info.StartedAt).Seconds())
 	}
 
 	if info.PID > 0 {
-		if proc, err := process.NewProcess(int32(info.PID)); err == nil {
-			if cpu, err := proc.CPUPercent(); err == nil {
-				info.CPU = cpu
-			}
-			if mem, err := proc.MemoryInfo(); err == nil && mem != nil {
-				info.Memory = mem.RSS
-			}
-			if memPercent, err := proc.MemoryPercent(); err == nil {
-				info.MemoryPercent = float64(memPercent)
-			}
+		if sample, ok := p.stats.last(); ok && sample.PID == info.PID {
+			info.CPU = sample.CPU
+			info.Memory = sample.Memory
+			info.MemoryPercent = sample.MemoryPercent
+			info.SampledAt = &sample.Timestamp
 		}
 	}
 
 	return &info
 }
 
+// FreshInfo returns process information with CPU and memory usage sampled
+// now. The process isn't locked while sampling.
+func (p *Process) FreshInfo() *types.ProcessInfo {
+	info := p.Info()
+	if stats := p.Stats(); stats != nil && stats.PID == info.PID {
+		info.CPU = stats.CPU
+		info.Memory = stats.Memory
+		info.MemoryPercent = stats.MemoryPercent
+		info.SampledAt = &stats.Timestamp
+	}
+	return info
+}
+
 // Stats returns current process stats
 func (p *Process) Stats() *types.ProcessStats {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
+	return sampleStats([]*Process{p})[0]
+}
 
-	if p.info.PID <= 0 || p.info.Status != types.StatusRunning {
-		return nil
-	}
+// recordStats stores a sample for historical data. It returns the CPU
+// seconds and memory byte-hours used since the previous sample of the run.
+func (p *Process) recordStats(stats *types.ProcessStats) (cpuSeconds, memoryByteHours float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	stats := &types.ProcessStats{
-		ID:        p.info.ID,
-		PID:       p.info.PID,
-		Timestamp: time.Now(),
+	// The first sample of a run accounts for the time since it started
+	since, cpuBefore := stats.Timestamp, 0.0
+	if p.info.StartedAt != nil {
+		since = *p.info.StartedAt
 	}
-
-	proc, err := process.NewProcess(int32(p.info.PID))
-	if err != nil {
-		return stats
+	if prev, ok := p.stats.last(); ok && prev.PID == stats.PID && !prev.Timestamp.Before(since) {
+		since, cpuBefore = prev.Timestamp, prev.CPUTime
 	}
+	cpuSeconds = max(stats.CPUTime-cpuBefore, 0)
+	memoryByteHours = float64(stats.Memory) * max(stats.Timestamp.Sub(since).Hours(), 0)
 
-	if cpu, err := proc.CPUPercent(); err == nil {
-		stats.CPU = cpu
-	}
-	if mem, err := proc.MemoryInfo(); err == nil && mem != nil {
-		stats.Memory = mem.RSS
-	}
-	if memPercent, err := proc.MemoryPercent(); err == nil {
-		stats.MemoryPercent = float64(memPercent)
-	}
-	if threads, err := proc.NumThreads(); err == nil {
-		stats.NumThreads = threads
-	}
-	if fds, err := proc.NumFDs(); err == nil {
-		stats.NumFDs = fds
-	}
-	if ioCounters, err := proc.IOCounters(); err == nil && ioCounters != nil {
-		stats.ReadBytes = ioCounters.ReadBytes
-		stats.WriteBytes = ioCounters.WriteBytes
-	}
+	p.stats.add(*stats)
+	return cpuSeconds, memoryByteHours
+}
 
-	return stats
+// GetStatsHistory returns the stats history from since on, the last limit
+// samples of it if limit is positive. Older samples are downsampled.
+func (p *Process) GetStatsHistory(since time.Time, limit int) []types.ProcessStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.stats.since(since, limit)
 }
 
-// CollectStats collects and stores stats for historical data
-func (p *Process) CollectStats() {
-	stats := p.Stats()
-	if stats == nil {
-		return
+// EachStatsSample calls fn for each of the samples GetStatsHistory returns.
+// They are copied in chunks, so the history isn't duplicated in memory and
+// the lock isn't held while fn runs.
+func (p *Process) EachStatsSample(since time.Time, limit int, fn func(types.ProcessStats) error) error {
+	p.mu.RLock()
+	from, ok := p.stats.start(since, limit)
+	p.mu.RUnlock()
+
+	sent := 0
+	for ok {
+		p.mu.RLock()
+		chunk := p.stats.chunk(from, statsChunkSize)
+		p.mu.RUnlock()
+
+		for _, sample := range chunk {
+			if limit > 0 && sent == limit {
+				return nil
+			}
+			if err := fn(sample); err != nil {
+				return err
+			}
+			sent++
+		}
+		if len(chunk) < statsChunkSize {
+			return nil
+		}
+		from = chunk[len(chunk)-1].Timestamp.Add(time.Nanosecond)
 	}
+	return nil
+}
 
-	p.mu.Lock()
-	defer p.mu.Unlock()
+// StreamLogs calls fn for each of the lines GetLogs returns
+func (p *Process) StreamLogs(lines int, logType string, run int, filter *logger.Filter, fn func(string) error) error {
+	return p.logger.StreamLogs(lines, logType, run, filter, fn)
+}
 
-	p.statsHistory = append(p.statsHistory, *stats)
+// StreamLogsAfter calls fn for each line numbered above after, including
+// the lines of rotated files
+func (p *Process) StreamLogsAfter(logType string, after uint64, filter *logger.Filter, fn func(string) error) error {
+	return p.logger.StreamAfter(logType, after, filter, fn)
+}
 
-	if len(p.statsHistory) > p.maxHistory {
-		p.statsHistory = p.statsHistory[len(p.statsHistory)-p.maxHistory:]
-	}
+// SubscribeLogs returns a stream of the lines captured from now on
+func (p *Process) SubscribeLogs(logType string) (*logger.Stream, func()) {
+	return p.logger.Subscribe(logType)
+}
+
+// GetLogs returns recent log entries, optionally limited to a single run
+// and to lines passing a filter
+func (p *Process) GetLogs(lines int, logType string, run int, filter *logger.Filter) ([]string, error) {
+	return p.logger.GetLogs(lines, logType, run, filter)
 }
 
-// GetStatsHistory returns historical stats
-func (p *Process) GetStatsHistory(limit int) []types.ProcessStats {
+// ToConfig converts process to configuration format
+func (p *Process) ToConfig() *config.Process {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	if limit <= 0 || limit > len(p.statsHistory) {
-		result := make([]types.ProcessStats, len(p.statsHistory))
-		copy(result, p.statsHistory)
-		return result
+	cfg := &config.Process{
+		ID:                    p.info.ID,
+		Name:                  p.info.Name,
+		Description:           p.info.Description,
+		Homepage:              p.info.Homepage,
+		OwnerContact:          p.info.OwnerContact,
+		Command:               p.info.Command,
+		Args:                  p.info.Args,
+		WorkDir:               p.info.WorkDir,
+		Stdin:                 p.info.Stdin,
+		Env:                   p.info.Env,
+		AutoStart:             p.info.AutoStart,
+		AutoRestart:           p.info.AutoRestart,
+		MaxRestarts:           p.info.MaxRestarts,
+		User:                  p.info.User,
+		Group:                 p.info.Group,
+		Timezone:              p.info.Timezone,
+		Locale:                p.info.Locale,
+		OutputEncoding:        p.info.OutputEncoding,
+		Namespace:             p.info.Namespace,
+		LogPipe:               p.info.LogPipe,
+		LogQuota:              p.info.LogQuota,
+		RestartPolicy:         p.info.RestartPolicy,
+		MaxUptime:             p.info.MaxUptime,
+		Schedule:              p.info.Schedule,
+		RestartOnBinaryChange: p.info.RestartOnBinaryChange,
+		OOMScoreAdj:           p.info.OOMScoreAdj,
+		Seccomp:               p.info.Seccomp,
+		AppArmorProfile:       p.info.AppArmorProfile,
+		SELinuxLabel:          p.info.SELinuxLabel,
+		MonitorPaths:          p.info.MonitorPaths,
+		DiskAlert:             p.info.DiskAlert,
+		Ports:                 p.info.Ports,
+		Generation:            p.info.Generation,
+		StoppedAt:             p.info.StoppedAt,
+		CrashLoopedAt:         p.info.CrashLoopedAt,
+	}
+	if n := p.info.Network; n != nil {
+		cfg.Network = &config.NetworkConfig{Mode: n.Mode, Publish: n.Publish}
+	}
+	if c := p.info.Capabilities; c != nil {
+		cfg.Capabilities = &config.CapabilitiesConfig{Keep: c.Keep, Drop: c.Drop}
+	}
+	if p.info.WaitFor != nil {
+		cfg.WaitFor = &config.WaitForConfig{TCP: p.info.WaitFor.TCP, Timeout: p.info.WaitFor.Timeout}
+	}
+	if w := p.info.OutputWatchdog; w != nil {
+		cfg.OutputWatchdog = &config.OutputWatchdogConfig{Timeout: w.Timeout, Restart: w.Restart}
+	}
+	if sb := p.info.Standby; sb != nil {
+		cfg.Standby = &config.StandbyConfig{Warmup: sb.Warmup}
+	}
+	if f := p.info.Fetch; f != nil {
+		cfg.Fetch = &config.FetchConfig{URL: f.URL, SHA256: f.SHA256}
+	}
+	if s := p.info.Source; s != nil {
+		cfg.Source = &config.SourceConfig{Git: s.Git, Ref: s.Ref}
+	}
+	if s := p.info.SoftLimits; s != nil {
+		cfg.SoftLimits = &config.SoftLimitsConfig{
+			CPUPercent:  s.CPUPercent,
+			CPUAction:   s.CPUAction,
+			CPUThrottle: s.CPUThrottle,
+			CPUWeight:   s.CPUWeight,
+			ThrottleFor: s.ThrottleFor,
+			MemoryHigh:  s.MemoryHigh,
+		}
+	}
+	if r := p.info.Reserve; r != nil {
+		cfg.Reserve = &config.ReservationConfig{CPU: r.CPU, Memory: r.Memory}
+	}
+	if b := p.info.Binary; b != nil {
+		cfg.Binary = &config.BinaryConfig{Path: b.Path, SHA256: b.SHA256, ModTime: b.ModTime}
+	}
+	if e := p.info.LastExit; e != nil {
+		cfg.LastExit = &config.LastExitConfig{
+			Code:   e.Code,
+			Signal: e.Signal,
+			Reason: string(e.Reason),
+			Detail: e.Detail,
+			Time:   e.Time,
+		}
 	}
 
-	start := len(p.statsHistory) - limit
-	result := make([]types.ProcessStats, limit)
-	copy(result, p.statsHistory[start:])
-	return result
-}
-
-// GetLogs returns recent log entries
-func (p *Process) GetLogs(lines int, logType string) ([]string, error) {
-	return p.logger.GetLogs(lines, logType)
+	return cfg
 }
 
-// ToConfig converts process to configuration format
-func (p *Process) ToConfig() *config.Process {
+// Definition returns the definition of the process as a start request
+func (p *Process) Definition() types.StartRequest {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	return &config.Process{
-		ID:          p.info.ID,
-		Name:        p.info.Name,
-		Command:     p.info.Command,
-		Args:        p.info.Args,
-		WorkDir:     p.info.WorkDir,
-		Env:         p.info.Env,
-		AutoStart:   p.info.AutoStart,
-		AutoRestart: p.info.AutoRestart,
-		MaxRestarts: p.info.MaxRestarts,
-		User:        p.info.User,
-		Group:       p.info.Group,
+	return types.StartRequest{
+		Name:                  p.info.Name,
+		Description:           p.info.Description,
+		Homepage:              p.info.Homepage,
+		OwnerContact:          p.info.OwnerContact,
+		Command:               p.info.Command,
+		Args:                  p.info.Args,
+		WorkDir:               p.info.WorkDir,
+		Stdin:                 p.info.Stdin,
+		Env:                   p.info.Env,
+		AutoStart:             p.info.AutoStart,
+		AutoRestart:           p.info.AutoRestart,
+		MaxRestarts:           p.info.MaxRestarts,
+		User:                  p.info.User,
+		Group:                 p.info.Group,
+		Timezone:              p.info.Timezone,
+		Locale:                p.info.Locale,
+		OutputEncoding:        p.info.OutputEncoding,
+		Namespace:             p.info.Namespace,
+		LogPipe:               p.info.LogPipe,
+		LogQuota:              p.info.LogQuota,
+		RestartPolicy:         p.info.RestartPolicy,
+		MaxUptime:             p.info.MaxUptime,
+		Schedule:              p.info.Schedule,
+		RestartOnBinaryChange: p.info.RestartOnBinaryChange,
+		WaitFor:               p.info.WaitFor,
+		SoftLimits:            p.info.SoftLimits,
+		Reserve:               p.info.Reserve,
+		OOMScoreAdj:           p.info.OOMScoreAdj,
+		Capabilities:          p.info.Capabilities,
+		Seccomp:               p.info.Seccomp,
+		AppArmorProfile:       p.info.AppArmorProfile,
+		SELinuxLabel:          p.info.SELinuxLabel,
+		Network:               p.info.Network,
+		MonitorPaths:          p.info.MonitorPaths,
+		DiskAlert:             p.info.DiskAlert,
+		Ports:                 p.info.Ports,
+		OutputWatchdog:        p.info.OutputWatchdog,
+		Standby:               p.info.Standby,
+		Fetch:                 p.info.Fetch,
+		Source:                p.info.Source,
 	}
 }
 
@@ -367,88 +960,347 @@ func (p *Process) Status() types.ProcessStatus {
 	return p.info.Status
 }
 
-// ShouldAutoStart returns whether the process should auto-start
+// Namespace returns the namespace of the process
+func (p *Process) Namespace() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.info.Namespace
+}
+
+// LogQuota returns the per-process log quota in MB (0 means no quota)
+func (p *Process) LogQuota() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.info.LogQuota
+}
+
+// ShouldAutoStart returns whether the process should auto-start. Processes
+// with a schedule are started by it instead.
 func (p *Process) ShouldAutoStart() bool {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	return p.info.AutoStart
+	return p.info.AutoStart && p.info.Schedule == ""
 }
 
-func (p *Process) captureOutput(reader io.Reader, outputType string) {
+// SetAutoStart sets whether the process starts with the daemon
+func (p *Process) SetAutoStart(autoStart bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.info.AutoStart = autoStart
+}
+
+// SetMetadata sets the description, homepage and owner contact of the
+// process
+func (p *Process) SetMetadata(req *types.StartRequest) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.info.Description = req.Description
+	p.info.Homepage = req.Homepage
+	p.info.OwnerContact = req.OwnerContact
+}
+
+// captureOutput logs the lines of an output as valid UTF-8, transcoded
+// from enc unless it is nil
+func (p *Process) captureOutput(reader io.Reader, outputType string, enc encoding.Encoding) {
+	var dec *encoding.Decoder
+	if enc != nil {
+		dec = enc.NewDecoder()
+	}
 	scanner := bufio.NewScanner(reader)
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := sanitizeOutput(scanner.Bytes(), dec)
+		p.recordOutput()
 		p.logger.Log(outputType, line)
 	}
 }
 
-func (p *Process) waitForExit() {
-	if p.cmd == nil {
+// waitForExit waits for a run of the process to exit and decides whether it
+// restarts
+func (p *Process) waitForExit(cmd *exec.Cmd) {
+	err := cmd.Wait()
+
+	p.mu.Lock()
+	// Standbys and runs replaced by them aren't supervised
+	if cmd != p.cmd {
+		p.retiredExited(cmd)
+		p.mu.Unlock()
 		return
 	}
 
-	err := p.cmd.Wait()
-
-	p.mu.Lock()
+	p.releaseStartSlot()
 	now := time.Now()
 	p.info.StoppedAt = &now
+	pid := p.info.PID
 	p.info.PID = 0
+	p.info.SecurityContext = ""
+	p.info.Unit = ""
+	p.stopForwards()
 
-	shouldRestart := p.info.AutoRestart && p.info.Status == types.StatusRunning
+	// The process exited on its own if nobody asked it to stop
+	crashed := p.info.Status == types.StatusRunning
+	shouldRestart := false
 
 	if err != nil {
 		p.logger.Log("stderr", fmt.Sprintf("Process exited with error: %v", err))
 	}
 
-	if shouldRestart && p.info.RestartCount < p.info.MaxRestarts {
+	p.info.LastExit = p.lastExit(crashed, now)
+	exitData := map[string]interface{}{
+		"pid":        pid,
+		"generation": p.info.Generation,
+		"exit_code":  p.cmd.ProcessState.ExitCode(),
+		"reason":     p.info.LastExit.Reason,
+	}
+	if crashed {
+		p.publish(types.EventCrash, fmt.Sprintf("Process exited unexpectedly: %s", p.cmd.ProcessState), exitData)
+	} else {
+		p.publish(types.EventStop, "Process stopped", exitData)
+	}
+
+	// A scheduled run ends with its exit, a failed one is retried by the
+	// next run of the schedule
+	scheduled := p.info.Schedule != ""
+	if scheduled {
+		// Written to disk once p.mu is released
+		if run := p.finishRun(now); p.recordRun != nil {
+			defer p.recordRun(p.info.ID, run)
+		}
+	}
+
+	if crashed && p.paused != nil && p.paused() {
+		p.logger.Log("stderr", "Supervision is paused, not restarting")
+		p.info.Status = types.StatusStopped
+		p.mu.Unlock()
+		p.saveState()
+		return
+	}
+
+	delay := defaultRestartDelay
+	if crashed && !scheduled {
+		decision := p.decideRestart(p.cmd.ProcessState.ExitCode())
+		if decision.err != nil {
+			p.logger.Log("stderr", fmt.Sprintf("Restart policy failed, using built-in rules: %v", decision.err))
+		}
+		if decision.reason != "" {
+			p.logger.Log("stderr", fmt.Sprintf("Restart policy decided to %s: %s", decision.action, decision.reason))
+		}
+		// The process may have been stopped while a policy ran
+		shouldRestart = decision.restart && p.info.Status == types.StatusRunning
+		delay = decision.delay
+	}
+	if shouldRestart && p.shutdown != nil && p.shutdown() {
+		p.logger.Log("stderr", "The daemon is shutting down, not restarting")
+		shouldRestart = false
+	}
+
+	if shouldRestart {
 		p.info.Status = types.StatusRestarting
 		p.info.RestartCount++
+		p.restartTimes = append(p.restartTimes, time.Now())
+		if len(p.restartTimes) > maxRestartTimes {
+			p.restartTimes = p.restartTimes[len(p.restartTimes)-maxRestartTimes:]
+		}
+		if p.standby.ready {
+			p.failover("the process exited")
+			p.mu.Unlock()
+			p.saveState()
+			return
+		}
+		p.publish(types.EventRestart, fmt.Sprintf("Restarting process in %s (attempt %d)", delay, p.info.RestartCount), map[string]interface{}{
+			"restart_count": p.info.RestartCount,
+			"delay":         delay.Seconds(),
+		})
+		cancelRestart := make(chan struct{})
+		p.restartCancel = cancelRestart
 		p.mu.Unlock()
-
-		time.Sleep(time.Second)
+		p.saveState()
+
+		// Stop, also by the daemon shutting down, cancels the restart
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-cancelRestart:
+			timer.Stop()
+			return
+		}
+		p.mu.Lock()
+		cancelled := p.info.Status != types.StatusRestarting
+		if p.restartCancel == cancelRestart {
+			p.restartCancel = nil
+		}
+		p.mu.Unlock()
+		if cancelled {
+			return
+		}
+		if p.restartGroup != nil && p.restartGroup(p) {
+			return
+		}
 		_ = p.Start()
 		return
 	}
 
-	p.info.Status = types.StatusStopped
+	// Give up loudly once the restart budget is used up
+	if crashed && !scheduled && !shouldRestart && p.info.Status == types.StatusRunning &&
+		p.info.AutoRestart && p.info.RestartCount >= p.info.MaxRestarts {
+		p.enterCrashLoop(now)
+	} else {
+		p.info.Status = types.StatusStopped
+	}
+	p.dropStandby()
+	p.removeCgroup()
 	p.mu.Unlock()
+	p.saveState()
+}
+
+// saveState persists the state of the process that survives daemon
+// restarts
+func (p *Process) saveState() {
+	if p.persist != nil {
+		p.persist()
+	}
+}
+
+// lastExit describes the exit of the process that just ended. The caller
+// must hold p.mu.
+func (p *Process) lastExit(crashed bool, at time.Time) *types.LastExit {
+	state := p.cmd.ProcessState
+	exit := &types.LastExit{
+		Code:   state.ExitCode(),
+		Reason: p.stopReason,
+		Detail: p.stopDetail,
+		Time:   at,
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		exit.Signal = unix.SignalName(status.Signal())
+	}
+
+	switch {
+	case p.oomKilled():
+		exit.Reason, exit.Detail = types.ExitOOM, ""
+	case !crashed:
+		if exit.Reason == "" {
+			exit.Reason = types.ExitKilledByUser
+		}
+	case exit.Code == 0:
+		exit.Reason, exit.Detail = types.ExitCompleted, ""
+	default:
+		exit.Reason, exit.Detail = types.ExitCrashed, ""
+	}
+	return exit
+}
+
+// decideRestart applies the restart rules to an exit. The caller must hold
+// p.mu, which is released while a restart policy runs.
+func (p *Process) decideRestart(exitCode int) restartDecision {
+	in := policy.Input{
+		Trigger:      policy.TriggerExit,
+		Name:         p.info.Name,
+		Namespace:    p.info.Namespace,
+		ExitCode:     exitCode,
+		RestartCount: p.info.RestartCount,
+		MaxRestarts:  p.info.MaxRestarts,
+		Restarts:     append([]time.Time(nil), p.restartTimes...),
+		Now:          time.Now(),
+	}
+	if p.info.StartedAt != nil {
+		in.Uptime = time.Since(*p.info.StartedAt)
+	}
+	autoRestart, path := p.info.AutoRestart, p.info.RestartPolicy
+
+	if path != "" {
+		p.mu.Unlock()
+		defer p.mu.Lock()
+	}
+
+	return decideRestart(autoRestart, path, in)
+}
+
+// publish sends an event about the process to the event bus. The caller
+// must hold p.mu.
+func (p *Process) publish(eventType types.EventType, message string, data map[string]interface{}) {
+	if p.events == nil {
+		return
+	}
+
+	p.events.Publish(types.Event{
+		Type:        eventType,
+		ProcessID:   p.info.ID,
+		ProcessName: p.info.Name,
+		Namespace:   p.info.Namespace,
+		Message:     message,
+		Data:        data,
+	})
+}
+
+// publishErrored publishes that the process couldn't be started. The
+// caller must hold p.mu.
+func (p *Process) publishErrored(err error) {
+	p.publish(types.EventErrored, fmt.Sprintf("Process failed to start: %v", err), map[string]interface{}{
+		"error": err.Error(),
+	})
 }
 
-func getUserCredentials(username, groupname string) (*syscall.Credential, error) {
+func getUserCredentials(username, groupname string) (*syscall.Credential, *user.User, error) {
 	u, err := user.Lookup(username)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	uid, err := strconv.ParseUint(u.Uid, 10, 32)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	gid, err := strconv.ParseUint(u.Gid, 10, 32)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if groupname != "" {
 		g, err := user.LookupGroup(groupname)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		gid, err = strconv.ParseUint(g.Gid, 10, 32)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
 	return &syscall.Credential{
 		Uid: uint32(uid),
 		Gid: uint32(gid),
-	}, nil
+	}, u, nil
 }
 
-// Close closes the process and its resources
+// userEnv returns the variables describing the run user, replacing those
+// of the daemon's user, from the user database
+func userEnv(u *user.User) []string {
+	env := []string{"USER=" + u.Username, "LOGNAME=" + u.Username}
+	if u.HomeDir != "" {
+		env = append(env, "HOME="+u.HomeDir)
+	}
+	return env
+}
+
+// Close closes the process and its resources. A pending restart or a start
+// waiting for its gate or slot is cancelled, so a removed process isn't
+// launched behind the registry's back.
 func (p *Process) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	if p.restartCancel != nil {
+		close(p.restartCancel)
+		p.restartCancel = nil
+	}
+	if (p.info.Status == types.StatusStarting || p.info.Status == types.StatusQueued) && p.cancel != nil {
+		p.cancel()
+	}
+	p.stopForwards()
+	p.dropStandby()
+	p.removeCgroup()
+	p.mu.Unlock()
+
 	if p.logger != nil {
 		return p.logger.Close()
 	}
@@ -0,0 +1,24 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+func TestCloseCancelsPendingRestart(t *testing.T) {
+	p := newTestProcesses(t, 1)[0]
+	cancel := make(chan struct{})
+	p.info.Status = types.StatusRestarting
+	p.restartCancel = cancel
+
+	p.Close()
+	select {
+	case <-cancel:
+	default:
+		t.Fatal("Close left the restart timer armed")
+	}
+	if err := p.Start(); err == nil {
+		t.Fatal("a closed process started")
+	}
+}
@@ -0,0 +1,125 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+)
+
+// DefaultStartHold is how long a process holds its start slot unless it
+// reports ready or exits first
+const DefaultStartHold = 10 * time.Second
+
+// startQueue limits how many processes start at the same time, daemon-wide
+// and per namespace. Each limit is a semaphore holding one token per
+// process in its startup.
+type startQueue struct {
+	global     chan struct{}
+	namespaces map[string]chan struct{}
+	hold       time.Duration
+}
+
+// newStartQueue returns the start queue of the configured limits, or nil if
+// there are none
+func newStartQueue(cfg *config.Config) *startQueue {
+	q := &startQueue{namespaces: make(map[string]chan struct{}), hold: DefaultStartHold}
+	if n := cfg.StartQueue.Concurrency; n > 0 {
+		q.global = make(chan struct{}, n)
+	}
+	for _, ns := range cfg.Namespaces {
+		if ns.StartConcurrency > 0 {
+			q.namespaces[ns.Name] = make(chan struct{}, ns.StartConcurrency)
+		}
+	}
+	if q.global == nil && len(q.namespaces) == 0 {
+		return nil
+	}
+
+	if h := cfg.StartQueue.Hold; h != "" {
+		if d, err := time.ParseDuration(h); err == nil && d > 0 {
+			q.hold = d
+		} else {
+			fmt.Printf("Warning: invalid start_queue.hold %q, using %s\n", h, DefaultStartHold)
+		}
+	}
+	return q
+}
+
+// limits reports whether starts in a namespace are queued
+func (q *startQueue) limits(namespace string) bool {
+	return q != nil && (q.global != nil || q.namespaces[namespace] != nil)
+}
+
+// acquire waits for a start slot in the namespace and daemon-wide, in that
+// order, until ctx is done
+func (q *startQueue) acquire(ctx context.Context, namespace string) (*startSlot, error) {
+	slot := &startSlot{}
+	for _, sem := range []chan struct{}{q.namespaces[namespace], q.global} {
+		if sem == nil {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+			slot.sems = append(slot.sems, sem)
+		case <-ctx.Done():
+			slot.release()
+			return nil, ctx.Err()
+		}
+	}
+	return slot, nil
+}
+
+// tryAcquire takes a start slot in the namespace and daemon-wide if both
+// are free
+func (q *startQueue) tryAcquire(namespace string) (*startSlot, bool) {
+	slot := &startSlot{}
+	for _, sem := range []chan struct{}{q.namespaces[namespace], q.global} {
+		if sem == nil {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+			slot.sems = append(slot.sems, sem)
+		default:
+			slot.release()
+			return nil, false
+		}
+	}
+	return slot, true
+}
+
+// startSlot is the place of a starting process in the start queue
+type startSlot struct {
+	once sync.Once
+	sems []chan struct{}
+}
+
+// release frees the slot for the next queued process. It may be called more
+// than once and on a nil slot.
+func (s *startSlot) release() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		for _, sem := range s.sems {
+			<-sem
+		}
+	})
+}
+
+// holdStartSlot keeps the slot of a launched process for the hold time at
+// most. The caller must hold p.mu.
+func (p *Process) holdStartSlot(slot *startSlot) {
+	p.startSlot = slot
+	time.AfterFunc(p.queue.hold, slot.release)
+}
+
+// releaseStartSlot ends the startup of the process once it reported ready,
+// exited or held its slot long enough. The caller must hold p.mu.
+func (p *Process) releaseStartSlot() {
+	p.startSlot.release()
+	p.startSlot = nil
+}
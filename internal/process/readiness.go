@@ -0,0 +1,59 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// DefaultWaitTimeout is how long a process waits for its readiness gate if
+// no timeout is given
+const DefaultWaitTimeout = 60 * time.Second
+
+// readinessPollInterval is the time between readiness checks
+const readinessPollInterval = 500 * time.Millisecond
+
+// validateWaitFor checks the settings of a readiness gate
+func validateWaitFor(w *types.WaitFor) error {
+	if _, _, err := net.SplitHostPort(w.TCP); err != nil {
+		return fmt.Errorf("tcp must be host:port: %w", err)
+	}
+	if w.Timeout != "" {
+		if d, err := time.ParseDuration(w.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q", w.Timeout)
+		}
+	}
+	return nil
+}
+
+// waitForReady blocks until the TCP address of a readiness gate accepts
+// connections, the timeout passes or ctx is cancelled
+func waitForReady(ctx context.Context, w types.WaitFor) error {
+	timeout := DefaultWaitTimeout
+	if d, err := time.ParseDuration(w.Timeout); err == nil {
+		timeout = d
+	}
+	deadline := time.Now().Add(timeout)
+
+	dialer := net.Dialer{Timeout: time.Second}
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", w.TCP)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s did not accept connections within %s", w.TCP, timeout)
+		}
+
+		select {
+		case <-time.After(readinessPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
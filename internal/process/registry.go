@@ -0,0 +1,142 @@
+package process
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// registryShards is the number of shards of the process registry. Lookups
+// and changes of processes in different shards don't contend.
+const registryShards = 64
+
+// registry holds the managed processes in shards keyed by ID, with an index
+// of their names. It is safe for concurrent use; the caller doesn't need to
+// hold m.mu.
+type registry struct {
+	shards [registryShards]registryShard
+
+	// namesMu also serializes adding, replacing and removing processes so
+	// that names stay unique
+	namesMu sync.RWMutex
+	names   map[string]*Process
+}
+
+type registryShard struct {
+	mu    sync.RWMutex
+	procs map[string]*Process
+}
+
+func newRegistry() *registry {
+	r := &registry{names: make(map[string]*Process)}
+	for i := range r.shards {
+		r.shards[i].procs = make(map[string]*Process)
+	}
+	return r
+}
+
+func (r *registry) shard(id string) *registryShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &r.shards[h.Sum32()%registryShards]
+}
+
+// get returns the process with an ID, or nil
+func (r *registry) get(id string) *Process {
+	s := r.shard(id)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.procs[id]
+}
+
+// byName returns the process with a name, or nil
+func (r *registry) byName(name string) *Process {
+	r.namesMu.RLock()
+	defer r.namesMu.RUnlock()
+	return r.names[name]
+}
+
+// lookup returns a process by ID or, failing that, by name
+func (r *registry) lookup(idOrName string) *Process {
+	if p := r.get(idOrName); p != nil {
+		return p
+	}
+	return r.byName(idOrName)
+}
+
+// add registers a new process. It fails if another process has the same
+// name.
+func (r *registry) add(p *Process) error {
+	r.namesMu.Lock()
+	defer r.namesMu.Unlock()
+
+	if _, ok := r.names[p.Name()]; ok {
+		return fmt.Errorf("process with name %s already exists", p.Name())
+	}
+	r.names[p.Name()] = p
+	r.put(p)
+	return nil
+}
+
+// replace swaps a process for a new one with the same ID, which may have
+// another name. It fails if another process has the new name.
+func (r *registry) replace(old, p *Process) error {
+	r.namesMu.Lock()
+	defer r.namesMu.Unlock()
+
+	if other, ok := r.names[p.Name()]; ok && other != old {
+		return fmt.Errorf("process with name %s already exists", p.Name())
+	}
+	if r.names[old.Name()] == old {
+		delete(r.names, old.Name())
+	}
+	r.names[p.Name()] = p
+	r.put(p)
+	return nil
+}
+
+// remove unregisters a process
+func (r *registry) remove(p *Process) {
+	r.namesMu.Lock()
+	defer r.namesMu.Unlock()
+
+	if r.names[p.Name()] == p {
+		delete(r.names, p.Name())
+	}
+
+	s := r.shard(p.ID())
+	s.mu.Lock()
+	if s.procs[p.ID()] == p {
+		delete(s.procs, p.ID())
+	}
+	s.mu.Unlock()
+}
+
+// put stores a process in its shard. The caller must hold r.namesMu.
+func (r *registry) put(p *Process) {
+	s := r.shard(p.ID())
+	s.mu.Lock()
+	s.procs[p.ID()] = p
+	s.mu.Unlock()
+}
+
+// all returns a snapshot of all processes
+func (r *registry) all() []*Process {
+	procs := make([]*Process, 0, r.len())
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.RLock()
+		for _, p := range s.procs {
+			procs = append(procs, p)
+		}
+		s.mu.RUnlock()
+	}
+	return procs
+}
+
+// len returns the number of processes
+func (r *registry) len() int {
+	r.namesMu.RLock()
+	defer r.namesMu.RUnlock()
+	return len(r.names)
+}
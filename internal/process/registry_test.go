@@ -0,0 +1,90 @@
+package process
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// newTestProcesses returns n stopped processes named proc-0 and so on
+func newTestProcesses(tb testing.TB, n int) []*Process {
+	tb.Helper()
+	logDir := tb.TempDir()
+	procs := make([]*Process, n)
+	for i := range procs {
+		req := &types.StartRequest{Name: fmt.Sprintf("proc-%d", i), Command: "/bin/true"}
+		p, err := newProcess(fmt.Sprintf("%08x", i), req, logDir)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		procs[i] = p
+	}
+	return procs
+}
+
+func newTestRegistry(tb testing.TB, n int) (*registry, []*Process) {
+	tb.Helper()
+	r := newRegistry()
+	procs := newTestProcesses(tb, n)
+	for _, p := range procs {
+		if err := r.add(p); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return r, procs
+}
+
+func BenchmarkRegistryGet(b *testing.B) {
+	r, procs := newTestRegistry(b, 1000)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if r.get(procs[i%len(procs)].info.ID) == nil {
+				b.Fatal("process not found")
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkRegistryLookupByName(b *testing.B) {
+	r, procs := newTestRegistry(b, 1000)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if r.lookup(procs[i%len(procs)].info.Name) == nil {
+				b.Fatal("process not found")
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkRegistryAll(b *testing.B) {
+	for _, n := range []int{100, 1000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			r, _ := newTestRegistry(b, n)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if len(r.all()) != n {
+					b.Fatal("processes missing")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRegistryReplace(b *testing.B) {
+	r, procs := newTestRegistry(b, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := procs[i%len(procs)]
+		if err := r.replace(p, p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package process
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/policy"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// maxSimulatedCrashes bounds the crash sequences that can be simulated
+const maxSimulatedCrashes = 1000
+
+// defaultRestartDelay is how long a crashed process waits to be restarted
+// unless its restart policy decides otherwise
+const defaultRestartDelay = time.Second
+
+// restartDecision is what happens to a process after a crash
+type restartDecision struct {
+	restart bool
+	action  string
+	delay   time.Duration
+	reason  string
+	// err is set when the restart policy failed and the built-in rules
+	// were applied instead
+	err error
+}
+
+// decideRestart runs the restart policy at path, or applies the built-in
+// auto_restart and max_restarts rules without one or when it fails
+func decideRestart(autoRestart bool, path string, in policy.Input) restartDecision {
+	d := restartDecision{
+		restart: autoRestart && in.RestartCount < in.MaxRestarts,
+		delay:   defaultRestartDelay,
+	}
+	d.action = policy.ActionGiveUp
+	if d.restart {
+		d.action = policy.ActionRestart
+	}
+
+	if path == "" {
+		return d
+	}
+
+	decision, err := policy.Evaluate(path, in)
+	if err != nil {
+		d.err = err
+		return d
+	}
+
+	d.restart = decision.Restart()
+	d.action = decision.Action
+	d.reason = decision.Reason
+	if decision.Delay > 0 {
+		d.delay = decision.Delay
+	}
+	return d
+}
+
+// Simulate runs the restart rules of a process against a sequence of
+// crashes, starting from its current restart count, and reports what the
+// daemon would do after each. Nothing is started or stopped.
+func (m *Manager) Simulate(idOrName string, req types.SimulateRequest) (*types.Simulation, error) {
+	if req.Times < 1 || req.Times > maxSimulatedCrashes {
+		return nil, fmt.Errorf("times must be between 1 and %d", maxSimulatedCrashes)
+	}
+	var uptime time.Duration
+	if req.Uptime != "" {
+		d, err := time.ParseDuration(req.Uptime)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid uptime %q", req.Uptime)
+		}
+		uptime = d
+	}
+
+	proc := m.registry.lookup(idOrName)
+	if proc == nil {
+		return nil, fmt.Errorf("process %s not found", idOrName)
+	}
+
+	proc.mu.RLock()
+	in := policy.Input{
+		Trigger:      policy.TriggerExit,
+		Name:         proc.info.Name,
+		Namespace:    proc.info.Namespace,
+		ExitCode:     req.ExitCode,
+		Uptime:       uptime,
+		RestartCount: proc.info.RestartCount,
+		MaxRestarts:  proc.info.MaxRestarts,
+		Restarts:     append([]time.Time(nil), proc.restartTimes...),
+	}
+	autoRestart, path := proc.info.AutoRestart, proc.info.RestartPolicy
+	proc.mu.RUnlock()
+
+	sim := &types.Simulation{
+		Process: in.Name,
+		Policy:  valueOr(path, "built-in"),
+		Paused:  m.Paused(),
+	}
+
+	start := time.Now()
+	now := start
+	for crash := 1; crash <= req.Times; crash++ {
+		now = now.Add(uptime)
+		in.Now = now
+
+		d := decideRestart(autoRestart, path, in)
+		step := types.SimulationStep{
+			Crash:    crash,
+			At:       now.Sub(start).Seconds(),
+			ExitCode: req.ExitCode,
+			Action:   d.action,
+			Reason:   d.reason,
+		}
+		if d.err != nil {
+			step.Error = d.err.Error()
+		}
+		if d.restart {
+			step.Delay = d.delay.Seconds()
+		}
+		sim.Steps = append(sim.Steps, step)
+
+		if !d.restart {
+			sim.Outcome = fmt.Sprintf("Gives up after crash %d, the process stays stopped", crash)
+			break
+		}
+
+		in.RestartCount++
+		in.Restarts = append(in.Restarts, now)
+		if len(in.Restarts) > maxRestartTimes {
+			in.Restarts = in.Restarts[len(in.Restarts)-maxRestartTimes:]
+		}
+		now = now.Add(d.delay)
+	}
+	if sim.Outcome == "" {
+		sim.Outcome = fmt.Sprintf("Still restarting after %d crashes, %d restarts in total", req.Times, in.RestartCount)
+	}
+	if sim.Paused {
+		sim.Outcome += "; supervision is paused, so no crashed process is restarted until it is resumed"
+	}
+
+	return sim, nil
+}
+
+func valueOr(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// Reset clears the restart count, the recent restarts passed to policies
+// and a crash loop, so the process gets its full restart budget again. A
+// crash-looped or errored process is left stopped; a running one keeps
+// running.
+func (p *Process) Reset() {
+	p.mu.Lock()
+	p.info.RestartCount = 0
+	p.restartTimes = nil
+	p.info.CrashLoopedAt = nil
+	if p.info.Status == types.StatusCrashLooped || p.info.Status == types.StatusErrored {
+		p.info.Status = types.StatusStopped
+	}
+	p.publish(types.EventReset, "Restart count and error state reset", nil)
+	p.mu.Unlock()
+	p.saveState()
+}
+
+// supervisedRestart restarts a running process that is unhealthy for cause,
+// counting it as an automatic restart, or fails over to its standby if one
+// is ready. still is called with p.mu held and
+// cancels the restart if the process recovered meanwhile. The caller must
+// not hold p.mu.
+func (p *Process) supervisedRestart(cause string, still func() bool) {
+	p.mu.Lock()
+	if p.info.Status != types.StatusRunning || !still() {
+		p.mu.Unlock()
+		return
+	}
+	p.info.RestartCount++
+	p.restartTimes = append(p.restartTimes, time.Now())
+	if len(p.restartTimes) > maxRestartTimes {
+		p.restartTimes = p.restartTimes[len(p.restartTimes)-maxRestartTimes:]
+	}
+	if p.standby.ready {
+		p.failover(cause)
+		p.mu.Unlock()
+		p.saveState()
+		return
+	}
+	p.publish(types.EventRestart, fmt.Sprintf("Restarting process as %s (attempt %d)", cause, p.info.RestartCount), map[string]interface{}{
+		"restart_count": p.info.RestartCount,
+		"reason":        cause,
+	})
+	p.stopReason, p.stopDetail = types.ExitHealthFailed, cause
+	p.mu.Unlock()
+
+	if err := p.Restart(); err != nil {
+		p.logger.Log("stderr", fmt.Sprintf("Failed to restart: %v", err))
+	}
+}
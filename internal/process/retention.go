@@ -0,0 +1,174 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// Retention reasons, reported in the config_change event of a deleted
+// process
+const (
+	RetentionStopped   = "stopped"
+	RetentionCompleted = "completed"
+)
+
+// retentionPolicy deletes processes that stayed stopped too long
+type retentionPolicy struct {
+	stopped   time.Duration
+	completed time.Duration
+	archive   bool
+}
+
+// newRetentionPolicy parses the retention config, or returns nil if it
+// keeps every process
+func newRetentionPolicy(cfg config.RetentionConfig) *retentionPolicy {
+	r := &retentionPolicy{}
+	for _, d := range []struct {
+		field string
+		value string
+		dst   *time.Duration
+	}{
+		{"stopped", cfg.Stopped, &r.stopped},
+		{"completed", cfg.Completed, &r.completed},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v <= 0 {
+			fmt.Printf("Warning: invalid retention.%s %q, keeping these processes\n", d.field, d.value)
+			continue
+		}
+		*d.dst = v
+	}
+
+	switch cfg.Action {
+	case "", "delete":
+	case "archive":
+		r.archive = true
+	default:
+		fmt.Printf("Warning: invalid retention.action %q, disabling retention\n", cfg.Action)
+		return nil
+	}
+
+	if r.stopped == 0 && r.completed == 0 {
+		return nil
+	}
+	return r
+}
+
+// expired returns why a process is past its retention, or "" if it is kept
+func (r *retentionPolicy) expired(info *types.ProcessInfo, now time.Time) string {
+	if info.Status != types.StatusStopped && info.Status != types.StatusErrored {
+		return ""
+	}
+	if info.StoppedAt == nil {
+		return ""
+	}
+	age := now.Sub(*info.StoppedAt)
+
+	completed := info.LastExit != nil && info.LastExit.Reason == types.ExitCompleted
+	if completed && r.completed > 0 && age > r.completed {
+		return RetentionCompleted
+	}
+	if r.stopped > 0 && age > r.stopped {
+		return RetentionStopped
+	}
+	return ""
+}
+
+// RetentionEnabled reports whether stopped processes are deleted
+func (m *Manager) RetentionEnabled() bool {
+	return m.retention != nil
+}
+
+// EnforceRetention deletes the processes that have been stopped longer than
+// the retention allows, archiving them first if configured. Nothing is
+// deleted while supervision is paused.
+func (m *Manager) EnforceRetention() {
+	r := m.retention
+	if r == nil || m.Paused() {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, p := range m.registry.all() {
+		info := p.Info()
+		reason := r.expired(info, now)
+		if reason == "" {
+			continue
+		}
+
+		data := map[string]interface{}{
+			"retention":  reason,
+			"stopped_at": info.StoppedAt,
+		}
+		if r.archive {
+			path, err := m.archiveProcess(p, reason)
+			if err != nil {
+				fmt.Printf("Warning: failed to archive process %s, keeping it: %v\n", p.Name(), err)
+				continue
+			}
+			data["archive"] = path
+		}
+
+		if err := m.deleteProcess(p, data); err != nil {
+			fmt.Printf("Warning: failed to delete process %s: %v\n", p.Name(), err)
+		}
+	}
+}
+
+// archivedProcess is a process saved before retention deleted it
+type archivedProcess struct {
+	ArchivedAt time.Time                 `json:"archived_at"`
+	Retention  string                    `json:"retention"`
+	Process    *types.ProcessInfo        `json:"process"`
+	Definition types.StartRequest        `json:"definition"`
+	History    []types.DefinitionVersion `json:"history,omitempty"`
+	// Annotations are the notes attached to the process
+	Annotations []types.Annotation `json:"annotations,omitempty"`
+}
+
+// archiveProcess saves a process with its definition history and
+// annotations to the archive directory and returns the file written
+func (m *Manager) archiveProcess(p *Process, reason string) (string, error) {
+	history, err := m.loadHistory(p.ID())
+	if err != nil {
+		return "", err
+	}
+	annotations, err := m.loadAnnotations(p.ID())
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(archivedProcess{
+		ArchivedAt:  time.Now(),
+		Retention:   reason,
+		Process:     p.Info(),
+		Definition:  p.Definition(),
+		History:     history,
+		Annotations: annotations,
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(m.dataDir, "archive")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.json", p.Name(), p.ID()))
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
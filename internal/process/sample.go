@@ -0,0 +1,114 @@
+package process
+
+import (
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// procSample is the resource usage of a process read in a sampling pass
+type procSample struct {
+	cpuTime        float64 // user and system seconds
+	cpuUser        float64
+	cpuSystem      float64
+	memory         uint64 // resident set size
+	memoryPercent  float64
+	threads        int32
+	fds            int32
+	readBytes      uint64
+	writeBytes     uint64
+	voluntaryCtx   uint64
+	involuntaryCtx uint64
+	minorFaults    uint64
+	majorFaults    uint64
+}
+
+// sampleStats samples the running processes among procs in a single pass,
+// returning their stats in the same order, nil for the others
+func sampleStats(procs []*Process) []*types.ProcessStats {
+	pids := make([]int, len(procs))
+	for i, p := range procs {
+		pids[i] = p.runningPID()
+	}
+	samples := sampleProcesses(pids)
+
+	now := time.Now()
+	result := make([]*types.ProcessStats, len(procs))
+	for i, p := range procs {
+		if pids[i] > 0 {
+			sample, ok := samples[pids[i]]
+			result[i] = p.statsFrom(pids[i], sample, ok, now)
+		}
+	}
+	return result
+}
+
+// runningPID returns the PID of the process if it is running, or 0
+func (p *Process) runningPID() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.info.Status != types.StatusRunning {
+		return 0
+	}
+	return p.info.PID
+}
+
+// statsFrom builds the stats of the process from a sample of pid taken at
+// now. ok is false if pid couldn't be sampled. It returns nil if the process
+// no longer runs as pid.
+func (p *Process) statsFrom(pid int, sample procSample, ok bool, now time.Time) *types.ProcessStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.info.PID != pid || p.info.Status != types.StatusRunning {
+		return nil
+	}
+
+	stats := &types.ProcessStats{
+		ID:        p.info.ID,
+		PID:       pid,
+		Logging:   p.logger.Stats(),
+		Disk:      p.diskUsage(),
+		Probes:    p.probeResults(),
+		Timestamp: now,
+	}
+	if !ok {
+		return stats
+	}
+
+	stats.CPUTime = sample.cpuTime
+	stats.CPUUser = sample.cpuUser
+	stats.CPUSystem = sample.cpuSystem
+	stats.CPU = p.cpuPercent(pid, sample.cpuTime, now)
+	stats.Memory = sample.memory
+	stats.MemoryPercent = sample.memoryPercent
+	stats.NumThreads = sample.threads
+	stats.NumFDs = sample.fds
+	stats.ReadBytes = sample.readBytes
+	stats.WriteBytes = sample.writeBytes
+	stats.VoluntaryCtxSwitches = sample.voluntaryCtx
+	stats.InvoluntaryCtxSwitches = sample.involuntaryCtx
+	stats.MinorFaults = sample.minorFaults
+	stats.MajorFaults = sample.majorFaults
+
+	return stats
+}
+
+// cpuPercent returns the CPU usage since the previous sample of the run, or
+// since the run started. The caller must hold p.mu.
+func (p *Process) cpuPercent(pid int, cpuTime float64, now time.Time) float64 {
+	since, before := now, 0.0
+	if p.info.StartedAt != nil {
+		since = *p.info.StartedAt
+	}
+	if prev, ok := p.stats.last(); ok && prev.PID == pid && !prev.Timestamp.Before(since) {
+		since, before = prev.Timestamp, prev.CPUTime
+	}
+
+	elapsed := now.Sub(since).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return max(cpuTime-before, 0) / elapsed * 100
+}
@@ -0,0 +1,157 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+)
+
+// sampleProcesses reads the usage of the given processes from /proc, four
+// files per process. PIDs that can't be read are left out.
+func sampleProcesses(pids []int) map[int]procSample {
+	samples := make(map[int]procSample, len(pids))
+	memTotal := readMemTotal()
+	pageSize := uint64(os.Getpagesize())
+
+	for _, pid := range pids {
+		if pid <= 0 {
+			continue
+		}
+		sample, err := readProcStat(pid, pageSize)
+		if err != nil {
+			continue
+		}
+		if memTotal > 0 {
+			sample.memoryPercent = float64(sample.memory) / float64(memTotal) * 100
+		}
+		sample.readBytes, sample.writeBytes = readProcIO(pid)
+		sample.voluntaryCtx, sample.involuntaryCtx = readCtxSwitches(pid)
+		sample.fds = countFDs(pid)
+		samples[pid] = sample
+	}
+	return samples
+}
+
+// readProcStat reads CPU time, page faults, threads and resident memory
+// from /proc/<pid>/stat
+func readProcStat(pid int, pageSize uint64) (procSample, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return procSample{}, err
+	}
+
+	// The command name may contain spaces, the fields follow its closing
+	// parenthesis starting at the state
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return procSample{}, fmt.Errorf("malformed stat of %d", pid)
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 22 {
+		return procSample{}, fmt.Errorf("malformed stat of %d", pid)
+	}
+
+	minflt, _ := strconv.ParseUint(fields[7], 10, 64)
+	majflt, _ := strconv.ParseUint(fields[9], 10, 64)
+	utime, _ := strconv.ParseFloat(fields[11], 64)
+	stime, _ := strconv.ParseFloat(fields[12], 64)
+	threads, _ := strconv.ParseInt(fields[17], 10, 32)
+	rss, _ := strconv.ParseUint(fields[21], 10, 64)
+
+	return procSample{
+		cpuTime:     (utime + stime) / cpu.ClocksPerSec,
+		cpuUser:     utime / cpu.ClocksPerSec,
+		cpuSystem:   stime / cpu.ClocksPerSec,
+		minorFaults: minflt,
+		majorFaults: majflt,
+		memory:      rss * pageSize,
+		threads:     int32(threads),
+	}, nil
+}
+
+// readCtxSwitches returns the voluntary and involuntary context switches of
+// a process from /proc/<pid>/status
+func readCtxSwitches(pid int) (voluntary, involuntary uint64) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "voluntary_ctxt_switches":
+			voluntary, _ = strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		case "nonvoluntary_ctxt_switches":
+			involuntary, _ = strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		}
+	}
+	return voluntary, involuntary
+}
+
+// readProcIO returns the bytes a process read from and wrote to storage
+func readProcIO(pid int) (read, written uint64) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/io", pid))
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ": ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "read_bytes":
+			read, _ = strconv.ParseUint(value, 10, 64)
+		case "write_bytes":
+			written, _ = strconv.ParseUint(value, 10, 64)
+		}
+	}
+	return read, written
+}
+
+// countFDs returns the number of open file descriptors of a process
+func countFDs(pid int) int32 {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/fd", pid))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return 0
+	}
+	return int32(len(names))
+}
+
+// readMemTotal returns the total memory of the system in bytes, or 0
+func readMemTotal() uint64 {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "MemTotal:"); ok {
+			kb, _ := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+			return kb * 1024
+		}
+	}
+	return 0
+}
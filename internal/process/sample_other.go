@@ -0,0 +1,53 @@
+//go:build !linux
+
+package process
+
+import (
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// sampleProcesses reads the usage of the given processes through gopsutil.
+// PIDs that can't be read are left out.
+func sampleProcesses(pids []int) map[int]procSample {
+	samples := make(map[int]procSample, len(pids))
+	for _, pid := range pids {
+		if pid <= 0 {
+			continue
+		}
+		proc, err := process.NewProcess(int32(pid))
+		if err != nil {
+			continue
+		}
+
+		var sample procSample
+		if times, err := proc.Times(); err == nil && times != nil {
+			sample.cpuTime = times.User + times.System
+			sample.cpuUser, sample.cpuSystem = times.User, times.System
+		}
+		if mem, err := proc.MemoryInfo(); err == nil && mem != nil {
+			sample.memory = mem.RSS
+		}
+		if memPercent, err := proc.MemoryPercent(); err == nil {
+			sample.memoryPercent = float64(memPercent)
+		}
+		if threads, err := proc.NumThreads(); err == nil {
+			sample.threads = threads
+		}
+		if fds, err := proc.NumFDs(); err == nil {
+			sample.fds = fds
+		}
+		if ioCounters, err := proc.IOCounters(); err == nil && ioCounters != nil {
+			sample.readBytes = ioCounters.ReadBytes
+			sample.writeBytes = ioCounters.WriteBytes
+		}
+		if ctx, err := proc.NumCtxSwitches(); err == nil && ctx != nil {
+			sample.voluntaryCtx = uint64(ctx.Voluntary)
+			sample.involuntaryCtx = uint64(ctx.Involuntary)
+		}
+		if faults, err := proc.PageFaults(); err == nil && faults != nil {
+			sample.minorFaults, sample.majorFaults = faults.MinorFaults, faults.MajorFaults
+		}
+		samples[pid] = sample
+	}
+	return samples
+}
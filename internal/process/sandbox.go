@@ -0,0 +1,39 @@
+package process
+
+import (
+	"os/exec"
+
+	"github.com/PrismManager/gemstone/internal/sandbox"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// sandbox makes the command start through the exec shim if the process has
+// capabilities, a seccomp profile, a security context or an isolated
+// network, which are applied before exec. The profile is read again on every start. The caller must
+// hold p.mu.
+func (p *Process) sandbox(cmd *exec.Cmd) error {
+	opts := sandboxOptions(p.info.Capabilities, p.info.Seccomp, p.info.AppArmorProfile, p.info.SELinuxLabel)
+	opts.IsolateNetwork = p.isolatedNetwork()
+	if opts.Empty() {
+		return nil
+	}
+
+	spec, err := sandbox.Prepare(opts)
+	if err != nil {
+		return err
+	}
+	return sandbox.Wrap(cmd, spec)
+}
+
+func sandboxOptions(caps *types.Capabilities, seccomp, apparmor, selinux string) sandbox.Options {
+	opts := sandbox.Options{
+		Seccomp:         seccomp,
+		AppArmorProfile: apparmor,
+		SELinuxLabel:    selinux,
+	}
+	if caps != nil {
+		opts.Keep = caps.Keep
+		opts.Drop = caps.Drop
+	}
+	return opts
+}
@@ -0,0 +1,176 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/cron"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// scaleGroup is a process of an apply document with scale rules, kept to add
+// and remove its instances when the rules change their number
+type scaleGroup struct {
+	// Definition is the process as listed, with its default instance
+	// count and its rules
+	Definition types.StartRequest `json:"definition"`
+	// Instances is the number of instances defined now
+	Instances int `json:"instances"`
+}
+
+// scaleKey identifies the scale group of a process by namespace and name
+func scaleKey(namespace, name string) string {
+	return namespaceOrDefault(namespace) + "/" + name
+}
+
+// validateScale checks the scale rules of a process
+func validateScale(proc *types.StartRequest) error {
+	if proc.Instances < 0 {
+		return fmt.Errorf("instances must not be negative")
+	}
+	for i, rule := range proc.Scale {
+		if _, err := cron.Parse(rule.Schedule); err != nil {
+			return fmt.Errorf("scale[%d]: %w", i, err)
+		}
+		if rule.Instances < 1 {
+			return fmt.Errorf("scale[%d]: instances must be at least 1", i)
+		}
+	}
+	return nil
+}
+
+// scaledInstances returns the number of instances the scale rules of a
+// process ask for at a time, in its timezone
+func scaledInstances(proc *types.StartRequest, now time.Time) int {
+	if proc.Timezone != "" {
+		if loc, err := time.LoadLocation(proc.Timezone); err == nil {
+			now = now.In(loc)
+		}
+	}
+	for _, rule := range proc.Scale {
+		if schedule, err := cron.Parse(rule.Schedule); err == nil && schedule.Matches(now) {
+			return rule.Instances
+		}
+	}
+	return max(proc.Instances, 1)
+}
+
+// instanceNames returns the names of the instances of a scaled process
+func instanceNames(name string, n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-%d", name, i)
+	}
+	return names
+}
+
+// Scale moves the instance count of each scaled process one instance
+// toward what its rules ask for now. Scaling up waits until the instances
+// added last have started, so instances come and go one at a time. Nothing
+// is scaled while supervision is paused.
+func (m *Manager) Scale() {
+	if m.Paused() {
+		return
+	}
+
+	m.applyMu.Lock()
+	defer m.applyMu.Unlock()
+
+	keys := make([]string, 0, len(m.scaleGroups))
+	for key := range m.scaleGroups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	now := time.Now()
+	for _, key := range keys {
+		g := m.scaleGroups[key]
+		want := scaledInstances(&g.Definition, now)
+		next := g.Instances
+		switch {
+		case want > g.Instances && !m.instancesStarting(&g.Definition, g.Instances):
+			next++
+		case want < g.Instances:
+			next--
+		}
+		if next == g.Instances {
+			continue
+		}
+
+		req := &types.ApplyRequest{Processes: []types.StartRequest{g.Definition}, Partial: true}
+		result, err := m.apply(req, "scale", nil, map[string]int{key: next})
+		if err != nil {
+			fmt.Printf("Warning: failed to scale %s to %d instances: %v\n", g.Definition.Name, next, err)
+			continue
+		}
+		fmt.Printf("Scaled %s from %d to %d instances\n", g.Definition.Name, g.Instances, next)
+		for _, change := range result.Changes {
+			if change.Error != "" {
+				fmt.Printf("Warning: failed to %s %s while scaling: %s\n", change.Action, change.Name, change.Error)
+			}
+		}
+	}
+}
+
+// instancesStarting reports whether any of the first n instances of a
+// scaled process is still starting or waiting to
+func (m *Manager) instancesStarting(def *types.StartRequest, n int) bool {
+	for _, name := range instanceNames(def.Name, n) {
+		if p := m.registry.byName(name); p != nil {
+			switch p.Status() {
+			case types.StatusStarting, types.StatusQueued:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// updateScaleGroups records the scaled processes of an apply and forgets
+// the ones no longer scaled. The caller must hold m.applyMu.
+func (m *Manager) updateScaleGroups(plan *applyPlan) {
+	if len(plan.scaled) == 0 && len(plan.unscaled) == 0 {
+		return
+	}
+	for _, key := range plan.unscaled {
+		delete(m.scaleGroups, key)
+	}
+	for i := range plan.scaled {
+		g := plan.scaled[i]
+		m.scaleGroups[scaleKey(g.Definition.Namespace, g.Definition.Name)] = &g
+	}
+	m.saveScaleGroups()
+}
+
+func (m *Manager) scaleGroupsPath() string {
+	return filepath.Join(m.dataDir, "scaling.json")
+}
+
+func (m *Manager) loadScaleGroups() map[string]*scaleGroup {
+	groups := make(map[string]*scaleGroup)
+	data, err := os.ReadFile(m.scaleGroupsPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("Warning: failed to load scaled processes: %v\n", err)
+		}
+		return groups
+	}
+	if err := json.Unmarshal(data, &groups); err != nil {
+		fmt.Printf("Warning: failed to load scaled processes: %v\n", err)
+	}
+	return groups
+}
+
+func (m *Manager) saveScaleGroups() {
+	data, err := json.MarshalIndent(m.scaleGroups, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(m.scaleGroupsPath(), data, 0644)
+	}
+	if err != nil {
+		fmt.Printf("Warning: failed to save scaled processes: %v\n", err)
+	}
+}
@@ -0,0 +1,87 @@
+package process
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+func TestScaledInstances(t *testing.T) {
+	proc := &types.StartRequest{
+		Name:      "worker",
+		Instances: 2,
+		Timezone:  "Europe/Berlin",
+		Scale: []types.ScaleRule{
+			{Schedule: "* 8-19 * * mon-fri", Instances: 8},
+			{Schedule: "* 8-19 * * *", Instances: 4},
+		},
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	for when, want := range map[time.Time]int{
+		// A Tuesday and a Saturday, in Berlin
+		time.Date(2026, 3, 10, 9, 0, 0, 0, berlin):  8,
+		time.Date(2026, 3, 14, 9, 0, 0, 0, berlin):  4,
+		time.Date(2026, 3, 10, 20, 0, 0, 0, berlin): 2,
+		// 07:30 UTC is 08:30 in Berlin
+		time.Date(2026, 3, 10, 7, 30, 0, 0, time.UTC): 8,
+	} {
+		if got := scaledInstances(proc, when); got != want {
+			t.Errorf("at %s got %d instances, want %d", when, got, want)
+		}
+	}
+
+	proc.Instances = 0
+	if got := scaledInstances(proc, time.Date(2026, 3, 10, 22, 0, 0, 0, berlin)); got != 1 {
+		t.Errorf("got %d instances outside the rules with instances unset, want 1", got)
+	}
+}
+
+func TestValidateScale(t *testing.T) {
+	for _, rules := range [][]types.ScaleRule{
+		{{Schedule: "nope", Instances: 2}},
+		{{Schedule: "* * * * *", Instances: 0}},
+	} {
+		if err := validateScale(&types.StartRequest{Name: "worker", Scale: rules}); err == nil {
+			t.Errorf("rules %+v are valid", rules)
+		}
+	}
+}
+
+func TestExpandInstances(t *testing.T) {
+	scale := []types.ScaleRule{{Schedule: "* * * * *", Instances: 1}}
+	got, err := expandInstances([]types.StartRequest{
+		{Name: "api"},
+		{Name: "web", Instances: 2, Env: map[string]string{"PORT": "80"}},
+		// Scaled processes are suffixed even with one instance
+		{Name: "worker", Instances: 1, Scale: scale},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, proc := range got {
+		names = append(names, proc.Name)
+		if proc.Instances != 0 || proc.Scale != nil {
+			t.Errorf("%s keeps instances %d, scale %v", proc.Name, proc.Instances, proc.Scale)
+		}
+	}
+	if want := []string{"api", "web-0", "web-1", "worker-0"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got %v, want %v", names, want)
+	}
+	if got[2].Env["GEMSTONE_INSTANCE"] != "1" || got[2].Env["PORT"] != "80" {
+		t.Errorf("web-1 has env %v", got[2].Env)
+	}
+	if _, ok := got[1].Env["GEMSTONE_INSTANCE"]; !ok || got[1].Env["GEMSTONE_INSTANCE"] == got[2].Env["GEMSTONE_INSTANCE"] {
+		t.Errorf("instances share their env: %v", got[1].Env)
+	}
+
+	if _, err := expandInstances([]types.StartRequest{{Name: "web", Instances: -1}}); err == nil {
+		t.Error("negative instances were expanded")
+	}
+}
@@ -0,0 +1,209 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/cron"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// maxRuns is the number of finished runs kept per scheduled process
+const maxRuns = 100
+
+// nextRun returns when the schedule of the process starts it next after a
+// time, in its timezone, nil without a schedule. The caller must hold p.mu.
+func (p *Process) nextRun(after time.Time) *time.Time {
+	if p.info.Schedule == "" {
+		return nil
+	}
+	schedule, err := cron.Parse(p.info.Schedule)
+	if err != nil {
+		return nil
+	}
+	if p.info.Timezone != "" {
+		if loc, err := time.LoadLocation(p.info.Timezone); err == nil {
+			after = after.In(loc)
+		}
+	}
+	next := schedule.Next(after)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// scheduleDue reports whether the schedule of the process is due and moves
+// the next run past now
+func (p *Process) scheduleDue(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.info.NextRun == nil || now.Before(*p.info.NextRun) {
+		return false
+	}
+	p.info.NextRun = p.nextRun(now)
+	return true
+}
+
+// finishRun ends the run of a scheduled process that just exited and
+// returns it for the run history, which the caller saves once it has
+// released p.mu. The caller must hold p.mu.
+func (p *Process) finishRun(at time.Time) types.ScheduledRun {
+	trigger := types.TriggerManual
+	if p.scheduledRun {
+		trigger = types.TriggerSchedule
+	}
+	p.scheduledRun = false
+
+	started := at
+	if p.info.StartedAt != nil {
+		started = *p.info.StartedAt
+	}
+	run := types.ScheduledRun{
+		Generation: p.info.Generation,
+		Trigger:    trigger,
+		StartedAt:  started,
+		FinishedAt: at,
+		Duration:   at.Sub(started).Seconds(),
+		ExitCode:   p.info.LastExit.Code,
+		Signal:     p.info.LastExit.Signal,
+		Reason:     p.info.LastExit.Reason,
+	}
+	p.info.LastRun = &run
+	return run
+}
+
+// RunScheduled starts the processes whose schedule is due. A run that is
+// due while the previous one is still going is skipped, and so are runs due
+// while supervision is paused.
+func (m *Manager) RunScheduled() {
+	now := time.Now()
+	for _, p := range m.registry.all() {
+		if !p.scheduleDue(now) {
+			continue
+		}
+		if m.Paused() {
+			p.logger.Log("stderr", "Supervision is paused, skipping scheduled run")
+			continue
+		}
+
+		p.mu.Lock()
+		switch p.info.Status {
+		case types.StatusStopped, types.StatusErrored, types.StatusCrashLooped:
+		default:
+			p.mu.Unlock()
+			p.logger.Log("stderr", fmt.Sprintf("Skipping scheduled run, the process is %s", p.Status()))
+			continue
+		}
+		p.scheduledRun = true
+		p.mu.Unlock()
+
+		if err := p.Start(); err != nil {
+			p.mu.Lock()
+			p.scheduledRun = false
+			p.mu.Unlock()
+			p.logger.Log("stderr", fmt.Sprintf("Failed to start scheduled run: %v", err))
+		}
+	}
+}
+
+// Runs returns the finished runs of a process, oldest first
+func (m *Manager) Runs(idOrName string) ([]types.ScheduledRun, error) {
+	proc := m.registry.lookup(idOrName)
+	if proc == nil {
+		return nil, fmt.Errorf("process %s not found", idOrName)
+	}
+
+	m.runsMu.Lock()
+	defer m.runsMu.Unlock()
+
+	runs, err := m.loadRuns(proc.ID())
+	if err != nil {
+		return nil, err
+	}
+	if runs == nil {
+		runs = []types.ScheduledRun{}
+	}
+	return runs, nil
+}
+
+// recordRun appends a finished run to the run history of a process. It
+// doesn't take m.mu, which may be held while waiting for the process to
+// stop.
+func (m *Manager) recordRun(id string, run types.ScheduledRun) {
+	m.runsMu.Lock()
+	defer m.runsMu.Unlock()
+
+	runs, err := m.loadRuns(id)
+	if err != nil {
+		fmt.Printf("Warning: failed to load runs of process %s: %v\n", id, err)
+	}
+	runs = append(runs, run)
+	if len(runs) > maxRuns {
+		runs = runs[len(runs)-maxRuns:]
+	}
+	if err := m.saveRuns(id, runs); err != nil {
+		fmt.Printf("Warning: failed to save runs of process %s: %v\n", id, err)
+	}
+}
+
+// lastRun returns the last finished run of a process, nil if there is none
+func (m *Manager) lastRun(id string) *types.ScheduledRun {
+	m.runsMu.Lock()
+	defer m.runsMu.Unlock()
+
+	runs, err := m.loadRuns(id)
+	if err != nil || len(runs) == 0 {
+		return nil
+	}
+	return &runs[len(runs)-1]
+}
+
+func (m *Manager) runsPath(id string) string {
+	return filepath.Join(m.dataDir, "runs", id+".json")
+}
+
+func (m *Manager) loadRuns(id string) ([]types.ScheduledRun, error) {
+	data, err := os.ReadFile(m.runsPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var runs []types.ScheduledRun
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+func (m *Manager) saveRuns(id string, runs []types.ScheduledRun) error {
+	path := m.runsPath(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data, 0644)
+}
+
+// removeRuns deletes the run history of a deleted process
+func (m *Manager) removeRuns(id string) {
+	m.runsMu.Lock()
+	defer m.runsMu.Unlock()
+
+	if err := os.Remove(m.runsPath(id)); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: failed to remove runs: %v\n", err)
+	}
+}
@@ -0,0 +1,57 @@
+package process
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/systemd"
+)
+
+// scopeOptions are how processes are placed in systemd scopes
+type scopeOptions struct {
+	slice string
+}
+
+// newScopeOptions returns the scope options, or nil unless scopes are
+// enabled on a host running systemd
+func newScopeOptions(cfg config.SystemdConfig) *scopeOptions {
+	if !cfg.Scope {
+		return nil
+	}
+	if !systemd.Booted() {
+		fmt.Printf("Warning: systemd.scope is set but the host doesn't run systemd, processes stay in the daemon's cgroup\n")
+		return nil
+	}
+	if cfg.Slice != "" && !strings.HasSuffix(cfg.Slice, ".slice") {
+		fmt.Printf("Warning: invalid systemd.slice %q, using the default slice\n", cfg.Slice)
+		cfg.Slice = ""
+	}
+	return &scopeOptions{slice: cfg.Slice}
+}
+
+// joinScope moves the process into a transient scope unit named after it
+// and the run, so a scope of the previous run still being collected can't
+// clash. Children forked before the move stay in the daemon's cgroup. The
+// caller must hold p.mu.
+func (p *Process) joinScope() {
+	p.info.Unit = ""
+	if p.scopes == nil {
+		return
+	}
+
+	unit := systemd.UnitName("scope", "gemstone", p.info.Name, p.info.ID, strconv.Itoa(p.info.Generation))
+	err := systemd.StartScope(systemd.Scope{
+		Unit:        unit,
+		Description: fmt.Sprintf("gemstone process %s (%s)", p.info.Name, p.info.Namespace),
+		Slice:       p.scopes.slice,
+		// Soft limits write to the cgroup of the scope
+		Delegate: true,
+	}, p.info.PID)
+	if err != nil {
+		p.logger.Log("stderr", fmt.Sprintf("Not running in a systemd scope: %v", err))
+		return
+	}
+	p.info.Unit = unit
+}
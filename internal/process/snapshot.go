@@ -0,0 +1,42 @@
+package process
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// Snapshot returns the definitions and state of the processes whose
+// namespace canAccess allows, sorted by namespace and name. nil allows all.
+func (m *Manager) Snapshot(canAccess func(namespace string) bool) *types.Snapshot {
+	host, _ := os.Hostname()
+	s := &types.Snapshot{
+		Host:      host,
+		TakenAt:   time.Now(),
+		Processes: []types.SnapshotProcess{},
+	}
+
+	for _, p := range m.registry.all() {
+		info := p.Info()
+		if canAccess != nil && !canAccess(info.Namespace) {
+			continue
+		}
+		s.Processes = append(s.Processes, types.SnapshotProcess{
+			ID:         info.ID,
+			Status:     info.Status,
+			Revision:   info.Revision,
+			Definition: p.Definition(),
+		})
+	}
+
+	sort.Slice(s.Processes, func(i, j int) bool {
+		a, b := s.Processes[i].Definition, s.Processes[j].Definition
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return s
+}
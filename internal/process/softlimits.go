@@ -0,0 +1,231 @@
+package process
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/cgroup"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// Soft limit defaults
+const (
+	DefaultThrottleFor = 5 * time.Minute
+	defaultCPUWeight   = 10
+	normalCPUWeight    = 100
+)
+
+// CPU actions of soft limits
+const (
+	CPUActionMax    = "max"
+	CPUActionWeight = "weight"
+)
+
+// throttleState tracks the cgroup and throttling of a process
+type throttleState struct {
+	group      *cgroup.Group
+	lastUsage  cgroup.Usage
+	active     bool
+	until      time.Time
+	highEvents uint64
+	oomKills   uint64
+}
+
+// validateSoftLimits checks the settings of soft limits
+func validateSoftLimits(s *types.SoftLimits) error {
+	if s.CPUPercent < 0 || s.CPUThrottle < 0 || s.MemoryHigh < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	switch s.CPUAction {
+	case "", CPUActionMax, CPUActionWeight:
+	default:
+		return fmt.Errorf("unknown cpu_action %q (expected max or weight)", s.CPUAction)
+	}
+	if s.CPUWeight != 0 && (s.CPUWeight < 1 || s.CPUWeight > 10000) {
+		return fmt.Errorf("cpu_weight must be between 1 and 10000")
+	}
+	if s.ThrottleFor != "" {
+		if d, err := time.ParseDuration(s.ThrottleFor); err != nil || d <= 0 {
+			return fmt.Errorf("invalid throttle_for %q", s.ThrottleFor)
+		}
+	}
+	return nil
+}
+
+// setupCgroup moves a newly started process into its cgroup if it has soft
+// limits. Children forked before the move stay outside the cgroup. The
+// caller must hold p.mu.
+func (p *Process) setupCgroup() {
+	limits := p.info.SoftLimits
+	if limits == nil {
+		return
+	}
+
+	p.throttle.lastUsage = cgroup.Usage{}
+	p.throttle.active = false
+
+	if p.info.Unit != "" {
+		// Limit the delegated cgroup of the scope rather than moving the
+		// process out of it
+		p.removeCgroup()
+		group, err := cgroup.ForProcess(p.info.PID)
+		if err != nil {
+			p.throttle.group = nil
+			p.logger.Log("stderr", fmt.Sprintf("Soft limits disabled: %v", err))
+			return
+		}
+		p.throttle.group = group
+	} else {
+		if p.throttle.group == nil || p.throttle.group.External() {
+			group, err := cgroup.New("proc-" + p.info.ID)
+			if err != nil {
+				p.logger.Log("stderr", fmt.Sprintf("Soft limits disabled: %v", err))
+				return
+			}
+			p.throttle.group = group
+		}
+		if err := p.throttle.group.AddProcess(p.info.PID); err != nil {
+			p.logger.Log("stderr", fmt.Sprintf("Soft limits disabled: failed to join cgroup: %v", err))
+			return
+		}
+	}
+	g := p.throttle.group
+
+	// Lift throttling left over from the previous run
+	_ = g.ResetCPUMax()
+	_ = g.SetCPUWeight(normalCPUWeight)
+
+	if limits.MemoryHigh > 0 {
+		if err := g.SetMemoryHigh(uint64(limits.MemoryHigh) * 1024 * 1024); err != nil {
+			p.logger.Log("stderr", fmt.Sprintf("Failed to set memory soft limit: %v", err))
+		}
+	}
+	p.throttle.highEvents, _ = g.MemoryHighEvents()
+	p.throttle.oomKills, _ = g.OOMKills()
+}
+
+// oomKilled reports whether the OOM killer killed a process of the cgroup
+// since the process started. The caller must hold p.mu.
+func (p *Process) oomKilled() bool {
+	if p.throttle.group == nil {
+		return false
+	}
+	kills, err := p.throttle.group.OOMKills()
+	return err == nil && kills > p.throttle.oomKills
+}
+
+// removeCgroup deletes the cgroup of the process once it is empty. The
+// caller must hold p.mu.
+func (p *Process) removeCgroup() {
+	if p.throttle.group != nil && p.throttle.group.Remove() == nil {
+		p.throttle.group = nil
+	}
+}
+
+// checkSoftLimits measures the CPU usage of the process since the last
+// check and throttles it if it exceeds its soft limit. While paused, no new
+// throttling is applied.
+func (p *Process) checkSoftLimits(paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	limits := p.info.SoftLimits
+	g := p.throttle.group
+	if limits == nil || g == nil || p.info.Status != types.StatusRunning {
+		return
+	}
+
+	now := time.Now()
+	if p.throttle.active && now.After(p.throttle.until) {
+		p.unthrottle()
+	}
+
+	if events, err := g.MemoryHighEvents(); err == nil && events > p.throttle.highEvents {
+		p.publish(types.EventThrottle, fmt.Sprintf("Memory above the %dMB soft limit is being reclaimed", limits.MemoryHigh), map[string]interface{}{
+			"resource":    "memory",
+			"memory_high": limits.MemoryHigh,
+			"events":      events - p.throttle.highEvents,
+		})
+		p.throttle.highEvents = events
+	}
+
+	usage, err := g.CPUUsage()
+	if err != nil {
+		return
+	}
+	last := p.throttle.lastUsage
+	p.throttle.lastUsage = usage
+	if last.Time.IsZero() || limits.CPUPercent <= 0 {
+		return
+	}
+
+	elapsed := usage.Time.Sub(last.Time)
+	if elapsed <= 0 {
+		return
+	}
+	cpu := float64(usage.CPU-last.CPU) / float64(elapsed) * 100
+
+	if cpu > limits.CPUPercent && !p.throttle.active && !paused {
+		p.applyThrottle(cpu)
+	}
+}
+
+// applyThrottle throttles the CPU of the process. The caller must hold p.mu.
+func (p *Process) applyThrottle(cpu float64) {
+	limits := p.info.SoftLimits
+	g := p.throttle.group
+
+	throttleFor := DefaultThrottleFor
+	if d, err := time.ParseDuration(limits.ThrottleFor); err == nil {
+		throttleFor = d
+	}
+
+	data := map[string]interface{}{
+		"resource":    "cpu",
+		"cpu":         cpu,
+		"cpu_percent": limits.CPUPercent,
+		"duration":    throttleFor.Seconds(),
+	}
+
+	var err error
+	var action string
+	if limits.CPUAction == CPUActionWeight {
+		weight := limits.CPUWeight
+		if weight == 0 {
+			weight = defaultCPUWeight
+		}
+		err = g.SetCPUWeight(weight)
+		action = fmt.Sprintf("lowered cpu.weight to %d", weight)
+		data["cpu_weight"] = weight
+	} else {
+		throttle := limits.CPUThrottle
+		if throttle == 0 {
+			throttle = limits.CPUPercent / 2
+		}
+		err = g.SetCPUMax(throttle)
+		action = fmt.Sprintf("capped CPU at %.0f%%", throttle)
+		data["cpu_throttle"] = throttle
+	}
+	if err != nil {
+		p.logger.Log("stderr", fmt.Sprintf("Failed to throttle process: %v", err))
+		return
+	}
+
+	p.throttle.active = true
+	p.throttle.until = time.Now().Add(throttleFor)
+	p.publish(types.EventThrottle, fmt.Sprintf("CPU usage %.0f%% exceeded the %.0f%% soft limit, %s for %s", cpu, limits.CPUPercent, action, throttleFor), data)
+}
+
+// unthrottle lifts CPU throttling. The caller must hold p.mu.
+func (p *Process) unthrottle() {
+	g := p.throttle.group
+	if err := g.ResetCPUMax(); err != nil {
+		p.logger.Log("stderr", fmt.Sprintf("Failed to lift CPU cap: %v", err))
+	}
+	if err := g.SetCPUWeight(normalCPUWeight); err != nil {
+		p.logger.Log("stderr", fmt.Sprintf("Failed to restore cpu.weight: %v", err))
+	}
+
+	p.throttle.active = false
+	p.publish(types.EventUnthrottle, "CPU throttling lifted", map[string]interface{}{"resource": "cpu"})
+}
@@ -0,0 +1,247 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// gitTimeout bounds every git command run for a source
+const gitTimeout = 5 * time.Minute
+
+// sourceState is the checkout of a process with a git source
+type sourceState struct {
+	// mu serializes git commands on the checkout
+	mu  sync.Mutex
+	dir string
+}
+
+// validateSource checks the git source of a definition
+func validateSource(src *types.Source, workDir string) error {
+	if src.Git == "" {
+		return fmt.Errorf("git is required")
+	}
+	if strings.HasPrefix(src.Ref, "-") {
+		return fmt.Errorf("invalid ref %q", src.Ref)
+	}
+	if filepath.IsAbs(workDir) {
+		return fmt.Errorf("work_dir must be relative to the checkout")
+	}
+	return nil
+}
+
+// sourcePath returns the directory holding the checkout of a process
+func (m *Manager) sourcePath(id string) string {
+	return filepath.Join(m.dataDir, "sources", id)
+}
+
+// removeSource deletes the checkout of a process
+func (m *Manager) removeSource(id string) {
+	if err := os.RemoveAll(m.sourcePath(id)); err != nil {
+		fmt.Printf("Warning: failed to remove source checkout of %s: %v\n", id, err)
+	}
+}
+
+// prepareSource clones the source of a process if it has none yet and
+// checks out its ref. With update set it fetches the remote first.
+func (m *Manager) prepareSource(p *Process, update bool) error {
+	p.mu.RLock()
+	src := p.info.Source
+	p.mu.RUnlock()
+	if src == nil {
+		return nil
+	}
+
+	s := &p.source
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	if _, err := os.Stat(filepath.Join(s.dir, ".git")); err != nil {
+		if err := cloneSource(ctx, src.Git, s.dir); err != nil {
+			return err
+		}
+	} else {
+		if url, _ := git(ctx, s.dir, "remote", "get-url", "origin"); url != src.Git {
+			if _, err := git(ctx, s.dir, "remote", "set-url", "origin", src.Git); err != nil {
+				return err
+			}
+			update = true
+		}
+		if update {
+			if err := fetchSource(ctx, s.dir); err != nil {
+				return err
+			}
+		}
+	}
+
+	revision, err := resolveRef(ctx, s.dir, src.Ref)
+	if err != nil && !update {
+		// The ref may be newer than the last fetch
+		if err := fetchSource(ctx, s.dir); err != nil {
+			return err
+		}
+		revision, err = resolveRef(ctx, s.dir, src.Ref)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := git(ctx, s.dir, "checkout", "--quiet", "--force", "--detach", revision); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.info.Revision = revision
+	p.mu.Unlock()
+	return nil
+}
+
+// loadSource reads the revision of an existing checkout, or clones the
+// source if the checkout is missing
+func (m *Manager) loadSource(p *Process) error {
+	if p.Definition().Source == nil {
+		return nil
+	}
+
+	if _, err := os.Stat(filepath.Join(p.source.dir, ".git")); err != nil {
+		return m.prepareSource(p, false)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	revision, err := git(ctx, p.source.dir, "rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.info.Revision = revision
+	p.mu.Unlock()
+	return nil
+}
+
+// Deploy fetches the source of a process, checks out its ref and restarts
+// the process if it was running
+func (m *Manager) Deploy(idOrName string) (*types.ProcessInfo, error) {
+	proc := m.registry.lookup(idOrName)
+	if proc == nil {
+		return nil, fmt.Errorf("process %s not found", idOrName)
+	}
+	if proc.Definition().Source == nil {
+		return nil, fmt.Errorf("process %s has no source", idOrName)
+	}
+
+	previous := proc.Info().Revision
+	if err := m.prepareSource(proc, true); err != nil {
+		return nil, fmt.Errorf("failed to deploy: %w", err)
+	}
+	info := proc.Info()
+
+	proc.mu.Lock()
+	proc.publish(types.EventDeploy, fmt.Sprintf("Deployed revision %s", shortRevision(info.Revision)), map[string]interface{}{
+		"revision":          info.Revision,
+		"previous_revision": previous,
+		"ref":               info.Source.Ref,
+	})
+	proc.mu.Unlock()
+
+	if info.Status == types.StatusRunning && info.Revision != previous {
+		if err := proc.Restart(); err != nil {
+			return nil, err
+		}
+	}
+	return proc.Info(), nil
+}
+
+// workDir returns the directory the process runs in. The caller must hold
+// p.mu.
+func (p *Process) workDir() string {
+	if p.info.Source != nil {
+		return filepath.Join(p.source.dir, p.info.WorkDir)
+	}
+	return p.info.WorkDir
+}
+
+// cloneSource clones url into dir without checking out a revision. The
+// clone appears at dir only once complete.
+func cloneSource(ctx context.Context, url, dir string) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return fmt.Errorf("failed to create source directory: %w", err)
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), ".clone-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if _, err := git(ctx, "", "clone", "--quiet", "--no-checkout", "--", url, tmp); err != nil {
+		return err
+	}
+	os.RemoveAll(dir)
+	return os.Rename(tmp, dir)
+}
+
+// fetchSource fetches branches and tags of the remote
+func fetchSource(ctx context.Context, dir string) error {
+	if _, err := git(ctx, dir, "fetch", "--quiet", "--force", "--prune", "--tags", "origin"); err != nil {
+		return err
+	}
+	// Follow a change of the default branch
+	_, _ = git(ctx, dir, "remote", "set-head", "origin", "--auto")
+	return nil
+}
+
+// resolveRef returns the commit of a ref, preferring the remote branch of
+// that name over a tag or commit. An empty ref is the default branch.
+func resolveRef(ctx context.Context, dir, ref string) (string, error) {
+	candidates := []string{"origin/HEAD"}
+	if ref != "" {
+		candidates = []string{"origin/" + ref, ref}
+	}
+	for _, c := range candidates {
+		if revision, err := git(ctx, dir, "rev-parse", "--verify", "--quiet", c+"^{commit}"); err == nil {
+			return revision, nil
+		}
+	}
+	if ref == "" {
+		return "", fmt.Errorf("no default branch found")
+	}
+	return "", fmt.Errorf("ref %s not found", ref)
+}
+
+// git runs a git command in dir and returns its trimmed output
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// shortRevision abbreviates a commit hash for messages
+func shortRevision(revision string) string {
+	if len(revision) > 12 {
+		return revision[:12]
+	}
+	return revision
+}
@@ -0,0 +1,221 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// ErrNoStandby is returned for a failover of a process without a
+// suspended standby
+var ErrNoStandby = errors.New("no standby ready")
+
+// defaultStandbyWarmup is how long a standby runs before it is suspended
+// unless the process sets a warmup
+const defaultStandbyWarmup = 30 * time.Second
+
+// standbyState tracks the warm standby of a process
+type standbyState struct {
+	cmd *exec.Cmd
+	// ready is set once the standby is suspended
+	ready bool
+	// retiring holds the PIDs of dropped standbys and of runs a standby
+	// took over from until they exit
+	retiring map[int]bool
+}
+
+func validateStandby(sb *types.Standby) error {
+	if sb.Warmup == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(sb.Warmup); err != nil || d < 0 {
+		return fmt.Errorf("invalid warmup %q", sb.Warmup)
+	}
+	return nil
+}
+
+// standbyWarmup returns the warmup of the standby of the process
+func standbyWarmup(sb *types.Standby) time.Duration {
+	if d, err := time.ParseDuration(sb.Warmup); err == nil {
+		return d
+	}
+	return defaultStandbyWarmup
+}
+
+// EnsureStandbys starts a standby for running processes that want one and
+// have none. No standbys are started while supervision is paused.
+func (m *Manager) EnsureStandbys() {
+	if m.Paused() {
+		return
+	}
+	for _, p := range m.registry.all() {
+		p.ensureStandby()
+	}
+}
+
+// wantsStandby reports whether the process needs a new standby. Until the
+// runs it replaced exit, they may still hold ports the standby would bind.
+// The caller must hold p.mu.
+func (p *Process) wantsStandby() bool {
+	return p.info.Standby != nil && p.info.Status == types.StatusRunning &&
+		p.standby.cmd == nil && len(p.standby.retiring) == 0
+}
+
+func (p *Process) ensureStandby() {
+	p.mu.RLock()
+	want := p.wantsStandby()
+	p.mu.RUnlock()
+	if !want {
+		return
+	}
+
+	env, err := p.environ(context.Background())
+	if err != nil {
+		p.logger.Log("stderr", fmt.Sprintf("Not starting a standby: %v", err))
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.wantsStandby() {
+		return
+	}
+
+	cmd, stdout, stderr, err := p.spawn(p.ctx, append(env, "GEMSTONE_STANDBY=1"))
+	if err != nil {
+		p.logger.Log("stderr", fmt.Sprintf("Failed to start a standby: %v", err))
+		return
+	}
+	p.standby.cmd, p.standby.ready = cmd, false
+
+	warmup := standbyWarmup(p.info.Standby)
+	p.logger.Log("stderr", fmt.Sprintf("Started standby with PID %d, suspending it in %s", cmd.Process.Pid, warmup))
+
+	enc := p.captureEncoding()
+	go p.captureOutput(stdout, "stdout", enc)
+	go p.captureOutput(stderr, "stderr", enc)
+	go p.waitForExit(cmd)
+	time.AfterFunc(warmup, func() { p.suspendStandby(cmd) })
+}
+
+// suspendStandby stops the process group of a warmed up standby with
+// SIGSTOP, unless it is no longer the standby
+func (p *Process) suspendStandby(cmd *exec.Cmd) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.standby.cmd != cmd {
+		return
+	}
+	pid := cmd.Process.Pid
+	if err := syscall.Kill(-pid, syscall.SIGSTOP); err != nil {
+		p.logger.Log("stderr", fmt.Sprintf("Failed to suspend standby PID %d: %v", pid, err))
+		return
+	}
+	p.standby.ready = true
+	p.publish(types.EventStandbyReady, fmt.Sprintf("Standby PID %d suspended, ready to take over", pid), map[string]interface{}{
+		"pid": pid,
+	})
+}
+
+// Failover hands the process over to its standby and recycles the run it
+// replaces
+func (m *Manager) Failover(idOrName string) error {
+	proc := m.registry.lookup(idOrName)
+	if proc == nil {
+		return fmt.Errorf("process %s not found", idOrName)
+	}
+
+	m.delayStop(proc)
+	return proc.Failover()
+}
+
+// Failover resumes the suspended standby in place of the running process,
+// which is asked to exit
+func (p *Process) Failover() error {
+	p.mu.Lock()
+	if p.info.Status != types.StatusRunning {
+		p.mu.Unlock()
+		return fmt.Errorf("process %s is not running", p.info.Name)
+	}
+	if !p.standby.ready {
+		p.mu.Unlock()
+		return fmt.Errorf("%w for %s", ErrNoStandby, p.info.Name)
+	}
+	p.failover("requested")
+	p.mu.Unlock()
+	p.saveState()
+	return nil
+}
+
+// failover resumes the ready standby as the new run of the process and
+// retires the previous run if it still runs. The caller must hold p.mu.
+func (p *Process) failover(cause string) {
+	previous := p.info.PID
+	cmd := p.standby.cmd
+	p.standby.cmd, p.standby.ready = nil, false
+
+	if previous > 0 {
+		p.retire(previous)
+	}
+	pid := cmd.Process.Pid
+	if err := syscall.Kill(-pid, syscall.SIGCONT); err != nil {
+		p.logger.Log("stderr", fmt.Sprintf("Failed to resume standby PID %d: %v", pid, err))
+	}
+
+	p.stopForwards()
+	p.adopt(cmd)
+	p.publish(types.EventFailover, fmt.Sprintf("Standby PID %d took over as %s", pid, cause), map[string]interface{}{
+		"pid":          pid,
+		"previous_pid": previous,
+		"reason":       cause,
+	})
+}
+
+// dropStandby retires the standby of the process. The caller must hold
+// p.mu.
+func (p *Process) dropStandby() {
+	if p.standby.cmd == nil {
+		return
+	}
+	p.retire(p.standby.cmd.Process.Pid)
+	p.standby.cmd, p.standby.ready = nil, false
+}
+
+// retire asks the process group of a run the process no longer supervises
+// to exit, resuming it in case it is suspended, and kills it if it doesn't
+// exit within the stop timeout. The caller must hold p.mu.
+func (p *Process) retire(pid int) {
+	if p.standby.retiring == nil {
+		p.standby.retiring = make(map[int]bool)
+	}
+	p.standby.retiring[pid] = true
+	_ = syscall.Kill(-pid, syscall.SIGTERM)
+	_ = syscall.Kill(-pid, syscall.SIGCONT)
+
+	time.AfterFunc(stopTimeout, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.standby.retiring[pid] {
+			_ = syscall.Kill(-pid, syscall.SIGKILL)
+		}
+	})
+}
+
+// retiredExited notes the exit of a standby or of a run a standby took over
+// from. The caller must hold p.mu.
+func (p *Process) retiredExited(cmd *exec.Cmd) {
+	pid := cmd.Process.Pid
+	if cmd == p.standby.cmd {
+		p.standby.cmd, p.standby.ready = nil, false
+		p.logger.Log("stderr", fmt.Sprintf("Standby PID %d exited: %s", pid, cmd.ProcessState))
+		return
+	}
+	delete(p.standby.retiring, pid)
+	p.logger.Log("stderr", fmt.Sprintf("Retired PID %d exited: %s", pid, cmd.ProcessState))
+}
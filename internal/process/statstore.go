@@ -0,0 +1,339 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/ring"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+const (
+	// statsSaveInterval is how often the stats history is written to disk
+	statsSaveInterval = 5 * time.Minute
+	// statsChunkSize is how many samples are copied at a time when the
+	// history is streamed
+	statsChunkSize = 500
+	// statsSampleInterval is how often the stats collector samples
+	// processes, used to size the tier that keeps every sample
+	statsSampleInterval = 10 * time.Second
+)
+
+// statsTier keeps samples at a resolution until they are older than its
+// retention, at most capacity of them. A resolution of zero keeps every
+// sample.
+type statsTier struct {
+	resolution time.Duration
+	retention  time.Duration
+	capacity   int
+}
+
+// statsTiers parses the stats retention of the config, falling back to the
+// defaults when it is invalid
+func statsTiers(cfg config.StatsConfig) []statsTier {
+	tiers, err := parseStatsTiers(cfg)
+	if err != nil {
+		fmt.Printf("Warning: invalid stats config, using the defaults: %v\n", err)
+		tiers, _ = parseStatsTiers(config.DefaultConfig().Stats)
+	}
+	return tiers
+}
+
+func parseStatsTiers(cfg config.StatsConfig) ([]statsTier, error) {
+	retention, err := time.ParseDuration(cfg.Retention)
+	if err != nil || retention <= 0 {
+		return nil, fmt.Errorf("invalid retention %q", cfg.Retention)
+	}
+	tiers := []statsTier{{retention: retention}}
+
+	for _, d := range cfg.Downsample {
+		prev := tiers[len(tiers)-1]
+		resolution, err := time.ParseDuration(d.Resolution)
+		if err != nil || resolution <= prev.resolution {
+			return nil, fmt.Errorf("invalid downsample resolution %q, resolutions must increase", d.Resolution)
+		}
+		retention, err := time.ParseDuration(d.Retention)
+		if err != nil || retention <= prev.retention {
+			return nil, fmt.Errorf("invalid downsample retention %q, retentions must increase", d.Retention)
+		}
+		tiers = append(tiers, statsTier{resolution: resolution, retention: retention})
+	}
+
+	if cfg.MaxSamples < 0 {
+		return nil, fmt.Errorf("invalid max_samples %d", cfg.MaxSamples)
+	}
+	for i := range tiers {
+		interval := max(tiers[i].resolution, statsSampleInterval)
+		tiers[i].capacity = int(tiers[i].retention/interval) + 1
+		if cfg.MaxSamples > 0 {
+			tiers[i].capacity = min(tiers[i].capacity, cfg.MaxSamples)
+		}
+	}
+	return tiers, nil
+}
+
+// statsSeries is the stats history of a process. New samples go to the
+// first tier; samples older than a tier's retention are averaged into the
+// next tier, or dropped after the last. It is guarded by the mutex of its
+// process.
+type statsSeries struct {
+	tiers   []statsTier
+	samples []*ring.Buffer[types.ProcessStats]
+}
+
+func newStatsSeries(tiers []statsTier) *statsSeries {
+	if len(tiers) == 0 {
+		tiers, _ = parseStatsTiers(config.DefaultConfig().Stats)
+	}
+	s := &statsSeries{
+		tiers:   tiers,
+		samples: make([]*ring.Buffer[types.ProcessStats], len(tiers)),
+	}
+	for i, tier := range tiers {
+		s.samples[i] = ring.New[types.ProcessStats](tier.capacity)
+	}
+	return s
+}
+
+// last returns the newest sample
+func (s *statsSeries) last() (types.ProcessStats, bool) {
+	for _, samples := range s.samples {
+		if sample, ok := samples.Last(); ok {
+			return sample, true
+		}
+	}
+	return types.ProcessStats{}, false
+}
+
+// add records a sample and compacts the tiers. The oldest sample of a full
+// tier is downsampled into the next one before it is overwritten.
+func (s *statsSeries) add(sample types.ProcessStats) {
+	s.compact(sample.Timestamp)
+	if first := s.samples[0]; first.Len() == first.Cap() {
+		s.expire(0, 1)
+	}
+	s.samples[0].Push(sample)
+}
+
+// saved returns the samples of each tier for saving, oldest first
+func (s *statsSeries) saved() [][]types.ProcessStats {
+	saved := make([][]types.ProcessStats, len(s.samples))
+	for i, samples := range s.samples {
+		saved[i] = samples.Slice()
+	}
+	return saved
+}
+
+// compact moves samples past the retention of their tier into the next one
+func (s *statsSeries) compact(now time.Time) {
+	for i, tier := range s.tiers {
+		cutoff := now.Add(-tier.retention)
+		samples := s.samples[i]
+
+		expired := 0
+		for expired < samples.Len() && samples.Ptr(expired).Timestamp.Before(cutoff) {
+			expired++
+		}
+		if expired > 0 {
+			s.expire(i, expired)
+		}
+	}
+}
+
+// expire moves the n oldest samples of a tier into the next one, or drops
+// them after the last
+func (s *statsSeries) expire(tier, n int) {
+	if tier+1 < len(s.tiers) {
+		for j := 0; j < n; j++ {
+			s.addDownsampled(tier+1, s.samples[tier].At(j))
+		}
+	}
+	s.samples[tier].Drop(n)
+}
+
+// addDownsampled averages a sample into the bucket of the tier's resolution
+// it falls into, which is the last one or a new one
+func (s *statsSeries) addDownsampled(tier int, sample types.ProcessStats) {
+	samples := s.samples[tier]
+	bucket := sample.Timestamp.Truncate(s.tiers[tier].resolution)
+	weight := max(sample.Samples, 1)
+
+	n := samples.Len()
+	if n == 0 || !samples.Ptr(n-1).Timestamp.Equal(bucket) {
+		if n == samples.Cap() {
+			s.expire(tier, 1)
+		}
+		sample.Timestamp = bucket
+		sample.Samples = weight
+		samples.Push(sample)
+		return
+	}
+
+	agg := samples.Ptr(n - 1)
+	total := float64(agg.Samples + weight)
+	avg := func(a, b float64) float64 {
+		return (a*float64(agg.Samples) + b*float64(weight)) / total
+	}
+	agg.CPU = avg(agg.CPU, sample.CPU)
+	agg.Memory = uint64(avg(float64(agg.Memory), float64(sample.Memory)))
+	agg.MemoryPercent = avg(agg.MemoryPercent, sample.MemoryPercent)
+	agg.NumThreads = int32(avg(float64(agg.NumThreads), float64(sample.NumThreads)))
+	agg.NumFDs = int32(avg(float64(agg.NumFDs), float64(sample.NumFDs)))
+
+	// Counters keep their latest value
+	agg.PID = sample.PID
+	agg.ReadBytes = sample.ReadBytes
+	agg.WriteBytes = sample.WriteBytes
+	agg.CPUTime = sample.CPUTime
+	agg.CPUUser = sample.CPUUser
+	agg.CPUSystem = sample.CPUSystem
+	agg.VoluntaryCtxSwitches = sample.VoluntaryCtxSwitches
+	agg.InvoluntaryCtxSwitches = sample.InvoluntaryCtxSwitches
+	agg.MinorFaults = sample.MinorFaults
+	agg.MajorFaults = sample.MajorFaults
+	agg.Logging = sample.Logging
+	agg.Disk = sample.Disk
+	agg.Probes = sample.Probes
+	agg.Samples += weight
+}
+
+// since returns the samples from since on, oldest first, the last limit of
+// them if limit is positive
+func (s *statsSeries) since(since time.Time, limit int) []types.ProcessStats {
+	result := make([]types.ProcessStats, 0)
+	for i := len(s.samples) - 1; i >= 0; i-- {
+		samples := s.samples[i]
+		for j := 0; j < samples.Len(); j++ {
+			if sample := samples.Ptr(j); !sample.Timestamp.Before(since) {
+				result = append(result, *sample)
+			}
+		}
+	}
+
+	if limit > 0 && limit < len(result) {
+		result = result[len(result)-limit:]
+	}
+	return result
+}
+
+// start returns the timestamp of the first sample since returns, or false
+// if there is none
+func (s *statsSeries) start(since time.Time, limit int) (time.Time, bool) {
+	// Count from the newest sample back to find the first of the last limit
+	n := 0
+	var first time.Time
+	for _, samples := range s.samples {
+		for j := samples.Len() - 1; j >= 0; j-- {
+			sample := samples.Ptr(j)
+			if sample.Timestamp.Before(since) {
+				continue
+			}
+			first = sample.Timestamp
+			n++
+			if limit > 0 && n == limit {
+				return first, true
+			}
+		}
+	}
+	return first, n > 0
+}
+
+// chunk returns up to n samples from from on, oldest first
+func (s *statsSeries) chunk(from time.Time, n int) []types.ProcessStats {
+	result := make([]types.ProcessStats, 0, n)
+	for i := len(s.samples) - 1; i >= 0; i-- {
+		samples := s.samples[i]
+		for j := 0; j < samples.Len(); j++ {
+			sample := samples.Ptr(j)
+			if sample.Timestamp.Before(from) {
+				continue
+			}
+			result = append(result, *sample)
+			if len(result) == n {
+				return result
+			}
+		}
+	}
+	return result
+}
+
+// statsPath is the file the stats history of a process is saved to
+func (m *Manager) statsPath(id string) string {
+	return filepath.Join(m.dataDir, "stats", id+".json")
+}
+
+// loadStats returns the saved stats history of a process, an empty one if
+// there is none
+func (m *Manager) loadStats(id string) *statsSeries {
+	series := newStatsSeries(m.statsTiers)
+
+	data, err := os.ReadFile(m.statsPath(id))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("Warning: failed to load stats history of %s: %v\n", id, err)
+		}
+		return series
+	}
+
+	var saved [][]types.ProcessStats
+	if err := json.Unmarshal(data, &saved); err != nil {
+		fmt.Printf("Warning: failed to load stats history of %s: %v\n", id, err)
+		return series
+	}
+
+	// Tiers may have been removed from the config since, their samples are
+	// kept in the last tier until they expire
+	last := len(series.samples) - 1
+	for len(saved) > len(series.samples) {
+		saved[last] = append(saved[last], saved[last+1]...)
+		saved = append(saved[:last+1], saved[last+2:]...)
+	}
+	if len(saved) > last {
+		merged := saved[last]
+		sort.Slice(merged, func(i, j int) bool { return merged[i].Timestamp.Before(merged[j].Timestamp) })
+	}
+	for i, samples := range saved {
+		for _, sample := range samples {
+			series.samples[i].Push(sample)
+		}
+	}
+	series.compact(time.Now())
+
+	return series
+}
+
+// SaveStats writes the stats history of all processes to disk
+func (m *Manager) SaveStats() {
+	procs := m.registry.all()
+
+	if err := os.MkdirAll(filepath.Join(m.dataDir, "stats"), 0755); err != nil {
+		fmt.Printf("Warning: failed to save stats history: %v\n", err)
+		return
+	}
+
+	for _, p := range procs {
+		p.mu.RLock()
+		data, err := json.Marshal(p.stats.saved())
+		p.mu.RUnlock()
+
+		if err == nil {
+			err = writeFileAtomic(m.statsPath(p.ID()), data, 0644)
+		}
+		if err != nil {
+			fmt.Printf("Warning: failed to save stats history of %s: %v\n", p.Name(), err)
+		}
+	}
+	m.statsSavedAt = time.Now()
+}
+
+// removeStats deletes the saved stats history of a deleted process
+func (m *Manager) removeStats(id string) {
+	if err := os.Remove(m.statsPath(id)); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: failed to remove stats history of %s: %v\n", id, err)
+	}
+}
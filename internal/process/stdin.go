@@ -0,0 +1,57 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// openStdin opens the standard input of the process, nil for /dev/null.
+// Relative paths are relative to the working directory. A named pipe is
+// opened for reading and writing, so opening it doesn't block until a
+// writer connects and the process doesn't read end of file between
+// writers. The daemon opens the file, so with cred it must be readable by
+// the run user. The caller must hold p.mu.
+func (p *Process) openStdin(cred *syscall.Credential) (*os.File, error) {
+	path := p.info.Stdin
+	if path == "" || path == os.DevNull {
+		return nil, nil
+	}
+	if dir := p.workDir(); !filepath.IsAbs(path) && dir != "" {
+		path = filepath.Join(dir, path)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	if cred != nil && !readableBy(fi, cred) {
+		return nil, fmt.Errorf("%s is not readable by uid %d", path, cred.Uid)
+	}
+
+	if fi.Mode()&os.ModeNamedPipe != 0 {
+		return os.OpenFile(path, os.O_RDWR, 0)
+	}
+	return os.Open(path)
+}
+
+// readableBy reports whether the permission bits of a file let the user of
+// cred read it
+func readableBy(fi os.FileInfo, cred *syscall.Credential) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || cred.Uid == 0 {
+		return true
+	}
+	perm := fi.Mode().Perm()
+	switch {
+	case st.Uid == cred.Uid:
+		return perm&0400 != 0
+	case st.Gid == cred.Gid:
+		return perm&0040 != 0
+	}
+	return perm&0004 != 0
+}
@@ -0,0 +1,260 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// ErrTargetNotFound is returned for a target missing from the config
+var ErrTargetNotFound = errors.New("target not found")
+
+// targetStartTimeout bounds how long a required target may take until all
+// its processes run
+const targetStartTimeout = DefaultWaitTimeout
+
+// targetPollInterval is the time between checks of a required target
+const targetPollInterval = 200 * time.Millisecond
+
+// Targets returns the configured targets with the state of their
+// processes, sorted by name
+func (m *Manager) Targets() []types.TargetStatus {
+	result := make([]types.TargetStatus, 0, len(m.config.Targets))
+	for _, t := range m.config.Targets {
+		status := types.TargetStatus{Name: t.Name, Requires: t.Requires, Processes: []string{}}
+		procs := m.targetProcesses(t)
+		for _, p := range procs {
+			status.Processes = append(status.Processes, p.Name())
+			if p.Status() == types.StatusRunning {
+				status.Running++
+			}
+		}
+		status.Active = len(procs) > 0 && status.Running == len(procs)
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// StartTarget starts the processes of a target after those of the targets
+// it requires, which must all be running before the next target starts.
+// Running processes are left alone. A process failing in a required target
+// aborts the start, failures in the target itself are only reported.
+//
+// canAccess reports whether a namespace may be changed; nil allows all.
+func (m *Manager) StartTarget(name string, canAccess func(namespace string) bool) (*types.TargetResult, error) {
+	order, err := m.targetOrder(name, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkTargetAccess(order, canAccess); err != nil {
+		return nil, err
+	}
+
+	result := &types.TargetResult{Target: name, Actions: []types.TargetAction{}}
+	for i, t := range order {
+		var started []*Process
+		for _, p := range m.targetProcesses(t) {
+			action := types.TargetAction{Target: t.Name, Process: p.Name()}
+			switch p.Status() {
+			case types.StatusRunning, types.StatusStarting, types.StatusQueued:
+				action.Action = "running"
+			default:
+				if err := p.Start(); err != nil {
+					action.Action = "failed"
+					action.Error = err.Error()
+				} else {
+					action.Action = "started"
+					started = append(started, p)
+				}
+			}
+			result.Actions = append(result.Actions, action)
+			if action.Action == "failed" && i < len(order)-1 {
+				return result, fmt.Errorf("required target %s failed to start: %s: %s", t.Name, p.Name(), action.Error)
+			}
+		}
+
+		// Dependents start once the required target is up
+		if i < len(order)-1 {
+			if err := waitTargetRunning(t, started); err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// StopTarget stops the processes of a target after those of the targets
+// requiring it, dependents first
+//
+// canAccess reports whether a namespace may be changed; nil allows all.
+func (m *Manager) StopTarget(name string, canAccess func(namespace string) bool) (*types.TargetResult, error) {
+	order, err := m.targetOrder(name, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkTargetAccess(order, canAccess); err != nil {
+		return nil, err
+	}
+
+	result := &types.TargetResult{Target: name, Actions: []types.TargetAction{}}
+	stopped := make(map[*Process]bool)
+	for _, t := range order {
+		for _, p := range m.targetProcesses(t) {
+			status := p.Status()
+			if stopped[p] || (status != types.StatusRunning && status != types.StatusStarting && status != types.StatusQueued) {
+				continue
+			}
+			stopped[p] = true
+
+			action := types.TargetAction{Target: t.Name, Process: p.Name(), Action: "stopped"}
+			m.delayStop(p)
+			if err := p.Stop(); err != nil {
+				action.Action = "failed"
+				action.Error = err.Error()
+			}
+			result.Actions = append(result.Actions, action)
+		}
+	}
+	return result, nil
+}
+
+// findTarget returns the config of a target
+func (m *Manager) findTarget(name string) (config.TargetConfig, bool) {
+	for _, t := range m.config.Targets {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return config.TargetConfig{}, false
+}
+
+// targetOrder returns a target with the targets it requires, each after
+// its requirements. With dependents it returns the target with the targets
+// requiring it instead, each before its requirements.
+func (m *Manager) targetOrder(name string, dependents bool) ([]config.TargetConfig, error) {
+	if _, ok := m.findTarget(name); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTargetNotFound, name)
+	}
+
+	// Edges point from a target to the ones acted on before it
+	before := func(t config.TargetConfig) []string {
+		if !dependents {
+			return t.Requires
+		}
+		var names []string
+		for _, other := range m.config.Targets {
+			for _, r := range other.Requires {
+				if r == t.Name {
+					names = append(names, other.Name)
+				}
+			}
+		}
+		return names
+	}
+
+	var order []config.TargetConfig
+	state := make(map[string]int) // 1 visiting, 2 done
+	var visit func(name string, chain []string) error
+	visit = func(name string, chain []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("targets form a cycle: %s -> %s", strings.Join(chain, " -> "), name)
+		case 2:
+			return nil
+		}
+		t, ok := m.findTarget(name)
+		if !ok {
+			return fmt.Errorf("target %s requires unknown target %s", chain[len(chain)-1], name)
+		}
+
+		state[name] = 1
+		for _, n := range before(t) {
+			if err := visit(n, append(chain, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		order = append(order, t)
+		return nil
+	}
+	if err := visit(name, nil); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// targetProcesses returns the processes matching a target, in the order
+// of its patterns
+func (m *Manager) targetProcesses(t config.TargetConfig) []*Process {
+	return m.matchProcesses(t.Processes)
+}
+
+// matchProcesses returns the processes matching names or globs, in the
+// order of the patterns
+func (m *Manager) matchProcesses(patterns []string) []*Process {
+	procs := m.registry.all()
+	sort.Slice(procs, func(i, j int) bool { return procs[i].Name() < procs[j].Name() })
+
+	var matched []*Process
+	seen := make(map[*Process]bool)
+	for _, pattern := range patterns {
+		for _, p := range procs {
+			if seen[p] {
+				continue
+			}
+			if ok, _ := path.Match(pattern, p.Name()); ok || pattern == p.Name() {
+				seen[p] = true
+				matched = append(matched, p)
+			}
+		}
+	}
+	return matched
+}
+
+// checkTargetAccess fails unless every process of the targets is in a
+// namespace that may be changed
+func (m *Manager) checkTargetAccess(targets []config.TargetConfig, canAccess func(string) bool) error {
+	if canAccess == nil {
+		return nil
+	}
+	for _, t := range targets {
+		for _, p := range m.targetProcesses(t) {
+			if ns := p.Namespace(); !canAccess(ns) {
+				return fmt.Errorf("%w: target %s includes %s in namespace %s", ErrForbidden, t.Name, p.Name(), ns)
+			}
+		}
+	}
+	return nil
+}
+
+// waitTargetRunning waits until the started processes of a target run,
+// failing if one of them exits or the timeout passes
+func waitTargetRunning(t config.TargetConfig, started []*Process) error {
+	deadline := time.Now().Add(targetStartTimeout)
+	for {
+		pending := 0
+		for _, p := range started {
+			switch p.Status() {
+			case types.StatusRunning:
+			case types.StatusStarting, types.StatusQueued:
+				pending++
+			default:
+				return fmt.Errorf("required target %s failed to start: %s is %s", t.Name, p.Name(), p.Status())
+			}
+		}
+		if pending == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("required target %s did not start within %s", t.Name, targetStartTimeout)
+		}
+		time.Sleep(targetPollInterval)
+	}
+}
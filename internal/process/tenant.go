@@ -0,0 +1,64 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/secrets"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// ErrNameUnavailable is returned to a tenant whose process name is taken by
+// a process in a namespace it can't access, without telling which
+var ErrNameUnavailable = errors.New("process name is not available")
+
+// Confine restricts the definition of a process of a tenant, an identity
+// owning namespaces, to what it could do without the daemon: the process
+// runs as the run_as user of its namespace, and settings the daemon carries
+// out with its own privileges, like a log pipe, capabilities, published
+// ports, host paths or secret references resolved with the daemon's
+// credentials, are rejected.
+func Confine(req *types.StartRequest, ns *config.NamespaceConfig) error {
+	if ns == nil || ns.RunAs == "" {
+		return fmt.Errorf("%w: namespace %s has no run_as user", ErrForbidden, namespaceOrDefault(req.Namespace))
+	}
+	if (req.User != "" && req.User != ns.RunAs) || (req.Group != "" && req.Group != ns.RunAsGroup) {
+		return fmt.Errorf("%w: processes in namespace %s run as %s", ErrForbidden, ns.Name, ns.RunAs)
+	}
+	req.User, req.Group = ns.RunAs, ns.RunAsGroup
+
+	var denied []string
+	deny := func(field string, set bool) {
+		if set {
+			denied = append(denied, field)
+		}
+	}
+	deny("log_pipe", req.LogPipe != "")
+	deny("capabilities", req.Capabilities != nil)
+	deny("seccomp", req.Seccomp != "")
+	deny("apparmor_profile", req.AppArmorProfile != "")
+	deny("selinux_label", req.SELinuxLabel != "")
+	deny("network.publish", req.Network != nil && len(req.Network.Publish) > 0)
+	deny("monitor_paths", len(req.MonitorPaths) > 0)
+	deny("stdin", req.Stdin != "")
+	deny("source", req.Source != nil)
+	deny("fetch", req.Fetch != nil)
+	deny("oom_score_adj", req.OOMScoreAdj < 0)
+	var refs []string
+	for k, v := range req.Env {
+		if secrets.IsReference(v) {
+			refs = append(refs, k)
+		}
+	}
+	sort.Strings(refs)
+	for _, k := range refs {
+		deny("env."+k+" (secret reference)", true)
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("%w: tenants may not set %s", ErrForbidden, strings.Join(denied, ", "))
+	}
+	return nil
+}
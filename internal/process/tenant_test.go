@@ -0,0 +1,61 @@
+package process
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+var teamA = &config.NamespaceConfig{Name: "team-a", Owners: []string{"team-a"}, RunAs: "team-a", RunAsGroup: "team-a"}
+
+func TestConfine(t *testing.T) {
+	req := &types.StartRequest{Name: "api", Command: "/srv/api", Namespace: "team-a", Env: map[string]string{"PORT": "8080"}}
+	if err := Confine(req, teamA); err != nil {
+		t.Fatal(err)
+	}
+	if req.User != "team-a" || req.Group != "team-a" {
+		t.Fatalf("runs as %s:%s, want team-a:team-a", req.User, req.Group)
+	}
+}
+
+func TestConfineRejects(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		req  types.StartRequest
+		ns   *config.NamespaceConfig
+		want string
+	}{
+		{"no run_as", types.StartRequest{Namespace: "team-b"}, &config.NamespaceConfig{Name: "team-b"}, "no run_as user"},
+		{"other user", types.StartRequest{User: "root"}, teamA, "run as team-a"},
+		{"log pipe", types.StartRequest{LogPipe: "logger"}, teamA, "log_pipe"},
+		{"seccomp", types.StartRequest{Seccomp: "/etc/profile.json"}, teamA, "seccomp"},
+		{"stdin", types.StartRequest{Stdin: "/etc/shadow"}, teamA, "stdin"},
+		{"negative oom_score_adj", types.StartRequest{OOMScoreAdj: -1000}, teamA, "oom_score_adj"},
+		{
+			"vault secret",
+			types.StartRequest{Env: map[string]string{"PORT": "80", "DB_PASSWORD": "vault://secret/data/team-b/db#password"}},
+			teamA,
+			"env.DB_PASSWORD (secret reference)",
+		},
+		{
+			"SSM secrets",
+			types.StartRequest{Env: map[string]string{"B": "awsssm:///team-b/token", "A": "awsssm:///prod/key"}},
+			teamA,
+			"env.A (secret reference), env.B (secret reference)",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := tc.req
+			err := Confine(&req, tc.ns)
+			if !errors.Is(err, ErrForbidden) {
+				t.Fatalf("got %v, want ErrForbidden", err)
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("got %q, want %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package process
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// maxUptimeSpread is the fraction of the max uptime, here a tenth, over
+// which restarts are spread, so processes started together aren't restarted
+// together
+const maxUptimeSpread = 10
+
+// uptimeDue returns how long the process may run before it is restarted,
+// 0 without a max uptime. Each process restarts a fixed offset of up to a
+// tenth of its max uptime early, derived from its ID. The caller must hold
+// p.mu.
+func (p *Process) uptimeDue() time.Duration {
+	if p.info.MaxUptime == "" {
+		return 0
+	}
+	maxUptime, err := config.ParseDuration(p.info.MaxUptime)
+	if err != nil || maxUptime <= 0 {
+		return 0
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(p.info.ID))
+	spread := maxUptime / maxUptimeSpread
+	if spread <= 0 {
+		return maxUptime
+	}
+	return maxUptime - time.Duration(h.Sum64()%uint64(spread))
+}
+
+// RestartAged gracefully restarts a running process that has been up
+// longer than its max uptime. One process is restarted per call, the one
+// most overdue, so processes sharing a max uptime restart one at a time
+// and the others keep serving meanwhile.
+func (m *Manager) RestartAged() {
+	if m.Paused() {
+		return
+	}
+
+	type aged struct {
+		proc    *Process
+		overdue time.Duration
+		uptime  time.Duration
+	}
+	var due []aged
+	for _, p := range m.registry.all() {
+		p.mu.RLock()
+		if p.info.Status == types.StatusRunning && p.info.StartedAt != nil {
+			if limit := p.uptimeDue(); limit > 0 {
+				uptime := time.Since(*p.info.StartedAt)
+				if uptime >= limit {
+					due = append(due, aged{proc: p, overdue: uptime - limit, uptime: uptime})
+				}
+			}
+		}
+		p.mu.RUnlock()
+	}
+	if len(due) == 0 {
+		return
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].overdue > due[j].overdue })
+
+	a := due[0]
+	a.proc.mu.Lock()
+	if a.proc.info.Status != types.StatusRunning {
+		a.proc.mu.Unlock()
+		return
+	}
+	detail := fmt.Sprintf("it has been up for %s, max_uptime is %s", a.uptime.Round(time.Second), a.proc.info.MaxUptime)
+	a.proc.publish(types.EventRestart, "Restarting process as "+detail, map[string]interface{}{
+		"reason": "max_uptime",
+		"uptime": a.uptime.Seconds(),
+	})
+	a.proc.stopReason, a.proc.stopDetail = types.ExitScheduled, detail
+	a.proc.mu.Unlock()
+
+	m.delayStop(a.proc)
+	if err := a.proc.Restart(); err != nil {
+		a.proc.logger.Log("stderr", fmt.Sprintf("Failed to restart after max uptime: %v", err))
+	}
+}
@@ -0,0 +1,252 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// Usage is kept in hourly buckets per process for usageRetention and saved
+// to disk at most every usageSaveInterval
+const (
+	usageRetention    = 90 * 24 * time.Hour
+	usageSaveInterval = 5 * time.Minute
+)
+
+// Periods usage can be grouped by
+const (
+	UsageHour  = "hour"
+	UsageDay   = "day"
+	UsageMonth = "month"
+	UsageTotal = "total"
+)
+
+// Dimensions usage can be grouped by
+const (
+	UsageByNamespace = "namespace"
+	UsageByProcess   = "process"
+)
+
+type usageKey struct {
+	hour      int64 // unix time of the start of the hour
+	namespace string
+	process   string
+}
+
+type usageTotals struct {
+	cpuSeconds      float64
+	memoryByteHours float64
+}
+
+// usageLedger accumulates the resource consumption of processes. Usage of
+// deleted processes stays attributed to their namespace.
+type usageLedger struct {
+	mu      sync.Mutex
+	path    string
+	buckets map[usageKey]*usageTotals
+	dirty   bool
+	savedAt time.Time
+}
+
+func newUsageLedger(path string) *usageLedger {
+	l := &usageLedger{
+		path:    path,
+		buckets: make(map[usageKey]*usageTotals),
+		savedAt: time.Now(),
+	}
+	if err := l.load(); err != nil {
+		fmt.Printf("Warning: failed to load usage: %v\n", err)
+	}
+	return l
+}
+
+// add accounts resources used by a process in the hour of at
+func (l *usageLedger) add(at time.Time, namespace, process string, cpuSeconds, memoryByteHours float64) {
+	if cpuSeconds == 0 && memoryByteHours == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := usageKey{hour: at.Truncate(time.Hour).Unix(), namespace: namespace, process: process}
+	totals := l.buckets[key]
+	if totals == nil {
+		totals = &usageTotals{}
+		l.buckets[key] = totals
+	}
+	totals.cpuSeconds += cpuSeconds
+	totals.memoryByteHours += memoryByteHours
+	l.dirty = true
+}
+
+// query sums the buckets from since until until by period and namespace or
+// process, ordered by period and name
+func (l *usageLedger) query(since, until time.Time, period, groupBy string) []types.UsageRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	type group struct {
+		start     int64
+		namespace string
+		process   string
+	}
+	groups := make(map[group]*types.UsageRecord)
+
+	for key, totals := range l.buckets {
+		hour := time.Unix(key.hour, 0)
+		if hour.Before(since.Truncate(time.Hour)) || !hour.Before(until) {
+			continue
+		}
+
+		start, end := periodOf(hour, period, since, until)
+		g := group{start: start.Unix(), namespace: key.namespace}
+		if groupBy == UsageByProcess {
+			g.process = key.process
+		}
+
+		record := groups[g]
+		if record == nil {
+			record = &types.UsageRecord{Start: start, End: end, Namespace: g.namespace, Process: g.process}
+			groups[g] = record
+		}
+		record.CPUSeconds += totals.cpuSeconds
+		record.MemoryByteHours += totals.memoryByteHours
+	}
+
+	records := make([]types.UsageRecord, 0, len(groups))
+	for _, record := range groups {
+		records = append(records, *record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if !a.Start.Equal(b.Start) {
+			return a.Start.Before(b.Start)
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Process < b.Process
+	})
+	return records
+}
+
+// periodOf returns the period of the given length an hour falls into
+func periodOf(hour time.Time, period string, since, until time.Time) (time.Time, time.Time) {
+	switch period {
+	case UsageHour:
+		return hour, hour.Add(time.Hour)
+	case UsageMonth:
+		start := time.Date(hour.Year(), hour.Month(), 1, 0, 0, 0, 0, hour.Location())
+		return start, start.AddDate(0, 1, 0)
+	case UsageTotal:
+		return since, until
+	}
+	start := time.Date(hour.Year(), hour.Month(), hour.Day(), 0, 0, 0, 0, hour.Location())
+	return start, start.AddDate(0, 0, 1)
+}
+
+// saveIfDue saves the ledger when it changed and wasn't saved recently
+func (l *usageLedger) saveIfDue() {
+	l.mu.Lock()
+	due := l.dirty && time.Since(l.savedAt) >= usageSaveInterval
+	l.mu.Unlock()
+
+	if due {
+		if err := l.save(); err != nil {
+			fmt.Printf("Warning: failed to save usage: %v\n", err)
+		}
+	}
+}
+
+// save drops buckets older than the retention and writes the rest to disk
+func (l *usageLedger) save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := time.Now().Add(-usageRetention).Unix()
+	records := make([]types.UsageRecord, 0, len(l.buckets))
+	for key, totals := range l.buckets {
+		if key.hour < cutoff {
+			delete(l.buckets, key)
+			continue
+		}
+		hour := time.Unix(key.hour, 0)
+		records = append(records, types.UsageRecord{
+			Start:           hour,
+			End:             hour.Add(time.Hour),
+			Namespace:       key.namespace,
+			Process:         key.process,
+			CPUSeconds:      totals.cpuSeconds,
+			MemoryByteHours: totals.memoryByteHours,
+		})
+	}
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(l.path, data, 0644); err != nil {
+		return err
+	}
+
+	l.dirty = false
+	l.savedAt = time.Now()
+	return nil
+}
+
+func (l *usageLedger) load() error {
+	data, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var records []types.UsageRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+	for _, r := range records {
+		key := usageKey{hour: r.Start.Unix(), namespace: r.Namespace, process: r.Process}
+		l.buckets[key] = &usageTotals{cpuSeconds: r.CPUSeconds, memoryByteHours: r.MemoryByteHours}
+	}
+	return nil
+}
+
+// Usage returns the CPU seconds and memory byte-hours used by processes from
+// since until until, summed per period (hour, day, month or total) and per
+// namespace or process
+func (m *Manager) Usage(since, until time.Time, period, groupBy string) ([]types.UsageRecord, error) {
+	switch period {
+	case UsageHour, UsageDay, UsageMonth, UsageTotal:
+	default:
+		return nil, fmt.Errorf("invalid period %q, expected hour, day, month or total", period)
+	}
+	switch groupBy {
+	case UsageByNamespace, UsageByProcess:
+	default:
+		return nil, fmt.Errorf("invalid grouping %q, expected namespace or process", groupBy)
+	}
+	if !since.Before(until) {
+		return nil, fmt.Errorf("since must be before until")
+	}
+
+	return m.usage.query(since, until, period, groupBy), nil
+}
+
+// SaveUsage writes the recorded usage to disk
+func (m *Manager) SaveUsage() error {
+	return m.usage.save()
+}
+
+func (m *Manager) usagePath() string {
+	return filepath.Join(m.dataDir, "usage.json")
+}
@@ -0,0 +1,87 @@
+package process
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// watchdogState tracks the output watchdog of a process
+type watchdogState struct {
+	// alerted is the silence that was alerted on, as the time its last
+	// output or start, so each silence alerts once
+	alerted time.Time
+}
+
+func validateOutputWatchdog(w *types.OutputWatchdog) error {
+	if d, err := time.ParseDuration(w.Timeout); err != nil || d <= 0 {
+		return fmt.Errorf("invalid timeout %q", w.Timeout)
+	}
+	return nil
+}
+
+// recordOutput notes that the process wrote a line
+func (p *Process) recordOutput() {
+	p.lastOutput.Store(time.Now().UnixNano())
+}
+
+// lastOutputTime returns when the process last wrote a line, or the zero
+// time if it never did
+func (p *Process) lastOutputTime() time.Time {
+	if n := p.lastOutput.Load(); n > 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// WatchOutput emits a no_output event for running processes that wrote no
+// output for longer than their watchdog allows, and restarts them if it
+// says so
+func (m *Manager) WatchOutput() {
+	procs := m.registry.all()
+
+	paused := m.Paused()
+	for _, p := range procs {
+		p.checkOutput(paused)
+	}
+}
+
+func (p *Process) checkOutput(paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w := p.info.OutputWatchdog
+	if w == nil || p.info.Status != types.StatusRunning || p.info.StartedAt == nil {
+		return
+	}
+	timeout, err := time.ParseDuration(w.Timeout)
+	if err != nil {
+		return
+	}
+
+	// Output of a previous run doesn't count
+	since := p.lastOutputTime()
+	if since.Before(*p.info.StartedAt) {
+		since = *p.info.StartedAt
+	}
+	silent := time.Since(since)
+	if silent < timeout || p.watchdog.alerted.Equal(since) {
+		return
+	}
+	p.watchdog.alerted = since
+
+	restart := w.Restart && !paused && p.info.RestartCount < p.info.MaxRestarts
+	p.publish(types.EventNoOutput, fmt.Sprintf("No output for %s, above the watchdog timeout of %s", silent.Round(time.Second), timeout), map[string]interface{}{
+		"last_output": since,
+		"timeout":     timeout.Seconds(),
+		"restart":     restart,
+	})
+	if !restart {
+		return
+	}
+
+	go p.supervisedRestart(fmt.Sprintf("it wrote no output for %s", silent.Round(time.Second)), func() bool {
+		return !p.lastOutputTime().After(since)
+	})
+}
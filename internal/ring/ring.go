@@ -0,0 +1,110 @@
+package ring
+
+// Buffer keeps up to a fixed number of items, dropping the oldest when a new
+// one is pushed into a full buffer. Its storage grows up to the capacity and
+// is reused from then on. It is not safe for concurrent use.
+type Buffer[T any] struct {
+	items    []T
+	head     int // index of the oldest item
+	n        int
+	capacity int
+}
+
+// New returns an empty buffer of the given capacity, at least one
+func New[T any](capacity int) *Buffer[T] {
+	return &Buffer[T]{capacity: max(capacity, 1)}
+}
+
+// Len returns the number of items
+func (b *Buffer[T]) Len() int {
+	return b.n
+}
+
+// Cap returns the capacity
+func (b *Buffer[T]) Cap() int {
+	return b.capacity
+}
+
+// Push appends an item, dropping the oldest if the buffer is full
+func (b *Buffer[T]) Push(item T) {
+	switch {
+	case b.n < len(b.items):
+		b.items[(b.head+b.n)%len(b.items)] = item
+		b.n++
+	case len(b.items) < b.capacity:
+		if b.head != 0 {
+			b.items = b.appendTo(make([]T, 0, min(2*b.n+1, b.capacity)))
+			b.head = 0
+		}
+		b.items = append(b.items, item)
+		b.n++
+	default:
+		b.items[b.head] = item
+		b.head = (b.head + 1) % len(b.items)
+	}
+}
+
+// At returns the i-th item, oldest first
+func (b *Buffer[T]) At(i int) T {
+	return *b.Ptr(i)
+}
+
+// Ptr returns a pointer to the i-th item, oldest first, which stays valid
+// until the next Push
+func (b *Buffer[T]) Ptr(i int) *T {
+	if i < 0 || i >= b.n {
+		panic("ring: index out of range")
+	}
+	return &b.items[(b.head+i)%len(b.items)]
+}
+
+// Last returns the newest item, or false if the buffer is empty
+func (b *Buffer[T]) Last() (T, bool) {
+	if b.n == 0 {
+		var zero T
+		return zero, false
+	}
+	return b.At(b.n - 1), true
+}
+
+// Drop removes the n oldest items
+func (b *Buffer[T]) Drop(n int) {
+	n = min(n, b.n)
+	var zero T
+	for i := 0; i < n; i++ {
+		// Clear the slot so what the item references can be freed
+		b.items[(b.head+i)%len(b.items)] = zero
+	}
+	b.n -= n
+	b.head = (b.head + n) % max(len(b.items), 1)
+	if b.n == 0 {
+		b.head = 0
+	}
+}
+
+// Slice returns a copy of the items, oldest first
+func (b *Buffer[T]) Slice() []T {
+	return b.appendTo(make([]T, 0, b.n))
+}
+
+// LastN returns a copy of the newest n items, oldest first
+func (b *Buffer[T]) LastN(n int) []T {
+	n = min(max(n, 0), b.n)
+	result := make([]T, 0, n)
+	for i := b.n - n; i < b.n; i++ {
+		result = append(result, b.At(i))
+	}
+	return result
+}
+
+func (b *Buffer[T]) appendTo(dst []T) []T {
+	if b.n == 0 {
+		return dst
+	}
+	end := b.head + b.n
+	if end <= len(b.items) {
+		return append(dst, b.items[b.head:end]...)
+	}
+	dst = append(dst, b.items[b.head:]...)
+	return append(dst, b.items[:end-len(b.items)]...)
+}
@@ -0,0 +1,165 @@
+package ring
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPush(t *testing.T) {
+	b := New[int](3)
+	if b.Len() != 0 || b.Cap() != 3 {
+		t.Fatalf("new buffer has len %d, cap %d", b.Len(), b.Cap())
+	}
+	if _, ok := b.Last(); ok {
+		t.Fatal("empty buffer has a last item")
+	}
+
+	for i := 1; i <= 5; i++ {
+		b.Push(i)
+		if last, ok := b.Last(); !ok || last != i {
+			t.Fatalf("Last() = %d, %v after pushing %d", last, ok, i)
+		}
+	}
+	if b.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", b.Len())
+	}
+	if got := b.Slice(); !reflect.DeepEqual(got, []int{3, 4, 5}) {
+		t.Fatalf("Slice() = %v, want the newest 3", got)
+	}
+	for i, want := range []int{3, 4, 5} {
+		if got := b.At(i); got != want {
+			t.Errorf("At(%d) = %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestMinimumCapacity(t *testing.T) {
+	b := New[string](0)
+	b.Push("a")
+	b.Push("b")
+	if b.Cap() != 1 || !reflect.DeepEqual(b.Slice(), []string{"b"}) {
+		t.Fatalf("got cap %d, items %v", b.Cap(), b.Slice())
+	}
+}
+
+func TestGrowAfterDrop(t *testing.T) {
+	// Dropping before the storage reaches the capacity moves the head, so
+	// growing has to keep the order
+	b := New[int](8)
+	for i := 0; i < 3; i++ {
+		b.Push(i)
+	}
+	b.Drop(2)
+	for i := 3; i < 10; i++ {
+		b.Push(i)
+	}
+	if got := b.Slice(); !reflect.DeepEqual(got, []int{2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Fatalf("Slice() = %v", got)
+	}
+}
+
+func TestDrop(t *testing.T) {
+	b := New[*int](4)
+	for i := 0; i < 6; i++ {
+		v := i
+		b.Push(&v)
+	}
+	b.Drop(3)
+	if b.Len() != 1 || *b.At(0) != 5 {
+		t.Fatalf("after Drop(3) len is %d", b.Len())
+	}
+	for _, p := range b.items {
+		if p != nil && *p != 5 {
+			t.Fatalf("dropped item %d is still referenced", *p)
+		}
+	}
+
+	b.Drop(10)
+	if b.Len() != 0 || len(b.Slice()) != 0 {
+		t.Fatal("Drop past the length left items")
+	}
+	v := 42
+	b.Push(&v)
+	if got := *b.At(0); got != 42 {
+		t.Fatalf("At(0) = %d after reuse", got)
+	}
+
+	New[int](4).Drop(1)
+}
+
+func TestLastN(t *testing.T) {
+	b := New[int](5)
+	for i := 0; i < 7; i++ {
+		b.Push(i)
+	}
+	for n, want := range map[int][]int{
+		-1: {},
+		0:  {},
+		2:  {5, 6},
+		5:  {2, 3, 4, 5, 6},
+		9:  {2, 3, 4, 5, 6},
+	} {
+		if got := b.LastN(n); !reflect.DeepEqual(got, want) {
+			t.Errorf("LastN(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
+
+func TestSliceCopies(t *testing.T) {
+	b := New[int](2)
+	b.Push(1)
+	b.Push(2)
+	s := b.Slice()
+	s[0] = 99
+	if b.At(0) != 1 {
+		t.Fatal("Slice() shares the storage")
+	}
+}
+
+func TestPtr(t *testing.T) {
+	b := New[int](2)
+	b.Push(1)
+	*b.Ptr(0) = 7
+	if b.At(0) != 7 {
+		t.Fatal("Ptr() doesn't point into the buffer")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Ptr() out of range didn't panic")
+		}
+	}()
+	b.Ptr(1)
+}
+
+func BenchmarkPush(b *testing.B) {
+	buf := New[int](1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Push(i)
+	}
+}
+
+func BenchmarkLastN(b *testing.B) {
+	buf := New[int](1024)
+	for i := 0; i < 1500; i++ {
+		buf.Push(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.LastN(100)
+	}
+}
+
+func BenchmarkSlice(b *testing.B) {
+	buf := New[int](1024)
+	for i := 0; i < 1500; i++ {
+		buf.Push(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Slice()
+	}
+}
@@ -0,0 +1,88 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+func apparmorEnabled() bool {
+	data, err := os.ReadFile("/sys/module/apparmor/parameters/enabled")
+	return err == nil && strings.TrimSpace(string(data)) == "Y"
+}
+
+func selinuxEnabled() bool {
+	_, err := os.Stat("/sys/fs/selinux/enforce")
+	return err == nil
+}
+
+// checkSecurityContext checks that the requested LSM is enabled
+func checkSecurityContext(opts Options) error {
+	if opts.AppArmorProfile != "" && opts.SELinuxLabel != "" {
+		return fmt.Errorf("apparmor_profile and selinux_label are mutually exclusive")
+	}
+	if opts.AppArmorProfile != "" && !apparmorEnabled() {
+		return fmt.Errorf("AppArmor is not enabled")
+	}
+	if opts.SELinuxLabel != "" && !selinuxEnabled() {
+		return fmt.Errorf("SELinux is not enabled")
+	}
+	return nil
+}
+
+// attrPath returns the path of an LSM attribute of a task. AppArmor has its
+// own directory since Linux 5.8.
+func attrPath(task, lsm, name string) string {
+	if lsm != "" {
+		path := fmt.Sprintf("/proc/%s/attr/%s/%s", task, lsm, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return fmt.Sprintf("/proc/%s/attr/%s", task, name)
+}
+
+// setExecContext makes the next exec of the calling thread switch to the
+// spec's AppArmor profile or SELinux context
+func setExecContext(spec *Spec) error {
+	task := fmt.Sprintf("self/task/%d", unix.Gettid())
+
+	var path, value string
+	switch {
+	case spec.AppArmorProfile != "":
+		path, value = attrPath(task, "apparmor", "exec"), "exec "+spec.AppArmorProfile
+	case spec.SELinuxLabel != "":
+		path, value = attrPath(task, "", "exec"), spec.SELinuxLabel
+	default:
+		return nil
+	}
+
+	if err := os.WriteFile(path, []byte(value), 0); err != nil {
+		return fmt.Errorf("failed to set security context %q: %w", value, err)
+	}
+	return nil
+}
+
+// SecurityContext returns the AppArmor profile or SELinux context a process
+// runs under, or "" without either
+func SecurityContext(pid int) string {
+	task := fmt.Sprint(pid)
+
+	var path string
+	switch {
+	case apparmorEnabled():
+		path = attrPath(task, "apparmor", "current")
+	case selinuxEnabled():
+		path = attrPath(task, "", "current")
+	default:
+		return ""
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(data), "\x00"))
+}
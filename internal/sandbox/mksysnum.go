@@ -0,0 +1,81 @@
+//go:build ignore
+
+// mksysnum generates the syscall name tables used to compile seccomp
+// profiles from the syscall numbers of golang.org/x/sys/unix.
+//
+//	go run mksysnum.go amd64 arm64
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var sysnum = regexp.MustCompile(`^\s*(SYS_\w+)\s*=\s*\d+`)
+
+// auditArchs are the seccomp_data.arch values of the architectures
+var auditArchs = map[string]string{
+	"amd64": "AUDIT_ARCH_X86_64",
+	"arm64": "AUDIT_ARCH_AARCH64",
+}
+
+func main() {
+	out, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", "golang.org/x/sys").Output()
+	if err != nil {
+		log.Fatalf("failed to locate golang.org/x/sys: %v", err)
+	}
+	dir := filepath.Join(strings.TrimSpace(string(out)), "unix")
+
+	for _, arch := range os.Args[1:] {
+		if err := generate(dir, arch); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func generate(dir, arch string) error {
+	auditArch, ok := auditArchs[arch]
+	if !ok {
+		return fmt.Errorf("unknown audit arch for %s", arch)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "zsysnum_linux_"+arch+".go"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by mksysnum.go %s; DO NOT EDIT.\n\n", arch)
+	b.WriteString("package sandbox\n\nimport \"golang.org/x/sys/unix\"\n\n")
+	fmt.Fprintf(&b, "const auditArch = unix.%s\n\n", auditArch)
+	b.WriteString("var syscallNumbers = map[string]uint32{\n")
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m := sysnum.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(m[1], "SYS_"))
+		fmt.Fprintf(&b, "%q: unix.%s,\n", name, m[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	b.WriteString("}\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return err
+	}
+	return os.WriteFile("sysnum_linux_"+arch+".go", src, 0644)
+}
@@ -0,0 +1,72 @@
+package sandbox
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// dialTimeout bounds connecting to a port inside a network namespace
+const dialTimeout = 5 * time.Second
+
+// setLoopbackUp brings up the loopback interface, which starts down in a new
+// network namespace
+func setLoopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to bring up lo: %w", err)
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("failed to bring up lo: %w", err)
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	if err := unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("failed to bring up lo: %w", err)
+	}
+	return nil
+}
+
+// DialNamespace connects to a TCP address inside the network namespace of
+// a process
+func DialNamespace(pid int, address string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan result, 1)
+
+	go func() {
+		// The thread switches namespace and is never unlocked, so the
+		// runtime discards it when the goroutine exits
+		runtime.LockOSThread()
+		conn, err := dialNamespace(pid, address)
+		ch <- result{conn, err}
+	}()
+
+	r := <-ch
+	return r.conn, r.err
+}
+
+func dialNamespace(pid int, address string) (net.Conn, error) {
+	fd, err := unix.Open(fmt.Sprintf("/proc/%d/ns/net", pid), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open network namespace: %w", err)
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Setns(fd, unix.CLONE_NEWNET); err != nil {
+		return nil, fmt.Errorf("failed to enter network namespace: %w", err)
+	}
+
+	// The socket belongs to the namespace of the thread creating it
+	return net.DialTimeout("tcp", address, dialTimeout)
+}
@@ -0,0 +1,78 @@
+package sandbox
+
+//go:generate go run mksysnum.go amd64 arm64
+
+// EnvSpec is the environment variable passing the spec of a sandboxed
+// process to the exec shim
+const EnvSpec = "GEMSTONE_SANDBOX"
+
+// Options are the restrictions requested for a process
+type Options struct {
+	Keep    []string // capabilities to keep, all others are dropped
+	Drop    []string // capabilities to drop
+	Seccomp string   // path of an OCI seccomp profile
+
+	AppArmorProfile string // AppArmor profile to execute under
+	SELinuxLabel    string // SELinux context to execute under
+
+	IsolateNetwork bool // run in a new network namespace with only loopback
+}
+
+// Empty reports whether no restrictions are requested
+func (o Options) Empty() bool {
+	return len(o.Keep) == 0 && len(o.Drop) == 0 && o.Seccomp == "" &&
+		o.AppArmorProfile == "" && o.SELinuxLabel == "" && !o.IsolateNetwork
+}
+
+// Spec is what the exec shim applies before it executes the command
+type Spec struct {
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+
+	// RestrictCapabilities is set when the bounding set is reduced to the
+	// capabilities in Keep (all if empty) that are not in Drop
+	RestrictCapabilities bool  `json:"restrict_capabilities,omitempty"`
+	Keep                 []int `json:"keep,omitempty"`
+	Drop                 []int `json:"drop,omitempty"`
+	// RaiseAmbient keeps the capabilities in Keep for a non-root user
+	RaiseAmbient bool `json:"raise_ambient,omitempty"`
+
+	AppArmorProfile string `json:"apparmor_profile,omitempty"`
+	SELinuxLabel    string `json:"selinux_label,omitempty"`
+
+	IsolateNetwork bool `json:"isolate_network,omitempty"`
+
+	Credential *Credential   `json:"credential,omitempty"`
+	Filter     []Instruction `json:"filter,omitempty"`
+}
+
+// Credential is the user the shim switches to before it executes the command
+type Credential struct {
+	Uid uint32 `json:"uid"`
+	Gid uint32 `json:"gid"`
+}
+
+// Instruction is a classic BPF instruction of a seccomp filter
+type Instruction struct {
+	Code uint16 `json:"code"`
+	Jt   uint8  `json:"jt"`
+	Jf   uint8  `json:"jf"`
+	K    uint32 `json:"k"`
+}
+
+// retains reports whether a capability stays in the bounding set
+func (s *Spec) retains(c int) bool {
+	if len(s.Keep) > 0 && !contains(s.Keep, c) {
+		return false
+	}
+	return !contains(s.Drop, c)
+}
+
+func contains(caps []int, c int) bool {
+	for _, v := range caps {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
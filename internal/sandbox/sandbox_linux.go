@@ -0,0 +1,158 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// shimPath re-executes the daemon binary as the exec shim
+const shimPath = "/proc/self/exe"
+
+// Prepare resolves capability names, compiles the seccomp profile and checks
+// that the LSM of the security context is enabled
+func Prepare(opts Options) (*Spec, error) {
+	if err := checkSecurityContext(opts); err != nil {
+		return nil, err
+	}
+
+	spec := &Spec{
+		AppArmorProfile: opts.AppArmorProfile,
+		SELinuxLabel:    opts.SELinuxLabel,
+		IsolateNetwork:  opts.IsolateNetwork,
+	}
+
+	if len(opts.Keep) > 0 || len(opts.Drop) > 0 {
+		keep, err := parseCapabilities(opts.Keep)
+		if err != nil {
+			return nil, fmt.Errorf("keep: %w", err)
+		}
+		drop, err := parseCapabilities(opts.Drop)
+		if err != nil {
+			return nil, fmt.Errorf("drop: %w", err)
+		}
+		spec.RestrictCapabilities = true
+		spec.Keep = keep
+		spec.Drop = drop
+		spec.RaiseAmbient = len(keep) > 0
+	}
+
+	if opts.Seccomp != "" {
+		filter, err := loadProfile(opts.Seccomp)
+		if err != nil {
+			return nil, fmt.Errorf("seccomp: %w", err)
+		}
+		spec.Filter = filter
+	}
+
+	return spec, nil
+}
+
+// Wrap makes a command start through the exec shim, which applies the spec
+// and then executes the original command in place. The shim switches to the
+// credential of the command itself so it can keep capabilities.
+func Wrap(cmd *exec.Cmd, spec *Spec) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+
+	spec.Path = cmd.Path
+	spec.Args = cmd.Args
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if attr := cmd.SysProcAttr; attr.Credential != nil {
+		spec.Credential = &Credential{Uid: attr.Credential.Uid, Gid: attr.Credential.Gid}
+		attr.Credential = nil
+	}
+	if spec.IsolateNetwork {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	cmd.Path = shimPath
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, EnvSpec+"="+string(data))
+	return nil
+}
+
+// Init runs the exec shim when the binary was started by Wrap. It must be
+// called first thing in main and doesn't return in the shim.
+func Init() {
+	data, ok := os.LookupEnv(EnvSpec)
+	if !ok {
+		return
+	}
+	os.Unsetenv(EnvSpec)
+
+	var spec Spec
+	if err := json.Unmarshal([]byte(data), &spec); err != nil {
+		fmt.Fprintf(os.Stderr, "gemstone: invalid sandbox spec: %v\n", err)
+		os.Exit(127)
+	}
+
+	if err := run(&spec); err != nil {
+		fmt.Fprintf(os.Stderr, "gemstone: failed to start %s: %v\n", spec.Path, err)
+		os.Exit(127)
+	}
+}
+
+// run applies the spec and executes the command. Credentials and
+// capabilities are per thread, so everything happens on one thread that
+// ends up running the command.
+func run(spec *Spec) error {
+	runtime.LockOSThread()
+
+	// Before capabilities are dropped, as MAC policies may require them
+	if err := setExecContext(spec); err != nil {
+		return err
+	}
+
+	if spec.IsolateNetwork {
+		if err := setLoopbackUp(); err != nil {
+			return err
+		}
+	}
+
+	if spec.RestrictCapabilities {
+		if err := restrictCapabilities(spec); err != nil {
+			return err
+		}
+	} else if spec.Credential != nil {
+		if err := setCredential(spec.Credential); err != nil {
+			return err
+		}
+	}
+
+	if len(spec.Filter) > 0 {
+		if err := loadFilter(spec.Filter); err != nil {
+			return err
+		}
+	}
+
+	return syscall.Exec(spec.Path, spec.Args, os.Environ())
+}
+
+// setCredential switches to a user like exec.Cmd does, dropping
+// supplementary groups
+func setCredential(cred *Credential) error {
+	if err := syscall.Setgroups(nil); err != nil {
+		return fmt.Errorf("failed to set groups: %w", err)
+	}
+	if err := syscall.Setgid(int(cred.Gid)); err != nil {
+		return fmt.Errorf("failed to set gid: %w", err)
+	}
+	if err := syscall.Setuid(int(cred.Uid)); err != nil {
+		return fmt.Errorf("failed to set uid: %w", err)
+	}
+	return nil
+}
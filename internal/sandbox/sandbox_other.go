@@ -0,0 +1,34 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"errors"
+	"net"
+	"os/exec"
+)
+
+var errUnsupported = errors.New("capabilities, seccomp profiles, security contexts and network isolation are only supported on Linux")
+
+// Prepare is only supported on Linux
+func Prepare(opts Options) (*Spec, error) {
+	return nil, errUnsupported
+}
+
+// Wrap is only supported on Linux
+func Wrap(cmd *exec.Cmd, spec *Spec) error {
+	return errUnsupported
+}
+
+// DialNamespace is only supported on Linux
+func DialNamespace(pid int, address string) (net.Conn, error) {
+	return nil, errUnsupported
+}
+
+// Init does nothing outside Linux
+func Init() {}
+
+// SecurityContext returns "" outside Linux
+func SecurityContext(pid int) string {
+	return ""
+}
@@ -0,0 +1,177 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Profile is an OCI seccomp profile, as used by Docker and Podman. Argument
+// filters aren't supported.
+type Profile struct {
+	DefaultAction   string        `json:"defaultAction"`
+	DefaultErrnoRet *uint         `json:"defaultErrnoRet,omitempty"`
+	Syscalls        []SyscallRule `json:"syscalls"`
+}
+
+// SyscallRule applies an action to a set of syscalls
+type SyscallRule struct {
+	Names    []string          `json:"names"`
+	Name     string            `json:"name,omitempty"` // older profiles
+	Action   string            `json:"action"`
+	ErrnoRet *uint             `json:"errnoRet,omitempty"`
+	Args     []json.RawMessage `json:"args,omitempty"`
+}
+
+// BPF opcodes used by seccomp filters
+const (
+	bpfLoadAbs = unix.BPF_LD | unix.BPF_W | unix.BPF_ABS
+	bpfJumpEq  = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+	bpfJumpGe  = unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K
+	bpfReturn  = unix.BPF_RET | unix.BPF_K
+)
+
+// Offsets in struct seccomp_data
+const (
+	offsetNr   = 0
+	offsetArch = 4
+)
+
+// x32SyscallBit marks syscalls of the x32 ABI on amd64
+const x32SyscallBit = 0x40000000
+
+// loadProfile reads a seccomp profile and compiles it to a filter
+func loadProfile(path string) ([]Instruction, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("invalid seccomp profile: %w", err)
+	}
+
+	return compileProfile(&profile)
+}
+
+// compileProfile compiles a profile for the native architecture. The first
+// rule naming a syscall wins.
+func compileProfile(profile *Profile) ([]Instruction, error) {
+	if syscallNumbers == nil {
+		return nil, fmt.Errorf("seccomp profiles are not supported on %s", runtime.GOARCH)
+	}
+
+	defaultAction, err := seccompAction(profile.DefaultAction, profile.DefaultErrnoRet)
+	if err != nil {
+		return nil, fmt.Errorf("defaultAction: %w", err)
+	}
+
+	// Kill processes using another architecture's syscall numbers
+	filter := []Instruction{
+		{Code: bpfLoadAbs, K: offsetArch},
+		{Code: bpfJumpEq, Jt: 1, K: auditArch},
+		{Code: bpfReturn, K: unix.SECCOMP_RET_KILL_PROCESS},
+		{Code: bpfLoadAbs, K: offsetNr},
+	}
+	if runtime.GOARCH == "amd64" {
+		filter = append(filter,
+			Instruction{Code: bpfJumpGe, Jf: 1, K: x32SyscallBit},
+			Instruction{Code: bpfReturn, K: unix.SECCOMP_RET_ERRNO | uint32(unix.ENOSYS)},
+		)
+	}
+
+	seen := make(map[uint32]bool)
+	for i, rule := range profile.Syscalls {
+		if len(rule.Args) > 0 {
+			return nil, fmt.Errorf("syscalls[%d]: argument filters are not supported", i)
+		}
+		action, err := seccompAction(rule.Action, rule.ErrnoRet)
+		if err != nil {
+			return nil, fmt.Errorf("syscalls[%d]: %w", i, err)
+		}
+
+		names := rule.Names
+		if rule.Name != "" {
+			names = append(names, rule.Name)
+		}
+		for _, name := range names {
+			nr, ok := syscallNumbers[name]
+			if !ok {
+				return nil, fmt.Errorf("syscalls[%d]: unknown syscall %q on %s", i, name, runtime.GOARCH)
+			}
+			if seen[nr] {
+				continue
+			}
+			seen[nr] = true
+			if action == defaultAction {
+				continue
+			}
+			filter = append(filter,
+				Instruction{Code: bpfJumpEq, Jf: 1, K: nr},
+				Instruction{Code: bpfReturn, K: action},
+			)
+		}
+	}
+
+	filter = append(filter, Instruction{Code: bpfReturn, K: defaultAction})
+	if len(filter) > unix.BPF_MAXINSNS {
+		return nil, fmt.Errorf("profile compiles to %d instructions, more than %d", len(filter), unix.BPF_MAXINSNS)
+	}
+
+	return filter, nil
+}
+
+// seccompAction returns the filter return value of a profile action
+func seccompAction(action string, errnoRet *uint) (uint32, error) {
+	errno := uint32(unix.EPERM)
+	if errnoRet != nil {
+		errno = uint32(*errnoRet) & unix.SECCOMP_RET_DATA
+	}
+
+	switch action {
+	case "SCMP_ACT_ALLOW":
+		return unix.SECCOMP_RET_ALLOW, nil
+	case "SCMP_ACT_ERRNO":
+		return unix.SECCOMP_RET_ERRNO | errno, nil
+	case "SCMP_ACT_KILL", "SCMP_ACT_KILL_THREAD":
+		return unix.SECCOMP_RET_KILL_THREAD, nil
+	case "SCMP_ACT_KILL_PROCESS":
+		return unix.SECCOMP_RET_KILL_PROCESS, nil
+	case "SCMP_ACT_TRAP":
+		return unix.SECCOMP_RET_TRAP, nil
+	case "SCMP_ACT_TRACE":
+		return unix.SECCOMP_RET_TRACE | errno, nil
+	case "SCMP_ACT_LOG":
+		return unix.SECCOMP_RET_LOG, nil
+	case "":
+		return 0, fmt.Errorf("missing action")
+	default:
+		return 0, fmt.Errorf("unknown action %q", action)
+	}
+}
+
+// loadFilter installs a seccomp filter for the calling thread, which keeps
+// it across exec. no_new_privs is set first, as required without
+// CAP_SYS_ADMIN.
+func loadFilter(filter []Instruction) error {
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+
+	insns := make([]unix.SockFilter, len(filter))
+	for i, in := range filter {
+		insns[i] = unix.SockFilter{Code: in.Code, Jt: in.Jt, Jf: in.Jf, K: in.K}
+	}
+	prog := unix.SockFprog{Len: uint16(len(insns)), Filter: &insns[0]}
+
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+		return fmt.Errorf("failed to load seccomp filter: %w", err)
+	}
+	runtime.KeepAlive(insns)
+	return nil
+}
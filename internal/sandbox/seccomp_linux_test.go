@@ -0,0 +1,218 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// evaluate runs a filter on a syscall the way the kernel does and returns
+// its return value
+func evaluate(t *testing.T, filter []Instruction, arch, nr uint32) uint32 {
+	t.Helper()
+	var acc uint32
+	for pc := 0; pc < len(filter); pc++ {
+		in := filter[pc]
+		switch in.Code {
+		case bpfLoadAbs:
+			switch in.K {
+			case offsetNr:
+				acc = nr
+			case offsetArch:
+				acc = arch
+			default:
+				t.Fatalf("instruction %d loads offset %d", pc, in.K)
+			}
+		case bpfJumpEq, bpfJumpGe:
+			match := acc == in.K
+			if in.Code == bpfJumpGe {
+				match = acc >= in.K
+			}
+			if match {
+				pc += int(in.Jt)
+			} else {
+				pc += int(in.Jf)
+			}
+		case bpfReturn:
+			return in.K
+		default:
+			t.Fatalf("instruction %d has unknown code %#x", pc, in.Code)
+		}
+	}
+	t.Fatal("the filter runs off its end")
+	return 0
+}
+
+func compile(t *testing.T, profile *Profile) []Instruction {
+	t.Helper()
+	if syscallNumbers == nil {
+		t.Skipf("seccomp profiles are not supported on %s", runtime.GOARCH)
+	}
+	filter, err := compileProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filter
+}
+
+func errnoRet(n uint) *uint {
+	return &n
+}
+
+func TestCompileProfileAllowList(t *testing.T) {
+	filter := compile(t, &Profile{
+		DefaultAction:   "SCMP_ACT_ERRNO",
+		DefaultErrnoRet: errnoRet(uint(unix.EACCES)),
+		Syscalls: []SyscallRule{
+			{Names: []string{"read", "write"}, Action: "SCMP_ACT_ALLOW"},
+			{Name: "openat", Action: "SCMP_ACT_ALLOW"},
+		},
+	})
+
+	for name, want := range map[string]uint32{
+		"read":   unix.SECCOMP_RET_ALLOW,
+		"write":  unix.SECCOMP_RET_ALLOW,
+		"openat": unix.SECCOMP_RET_ALLOW,
+		"mount":  unix.SECCOMP_RET_ERRNO | uint32(unix.EACCES),
+		"ptrace": unix.SECCOMP_RET_ERRNO | uint32(unix.EACCES),
+	} {
+		if got := evaluate(t, filter, auditArch, syscallNumbers[name]); got != want {
+			t.Errorf("%s returns %#x, want %#x", name, got, want)
+		}
+	}
+}
+
+func TestCompileProfileDenyList(t *testing.T) {
+	filter := compile(t, &Profile{
+		DefaultAction: "SCMP_ACT_ALLOW",
+		Syscalls: []SyscallRule{
+			{Names: []string{"ptrace"}, Action: "SCMP_ACT_KILL_PROCESS"},
+			{Names: []string{"mount"}, Action: "SCMP_ACT_ERRNO"},
+			// Rules for the default action compile to nothing
+			{Names: []string{"read"}, Action: "SCMP_ACT_ALLOW"},
+		},
+	})
+
+	for name, want := range map[string]uint32{
+		"ptrace": unix.SECCOMP_RET_KILL_PROCESS,
+		"mount":  unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM),
+		"read":   unix.SECCOMP_RET_ALLOW,
+		"write":  unix.SECCOMP_RET_ALLOW,
+	} {
+		if got := evaluate(t, filter, auditArch, syscallNumbers[name]); got != want {
+			t.Errorf("%s returns %#x, want %#x", name, got, want)
+		}
+	}
+	for _, in := range filter {
+		if in.Code == bpfJumpEq && in.K == syscallNumbers["read"] {
+			t.Error("the filter checks read, which takes the default action")
+		}
+	}
+}
+
+func TestCompileProfileFirstRuleWins(t *testing.T) {
+	filter := compile(t, &Profile{
+		DefaultAction: "SCMP_ACT_ALLOW",
+		Syscalls: []SyscallRule{
+			{Names: []string{"mount"}, Action: "SCMP_ACT_LOG"},
+			{Names: []string{"mount"}, Action: "SCMP_ACT_KILL"},
+		},
+	})
+	if got := evaluate(t, filter, auditArch, syscallNumbers["mount"]); got != unix.SECCOMP_RET_LOG {
+		t.Fatalf("mount returns %#x, want the first rule's SCMP_ACT_LOG", got)
+	}
+}
+
+func TestCompileProfileForeignArch(t *testing.T) {
+	filter := compile(t, &Profile{DefaultAction: "SCMP_ACT_ALLOW"})
+	if got := evaluate(t, filter, unix.AUDIT_ARCH_I386, syscallNumbers["read"]); got != unix.SECCOMP_RET_KILL_PROCESS {
+		t.Fatalf("a syscall of another architecture returns %#x, want kill", got)
+	}
+}
+
+func TestCompileProfileX32(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("x32 is an amd64 ABI")
+	}
+	filter := compile(t, &Profile{DefaultAction: "SCMP_ACT_ALLOW"})
+	want := unix.SECCOMP_RET_ERRNO | uint32(unix.ENOSYS)
+	if got := evaluate(t, filter, auditArch, x32SyscallBit|syscallNumbers["read"]); got != want {
+		t.Fatalf("an x32 syscall returns %#x, want ENOSYS", got)
+	}
+}
+
+func TestCompileProfileErrors(t *testing.T) {
+	if syscallNumbers == nil {
+		t.Skipf("seccomp profiles are not supported on %s", runtime.GOARCH)
+	}
+	for _, tc := range []struct {
+		profile Profile
+		want    string
+	}{
+		{Profile{}, "defaultAction: missing action"},
+		{Profile{DefaultAction: "SCMP_ACT_NOPE"}, `unknown action "SCMP_ACT_NOPE"`},
+		{Profile{DefaultAction: "SCMP_ACT_ALLOW", Syscalls: []SyscallRule{{Names: []string{"nosuchcall"}, Action: "SCMP_ACT_ERRNO"}}}, `unknown syscall "nosuchcall"`},
+		{Profile{DefaultAction: "SCMP_ACT_ALLOW", Syscalls: []SyscallRule{{Names: []string{"read"}}}}, "syscalls[0]: missing action"},
+		{Profile{DefaultAction: "SCMP_ACT_ALLOW", Syscalls: []SyscallRule{{Names: []string{"read"}, Action: "SCMP_ACT_ERRNO", Args: []json.RawMessage{[]byte(`{}`)}}}}, "argument filters are not supported"},
+	} {
+		_, err := compileProfile(&tc.profile)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("got %v, want %q", err, tc.want)
+		}
+	}
+}
+
+func TestSeccompAction(t *testing.T) {
+	for _, tc := range []struct {
+		action string
+		errno  *uint
+		want   uint32
+	}{
+		{"SCMP_ACT_ALLOW", nil, unix.SECCOMP_RET_ALLOW},
+		{"SCMP_ACT_ERRNO", nil, unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)},
+		{"SCMP_ACT_ERRNO", errnoRet(38), unix.SECCOMP_RET_ERRNO | 38},
+		{"SCMP_ACT_ERRNO", errnoRet(0x1ffff), unix.SECCOMP_RET_ERRNO | 0xffff},
+		{"SCMP_ACT_KILL", nil, unix.SECCOMP_RET_KILL_THREAD},
+		{"SCMP_ACT_KILL_THREAD", nil, unix.SECCOMP_RET_KILL_THREAD},
+		{"SCMP_ACT_KILL_PROCESS", nil, unix.SECCOMP_RET_KILL_PROCESS},
+		{"SCMP_ACT_TRAP", nil, unix.SECCOMP_RET_TRAP},
+		{"SCMP_ACT_TRACE", errnoRet(7), unix.SECCOMP_RET_TRACE | 7},
+		{"SCMP_ACT_LOG", nil, unix.SECCOMP_RET_LOG},
+	} {
+		got, err := seccompAction(tc.action, tc.errno)
+		if err != nil || got != tc.want {
+			t.Errorf("seccompAction(%s) = %#x, %v, want %#x", tc.action, got, err, tc.want)
+		}
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	if syscallNumbers == nil {
+		t.Skipf("seccomp profiles are not supported on %s", runtime.GOARCH)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "profile.json")
+	os.WriteFile(path, []byte(`{
+		"defaultAction": "SCMP_ACT_ERRNO",
+		"syscalls": [{"names": ["read", "write"], "action": "SCMP_ACT_ALLOW"}]
+	}`), 0644)
+
+	filter, err := loadProfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := evaluate(t, filter, auditArch, syscallNumbers["write"]); got != unix.SECCOMP_RET_ALLOW {
+		t.Fatalf("write returns %#x, want allow", got)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte(`{"defaultAction": `), 0644)
+	if _, err := loadProfile(bad); err == nil || !strings.Contains(err.Error(), "invalid seccomp profile") {
+		t.Fatalf("got %v, want an invalid profile", err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build linux && !amd64 && !arm64
+
+package sandbox
+
+// Seccomp profiles can't be compiled without a syscall table
+const auditArch = 0
+
+var syscallNumbers map[string]uint32
@@ -0,0 +1,130 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+)
+
+const (
+	// DefaultCacheTTL is how long resolved secrets are reused
+	DefaultCacheTTL = time.Minute
+	// requestTimeout bounds a request to a secret store
+	requestTimeout = 10 * time.Second
+)
+
+// Prefixes of secret references
+const (
+	vaultPrefix  = "vault://"
+	awsSSMPrefix = "awsssm://"
+)
+
+// IsReference reports whether an environment value refers to a secret
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, vaultPrefix) || strings.HasPrefix(value, awsSSMPrefix)
+}
+
+// Validate checks the syntax of a secret reference
+func Validate(value string) error {
+	switch {
+	case strings.HasPrefix(value, vaultPrefix):
+		path, _, _ := strings.Cut(strings.TrimPrefix(value, vaultPrefix), "#")
+		if strings.Trim(path, "/") == "" {
+			return fmt.Errorf("%s: missing path", value)
+		}
+	case strings.HasPrefix(value, awsSSMPrefix):
+		if strings.TrimPrefix(value, awsSSMPrefix) == "" {
+			return fmt.Errorf("%s: missing parameter name", value)
+		}
+	}
+	return nil
+}
+
+type cached struct {
+	value   string
+	expires time.Time
+}
+
+// Resolver resolves secret references in environment values at process
+// start. Values are kept in memory only, for the cache TTL.
+type Resolver struct {
+	ttl    time.Duration
+	client *http.Client
+	vault  *vault
+	ssm    *ssm
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+// NewResolver creates a resolver for the configured secret stores
+func NewResolver(cfg config.SecretsConfig) *Resolver {
+	ttl := DefaultCacheTTL
+	if cfg.CacheTTL != "" {
+		if d, err := time.ParseDuration(cfg.CacheTTL); err == nil && d >= 0 {
+			ttl = d
+		} else {
+			fmt.Printf("Warning: invalid secrets cache_ttl %q, using %s\n", cfg.CacheTTL, DefaultCacheTTL)
+		}
+	}
+
+	client := &http.Client{Timeout: requestTimeout}
+	return &Resolver{
+		ttl:    ttl,
+		client: client,
+		vault:  newVault(cfg.Vault, client),
+		ssm:    newSSM(cfg.AWS, client),
+		cache:  make(map[string]cached),
+	}
+}
+
+// Resolve returns the secret a reference points to. Other values are
+// returned unchanged.
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+
+	r.mu.Lock()
+	c, ok := r.cache[value]
+	r.mu.Unlock()
+	if ok && time.Now().Before(c.expires) {
+		return c.value, nil
+	}
+
+	var secret string
+	var err error
+	if strings.HasPrefix(value, vaultPrefix) {
+		secret, err = r.vault.get(ctx, strings.TrimPrefix(value, vaultPrefix))
+	} else {
+		secret, err = r.ssm.get(ctx, strings.TrimPrefix(value, awsSSMPrefix))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if r.ttl > 0 {
+		r.mu.Lock()
+		r.cache[value] = cached{value: secret, expires: time.Now().Add(r.ttl)}
+		r.mu.Unlock()
+	}
+	return secret, nil
+}
+
+// ResolveEnv returns env with its secret references resolved
+func (r *Resolver) ResolveEnv(ctx context.Context, env map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(env))
+	for k, v := range env {
+		secret, err := r.Resolve(ctx, v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", k, err)
+		}
+		resolved[k] = secret
+	}
+	return resolved, nil
+}
@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/awsauth"
+	"github.com/PrismManager/gemstone/internal/config"
+)
+
+// ssm reads parameters from AWS Systems Manager Parameter Store
+type ssm struct {
+	region   string
+	endpoint string
+	client   *http.Client
+	creds    *awsauth.Provider
+}
+
+func newSSM(cfg config.AWSConfig, client *http.Client) *ssm {
+	s := &ssm{region: cfg.Region, endpoint: cfg.Endpoint, client: client, creds: awsauth.NewProvider(client)}
+	if s.region == "" {
+		s.region = awsauth.Region()
+	}
+	return s
+}
+
+// get reads a parameter, decrypting SecureStrings. Names with a slash are
+// hierarchical, "awsssm://prod/db" reads /prod/db.
+func (s *ssm) get(ctx context.Context, name string) (string, error) {
+	if strings.Contains(name, "/") && !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	if s.region == "" {
+		return "", fmt.Errorf("aws region is not configured (secrets.aws.region or AWS_REGION)")
+	}
+
+	creds, err := s.creds.Get(ctx)
+	if err != nil {
+		return "", fmt.Errorf("aws: %w", err)
+	}
+
+	endpoint := s.endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://ssm.%s.amazonaws.com", s.region)
+	}
+	body, _ := json.Marshal(map[string]interface{}{"Name": name, "WithDecryption": true})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonSSM.GetParameter")
+	awsauth.Sign(req, awsauth.PayloadHash(body), creds, s.region, "ssm", time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("aws ssm: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("aws ssm: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Type != "" {
+			return "", fmt.Errorf("aws ssm: %s: %s %s", name, e.Type, e.Message)
+		}
+		return "", fmt.Errorf("aws ssm: %s: %s", name, resp.Status)
+	}
+
+	var result struct {
+		Parameter struct {
+			Value string `json:"Value"`
+		} `json:"Parameter"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("aws ssm: invalid response: %w", err)
+	}
+	return result.Parameter.Value, nil
+}
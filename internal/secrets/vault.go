@@ -0,0 +1,136 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/PrismManager/gemstone/internal/config"
+)
+
+// vault reads secrets from the HTTP API of HashiCorp Vault
+type vault struct {
+	address   string
+	token     string
+	tokenFile string
+	namespace string
+	client    *http.Client
+}
+
+func newVault(cfg config.VaultConfig, client *http.Client) *vault {
+	v := &vault{
+		address:   cfg.Address,
+		token:     cfg.Token,
+		tokenFile: cfg.TokenFile,
+		namespace: cfg.Namespace,
+		client:    client,
+	}
+	if v.address == "" {
+		v.address = os.Getenv("VAULT_ADDR")
+	}
+	if v.token == "" && v.tokenFile == "" {
+		v.token = os.Getenv("VAULT_TOKEN")
+	}
+	if v.namespace == "" {
+		v.namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	return v
+}
+
+// get reads "path#key" from Vault. Without a key the secret must hold a
+// single value.
+func (v *vault) get(ctx context.Context, ref string) (string, error) {
+	path, key, _ := strings.Cut(ref, "#")
+	if v.address == "" {
+		return "", fmt.Errorf("vault address is not configured (secrets.vault.address or VAULT_ADDR)")
+	}
+
+	token := v.token
+	if v.tokenFile != "" {
+		// Re-read on every request, agents rotate the token in place
+		data, err := os.ReadFile(v.tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read vault token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	url := strings.TrimRight(v.address, "/") + "/v1/" + strings.Trim(path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(body, &e) == nil && len(e.Errors) > 0 {
+			return "", fmt.Errorf("vault: %s: %s", path, strings.Join(e.Errors, "; "))
+		}
+		return "", fmt.Errorf("vault: %s: %s", path, resp.Status)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("vault: invalid response: %w", err)
+	}
+
+	// KV version 2 nests the values under data.data next to metadata
+	values := secret.Data
+	if nested, ok := values["data"].(map[string]interface{}); ok {
+		if _, ok := values["metadata"]; ok {
+			values = nested
+		}
+	}
+
+	if key == "" {
+		if len(values) != 1 {
+			keys := make([]string, 0, len(values))
+			for k := range values {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return "", fmt.Errorf("vault: %s holds %d keys (%s), select one with #key", path, len(keys), strings.Join(keys, ", "))
+		}
+		for k := range values {
+			key = k
+		}
+	}
+
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("vault: %s has no key %s", path, key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
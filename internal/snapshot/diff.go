@@ -0,0 +1,138 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/PrismManager/gemstone/internal/config"
+	"github.com/PrismManager/gemstone/internal/types"
+)
+
+// Load reads a snapshot saved with gem snapshot save
+func Load(path string) (*types.Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s types.Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s is not a snapshot: %w", path, err)
+	}
+	return &s, nil
+}
+
+// Diff compares snapshot a to snapshot b. Fields are compared by their JSON
+// names, the definition fields next to status and revision; fields named in
+// ignore are skipped.
+func Diff(a, b *types.Snapshot, ignore []string) *types.SnapshotDiff {
+	skip := make(map[string]bool, len(ignore))
+	for _, f := range ignore {
+		skip[f] = true
+	}
+
+	diff := &types.SnapshotDiff{
+		A:       types.SnapshotOrigin{Host: a.Host, TakenAt: a.TakenAt},
+		B:       types.SnapshotOrigin{Host: b.Host, TakenAt: b.TakenAt},
+		Added:   []types.ProcessDiff{},
+		Removed: []types.ProcessDiff{},
+		Changed: []types.ProcessDiff{},
+	}
+
+	before := byKey(a)
+	after := byKey(b)
+	for _, k := range sortedKeys(before, after) {
+		old, inA := before[k]
+		cur, inB := after[k]
+		pd := types.ProcessDiff{Name: k.name, Namespace: k.namespace}
+
+		switch {
+		case !inA:
+			diff.Added = append(diff.Added, pd)
+		case !inB:
+			diff.Removed = append(diff.Removed, pd)
+		default:
+			pd.Fields = fieldChanges(fields(old), fields(cur), skip)
+			if len(pd.Fields) > 0 {
+				diff.Changed = append(diff.Changed, pd)
+			} else {
+				diff.Unchanged++
+			}
+		}
+	}
+	return diff
+}
+
+type key struct {
+	namespace string
+	name      string
+}
+
+func byKey(s *types.Snapshot) map[key]types.SnapshotProcess {
+	procs := make(map[key]types.SnapshotProcess, len(s.Processes))
+	for _, p := range s.Processes {
+		namespace := p.Definition.Namespace
+		if namespace == "" {
+			namespace = config.DefaultNamespace
+		}
+		procs[key{namespace: namespace, name: p.Definition.Name}] = p
+	}
+	return procs
+}
+
+func sortedKeys(maps ...map[key]types.SnapshotProcess) []key {
+	seen := make(map[key]bool)
+	var keys []key
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].namespace != keys[j].namespace {
+			return keys[i].namespace < keys[j].namespace
+		}
+		return keys[i].name < keys[j].name
+	})
+	return keys
+}
+
+// fields returns the compared fields of a process by JSON name. The ID
+// differs between hosts and after every recreate, so it is left out.
+func fields(p types.SnapshotProcess) map[string]interface{} {
+	data, _ := json.Marshal(p.Definition)
+	var f map[string]interface{}
+	_ = json.Unmarshal(data, &f)
+	f["status"] = string(p.Status)
+	if p.Revision != "" {
+		f["revision"] = p.Revision
+	}
+	return f
+}
+
+func fieldChanges(old, cur map[string]interface{}, skip map[string]bool) []types.FieldChange {
+	names := make([]string, 0, len(old)+len(cur))
+	for name := range old {
+		names = append(names, name)
+	}
+	for name := range cur {
+		if _, ok := old[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []types.FieldChange
+	for _, name := range names {
+		if skip[name] || reflect.DeepEqual(old[name], cur[name]) {
+			continue
+		}
+		changes = append(changes, types.FieldChange{Field: name, Old: old[name], New: cur[name]})
+	}
+	return changes
+}
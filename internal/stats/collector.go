@@ -1,6 +1,8 @@
 package stats
 
 import (
+	"os"
+	"runtime"
 	"sync"
 	"time"
 
@@ -9,30 +11,50 @@ import (
 	"github.com/shirou/gopsutil/v3/host"
 	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
+	psprocess "github.com/shirou/gopsutil/v3/process"
 
+	"github.com/PrismManager/gemstone/internal/logger"
 	"github.com/PrismManager/gemstone/internal/process"
+	"github.com/PrismManager/gemstone/internal/ring"
 	"github.com/PrismManager/gemstone/internal/types"
 )
 
+// defaultSystemHistory is the number of system stats samples kept when the
+// config sets none
+const defaultSystemHistory = 1000
+
 // Collector collects system and process statistics
 type Collector struct {
 	mu          sync.RWMutex
 	manager     *process.Manager
-	systemStats []types.SystemStats
-	maxHistory  int
+	systemStats *ring.Buffer[types.SystemStats]
 	interval    time.Duration
 	stopChan    chan struct{}
 	running     bool
+	self        *psprocess.Process
 }
 
-// NewCollector creates a new stats collector
-func NewCollector(manager *process.Manager) *Collector {
-	return &Collector{
-		manager:    manager,
-		maxHistory: 1000,
-		interval:   10 * time.Second,
-		stopChan:   make(chan struct{}),
+// NewCollector creates a new stats collector keeping the last history
+// system stats samples
+func NewCollector(manager *process.Manager, history int) *Collector {
+	if history <= 0 {
+		history = defaultSystemHistory
+	}
+
+	c := &Collector{
+		manager:     manager,
+		systemStats: ring.New[types.SystemStats](history),
+		interval:    10 * time.Second,
+		stopChan:    make(chan struct{}),
 	}
+
+	// Keep a handle on the daemon process so CPU usage is measured
+	// between calls rather than since the daemon started
+	if self, err := psprocess.NewProcess(int32(os.Getpid())); err == nil {
+		c.self = self
+	}
+
+	return c
 }
 
 // Start starts the stats collector
@@ -83,10 +105,7 @@ func (c *Collector) collect() {
 	sysStats := c.collectSystemStats()
 
 	c.mu.Lock()
-	c.systemStats = append(c.systemStats, sysStats)
-	if len(c.systemStats) > c.maxHistory {
-		c.systemStats = c.systemStats[len(c.systemStats)-c.maxHistory:]
-	}
+	c.systemStats.Push(sysStats)
 	c.mu.Unlock()
 
 	// Collect process stats
@@ -135,19 +154,60 @@ func (c *Collector) GetCurrentSystemStats() types.SystemStats {
 	return c.collectSystemStats()
 }
 
+// GetDaemonStats returns resource usage of the daemon itself
+func (c *Collector) GetDaemonStats() types.DaemonStats {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	stats := types.DaemonStats{
+		PID:           os.Getpid(),
+		Goroutines:    runtime.NumGoroutine(),
+		HeapAlloc:     memStats.HeapAlloc,
+		HeapSys:       memStats.HeapSys,
+		NumGC:         memStats.NumGC,
+		GCPauseTotal:  memStats.PauseTotalNs,
+		GCCPUFraction: memStats.GCCPUFraction,
+		GOMAXPROCS:    runtime.GOMAXPROCS(0),
+		OpenLogFiles:  logger.OpenFiles(),
+		Timestamp:     time.Now(),
+	}
+	if memStats.LastGC > 0 {
+		stats.LastGC = time.Unix(0, int64(memStats.LastGC))
+	}
+
+	if c.self == nil {
+		return stats
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cpuPercent, err := c.self.Percent(0); err == nil {
+		stats.CPU = cpuPercent
+	}
+	if memInfo, err := c.self.MemoryInfo(); err == nil && memInfo != nil {
+		stats.Memory = memInfo.RSS
+	}
+	if fds, err := c.self.NumFDs(); err == nil {
+		stats.NumFDs = fds
+	}
+	if threads, err := c.self.NumThreads(); err == nil {
+		stats.NumThreads = threads
+	}
+	if created, err := c.self.CreateTime(); err == nil {
+		stats.Uptime = int64(time.Since(time.UnixMilli(created)).Seconds())
+	}
+
+	return stats
+}
+
 // GetSystemStatsHistory returns historical system stats
 func (c *Collector) GetSystemStatsHistory(limit int) []types.SystemStats {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if limit <= 0 || limit > len(c.systemStats) {
-		result := make([]types.SystemStats, len(c.systemStats))
-		copy(result, c.systemStats)
-		return result
+	if limit <= 0 {
+		return c.systemStats.Slice()
 	}
-
-	start := len(c.systemStats) - limit
-	result := make([]types.SystemStats, limit)
-	copy(result, c.systemStats[start:])
-	return result
+	return c.systemStats.LastN(limit)
 }
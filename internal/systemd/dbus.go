@@ -0,0 +1,423 @@
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Just enough of the D-Bus wire protocol to call methods of systemd: the
+// EXTERNAL authentication, little-endian method calls and reading their
+// replies and errors
+
+// Message types
+const (
+	msgMethodCall   = 1
+	msgMethodReturn = 2
+	msgError        = 3
+)
+
+// Header fields
+const (
+	fieldPath        = 1
+	fieldInterface   = 2
+	fieldMember      = 3
+	fieldErrorName   = 4
+	fieldReplySerial = 5
+	fieldDestination = 6
+	fieldSignature   = 8
+)
+
+// maxMessageSize is the largest message the D-Bus specification allows
+const maxMessageSize = 128 << 20
+
+// callTimeout bounds a method call including connecting
+const callTimeout = 10 * time.Second
+
+// BusError is an error reply of a method call
+type BusError struct {
+	Name    string
+	Message string
+}
+
+func (e *BusError) Error() string {
+	if e.Message == "" {
+		return e.Name
+	}
+	return e.Name + ": " + e.Message
+}
+
+// conn is a connection to the system bus, or directly to systemd
+type conn struct {
+	c      net.Conn
+	r      *bufio.Reader
+	serial uint32
+}
+
+// dial connects to the system bus and says hello. Without a bus daemon it
+// falls back to the private socket of systemd, which needs no hello.
+func dial() (*conn, error) {
+	path := "/run/dbus/system_bus_socket"
+	if addr := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS"); addr != "" {
+		p, err := unixPath(addr)
+		if err != nil {
+			return nil, err
+		}
+		path = p
+	}
+
+	c, err := dialPath(path)
+	if err == nil {
+		if _, err = c.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", "", nil); err != nil {
+			c.close()
+			return nil, fmt.Errorf("hello: %w", err)
+		}
+		return c, nil
+	}
+
+	private, perr := dialPath("/run/systemd/private")
+	if perr != nil {
+		return nil, err
+	}
+	return private, nil
+}
+
+// unixPath returns the socket path of a unix:path= bus address
+func unixPath(addr string) (string, error) {
+	for _, a := range strings.Split(addr, ";") {
+		transport, params, ok := strings.Cut(a, ":")
+		if !ok || transport != "unix" {
+			continue
+		}
+		for _, kv := range strings.Split(params, ",") {
+			if k, v, ok := strings.Cut(kv, "="); ok && k == "path" {
+				return v, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unsupported bus address %q", addr)
+}
+
+func dialPath(path string) (*conn, error) {
+	nc, err := net.DialTimeout("unix", path, callTimeout)
+	if err != nil {
+		return nil, err
+	}
+	_ = nc.SetDeadline(time.Now().Add(callTimeout))
+
+	c := &conn{c: nc, r: bufio.NewReader(nc)}
+	if err := c.auth(); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// auth authenticates as the user of the daemon process, which the bus
+// checks against the credentials of the socket
+func (c *conn) auth() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := io.WriteString(c.c, "\x00AUTH EXTERNAL "+uid+"\r\n"); err != nil {
+		return err
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("authentication: %w", err)
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("authentication rejected: %s", strings.TrimSpace(line))
+	}
+	_, err = io.WriteString(c.c, "BEGIN\r\n")
+	return err
+}
+
+func (c *conn) close() error {
+	return c.c.Close()
+}
+
+// call invokes a method and waits for its reply, returning the body. The
+// body of the call is encoded per signature already.
+func (c *conn) call(dest, path, iface, member, signature string, body []byte) ([]byte, error) {
+	c.serial++
+	serial := c.serial
+
+	var e encoder
+	e.byte('l')
+	e.byte(msgMethodCall)
+	e.byte(0)
+	e.byte(1)
+	e.uint32(uint32(len(body)))
+	e.uint32(serial)
+
+	fields := e.arrayStart(8)
+	e.field(fieldPath, "o", path)
+	e.field(fieldInterface, "s", iface)
+	e.field(fieldMember, "s", member)
+	if dest != "" {
+		e.field(fieldDestination, "s", dest)
+	}
+	if signature != "" {
+		e.align(8)
+		e.byte(fieldSignature)
+		e.signature("g")
+		e.signature(signature)
+	}
+	e.arrayEnd(fields)
+	e.align(8)
+	e.buf.Write(body)
+
+	if _, err := c.c.Write(e.buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	// Skip signals such as NameAcquired until the reply arrives
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if msg.replySerial != serial {
+			continue
+		}
+		switch msg.typ {
+		case msgMethodReturn:
+			return msg.body, nil
+		case msgError:
+			be := &BusError{Name: msg.errorName}
+			if strings.HasPrefix(msg.signature, "s") {
+				d := decoder{data: msg.body, order: msg.order}
+				be.Message, _ = d.string()
+			}
+			return nil, be
+		}
+	}
+}
+
+type message struct {
+	typ         byte
+	order       binary.ByteOrder
+	replySerial uint32
+	errorName   string
+	signature   string
+	body        []byte
+}
+
+// read reads the next message from the connection
+func (c *conn) read() (*message, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(c.r, fixed); err != nil {
+		return nil, err
+	}
+
+	msg := &message{typ: fixed[1]}
+	switch fixed[0] {
+	case 'l':
+		msg.order = binary.LittleEndian
+	case 'B':
+		msg.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid message endianness %q", fixed[0])
+	}
+
+	bodyLen := msg.order.Uint32(fixed[4:])
+	fieldsLen := msg.order.Uint32(fixed[12:])
+	headerLen := 16 + int(fieldsLen)
+	padded := (headerLen + 7) &^ 7
+	if uint64(padded)+uint64(bodyLen) > maxMessageSize {
+		return nil, fmt.Errorf("message too large")
+	}
+
+	rest := make([]byte, padded-16+int(bodyLen))
+	if _, err := io.ReadFull(c.r, rest); err != nil {
+		return nil, err
+	}
+	data := append(fixed, rest...)
+	msg.body = data[padded:]
+
+	// Offsets are relative to the start of the message for alignment
+	d := decoder{data: data[:headerLen], pos: 16, order: msg.order}
+	for d.pos < headerLen {
+		d.align(8)
+		if d.pos >= headerLen {
+			break
+		}
+		code, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		sig, err := d.signature()
+		if err != nil {
+			return nil, err
+		}
+
+		switch sig {
+		case "s", "o":
+			v, err := d.string()
+			if err != nil {
+				return nil, err
+			}
+			if code == fieldErrorName {
+				msg.errorName = v
+			}
+		case "g":
+			v, err := d.signature()
+			if err != nil {
+				return nil, err
+			}
+			if code == fieldSignature {
+				msg.signature = v
+			}
+		case "u":
+			v, err := d.uint32()
+			if err != nil {
+				return nil, err
+			}
+			if code == fieldReplySerial {
+				msg.replySerial = v
+			}
+		default:
+			return nil, fmt.Errorf("unexpected header field type %q", sig)
+		}
+	}
+	return msg, nil
+}
+
+// encoder writes D-Bus values in little-endian order
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) align(n int) {
+	for e.buf.Len()%n != 0 {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *encoder) byte(b byte) {
+	e.buf.WriteByte(b)
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.align(4)
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.uint32(1)
+	} else {
+		e.uint32(0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf.WriteString(s)
+	e.buf.WriteByte(0)
+}
+
+func (e *encoder) signature(s string) {
+	e.buf.WriteByte(byte(len(s)))
+	e.buf.WriteString(s)
+	e.buf.WriteByte(0)
+}
+
+// array is an array being written
+type array struct {
+	lenPos int
+	start  int
+}
+
+// arrayStart writes a placeholder for the length of an array whose elements
+// align to elem
+func (e *encoder) arrayStart(elem int) array {
+	e.align(4)
+	a := array{lenPos: e.buf.Len()}
+	e.uint32(0)
+	e.align(elem)
+	a.start = e.buf.Len()
+	return a
+}
+
+// arrayEnd fills in the length of the array, which excludes the padding
+// before its first element
+func (e *encoder) arrayEnd(a array) {
+	binary.LittleEndian.PutUint32(e.buf.Bytes()[a.lenPos:], uint32(e.buf.Len()-a.start))
+}
+
+// field writes a header field with a string-like value
+func (e *encoder) field(code byte, sig, value string) {
+	e.align(8)
+	e.byte(code)
+	e.signature(sig)
+	e.string(value)
+}
+
+// decoder reads D-Bus values
+type decoder struct {
+	data  []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+var errShort = errors.New("message too short")
+
+func (d *decoder) align(n int) {
+	d.pos = (d.pos + n - 1) &^ (n - 1)
+}
+
+func (d *decoder) byte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, errShort
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	d.align(4)
+	if d.pos+4 > len(d.data) {
+		return 0, errShort
+	}
+	v := d.order.Uint32(d.data[d.pos:])
+	d.pos += 4
+	return v, nil
+}
+
+func (d *decoder) string() (string, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return "", err
+	}
+	if d.pos+int(n)+1 > len(d.data) {
+		return "", errShort
+	}
+	s := string(d.data[d.pos : d.pos+int(n)])
+	d.pos += int(n) + 1
+	return s, nil
+}
+
+func (d *decoder) signature() (string, error) {
+	n, err := d.byte()
+	if err != nil {
+		return "", err
+	}
+	if d.pos+int(n)+1 > len(d.data) {
+		return "", errShort
+	}
+	s := string(d.data[d.pos : d.pos+int(n)])
+	d.pos += int(n) + 1
+	return s, nil
+}
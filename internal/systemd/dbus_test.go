@@ -0,0 +1,359 @@
+package systemd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// busCall is a method call received by the fake bus
+type busCall struct {
+	serial uint32
+	fields map[byte]string
+	body   []byte
+}
+
+// fakeBus serves a unix socket like the system bus. handle answers each
+// method call with a reply body, or with a BusError.
+type fakeBus struct {
+	t      *testing.T
+	path   string
+	authOK bool
+	handle func(call *busCall) ([]byte, error)
+	calls  chan *busCall
+}
+
+func newFakeBus(t *testing.T, handle func(call *busCall) ([]byte, error)) *fakeBus {
+	t.Helper()
+	b := &fakeBus{
+		t:      t,
+		path:   filepath.Join(t.TempDir(), "bus.sock"),
+		authOK: true,
+		handle: handle,
+		calls:  make(chan *busCall, 16),
+	}
+	l, err := net.Listen("unix", b.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(c)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBus) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return
+	}
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if line != "\x00AUTH EXTERNAL "+uid+"\r\n" || !b.authOK {
+		io.WriteString(c, "REJECTED EXTERNAL\r\n")
+		return
+	}
+	io.WriteString(c, "OK 0123456789abcdef\r\n")
+	if line, err := r.ReadString('\n'); err != nil || line != "BEGIN\r\n" {
+		return
+	}
+
+	var serial uint32
+	for {
+		call, err := readCall(r)
+		if err != nil {
+			return
+		}
+		b.calls <- call
+
+		// A signal first, which the client must skip
+		serial++
+		c.Write(busMessage(4, serial, func(e *encoder) {
+			e.field(fieldPath, "o", "/org/freedesktop/DBus")
+			e.field(fieldMember, "s", "NameAcquired")
+		}, nil))
+
+		body, err := b.handle(call)
+		serial++
+		var be *BusError
+		if errors.As(err, &be) {
+			var msg encoder
+			msg.string(be.Message)
+			c.Write(busMessage(msgError, serial, func(e *encoder) {
+				e.field(fieldErrorName, "s", be.Name)
+				replySerial(e, call.serial)
+				signature(e, "s")
+			}, msg.buf.Bytes()))
+			continue
+		}
+		c.Write(busMessage(msgMethodReturn, serial, func(e *encoder) {
+			replySerial(e, call.serial)
+			if len(body) > 0 {
+				signature(e, "s")
+			}
+		}, body))
+	}
+}
+
+func replySerial(e *encoder, serial uint32) {
+	e.align(8)
+	e.byte(fieldReplySerial)
+	e.signature("u")
+	e.uint32(serial)
+}
+
+func signature(e *encoder, sig string) {
+	e.align(8)
+	e.byte(fieldSignature)
+	e.signature("g")
+	e.signature(sig)
+}
+
+// busMessage encodes a little-endian message
+func busMessage(typ byte, serial uint32, fields func(e *encoder), body []byte) []byte {
+	var e encoder
+	e.byte('l')
+	e.byte(typ)
+	e.byte(0)
+	e.byte(1)
+	e.uint32(uint32(len(body)))
+	e.uint32(serial)
+	a := e.arrayStart(8)
+	fields(&e)
+	e.arrayEnd(a)
+	e.align(8)
+	e.buf.Write(body)
+	return e.buf.Bytes()
+}
+
+// readCall reads a method call with its string header fields
+func readCall(r io.Reader) (*busCall, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+	bodyLen := binary.LittleEndian.Uint32(fixed[4:])
+	headerLen := 16 + int(binary.LittleEndian.Uint32(fixed[12:]))
+	padded := (headerLen + 7) &^ 7
+	rest := make([]byte, padded-16+int(bodyLen))
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, err
+	}
+	data := append(fixed, rest...)
+
+	call := &busCall{
+		serial: binary.LittleEndian.Uint32(fixed[8:]),
+		fields: make(map[byte]string),
+		body:   data[padded:],
+	}
+	d := decoder{data: data[:headerLen], pos: 16, order: binary.LittleEndian}
+	for d.pos < headerLen {
+		d.align(8)
+		code, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		sig, err := d.signature()
+		if err != nil {
+			return nil, err
+		}
+		var v string
+		if sig == "g" {
+			v, err = d.signature()
+		} else {
+			v, err = d.string()
+		}
+		if err != nil {
+			return nil, err
+		}
+		call.fields[code] = v
+	}
+	return call, nil
+}
+
+func TestUnixPath(t *testing.T) {
+	for addr, want := range map[string]string{
+		"unix:path=/run/dbus/system_bus_socket":            "/run/dbus/system_bus_socket",
+		"unix:guid=abc,path=/tmp/bus":                      "/tmp/bus",
+		"tcp:host=localhost,port=1;unix:path=/var/run/bus": "/var/run/bus",
+	} {
+		got, err := unixPath(addr)
+		if err != nil || got != want {
+			t.Errorf("unixPath(%q) = %q, %v, want %q", addr, got, err, want)
+		}
+	}
+	for _, addr := range []string{"", "tcp:host=localhost,port=1", "unix:abstract=/tmp/bus"} {
+		if _, err := unixPath(addr); err == nil {
+			t.Errorf("unixPath(%q) succeeded", addr)
+		}
+	}
+}
+
+func TestRestartUnit(t *testing.T) {
+	bus := newFakeBus(t, func(call *busCall) ([]byte, error) {
+		var e encoder
+		if call.fields[fieldMember] == "Hello" {
+			e.string(":1.42")
+		} else {
+			e.string("/org/freedesktop/systemd1/job/7")
+		}
+		return e.buf.Bytes(), nil
+	})
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", "unix:path="+bus.path)
+
+	if err := RestartUnit("web.service"); err != nil {
+		t.Fatal(err)
+	}
+
+	hello := <-bus.calls
+	if hello.fields[fieldMember] != "Hello" || hello.fields[fieldDestination] != "org.freedesktop.DBus" {
+		t.Fatalf("first call is %v, want Hello", hello.fields)
+	}
+
+	call := <-bus.calls
+	for code, want := range map[byte]string{
+		fieldPath:        "/org/freedesktop/systemd1",
+		fieldInterface:   "org.freedesktop.systemd1.Manager",
+		fieldMember:      "RestartUnit",
+		fieldDestination: "org.freedesktop.systemd1",
+		fieldSignature:   "ss",
+	} {
+		if got := call.fields[code]; got != want {
+			t.Errorf("header field %d = %q, want %q", code, got, want)
+		}
+	}
+	if call.serial <= hello.serial {
+		t.Errorf("serial %d doesn't follow %d", call.serial, hello.serial)
+	}
+
+	d := decoder{data: call.body, order: binary.LittleEndian}
+	unit, _ := d.string()
+	mode, _ := d.string()
+	if unit != "web.service" || mode != "replace" {
+		t.Errorf("body is %q %q, want web.service replace", unit, mode)
+	}
+}
+
+func TestRestartUnitError(t *testing.T) {
+	bus := newFakeBus(t, func(call *busCall) ([]byte, error) {
+		if call.fields[fieldMember] == "Hello" {
+			return nil, nil
+		}
+		return nil, &BusError{Name: "org.freedesktop.systemd1.NoSuchUnit", Message: "Unit web.service not found."}
+	})
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", "unix:path="+bus.path)
+
+	err := RestartUnit("web.service")
+	var be *BusError
+	if !errors.As(err, &be) {
+		t.Fatalf("got %v, want a BusError", err)
+	}
+	if be.Name != "org.freedesktop.systemd1.NoSuchUnit" || be.Message != "Unit web.service not found." {
+		t.Fatalf("got %+v", be)
+	}
+	if !strings.Contains(err.Error(), "failed to restart web.service") {
+		t.Fatalf("error %q doesn't name the unit", err)
+	}
+}
+
+func TestAuthRejected(t *testing.T) {
+	bus := newFakeBus(t, nil)
+	bus.authOK = false
+
+	if _, err := dialPath(bus.path); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Fatalf("got %v, want the authentication rejected", err)
+	}
+}
+
+func TestReadTooLarge(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		fixed := []byte{'l', msgMethodReturn, 0, 1, 0, 0, 0, 0xff, 1, 0, 0, 0, 0, 0, 0, 0}
+		server.Write(fixed)
+		server.Close()
+	}()
+
+	c := &conn{c: client, r: bufio.NewReader(client)}
+	if _, err := c.read(); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("got %v, want message too large", err)
+	}
+}
+
+func TestReadBigEndian(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		// An error reply to serial 3 with no body
+		msg := []byte{'B', msgError, 0, 1, 0, 0, 0, 0, 0, 0, 0, 9, 0, 0, 0, 0}
+		var fields []byte
+		fields = append(fields, fieldReplySerial, 1, 'u', 0, 0, 0, 0, 3)
+		fields = append(fields, fieldErrorName, 1, 's', 0, 0, 0, 0, 3, 'x', '.', 'y', 0)
+		binary.BigEndian.PutUint32(msg[12:], uint32(len(fields)))
+		msg = append(msg, fields...)
+		for len(msg)%8 != 0 {
+			msg = append(msg, 0)
+		}
+		server.Write(msg)
+		server.Close()
+	}()
+
+	c := &conn{c: client, r: bufio.NewReader(client)}
+	msg, err := c.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.typ != msgError || msg.replySerial != 3 || msg.errorName != "x.y" {
+		t.Fatalf("got %+v", msg)
+	}
+}
+
+func TestArrayLength(t *testing.T) {
+	var e encoder
+	e.byte(1)
+	a := e.arrayStart(8)
+	e.string("ab")
+	e.arrayEnd(a)
+
+	data := e.buf.Bytes()
+	// The length sits at 4 after padding and excludes the padding to 8
+	if got := binary.LittleEndian.Uint32(data[4:]); got != 7 {
+		t.Fatalf("array length is %d, want 7", got)
+	}
+	if len(data) != 15 {
+		t.Fatalf("encoded %d bytes, want 15", len(data))
+	}
+}
+
+func TestUnitName(t *testing.T) {
+	for _, tc := range []struct {
+		suffix string
+		parts  []string
+		want   string
+	}{
+		{"scope", []string{"gemstone", "web"}, "gemstone-web.scope"},
+		{"scope", []string{"gemstone", "my-app"}, `gemstone-my\x2dapp.scope`},
+		{"slice", []string{"a b", ".hidden", "v1.2"}, `a\x20b-\x2ehidden-v1.2.slice`},
+	} {
+		if got := UnitName(tc.suffix, tc.parts...); got != tc.want {
+			t.Errorf("UnitName(%q, %q) = %q, want %q", tc.suffix, tc.parts, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package systemd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// scopeWait is how long StartScope waits for the process to be moved
+const scopeWait = 2 * time.Second
+
+// Booted reports whether the host runs systemd as its init system
+func Booted() bool {
+	_, err := os.Stat("/run/systemd/system")
+	return err == nil
+}
+
+// Scope describes a transient scope unit
+type Scope struct {
+	// Unit is the name of the unit, ending in .scope
+	Unit        string
+	Description string
+	// Slice places the scope below a slice instead of system.slice
+	Slice string
+	// Delegate hands the cgroup of the scope to the caller, so it may
+	// change its limits
+	Delegate bool
+}
+
+// StartScope creates a transient scope unit containing pid through the
+// D-Bus API of systemd, and returns once pid was moved into it
+func StartScope(s Scope, pid int) error {
+	c, err := dial()
+	if err != nil {
+		return fmt.Errorf("failed to connect to systemd: %w", err)
+	}
+	defer c.close()
+
+	var e encoder
+	e.string(s.Unit)
+	e.string("fail")
+
+	props := e.arrayStart(8)
+	property := func(name, sig string, value func()) {
+		e.align(8)
+		e.string(name)
+		e.signature(sig)
+		value()
+	}
+	if s.Description != "" {
+		property("Description", "s", func() { e.string(s.Description) })
+	}
+	if s.Slice != "" {
+		property("Slice", "s", func() { e.string(s.Slice) })
+	}
+	property("Delegate", "b", func() { e.bool(s.Delegate) })
+	// Remove the unit once its processes are gone, even if they failed
+	property("CollectMode", "s", func() { e.string("inactive-or-failed") })
+	property("PIDs", "au", func() {
+		pids := e.arrayStart(4)
+		e.uint32(uint32(pid))
+		e.arrayEnd(pids)
+	})
+	e.arrayEnd(props)
+
+	// No auxiliary units
+	aux := e.arrayStart(8)
+	e.arrayEnd(aux)
+
+	if _, err := c.call("org.freedesktop.systemd1", "/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager",
+		"StartTransientUnit", "ssa(sv)a(sa(sv))", e.buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to start %s: %w", s.Unit, err)
+	}
+
+	// The job moves the process asynchronously
+	deadline := time.Now().Add(scopeWait)
+	for {
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(data), "/"+s.Unit) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("process %d was not moved into %s", pid, s.Unit)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// UnitName builds a valid unit name from parts joined with dashes, escaping
+// characters systemd doesn't allow the way systemd-escape does
+func UnitName(suffix string, parts ...string) string {
+	var b strings.Builder
+	for i, part := range parts {
+		if i > 0 {
+			b.WriteByte('-')
+		}
+		for j := 0; j < len(part); j++ {
+			c := part[j]
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == ':':
+				b.WriteByte(c)
+			case c == '.' && j > 0:
+				b.WriteByte(c)
+			default:
+				fmt.Fprintf(&b, `\x%02x`, c)
+			}
+		}
+	}
+	return b.String() + "." + suffix
+}
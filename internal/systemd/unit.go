@@ -0,0 +1,22 @@
+package systemd
+
+import "fmt"
+
+// RestartUnit restarts a unit through the D-Bus API of systemd, stopping it
+// first if it runs. It returns once the restart job is queued.
+func RestartUnit(unit string) error {
+	c, err := dial()
+	if err != nil {
+		return fmt.Errorf("failed to connect to systemd: %w", err)
+	}
+	defer c.close()
+
+	var e encoder
+	e.string(unit)
+	e.string("replace")
+	if _, err := c.call("org.freedesktop.systemd1", "/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager",
+		"RestartUnit", "ss", e.buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to restart %s: %w", unit, err)
+	}
+	return nil
+}
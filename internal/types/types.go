@@ -14,45 +14,156 @@ const (
 	StatusStopping   ProcessStatus = "stopping"
 	StatusErrored    ProcessStatus = "errored"
 	StatusRestarting ProcessStatus = "restarting"
+	// StatusQueued is a process waiting for a slot in the start queue
+	StatusQueued ProcessStatus = "queued"
+	// StatusCrashLooped is a process that used up its restart budget and
+	// is no longer restarted automatically until the cooldown passes
+	StatusCrashLooped ProcessStatus = "crash_looped"
 )
 
 // ProcessInfo represents detailed information about a managed process
 type ProcessInfo struct {
-	ID            string            `json:"id"`
-	Name          string            `json:"name"`
-	Status        ProcessStatus     `json:"status"`
-	PID           int               `json:"pid,omitempty"`
-	Command       string            `json:"command"`
-	Args          []string          `json:"args,omitempty"`
-	WorkDir       string            `json:"work_dir,omitempty"`
-	Env           map[string]string `json:"env,omitempty"`
-	AutoStart     bool              `json:"auto_start"`
-	AutoRestart   bool              `json:"auto_restart"`
-	MaxRestarts   int               `json:"max_restarts"`
-	RestartCount  int               `json:"restart_count"`
-	User          string            `json:"user,omitempty"`
-	Group         string            `json:"group,omitempty"`
-	CreatedAt     time.Time         `json:"created_at"`
-	StartedAt     *time.Time        `json:"started_at,omitempty"`
-	StoppedAt     *time.Time        `json:"stopped_at,omitempty"`
-	Uptime        int64             `json:"uptime,omitempty"` // seconds
-	CPU           float64           `json:"cpu,omitempty"`    // percentage
-	Memory        uint64            `json:"memory,omitempty"` // bytes
-	MemoryPercent float64           `json:"memory_percent,omitempty"`
+	ID                    string            `json:"id"`
+	Name                  string            `json:"name"`
+	Description           string            `json:"description,omitempty"`
+	Homepage              string            `json:"homepage,omitempty"`
+	OwnerContact          string            `json:"owner_contact,omitempty"`
+	Status                ProcessStatus     `json:"status"`
+	PID                   int               `json:"pid,omitempty"`
+	Command               string            `json:"command"`
+	Args                  []string          `json:"args,omitempty"`
+	WorkDir               string            `json:"work_dir,omitempty"`
+	Stdin                 string            `json:"stdin,omitempty"`
+	Env                   map[string]string `json:"env,omitempty"`
+	AutoStart             bool              `json:"auto_start"`
+	AutoRestart           bool              `json:"auto_restart"`
+	MaxRestarts           int               `json:"max_restarts"`
+	RestartCount          int               `json:"restart_count"`
+	Generation            int               `json:"generation"` // incremented on every start
+	User                  string            `json:"user,omitempty"`
+	Group                 string            `json:"group,omitempty"`
+	Timezone              string            `json:"timezone,omitempty"`
+	Locale                string            `json:"locale,omitempty"`
+	OutputEncoding        string            `json:"output_encoding,omitempty"`
+	Namespace             string            `json:"namespace"`
+	LogPipe               string            `json:"log_pipe,omitempty"`
+	LogQuota              int               `json:"log_quota,omitempty"` // MB
+	RestartPolicy         string            `json:"restart_policy,omitempty"`
+	MaxUptime             string            `json:"max_uptime,omitempty"`
+	Schedule              string            `json:"schedule,omitempty"`
+	RestartOnBinaryChange bool              `json:"restart_on_binary_change,omitempty"`
+	WaitFor               *WaitFor          `json:"wait_for,omitempty"`
+	SoftLimits            *SoftLimits       `json:"soft_limits,omitempty"`
+	Throttled             bool              `json:"throttled,omitempty"`
+	Reserve               *Reservation      `json:"reserve,omitempty"`
+	OOMScoreAdj           int               `json:"oom_score_adj,omitempty"`
+	Capabilities          *Capabilities     `json:"capabilities,omitempty"`
+	Seccomp               string            `json:"seccomp,omitempty"`
+	AppArmorProfile       string            `json:"apparmor_profile,omitempty"`
+	SELinuxLabel          string            `json:"selinux_label,omitempty"`
+	Network               *Network          `json:"network,omitempty"`
+	MonitorPaths          []string          `json:"monitor_paths,omitempty"`
+	DiskAlert             int               `json:"disk_alert,omitempty"` // MB
+	Ports                 []string          `json:"ports,omitempty"`
+	OutputWatchdog        *OutputWatchdog   `json:"output_watchdog,omitempty"`
+	Standby               *Standby          `json:"standby,omitempty"`
+	Fetch                 *Fetch            `json:"fetch,omitempty"`
+	Source                *Source           `json:"source,omitempty"`
+	// Revision is the commit of the source checkout
+	Revision string `json:"revision,omitempty"`
+	// LastExit describes how and why the process last exited
+	LastExit *LastExit `json:"last_exit,omitempty"`
+	// NextRun is when the schedule starts the process next, LastRun is its
+	// last finished run
+	NextRun *time.Time    `json:"next_run,omitempty"`
+	LastRun *ScheduledRun `json:"last_run,omitempty"`
+	// CrashLoopedAt is when the process went into the crash_looped state
+	CrashLoopedAt *time.Time `json:"crash_looped_at,omitempty"`
+	// Binary is the command binary as of the last start
+	Binary *Binary `json:"binary,omitempty"`
+	// BinaryUpdated is set while the binary on disk differs from the
+	// running one, until a restart picks it up
+	BinaryUpdated bool `json:"binary_updated,omitempty"`
+	// StandbyPID is the PID of the warm standby, StandbyReady is set once
+	// it is suspended and can take over
+	StandbyPID   int  `json:"standby_pid,omitempty"`
+	StandbyReady bool `json:"standby_ready,omitempty"`
+	// SampledAt is when CPU and memory usage were sampled
+	SampledAt *time.Time `json:"sampled_at,omitempty"`
+	// LastOutput is when the process last wrote a line to stdout or stderr
+	LastOutput *time.Time `json:"last_output,omitempty"`
+	// DiskUsage holds the last measured sizes of the monitored paths
+	DiskUsage map[string]uint64 `json:"disk_usage,omitempty"`
+	// Probes hold the last results of probing the ports
+	Probes []PortProbe `json:"probes,omitempty"`
+	// Report is what the running process reported on the notify socket
+	Report *Report `json:"report,omitempty"`
+	// Unit is the systemd scope unit the process runs in
+	Unit string `json:"unit,omitempty"`
+	// SecurityContext is the AppArmor profile or SELinux context the
+	// process runs under
+	SecurityContext string     `json:"security_context,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	StoppedAt       *time.Time `json:"stopped_at,omitempty"`
+	Uptime          int64      `json:"uptime,omitempty"` // seconds
+	CPU             float64    `json:"cpu,omitempty"`    // percentage
+	Memory          uint64     `json:"memory,omitempty"` // bytes
+	MemoryPercent   float64    `json:"memory_percent,omitempty"`
 }
 
 // ProcessStats represents resource usage statistics
 type ProcessStats struct {
-	ID            string    `json:"id"`
-	PID           int       `json:"pid"`
-	CPU           float64   `json:"cpu"`
-	Memory        uint64    `json:"memory"`
-	MemoryPercent float64   `json:"memory_percent"`
-	NumThreads    int32     `json:"num_threads"`
-	NumFDs        int32     `json:"num_fds"`
-	ReadBytes     uint64    `json:"read_bytes"`
-	WriteBytes    uint64    `json:"write_bytes"`
-	Timestamp     time.Time `json:"timestamp"`
+	ID            string   `json:"id"`
+	PID           int      `json:"pid"`
+	CPU           float64  `json:"cpu"`
+	Memory        uint64   `json:"memory"`
+	MemoryPercent float64  `json:"memory_percent"`
+	NumThreads    int32    `json:"num_threads"`
+	NumFDs        int32    `json:"num_fds"`
+	ReadBytes     uint64   `json:"read_bytes"`
+	WriteBytes    uint64   `json:"write_bytes"`
+	Logging       LogStats `json:"logging"`
+	// CPUTime is the user and system CPU time used by the run in seconds
+	CPUTime float64 `json:"cpu_time"`
+	// CPUUser and CPUSystem split CPUTime into user and system seconds
+	CPUUser   float64 `json:"cpu_user"`
+	CPUSystem float64 `json:"cpu_system"`
+	// VoluntaryCtxSwitches counts the times the run gave up the CPU, e.g. to
+	// wait for I/O, InvoluntaryCtxSwitches the times it was preempted
+	VoluntaryCtxSwitches   uint64 `json:"voluntary_ctx_switches"`
+	InvoluntaryCtxSwitches uint64 `json:"involuntary_ctx_switches"`
+	// MinorFaults and MajorFaults count the page faults of the run, major
+	// ones needed to read from disk
+	MinorFaults uint64 `json:"minor_faults"`
+	MajorFaults uint64 `json:"major_faults"`
+	// Disk holds the sizes of the monitored paths in bytes
+	Disk map[string]uint64 `json:"disk,omitempty"`
+	// Probes hold the last results of probing the ports
+	Probes []PortProbe `json:"probes,omitempty"`
+	// Samples is the number of samples averaged into a downsampled one
+	Samples   int       `json:"samples,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// LogStats represents counters of the log capture pipeline of a process
+type LogStats struct {
+	LinesCaptured uint64 `json:"lines_captured"`
+	BytesWritten  uint64 `json:"bytes_written"`
+	LinesDropped  uint64 `json:"lines_dropped"`
+	Rotations     uint64 `json:"rotations"`
+	// StreamLinesDropped counts lines live log streams dropped because
+	// their client fell behind
+	StreamLinesDropped uint64 `json:"stream_lines_dropped"`
+}
+
+// LogStreamMessage is a line of a followed log. DroppedLines counts the
+// lines skipped so far because the client fell behind. Seq is the sequence
+// number of the line, which a client passes as after to resume following.
+type LogStreamMessage struct {
+	Line         string `json:"line"`
+	Seq          uint64 `json:"seq,omitempty"`
+	DroppedLines uint64 `json:"dropped_lines"`
 }
 
 // SystemStats represents system-wide statistics
@@ -69,6 +180,45 @@ type SystemStats struct {
 	Timestamp     time.Time `json:"timestamp"`
 }
 
+// DaemonStats represents resource usage of the daemon itself
+type DaemonStats struct {
+	PID           int       `json:"pid"`
+	CPU           float64   `json:"cpu"`
+	Memory        uint64    `json:"memory"` // RSS in bytes
+	NumFDs        int32     `json:"num_fds"`
+	NumThreads    int32     `json:"num_threads"`
+	Goroutines    int       `json:"goroutines"`
+	HeapAlloc     uint64    `json:"heap_alloc"`
+	HeapSys       uint64    `json:"heap_sys"`
+	NumGC         uint32    `json:"num_gc"`
+	GCPauseTotal  uint64    `json:"gc_pause_total_ns"`
+	LastGC        time.Time `json:"last_gc,omitempty"`
+	GCCPUFraction float64   `json:"gc_cpu_fraction"`
+	GOMAXPROCS    int       `json:"gomaxprocs"`
+	OpenLogFiles  int       `json:"open_log_files"`
+	Streams       int       `json:"streams"`         // streaming API requests
+	Chaos         string    `json:"chaos,omitempty"` // chaos mode faults, if on
+	Uptime        int64     `json:"uptime"`          // seconds
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// PluginInfo represents a loaded plugin
+type PluginInfo struct {
+	Name        string   `json:"name"`
+	Path        string   `json:"path"`
+	Description string   `json:"description,omitempty"`
+	Hooks       []string `json:"hooks,omitempty"`
+	Commands    []string `json:"commands,omitempty"`
+	Collectors  []string `json:"collectors,omitempty"`
+	Running     bool     `json:"running"`
+}
+
+// PluginResult represents the result of a plugin command
+type PluginResult struct {
+	Output string      `json:"output,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
 // LogEntry represents a log entry
 type LogEntry struct {
 	ID        string    `json:"id"`
@@ -78,6 +228,88 @@ type LogEntry struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// EventType identifies the kind of an event
+type EventType string
+
+const (
+	EventLogQuota   EventType = "log_quota"
+	EventDiskAlert  EventType = "disk_alert"
+	EventPortDown   EventType = "port_down"
+	EventPortUp     EventType = "port_up"
+	EventNoOutput   EventType = "no_output"
+	EventStart      EventType = "start"
+	EventStop       EventType = "stop"
+	EventCrash      EventType = "crash"
+	EventRestart    EventType = "restart"
+	EventErrored    EventType = "errored"
+	EventPause      EventType = "pause"
+	EventResume     EventType = "resume"
+	EventThrottle   EventType = "throttle"
+	EventUnthrottle EventType = "unthrottle"
+	// EventConfigChange is published when a definition is created, updated,
+	// rolled back or deleted
+	EventConfigChange EventType = "config_change"
+	// EventPersistFailed is published when the process definitions could not
+	// be saved to disk
+	EventPersistFailed EventType = "persist_failed"
+	// EventDaemonLimit is published when the daemon goes over or back under
+	// one of its own limits
+	EventDaemonLimit EventType = "daemon_limit"
+	// EventDeploy is published when the source of a process was fetched and
+	// checked out by a deploy
+	EventDeploy EventType = "deploy"
+	// EventLogArchive is published when rotated log files of a process were
+	// uploaded to the log archive
+	EventLogArchive EventType = "log_archive"
+	// EventChaos is published when chaos mode injects a fault
+	EventChaos EventType = "chaos"
+	// EventReady is published when a process reports that it is ready
+	EventReady EventType = "ready"
+	// EventHealth is published when the health a process reports changes
+	EventHealth EventType = "health"
+	// EventCrashLoop is published with high priority when a process used
+	// up its restart budget
+	EventCrashLoop EventType = "crash_loop"
+	// EventBinaryChanged is published when the command binary of a running
+	// process changes on disk
+	EventBinaryChanged EventType = "binary_changed"
+	// EventUpdateAvailable is published when the daemon finds a release
+	// newer than itself
+	EventUpdateAvailable EventType = "update_available"
+	// EventReset is published when the restart counters and error state
+	// of a process are cleared
+	EventReset EventType = "reset"
+	// EventStandbyReady is published when the warm standby of a process is
+	// suspended and ready to take over
+	EventStandbyReady EventType = "standby_ready"
+	// EventFailover is published when the standby of a process takes over
+	// from the running one
+	EventFailover EventType = "failover"
+	// EventLockdown and EventLockdownLifted are published when the API is
+	// locked down and when the lockdown ends
+	EventLockdown       EventType = "lockdown"
+	EventLockdownLifted EventType = "lockdown_lifted"
+	// EventAnnotation is published when a note is attached to a process
+	EventAnnotation EventType = "annotation"
+)
+
+// Event represents something that happened in the daemon
+type Event struct {
+	ID          string                 `json:"id"`
+	Type        EventType              `json:"type"`
+	ProcessID   string                 `json:"process_id,omitempty"`
+	ProcessName string                 `json:"process_name,omitempty"`
+	Namespace   string                 `json:"namespace,omitempty"`
+	Message     string                 `json:"message"`
+	Data        map[string]interface{} `json:"data,omitempty"`
+	Timestamp   time.Time              `json:"timestamp"`
+	// Priority is set on events that need attention
+	Priority string `json:"priority,omitempty"`
+}
+
+// PriorityHigh marks events that need attention
+const PriorityHigh = "high"
+
 // StartRequest represents a request to start a new process
 type StartRequest struct {
 	Name        string            `json:"name"`
@@ -90,6 +322,537 @@ type StartRequest struct {
 	MaxRestarts int               `json:"max_restarts"`
 	User        string            `json:"user,omitempty"`
 	Group       string            `json:"group,omitempty"`
+	Namespace   string            `json:"namespace,omitempty"`
+	LogPipe     string            `json:"log_pipe,omitempty"`
+	LogQuota    int               `json:"log_quota,omitempty"` // MB
+	// Stdin is a file or named pipe the process reads as standard input,
+	// /dev/null if empty
+	Stdin string `json:"stdin,omitempty"`
+	// Description, Homepage and OwnerContact tell whoever is on call what
+	// the process is and who to contact about it
+	Description  string `json:"description,omitempty"`
+	Homepage     string `json:"homepage,omitempty"`
+	OwnerContact string `json:"owner_contact,omitempty"`
+	// Timezone and Locale set TZ and LANG, e.g. "Europe/Berlin" and
+	// "de_DE.UTF-8"
+	Timezone string `json:"timezone,omitempty"`
+	Locale   string `json:"locale,omitempty"`
+	// OutputEncoding is the character encoding of the output, e.g.
+	// "windows-1252", transcoded to UTF-8 when captured. It defaults to the
+	// charset of Locale.
+	OutputEncoding string `json:"output_encoding,omitempty"`
+	// RestartPolicy is the path of a Starlark script deciding on restarts
+	RestartPolicy string `json:"restart_policy,omitempty"`
+	// MaxUptime restarts the process gracefully once it has been up this
+	// long, e.g. "7d"
+	MaxUptime string `json:"max_uptime,omitempty"`
+	// Schedule is a cron expression, e.g. "*/5 * * * *", on which the
+	// process is started instead of being kept running
+	Schedule string `json:"schedule,omitempty"`
+	// RestartOnBinaryChange restarts the running process when the command
+	// binary on disk changes
+	RestartOnBinaryChange bool `json:"restart_on_binary_change,omitempty"`
+	// WaitFor delays starting until a dependency is ready
+	WaitFor *WaitFor `json:"wait_for,omitempty"`
+	// SoftLimits throttle the process instead of restarting it
+	SoftLimits *SoftLimits `json:"soft_limits,omitempty"`
+	// Reserve is the CPU and memory the process is expected to use, checked
+	// by admission control before it starts
+	Reserve *Reservation `json:"reserve,omitempty"`
+	// OOMScoreAdj is written to /proc/<pid>/oom_score_adj after start,
+	// from -1000 (never killed) to 1000 (killed first)
+	OOMScoreAdj int `json:"oom_score_adj,omitempty"`
+	// Capabilities restrict the capabilities of the process
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+	// Seccomp is the path of an OCI seccomp profile applied before exec
+	Seccomp string `json:"seccomp,omitempty"`
+	// AppArmorProfile is the AppArmor profile the process is executed under
+	AppArmorProfile string `json:"apparmor_profile,omitempty"`
+	// SELinuxLabel is the SELinux context the process is executed under
+	SELinuxLabel string `json:"selinux_label,omitempty"`
+	// Network isolates the process in its own network namespace
+	Network *Network `json:"network,omitempty"`
+	// MonitorPaths are files or directories whose size is recorded
+	MonitorPaths []string `json:"monitor_paths,omitempty"`
+	// DiskAlert emits a disk_alert event when a monitored path grows
+	// above this many MB
+	DiskAlert int `json:"disk_alert,omitempty"`
+	// Ports are the addresses the process listens on, "port" or
+	// "host:port", which are probed while it runs
+	Ports []string `json:"ports,omitempty"`
+	// OutputWatchdog alerts when the process writes no output for a while
+	OutputWatchdog *OutputWatchdog `json:"output_watchdog,omitempty"`
+	// Standby keeps a suspended second run of the command to fail over to
+	Standby *Standby `json:"standby,omitempty"`
+	// Fetch downloads the command from a URL into the data directory
+	Fetch *Fetch `json:"fetch,omitempty"`
+	// Source is a git repository checked out as the working directory
+	Source *Source `json:"source,omitempty"`
+	// Instances, only in apply documents, defines that many copies of the
+	// process named name-0, name-1 and so on, each with its index in
+	// GEMSTONE_INSTANCE
+	Instances int `json:"instances,omitempty"`
+	// Scale, only in apply documents, changes the number of instances over
+	// time: the first rule whose schedule matches the current minute sets
+	// it, and Instances applies while none does
+	Scale []ScaleRule `json:"scale,omitempty"`
+}
+
+// ScaleRule sets the number of instances of a process while its schedule,
+// a cron expression matched against every minute, matches. "* 8-19 * * *"
+// covers 08:00 to 20:00.
+type ScaleRule struct {
+	Schedule  string `json:"schedule"`
+	Instances int    `json:"instances"`
+}
+
+// PortProbe is the result of connecting to a port of a process
+type PortProbe struct {
+	Address string  `json:"address"`
+	Latency float64 `json:"latency_ms"`
+	Error   string  `json:"error,omitempty"`
+	// Failures is the number of probes that failed in a row
+	Failures int `json:"failures,omitempty"`
+	// Backlog is the number of connections waiting to be accepted. Only
+	// known on Linux.
+	Backlog   int       `json:"backlog,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Network is the network setup of a process. An isolated process only has a
+// loopback interface; published ports are forwarded to it by the daemon.
+type Network struct {
+	Mode    string   `json:"mode,omitempty"`    // "host" (default) or "isolated"
+	Publish []string `json:"publish,omitempty"` // "[host_ip:]host_port:port", host_ip defaults to 127.0.0.1
+}
+
+// Capabilities are the Linux capabilities a process keeps or drops, by name
+// like CAP_NET_RAW. With keep, every capability not listed is dropped.
+type Capabilities struct {
+	Keep []string `json:"keep,omitempty"`
+	Drop []string `json:"drop,omitempty"`
+}
+
+// SoftLimits contain resource usage at which a process is throttled through
+// its cgroup and an alert is emitted, instead of the process being killed
+type SoftLimits struct {
+	CPUPercent  float64 `json:"cpu_percent,omitempty"`  // usage that triggers throttling, 100 = one core
+	CPUAction   string  `json:"cpu_action,omitempty"`   // "max" (default) or "weight"
+	CPUThrottle float64 `json:"cpu_throttle,omitempty"` // cpu.max while throttled in percent, default cpu_percent/2
+	CPUWeight   int     `json:"cpu_weight,omitempty"`   // cpu.weight while throttled, default 10
+	ThrottleFor string  `json:"throttle_for,omitempty"` // how long throttling lasts, default "5m"
+	MemoryHigh  int     `json:"memory_high,omitempty"`  // MB above which memory is reclaimed
+}
+
+// Reservation is the CPU and memory a process is expected to use
+type Reservation struct {
+	CPU    float64 `json:"cpu,omitempty"`    // cores
+	Memory int     `json:"memory,omitempty"` // MB
+}
+
+// Capacity is the host capacity admission control checks reservations
+// against, with what the running processes reserve
+type Capacity struct {
+	Mode           string  `json:"mode"`
+	CPU            float64 `json:"cpu"`    // cores
+	Memory         int     `json:"memory"` // MB
+	ReservedCPU    float64 `json:"reserved_cpu"`
+	ReservedMemory int     `json:"reserved_memory"` // MB
+}
+
+// ExitReason is why a process exited
+type ExitReason string
+
+// Exit reasons
+const (
+	// ExitCrashed is an exit with a non-zero code or by a signal on its own
+	ExitCrashed ExitReason = "crashed"
+	// ExitCompleted is an exit with 0 on its own
+	ExitCompleted ExitReason = "exited"
+	// ExitOOM is a kill by the OOM killer, only detected for processes in
+	// a cgroup
+	ExitOOM ExitReason = "oom"
+	// ExitKilledByUser is a stop or restart asked for through the CLI or API
+	ExitKilledByUser ExitReason = "killed_by_user"
+	// ExitHealthFailed is a restart after a port probe or the output
+	// watchdog failed
+	ExitHealthFailed ExitReason = "health_failed"
+	// ExitScheduled is a stop or restart on a schedule
+	ExitScheduled ExitReason = "scheduled"
+	// ExitUpdated is a restart picking up a changed command binary
+	ExitUpdated ExitReason = "updated"
+)
+
+// LastExit describes the last exit of a process
+type LastExit struct {
+	Code   int        `json:"code"`
+	Signal string     `json:"signal,omitempty"`
+	Reason ExitReason `json:"reason"`
+	// Detail explains the reason, e.g. which port was down
+	Detail string    `json:"detail,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// ScheduledRun is a finished run of a process with a schedule
+type ScheduledRun struct {
+	Generation int `json:"generation"`
+	// Trigger is "schedule" for runs started by the schedule and "manual"
+	// for the others
+	Trigger    string     `json:"trigger"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt time.Time  `json:"finished_at"`
+	Duration   float64    `json:"duration"` // seconds
+	ExitCode   int        `json:"exit_code"`
+	Signal     string     `json:"signal,omitempty"`
+	Reason     ExitReason `json:"reason"`
+}
+
+// Run triggers
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// Binary identifies the command binary a process was started from
+type Binary struct {
+	Path    string    `json:"path"`
+	SHA256  string    `json:"sha256"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Report is the state a process reports about itself on the notify socket
+type Report struct {
+	// Ready is set once the process reported READY=1
+	Ready bool `json:"ready"`
+	// Health is healthy, degraded or unhealthy, empty until reported
+	Health string `json:"health,omitempty"`
+	// Status is free-form text, e.g. the progress of a shutdown
+	Status string `json:"status,omitempty"`
+	// Stopping is set once the process reported STOPPING=1
+	Stopping bool `json:"stopping,omitempty"`
+	// Details hold the custom X_ values the process reported
+	Details   map[string]string `json:"details,omitempty"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// OutputWatchdog emits a no_output event when a running process writes
+// nothing to stdout or stderr for Timeout, and restarts it with Restart
+type OutputWatchdog struct {
+	Timeout string `json:"timeout"` // duration, e.g. "10m"
+	Restart bool   `json:"restart,omitempty"`
+}
+
+// Standby is a second run of the command kept as a warm standby: it runs
+// for Warmup to boot and is then suspended with SIGSTOP until a failover
+// resumes it in place of the running one
+type Standby struct {
+	Warmup string `json:"warmup,omitempty"` // duration, e.g. "30s"
+}
+
+// Fetch is a script downloaded from URL and run as the command once its
+// checksum is verified
+type Fetch struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+// Source is a git repository the daemon clones and checks out at Ref, a
+// branch, tag or commit, to run the process in. An empty Ref follows the
+// default branch.
+type Source struct {
+	Git string `json:"git"`
+	Ref string `json:"ref,omitempty"`
+}
+
+// WaitFor is a readiness gate a process waits for before it is started
+type WaitFor struct {
+	TCP     string `json:"tcp"`               // host:port accepting connections
+	Timeout string `json:"timeout,omitempty"` // duration, e.g. "60s"
+}
+
+// DefinitionVersion is an entry in the definition history of a process
+type DefinitionVersion struct {
+	Version    int          `json:"version"`
+	Timestamp  time.Time    `json:"timestamp"`
+	Actor      string       `json:"actor,omitempty"`
+	Action     string       `json:"action"`
+	Changes    []string     `json:"changes,omitempty"`
+	Definition StartRequest `json:"definition"`
+}
+
+// RollbackRequest represents a request to restore a definition version
+type RollbackRequest struct {
+	Version int `json:"version"`
+}
+
+// Annotation is a note attached to a process at runtime, e.g. why it was
+// rolled back
+type Annotation struct {
+	Timestamp time.Time `json:"timestamp"`
+	Author    string    `json:"author,omitempty"`
+	Text      string    `json:"text"`
+}
+
+// AnnotateRequest represents a request to annotate a process
+type AnnotateRequest struct {
+	Text string `json:"text"`
+}
+
+// SimulateRequest describes a sequence of crashes to run the restart rules
+// of a process against
+type SimulateRequest struct {
+	ExitCode int    `json:"exit_code"`
+	Times    int    `json:"times"`
+	Uptime   string `json:"uptime,omitempty"` // how long each run lasts, e.g. "10s"
+}
+
+// SimulationStep is what the daemon would do after one simulated crash
+type SimulationStep struct {
+	Crash    int     `json:"crash"`
+	At       float64 `json:"at"` // seconds since the first start
+	ExitCode int     `json:"exit_code"`
+	Action   string  `json:"action"`
+	Delay    float64 `json:"delay,omitempty"` // seconds
+	Reason   string  `json:"reason,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// Simulation is the outcome of a simulated crash sequence
+type Simulation struct {
+	Process string           `json:"process"`
+	Policy  string           `json:"policy"`
+	Paused  bool             `json:"paused"`
+	Steps   []SimulationStep `json:"steps"`
+	Outcome string           `json:"outcome"`
+}
+
+// UsageRecord is the resource consumption of a namespace, or of a process
+// of it, during a period
+type UsageRecord struct {
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	Namespace       string    `json:"namespace"`
+	Process         string    `json:"process,omitempty"`
+	CPUSeconds      float64   `json:"cpu_seconds"`
+	MemoryByteHours float64   `json:"memory_byte_hours"`
+}
+
+// Health of processes and namespaces, from best to worst
+const (
+	HealthHealthy   = "healthy"
+	HealthDegraded  = "degraded"
+	HealthUnhealthy = "unhealthy"
+)
+
+// NamespaceStatus is the rollup of the processes of a namespace
+type NamespaceStatus struct {
+	Name     string  `json:"name"`
+	Total    int     `json:"total"`
+	Running  int     `json:"running"`
+	Stopped  int     `json:"stopped"`
+	Errored  int     `json:"errored"`
+	Restarts int     `json:"restarts"`
+	CPU      float64 `json:"cpu"`
+	Memory   uint64  `json:"memory"`
+	// Health is the worst health of its processes
+	Health string `json:"health"`
+	// Unhealthy lists the processes that aren't healthy
+	Unhealthy []string `json:"unhealthy,omitempty"`
+}
+
+// LaunchPlan is what starting a process would run, resolved from its
+// definition and the daemon's defaults without launching anything
+type LaunchPlan struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Command   string `json:"command"`
+	// Path is the executable the command resolves to
+	Path    string   `json:"path,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	WorkDir string   `json:"cwd,omitempty"`
+	Stdin   string   `json:"stdin,omitempty"`
+	// User and Group are the run user, the daemon's own if not set
+	User  string `json:"user"`
+	Group string `json:"group,omitempty"`
+	UID   uint32 `json:"uid"`
+	GID   uint32 `json:"gid"`
+	// Env is the complete environment, sorted, with the values of secret
+	// references redacted
+	Env         []string `json:"env"`
+	AutoRestart bool     `json:"auto_restart"`
+	MaxRestarts int      `json:"max_restarts"`
+	WaitFor     *WaitFor `json:"wait_for,omitempty"`
+	// SoftLimits are the soft limits with their defaults filled in
+	SoftLimits  *SoftLimits  `json:"soft_limits,omitempty"`
+	Reserve     *Reservation `json:"reserve,omitempty"`
+	OOMScoreAdj int          `json:"oom_score_adj,omitempty"`
+	// Cgroup is the cgroup created for the soft limits, unless they apply
+	// to the systemd scope Unit in Slice
+	Cgroup          string        `json:"cgroup,omitempty"`
+	Unit            string        `json:"unit,omitempty"`
+	Slice           string        `json:"slice,omitempty"`
+	Capabilities    *Capabilities `json:"capabilities,omitempty"`
+	Seccomp         string        `json:"seccomp,omitempty"`
+	AppArmorProfile string        `json:"apparmor_profile,omitempty"`
+	SELinuxLabel    string        `json:"selinux_label,omitempty"`
+	IsolatedNetwork bool          `json:"isolated_network,omitempty"`
+	// Notes tell what else happens before the process runs
+	Notes []string `json:"notes,omitempty"`
+	// Problems would make starting the process fail
+	Problems []string `json:"problems,omitempty"`
+}
+
+// TargetStatus represents a target and the state of its processes
+type TargetStatus struct {
+	Name     string   `json:"name"`
+	Requires []string `json:"requires,omitempty"`
+	// Processes are the names of the processes currently matching the
+	// target
+	Processes []string `json:"processes"`
+	Running   int      `json:"running"`
+	// Active is set when all processes of the target are running
+	Active bool `json:"active"`
+}
+
+// TargetAction is what starting or stopping a target did to one process
+type TargetAction struct {
+	Target  string `json:"target"`
+	Process string `json:"process"`
+	// Action is "started", "stopped", "running" (already) or "failed"
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// TargetResult is the outcome of starting or stopping a target, in the
+// order the processes were acted on
+type TargetResult struct {
+	Target  string         `json:"target"`
+	Actions []TargetAction `json:"actions"`
+}
+
+// GroupAction is what restarting a restart group did to one process
+type GroupAction struct {
+	Process string `json:"process"`
+	// Action is "stopped", "started", "skipped" (not started after a
+	// failure) or "failed"
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// GroupResult is the outcome of restarting a restart group, in the order
+// the processes were acted on
+type GroupResult struct {
+	Group   string        `json:"group"`
+	Actions []GroupAction `json:"actions"`
+}
+
+// ProcessPatch changes settings of an existing process. Unset fields are
+// left unchanged.
+type ProcessPatch struct {
+	AutoStart *bool `json:"auto_start,omitempty"`
+}
+
+// ApplyRequest is a desired-state document. The processes listed replace
+// the processes of the listed namespaces and of the namespaces they use.
+type ApplyRequest struct {
+	Namespaces []string       `json:"namespaces,omitempty"`
+	Processes  []StartRequest `json:"processes"`
+	DryRun     bool           `json:"dry_run"`
+	// Partial keeps the processes in scope that aren't listed instead of
+	// deleting them, except instances beyond the listed instance counts
+	Partial bool `json:"partial,omitempty"`
+	// Start also starts the listed processes that are stopped, errored or
+	// crash looped
+	Start bool `json:"start,omitempty"`
+}
+
+// ApplyAction is the kind of change an apply makes to a process
+type ApplyAction string
+
+const (
+	ApplyCreate    ApplyAction = "create"
+	ApplyUpdate    ApplyAction = "update"
+	ApplyDelete    ApplyAction = "delete"
+	ApplyUnchanged ApplyAction = "unchanged"
+)
+
+// ApplyChange describes the change an apply makes to a single process
+type ApplyChange struct {
+	Action    ApplyAction `json:"action"`
+	Name      string      `json:"name"`
+	Namespace string      `json:"namespace"`
+	ID        string      `json:"id,omitempty"`
+	Fields    []string    `json:"fields,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	// Started is set on existing processes started because of Start
+	Started bool `json:"started,omitempty"`
+}
+
+// ApplyResult represents the outcome of an apply
+type ApplyResult struct {
+	DryRun  bool          `json:"dry_run"`
+	Changes []ApplyChange `json:"changes"`
+}
+
+// Snapshot is the state of the processes of a daemon at a point in time
+type Snapshot struct {
+	Host      string            `json:"host"`
+	TakenAt   time.Time         `json:"taken_at"`
+	Processes []SnapshotProcess `json:"processes"`
+}
+
+// SnapshotProcess is a process in a snapshot: its definition and the
+// runtime state worth comparing
+type SnapshotProcess struct {
+	ID         string        `json:"id"`
+	Status     ProcessStatus `json:"status"`
+	Revision   string        `json:"revision,omitempty"`
+	Definition StartRequest  `json:"definition"`
+}
+
+// SnapshotDiffRequest asks for the differences between two snapshots. Without
+// B, A is compared to the current state.
+type SnapshotDiffRequest struct {
+	A      *Snapshot `json:"a"`
+	B      *Snapshot `json:"b,omitempty"`
+	Ignore []string  `json:"ignore,omitempty"`
+}
+
+// SnapshotDiff lists the processes added, removed and changed from snapshot
+// A to snapshot B. Processes are matched by namespace and name.
+type SnapshotDiff struct {
+	A         SnapshotOrigin `json:"a"`
+	B         SnapshotOrigin `json:"b"`
+	Added     []ProcessDiff  `json:"added"`
+	Removed   []ProcessDiff  `json:"removed"`
+	Changed   []ProcessDiff  `json:"changed"`
+	Unchanged int            `json:"unchanged"`
+}
+
+// Empty reports whether the snapshots hold the same processes
+func (d *SnapshotDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// SnapshotOrigin tells where and when a snapshot was taken
+type SnapshotOrigin struct {
+	Host    string    `json:"host"`
+	TakenAt time.Time `json:"taken_at"`
+}
+
+// ProcessDiff is a process that differs between two snapshots
+type ProcessDiff struct {
+	Name      string        `json:"name"`
+	Namespace string        `json:"namespace"`
+	Fields    []FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange is a field of a process with its value in each snapshot. A
+// missing value is null.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
 }
 
 // Response represents a generic API response
@@ -108,9 +871,16 @@ type HistoricalStats struct {
 
 // DaemonInfo represents daemon information
 type DaemonInfo struct {
-	Version      string      `json:"version"`
-	Uptime       int64       `json:"uptime"`
-	StartedAt    time.Time   `json:"started_at"`
-	ProcessCount int         `json:"process_count"`
-	SystemStats  SystemStats `json:"system_stats"`
+	Version      string    `json:"version"`
+	InstanceID   string    `json:"instance_id"`
+	ServerTime   time.Time `json:"server_time"`
+	Uptime       int64     `json:"uptime"`
+	StartedAt    time.Time `json:"started_at"`
+	ProcessCount int       `json:"process_count"`
+	Paused       bool      `json:"paused"`
+	Lockdown     bool      `json:"lockdown"`
+	Capacity     *Capacity `json:"capacity,omitempty"`
+	// UpdateAvailable is a newer release found by the daemon's update check
+	UpdateAvailable string      `json:"update_available,omitempty"`
+	SystemStats     SystemStats `json:"system_stats"`
 }
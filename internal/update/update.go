@@ -0,0 +1,313 @@
+package update
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PrismManager/gemstone/internal/config"
+)
+
+// DefaultURL is the release endpoint queried unless update.url is set, in
+// the format of the GitHub API
+const DefaultURL = "https://api.github.com/repos/PrismManager/gemstone/releases/latest"
+
+// ChecksumsAsset and SignatureAsset are the checksum file of a release and
+// its Ed25519 signature
+const (
+	ChecksumsAsset = "SHA256SUMS"
+	SignatureAsset = "SHA256SUMS.sig"
+)
+
+const (
+	// requestTimeout bounds a query of the release endpoint
+	requestTimeout = 30 * time.Second
+	// downloadTimeout bounds the download of a binary
+	downloadTimeout = 10 * time.Minute
+	// maxBinarySize is the largest binary that is downloaded
+	maxBinarySize = 200 * 1024 * 1024
+	// maxMetadataSize is the largest release description and checksum file
+	maxMetadataSize = 1024 * 1024
+)
+
+// ErrNoPublicKey is returned when a release can't be verified because no
+// key to check its signature is configured
+var ErrNoPublicKey = errors.New("update.public_key is not set, releases can't be verified")
+
+// Release is a published version with its downloadable assets
+type Release struct {
+	Version string
+	// Page is the human-readable page of the release
+	Page   string
+	assets map[string]string
+}
+
+// releaseJSON is a release as the GitHub API returns it
+type releaseJSON struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// Latest queries the release endpoint for the latest release
+func Latest(ctx context.Context, cfg config.UpdateConfig) (*Release, error) {
+	url := cfg.URL
+	if url == "" {
+		url = DefaultURL
+	}
+
+	data, err := get(ctx, url, maxMetadataSize, requestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	var r releaseJSON
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("invalid release from %s: %w", url, err)
+	}
+	if r.TagName == "" {
+		return nil, fmt.Errorf("invalid release from %s: no tag_name", url)
+	}
+
+	rel := &Release{Version: r.TagName, Page: r.HTMLURL, assets: make(map[string]string)}
+	for _, a := range r.Assets {
+		rel.assets[a.Name] = a.URL
+	}
+	return rel, nil
+}
+
+// AssetName is the release asset of a binary for this platform, e.g.
+// "gemstoned_linux_amd64"
+func AssetName(binary string) string {
+	return fmt.Sprintf("%s_%s_%s", binary, runtime.GOOS, runtime.GOARCH)
+}
+
+// Checksums downloads the checksum file of the release and verifies its
+// signature against the configured public key. It returns the SHA-256 of
+// each asset by name.
+func (r *Release) Checksums(ctx context.Context, cfg config.UpdateConfig) (map[string]string, error) {
+	if cfg.PublicKey == "" {
+		return nil, ErrNoPublicKey
+	}
+	key, err := base64.StdEncoding.DecodeString(cfg.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid update.public_key: must be a base64 Ed25519 public key")
+	}
+
+	sums, err := r.asset(ctx, ChecksumsAsset)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := r.asset(ctx, SignatureAsset)
+	if err != nil {
+		return nil, err
+	}
+	// Signatures are published raw or base64 encoded
+	if len(sig) != ed25519.SignatureSize {
+		if sig, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", SignatureAsset, err)
+		}
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), sums, sig) {
+		return nil, fmt.Errorf("the signature of %s of %s doesn't match update.public_key", ChecksumsAsset, r.Version)
+	}
+
+	// Lines are "<sha256>  <name>" as sha256sum writes them
+	checksums := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			checksums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+		}
+	}
+	return checksums, nil
+}
+
+// Download saves an asset as an executable file at path after checking it
+// against its signed checksum. Nothing is left at path if it doesn't match.
+func (r *Release) Download(ctx context.Context, name, want, path string) error {
+	url, ok := r.assets[name]
+	if !ok {
+		return fmt.Errorf("release %s has no %s", r.Version, name)
+	}
+	if want == "" {
+		return fmt.Errorf("%s of %s lists no checksum for %s", ChecksumsAsset, r.Version, name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+	resp, err := request(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(resp.Body, maxBinarySize+1))
+	if err == nil && n > maxBinarySize {
+		err = fmt.Errorf("larger than %d MB", maxBinarySize/1024/1024)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", name, err)
+	}
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != want {
+		return fmt.Errorf("checksum mismatch for %s: got sha256 %s, expected %s", name, sum, want)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// asset downloads a small asset of the release
+func (r *Release) asset(ctx context.Context, name string) ([]byte, error) {
+	url, ok := r.assets[name]
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s", r.Version, name)
+	}
+	return get(ctx, url, maxMetadataSize, requestTimeout)
+}
+
+// Newer reports whether version a is newer than b. Versions are compared
+// by their dot-separated numbers, a leading "v" and suffixes like "-rc1"
+// are ignored.
+func Newer(a, b string) bool {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
+
+func versionParts(v string) []int {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	var parts []int
+	for _, s := range strings.Split(v, ".") {
+		n, _ := strconv.Atoi(s)
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+func request(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, application/octet-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+func get(ctx context.Context, url string, limit int64, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	resp, err := request(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("failed to fetch %s: larger than %d KB", url, limit/1024)
+	}
+	return data, nil
+}
+
+// Checker looks for releases newer than the running version and remembers
+// the last one found
+type Checker struct {
+	cfg     config.UpdateConfig
+	current string
+
+	mu        sync.Mutex
+	available string
+}
+
+// NewChecker creates a checker for the running version
+func NewChecker(cfg config.UpdateConfig, current string) *Checker {
+	return &Checker{cfg: cfg, current: current}
+}
+
+// Check queries the release endpoint and returns the latest release if it
+// is newer than the running version, nil otherwise
+func (c *Checker) Check(ctx context.Context) (*Release, error) {
+	rel, err := Latest(ctx, c.cfg)
+	if err != nil {
+		return nil, err
+	}
+	if !Newer(rel.Version, c.current) {
+		rel = nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.available = ""
+	if rel != nil {
+		c.available = rel.Version
+	}
+	return rel, nil
+}
+
+// Available returns the version the last check found to be newer than the
+// running one, empty if there is none. A nil checker has none.
+func (c *Checker) Available() string {
+	if c == nil {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.available
+}